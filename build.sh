@@ -8,6 +8,7 @@ set -e
 # Configuration
 APP_NAME="byd-hass"
 VERSION=$(git rev-parse --short HEAD 2>/dev/null || echo "dev")
+COMMIT=$(git rev-parse HEAD 2>/dev/null || echo "")
 BUILD_DIR="build"
 BINARY_NAME="${APP_NAME}"
 
@@ -25,7 +26,7 @@ mkdir -p ${BUILD_DIR}
 # Build for Android ARM64 (GOOS=android avoids restricted syscalls like faccessat2)
 echo -e "${YELLOW}Building for Android ARM64...${NC}"
 GOOS=android GOARCH=arm64 CGO_ENABLED=0 go build -a -v \
-    -ldflags="-s -w -X main.version=${VERSION}" \
+    -ldflags="-s -w -X main.version=${VERSION} -X main.commit=${COMMIT}" \
     -o ${BUILD_DIR}/${BINARY_NAME} \
     ./cmd/byd-hass
 
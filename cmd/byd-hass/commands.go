@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/api"
+	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/transmission"
+)
+
+// commandUsage lists the subcommands; "run" is the default.
+const commandUsage = `usage: byd-hass [command] [flags]
+
+commands:
+  run              poll the car and run the outputs (default)
+  doctor           poll Diplus once, check every output and exit (status 1 on failure)
+  send-test        send one synthetic sample through every enabled output and exit
+  list-sensors     list the known sensors and whether they are monitored
+  config print     print the effective configuration
+  config validate  check the configuration and exit (status 1 on problems)`
+
+// parseCommand splits the subcommand off args (os.Args without the program
+// name). Flags without a command run the collector.
+func parseCommand(args []string) (string, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "run", args, nil
+	}
+	switch args[0] {
+	case "run", "doctor", "send-test", "list-sensors":
+		return args[0], args[1:], nil
+	case "config":
+		if len(args) < 2 || (args[1] != "print" && args[1] != "validate") {
+			return "", nil, fmt.Errorf("usage: byd-hass config print|validate [flags]")
+		}
+		return "config " + args[1], args[2:], nil
+	case "help":
+		return "", nil, fmt.Errorf("%s", commandUsage)
+	}
+	return "", nil, fmt.Errorf("unknown command %q\n%s", args[0], commandUsage)
+}
+
+// runValidate prints every problem with cfg: the settings
+// config.ValidateConfig rejects, the sensor list entries that are skipped and,
+// as warnings, the values flag parsing replaced with a default (warnings). It
+// returns 1 when there is any.
+func runValidate(w io.Writer, cfg *config.Config, warnings []string) int {
+	errs := append(config.ValidateConfig(cfg), sensorFieldErrors()...)
+	for _, e := range errs {
+		fmt.Fprintln(w, "error:", e)
+	}
+	for _, warn := range warnings {
+		fmt.Fprintln(w, "warning:", warn)
+	}
+	if len(errs) > 0 || len(warnings) > 0 {
+		return 1
+	}
+	fmt.Fprintln(w, "configuration OK")
+	return 0
+}
+
+// sensorFieldErrors returns sensors.ConfigWarnings keyed by the config file
+// key of the setting each comes from.
+func sensorFieldErrors() []config.FieldError {
+	errs := make([]config.FieldError, 0, len(sensors.ConfigWarnings))
+	for _, w := range sensors.ConfigWarnings {
+		field := "sensor_ids"
+		switch {
+		case strings.Contains(w, "transform"):
+			field = "transform"
+		case strings.Contains(w, "value map"):
+			field = "value_map"
+		}
+		errs = append(errs, config.FieldError{Field: field, Message: strings.TrimPrefix(w, "BYD_HASS_SENSOR_IDS: ")})
+	}
+	return errs
+}
+
+// runListSensors prints every sensor of sensors.AllSensors with whether it
+// is polled and published.
+func runListSensors(w io.Writer) int {
+	monitored := make(map[int]sensors.MonitoredSensor)
+	for _, m := range sensors.GetMonitoredSensors() {
+		monitored[m.ID] = m
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tUNIT\tMONITORED")
+	for _, def := range sensors.AllSensors {
+		state := "no"
+		if m, ok := monitored[def.ID]; ok {
+			state = "yes"
+			if !m.Publish {
+				state = "yes (not published)"
+			}
+			if m.Priority {
+				state += ", fast poll"
+			}
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", def.ID, def.EnglishName, def.UnitOfMeasurement, state)
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// doctor runs the self-test plus a test publish on MQTT and adds a hint on
+// how to fix each failure.
+func doctor(ctx context.Context, cfg *config.Config, diplusClient *api.DiplusClient, mqttTx *transmission.MQTTTransmitter, txs []transmission.Transmitter, setupFailures []checkResult) []checkResult {
+	results := selfTest(ctx, diplusClient, txs, setupFailures)
+	if mqttTx != nil {
+		res := checkResult{subsystem: "MQTT publish", detail: "test message accepted"}
+		pubCtx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+		res.err = mqttTx.PublishTest(pubCtx)
+		cancel()
+		// Right after the MQTT connection check.
+		i := slices.IndexFunc(results, func(r checkResult) bool { return r.subsystem == mqttTx.Name() })
+		results = slices.Insert(results, i+1, res)
+	}
+	for i := range results {
+		if results[i].err != nil {
+			results[i].hint = doctorHint(cfg, results[i].subsystem)
+		}
+	}
+	return results
+}
+
+// doctorHint suggests what to check when subsystem fails.
+func doctorHint(cfg *config.Config, subsystem string) string {
+	switch subsystem {
+	case "Diplus":
+		return fmt.Sprintf("check that the Diplus app is running on the head-unit and listening on %s (-diplus-url)", cfg.DiplusURL)
+	case "MQTT", "MQTT publish":
+		return "check the broker host, port, user and password in -mqtt-url, and -mqtt-ca/-mqtt-cert for TLS brokers"
+	case "ABRP":
+		return "check the internet connection of the head-unit (api.iternio.com) and -abrp-api-key/-abrp-token"
+	case "Home Assistant REST":
+		return "check -ha-url and that -ha-token is a valid long-lived access token"
+	}
+	return ""
+}
+
+// sendTest transmits one synthetic sample through every output and closes
+// all but MQTT, so buffering outputs flush. MQTT stays open: a clean
+// disconnect would mark the car offline in Home Assistant.
+func sendTest(ctx context.Context, txs []transmission.Transmitter, setupFailures []checkResult) []checkResult {
+	results := append([]checkResult(nil), setupFailures...)
+	data := syntheticSensorData(time.Now())
+	for _, tx := range txs {
+		res := checkResult{subsystem: tx.Name(), detail: "sample sent"}
+		sendCtx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+		res.err = tx.Transmit(sendCtx, data)
+		if _, isMQTT := tx.(*transmission.MQTTTransmitter); !isMQTT {
+			if err := tx.Close(sendCtx); res.err == nil {
+				res.err = err
+			}
+		}
+		cancel()
+		results = append(results, res)
+	}
+	return results
+}
+
+// syntheticSensorData is a plausible parked car, half charged and without a
+// location, so no tracker moves.
+func syntheticSensorData(now time.Time) *sensors.SensorData {
+	v := func(f float64) *float64 { return &f }
+	return &sensors.SensorData{
+		Timestamp:          now,
+		Speed:              v(0),
+		Mileage:            v(12345),
+		PowerStatus:        v(1),
+		EnginePower:        v(0),
+		BatteryPercentage:  v(50),
+		CabinTemperature:   v(21),
+		OutsideTemperature: v(15),
+	}
+}
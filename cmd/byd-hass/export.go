@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/Allthebester/byd-hass/internal/transmission"
+)
+
+// runExportHistory writes the history selected by query (as for
+// /api/history) to stdout and returns the exit status. It only reads the
+// history directory, so it may run alongside the collector.
+func runExportHistory(cfg *config.Config, query string) int {
+	if cfg.HistoryDir == "" {
+		fmt.Fprintln(os.Stderr, "export-history: no -history-dir configured")
+		return 1
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export-history: invalid query: %v\n", err)
+		return 1
+	}
+	q, err := transmission.ParseHistoryQuery(values)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export-history: %v\n", err)
+		return 1
+	}
+	out := bufio.NewWriter(os.Stdout)
+	err = transmission.ExportHistoryDir(cfg.HistoryDir, out, q)
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export-history: %v\n", err)
+		return 1
+	}
+	return 0
+}
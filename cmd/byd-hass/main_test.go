@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/config"
+)
+
+func TestReloadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		poll    time.Duration
+	}{
+		{"valid", []string{"-poll-interval", "20s"}, false, 20 * time.Second},
+		{"version is ignored", []string{"-version", "-poll-interval", "30s"}, false, 30 * time.Second},
+		{"warning fails the reload", []string{"-poll-interval", "soon"}, true, 0},
+		{"unknown flag", []string{"-no-such-flag"}, true, 0},
+	}
+	args := os.Args
+	defer func() { os.Args = args }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = append([]string{"byd-hass"}, tt.args...)
+			cfg, err := reloadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reloadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.PollInterval != tt.poll {
+				t.Errorf("PollInterval = %s, want %s", cfg.PollInterval, tt.poll)
+			}
+		})
+	}
+}
+
+func TestPollIntervalFlag(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		want      time.Duration
+		wantWarns int
+	}{
+		{"default", nil, config.DiplusPollInterval, 0},
+		{"set", []string{"-poll-interval", "15s"}, 15 * time.Second, 0},
+		{"plain seconds", []string{"-poll-interval", "30"}, 30 * time.Second, 0},
+		{"below the minimum falls back", []string{"-poll-interval", "100ms"}, config.DiplusPollInterval, 1},
+		{"invalid falls back", []string{"-poll-interval", "often"}, config.DiplusPollInterval, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFlagParser()
+			fs := flag.NewFlagSet("byd-hass", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			flags, err := p.parse(fs, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if flags.cfg.PollInterval != tt.want {
+				t.Errorf("PollInterval = %s, want %s", flags.cfg.PollInterval, tt.want)
+			}
+			if len(p.warnings) != tt.wantWarns {
+				t.Errorf("warnings %q, want %d", p.warnings, tt.wantWarns)
+			}
+		})
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	envPath := filepath.Join(dir, "config.env")
+	if err := os.WriteFile(yamlPath, []byte("poll_interval: 20s\nenable_abrp: false\nmqtt_insecure: false\nsensor_ids: \"33,2\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(envPath, []byte("export BYD_HASS_POLL_INTERVAL=25s\nexport BYD_HASS_ENABLE_ABRP=false\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+		env  string // BYD_HASS_POLL_INTERVAL
+		want string
+	}{
+		{"yaml", []string{"-config", yamlPath}, "", "20s false false 33,2"},
+		{"environment overrides yaml", []string{"-config", yamlPath}, "30s", "30s false false 33,2"},
+		{"flag overrides yaml", []string{"-config", yamlPath, "-poll-interval", "40s"}, "", "40s false false 33,2"},
+		{"env file overrides environment", []string{"-config", envPath}, "30s", "25s false true "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BYD_HASS_POLL_INTERVAL", tt.env)
+			p := newFlagParser()
+			fs := flag.NewFlagSet("byd-hass", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			flags, err := p.parse(fs, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := flags.cfg
+			if got := fmt.Sprint(cfg.PollInterval, " ", cfg.EnableABRP, " ", cfg.MQTTInsecure, " ", cfg.SensorIDs); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if len(p.warnings) > 0 {
+				t.Errorf("warnings %q", p.warnings)
+			}
+		})
+	}
+}
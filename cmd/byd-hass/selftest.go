@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/api"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/transmission"
+	"github.com/sirupsen/logrus"
+)
+
+// selfTestTimeout bounds each self-test check.
+const selfTestTimeout = 10 * time.Second
+
+// checkResult is the outcome of one self-test check.
+type checkResult struct {
+	subsystem string
+	detail    string // shown on success
+	err       error
+	hint      string // shown on failure: what to check
+}
+
+// selfTest polls Diplus once and checks every transmitter. diplusClient is nil
+// when it could not be set up; that failure is expected in setupFailures.
+func selfTest(ctx context.Context, diplusClient *api.DiplusClient, txs []transmission.Transmitter, setupFailures []checkResult) []checkResult {
+	results := append([]checkResult(nil), setupFailures...)
+
+	if diplusClient != nil {
+		res := checkResult{subsystem: "Diplus"}
+		start := time.Now()
+		pollCtx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+		data, err := diplusClient.Poll(pollCtx)
+		cancel()
+		if err != nil {
+			res.err = err
+		} else {
+			res.detail = fmt.Sprintf("%d sensors in %s", sensors.CountValues(data), time.Since(start).Round(time.Millisecond))
+		}
+		results = append(results, res)
+	}
+
+	for _, tx := range txs {
+		res := checkResult{subsystem: tx.Name()}
+		if c, ok := tx.(transmission.Checker); ok {
+			checkCtx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+			res.err = c.Check(checkCtx)
+			cancel()
+			res.detail = "reachable"
+		} else {
+			res.detail = "set up (not verifiable without sending data)"
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// printSelfTestReport writes one PASS/FAIL line per subsystem and reports
+// whether everything passed.
+func printSelfTestReport(w io.Writer, results []checkResult) bool {
+	ok := true
+	for _, r := range results {
+		if r.err != nil {
+			ok = false
+			fmt.Fprintf(w, "FAIL  %-20s %v\n", r.subsystem, r.err)
+			if r.hint != "" {
+				fmt.Fprintf(w, "      %-20s hint: %s\n", "", r.hint)
+			}
+			continue
+		}
+		fmt.Fprintf(w, "PASS  %-20s %s\n", r.subsystem, r.detail)
+	}
+	return ok
+}
+
+// logSelfTestReport logs the results at startup; failures are warnings since
+// the outputs keep retrying.
+func logSelfTestReport(logger *logrus.Logger, results []checkResult) {
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			logger.WithError(r.err).WithField("subsystem", r.subsystem).Warn("Self-test failed")
+			continue
+		}
+		logger.WithFields(logrus.Fields{"subsystem": r.subsystem, "detail": r.detail}).Debug("Self-test passed")
+	}
+	if failed == 0 {
+		logger.WithField("checks", len(results)).Info("Self-test passed")
+	}
+}
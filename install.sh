@@ -386,6 +386,8 @@ while true; do
   # Export configuration variables if present
     if [ -f "\$CONFIG_PATH" ]; then
         . "\$CONFIG_PATH"
+        # Lets a reload re-read the settings from the same file
+        export BYD_HASS_CONFIG="\$CONFIG_PATH"
     fi
 
     # Rotate logs daily, keep only yesterday's copy
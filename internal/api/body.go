@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxDiplusResponseBytes bounds a decoded response; a full sensor set is
+	// a few KB.
+	maxDiplusResponseBytes = 1 << 20
+	// maxPooledBuffer keeps an unusually large response from pinning memory
+	// in the pool.
+	maxPooledBuffer = 64 << 10
+)
+
+// Response buffers and gzip readers are reused across polls: on the
+// head-unit a poll every few seconds otherwise churns through a fresh
+// buffer (and gzip window) each time.
+var (
+	bodyPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+	gzipPool sync.Pool // *gzip.Reader
+)
+
+// responseBody is a response body, possibly backed by a pooled buffer;
+// release returns the buffer once the caller is done with data.
+type responseBody struct {
+	data []byte
+	buf  *bytes.Buffer // nil when data is not pooled (e.g. a replayed capture)
+}
+
+func (b responseBody) release() {
+	if b.buf == nil || b.buf.Cap() > maxPooledBuffer {
+		return
+	}
+	bodyPool.Put(b.buf)
+}
+
+// readBody reads resp into a pooled buffer, decompressing it when Diplus
+// honoured our Accept-Encoding: gzip. Servers that ignore the header send
+// plain bodies, which are read as they are.
+func readBody(resp *http.Response) (responseBody, error) {
+	var r io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := getGzipReader(resp.Body)
+		if err != nil {
+			return responseBody{}, fmt.Errorf("invalid gzip response: %w", err)
+		}
+		defer gzipPool.Put(zr)
+		r = zr
+	}
+
+	buf := bodyPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	body := responseBody{buf: buf}
+	n, err := buf.ReadFrom(io.LimitReader(r, maxDiplusResponseBytes+1))
+	if err == nil && n > maxDiplusResponseBytes {
+		err = fmt.Errorf("response exceeds %d bytes", maxDiplusResponseBytes)
+	}
+	if err != nil {
+		body.release()
+		return responseBody{}, err
+	}
+	body.data = buf.Bytes()
+	return body, nil
+}
+
+func getGzipReader(r io.Reader) (*gzip.Reader, error) {
+	if zr, ok := gzipPool.Get().(*gzip.Reader); ok {
+		if err := zr.Reset(r); err != nil {
+			gzipPool.Put(zr)
+			return nil, err
+		}
+		return zr, nil
+	}
+	return gzip.NewReader(r)
+}
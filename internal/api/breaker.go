@@ -0,0 +1,66 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by Poll while the circuit breaker is open and
+// the next probe is not due yet.
+var ErrCircuitOpen = errors.New("Diplus circuit breaker open")
+
+// circuitBreaker stops hammering Diplus while it is down (typically while the
+// APK restarts). It opens after threshold consecutive failed poll cycles;
+// while open, only one probe request per probeInterval is let through, and a
+// successful probe closes it again.
+type circuitBreaker struct {
+	threshold     int // 0 disables the breaker
+	probeInterval time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	open      bool
+	nextProbe time.Time
+}
+
+// allow reports whether a poll may go ahead: always while closed, once per
+// probe interval while open.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	if now.Before(b.nextProbe) {
+		return false
+	}
+	b.nextProbe = now.Add(b.probeInterval)
+	return true
+}
+
+// record updates the breaker after a poll cycle and reports whether it
+// changed state.
+func (b *circuitBreaker) record(err error, now time.Time) (changed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		changed = b.open
+		b.open = false
+		return changed
+	}
+	b.failures++
+	if b.threshold > 0 && !b.open && b.failures >= b.threshold {
+		b.open = true
+		b.nextProbe = now.Add(b.probeInterval)
+		return true
+	}
+	return false
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	fail := errors.New("connection refused")
+	type step struct {
+		at          time.Duration // since start
+		record      bool          // record err instead of asking allow
+		err         error
+		wantAllow   bool
+		wantChanged bool
+		wantOpen    bool
+	}
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []step
+	}{
+		{"opens after the threshold", 3, []step{
+			{record: true, err: fail},
+			{record: true, err: fail},
+			{at: time.Second, wantAllow: true},
+			{record: true, err: fail, wantChanged: true, wantOpen: true},
+			{at: time.Second, wantOpen: true},
+			{at: 29 * time.Second, wantOpen: true},
+		}},
+		{"a success resets the count", 2, []step{
+			{record: true, err: fail},
+			{record: true},
+			{record: true, err: fail},
+			{at: time.Second, wantAllow: true},
+		}},
+		{"one probe per interval, success closes", 1, []step{
+			{record: true, err: fail, wantChanged: true, wantOpen: true},
+			{at: 30 * time.Second, wantAllow: true, wantOpen: true},
+			{at: 31 * time.Second, wantOpen: true},
+			{at: 31 * time.Second, record: true, err: fail, wantOpen: true},
+			{at: 60 * time.Second, wantAllow: true, wantOpen: true},
+			{at: 60 * time.Second, record: true, wantChanged: true},
+			{at: 60 * time.Second, wantAllow: true},
+		}},
+		{"disabled", 0, []step{
+			{record: true, err: fail},
+			{record: true, err: fail},
+			{record: true, err: fail},
+			{at: time.Second, wantAllow: true},
+		}},
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := circuitBreaker{threshold: tt.threshold, probeInterval: 30 * time.Second}
+			for i, st := range tt.steps {
+				now := start.Add(st.at)
+				if st.record {
+					if changed := b.record(st.err, now); changed != st.wantChanged {
+						t.Errorf("step %d: record changed = %v, want %v", i, changed, st.wantChanged)
+					}
+				} else if allowed := b.allow(now); allowed != st.wantAllow {
+					t.Errorf("step %d: allow = %v, want %v", i, allowed, st.wantAllow)
+				}
+				if open := b.isOpen(); open != st.wantOpen {
+					t.Errorf("step %d: open = %v, want %v", i, open, st.wantOpen)
+				}
+			}
+		})
+	}
+}
+
+// flappingDiplus wraps fakeDiplus: while down, or for the next failNext
+// requests, it answers with status instead.
+type flappingDiplus struct {
+	fakeDiplus
+	status   int
+	down     atomic.Bool
+	failNext atomic.Int32
+	calls    atomic.Int32
+}
+
+func (f *flappingDiplus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.calls.Add(1)
+	if f.down.Load() || f.failNext.Add(-1) >= 0 {
+		http.Error(w, "restarting", f.status)
+		return
+	}
+	f.fakeDiplus.ServeHTTP(w, r)
+}
+
+func TestPollRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		failNext  int32
+		retries   int
+		wantErr   bool
+		wantCalls int32
+	}{
+		{"no failures", http.StatusServiceUnavailable, 0, 2, false, 1},
+		{"5xx retried", http.StatusServiceUnavailable, 1, 2, false, 2},
+		{"gives up after the retries", http.StatusServiceUnavailable, 5, 1, true, 2},
+		{"4xx not retried", http.StatusNotFound, 1, 2, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diplus := &flappingDiplus{status: tt.status}
+			diplus.failNext.Store(tt.failNext)
+			srv := httptest.NewServer(diplus)
+			defer srv.Close()
+			c := NewDiplusClient(srv.URL, quietLogger())
+			c.SetRetries(tt.retries)
+
+			data, err := c.Poll(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Poll err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && data == nil {
+				t.Error("Poll returned no data")
+			}
+			if got := diplus.calls.Load(); got != tt.wantCalls {
+				t.Errorf("%d requests, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// errAny stands for any error other than ErrCircuitOpen.
+var errAny = errors.New("any error")
+
+// TestPollFlappingDiplus takes the client through a Diplus restart: failed
+// polls open the breaker, which then lets one probe through per interval
+// until Diplus answers again.
+func TestPollFlappingDiplus(t *testing.T) {
+	const probe = 100 * time.Millisecond
+	steps := []struct {
+		name          string
+		down          bool
+		wait          time.Duration
+		wantErr       error // ErrCircuitOpen, errAny or nil
+		wantCalls     int32 // requests made by this poll
+		wantConnected bool
+	}{
+		{"up", false, 0, nil, 1, true},
+		{"first failure", true, 0, errAny, 1, true},
+		{"breaker opens", true, 0, errAny, 1, false},
+		{"held back", true, 0, ErrCircuitOpen, 0, false},
+		{"failed probe", true, probe, errAny, 1, false},
+		{"held back after the probe", true, 0, ErrCircuitOpen, 0, false},
+		{"Diplus back, probe not due", false, 0, ErrCircuitOpen, 0, false},
+		{"successful probe", false, probe, nil, 1, true},
+		{"closed", false, 0, ErrNotModified, 1, true},
+	}
+	diplus := &flappingDiplus{status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(diplus)
+	defer srv.Close()
+	c := NewDiplusClient(srv.URL, quietLogger())
+	c.SetRetries(0)
+	c.SetCircuitBreaker(2, probe)
+
+	for _, st := range steps {
+		diplus.down.Store(st.down)
+		time.Sleep(st.wait)
+		before := diplus.calls.Load()
+		_, err := c.Poll(context.Background())
+		switch {
+		case st.wantErr == errAny:
+			if err == nil || errors.Is(err, ErrCircuitOpen) {
+				t.Errorf("%s: err = %v, want a failed request", st.name, err)
+			}
+		case !errors.Is(err, st.wantErr):
+			t.Errorf("%s: err = %v, want %v", st.name, err, st.wantErr)
+		}
+		if got := diplus.calls.Load() - before; got != st.wantCalls {
+			t.Errorf("%s: %d requests, want %d", st.name, got, st.wantCalls)
+		}
+		if got := c.Connected(); got != st.wantConnected {
+			t.Errorf("%s: Connected = %v, want %v", st.name, got, st.wantConnected)
+		}
+	}
+}
@@ -1,55 +1,299 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Allthebester/byd-hass/internal/sensors"
 	"github.com/sirupsen/logrus"
 )
 
+// Retry defaults for a single Diplus request within a poll cycle.
+const (
+	diplusDefaultRetries = 2
+	diplusRetryBackoff   = 500 * time.Millisecond // doubled per retry, ±50% jitter
+	diplusMaxBackoff     = 4 * time.Second
+	diplusProbeInterval  = 30 * time.Second
+)
+
+// diplusDefaultTimeout bounds a single request until SetTimeout is called.
+const diplusDefaultTimeout = 10 * time.Second
+
+// maxBatchParallelism caps concurrent batch requests.
+const maxBatchParallelism = 2
+
+// malformedWarnInterval throttles the per-sensor malformed value warning.
+const malformedWarnInterval = time.Minute
+
 // DiplusClient handles communication with the local Diplus API
 type DiplusClient struct {
-	baseURL    string
-	httpClient *http.Client
-	logger     *logrus.Logger
+	baseURL     string
+	httpClient  *http.Client
+	logger      *logrus.Logger
+	batchSize   int // max sensors per request; 0 = no limit
+	parallelism int // batches requested at once
+	retries     int // extra attempts per request on connection errors and 5xx
+
+	breaker   circuitBreaker
+	responses responseCache
+
+	mu              sync.Mutex
+	malformedWarned map[int]time.Time // last warning per sensor ID
+	requestDay      string            // local date requestsToday counts for
+	requestsToday   int
+
+	replay   frameSource      // non-nil when replaying a capture or simulating
+	recorder *captureRecorder // non-nil when recording Poll responses
 }
 
-// NewDiplusClient creates a new Diplus API client
+// NewDiplusClient creates a new Diplus API client. baseURL is the request
+// URL; {text} in it is replaced by the URL-encoded sensor template, which is
+// otherwise passed as ?text=.
 func NewDiplusClient(baseURL string, logger *logrus.Logger) *DiplusClient {
 	return &DiplusClient{
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:   diplusDefaultTimeout,
+			Transport: diplusTransport(diplusDefaultTimeout),
 		},
-		logger: logger,
+		logger:      logger,
+		parallelism: 1,
+		retries:     diplusDefaultRetries,
+		breaker:     circuitBreaker{probeInterval: diplusProbeInterval},
 	}
 }
 
-// GetSensorData fetches sensor data for the specified sensor IDs
-func (c *DiplusClient) GetSensorData(sensorIDs []int) (*sensors.SensorData, error) {
+// SetRetries sets how often a failed request is retried within a poll cycle
+// (jittered exponential backoff). Only connection errors and 5xx responses
+// are retried.
+func (c *DiplusClient) SetRetries(n int) {
+	c.retries = n
+}
+
+// SetCircuitBreaker opens the breaker after threshold consecutive failed
+// polls; while open, Diplus is only probed every probeInterval. threshold 0
+// disables the breaker.
+func (c *DiplusClient) SetCircuitBreaker(threshold int, probeInterval time.Duration) {
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	c.breaker.threshold = threshold
+	if probeInterval > 0 {
+		c.breaker.probeInterval = probeInterval
+	}
+}
+
+// Connected reports whether Diplus is considered reachable, i.e. the circuit
+// breaker is closed.
+func (c *DiplusClient) Connected() bool {
+	return !c.breaker.isOpen()
+}
+
+// RequestsToday returns how many HTTP requests were made to Diplus since
+// local midnight, retries and batches included.
+func (c *DiplusClient) RequestsToday() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.requestDay != time.Now().Format(time.DateOnly) {
+		return 0
+	}
+	return c.requestsToday
+}
+
+func (c *DiplusClient) countRequest() {
+	day := time.Now().Format(time.DateOnly)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if day != c.requestDay {
+		c.requestDay, c.requestsToday = day, 0
+	}
+	c.requestsToday++
+}
+
+// SetBatchSize caps the number of sensors requested per Diplus call. Some
+// firmware truncates long template URLs, so larger sets are split into several
+// requests whose results are merged. 0 disables batching.
+func (c *DiplusClient) SetBatchSize(n int) {
+	c.batchSize = n
+}
+
+// SetBatchParallelism sets how many batches are requested at once (1 =
+// sequentially, at most maxBatchParallelism; the head-unit's HTTP server is
+// easily overwhelmed).
+func (c *DiplusClient) SetBatchParallelism(n int) {
+	c.parallelism = min(max(n, 1), maxBatchParallelism)
+}
+
+// GetSensorData fetches sensor data for the specified sensor IDs, in batches
+// of at most batchSize sensors. A failed batch only loses its own sensors; an
+// error is returned when every batch failed. The merged data is stamped with
+// the start of the cycle, however long the batches took. Cancelling ctx
+// aborts the requests in flight.
+func (c *DiplusClient) GetSensorData(ctx context.Context, sensorIDs []int) (*sensors.SensorData, error) {
+	data, _, err := c.getSensorData(ctx, sensorIDs, false)
+	return data, err
+}
+
+// getSensorData is GetSensorData, writing the responses to the capture when
+// record is set and a recorder is configured. unchanged reports that every
+// batch answered exactly as the last time, so data is the previous parse.
+func (c *DiplusClient) getSensorData(ctx context.Context, sensorIDs []int, record bool) (data *sensors.SensorData, unchanged bool, err error) {
+	if c.replay != nil {
+		data, err := c.replayPoll()
+		return data, false, err
+	}
+
+	start := time.Now()
+	var recordAt time.Time // zero = don't record
+	if record && c.recorder != nil {
+		recordAt = start
+	}
+	if c.batchSize <= 0 || len(sensorIDs) <= c.batchSize {
+		return c.getSensorBatch(ctx, sensorIDs, recordAt)
+	}
+
+	batches := (len(sensorIDs) + c.batchSize - 1) / c.batchSize
+	type batchResult struct {
+		data      *sensors.SensorData
+		unchanged bool
+		err       error
+	}
+	results := make([]batchResult, batches)
+
+	var (
+		wg          sync.WaitGroup
+		unreachable atomic.Bool
+	)
+	sem := make(chan struct{}, max(c.parallelism, 1))
+	for b := 0; b < batches; b++ {
+		sem <- struct{}{}
+		// Diplus itself is unreachable (or the cycle was cancelled); the
+		// remaining batches would only fail too.
+		if unreachable.Load() || ctx.Err() != nil {
+			<-sem
+			break
+		}
+		ids := sensorIDs[b*c.batchSize : min((b+1)*c.batchSize, len(sensorIDs))]
+		wg.Add(1)
+		go func(b int, ids []int) {
+			defer func() { <-sem; wg.Done() }()
+			data, unchanged, err := c.getSensorBatch(ctx, ids, recordAt)
+			if errors.Is(err, errDiplusUnreachable) {
+				unreachable.Store(true)
+			}
+			results[b] = batchResult{data: data, unchanged: unchanged, err: err}
+		}(b, ids)
+	}
+	wg.Wait()
+
+	// Merge in request order so overlapping fields resolve the same way
+	// whatever the parallelism. Each batch is hashed on its own, so the
+	// cycle is unchanged only when every batch is.
+	var (
+		merged *sensors.SensorData
+		failed int
+		errs   []error
+	)
+	unchanged = true
+	for b, res := range results {
+		unchanged = unchanged && res.unchanged
+		switch {
+		case res.err != nil:
+			failed++
+			errs = append(errs, fmt.Errorf("batch %d/%d: %w", b+1, batches, res.err))
+		case res.data == nil:
+			// Not requested after Diplus turned out to be unreachable.
+			failed++
+		case merged == nil:
+			merged = res.data
+		default:
+			sensors.MergeSensorData(merged, res.data)
+		}
+	}
+
+	if merged == nil {
+		if len(errs) == 0 {
+			return nil, false, ctx.Err() // cancelled before the first batch
+		}
+		return nil, false, errors.Join(errs...)
+	}
+	merged.Timestamp = start
+	if failed > 0 {
+		c.logger.WithError(errors.Join(errs...)).WithFields(logrus.Fields{
+			"failed":  failed,
+			"batches": batches,
+		}).Warn("Some Diplus batches failed; keeping partial data")
+	}
+	return merged, unchanged, nil
+}
+
+// getSensorBatch fetches sensor data for the specified sensor IDs in a single
+// request, recording the response under recordAt unless it is zero.
+// unchanged reports that the response was identical to the last one for the
+// same sensors and data is a copy of its parse.
+func (c *DiplusClient) getSensorBatch(ctx context.Context, sensorIDs []int, recordAt time.Time) (data *sensors.SensorData, unchanged bool, err error) {
 	// Build the template string with Chinese sensor names
 	template := c.buildAPITemplate(sensorIDs)
 	if template == "" {
-		return nil, fmt.Errorf("no valid sensors found for IDs: %v", sensorIDs)
+		return nil, false, fmt.Errorf("no valid sensors found for IDs: %v", sensorIDs)
 	}
 
 	//c.logger.WithField("template", template).Debug("Built API template")
 
 	// Make the HTTP request
-	responseBody, err := c.makeRequest(template)
+	body, err := c.makeRequest(ctx, template)
+	if err != nil {
+		// The next response can't count as unchanged: the last poll
+		// didn't have this batch.
+		c.responses.forget(template)
+		return nil, false, fmt.Errorf("API request failed: %w", err)
+	}
+	if !recordAt.IsZero() {
+		c.record(recordAt, body.data)
+	}
+	cached, sum := c.responses.lookup(template, body.data)
+	if cached != nil {
+		body.release()
+		c.logger.Debug("Diplus response unchanged; reusing the last parse")
+		return cached, true, nil
+	}
+	data, err = c.parseResponse(body, len(sensorIDs))
 	if err != nil {
-		return nil, fmt.Errorf("API request failed: %w", err)
+		c.responses.forget(template)
+		return nil, false, err
 	}
+	c.responses.store(template, sum, data)
+	return data, false, nil
+}
 
-	// Parse the response
-	sensorData, err := sensors.ParseAPIResponse(responseBody)
+// parseResponse parses one response body and releases it. requested is the
+// number of sensors asked for; 0 skips the partial response check.
+func (c *DiplusClient) parseResponse(body responseBody, requested int) (*sensors.SensorData, error) {
+	// Parse the response; the parser copies what it keeps, so the buffer
+	// can go back to the pool straight after.
+	sensorData, report, err := sensors.ParseAPIResponseReport(body.data)
+	body.release()
+	for id, raw := range report.Malformed {
+		c.warnMalformed(id, raw)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse API response: %w", err)
 	}
+	if requested > 0 && requested > len(report.Present) {
+		c.logger.WithFields(logrus.Fields{
+			"requested": requested,
+			"present":   len(report.Present),
+		}).Debug("Partial Diplus response")
+	}
 
 	// Validate the data
 	if warnings := sensors.ValidateSensorData(sensorData); len(warnings) > 0 {
@@ -63,6 +307,30 @@ func (c *DiplusClient) GetSensorData(sensorIDs []int) (*sensors.SensorData, erro
 	return sensorData, nil
 }
 
+// warnMalformed logs an unparsable value at most once per
+// malformedWarnInterval per sensor; Diplus tends to send the same "--" on
+// every poll until the sensor comes back.
+func (c *DiplusClient) warnMalformed(id int, raw string) {
+	now := time.Now()
+	c.mu.Lock()
+	if c.malformedWarned == nil {
+		c.malformedWarned = make(map[int]time.Time)
+	}
+	last, seen := c.malformedWarned[id]
+	if seen && now.Sub(last) < malformedWarnInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.malformedWarned[id] = now
+	c.mu.Unlock()
+
+	entry := c.logger.WithFields(logrus.Fields{"sensor_id": id, "value": raw})
+	if def := sensors.GetSensorByID(id); def != nil {
+		entry = entry.WithField("sensor", def.EnglishName)
+	}
+	entry.Warn("Ignoring malformed Diplus value")
+}
+
 // buildAPITemplate creates the API template string using Chinese sensor names
 func (c *DiplusClient) buildAPITemplate(sensorIDs []int) string {
 	var parts []string
@@ -103,52 +371,127 @@ func (c *DiplusClient) buildAPITemplate(sensorIDs []int) string {
 	return template
 }
 
-// makeRequest makes the HTTP request to the Diplus API
-func (c *DiplusClient) makeRequest(template string) ([]byte, error) {
+// errDiplusUnreachable marks connection-level failures (refused, timeout).
+var errDiplusUnreachable = errors.New("Diplus unreachable")
+
+// retryableError is a failure worth retrying within the cycle.
+type retryableError struct{ err error }
+
+func (e retryableError) Error() string { return e.err.Error() }
+func (e retryableError) Unwrap() error { return e.err }
+
+// makeRequest makes the HTTP request to the Diplus API, retrying connection
+// errors and 5xx responses up to c.retries times with jittered exponential
+// backoff. Neither a request nor the wait between retries outlives ctx.
+func (c *DiplusClient) makeRequest(ctx context.Context, template string) (responseBody, error) {
+	// A probe while the breaker is open is a single attempt.
+	retries := c.retries
+	if c.breaker.isOpen() {
+		retries = 0
+	}
+	backoff := diplusRetryBackoff
+	for attempt := 0; ; attempt++ {
+		c.countRequest()
+		body, err := c.requestOnce(ctx, template)
+		var retryable retryableError
+		if err == nil || !errors.As(err, &retryable) || attempt >= retries {
+			return body, err
+		}
+		// ±50% jitter so several clients (or batches) don't retry in step.
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		c.logger.WithError(err).WithFields(logrus.Fields{
+			"attempt": attempt + 1,
+			"wait":    wait,
+		}).Debug("Diplus request failed, retrying")
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return responseBody{}, fmt.Errorf("Diplus request abandoned: %w", ctx.Err())
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > diplusMaxBackoff {
+			backoff = diplusMaxBackoff
+		}
+	}
+}
+
+// requestOnce performs a single request. The caller must release the
+// returned body.
+func (c *DiplusClient) requestOnce(ctx context.Context, template string) (responseBody, error) {
 	// URL encode the template
 	encodedTemplate := url.QueryEscape(template)
 
 	// Build the full URL
 	fullURL := fmt.Sprintf("%s?text=%s", c.baseURL, encodedTemplate)
+	if strings.Contains(c.baseURL, "{text}") {
+		fullURL = strings.Replace(c.baseURL, "{text}", encodedTemplate, 1)
+	}
 
 	//c.logger.WithField("url", fullURL).Debug("Making API request")
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
+	if err != nil {
+		return responseBody{}, fmt.Errorf("failed to build request: %w", err)
+	}
+	// Asking explicitly (rather than leaving it to the transport) lets
+	// readBody decode through a pooled gzip reader.
+	req.Header.Set("Accept-Encoding", "gzip")
+
 	// Make the request
-	resp, err := c.httpClient.Get(fullURL)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		if ctx.Err() != nil {
+			// Our own deadline or shutdown, not a sign of Diplus being down
+			// worth retrying.
+			return responseBody{}, fmt.Errorf("Diplus request abandoned: %w", ctx.Err())
+		}
+		return responseBody{}, retryableError{fmt.Errorf("%w: %w", errDiplusUnreachable, err)}
 	}
 	defer resp.Body.Close()
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, resp.Status)
+		// Drain so the keep-alive connection can be reused.
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("API returned status %d: %s", resp.StatusCode, resp.Status)
+		if resp.StatusCode >= 500 {
+			return responseBody{}, retryableError{err}
+		}
+		return responseBody{}, err
 	}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	body, err := readBody(resp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		err = fmt.Errorf("failed to read response body: %w", err)
+		var netErr net.Error
+		if ctx.Err() == nil && errors.As(err, &netErr) && netErr.Timeout() {
+			// The client timeout fired mid-body: as recoverable as one
+			// before the headers.
+			return responseBody{}, retryableError{fmt.Errorf("%w: %w", errDiplusUnreachable, err)}
+		}
+		return responseBody{}, err
 	}
 
 	c.logger.WithFields(logrus.Fields{
 		"status_code":   resp.StatusCode,
-		"response_size": len(body),
+		"response_size": len(body.data),
+		"gzip":          resp.Header.Get("Content-Encoding") != "",
 	}).Debug("Received API response")
 
 	return body, nil
 }
 
 // GetAllSensorData fetches data for all available sensors
-func (c *DiplusClient) GetAllSensorData() (*sensors.SensorData, error) {
-	return c.GetSensorData(sensors.GetAllSensorIDs())
+func (c *DiplusClient) GetAllSensorData(ctx context.Context) (*sensors.SensorData, error) {
+	return c.GetSensorData(ctx, sensors.GetAllSensorIDs())
 }
 
 // IsHealthy checks if the Diplus API is responding
-func (c *DiplusClient) IsHealthy() bool {
+func (c *DiplusClient) IsHealthy(ctx context.Context) bool {
 	// Try to fetch a minimal sensor set to test connectivity
 	testSensorIDs := []int{33} // Just battery percentage
-	_, err := c.GetSensorData(testSensorIDs)
+	_, err := c.GetSensorData(ctx, testSensorIDs)
 	return err == nil
 }
 
@@ -162,9 +505,28 @@ func (c *DiplusClient) GetAllSensorInfo() []sensors.SensorDefinition {
 	return sensors.AllSensors
 }
 
-// SetTimeout configures the HTTP client timeout
+// SetTimeout bounds a single request: connecting, waiting for the response
+// headers and the request as a whole each give up after timeout. Call it
+// before the first request.
 func (c *DiplusClient) SetTimeout(timeout time.Duration) {
 	c.httpClient.Timeout = timeout
+	c.httpClient.Transport = diplusTransport(timeout)
+}
+
+// diplusTransport returns a transport whose connection phases are bounded by
+// timeout, so a head-unit that accepts the connection but never answers
+// fails the attempt rather than holding the poll until its deadline.
+func diplusTransport(timeout time.Duration) *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConnsPerHost:   2, // at most two batches run at once
+		IdleConnTimeout:       90 * time.Second,
+	}
 }
 
 // SetLogger updates the logger instance
@@ -173,11 +535,11 @@ func (c *DiplusClient) SetLogger(logger *logrus.Logger) {
 }
 
 // CompareAllSensors queries all sensors and compares raw vs parsed values
-func (c *DiplusClient) CompareAllSensors() error {
+func (c *DiplusClient) CompareAllSensors(ctx context.Context) error {
 	c.logger.Debug("Diplus: querying all sensors for comparison")
 
 	// Get all sensor data
-	sensorData, err := c.GetAllSensorData()
+	sensorData, err := c.GetAllSensorData(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get sensor data: %w", err)
 	}
@@ -185,20 +547,56 @@ func (c *DiplusClient) CompareAllSensors() error {
 	// Also get the raw response for comparison
 	allSensorIDs := sensors.GetAllSensorIDs()
 	template := c.buildAPITemplate(allSensorIDs)
-	responseBody, err := c.makeRequest(template)
+	body, err := c.makeRequest(ctx, template)
 	if err != nil {
 		return fmt.Errorf("failed to get raw API response: %w", err)
 	}
+	defer body.release()
 
 	c.logger.Debug("Diplus: comparing raw vs parsed values")
-	sensors.CompareRawVsParsed(responseBody, sensorData)
+	sensors.CompareRawVsParsed(body.data, sensorData)
 
 	return nil
 }
 
-// Poll polls the Diplus API for sensor data
-func (c *DiplusClient) Poll() (*sensors.SensorData, error) {
+// PollSubset fetches only sensorIDs, for the fast path. It neither counts
+// towards the circuit breaker nor probes it: while the breaker is open it
+// returns ErrCircuitOpen and leaves probing to Poll.
+func (c *DiplusClient) PollSubset(ctx context.Context, sensorIDs []int) (*sensors.SensorData, error) {
+	if c.breaker.isOpen() {
+		return nil, ErrCircuitOpen
+	}
+	return c.GetSensorData(ctx, sensorIDs)
+}
+
+// Poll polls the Diplus API for sensor data. While the circuit breaker is
+// open it returns ErrCircuitOpen without contacting Diplus, except for one
+// probe per probe interval (sent without retries). ctx bounds the whole
+// cycle, retries and batches included; a deadline counts as a failed poll,
+// a cancellation (shutdown) does not. When Diplus answered exactly as on the
+// previous poll it returns ErrNotModified and no data, a successful poll
+// whose readings the caller already has.
+func (c *DiplusClient) Poll(ctx context.Context) (*sensors.SensorData, error) {
+	now := time.Now()
+	if !c.breaker.allow(now) {
+		return nil, ErrCircuitOpen
+	}
 	c.logger.Debug("Polling Diplus API for sensor data...")
 	// For now, we use a minimal set of essential sensors.
-	return c.GetSensorData(sensors.PollSensorIDs())
+	data, unchanged, err := c.getSensorData(ctx, sensors.PollSensorIDs(), true)
+	if errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+
+	if c.breaker.record(err, time.Now()) {
+		if err != nil {
+			c.logger.WithError(err).Warn("Diplus unreachable; circuit breaker open, probing periodically")
+		} else {
+			c.logger.Info("Diplus reachable again; circuit breaker closed")
+		}
+	}
+	if unchanged {
+		return nil, ErrNotModified
+	}
+	return data, err
 }
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// fakeDiplus answers every requested sensor with its value (1 unless set)
+// and fails requests for the sensor in fail with a 500.
+type fakeDiplus struct {
+	mu       sync.Mutex
+	values   map[string]string // by field name
+	fail     string
+	requests []int // sensors per request
+}
+
+func (f *fakeDiplus) set(field, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.values == nil {
+		f.values = make(map[string]string)
+	}
+	f.values[field] = value
+}
+
+func (f *fakeDiplus) failing(field string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = field
+}
+
+func (f *fakeDiplus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	template := strings.Split(r.URL.Query().Get("text"), "|")
+	f.requests = append(f.requests, len(template))
+	var parts []string
+	for _, part := range template {
+		field, _, _ := strings.Cut(part, ":")
+		if field == f.fail {
+			http.Error(w, "busy", http.StatusInternalServerError)
+			return
+		}
+		value, ok := f.values[field]
+		if !ok {
+			value = "1"
+		}
+		parts = append(parts, field+":"+value)
+	}
+	json.NewEncoder(w).Encode(sensors.APIResponse{Success: true, Val: strings.Join(parts, "|")})
+}
+
+// sensorIDsPresent returns which of ids have a value in data.
+func sensorIDsPresent(data *sensors.SensorData, ids []int) map[int]bool {
+	present := make(map[int]bool)
+	v := reflect.ValueOf(data).Elem()
+	for _, id := range ids {
+		if f := v.FieldByName(sensors.GetSensorByID(id).FieldName); f.IsValid() && !f.IsNil() {
+			present[id] = true
+		}
+	}
+	return present
+}
+
+func TestGetSensorDataBatches(t *testing.T) {
+	ids := []int{1, 2, 3, 33, 34, 10, 12, 14, 81}
+	tests := []struct {
+		name         string
+		batchSize    int
+		failBatch    int // 1-based; 0 = none
+		wantRequests int
+		wantErr      bool
+	}{
+		{"unbatched", 0, 0, 1, false},
+		{"three batches", 3, 0, 3, false},
+		{"uneven batches", 4, 0, 3, false},
+		{"middle batch fails", 3, 2, 3, false},
+		{"only batch fails", 0, 1, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diplus := &fakeDiplus{}
+			srv := httptest.NewServer(diplus)
+			defer srv.Close()
+			c := NewDiplusClient(srv.URL, quietLogger())
+			c.SetRetries(0)
+			c.SetBatchSize(tt.batchSize)
+
+			size := tt.batchSize
+			if size == 0 {
+				size = len(ids)
+			}
+			var failed []int
+			if tt.failBatch > 0 {
+				failed = ids[(tt.failBatch-1)*size : min(tt.failBatch*size, len(ids))]
+				diplus.failing(sensors.GetSensorByID(failed[0]).FieldName)
+			}
+
+			data, err := c.GetSensorData(context.Background(), ids)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			diplus.mu.Lock()
+			requests := diplus.requests
+			diplus.mu.Unlock()
+			if len(requests) != tt.wantRequests {
+				t.Errorf("%d requests, want %d", len(requests), tt.wantRequests)
+			}
+			for _, n := range requests {
+				if n > size {
+					t.Errorf("request for %d sensors, batch size %d", n, size)
+				}
+			}
+			if err != nil {
+				return
+			}
+			present := sensorIDsPresent(data, ids)
+			for _, id := range ids {
+				lost := false
+				for _, f := range failed {
+					lost = lost || f == id
+				}
+				if present[id] == lost {
+					t.Errorf("sensor %d present = %v, want %v", id, present[id], !lost)
+				}
+			}
+		})
+	}
+}
+
+func TestMalformedWarningThrottled(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	diplus := &fakeDiplus{}
+	diplus.set("Speed", "--")
+	srv := httptest.NewServer(diplus)
+	defer srv.Close()
+	c := NewDiplusClient(srv.URL, logger)
+	c.SetRetries(0)
+
+	ids := []int{2, 33}
+	// poll returns the number of warnings the poll logged. The battery
+	// changes each time so the response is parsed again.
+	soc := 50
+	poll := func() int {
+		hook.Reset()
+		soc++
+		diplus.set("BatteryPercentage", strconv.Itoa(soc))
+		data, err := c.GetSensorData(context.Background(), ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if present := sensorIDsPresent(data, ids); present[2] || !present[33] {
+			t.Errorf("present %v, want only the battery", present)
+		}
+		n := 0
+		for _, e := range hook.AllEntries() {
+			if e.Level == logrus.WarnLevel {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := poll(); n != 1 {
+		t.Errorf("first poll logged %d warnings, want 1", n)
+	}
+	if n := poll(); n != 0 {
+		t.Errorf("second poll logged %d warnings, want none within %s", n, malformedWarnInterval)
+	}
+	c.mu.Lock()
+	c.malformedWarned[2] = c.malformedWarned[2].Add(-malformedWarnInterval)
+	c.mu.Unlock()
+	if n := poll(); n != 1 {
+		t.Errorf("poll a minute later logged %d warnings, want 1", n)
+	}
+}
+
+func TestPollContext(t *testing.T) {
+	tests := []struct {
+		name string
+		// hang leaves requests unanswered; otherwise they fail with a 503.
+		hang          bool
+		retries       int
+		timeout       time.Duration // 0: cancelled after 50 ms instead
+		wantErr       error
+		wantConnected bool
+	}{
+		{"slow Diplus hits the deadline", true, 2, 100 * time.Millisecond, context.DeadlineExceeded, false},
+		{"deadline cuts the retry wait short", false, 5, 200 * time.Millisecond, context.DeadlineExceeded, false},
+		{"shutdown cancels a slow poll", true, 2, 0, context.Canceled, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.hang {
+					<-r.Context().Done()
+					return
+				}
+				http.Error(w, "restarting", http.StatusServiceUnavailable)
+			}))
+			defer srv.Close()
+			c := NewDiplusClient(srv.URL, quietLogger())
+			c.SetRetries(tt.retries)
+			// One failed poll opens the breaker; a cancelled one must not.
+			c.SetCircuitBreaker(1, time.Minute)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.timeout > 0 {
+				ctx, cancel = context.WithTimeout(context.Background(), tt.timeout)
+			} else {
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+			defer cancel()
+
+			start := time.Now()
+			data, err := c.Poll(ctx)
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Poll returned after %s, want it to stop with its context", elapsed)
+			}
+			if data != nil || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Poll = %v, %v; want %v", data, err, tt.wantErr)
+			}
+			if got := c.Connected(); got != tt.wantConnected {
+				t.Errorf("Connected = %v, want %v", got, tt.wantConnected)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+)
+
+// captureLine is one recorded Diplus response. The batches of one poll share
+// its start time.
+type captureLine struct {
+	Time time.Time       `json:"time"`
+	Body json.RawMessage `json:"body"`
+}
+
+// replayFrame is what one poll got: every response body of the poll and,
+// for recorded captures, when it was taken.
+type replayFrame struct {
+	at     time.Time // zero for plain captures
+	bodies [][]byte
+}
+
+// frameSource stands in for the head-unit: it hands out what a poll at now
+// gets, and whether that was the end of the source and it starts over.
+type frameSource interface {
+	nextFrame(now time.Time) (replayFrame, bool)
+}
+
+// replaySource serves recorded Diplus responses from JSON-lines captures, in
+// order. A line is either a bare response body or a captureLine written by
+// -diplus-record. It wraps around at the end so a short capture can drive
+// the pipeline indefinitely.
+//
+// With speed > 0, timed captures are played back in real time (or speed
+// times faster): each poll gets the frame that was current at that point of
+// the recording, however often it polls. Plain captures, and speed 0, hand
+// out one frame per poll.
+type replaySource struct {
+	mu     sync.Mutex
+	path   string
+	frames []replayFrame
+	timed  bool
+	speed  float64
+	next   int // unpaced: the next frame
+
+	started time.Time // paced: wall time the current pass started
+	loops   int       // completed passes
+}
+
+func loadReplaySource(path string, speed float64) (*replaySource, error) {
+	files := []string{path}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.jsonl"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Diplus captures: %w", err)
+		}
+		sort.Strings(files)
+	}
+
+	r := &replaySource{path: path, speed: speed, timed: true}
+	for _, file := range files {
+		if err := r.load(file); err != nil {
+			return nil, err
+		}
+	}
+	if len(r.frames) == 0 {
+		return nil, fmt.Errorf("Diplus capture %s contains no responses", path)
+	}
+	return r, nil
+}
+
+// load appends the frames of one capture file.
+func (r *replaySource) load(file string) error {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read Diplus capture: %w", err)
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(raw))
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec captureLine
+		if json.Unmarshal(line, &rec) != nil || rec.Time.IsZero() || len(rec.Body) == 0 {
+			r.timed = false
+			r.frames = append(r.frames, replayFrame{bodies: [][]byte{append([]byte(nil), line...)}})
+			continue
+		}
+		body := []byte(rec.Body)
+		var s string
+		if json.Unmarshal(rec.Body, &s) == nil {
+			body = []byte(s) // a response that was not JSON
+		}
+		if n := len(r.frames); n > 0 && r.frames[n-1].at.Equal(rec.Time) {
+			r.frames[n-1].bodies = append(r.frames[n-1].bodies, body)
+			continue
+		}
+		r.frames = append(r.frames, replayFrame{at: rec.Time, bodies: [][]byte{body}})
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("failed to read Diplus capture: %w", err)
+	}
+	return nil
+}
+
+// span is the recorded time the capture covers.
+func (r *replaySource) span() time.Duration {
+	return r.frames[len(r.frames)-1].at.Sub(r.frames[0].at)
+}
+
+// nextFrame returns the frame to serve at now and whether the capture just
+// wrapped around to the start. The frame time of a timed capture is shifted
+// by the span once per pass, so timestamps keep increasing.
+func (r *replaySource) nextFrame(now time.Time) (replayFrame, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	span := time.Duration(0)
+	if r.timed {
+		span = r.span()
+	}
+	if r.speed <= 0 || span <= 0 {
+		f := r.shifted(r.frames[r.next], span)
+		r.next++
+		if r.next < len(r.frames) {
+			return f, false
+		}
+		r.next = 0
+		r.loops++
+		return f, true
+	}
+
+	if r.started.IsZero() {
+		r.started = now
+	}
+	wrapped := false
+	pos := time.Duration(float64(now.Sub(r.started)) * r.speed)
+	if pos > span {
+		r.started, pos = now, 0
+		r.loops++
+		wrapped = true
+	}
+	at := r.frames[0].at.Add(pos)
+	i := sort.Search(len(r.frames), func(i int) bool { return r.frames[i].at.After(at) })
+	return r.shifted(r.frames[max(i-1, 0)], span), wrapped
+}
+
+func (r *replaySource) shifted(f replayFrame, span time.Duration) replayFrame {
+	if !f.at.IsZero() {
+		f.at = f.at.Add(time.Duration(r.loops) * span)
+	}
+	return f
+}
+
+// replayPoll serves the next frame of the capture as one poll, whatever
+// sensors were asked for.
+func (c *DiplusClient) replayPoll() (*sensors.SensorData, error) {
+	f, wrapped := c.replay.nextFrame(time.Now())
+	if wrapped {
+		c.logger.Debug("Diplus capture reached the end, looping")
+	}
+	var merged *sensors.SensorData
+	for _, body := range f.bodies {
+		data, err := c.parseResponse(responseBody{data: body}, 0)
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = data
+		} else {
+			sensors.MergeSensorData(merged, data)
+		}
+	}
+	if !f.at.IsZero() {
+		merged.Timestamp = f.at
+	}
+	return merged, nil
+}
+
+// NewDiplusReplayClient creates a client that replays a recorded capture,
+// or every *.jsonl capture in a directory, instead of querying a head-unit,
+// so transmitters and derived sensors can be exercised off-car. speed paces
+// timed captures (see replaySource); samples carry the recorded time.
+func NewDiplusReplayClient(path string, speed float64, logger *logrus.Logger) (*DiplusClient, error) {
+	src, err := loadReplaySource(path, speed)
+	if err != nil {
+		return nil, err
+	}
+	c := NewDiplusClient("file://"+path, logger)
+	c.replay = src
+	fields := logrus.Fields{
+		"path":  path,
+		"polls": len(src.frames),
+	}
+	if src.timed {
+		fields["recorded"] = src.span().Round(time.Second)
+		fields["speed"] = speed
+	}
+	logger.WithFields(fields).Info("Replaying recorded Diplus responses")
+	return c, nil
+}
+
+// captureRecorder appends every raw Diplus response of a poll to
+// <dir>/diplus-YYYY-MM-DD.jsonl, one file per local day.
+type captureRecorder struct {
+	mu     sync.Mutex
+	dir    string
+	day    string
+	f      *os.File
+	warned bool
+}
+
+func (r *captureRecorder) write(at time.Time, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if day := at.Format("2006-01-02"); day != r.day || r.f == nil {
+		if r.f != nil {
+			r.f.Close()
+			r.f = nil
+		}
+		f, err := os.OpenFile(filepath.Join(r.dir, "diplus-"+day+".jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open Diplus capture: %w", err)
+		}
+		r.f, r.day = f, day
+	}
+
+	raw := json.RawMessage(body)
+	if !json.Valid(body) {
+		raw, _ = json.Marshal(string(body))
+	}
+	line, err := json.Marshal(captureLine{Time: at, Body: raw})
+	if err != nil {
+		return fmt.Errorf("failed to encode Diplus capture: %w", err)
+	}
+	if _, err := r.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write Diplus capture: %w", err)
+	}
+	return nil
+}
+
+// RecordTo writes the raw responses of every Poll (not PollSubset) to dir
+// for later replay with NewDiplusReplayClient.
+func (c *DiplusClient) RecordTo(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create Diplus capture directory: %w", err)
+	}
+	c.recorder = &captureRecorder{dir: dir}
+	return nil
+}
+
+// record writes body to the capture, warning once while writing fails.
+func (c *DiplusClient) record(at time.Time, body []byte) {
+	r := c.recorder
+	err := r.write(at, body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case err != nil && !r.warned:
+		c.logger.WithError(err).Warn("Recording Diplus responses failed")
+		r.warned = true
+	case err == nil && r.warned:
+		c.logger.Info("Recording Diplus responses again")
+		r.warned = false
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// maxCachedResponses bounds the response cache; it only needs one entry per
+// batch, more after the sensor list was reloaded.
+const maxCachedResponses = 16
+
+var responseSeed = maphash.MakeSeed()
+
+// ErrNotModified is returned by Poll when every Diplus response was identical
+// to the previous one, so the readings are those of the last poll.
+var ErrNotModified = errors.New("Diplus response unchanged")
+
+// responseCache remembers the last parse of each request template by the
+// hash of its response body. On a parked car consecutive responses are
+// byte-identical, so the parse is reused instead of repeated, and Poll tells
+// the caller with ErrNotModified. Keyed by template, each batch of a batched
+// poll keeps its own hash.
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+	hits    int
+}
+
+type cachedResponse struct {
+	sum  uint64
+	data sensors.SensorData
+}
+
+// lookup returns a copy of the parse cached for template if body hashes the
+// same, with a fresh timestamp, or nil. sum is body's hash for store.
+func (c *responseCache) lookup(template string, body []byte) (data *sensors.SensorData, sum uint64) {
+	sum = maphash.Bytes(responseSeed, body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[template]
+	if !ok || e.sum != sum {
+		return nil, sum
+	}
+	c.hits++
+	// Processing replaces fields rather than modifying their values, so a
+	// shallow copy leaves the cached parse intact.
+	cp := e.data
+	cp.Timestamp = time.Now()
+	return &cp, sum
+}
+
+// store caches data, the parse of the response to template hashing to sum.
+func (c *responseCache) store(template string, sum uint64, data *sensors.SensorData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[template]; !ok && len(c.entries) >= maxCachedResponses {
+		c.entries = nil
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]cachedResponse)
+	}
+	c.entries[template] = cachedResponse{sum: sum, data: *data}
+}
+
+// forget drops the entry of template, whose request failed.
+func (c *responseCache) forget(template string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, template)
+}
+
+// UnchangedResponses returns how many Diplus responses were identical to the
+// previous one for the same request and were not parsed again.
+func (c *DiplusClient) UnchangedResponses() int {
+	c.responses.mu.Lock()
+	defer c.responses.mu.Unlock()
+	return c.responses.hits
+}
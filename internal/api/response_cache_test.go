@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+func TestPollNotModified(t *testing.T) {
+	ids := sensors.PollSensorIDs()
+	first := sensors.GetSensorByID(ids[0]).FieldName
+	last := sensors.GetSensorByID(ids[len(ids)-1]).FieldName
+
+	type step struct {
+		name    string
+		change  bool   // a new value for the first sensor
+		fail    string // field whose batch fails
+		wantErr error
+	}
+	tests := []struct {
+		name    string
+		batches int
+		steps   []step
+	}{
+		{"single request", 1, []step{
+			{name: "first"},
+			{name: "same", wantErr: ErrNotModified},
+			{name: "changed", change: true},
+			{name: "same again", wantErr: ErrNotModified},
+		}},
+		{"batched", 3, []step{
+			{name: "first"},
+			{name: "same", wantErr: ErrNotModified},
+			{name: "one batch changed", change: true},
+			{name: "same again", wantErr: ErrNotModified},
+		}},
+		{"failed batch", 3, []step{
+			{name: "first"},
+			{name: "last batch fails", fail: last},
+			// Identical to the first poll, but not to the partial one.
+			{name: "recovered"},
+			{name: "same", wantErr: ErrNotModified},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diplus := &fakeDiplus{}
+			srv := httptest.NewServer(diplus)
+			defer srv.Close()
+			c := NewDiplusClient(srv.URL, quietLogger())
+			c.SetRetries(0)
+			if tt.batches > 1 {
+				c.SetBatchSize((len(ids) + tt.batches - 1) / tt.batches)
+			}
+
+			for i, st := range tt.steps {
+				if st.change {
+					diplus.set(first, strconv.Itoa(i+2))
+				}
+				diplus.failing(st.fail)
+				data, err := c.Poll(context.Background())
+				if !errors.Is(err, st.wantErr) {
+					t.Fatalf("%s: err = %v, want %v", st.name, err, st.wantErr)
+				}
+				if (data == nil) != (err != nil) {
+					t.Errorf("%s: data = %v with err %v", st.name, data, err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkIdleCycle compares the work of an unchanged response with and
+// without the hash: parsing it again against hashing it and copying the
+// cached parse.
+func BenchmarkIdleCycle(b *testing.B) {
+	ids := sensors.PollSensorIDs()
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, sensors.GetSensorByID(id).FieldName+":12.5")
+	}
+	body, err := json.Marshal(sensors.APIResponse{Success: true, Val: strings.Join(parts, "|")})
+	if err != nil {
+		b.Fatal(err)
+	}
+	c := NewDiplusClient("http://127.0.0.1", quietLogger())
+	template := c.buildAPITemplate(ids)
+
+	b.Run("parse", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := c.parseResponse(responseBody{data: body}, len(ids)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("hash", func(b *testing.B) {
+		data, err := c.parseResponse(responseBody{data: body}, len(ids))
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, sum := c.responses.lookup(template, body)
+		c.responses.store(template, sum, data)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if cached, _ := c.responses.lookup(template, body); cached == nil {
+				b.Fatal("cache miss")
+			}
+		}
+	})
+}
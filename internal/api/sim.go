@@ -0,0 +1,394 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// simDefaultStep is how far simulated time advances per poll when the
+// scenario is not paced and sets no step.
+const simDefaultStep = 10 * time.Second
+
+// simBaseline is the state of a parked, locked car every scenario starts
+// from, by JSON sensor name. Monitored sensors without an entry start
+// at 0, or at the bottom of their plausible range.
+var simBaseline = map[string]float64{
+	"power_status":              0,
+	"gear_position":             1, // P
+	"charge_gun_state":          1, // disconnected
+	"battery_percentage":        80,
+	"mileage":                   12000,
+	"battery_voltage_12v":       12.6,
+	"max_battery_voltage":       12.6,
+	"min_battery_voltage":       12.5,
+	"max_battery_temp":          22,
+	"avg_battery_temp":          21,
+	"min_battery_temp":          20,
+	"cabin_temperature":         20,
+	"outside_temperature":       15,
+	"left_front_tire_pressure":  2.5,
+	"right_front_tire_pressure": 2.5,
+	"left_rear_tire_pressure":   2.5,
+	"right_rear_tire_pressure":  2.5,
+	"remote_lock_status":        1,
+}
+
+// simSensor is a sensor the simulator can produce: a numeric SensorData
+// field.
+type simSensor struct {
+	id    int
+	field string  // SensorData field, the key Diplus echoes back
+	scale float64 // raw Diplus value × scale = real value
+	// discrete sensors (states without a unit) switch at the start of a
+	// phase instead of ramping.
+	discrete bool
+}
+
+var (
+	simSensorsOnce sync.Once
+	simSensorsByID map[int]simSensor
+	simSensorKeys  map[string]int // JSON name → ID
+	simSensorNames map[int]string
+)
+
+func loadSimSensors() {
+	simSensorsOnce.Do(func() {
+		simSensorsByID = make(map[int]simSensor)
+		simSensorKeys = make(map[string]int)
+		simSensorNames = make(map[int]string)
+		dataType := reflect.TypeOf(sensors.SensorData{})
+		floatPtr := reflect.TypeOf((*float64)(nil))
+		for _, def := range sensors.AllSensors {
+			f, ok := dataType.FieldByName(def.FieldName)
+			if !ok || f.Type != floatPtr {
+				continue
+			}
+			scale := def.ScaleFactor
+			if scale == 0 {
+				scale = 1
+			}
+			simSensorsByID[def.ID] = simSensor{
+				id:       def.ID,
+				field:    def.FieldName,
+				scale:    scale,
+				discrete: def.UnitOfMeasurement == "" || def.Category == "binary_sensor" || sensors.ValueMapFor(def.ID) != nil,
+			}
+			key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			simSensorKeys[key] = def.ID
+			simSensorNames[def.ID] = key
+		}
+	})
+}
+
+// simMileageID and simSpeedID are the odometer, which the simulator
+// advances with the speed, and the speed.
+const (
+	simSpeedID   = 2
+	simMileageID = 3
+)
+
+// scenarioPhase is one stretch of a scenario: over duration, every sensor in
+// targets moves linearly from where the previous phase left it to its
+// target. A phase of duration 0 sets its values at once.
+type scenarioPhase struct {
+	name     string
+	duration time.Duration
+	targets  map[int]float64 // by sensor ID, in real units
+
+	begin    time.Duration   // offset into the scenario
+	from, to map[int]float64 // full state at the start and the end
+}
+
+// scenario is a simulated drive, charge or park. Its state at any offset is
+// a pure function of the file, so the same scenario always produces the same
+// samples.
+type scenario struct {
+	name   string
+	step   time.Duration
+	start  time.Time // zero = when the simulator starts
+	phases []scenarioPhase
+	total  time.Duration
+}
+
+// loadScenario reads a scenario file, which is YAML:
+//
+//	name: dc-charge
+//	step: 10s                  # simulated time per poll when not paced
+//	start: 2024-05-01T14:00:00Z # optional timestamp of the first sample
+//	phases:
+//	  - name: plug in
+//	    duration: 30s
+//	    charge_gun_state: 2
+//	    engine_power: -80
+//
+// Every phase key other than name and duration is a sensor (its name in the
+// MQTT state, e.g. battery_percentage) and the value it reaches at the end of the phase, in the
+// units Home Assistant shows; enum sensors also take their labels, e.g.
+// "gear_position: D". Sensors without a unit switch at the start of the
+// phase. The odometer advances with the speed; setting mileage moves it.
+func loadScenario(path string) (*scenario, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+	sc, err := parseScenario(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// scenarioFile is the layout of a scenario file. Phases are kept as nodes
+// because their keys are sensor names.
+type scenarioFile struct {
+	Name   string        `yaml:"name"`
+	Step   time.Duration `yaml:"step"`
+	Start  time.Time     `yaml:"start"`
+	Phases []yaml.Node   `yaml:"phases"`
+}
+
+func parseScenario(data []byte) (*scenario, error) {
+	loadSimSensors()
+	var file scenarioFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if file.Step < 0 {
+		return nil, fmt.Errorf("step must be a positive duration")
+	}
+	sc := &scenario{name: file.Name, step: file.Step, start: file.Start}
+	if sc.step == 0 {
+		sc.step = simDefaultStep
+	}
+	for _, n := range file.Phases {
+		if n.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: expected a phase of key: value settings", n.Line)
+		}
+		phase := scenarioPhase{targets: make(map[int]float64)}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if value.Kind != yaml.ScalarNode || value.Value == "" {
+				return nil, fmt.Errorf("line %d: %s needs a single value", key.Line, key.Value)
+			}
+			if err := phase.set(key.Value, value.Value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", key.Line, err)
+			}
+		}
+		sc.phases = append(sc.phases, phase)
+	}
+	if len(sc.phases) == 0 {
+		return nil, fmt.Errorf("scenario has no phases")
+	}
+	sc.plan()
+	return sc, nil
+}
+
+// set applies one key of a phase.
+func (p *scenarioPhase) set(key, value string) error {
+	switch key {
+	case "name":
+		p.name = value
+		return nil
+	case "duration":
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("duration must be a duration like 20m")
+		}
+		p.duration = d
+		return nil
+	}
+	id, ok := simSensorKeys[key]
+	if !ok {
+		return fmt.Errorf("unknown sensor %q", key)
+	}
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		p.targets[id] = v
+		return nil
+	}
+	for raw, label := range sensors.ValueMapFor(id) {
+		if strings.EqualFold(label, value) {
+			p.targets[id] = float64(raw)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %q is not a number or label", key, value)
+}
+
+// plan works out the state at the start and end of every phase.
+func (sc *scenario) plan() {
+	state := make(map[int]float64)
+	for _, id := range sensors.PollSensorIDs() {
+		if _, ok := simSensorsByID[id]; !ok {
+			continue
+		}
+		def := sensors.GetSensorByID(id)
+		v, ok := simBaseline[simSensorNames[id]]
+		if !ok && def.Min < def.Max {
+			v = math.Max(0, def.Min)
+		}
+		state[id] = v
+	}
+
+	var at time.Duration
+	for i := range sc.phases {
+		p := &sc.phases[i]
+		p.begin = at
+		p.from = make(map[int]float64, len(state))
+		for id, v := range state {
+			p.from[id] = v
+		}
+		for id, v := range p.targets {
+			if simSensorsByID[id].discrete || p.duration == 0 || id == simMileageID {
+				p.from[id] = v
+			} else if _, ok := p.from[id]; !ok {
+				p.from[id] = v // not monitored: nothing to ramp from
+			}
+			state[id] = v
+		}
+		p.to = make(map[int]float64, len(state))
+		for id, v := range state {
+			p.to[id] = v
+		}
+		at += p.duration
+	}
+	sc.total = at
+}
+
+// valuesAt returns every sensor's value off into the scenario; past the end
+// the final state holds.
+func (sc *scenario) valuesAt(off time.Duration) map[int]float64 {
+	off = min(max(off, 0), sc.total)
+	cur := &sc.phases[0]
+	odometer, hasOdometer := cur.from[simMileageID]
+	for i := range sc.phases {
+		p := &sc.phases[i]
+		if p.begin > off {
+			break
+		}
+		cur = p
+		if v, ok := p.targets[simMileageID]; ok {
+			odometer, hasOdometer = v, true
+		}
+		// Distance driven in this phase up to off: the speed ramps
+		// linearly, so it is the area of a trapezoid.
+		if t := min(off-p.begin, p.duration); t > 0 {
+			v0, v1 := p.from[simSpeedID], p.to[simSpeedID]
+			vt := v0 + (v1-v0)*float64(t)/float64(p.duration)
+			odometer += (v0 + vt) / 2 * t.Hours()
+		}
+	}
+
+	values := make(map[int]float64, len(cur.to))
+	frac := 1.0
+	if cur.duration > 0 {
+		frac = math.Min(float64(off-cur.begin)/float64(cur.duration), 1)
+	}
+	for id, to := range cur.to {
+		from := cur.from[id]
+		values[id] = from + (to-from)*frac
+	}
+	if hasOdometer {
+		values[simMileageID] = odometer
+	}
+	return values
+}
+
+// body renders the state at off as a Diplus response.
+func (sc *scenario) body(off time.Duration) []byte {
+	values := sc.valuesAt(off)
+	ids := make([]int, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s := simSensorsByID[id]
+		v := values[id]
+		if s.discrete {
+			v = math.Round(v)
+		}
+		raw := math.Round(v/s.scale*1000) / 1000
+		parts = append(parts, s.field+":"+strconv.FormatFloat(raw, 'f', -1, 64))
+	}
+	body, _ := json.Marshal(sensors.APIResponse{Success: true, Val: strings.Join(parts, "|")})
+	return body
+}
+
+// simSource serves a scenario as Diplus responses. With speed > 0 simulated
+// time runs speed times as fast as the wall clock; with speed 0 every poll
+// advances it by the scenario's step.
+type simSource struct {
+	mu      sync.Mutex
+	sc      *scenario
+	speed   float64
+	start   time.Time // time of the first sample
+	started time.Time // paced: wall time of the first poll
+	polls   int       // unpaced: polls so far
+	ended   bool
+	logger  *logrus.Logger
+}
+
+func (s *simSource) nextFrame(now time.Time) (replayFrame, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var off time.Duration
+	if s.speed > 0 {
+		if s.started.IsZero() {
+			s.started = now
+		}
+		off = time.Duration(float64(now.Sub(s.started)) * s.speed)
+	} else {
+		off = time.Duration(s.polls) * s.sc.step
+		s.polls++
+	}
+	if off > s.sc.total && !s.ended {
+		s.ended = true
+		s.logger.WithField("scenario", s.sc.name).Info("Simulated scenario finished, holding the final state")
+	}
+	return replayFrame{at: s.start.Add(off), bodies: [][]byte{s.sc.body(off)}}, false
+}
+
+// NewDiplusSimClient creates a client that simulates the car from a scenario
+// file (see loadScenario) instead of querying a head-unit. speed paces the
+// scenario like a timed capture; 0 advances it one step per poll, which
+// makes runs reproducible whatever the poll interval.
+func NewDiplusSimClient(path string, speed float64, logger *logrus.Logger) (*DiplusClient, error) {
+	sc, err := loadScenario(path)
+	if err != nil {
+		return nil, err
+	}
+	if sc.name == "" {
+		sc.name = strings.TrimSuffix(path[strings.LastIndex(path, "/")+1:], ".yaml")
+	}
+	src := &simSource{sc: sc, speed: speed, start: sc.start, logger: logger}
+	if src.start.IsZero() {
+		src.start = time.Now()
+	}
+	c := NewDiplusClient("sim:"+path, logger)
+	c.replay = src
+	logger.WithFields(logrus.Fields{
+		"scenario": sc.name,
+		"phases":   len(sc.phases),
+		"duration": sc.total,
+		"speed":    speed,
+	}).Info("Simulating the car from a scenario")
+	return c, nil
+}
@@ -2,44 +2,74 @@ package app
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/Allthebester/byd-hass/internal/api"
 	"github.com/Allthebester/byd-hass/internal/bus"
 	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/Allthebester/byd-hass/internal/diag"
 	"github.com/Allthebester/byd-hass/internal/domain"
 	"github.com/Allthebester/byd-hass/internal/location"
 	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/state"
 	"github.com/Allthebester/byd-hass/internal/transmission"
 	"github.com/Allthebester/byd-hass/internal/wifi"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 )
 
-// Adaptive ABRP intervals ------------------------------------------------
-const (
-	abrpDrivingInterval = 10 * time.Second  // default while moving / charging
-	abrpIdleInterval    = 120 * time.Second // when parked & not charging
-)
+// drivingStateConfirmSamples is how many consecutive polls must agree before
+// the driving state changes (charging transitions apply immediately).
+const drivingStateConfirmSamples = 2
 
-func computeABRPInterval(data *sensors.SensorData) time.Duration {
-	if data == nil {
-		return abrpDrivingInterval
-	}
-	// Fast cadence when speed > 0 km/h
-	if data.Speed != nil && *data.Speed > 0 {
-		return abrpDrivingInterval
-	}
-	// Fast cadence when actively charging
-	if sensors.DeriveChargingStatus(data) == "charging" {
-		return abrpDrivingInterval
-	}
-	// Otherwise we're parked / idle
-	return abrpIdleInterval
+// rangeMinHistoryKM is how far the car must have driven before the range
+// estimate is reported.
+const rangeMinHistoryKM = 10
+
+// diagnosticsInterval is how often the MQTT health sensor is refreshed.
+const diagnosticsInterval = time.Minute
+
+// powerStatusSensorID is PowerStatus; the fast poll pauses while it reports
+// the car as off.
+const powerStatusSensorID = 1
+
+// Output is an additional transmitter driven by the central scheduler. It is
+// sent the latest snapshot whenever Interval has elapsed and the data changed.
+type Output struct {
+	Interval    time.Duration
+	Transmitter transmission.Transmitter
+	// Timeout bounds a single transmission (0 = cfg.TransmitTimeout).
+	Timeout time.Duration
+	// SendUnchanged delivers every Interval even when the snapshot is unchanged.
+	SendUnchanged bool
+}
+
+// Observer is implemented by outputs that want to see poll and transmit
+// outcomes, e.g. to export them as metrics. Calls must not block.
+type Observer interface {
+	PollResult(err error)
+	TransmitResult(name string, err error)
+}
+
+// LatencyObserver is an Observer that also wants the duration of each Diplus
+// poll that reached the head-unit.
+type LatencyObserver interface {
+	PollDuration(d time.Duration)
 }
 
 // Run launches the hexagonal architecture and blocks until ctx is cancelled.
+// mqttTx, abrpTx and outputs are registered with manager, which runs the
+// transmissions. pollTrigger (optional) requests out-of-cycle polls;
+// diagnostics (optional) observes polls and transmissions and is published
+// over MQTT as the health sensor. loadConfig (optional) parses the
+// configuration again for a reload on SIGHUP or when the config file changes.
 func Run(
 	parentCtx context.Context,
 	cfg *config.Config,
@@ -47,6 +77,12 @@ func Run(
 	locationProvider *location.TermuxLocationProvider,
 	mqttTx *transmission.MQTTTransmitter,
 	abrpTx *transmission.ABRPTransmitter,
+	outputs []Output,
+	manager *transmission.Manager,
+	tunables *Tunables,
+	pollTrigger *PollTrigger,
+	diagnostics *diag.Registry,
+	loadConfig func() (*config.Config, error),
 	logger *logrus.Logger,
 ) {
 	ctx, cancel := context.WithCancel(parentCtx)
@@ -67,128 +103,783 @@ func Run(
 		})
 	}
 
+	// Health sensor --------------------------------------------------------
+	if diagnostics != nil && mqttTx != nil {
+		grp.Go(func() error {
+			ticker := time.NewTicker(diagnosticsInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-ticker.C:
+					pubCtx, cancel := context.WithTimeout(ctx, cfg.TransmitTimeout)
+					err := mqttTx.PublishDiagnostics(pubCtx, diagnostics.Snapshot())
+					cancel()
+					if err != nil {
+						logger.WithError(err).Debug("diagnostics: publish failed")
+					}
+				}
+			}
+		})
+	}
+
 	// Collector -----------------------------------------------------------
+	chargingTracker := sensors.NewChargingStateTracker(cfg.ChargingConfirmSamples, cfg.ChargingHysteresis, cfg.DCFCThresholdKW)
+	sessionTracker := sensors.NewChargeSessionTracker(cfg.DCFCThresholdKW)
+	drivingTracker := sensors.NewDrivingStateTracker(drivingStateConfirmSamples)
+	tripTracker := sensors.NewDriveSessionTracker(cfg.TripStartSpeed, cfg.TripEndAfter)
+	var efficiencyTracker *sensors.EfficiencyTracker
+	if cfg.EfficiencyWindowKM > 0 {
+		efficiencyTracker = sensors.NewEfficiencyTracker(cfg.EfficiencyWindowKM, cfg.EfficiencyWindowKM)
+	}
+	var rangeTracker *sensors.EfficiencyTracker
+	if cfg.RangeWindowKM > 0 {
+		rangeTracker = sensors.NewEfficiencyTracker(cfg.RangeWindowKM, rangeMinHistoryKM)
+	}
+	var geofence *location.Geofence
+	if zones := loadZones(cfg, logger); len(zones) > 0 {
+		if !cfg.ABRPLocation {
+			logger.Warn("Zones need GPS; enable -abrp-location")
+		}
+		geofence = location.NewGeofence(zones, cfg.ZoneHysteresisM, cfg.ZoneMaxAccuracyM)
+		if mqttTx != nil {
+			mqttTx.EnableZones(geofence.Zones())
+		}
+	}
+	thermalTracker := sensors.NewBatteryThermalTracker(max(2*cfg.PollInterval, time.Minute))
+	eventTracker := sensors.NewCarEventTracker(cfg.DoorOpenAlert)
+	// batteryTempsRead tells thermalTracker whether the sample being
+	// processed carries freshly read pack temperatures.
+	batteryTempsRead := false
+	var deviceLoc *time.Location // nil = timestamps are Unix time
+	if cfg.DeviceTimezone != "" {
+		// Validated while parsing flags.
+		deviceLoc, _ = time.LoadLocation(cfg.DeviceTimezone)
+	}
+	// Days end at midnight on the head-unit's clock when its zone is known.
+	distanceTracker := sensors.NewDistanceTracker(deviceLoc)
+	var battery12VTracker *sensors.Battery12VTracker
+	if cfg.Battery12VLowVolt > 0 {
+		battery12VTracker = sensors.NewBattery12VTracker(cfg.Battery12VLowVolt, deviceLoc)
+	}
+	debounceGlobal := sensors.DebounceRule{Polls: cfg.DebouncePolls, Hold: cfg.DebounceHold}
+	debounceRules, warnings := sensors.ParseDebounceRules(cfg.DebounceSensors, debounceGlobal)
+	for _, w := range warnings {
+		logger.Warn(w)
+	}
+	debouncer := sensors.NewDebouncer(debounceGlobal, debounceRules)
+	comfortFormula, _ := sensors.ParseComfortFormula(cfg.Comfort) // validated while parsing flags
+	smoother := sensors.NewSmoother(cfg.PollInterval, cfg.FastPollInterval)
+	// smoothFresh tells smoother which sensors the sample being processed
+	// read; nil after a full poll.
+	var smoothFresh func(id int) bool
+	var holder *sensors.ValueHolder
+	if cfg.HoldMissing > 0 {
+		holder = sensors.NewValueHolder(cfg.HoldMissing)
+	}
+	var rangeValidator *sensors.RangeValidator
+	if cfg.ValidateRanges {
+		rangeValidator = sensors.NewRangeValidator()
+	}
+	sleeper := newSleepPolicy(cfg.SleepAfterPolls, cfg.SleepIntervals)
+	slowest := cfg.PollIntervalMax
+	if n := len(cfg.SleepIntervals); n > 0 {
+		slowest = cfg.SleepIntervals[n-1]
+	}
+	keepalive := newKeepaliveWatchdog(cfg.KeepaliveCap, slowest)
+	// lastRaw is the last full poll (with fast-path values merged in)
+	// before any processing; fast polls only refresh part of it.
+	var lastRaw *sensors.SensorData
+	snapshotEnabled := cfg.SnapshotFile != "" && cfg.SnapshotInterval > 0
+	store := state.NewStore(cfg.SnapshotFile)
+	if snapshotEnabled {
+		store.Register("raw", state.Func(func() *sensors.SensorData { return lastRaw }, func(raw *sensors.SensorData) {
+			if holder != nil {
+				// Lets the first partial responses fall back on the values
+				// from before the restart, within the usual age limit.
+				holder.Apply(raw)
+			}
+		}))
+		store.Register("charging", state.Func(chargingTracker.State, chargingTracker.Restore))
+		store.Register("driving_state", state.Func(drivingTracker.State, func(s string) {
+			if s != "" {
+				drivingTracker.Restore(s)
+			}
+		}))
+		store.Register("charge_session", state.Func(sessionTracker.Export, sessionTracker.Restore))
+		store.Register("trip", state.Func(tripTracker.Export, tripTracker.Restore))
+		if efficiencyTracker != nil {
+			store.Register("efficiency", state.Func(efficiencyTracker.Export, efficiencyTracker.Restore))
+		}
+		if rangeTracker != nil {
+			store.Register("range", state.Func(rangeTracker.Export, rangeTracker.Restore))
+		}
+		store.Register("distance", state.Func(distanceTracker.Export, distanceTracker.Restore))
+		if battery12VTracker != nil {
+			store.Register("battery_12v", state.Func(battery12VTracker.Export, battery12VTracker.Restore))
+		}
+		store.Register("keepalive_minutes", state.Func(keepalive.minutes, keepalive.restore))
+
+		savedAt, restored, err := store.Load()
+		if err != nil {
+			logger.WithError(err).Warn("collector: ignoring snapshot")
+		}
+		if len(restored) > 0 {
+			logger.WithFields(logrus.Fields{
+				"saved_at": savedAt,
+				"restored": restored,
+			}).Info("Restored state from snapshot")
+		}
+	}
+	var observers []Observer
+	for _, out := range outputs {
+		if o, ok := out.Transmitter.(Observer); ok {
+			observers = append(observers, o)
+		}
+	}
+	if diagnostics != nil {
+		observers = append(observers, diagnostics)
+	}
+
+	var pollChanges <-chan time.Duration
+	if tunables != nil {
+		pollChanges = tunables.PollChanges()
+	}
+	// Reloaded configurations go to the scheduler, which applies the new
+	// MQTT cadence.
+	scheduleChanges := make(chan *config.Config, 1)
+
+	// On-demand polls are pushed straight to MQTT instead of waiting for
+	// its interval.
+	pushNow := make(chan struct{}, 1)
+	// Priority sensor changes from the fast path go to every change-driven
+	// output straight away.
+	pushChanged := make(chan struct{}, 1)
+
+	// diplusDown is set while the Diplus circuit breaker is open; the
+	// scheduler then holds back the last snapshot instead of re-sending
+	// stale data. The client itself logs the transitions.
+	var diplusDown atomic.Bool
+	diplusKnown := false
+	updateDiplusState := func() {
+		connected := diplusClient.Connected()
+		if diplusKnown && connected == !diplusDown.Load() {
+			return
+		}
+		diplusKnown = true
+		diplusDown.Store(!connected)
+		if diagnostics != nil {
+			diagnostics.SetDiplusConnected(connected)
+		}
+		if mqttTx != nil {
+			pubCtx, cancel := context.WithTimeout(ctx, cfg.TransmitTimeout)
+			err := mqttTx.PublishDiplusConnected(pubCtx, connected)
+			cancel()
+			if err != nil {
+				logger.WithError(err).Debug("collector: Diplus state publish failed")
+			}
+		}
+	}
+
+	// Which sensors the car supports is only probed on the car itself, not
+	// on a replay or simulation.
+	var capabilities *capabilityProbe
+	if cfg.CapabilityFile != "" && cfg.DiplusSource == "" {
+		capabilities = newCapabilityProbe(cfg, logger)
+	}
+
+	var lastPoll time.Time
+	var lastData *sensors.SensorData
+	var process, publish func(*sensors.SensorData) *sensors.SensorData
+	poll := func() *sensors.SensorData {
+		if capabilities != nil && capabilities.due(time.Now()) && diplusClient.Connected() {
+			probeCtx, cancel := diplusContext(ctx, cfg)
+			capabilities.probe(probeCtx, diplusClient, mqttTx, logger)
+			cancel()
+		}
+		pollStart := time.Now()
+		lastPoll = pollStart
+		pollCtx, cancel := diplusContext(ctx, cfg)
+		sensorData, err := diplusClient.Poll(pollCtx)
+		cancel()
+		pollDuration := time.Since(pollStart)
+		defer updateDiplusState()
+		if errors.Is(err, api.ErrCircuitOpen) {
+			// No request was made; the breaker is waiting for its next probe.
+			logger.Debug("collector: poll skipped, Diplus circuit breaker open")
+			return nil
+		}
+		if errors.Is(err, context.Canceled) {
+			return nil // shutting down
+		}
+		unchanged := errors.Is(err, api.ErrNotModified) && lastData != nil
+		if unchanged {
+			err = nil
+		}
+		for _, o := range observers {
+			o.PollResult(err)
+			if lo, ok := o.(LatencyObserver); ok {
+				lo.PollDuration(pollDuration)
+			}
+		}
+		if err != nil {
+			logger.WithError(err).WithField("duration", pollDuration).Warn("collector: poll failed")
+			return nil
+		}
+		var data *sensors.SensorData
+		var transition string
+		if unchanged {
+			// Same readings as the last poll, so nothing derived from them
+			// changes either: skip processing and only move the clocks on.
+			logger.WithField("duration", pollDuration).Debug("collector: poll unchanged")
+			raw := *lastRaw
+			raw.Timestamp = pollStart
+			lastRaw = &raw
+			transition = sleeper.observe(&raw)
+			fresh := *lastData
+			fresh.Timestamp = pollStart
+			data = publish(&fresh)
+		} else {
+			logger.WithFields(logrus.Fields{
+				"duration":            pollDuration,
+				"sensors":             sensors.CountValues(sensorData),
+				"unchanged_responses": diplusClient.UnchangedResponses(),
+			}).Debug("collector: poll succeeded")
+			batteryTempsRead = sensors.HasBatteryTemps(sensorData)
+			smoothFresh = nil
+			if holder != nil {
+				if held := holder.Apply(sensorData); len(held) > 0 {
+					logger.WithField("sensor_ids", held).Debug("collector: kept last value of missing sensors")
+				}
+			}
+			// Processing replaces fields rather than modifying their values, so
+			// a shallow copy keeps the raw readings.
+			raw := *sensorData
+			lastRaw = &raw
+			transition = sleeper.observe(sensorData)
+			data = process(sensorData)
+		}
+		if transition != "" {
+			logSleepTransition(logger, sleeper, transition)
+			// Outputs learn about the new mode (and the car waking up)
+			// straight away.
+			select {
+			case pushChanged <- struct{}{}:
+			default:
+			}
+		}
+		return data
+	}
+
+	// Fast path: only the priority sensors, merged into the last full poll.
+	fastPollIDs := func() []int {
+		ids := sensors.PrioritySensorIDs()
+		if len(ids) > 0 && !slices.Contains(ids, powerStatusSensorID) {
+			// Needed to pause the fast path once the car is switched off.
+			ids = append(ids, powerStatusSensorID)
+		}
+		return ids
+	}
+	fastIDs := fastPollIDs()
+	fastPaused := false
+	fastPoll := func() {
+		if lastRaw == nil || len(fastIDs) == 0 {
+			// Wait for a full poll to merge into; no priority sensors are
+			// left after a reload.
+			return
+		}
+		off := lastData != nil && lastData.PowerStatus != nil && *lastData.PowerStatus <= 0
+		if off != fastPaused {
+			fastPaused = off
+			if off {
+				logger.Debug("collector: car off, pausing fast poll")
+			} else {
+				logger.Debug("collector: car on, resuming fast poll")
+			}
+		}
+		if off {
+			return
+		}
+		pollCtx, cancel := diplusContext(ctx, cfg)
+		fastData, err := diplusClient.PollSubset(pollCtx, fastIDs)
+		cancel()
+		if err != nil {
+			// Full polls report Diplus problems; don't repeat them every
+			// few seconds.
+			logger.WithError(err).Debug("collector: fast poll failed")
+			return
+		}
+		batteryTempsRead = sensors.HasBatteryTemps(fastData)
+		smoothFresh = func(id int) bool { return slices.Contains(fastIDs, id) }
+		merged := *lastRaw
+		sensors.MergeSensorData(&merged, fastData)
+		merged.Timestamp = fastData.Timestamp
+		raw := merged
+		lastRaw = &raw
+		prev := lastData
+		data := process(&merged)
+		if sensors.SensorsDiffer(prev, data, fastIDs) {
+			logger.Debug("collector: priority sensor changed, transmitting now")
+			select {
+			case pushChanged <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	process = func(sensorData *sensors.SensorData) *sensors.SensorData {
+		sensors.ApplyTransforms(sensorData)
+		if rangeValidator != nil {
+			for _, msg := range rangeValidator.Apply(sensorData) {
+				logger.WithField("reading", msg).Debug("collector: dropped implausible value")
+			}
+		}
+		debouncer.Apply(sensorData)
+		sensors.DeriveAggregates(sensorData, cfg.WindowOpenThreshold)
+		sensors.DeriveEventTimes(sensorData, deviceLoc)
+		if cfg.ABRPLocation && locationProvider != nil {
+			if loc, err := locationProvider.GetLocation(); err == nil {
+				sensorData.Location = loc
+			}
+		}
+		if geofence != nil {
+			zone, left, entered := geofence.Update(sensorData.Location)
+			if zone != "" {
+				sensorData.LocationZone = &zone
+			}
+			announceZoneChange(ctx, cfg, mqttTx, left, entered, logger)
+		}
+		charging := chargingTracker.Update(sensorData)
+		sensorData.Charging = &charging
+		if done := sessionTracker.Update(sensorData); done != nil {
+			logger.WithFields(logrus.Fields{
+				"soc_gained": done.SOCGained,
+				"energy_kwh": done.EnergyKWh,
+				"peak_kw":    done.PeakPowerKW,
+				"minutes":    math.Round(done.DurationMin),
+				"avg_kw":     math.Round(done.AvgPowerKW*10) / 10,
+				"dcfc":       done.DCFC,
+			}).Info("Charge session finished")
+		}
+		sensorData.ChargeSession = sessionTracker.Last()
+		drivingState := drivingTracker.Update(sensorData)
+		sensorData.DrivingState = &drivingState
+		sensorData.BatteryTempSpread = sensors.BatteryTempSpread(sensorData)
+		thermalState := thermalTracker.Update(sensorData, batteryTempsRead)
+		sensorData.BatteryThermalState = &thermalState
+		announceCarEvents(ctx, cfg, mqttTx, eventTracker.Update(sensorData), logger)
+		if efficiencyTracker != nil {
+			sensorData.EfficiencyWhKM = efficiencyTracker.Update(sensorData)
+		}
+		if rangeTracker != nil {
+			if whKM := rangeTracker.Update(sensorData); whKM != nil {
+				kWh100 := *whKM / 10
+				sensorData.ConsumptionKWh100KM = &kWh100
+				sensorData.RangeEstimateKM = sensors.RollingRangeKM(sensorData, cfg.UsableCapacityKWh)
+			}
+		}
+		if done := tripTracker.Update(sensorData); done != nil {
+			logger.WithFields(logrus.Fields{
+				"distance_km": math.Round(done.DistanceKM*10) / 10,
+				"energy_kwh":  math.Round(done.EnergyKWh*100) / 100,
+				"minutes":     math.Round(done.DurationMin),
+			}).Info("Drive finished")
+		}
+		sensorData.DistanceToday, sensorData.DistanceWeek = distanceTracker.Update(sensorData)
+		sensorData.CurrentTrip = tripTracker.Current()
+		sensorData.LastTrip = tripTracker.Completed()
+		sensors.DeriveTirePressure(sensorData, cfg.TirePressureMin, cfg.TirePressureDeviationPct)
+		sensorData.CabinComfort = sensors.DeriveCabinComfort(sensorData, comfortFormula)
+		if battery12VTracker != nil {
+			sensorData.Battery12VLow, sensorData.Battery12VTrend = battery12VTracker.Update(sensorData)
+		}
+		// Smoothing comes last so the derived sensors above see the raw
+		// values.
+		smoother.Apply(sensorData, smoothFresh)
+		return publish(sensorData)
+	}
+
+	// publish updates the sensors that move with time alone, then hands
+	// sensorData to the outputs.
+	publish = func(sensorData *sensors.SensorData) *sensors.SensorData {
+		if keepalive.observe(sensorData, sensorData.CurrentTrip != nil) {
+			logger.WithFields(logrus.Fields{
+				"minutes":   math.Round(keepalive.minutes()),
+				"next_poll": keepalive.interval(cfg.PollInterval),
+			}).Warn("Polled too long with the car off, dropping to the slowest poll interval")
+			if mqttTx != nil {
+				pubCtx, cancel := context.WithTimeout(ctx, cfg.TransmitTimeout)
+				err := mqttTx.PublishEvent(pubCtx, transmission.EventKeepaliveCap, map[string]interface{}{
+					"keepalive_minutes": math.Round(keepalive.minutes()),
+					"cap_minutes":       cfg.KeepaliveCap.Minutes(),
+				})
+				cancel()
+				if err != nil {
+					logger.WithError(err).Debug("collector: keepalive event publish failed")
+				}
+			}
+		}
+		keepaliveMinutes := math.Round(keepalive.minutes())
+		sensorData.KeepaliveMinutes = &keepaliveMinutes
+		requests := float64(diplusClient.RequestsToday())
+		sensorData.DiplusRequestsToday = &requests
+		if sleeper != nil {
+			mode := sleeper.mode()
+			sensorData.PollMode = &mode
+		}
+		messageBus.Publish(sensorData)
+		lastData = sensorData
+		return sensorData
+	}
+
+	writeSnapshot := func() {
+		if lastRaw == nil {
+			return // nothing polled yet; keep the previous file
+		}
+		if err := store.Save(); err != nil {
+			logger.WithError(err).Warn("collector: failed to write snapshot")
+		}
+	}
+
+	// wakeProbe polls only the wake indicators while polls are backed off;
+	// waking up forces a full poll.
+	wakeProbe := func() bool {
+		if sleeper.mode() != sensors.PollModeSleeping {
+			return false
+		}
+		pollCtx, cancel := diplusContext(ctx, cfg)
+		data, err := diplusClient.PollSubset(pollCtx, sensors.WakeSensorIDs)
+		cancel()
+		if err != nil {
+			logger.WithError(err).Debug("collector: wake probe failed")
+			return false
+		}
+		reason, woke := sleeper.probe(data)
+		if !woke {
+			return false
+		}
+		logger.WithField("reason", reason).Info("Car awake, resuming normal polling")
+		poll()
+		select {
+		case pushChanged <- struct{}{}:
+		default:
+		}
+		return true
+	}
+
 	grp.Go(func() error {
-		ticker := time.NewTicker(config.DiplusPollInterval)
+		normalInterval := cfg.PollInterval
+		currentInterval := normalInterval
+		ticker := time.NewTicker(currentInterval)
 		defer ticker.Stop()
+		// reschedule applies the sleep back-off and the keepalive cap after
+		// each full poll.
+		reschedule := func() {
+			if d := keepalive.interval(sleeper.interval(normalInterval)); d != currentInterval {
+				currentInterval = d
+				ticker.Reset(d)
+			}
+		}
+		var wakeTick <-chan time.Time
+		if sleeper != nil && cfg.WakeProbeInterval > 0 {
+			wakeTicker := time.NewTicker(cfg.WakeProbeInterval)
+			defer wakeTicker.Stop()
+			wakeTick = wakeTicker.C
+		}
+		var snapshotTick <-chan time.Time
+		if snapshotEnabled {
+			snapshotTicker := time.NewTicker(cfg.SnapshotInterval)
+			defer snapshotTicker.Stop()
+			snapshotTick = snapshotTicker.C
+			// Written from this goroutine, so lastRaw and the trackers are
+			// never read halfway through a poll.
+			defer writeSnapshot()
+		}
+		// Fast and full polls share this goroutine, so the trackers never
+		// see two snapshots at once.
+		var fastTick <-chan time.Time
+		var fastTicker *time.Ticker
+		defer func() {
+			if fastTicker != nil {
+				fastTicker.Stop()
+			}
+		}()
+		startFastPoll := func() {
+			if fastTicker != nil || cfg.FastPollInterval <= 0 || len(fastIDs) == 0 {
+				return
+			}
+			fastTicker = time.NewTicker(cfg.FastPollInterval)
+			fastTick = fastTicker.C
+			logger.WithFields(logrus.Fields{
+				"interval": cfg.FastPollInterval,
+				"sensors":  len(fastIDs),
+			}).Info("Fast poll enabled for priority sensors")
+		}
+		startFastPoll()
+		// SIGHUP, or a change to the config file, reloads the configuration;
+		// the next poll uses the new sensors.
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		running := cfg
+		reload := func() {
+			loaded := running
+			if loadConfig != nil {
+				next, err := loadConfig()
+				if err != nil {
+					logger.WithError(err).Warn("Configuration not reloaded; keeping the running one")
+					return
+				}
+				running = applyConfig(running, next, mqttTx, outputs, tunables, scheduleChanges, logger)
+				loaded = next
+			}
+			if reloadSensors(loaded, mqttTx, logger) {
+				fastIDs = fastPollIDs()
+				startFastPoll()
+			}
+		}
+		var watchTick <-chan time.Time
+		var watcher *configWatcher
+		if cfg.ConfigPath != "" {
+			watcher = newConfigWatcher(cfg.ConfigPath)
+			watchTicker := time.NewTicker(configWatchInterval)
+			defer watchTicker.Stop()
+			watchTick = watchTicker.C
+		}
 		for {
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
+			case d := <-pollChanges:
+				normalInterval = d
+				currentInterval = keepalive.interval(sleeper.interval(d))
+				ticker.Reset(currentInterval)
 			case <-ticker.C:
-				sensorData, err := diplusClient.Poll()
-				if err != nil {
-					logger.WithError(err).Warn("collector: poll failed")
+				poll()
+				reschedule()
+			case <-wakeTick:
+				if wakeProbe() {
+					reschedule()
+				}
+			case <-fastTick:
+				fastPoll()
+			case <-hup:
+				reload()
+			case <-watchTick:
+				if watcher.changed() {
+					logger.WithField("path", watcher.path).Info("Config file changed; reloading")
+					reload()
+				}
+			case <-snapshotTick:
+				writeSnapshot()
+			case <-pollTrigger.requests():
+				// A poll that has just run is fresh enough; this keeps a
+				// burst of commands from hammering Diplus.
+				data := lastData
+				if time.Since(lastPoll) >= config.MinPollInterval {
+					logger.Debug("collector: on-demand poll")
+					data = poll()
+					reschedule()
+				}
+				if data == nil {
 					continue
 				}
-				if cfg.ABRPLocation && locationProvider != nil {
-					if loc, err := locationProvider.GetLocation(); err == nil {
-						sensorData.Location = loc
-					}
+				select {
+				case pushNow <- struct{}{}:
+				default:
 				}
-				messageBus.Publish(sensorData)
 			}
 		}
 	})
 
 	// Central scheduler ----------------------------------------------------
+	//
+	// The scheduler decides when each transmitter is due; the manager runs
+	// the transmissions concurrently, so a slow destination only holds up
+	// itself, and the scheduler waits for them at most cfg.TransmitBudget.
 
 	sub := messageBus.Subscribe()
 
 	type txState struct {
+		name             string
 		interval         time.Duration
 		lastSent         time.Time
 		lastForcedUpdate time.Time
 		lastSnap         *sensors.SensorData
-		sendFn           func(context.Context, *sensors.SensorData, *logrus.Logger) error
-		name             string
+		sendUnchanged    bool
+		inFlight         bool
 	}
 
 	var states []txState
 	now := time.Now()
-	if mqttTx != nil {
+	register := func(tx transmission.Transmitter, interval, timeout time.Duration, sendUnchanged bool) {
+		if timeout <= 0 {
+			timeout = cfg.TransmitTimeout
+		}
+		if err := manager.Register(tx, timeout); err != nil {
+			logger.WithError(err).Warn("app: transmitter not scheduled")
+			return
+		}
 		states = append(states, txState{
-			interval:         cfg.MQTTInterval,
-			lastSent:         now.Add(-cfg.MQTTInterval),
+			name:             tx.Name(),
+			interval:         interval,
+			lastSent:         now.Add(-interval),
 			lastForcedUpdate: now.Add(-cfg.ForceUpdateInterval), // Initialize so forced update triggers immediately on startup
-			sendFn: func(c context.Context, s *sensors.SensorData, l *logrus.Logger) error {
-				return transmitToMQTTAsync(c, mqttTx, s, l)
-			},
-			name: "MQTT",
+			sendUnchanged:    sendUnchanged,
 		})
 	}
+	if mqttTx != nil {
+		// The transmitter skips unchanged topics itself; it needs every
+		// cycle to publish always or refresh them.
+		register(mqttTx, cfg.MQTTInterval, 0, mqttSendsUnchanged(cfg))
+	}
 	if abrpTx != nil {
-		states = append(states, txState{
-			interval:         cfg.ABRPInterval,
-			lastSent:         now.Add(-cfg.ABRPInterval),
-			lastForcedUpdate: now.Add(-cfg.ForceUpdateInterval), // Initialize so forced update triggers immediately on startup
-			sendFn: func(c context.Context, s *sensors.SensorData, l *logrus.Logger) error {
-				return transmitToABRPAsync(c, abrpTx, s, l)
-			},
-			name: "ABRP",
-		})
+		// ABRP runs on its own cadence (driving/charging or parked, see
+		// ABRPTransmitter.Interval) independent of the poll interval, so it
+		// is sent the latest snapshot even when nothing changed.
+		register(abrpTx, cfg.ABRPInterval, cfg.ABRPTransmitTimeout, true)
+	}
+	for _, out := range outputs {
+		register(out.Transmitter, out.Interval, out.Timeout, out.SendUnchanged)
+	}
+
+	type txResult struct {
+		index    int
+		snap     *sensors.SensorData
+		forced   bool
+		started  time.Time
+		duration time.Duration
+		err      error
 	}
+	results := make(chan txResult, len(states))
+	// Each transmission gets its own deadline derived from this context. It
+	// outlives ctx so a shutdown lets transmissions finish; Manager.Close
+	// cancels the stragglers.
+	sendCtx := context.WithoutCancel(ctx)
 
 	grp.Go(func() error {
 		var latest *sensors.SensorData
+		forceUpdateInterval := cfg.ForceUpdateInterval
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
+			case next := <-scheduleChanges:
+				forceUpdateInterval = next.ForceUpdateInterval
+				for i := range states {
+					if mqttTx != nil && states[i].name == mqttTx.Name() {
+						states[i].interval = next.MQTTInterval
+						states[i].sendUnchanged = mqttSendsUnchanged(next)
+					}
+				}
 			case snap, ok := <-sub:
 				if !ok {
 					return nil
 				}
 				latest = snap
+			case <-pushNow:
+				// Make MQTT due on the next tick regardless of its interval.
+				for i := range states {
+					if mqttTx != nil && states[i].name == mqttTx.Name() {
+						states[i].lastSent = time.Time{}
+						states[i].lastSnap = nil
+					}
+				}
+			case <-pushChanged:
+				// Outputs driven by changes become due on the next tick;
+				// the ones sending on a fixed cadence (ABRP, Traccar, …)
+				// keep it.
+				for i := range states {
+					if !states[i].sendUnchanged {
+						states[i].lastSent = time.Time{}
+					}
+				}
+			case res := <-results:
+				st := &states[res.index]
+				st.inFlight = false
+				if errors.Is(res.err, transmission.ErrNotReady) {
+					// Still connecting: send the latest snapshot as soon
+					// as it has joined.
+					st.lastSent = time.Time{}
+					continue
+				}
+				for _, o := range observers {
+					o.TransmitResult(st.name, res.err)
+				}
+				if res.err != nil {
+					logger.WithError(res.err).WithFields(logrus.Fields{
+						"transmitter": st.name,
+						"duration":    res.duration,
+					}).Warn(st.name + " transmit failed")
+					// Ensure we retry even if no data change.
+					// Reset lastSnap so Changed() will evaluate to true on the next
+					// scheduler tick; lastSent was bumped when the send started so
+					// we still respect the configured transmission interval.
+					st.lastSnap = nil
+					continue
+				}
+				logger.WithFields(logrus.Fields{
+					"transmitter": st.name,
+					"duration":    res.duration,
+					"forced":      res.forced,
+				}).Debug("transmit succeeded")
+				st.lastSnap = res.snap
+				if res.forced {
+					st.lastForcedUpdate = res.started
+					logger.WithField("transmitter", st.name).Debug("Forced update transmitted")
+				}
 			case <-ticker.C:
-				if latest == nil {
+				if latest == nil || diplusDown.Load() {
 					continue
 				}
 				now := time.Now()
+				due := make(map[string]txResult)
+				var names []string
 				for i := range states {
 					st := &states[i]
+					if st.inFlight {
+						continue
+					}
 					// Dynamic interval for ABRP depending on vehicle state.
 					interval := st.interval
-					if st.name == "ABRP" {
-						interval = computeABRPInterval(latest)
+					if abrpTx != nil && st.name == abrpTx.Name() {
+						interval = abrpTx.Interval(latest)
 					}
 
 					// Check if forced update interval has elapsed (if enabled)
-					forceUpdate := cfg.ForceUpdateInterval > 0 && now.Sub(st.lastForcedUpdate) >= cfg.ForceUpdateInterval
-
-					// If not forcing an update, check regular interval and change detection
-					if !forceUpdate {
-						if now.Sub(st.lastSent) < interval {
-							continue
-						}
-						if !domain.Changed(st.lastSnap, latest) {
-							continue
-						}
-					} else {
-						// For forced updates, still respect minimum interval to avoid spam
-						if now.Sub(st.lastSent) < interval {
-							continue
-						}
-					}
+					forceUpdate := forceUpdateInterval > 0 && now.Sub(st.lastForcedUpdate) >= forceUpdateInterval
 
-					if err := st.sendFn(ctx, latest, logger); err != nil {
-						logger.WithError(err).Warn(st.name + " transmit failed")
-						// Ensure we retry even if no data change.
-						// Reset lastSnap so Changed() will evaluate to true on the next
-						// scheduler tick, and bump lastSent so we still respect the
-						// configured transmission interval.
-						st.lastSnap = nil
-						st.lastSent = now
-					} else {
-						st.lastSnap = latest
-						st.lastSent = now
-						if forceUpdate {
-							st.lastForcedUpdate = now
-							logger.WithField("transmitter", st.name).Debug("Forced update transmitted")
-						}
+					// Forced updates still respect the minimum interval to
+					// avoid spam; regular ones also require a change.
+					if now.Sub(st.lastSent) < interval {
+						continue
+					}
+					if !forceUpdate && !st.sendUnchanged && !domain.Changed(st.lastSnap, latest) {
+						continue
 					}
+
+					st.inFlight = true
+					st.lastSent = now
+					due[st.name] = txResult{index: i, snap: latest, forced: forceUpdate, started: now}
+					names = append(names, st.name)
+				}
+				if len(names) == 0 {
+					continue
+				}
+				// Wait for this cycle's transmissions up to the budget;
+				// the ones still running report through results later
+				// and stay in flight, so they miss the next cycle.
+				err := manager.SendAll(sendCtx, names, latest, cfg.TransmitBudget, func(name string, err error) {
+					res := due[name]
+					res.duration = time.Since(res.started)
+					res.err = err
+					results <- res
+				})
+				if errors.Is(err, transmission.ErrOverBudget) {
+					logger.WithError(err).Debug("scheduler: cycle budget exceeded")
 				}
 			}
 		}
@@ -199,28 +890,20 @@ func Run(
 	}
 }
 
-func transmitToABRPAsync(ctx context.Context, tx *transmission.ABRPTransmitter, data *sensors.SensorData, logger *logrus.Logger) error {
-	if tx == nil || data == nil {
-		return nil
+// logSleepTransition logs a poll mode change detected by a full poll.
+func logSleepTransition(logger *logrus.Logger, sleeper *sleepPolicy, reason string) {
+	if sleeper.mode() == sensors.PollModeSleeping {
+		logger.WithField("next_poll", sleeper.intervals[sleeper.step]).Info("Car asleep, backing off polls")
+		return
 	}
-	// Bound the transmission time so that a prolonged network outage does not
-	// block the central scheduler indefinitely.
-	ctxTx, cancel := context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
-
-	if err := tx.TransmitWithContext(ctxTx, data); err != nil {
-		return fmt.Errorf("ABRP transmit failed: %w", err)
-	}
-	return nil
+	logger.WithField("reason", reason).Info("Car awake, resuming normal polling")
 }
 
-func transmitToMQTTAsync(ctx context.Context, tx *transmission.MQTTTransmitter, data *sensors.SensorData, logger *logrus.Logger) error {
-	if tx == nil || data == nil {
-		return nil
-	}
-	_ = ctx
-	if err := tx.Transmit(data); err != nil {
-		return fmt.Errorf("MQTT transmit failed: %w", err)
+// diplusContext derives the context of one Diplus poll from ctx, with the
+// configured per-poll deadline.
+func diplusContext(ctx context.Context, cfg *config.Config) (context.Context, context.CancelFunc) {
+	if cfg.DiplusPollTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
-	return nil
+	return context.WithTimeout(ctx, cfg.DiplusPollTimeout)
 }
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/api"
+	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/transmission"
+	"github.com/sirupsen/logrus"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// eventLog records Diplus polls (p) and ABRP posts (a) in the order they
+// happen.
+type eventLog struct {
+	mu     sync.Mutex
+	events []byte
+}
+
+func (l *eventLog) add(e byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *eventLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return string(l.events)
+}
+
+// TestABRPTimerIndependentOfPoll runs Run against a fake Diplus server and
+// ABRP endpoint and checks that neither cadence drives the other.
+func TestABRPTimerIndependentOfPoll(t *testing.T) {
+	tests := []struct {
+		name         string
+		pollInterval time.Duration
+		abrpInterval time.Duration
+		// done tells when the events show the expected pattern.
+		done func(events string) bool
+	}{
+		{
+			// Two posts without a poll in between.
+			name:         "ABRP resends between polls",
+			pollInterval: 4 * time.Second,
+			abrpInterval: time.Second,
+			done: func(events string) bool {
+				return strings.Contains(events, "paa")
+			},
+		},
+		{
+			// Only the first post goes out while polls continue.
+			name:         "polls go on between ABRP posts",
+			pollInterval: 20 * time.Millisecond,
+			abrpInterval: time.Hour,
+			done: func(events string) bool {
+				_, after, ok := strings.Cut(events, "a")
+				return ok && !strings.Contains(after, "a") && strings.Count(after, "p") >= 5
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			logger := quietLogger()
+			var log eventLog
+
+			diplus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				log.add('p')
+				var parts []string
+				for _, part := range strings.Split(r.URL.Query().Get("text"), "|") {
+					field, _, _ := strings.Cut(part, ":")
+					parts = append(parts, field+":1")
+				}
+				json.NewEncoder(w).Encode(sensors.APIResponse{Success: true, Val: strings.Join(parts, "|")})
+			}))
+			defer diplus.Close()
+
+			abrpTx := transmission.NewABRPTransmitter("key", []string{"token"}, logger)
+			if err := abrpTx.SetMode(transmission.ABRPModeHTTP); err != nil {
+				t.Fatal(err)
+			}
+			abrpTx.SetRatePolicy(tt.abrpInterval, tt.abrpInterval)
+			abrpTx.SetTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				log.add('a')
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Header: make(http.Header), Request: r}, nil
+			}))
+
+			cfg := config.GetDefaultConfig()
+			cfg.PollInterval = tt.pollInterval
+			cfg.ABRPInterval = tt.abrpInterval
+			cfg.ABRPParkedInterval = tt.abrpInterval
+			cfg.SnapshotFile = ""
+			cfg.CapabilityFile = ""
+			cfg.SleepIntervals = nil
+			cfg.KeepaliveCap = 0
+
+			manager := transmission.NewManager(logger)
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				Run(ctx, cfg, api.NewDiplusClient(diplus.URL, logger), nil, nil, abrpTx, nil,
+					manager, nil, nil, nil, nil, logger)
+			}()
+			defer func() {
+				cancel()
+				<-stopped
+			}()
+
+			deadline := time.After(20 * time.Second)
+			for !tt.done(log.String()) {
+				select {
+				case <-deadline:
+					t.Fatalf("events %q (p poll, a ABRP post) never matched", log.String())
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/api"
+	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/transmission"
+	"github.com/sirupsen/logrus"
+)
+
+// capabilityMaxAge is how old the capability map may get before the car is
+// probed again, in case a software update added sensors.
+const capabilityMaxAge = 7 * 24 * time.Hour
+
+// capabilityProbe keeps the car's capability map (sensors.Capabilities) in
+// cfg.CapabilityFile. The car is probed with the first poll when the file is
+// missing or -redetect is set, and again once the map is capabilityMaxAge
+// old.
+type capabilityProbe struct {
+	path  string
+	force []int
+	next  time.Time // zero = probe before the next poll
+}
+
+// newCapabilityProbe loads cfg.CapabilityFile and installs the capability
+// map it holds.
+func newCapabilityProbe(cfg *config.Config, logger *logrus.Logger) *capabilityProbe {
+	force, _ := sensors.ParseSensorIDList(cfg.SensorForce) // validated while parsing flags
+	p := &capabilityProbe{path: cfg.CapabilityFile, force: force}
+
+	data, err := os.ReadFile(p.path)
+	if os.IsNotExist(err) {
+		return p
+	}
+	var c sensors.Capabilities
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		logger.WithError(err).Warn("capabilities: ignoring capability file; probing the car again")
+		return p
+	}
+	excluded := sensors.SetSupportedSensors(c, force)
+	logger.WithFields(logrus.Fields{
+		"detected_at": c.DetectedAt,
+		"detected":    fmt.Sprintf("%d/%d", len(c.Supported), len(sensors.AllSensors)),
+		"excluded":    describeSensors(excluded),
+	}).Info("Using the sensors detected earlier")
+	if !cfg.Redetect {
+		p.next = c.DetectedAt.Add(capabilityMaxAge)
+	}
+	return p
+}
+
+// due reports whether the car is to be probed before the poll at now.
+func (p *capabilityProbe) due(now time.Time) bool {
+	return !now.Before(p.next)
+}
+
+// probe polls every known sensor once and installs and saves the sensors
+// that returned a value. Entities of sensors no longer published are
+// withdrawn from Home Assistant. A failed probe is retried before the next
+// poll.
+func (p *capabilityProbe) probe(ctx context.Context, client *api.DiplusClient, mqttTx *transmission.MQTTTransmitter, logger *logrus.Logger) {
+	data, err := client.GetAllSensorData(ctx)
+	if err != nil {
+		logger.WithError(err).Debug("capabilities: probe failed; retrying with the next poll")
+		return
+	}
+	c := sensors.DetectCapabilities(data, time.Now())
+	if len(c.Supported) == 0 {
+		logger.Debug("capabilities: probe returned no values; retrying with the next poll")
+		return
+	}
+	p.next = c.DetectedAt.Add(capabilityMaxAge)
+
+	publishedBefore := sensors.PublishedSensorIDs()
+	smoothedBefore := sensors.SmoothedSensorIDs()
+	excluded := sensors.SetSupportedSensors(c, p.force)
+	withdrawSensors(mqttTx, publishedBefore, smoothedBefore)
+	logger.WithFields(logrus.Fields{
+		"detected":    fmt.Sprintf("%d/%d", len(c.Supported), len(sensors.AllSensors)),
+		"excluded":    describeSensors(excluded),
+		"unsupported": describeSensors(c.Unsupported()),
+	}).Info("Detected the sensors the car supports")
+
+	out, err := json.MarshalIndent(c, "", "  ")
+	if err == nil {
+		err = config.WriteFileAtomic(p.path, out)
+	}
+	if err != nil {
+		logger.WithError(err).Warn("capabilities: failed to save capability file")
+	}
+}
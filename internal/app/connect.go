@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/transmission"
+	"github.com/sirupsen/logrus"
+)
+
+// Retry delays of an output that could not connect at startup.
+const (
+	connectRetryMin = 5 * time.Second
+	connectRetryMax = time.Minute
+)
+
+// Startup tracks the outputs ConnectOutputs is connecting.
+type Startup struct {
+	anyOnce   sync.Once
+	anyReady  chan struct{}
+	attempted chan struct{}
+}
+
+// AnyReady is closed once at least one output can transmit, or every output
+// has had its first attempt: polling then starts either way.
+func (s *Startup) AnyReady() <-chan struct{} {
+	return s.anyReady
+}
+
+// Attempted is closed once every output has connected or failed its first
+// attempt.
+func (s *Startup) Attempted() <-chan struct{} {
+	return s.attempted
+}
+
+func (s *Startup) markReady() {
+	s.anyOnce.Do(func() { close(s.anyReady) })
+}
+
+// ConnectOutputs connects every output that has to reach a server first
+// (transmission.Connector) at once, so a slow broker holds up neither the
+// other outputs nor the first poll. Each attempt gets timeout. Until an
+// output is connected manager holds back its transmissions; one that misses
+// its first attempt keeps retrying with backoff until ctx is done and joins
+// the fan-out once connected.
+func ConnectOutputs(ctx context.Context, txs []transmission.Transmitter, timeout time.Duration, manager *transmission.Manager, logger *logrus.Logger) *Startup {
+	s := &Startup{anyReady: make(chan struct{}), attempted: make(chan struct{})}
+	var wg sync.WaitGroup
+	for _, tx := range txs {
+		c, ok := tx.(transmission.Connector)
+		if !ok {
+			s.markReady()
+			continue
+		}
+		manager.Await(c.Name())
+		wg.Add(1)
+		go func() {
+			start := time.Now()
+			first := true
+			delay := connectRetryMin
+			for {
+				attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+				err := c.Connect(attemptCtx)
+				cancel()
+				if err == nil {
+					manager.Ready(c.Name())
+					logger.WithFields(logrus.Fields{
+						"output":   c.Name(),
+						"duration": time.Since(start).Round(time.Millisecond),
+					}).Info("Output connected")
+					s.markReady()
+					if first {
+						wg.Done()
+					}
+					return
+				}
+				entry := logger.WithError(err).WithFields(logrus.Fields{
+					"output":   c.Name(),
+					"duration": time.Since(start).Round(time.Millisecond),
+					"retry_in": delay,
+				})
+				if first {
+					entry.Warn("Output not connected yet; it joins once connected")
+					first = false
+					wg.Done()
+				} else {
+					entry.Debug("Output still not connected")
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+				delay = min(delay*2, connectRetryMax)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(s.attempted)
+		s.markReady()
+	}()
+	return s
+}
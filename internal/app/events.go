@@ -0,0 +1,27 @@
+package app
+
+import (
+	"context"
+
+	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/transmission"
+	"github.com/sirupsen/logrus"
+)
+
+// announceCarEvents logs events and publishes them on the Car Event entity
+// (when MQTT is enabled).
+func announceCarEvents(ctx context.Context, cfg *config.Config, mqttTx *transmission.MQTTTransmitter, events []sensors.CarEvent, logger *logrus.Logger) {
+	for _, ev := range events {
+		logger.WithFields(logrus.Fields(ev.Attrs)).WithField("event", ev.Type).Info("Car event")
+		if mqttTx == nil {
+			continue
+		}
+		pubCtx, cancel := context.WithTimeout(ctx, cfg.TransmitTimeout)
+		err := mqttTx.PublishCarEvent(pubCtx, ev)
+		cancel()
+		if err != nil {
+			logger.WithError(err).Debug("collector: car event publish failed")
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"context"
+
+	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/Allthebester/byd-hass/internal/location"
+	"github.com/Allthebester/byd-hass/internal/transmission"
+	"github.com/sirupsen/logrus"
+)
+
+// loadZones collects the geofence zones from cfg.Zones, cfg.ZonesFile and
+// cfg.Geofences. Unusable entries are logged and skipped.
+func loadZones(cfg *config.Config, logger *logrus.Logger) []location.Zone {
+	zones, warnings := location.ParseZones(cfg.Zones)
+	zones = append(zones, cfg.Geofences...)
+	if cfg.ZonesFile != "" {
+		fromFile, fileWarnings, err := location.ReadZonesFile(cfg.ZonesFile)
+		if err != nil {
+			logger.WithError(err).Warn("Ignoring -zones-file")
+		}
+		zones = append(zones, fromFile...)
+		warnings = append(warnings, fileWarnings...)
+	}
+	for _, w := range warnings {
+		logger.Warn(w)
+	}
+	return zones
+}
+
+// announceZoneChange logs a zone change and publishes it as zone events
+// (when MQTT is enabled); left and entered are as returned by
+// location.Geofence.Update.
+func announceZoneChange(ctx context.Context, cfg *config.Config, mqttTx *transmission.MQTTTransmitter, left, entered string, logger *logrus.Logger) {
+	for _, ev := range []struct{ eventType, zone string }{
+		{transmission.EventZoneLeave, left},
+		{transmission.EventZoneEnter, entered},
+	} {
+		if ev.zone == "" {
+			continue
+		}
+		logger.WithFields(logrus.Fields{"zone": ev.zone, "event": ev.eventType}).Info("Zone changed")
+		if mqttTx == nil {
+			continue
+		}
+		pubCtx, cancel := context.WithTimeout(ctx, cfg.TransmitTimeout)
+		err := mqttTx.PublishZoneEvent(pubCtx, ev.eventType, ev.zone)
+		cancel()
+		if err != nil {
+			logger.WithError(err).Debug("collector: zone event publish failed")
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// keepaliveWatchdog measures how long the collector has kept the head-unit
+// busy while the car is switched off (PowerStatus 0), e.g. parked in sentry
+// mode, which slowly drains the 12 V battery. The total resets with every
+// drive, when the 12 V battery is recharged.
+//
+// Once the total reaches limit the watchdog caps polling at the slowest
+// interval until the car is switched on again. It is only used from the
+// collector goroutine.
+type keepaliveWatchdog struct {
+	limit   time.Duration // 0 = never cap
+	slowest time.Duration
+
+	total   time.Duration
+	lastOff time.Time // previous sample that found the car off
+	capped  bool
+}
+
+func newKeepaliveWatchdog(limit, slowest time.Duration) *keepaliveWatchdog {
+	return &keepaliveWatchdog{limit: limit, slowest: slowest}
+}
+
+// observe feeds a processed sample; driving is true while a drive is in
+// progress. It reports whether this sample reached the limit.
+func (w *keepaliveWatchdog) observe(data *sensors.SensorData, driving bool) bool {
+	if driving {
+		w.total, w.lastOff, w.capped = 0, time.Time{}, false
+		return false
+	}
+	if data.PowerStatus == nil || *data.PowerStatus > 0 {
+		w.lastOff, w.capped = time.Time{}, false
+		return false
+	}
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if !w.lastOff.IsZero() && now.After(w.lastOff) {
+		w.total += now.Sub(w.lastOff)
+	}
+	w.lastOff = now
+	if w.limit <= 0 || w.capped || w.total < w.limit {
+		return false
+	}
+	w.capped = true
+	return true
+}
+
+// minutes returns the time polled with the car off since the last drive.
+func (w *keepaliveWatchdog) minutes() float64 {
+	return w.total.Minutes()
+}
+
+// restore continues counting from a total kept across a restart. The
+// downtime itself is not counted.
+func (w *keepaliveWatchdog) restore(minutes float64) {
+	w.total = time.Duration(minutes * float64(time.Minute))
+}
+
+// interval returns how long to wait before the next full poll.
+func (w *keepaliveWatchdog) interval(d time.Duration) time.Duration {
+	if !w.capped {
+		return d
+	}
+	return max(d, w.slowest)
+}
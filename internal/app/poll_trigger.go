@@ -0,0 +1,28 @@
+package app
+
+// PollTrigger requests out-of-cycle polls (e.g. from the MQTT poll command).
+// Requests are coalesced: however many arrive while one is pending, the
+// collector runs a single extra poll.
+type PollTrigger struct {
+	ch chan struct{}
+}
+
+// NewPollTrigger creates a trigger with no pending request.
+func NewPollTrigger() *PollTrigger {
+	return &PollTrigger{ch: make(chan struct{}, 1)}
+}
+
+// PollNow requests an immediate poll. It never blocks.
+func (p *PollTrigger) PollNow() {
+	select {
+	case p.ch <- struct{}{}:
+	default:
+	}
+}
+
+func (p *PollTrigger) requests() <-chan struct{} {
+	if p == nil {
+		return nil
+	}
+	return p.ch
+}
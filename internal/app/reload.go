@@ -0,0 +1,197 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/transmission"
+	"github.com/sirupsen/logrus"
+)
+
+// configWatchInterval is how often the config file is checked for changes.
+const configWatchInterval = 5 * time.Second
+
+// reloadableSettings are the settings a configuration reload applies while
+// running. A change to any other one is logged and takes effect after a
+// restart. The sensor list is reloaded separately (see reloadSensors).
+var reloadableSettings = map[string]bool{
+	"poll_interval":         true,
+	"abrp_interval":         true,
+	"abrp_parked_interval":  true,
+	"mqtt_interval":         true,
+	"force_update_interval": true,
+	"publish_mode":          true,
+	"publish_deadband":      true,
+	"publish_deadbands":     true,
+	"publish_refresh":       true,
+	"mqtt_cleanup":          true,
+	"mqtt_qos":              true,
+	"units":                 true,
+	"log_level":             true,
+	"verbose":               true,
+}
+
+// applyConfig applies the reloadable settings that differ between running
+// and next, and logs those that need a restart. It returns the new running
+// configuration: running with the reloadable settings of next.
+func applyConfig(running, next *config.Config, mqttTx *transmission.MQTTTransmitter, outputs []Output, tunables *Tunables, schedule chan *config.Config, logger *logrus.Logger) *config.Config {
+	var applied, restart []string
+	for _, key := range running.Changed(next) {
+		if reloadableSettings[key] {
+			applied = append(applied, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+	if len(restart) > 0 {
+		logger.WithField("settings", restart).Warn("Changed settings need a restart to take effect")
+	}
+	if len(applied) == 0 {
+		if len(restart) == 0 {
+			logger.Info("Configuration reloaded; nothing changed")
+		}
+		return running
+	}
+
+	if mqttTx != nil {
+		if err := mqttTx.SetPublishMode(next.PublishMode, next.PublishDeadband); err != nil {
+			logger.WithError(err).Warn("MQTT publish mode not reloaded")
+		}
+		if err := mqttTx.SetSensorDeadbands(next.PublishDeadbands); err != nil {
+			logger.WithError(err).Warn("MQTT per-sensor deadbands not reloaded")
+		}
+		if err := mqttTx.SetQoS(next.MQTTQoS); err != nil {
+			logger.WithError(err).Warn("MQTT QoS not reloaded")
+		}
+		mqttTx.SetRepublishInterval(next.MQTTRepublishInterval())
+		mqttTx.SetCleanup(next.MQTTCleanup)
+	}
+	for _, s := range UnitSetters(mqttTx, outputs) {
+		s.SetUnits(next.Units)
+	}
+	if tunables != nil {
+		tunables.Reload(running, next)
+	}
+	// Keep only the newest configuration if the scheduler has not picked
+	// up the previous one yet.
+	select {
+	case <-schedule:
+	default:
+	}
+	schedule <- next
+	logger.WithField("settings", applied).Info("Configuration reloaded")
+	return running.With(next, applied)
+}
+
+// UnitSetters returns mqttTx (if set) and the outputs that take a unit system.
+func UnitSetters(mqttTx *transmission.MQTTTransmitter, outputs []Output) []transmission.UnitSetter {
+	var setters []transmission.UnitSetter
+	if mqttTx != nil {
+		setters = append(setters, mqttTx)
+	}
+	for _, out := range outputs {
+		if s, ok := out.Transmitter.(transmission.UnitSetter); ok {
+			setters = append(setters, s)
+		}
+	}
+	return setters
+}
+
+// mqttSendsUnchanged reports whether MQTT needs every cycle: the transmitter
+// skips unchanged topics itself, but has to see them to publish always or
+// refresh them.
+func mqttSendsUnchanged(cfg *config.Config) bool {
+	return cfg.PublishMode == transmission.PublishAlways || cfg.PublishRefresh > 0
+}
+
+// configWatcher notices changes to a file's modification time or size.
+type configWatcher struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func newConfigWatcher(path string) *configWatcher {
+	w := &configWatcher{path: path}
+	w.changed()
+	return w
+}
+
+// changed reports whether the file differs from the last check. A missing
+// file counts as unchanged, so one replaced by an editor is picked up once
+// it is back.
+func (w *configWatcher) changed() bool {
+	fi, err := os.Stat(w.path)
+	if err != nil || (fi.ModTime().Equal(w.modTime) && fi.Size() == w.size) {
+		return false
+	}
+	w.modTime, w.size = fi.ModTime(), fi.Size()
+	return true
+}
+
+// reloadSensors applies the sensor list and transforms of cfg, a freshly
+// loaded configuration, and swaps in the new monitored sensors. Entities of
+// sensors that are no longer published are withdrawn from Home Assistant;
+// newly published ones are announced by the next MQTT discovery cycle. It
+// reports whether anything changed.
+func reloadSensors(cfg *config.Config, mqttTx *transmission.MQTTTransmitter, logger *logrus.Logger) bool {
+	publishedBefore := sensors.PublishedSensorIDs()
+	smoothedBefore := sensors.SmoothedSensorIDs()
+	diff, warnings := sensors.ReloadMonitoredSensors(cfg.SensorIDs, cfg.Transform)
+	for _, w := range warnings {
+		logger.Warn(w)
+	}
+	if diff.Empty() {
+		logger.Info("Sensor configuration reloaded; nothing changed")
+		return false
+	}
+	logger.WithFields(logrus.Fields{
+		"added":   describeSensors(diff.Added),
+		"removed": describeSensors(diff.Removed),
+		"changed": describeSensors(diff.Changed),
+	}).Info("Sensor configuration reloaded")
+
+	withdrawSensors(mqttTx, publishedBefore, smoothedBefore)
+	return true
+}
+
+// withdrawSensors removes the Home Assistant entities of the sensors in
+// publishedBefore and smoothedBefore that are no longer published.
+func withdrawSensors(mqttTx *transmission.MQTTTransmitter, publishedBefore, smoothedBefore []int) {
+	if mqttTx == nil {
+		return
+	}
+	published := sensors.PublishedSensorIDs()
+	var withdrawn []int
+	for _, id := range publishedBefore {
+		if !slices.Contains(published, id) {
+			withdrawn = append(withdrawn, id)
+		}
+	}
+	mqttTx.RemoveSensors(withdrawn)
+	smoothed := sensors.SmoothedSensorIDs()
+	withdrawn = nil
+	for _, id := range smoothedBefore {
+		if !slices.Contains(smoothed, id) {
+			withdrawn = append(withdrawn, id)
+		}
+	}
+	mqttTx.RemoveSmoothedSensors(withdrawn)
+}
+
+// describeSensors labels sensor IDs with their names for the reload log.
+func describeSensors(ids []int) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if def := sensors.GetSensorByID(id); def != nil {
+			out = append(out, fmt.Sprintf("%d %s", id, def.EnglishName))
+		} else {
+			out = append(out, fmt.Sprint(id))
+		}
+	}
+	return out
+}
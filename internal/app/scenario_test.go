@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/api"
+	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/transmission"
+)
+
+// recordingOutput is an output that keeps the last snapshot it was sent.
+type recordingOutput struct {
+	mu   sync.Mutex
+	last *sensors.SensorData
+}
+
+func (r *recordingOutput) Transmit(_ context.Context, data *sensors.SensorData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = data
+	return nil
+}
+
+func (r *recordingOutput) latest() *sensors.SensorData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+func (r *recordingOutput) IsConnected() bool           { return true }
+func (r *recordingOutput) Name() string                { return "recorder" }
+func (r *recordingOutput) Close(context.Context) error { return nil }
+
+// TestScenarios replays the example scenarios through Run, one simulated
+// step per poll, and checks the sessions reported once they are over.
+func TestScenarios(t *testing.T) {
+	tests := []struct {
+		file string
+		// done tells when the scenario's outcome has been sent.
+		done  func(*sensors.SensorData) bool
+		check func(*testing.T, *sensors.SensorData)
+	}{
+		{
+			file: "dc-charge.yaml",
+			done: func(d *sensors.SensorData) bool {
+				return d.ChargeSession != nil && !d.ChargeSession.Active
+			},
+			check: func(t *testing.T, d *sensors.SensorData) {
+				s := d.ChargeSession
+				if !s.DCFC {
+					t.Error("charge session not reported as DC fast charge")
+				}
+				if s.DurationMin < 17 || s.DurationMin > 23 {
+					t.Errorf("charge session lasted %.1f min, want about 20", s.DurationMin)
+				}
+				if s.StartSOC != 20 || s.EndSOC != 75 {
+					t.Errorf("charged from %g %% to %g %%, want 20 to 75", s.StartSOC, s.EndSOC)
+				}
+				if d.Charging == nil || d.Charging.Charging {
+					t.Errorf("charging = %v after unplugging, want false", d.Charging)
+				}
+			},
+		},
+		{
+			file: "commute.yaml",
+			done: func(d *sensors.SensorData) bool {
+				return d.LastTrip != nil && d.CurrentTrip == nil
+			},
+			check: func(t *testing.T, d *sensors.SensorData) {
+				trip := d.LastTrip
+				if trip.DistanceKM < 30 || trip.DistanceKM > 36 {
+					t.Errorf("drove %.1f km, want about 33", trip.DistanceKM)
+				}
+				if trip.MaxSpeedKMH != 115 {
+					t.Errorf("max speed %g km/h, want 115", trip.MaxSpeedKMH)
+				}
+				if d.ChargeSession != nil {
+					t.Errorf("unexpected charge session %+v", d.ChargeSession)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			logger := quietLogger()
+			client, err := api.NewDiplusSimClient("../../examples/scenarios/"+tt.file, 0, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := config.GetDefaultConfig()
+			cfg.PollInterval = 5 * time.Millisecond
+			cfg.SnapshotFile = ""
+			cfg.CapabilityFile = ""
+			cfg.DiplusSource = "sim:" + tt.file
+			// Parked, the car would otherwise be polled minutes apart.
+			cfg.SleepIntervals = nil
+			cfg.KeepaliveCap = 0
+
+			out := &recordingOutput{}
+			manager := transmission.NewManager(logger)
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				Run(ctx, cfg, client, nil, nil, nil, []Output{{Transmitter: out, SendUnchanged: true}},
+					manager, nil, nil, nil, nil, logger)
+			}()
+			defer func() {
+				cancel()
+				<-stopped
+			}()
+
+			deadline := time.After(20 * time.Second)
+			for {
+				if d := out.latest(); d != nil && tt.done(d) {
+					tt.check(t, d)
+					return
+				}
+				select {
+				case <-deadline:
+					last := "nothing"
+					if d := out.latest(); d != nil {
+						last = d.Timestamp.String()
+					}
+					t.Fatalf("scenario outcome not sent; last snapshot from %s", last)
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+		})
+	}
+}
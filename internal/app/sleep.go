@@ -0,0 +1,100 @@
+package app
+
+import (
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// sleepPolicy backs off full polls while the car is switched off, so the
+// collector doesn't keep the head-unit (and the 12 V battery) busy every few
+// seconds overnight.
+//
+// After `after` consecutive polls found the car asleep (see
+// sensors.CarAsleep) the policy goes to sleep: each following poll waits
+// for the next entry of intervals, the last one being the cap. The first
+// poll showing a wake indicator (sensors.WakeReason) snaps it back to
+// active. It is only used from the collector goroutine.
+type sleepPolicy struct {
+	after     int
+	intervals []time.Duration
+
+	asleepCount int
+	sleeping    bool
+	step        int
+	baseline    *sensors.SensorData // sample the car fell asleep with
+}
+
+// newSleepPolicy returns nil when intervals is empty (sleep disabled).
+func newSleepPolicy(after int, intervals []time.Duration) *sleepPolicy {
+	if len(intervals) == 0 {
+		return nil
+	}
+	return &sleepPolicy{after: max(after, 1), intervals: intervals}
+}
+
+// mode returns the current poll mode.
+func (p *sleepPolicy) mode() string {
+	if p != nil && p.sleeping {
+		return sensors.PollModeSleeping
+	}
+	return sensors.PollModeActive
+}
+
+// observe feeds a full poll and returns the wake reason (or "asleep") when
+// the mode changed, "" otherwise.
+func (p *sleepPolicy) observe(data *sensors.SensorData) string {
+	if p == nil || data == nil {
+		return ""
+	}
+	if p.sleeping {
+		if reason := sensors.WakeReason(p.baseline, data); reason != "" {
+			p.wake()
+			return reason
+		}
+		p.step = min(p.step+1, len(p.intervals)-1)
+		return ""
+	}
+	if !sensors.CarAsleep(data) {
+		p.asleepCount = 0
+		return ""
+	}
+	p.asleepCount++
+	if p.asleepCount < p.after {
+		return ""
+	}
+	p.sleeping = true
+	p.step = 0
+	p.baseline = data
+	return "asleep"
+}
+
+// probe feeds a wake probe (a poll of sensors.WakeSensorIDs only) and
+// reports whether it woke the policy up, with the reason.
+func (p *sleepPolicy) probe(data *sensors.SensorData) (string, bool) {
+	if p == nil || !p.sleeping {
+		return "", false
+	}
+	reason := sensors.WakeReason(p.baseline, data)
+	if reason == "" {
+		return "", false
+	}
+	p.wake()
+	return reason, true
+}
+
+func (p *sleepPolicy) wake() {
+	p.sleeping = false
+	p.asleepCount = 0
+	p.step = 0
+	p.baseline = nil
+}
+
+// interval returns how long to wait before the next full poll.
+func (p *sleepPolicy) interval(normal time.Duration) time.Duration {
+	if p == nil || !p.sleeping {
+		return normal
+	}
+	// Never poll more often while asleep than while active.
+	return max(p.intervals[p.step], normal)
+}
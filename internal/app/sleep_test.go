@@ -0,0 +1,174 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// carSample is a poll result: car switched on or off, moving, plugged in,
+// driver door open.
+func carSample(on, moving, plugged, doorOpen bool) *sensors.SensorData {
+	flag := func(b bool, yes, no float64) *float64 {
+		if b {
+			return &yes
+		}
+		return &no
+	}
+	return &sensors.SensorData{
+		PowerStatus:    flag(on, 1, 0),
+		Speed:          flag(moving, 40, 0),
+		ChargeGunState: flag(plugged, 2, 1),
+		DriverDoor:     flag(doorOpen, 1, 0),
+	}
+}
+
+func TestSleepPolicy(t *testing.T) {
+	const normal = 15 * time.Second
+	off := carSample(false, false, false, false)
+	type step struct {
+		data           *sensors.SensorData
+		probe          bool // a wake probe rather than a full poll
+		wantTransition string
+		wantInterval   time.Duration
+	}
+	tests := []struct {
+		name  string
+		after int
+		steps []step
+	}{
+		{"backs off to the cap", 2, []step{
+			{data: off, wantInterval: normal},
+			{data: off, wantTransition: "asleep", wantInterval: time.Minute},
+			{data: off, wantInterval: 5 * time.Minute},
+			{data: off, wantInterval: 15 * time.Minute},
+			{data: off, wantInterval: 15 * time.Minute},
+		}},
+		{"power on wakes", 1, []step{
+			{data: off, wantTransition: "asleep", wantInterval: time.Minute},
+			{data: carSample(true, false, false, false), wantTransition: "power on", wantInterval: normal},
+		}},
+		{"charge gun wakes", 1, []step{
+			{data: off, wantTransition: "asleep", wantInterval: time.Minute},
+			{data: off, wantInterval: 5 * time.Minute},
+			{data: carSample(false, false, true, false), wantTransition: "charge gun connected", wantInterval: normal},
+		}},
+		{"door opened on a probe", 1, []step{
+			{data: off, wantTransition: "asleep", wantInterval: time.Minute},
+			{data: off, probe: true, wantInterval: time.Minute},
+			{data: carSample(false, false, false, true), probe: true, wantTransition: "driver door", wantInterval: normal},
+		}},
+		{"an awake poll resets the count", 3, []step{
+			{data: off, wantInterval: normal},
+			{data: off, wantInterval: normal},
+			{data: carSample(true, false, false, false), wantInterval: normal},
+			{data: off, wantInterval: normal},
+			{data: off, wantInterval: normal},
+			{data: off, wantTransition: "asleep", wantInterval: time.Minute},
+		}},
+		{"no power reading is not asleep", 1, []step{
+			{data: &sensors.SensorData{}, wantInterval: normal},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newSleepPolicy(tt.after, []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute})
+			for i, st := range tt.steps {
+				var transition string
+				if st.probe {
+					transition, _ = p.probe(st.data)
+				} else {
+					transition = p.observe(st.data)
+				}
+				if transition != st.wantTransition {
+					t.Errorf("step %d: transition %q, want %q", i, transition, st.wantTransition)
+				}
+				if got := p.interval(normal); got != st.wantInterval {
+					t.Errorf("step %d: interval %s, want %s", i, got, st.wantInterval)
+				}
+			}
+		})
+	}
+}
+
+// simulateDay replays a day against p the way the collector schedules it:
+// the first full poll after one interval, the next one interval(normal)
+// later, and a wake probe every probeEvery while asleep; a probe that wakes
+// the policy forces a full poll. It returns the Diplus requests made.
+func simulateDay(p *sleepPolicy, normal, probeEvery time.Duration, car func(time.Duration) *sensors.SensorData) (polls, probes int) {
+	const day = 24 * time.Hour
+	nextPoll, nextProbe := normal, day
+	if probeEvery > 0 {
+		nextProbe = probeEvery
+	}
+	for min(nextPoll, nextProbe) < day {
+		if now := nextPoll; now <= nextProbe {
+			polls++
+			p.observe(car(now))
+			nextPoll = now + p.interval(normal)
+			continue
+		}
+		now := nextProbe
+		nextProbe += probeEvery
+		if p.mode() != sensors.PollModeSleeping {
+			continue
+		}
+		probes++
+		if _, woke := p.probe(car(now)); woke {
+			polls++
+			p.observe(car(now))
+			nextPoll = now + p.interval(normal)
+		}
+	}
+	return polls, probes
+}
+
+// TestSleepPolicyDay parks the car for a day with two half-hour drives and
+// counts the Diplus requests.
+func TestSleepPolicyDay(t *testing.T) {
+	at := func(h, m int) time.Duration { return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute }
+	commute := func(now time.Duration) *sensors.SensorData {
+		driving := (now >= at(8, 0) && now < at(8, 30)) || (now >= at(17, 0) && now < at(17, 30))
+		return carSample(driving, driving, false, false)
+	}
+	// The car charges from 22:00 to midnight.
+	charging := func(now time.Duration) *sensors.SensorData {
+		if now >= at(22, 0) {
+			return carSample(false, false, true, false)
+		}
+		return commute(now)
+	}
+	intervals := []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+	tests := []struct {
+		name       string
+		sleep      bool
+		probeEvery time.Duration
+		car        func(time.Duration) *sensors.SensorData
+		wantPolls  int
+		wantProbes int
+	}{
+		// One poll every 15 s, all day.
+		{"sleep disabled", false, 0, commute, 5759, 0},
+		// Each park: 4 polls to fall asleep, 2 backing off, then every
+		// 15 min; a drive is noticed up to 15 min late.
+		{"sleeping", true, 0, commute, 292, 0},
+		// The wake probe notices the drives at once, at a probe per minute.
+		{"sleeping with wake probes", true, time.Minute, commute, 347, 1379},
+		// Plugging in is noticed at the next 15 min poll and polls at the
+		// normal rate while charging.
+		{"sleeping, charging overnight", true, 0, charging, 737, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p *sleepPolicy
+			if tt.sleep {
+				p = newSleepPolicy(4, intervals)
+			}
+			polls, probes := simulateDay(p, 15*time.Second, tt.probeEvery, tt.car)
+			if polls != tt.wantPolls || probes != tt.wantProbes {
+				t.Errorf("%d full polls and %d wake probes, want %d and %d", polls, probes, tt.wantPolls, tt.wantProbes)
+			}
+		})
+	}
+}
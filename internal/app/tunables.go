@@ -0,0 +1,231 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/Allthebester/byd-hass/internal/transmission"
+	"github.com/sirupsen/logrus"
+)
+
+// Bounds for the ABRP interval setting; the poll interval bounds are
+// configurable (-poll-interval-min/-max).
+const (
+	minABRPIntervalSeconds = 1
+	maxABRPIntervalSeconds = 600
+)
+
+// logLevelOptions are the levels offered by the log level select entity.
+var logLevelOptions = []string{"debug", "info", "warning", "error"}
+
+// LogLevels is the default log level shared by every component logger.
+type LogLevels interface {
+	Level() logrus.Level
+	SetLevel(logrus.Level)
+	SetLevelSpec(spec string, verbose bool) error
+}
+
+// Tunables holds the settings that can be changed while running: the poll
+// interval, the ABRP interval while driving/charging and the log level.
+// Changes are applied immediately and written to the state file so they
+// survive a restart.
+type Tunables struct {
+	path       string
+	abrpTx     *transmission.ABRPTransmitter
+	abrpParked time.Duration
+	pollMin    int // poll interval bounds in whole seconds
+	pollMax    int
+	logLevels  LogLevels
+	logger     *logrus.Logger
+	pollCh     chan time.Duration
+
+	mu    sync.Mutex // guards state and abrpParked
+	state config.RuntimeState
+}
+
+// NewTunables starts from the effective configuration (which already includes
+// any previously persisted state). abrpTx may be nil when ABRP is disabled.
+// The log level control changes the default level of logLevels; components
+// with an override keep theirs.
+func NewTunables(cfg *config.Config, abrpTx *transmission.ABRPTransmitter, logLevels LogLevels, logger *logrus.Logger) *Tunables {
+	return &Tunables{
+		path:       cfg.StateFile,
+		abrpTx:     abrpTx,
+		abrpParked: cfg.ABRPParkedInterval,
+		pollMin:    int((cfg.PollIntervalMin + time.Second - 1) / time.Second),
+		pollMax:    int(cfg.PollIntervalMax / time.Second),
+		logLevels:  logLevels,
+		logger:     logger,
+		pollCh:     make(chan time.Duration, 1),
+		state: config.RuntimeState{
+			PollIntervalSeconds: int(cfg.PollInterval / time.Second),
+			ABRPIntervalSeconds: int(cfg.ABRPInterval / time.Second),
+			LogLevel:            logLevels.Level().String(),
+		},
+	}
+}
+
+// PollChanges delivers the new poll interval whenever it is changed.
+func (t *Tunables) PollChanges() <-chan time.Duration {
+	return t.pollCh
+}
+
+// Controls describes the tunables as Home Assistant number/select entities.
+func (t *Tunables) Controls() []transmission.Control {
+	controls := []transmission.Control{{
+		Key:  "poll_interval_seconds",
+		Name: "Poll Interval",
+		Icon: "mdi:timer-cog-outline",
+		Unit: "s",
+		Min:  float64(t.pollMin),
+		Max:  float64(t.pollMax),
+		Step: 1,
+		Get:  func() string { return strconv.Itoa(t.get().PollIntervalSeconds) },
+		Set:  t.setPollInterval,
+	}}
+	if t.abrpTx != nil {
+		controls = append(controls, transmission.Control{
+			Key:  "abrp_interval_seconds",
+			Name: "ABRP Interval",
+			Icon: "mdi:timer-cog-outline",
+			Unit: "s",
+			Min:  minABRPIntervalSeconds,
+			Max:  maxABRPIntervalSeconds,
+			Step: 1,
+			Get:  func() string { return strconv.Itoa(t.get().ABRPIntervalSeconds) },
+			Set:  t.setABRPInterval,
+		})
+	}
+	controls = append(controls, transmission.Control{
+		Key:     "log_level",
+		Name:    "Log Level",
+		Icon:    "mdi:math-log",
+		Options: logLevelOptions,
+		Get:     func() string { return t.get().LogLevel },
+		Set:     t.setLogLevel,
+	})
+	return controls
+}
+
+func (t *Tunables) get() config.RuntimeState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+func (t *Tunables) setPollInterval(raw string) error {
+	v, err := parseSeconds(raw, math.MinInt, math.MaxInt)
+	if err != nil {
+		return err
+	}
+	// Out-of-range values (e.g. from an automation) are clamped rather than
+	// rejected.
+	if clamped := min(max(v, t.pollMin), t.pollMax); clamped != v {
+		t.logger.WithFields(logrus.Fields{
+			"requested": v,
+			"min":       t.pollMin,
+			"max":       t.pollMax,
+		}).Info("Poll interval clamped to bounds")
+		v = clamped
+	}
+	t.update(func(s *config.RuntimeState) { s.PollIntervalSeconds = v })
+
+	// Keep only the newest value if the collector has not picked up the
+	// previous one yet.
+	select {
+	case <-t.pollCh:
+	default:
+	}
+	t.pollCh <- time.Duration(v) * time.Second
+	t.logger.WithField("poll_interval", time.Duration(v)*time.Second).Info("Poll interval changed")
+	return nil
+}
+
+func (t *Tunables) setABRPInterval(raw string) error {
+	v, err := parseSeconds(raw, minABRPIntervalSeconds, maxABRPIntervalSeconds)
+	if err != nil {
+		return err
+	}
+	t.update(func(s *config.RuntimeState) { s.ABRPIntervalSeconds = v })
+	t.mu.Lock()
+	parked := t.abrpParked
+	t.mu.Unlock()
+	t.abrpTx.SetRatePolicy(time.Duration(v)*time.Second, parked)
+	t.logger.WithField("abrp_interval", time.Duration(v)*time.Second).Info("ABRP interval changed")
+	return nil
+}
+
+func (t *Tunables) setLogLevel(raw string) error {
+	lvl, err := logrus.ParseLevel(strings.TrimSpace(raw))
+	if err != nil || lvl > logrus.DebugLevel || lvl < logrus.ErrorLevel {
+		return fmt.Errorf("invalid log level %q (use %s)", raw, strings.Join(logLevelOptions, ", "))
+	}
+	t.update(func(s *config.RuntimeState) { s.LogLevel = lvl.String() })
+	t.logLevels.SetLevel(lvl)
+	t.logger.WithField("level", lvl.String()).Info("Log level changed")
+	return nil
+}
+
+// Reload takes over the tunables of a reloaded configuration that differ
+// from running, together with the parked ABRP interval. Nothing is
+// persisted: next already includes the persisted state.
+func (t *Tunables) Reload(running, next *config.Config) {
+	t.mu.Lock()
+	t.abrpParked = next.ABRPParkedInterval
+	t.state.PollIntervalSeconds = int(next.PollInterval / time.Second)
+	t.state.ABRPIntervalSeconds = int(next.ABRPInterval / time.Second)
+	t.mu.Unlock()
+
+	if next.PollInterval != running.PollInterval {
+		select {
+		case <-t.pollCh:
+		default:
+		}
+		t.pollCh <- next.PollInterval
+	}
+	if t.abrpTx != nil && (next.ABRPInterval != running.ABRPInterval || next.ABRPParkedInterval != running.ABRPParkedInterval) {
+		t.abrpTx.SetRatePolicy(next.ABRPInterval, next.ABRPParkedInterval)
+	}
+	if next.LogLevel != running.LogLevel || next.Verbose != running.Verbose {
+		if err := t.logLevels.SetLevelSpec(next.LogLevel, next.Verbose); err != nil {
+			t.logger.WithError(err).Warn("Log level not reloaded")
+		}
+		t.mu.Lock()
+		t.state.LogLevel = t.logLevels.Level().String()
+		t.mu.Unlock()
+	}
+}
+
+// update applies fn to the state and persists the result. A failed write is
+// logged; the new value still applies until the next restart.
+func (t *Tunables) update(fn func(*config.RuntimeState)) {
+	t.mu.Lock()
+	fn(&t.state)
+	state := t.state
+	t.mu.Unlock()
+
+	if t.path == "" {
+		return
+	}
+	if err := config.SaveRuntimeState(t.path, state); err != nil {
+		t.logger.WithError(err).Warn("Failed to persist runtime settings")
+	}
+}
+
+// parseSeconds parses a whole number of seconds within [min, max]. Home
+// Assistant sends number entity values as floats ("30.0").
+func parseSeconds(raw string, min, max int) (int, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || f != float64(int(f)) {
+		return 0, fmt.Errorf("invalid value %q: expected whole seconds", raw)
+	}
+	if v := int(f); v < min || v > max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, min, max)
+	}
+	return int(f), nil
+}
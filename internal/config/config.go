@@ -1,110 +1,641 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/Allthebester/byd-hass/internal/location"
 )
 
 // Config holds all configuration options for the BYD-HASS application
 type Config struct {
 	// MQTT Configuration
-	MQTTUrl         string `json:"mqtt_url"`         // MQTT URL (supports both WebSocket and standard MQTT)
-	DiscoveryPrefix string `json:"discovery_prefix"` // Home Assistant discovery prefix
+	MQTTUrl         string `json:"mqtt_url" yaml:"mqtt_url"`                 // MQTT URL (supports both WebSocket and standard MQTT)
+	DiscoveryPrefix string `json:"discovery_prefix" yaml:"discovery_prefix"` // Home Assistant discovery prefix
+	MQTTTokenFile   string `json:"mqtt_token_file" yaml:"mqtt_token_file"`   // Read the MQTT password (token) from this file on every connect
+	MQTTTokenURL    string `json:"mqtt_token_url" yaml:"mqtt_token_url"`     // Fetch the MQTT password (token) via HTTP GET on every connect
+	MQTTLayout      string `json:"mqtt_layout" yaml:"mqtt_layout"`           // Topic layout: "native" or "teslamate"
+	MQTTQoS         string `json:"mqtt_qos" yaml:"mqtt_qos"`                 // QoS of the sensor states, e.g. "default:0,52:1" (see sensors.ParseQoS)
+	MQTTCA          string `json:"mqtt_ca" yaml:"mqtt_ca"`                   // PEM CA bundle the broker certificate is verified against (mqtts/wss)
+	MQTTCert        string `json:"mqtt_cert" yaml:"mqtt_cert"`               // PEM client certificate for mutual TLS
+	MQTTKey         string `json:"mqtt_key" yaml:"mqtt_key"`                 // PEM private key of MQTTCert
+	MQTTInsecure    bool   `json:"mqtt_insecure" yaml:"mqtt_insecure"`       // Skip verification of the broker certificate
+	MQTTLocation    bool   `json:"mqtt_location" yaml:"mqtt_location"`       // Publish raw GPS coordinates (device_tracker, TeslaMate location)
+	MQTTCleanup     bool   `json:"mqtt_cleanup" yaml:"mqtt_cleanup"`         // Withdraw the discovery configs on shutdown, deleting the entities
+	TeslamateCarID  int    `json:"teslamate_car_id" yaml:"teslamate_car_id"` // <id> in teslamate/cars/<id>/... topics
+
+	// PublishMode is "onchange" (topics are only published when their
+	// payload changed) or "always" (every MQTT cycle; binary sensors stay
+	// change-only). PublishDeadband is how far a float has to move to count
+	// as changed (0 = exact) and PublishRefresh republishes unchanged topics
+	// this often (0 = never). PublishDeadbands overrides the deadband by
+	// sensor ID, also for integer sensors.
+	PublishMode      string          `json:"publish_mode" yaml:"publish_mode"`
+	PublishDeadband  float64         `json:"publish_deadband" yaml:"publish_deadband"`
+	PublishDeadbands map[int]float64 `json:"publish_deadbands" yaml:"publish_deadbands,omitempty"`
+	PublishRefresh   time.Duration   `json:"publish_refresh" yaml:"publish_refresh"`
+
+	// Units is the unit system of the MQTT and Home Assistant REST values:
+	// "metric", "imperial" or "auto" (follow the car's temperature unit).
+	// ABRP and the data outputs always get metric.
+	Units string `json:"units" yaml:"units"`
 
 	// ABRP Configuration
-	ABRPAPIKey string `json:"abrp_api_key"` // ABRP API key
-	ABRPToken  string `json:"abrp_token"`   // ABRP user token
+	ABRPAPIKey string `json:"abrp_api_key" yaml:"abrp_api_key"` // ABRP API key
+	ABRPToken  string `json:"abrp_token" yaml:"abrp_token"`     // ABRP user token(s), comma-separated to fan out to several accounts
+
+	// Files credentials are read from once at startup, e.g. Docker secrets.
+	// A file overrides the credential set directly.
+	MQTTPasswordFile string `json:"mqtt_password_file" yaml:"mqtt_password_file"` // Password of MQTTUrl
+	ABRPAPIKeyFile   string `json:"abrp_api_key_file" yaml:"abrp_api_key_file"`
+	ABRPTokenFile    string `json:"abrp_token_file" yaml:"abrp_token_file"`
+	HATokenFile      string `json:"ha_token_file" yaml:"ha_token_file"`
+	EVCCTokenFile    string `json:"evcc_token_file" yaml:"evcc_token_file"`
+	InfluxTokenFile  string `json:"influx_token_file" yaml:"influx_token_file"`
+	WebhookTokenFile string `json:"webhook_token_file" yaml:"webhook_token_file"`
 
 	// Device Configuration
-	DeviceID string `json:"device_id"` // Unique device identifier
+	DeviceID  string `json:"device_id" yaml:"device_id"`   // Unique device identifier
+	VehicleID string `json:"vehicle_id" yaml:"vehicle_id"` // Optional per-car namespace so several cars can share one broker
+
+	VehicleModel string `json:"vehicle_model" yaml:"vehicle_model"` // Model shown on the Home Assistant device ("" = "Car")
 
 	// Application Configuration
-	Verbose bool `json:"verbose"` // Enable verbose logging
+	Verbose   bool   `json:"verbose" yaml:"verbose"`       // Enable verbose logging
+	LogLevel  string `json:"log_level" yaml:"log_level"`   // debug, info, warn or error, plus optional per-component overrides ("info,mqtt=debug"); overrides Verbose when set
+	LogFormat string `json:"log_format" yaml:"log_format"` // "text" (default) or "json"
+	// LogRedactLocation hides coordinates in logs.
+	LogRedactLocation bool `json:"log_redact_location" yaml:"log_redact_location"`
+
+	// StateFile persists settings changed from Home Assistant (poll and ABRP
+	// interval, log level); its values override flags on startup. "" disables.
+	StateFile string `json:"state_file" yaml:"state_file"`
+
+	// SnapshotFile keeps the last poll and the derived sensors' tracker
+	// state across restarts (see package state); it is written every
+	// SnapshotInterval and on shutdown. "" or a zero interval disables it.
+	SnapshotFile     string        `json:"snapshot_file" yaml:"snapshot_file"`
+	SnapshotInterval time.Duration `json:"snapshot_interval" yaml:"snapshot_interval"`
+
+	// CapabilityFile keeps the sensors the car answered when every sensor
+	// was polled once; the default sensor list is trimmed to them. The probe
+	// runs when the file is missing, weekly, and on Redetect. "" disables.
+	CapabilityFile string `json:"capability_file" yaml:"capability_file"`
+	// Redetect probes the car's sensors again at startup.
+	Redetect bool `json:"redetect" yaml:"redetect"`
+	// SensorForce lists sensor IDs kept in the default list even if the
+	// probe got no value for them, e.g. "65,34".
+	SensorForce string `json:"sensor_force" yaml:"sensor_force"`
 
 	// ABRP Application Requirement
 	// When true, telemetry will only be transmitted to ABRP when the Android
 	// application "com.iternio.abrpapp" is detected to be running via ADB.
 	// This can be toggled at runtime through the "-require-abrp-app" CLI flag
 	// or the "BYD_HASS_REQUIRE_ABRP_APP" environment variable.
-	RequireABRPApp bool `json:"require_abrp_app"`
+	RequireABRPApp bool `json:"require_abrp_app" yaml:"require_abrp_app"`
 
 	// WiFi Re-enable
 	// When true, the application will periodically check if WiFi is disabled
 	// and automatically re-enable it. This can be toggled through the
 	// "-enable-wifi-reenable" CLI flag or the "BYD_HASS_ENABLE_WIFI_REENABLE"
 	// environment variable (default: false).
-	EnableWiFiReenable bool `json:"enable_wifi_reenable"`
+	EnableWiFiReenable bool `json:"enable_wifi_reenable" yaml:"enable_wifi_reenable"`
+
+	// Per-output switches (BYD_HASS_ENABLE_<OUTPUT>). An output runs only when
+	// it is both configured and enabled, so one can be turned off temporarily
+	// without removing its settings.
+	EnableMQTT       bool `json:"enable_mqtt" yaml:"enable_mqtt"`
+	EnableABRP       bool `json:"enable_abrp" yaml:"enable_abrp"`
+	EnableWebSocket  bool `json:"enable_websocket" yaml:"enable_websocket"`
+	EnableHAREST     bool `json:"enable_ha_rest" yaml:"enable_ha_rest"`
+	EnableTraccar    bool `json:"enable_traccar" yaml:"enable_traccar"`
+	EnableEVCC       bool `json:"enable_evcc" yaml:"enable_evcc"`
+	EnablePrometheus bool `json:"enable_prometheus" yaml:"enable_prometheus"`
+	EnableInflux     bool `json:"enable_influx" yaml:"enable_influx"`
+	EnableWebhook    bool `json:"enable_webhook" yaml:"enable_webhook"`
+	EnablePostgres   bool `json:"enable_postgres" yaml:"enable_postgres"`
+	EnableCSV        bool `json:"enable_csv" yaml:"enable_csv"`
+	EnableHistory    bool `json:"enable_history" yaml:"enable_history"`
+
+	// NoTransmit logs what MQTT and the HTTP outputs would send instead of
+	// sending it; the outputs are set up as usual otherwise.
+	NoTransmit bool `json:"no_transmit" yaml:"no_transmit"`
 
 	// API Configuration
-	DiplusURL       string `json:"diplus_url"`       // Di-Plus API URL
-	ExtendedPolling bool   `json:"extended_polling"` // Use extended sensor polling for more data
-	APITimeout      int    `json:"api_timeout"`      // API request timeout in seconds (default: 10)
+	DiplusURL       string        `json:"diplus_url" yaml:"diplus_url"`               // Di-Plus host:port, or http(s)://host:port[/prefix] (e.g. a proxy)
+	DiplusTemplate  string        `json:"diplus_template" yaml:"diplus_template"`     // Request path and query appended to DiplusURL; {text} is the URL-encoded sensor template
+	DiplusSource    string        `json:"diplus_source" yaml:"diplus_source"`         // Optional "file:///path/capture.jsonl" (or a directory of captures) to replay recorded responses, or "sim:scenario.yaml" to simulate the car, instead
+	DiplusRecord    string        `json:"diplus_record" yaml:"diplus_record"`         // Directory every raw poll response is recorded to for later replay ("" = disabled)
+	ReplaySpeed     float64       `json:"replay_speed" yaml:"replay_speed"`           // Playback speed of recorded captures and scenarios (1 = real time, 0 = one response per poll)
+	DiplusBatchSize int           `json:"diplus_batch_size" yaml:"diplus_batch_size"` // Max sensors per Diplus request; larger sets are split (0 = no limit)
+	DiplusParallel  int           `json:"diplus_parallel" yaml:"diplus_parallel"`     // Batches requested at once (1 or 2)
+	ExtendedPolling bool          `json:"extended_polling" yaml:"extended_polling"`   // Use extended sensor polling for more data
+	DiplusTimeout   time.Duration `json:"diplus_timeout" yaml:"diplus_timeout"`       // Timeout of a single Diplus request (default: 10s)
+	DiplusRetries   int           `json:"diplus_retries" yaml:"diplus_retries"`       // Retries per Diplus request within a poll (connection errors and 5xx)
+
+	// After DiplusBreakerThreshold consecutive failed polls Diplus is only
+	// probed every DiplusProbeInterval until it answers again (0 = never).
+	DiplusBreakerThreshold int           `json:"diplus_breaker_threshold" yaml:"diplus_breaker_threshold"`
+	DiplusProbeInterval    time.Duration `json:"diplus_probe_interval" yaml:"diplus_probe_interval"`
+
+	// DiplusPollTimeout bounds a whole poll cycle, batches and retries
+	// included, so a hung request never stalls the collector (0 = no limit
+	// beyond the per-request timeout).
+	DiplusPollTimeout time.Duration `json:"diplus_poll_timeout" yaml:"diplus_poll_timeout"`
 
 	// ABRP Configuration
-	ABRPEnhanced    bool   `json:"abrp_enhanced"`     // Use enhanced ABRP telemetry data
-	ABRPLocation    bool   `json:"abrp_location"`     // Include GPS location in ABRP data (if available)
-	ABRPVehicleType string `json:"abrp_vehicle_type"` // ABRP vehicle type for better range estimation
+	ABRPEnhanced    bool   `json:"abrp_enhanced" yaml:"abrp_enhanced"`         // Use enhanced ABRP telemetry data
+	ABRPLocation    bool   `json:"abrp_location" yaml:"abrp_location"`         // Include GPS location in ABRP data (if available)
+	ABRPElevation   bool   `json:"abrp_elevation" yaml:"abrp_elevation"`       // Include GPS altitude as ABRP "elevation"
+	ABRPHeading     bool   `json:"abrp_heading" yaml:"abrp_heading"`           // Include GPS bearing as ABRP "heading"
+	ABRPVehicleType string `json:"abrp_vehicle_type" yaml:"abrp_vehicle_type"` // ABRP vehicle type for better range estimation
+	ABRPMode        string `json:"abrp_mode" yaml:"abrp_mode"`                 // ABRP transport: "http" (default) or "ws"
+
+	// ABRP offline buffer: failed samples are kept for this long (in samples at
+	// ABRPInterval) and replayed once ABRP is reachable again. 0 disables it.
+	ABRPBufferDuration time.Duration `json:"abrp_buffer_duration" yaml:"abrp_buffer_duration"`
+	ABRPBufferSize     int           `json:"abrp_buffer_size" yaml:"abrp_buffer_size"` // Explicit sample limit; overrides ABRPBufferDuration when > 0
+	ABRPBufferFile     string        `json:"abrp_buffer_file" yaml:"abrp_buffer_file"` // Optional file so buffered samples survive a restart
+
+	// ABRPCurrentMaxAge drops the derived pack current from samples older than
+	// this (0 = always send).
+	ABRPCurrentMaxAge time.Duration `json:"abrp_current_max_age" yaml:"abrp_current_max_age"`
+
+	// ABRPPackVoltageSensor is the ID of a sensor reporting the high-voltage
+	// pack voltage. ABRP only gets voltage and current with one (0 = none).
+	ABRPPackVoltageSensor int `json:"abrp_pack_voltage_sensor" yaml:"abrp_pack_voltage_sensor"`
+
+	// ABRPTimeout bounds a single ABRP HTTP request: connecting, the TLS
+	// handshake, waiting for the response headers and the request as a whole.
+	ABRPTimeout time.Duration `json:"abrp_timeout" yaml:"abrp_timeout"`
+
+	// ValidateRanges drops sensor readings outside their plausible range
+	// (SensorDefinition.Min/Max) instead of publishing them.
+	ValidateRanges bool `json:"validate_ranges" yaml:"validate_ranges"`
+
+	// HoldMissing keeps the last value of a sensor missing from a partial
+	// Diplus response for up to this long (0 = disabled).
+	HoldMissing time.Duration `json:"hold_missing" yaml:"hold_missing"`
+
+	// Trip computer (see sensors.DriveSessionTracker): a drive starts above
+	// TripStartSpeed km/h out of P and ends after TripEndAfter parked.
+	TripStartSpeed float64       `json:"trip_start_speed" yaml:"trip_start_speed"`
+	TripEndAfter   time.Duration `json:"trip_end_after" yaml:"trip_end_after"`
+
+	// Sleep-aware polling: once SleepAfterPolls consecutive polls found the
+	// car off, full polls back off through SleepIntervals (the last entry is
+	// the cap) until a wake indicator shows up. WakeProbeInterval polls just
+	// the wake indicators in between (0 = only the backed-off polls). Empty
+	// SleepIntervals disables sleeping.
+	SleepAfterPolls   int             `json:"sleep_after_polls" yaml:"sleep_after_polls"`
+	SleepIntervals    []time.Duration `json:"sleep_intervals" yaml:"sleep_intervals"`
+	WakeProbeInterval time.Duration   `json:"wake_probe_interval" yaml:"wake_probe_interval"`
+
+	// KeepaliveCap limits how long the collector may keep polling with the
+	// car off between drives: past it, polls drop to the slowest interval
+	// (the last SleepIntervals entry, or PollIntervalMax) and a warning
+	// event is published over MQTT. 0 disables the cap.
+	KeepaliveCap time.Duration `json:"keepalive_cap" yaml:"keepalive_cap"`
+
+	// DoorOpenAlert is how long a door may stay open with the car locked
+	// before a door_left_open car event is published; 0 disables it.
+	DoorOpenAlert time.Duration `json:"door_open_alert" yaml:"door_open_alert"`
+
+	// FastPollInterval polls only the priority sensors (see
+	// sensors.MonitoredSensor.Priority) this often and transmits changes
+	// straight away; 0 disables the fast path.
+	FastPollInterval time.Duration `json:"fast_poll_interval" yaml:"fast_poll_interval"`
+
+	// Charging detection hysteresis (see sensors.ChargingStateTracker)
+	ChargingConfirmSamples int           `json:"charging_confirm_samples" yaml:"charging_confirm_samples"` // Consecutive samples before is_charging toggles
+	ChargingHysteresis     time.Duration `json:"charging_hysteresis" yaml:"charging_hysteresis"`           // Alternatively toggle once the new state persisted this long (0 = disabled)
+	DCFCThresholdKW        float64       `json:"dcfc_threshold_kw" yaml:"dcfc_threshold_kw"`               // Sustained charge power above which a session counts as DC fast charging
+
+	// EfficiencyWindowKM is the distance the rolling Wh/km efficiency is
+	// averaged over (see sensors.EfficiencyTracker). 0 disables it.
+	EfficiencyWindowKM float64 `json:"efficiency_window_km" yaml:"efficiency_window_km"`
+
+	// Range estimate: consumption is averaged over the last RangeWindowKM
+	// (0 disables the estimate) and applied to UsableCapacityKWh, or to the
+	// reported BatteryCapacity when that is 0.
+	RangeWindowKM     float64 `json:"range_window_km" yaml:"range_window_km"`
+	UsableCapacityKWh float64 `json:"usable_capacity_kwh" yaml:"usable_capacity_kwh"`
+
+	// WindowOpenThreshold is the opening in percent above which a window
+	// counts as open for the Windows Open aggregate.
+	WindowOpenThreshold float64 `json:"window_open_threshold" yaml:"window_open_threshold"`
+
+	// Tire Pressure Warning: a tire trips it below TirePressureMin bar or,
+	// once warmed up by a drive, more than TirePressureDeviationPct percent
+	// off the mean of all four. 0 disables either rule.
+	TirePressureMin          float64 `json:"tire_pressure_min" yaml:"tire_pressure_min"`
+	TirePressureDeviationPct float64 `json:"tire_pressure_deviation_pct" yaml:"tire_pressure_deviation_pct"`
+
+	// Comfort overrides the Cabin Comfort formula, e.g.
+	// "target=21,span=8,outside=0.2,fan=3" (see sensors.ParseComfortFormula).
+	Comfort string `json:"comfort" yaml:"comfort"`
+
+	// Battery12VLowVolt is the 12V battery voltage below which the 12V
+	// Battery Low sensor trips while the car is off. 0 disables the 12V
+	// battery sensors.
+	Battery12VLowVolt float64 `json:"battery_12v_low_volt" yaml:"battery_12v_low_volt"`
+
+	// DeviceTimezone is the IANA time zone (e.g. "Europe/Berlin") of
+	// head-units whose epoch timestamps (LastSentryTriggerTime, …) count
+	// from the local wall clock rather than UTC. "" = real Unix time.
+	DeviceTimezone string `json:"device_timezone" yaml:"device_timezone"`
+
+	// ConfigPath is the config file given with -config: YAML (.yaml or
+	// .yml, see LoadYAMLFile) or a shell-style env file such as the
+	// installer's config.env (see ReadEnvFile). YAML values override the
+	// defaults; environment variables and flags override them. The
+	// assignments of an env file count as environment variables that take
+	// precedence over the process environment, which the keep-alive script
+	// loaded from the same file. Every reload reads the file again.
+	ConfigPath string `json:"config_path" yaml:"-"`
+
+	// The sensor list and its per-sensor settings: BYD_HASS_SENSOR_IDS,
+	// BYD_HASS_TRANSFORM, BYD_HASS_VALUE_MAP and BYD_HASS_PRECISION (see
+	// package sensors, which reads the environment at init). A reload
+	// applies the first two itself (see app.reloadSensors), so Changed
+	// skips them.
+	SensorIDs string `json:"-" yaml:"sensor_ids"`
+	Transform string `json:"-" yaml:"transform"`
+	ValueMap  string `json:"-" yaml:"value_map"`
+	Precision string `json:"-" yaml:"precision"`
+
+	// Geofence: named zones ("home:52.37,4.89,100;work:…", radius in metres)
+	// inline, from ZonesFile, one per line, and from Geofences, which the
+	// YAML config file lists as mappings. A zone is only left
+	// ZoneHysteresisM beyond its radius; fixes less accurate than
+	// ZoneMaxAccuracyM metres are skipped.
+	Zones            string          `json:"zones" yaml:"zones"`
+	ZonesFile        string          `json:"zones_file" yaml:"zones_file"`
+	Geofences        []location.Zone `json:"geofences" yaml:"geofences,omitempty"`
+	ZoneHysteresisM  float64         `json:"zone_hysteresis_m" yaml:"zone_hysteresis_m"`
+	ZoneMaxAccuracyM float64         `json:"zone_max_accuracy_m" yaml:"zone_max_accuracy_m"`
+
+	// Debouncing of flappy on/off sensors (doors, seat belts, see
+	// sensors.DefaultDebouncedSensors): a new value is only published once it
+	// has held for DebouncePolls polls or DebounceHold, whichever comes first.
+	DebouncePolls   int           `json:"debounce_polls" yaml:"debounce_polls"`
+	DebounceHold    time.Duration `json:"debounce_hold" yaml:"debounce_hold"`
+	DebounceSensors string        `json:"debounce_sensors" yaml:"debounce_sensors"` // Per-sensor overrides/additions, e.g. "81:3,21:10s,5"
+
+	// WebSocket live stream
+	WebSocketListen string `json:"websocket_listen" yaml:"websocket_listen"` // Listen address for the dashboard stream ("" = disabled)
+
+	// Home Assistant REST API (alternative to MQTT discovery)
+	HAURL       string        `json:"ha_url" yaml:"ha_url"`               // Home Assistant base URL, e.g. http://homeassistant.local:8123 ("" = disabled)
+	HAToken     string        `json:"ha_token" yaml:"ha_token"`           // Long-lived access token
+	HARateLimit float64       `json:"ha_rate_limit" yaml:"ha_rate_limit"` // Maximum state updates per second
+	HAInterval  time.Duration `json:"ha_interval" yaml:"ha_interval"`     // Interval between update cycles
+
+	// Traccar (OsmAnd protocol)
+	TraccarURL         string  `json:"traccar_url" yaml:"traccar_url"`                   // OsmAnd endpoint, e.g. http://traccar:5055 ("" = disabled)
+	TraccarID          string  `json:"traccar_id" yaml:"traccar_id"`                     // Traccar device identifier ("" = namespaced device ID)
+	TraccarMinDistance float64 `json:"traccar_min_distance" yaml:"traccar_min_distance"` // Metres the car must move before a new fix is sent
+
+	// evcc HTTP API
+	EVCCListen     string        `json:"evcc_listen" yaml:"evcc_listen"`           // Listen address for /api/soc and /api/status ("" = disabled)
+	EVCCStaleAfter time.Duration `json:"evcc_stale_after" yaml:"evcc_stale_after"` // Answer 503 when the latest poll is older than this
+	EVCCToken      string        `json:"evcc_token" yaml:"evcc_token"`             // Optional bearer token
+	EVCCBasicAuth  string        `json:"evcc_basic_auth" yaml:"evcc_basic_auth"`   // Optional "user:password"
+
+	// Prometheus exporter
+	PrometheusListen string `json:"prometheus_listen" yaml:"prometheus_listen"` // Listen address for /metrics ("" = disabled)
+	// Diagnostics mounts /config, /diagnostics and /diagnostics/logs on the
+	// exporter's server. They answer only requests bearing APIToken, as does
+	// /api/history.
+	Diagnostics bool   `json:"diagnostics" yaml:"diagnostics"`
+	APIToken    string `json:"api_token" yaml:"api_token"` // Bearer token of the diagnostics endpoints and /api/history
+
+	// InfluxDB v2
+	InfluxURL           string        `json:"influx_url" yaml:"influx_url"`                       // InfluxDB base URL ("" = disabled)
+	InfluxOrg           string        `json:"influx_org" yaml:"influx_org"`                       // Organisation for /api/v2/write
+	InfluxBucket        string        `json:"influx_bucket" yaml:"influx_bucket"`                 // Target bucket
+	InfluxToken         string        `json:"influx_token" yaml:"influx_token"`                   // API token
+	InfluxBatchSize     int           `json:"influx_batch_size" yaml:"influx_batch_size"`         // Flush once this many points are queued
+	InfluxFlushInterval time.Duration `json:"influx_flush_interval" yaml:"influx_flush_interval"` // Flush at least this often
+	InfluxTagSensors    string        `json:"influx_tag_sensors" yaml:"influx_tag_sensors"`       // Comma-separated string sensors written as tags instead of fields
+
+	// PostgreSQL logger
+	PostgresURL     string `json:"postgres_url" yaml:"postgres_url"`           // Connection URL ("" = disabled)
+	PostgresTable   string `json:"postgres_table" yaml:"postgres_table"`       // Target table, created when missing
+	PostgresMaxRows int    `json:"postgres_max_rows" yaml:"postgres_max_rows"` // Rows kept in memory while the database is unreachable
+
+	// Generic webhook
+	WebhookURL      string        `json:"webhook_url" yaml:"webhook_url"`           // POST published values here ("" = disabled)
+	WebhookToken    string        `json:"webhook_token" yaml:"webhook_token"`       // Optional bearer token
+	WebhookMode     string        `json:"webhook_mode" yaml:"webhook_mode"`         // "change" (default), "every" or "rules"
+	WebhookRules    string        `json:"webhook_rules" yaml:"webhook_rules"`       // Conditions that trigger a POST when they turn true; switches to "rules" mode
+	WebhookTemplate string        `json:"webhook_template" yaml:"webhook_template"` // Optional text/template for the request body
+	WebhookTimeout  time.Duration `json:"webhook_timeout" yaml:"webhook_timeout"`   // Per-request timeout
+	WebhookInterval time.Duration `json:"webhook_interval" yaml:"webhook_interval"` // Interval between webhook deliveries
+
+	// Webhooks are further webhooks, which only the YAML config file can
+	// list; see WebhookOutputs.
+	Webhooks []Webhook `json:"webhooks" yaml:"webhooks,omitempty"`
+
+	// CSV log
+	CSVDir       string `json:"csv_dir" yaml:"csv_dir"`                 // Directory for CSV logs ("" = disabled)
+	CSVRotate    string `json:"csv_rotate" yaml:"csv_rotate"`           // "daily" (default) or "size"
+	CSVMaxSizeMB int    `json:"csv_max_size_mb" yaml:"csv_max_size_mb"` // Size limit per file for "size" rotation
+
+	// Local history of published snapshots, served on /api/history
+	HistoryDir       string        `json:"history_dir" yaml:"history_dir"`                 // Directory of the history segments ("" = disabled)
+	HistoryMaxAge    time.Duration `json:"history_max_age" yaml:"history_max_age"`         // Segments ending longer ago are pruned
+	HistoryMaxSizeMB int           `json:"history_max_size_mb" yaml:"history_max_size_mb"` // Total size limit; the oldest segments are pruned first
+
+	// Store-and-forward spool for ABRP, webhook and InfluxDB payloads that
+	// could not be delivered
+	SpoolDir         string `json:"spool_dir" yaml:"spool_dir"`                   // Directory of the spool ("" = disabled)
+	SpoolMaxSizeMB   int    `json:"spool_max_size_mb" yaml:"spool_max_size_mb"`   // Disk budget of all destinations; the oldest payloads are dropped first
+	SpoolMaxAttempts int    `json:"spool_max_attempts" yaml:"spool_max_attempts"` // Rejections after which a payload is dropped
 
 	// Timing intervals (overridable via CLI flags / env vars)
-	MQTTInterval        time.Duration `json:"mqtt_interval"`         // Interval between MQTT transmissions
-	ABRPInterval        time.Duration `json:"abrp_interval"`         // Interval between ABRP transmissions
-	ForceUpdateInterval time.Duration `json:"force_update_interval"` // Force update all sensors at this interval (0 = disabled)
+	PollInterval        time.Duration `json:"poll_interval" yaml:"poll_interval"`                 // Diplus poll cadence; also the floor for every transmit interval
+	PollIntervalMin     time.Duration `json:"poll_interval_min" yaml:"poll_interval_min"`         // Lower bound of the poll interval, including values set from Home Assistant
+	PollIntervalMax     time.Duration `json:"poll_interval_max" yaml:"poll_interval_max"`         // Upper bound of the poll interval
+	MQTTInterval        time.Duration `json:"mqtt_interval" yaml:"mqtt_interval"`                 // Interval between MQTT transmissions
+	ABRPInterval        time.Duration `json:"abrp_interval" yaml:"abrp_interval"`                 // Interval between ABRP transmissions while driving / charging
+	ABRPParkedInterval  time.Duration `json:"abrp_parked_interval" yaml:"abrp_parked_interval"`   // Interval between ABRP transmissions while parked
+	ForceUpdateInterval time.Duration `json:"force_update_interval" yaml:"force_update_interval"` // Force update all sensors at this interval (0 = disabled)
+
+	// Per-transmission deadlines; a transmission still running when its
+	// deadline passes is cancelled.
+	TransmitTimeout     time.Duration `json:"transmit_timeout" yaml:"transmit_timeout"`           // Default for every output
+	ABRPTransmitTimeout time.Duration `json:"abrp_transmit_timeout" yaml:"abrp_transmit_timeout"` // ABRP, which may also replay buffered samples
+	ConnectTimeout      time.Duration `json:"connect_timeout" yaml:"connect_timeout"`             // One startup connection attempt of MQTT or PostgreSQL
+	TransmitBudget      time.Duration `json:"transmit_budget" yaml:"transmit_budget"`             // Longest the scheduler waits for one cycle's transmissions (0 = until each finished or timed out)
+}
+
+// Webhook is one entry of Config.Webhooks. The fields mean the same as the
+// Webhook* settings; an empty mode, timeout or interval is taken from them.
+type Webhook struct {
+	Name     string        `json:"name" yaml:"name"` // Names the output in logs and metrics, and its spool queue
+	URL      string        `json:"url" yaml:"url"`
+	Token    string        `json:"token" yaml:"token"`
+	Mode     string        `json:"mode" yaml:"mode"`
+	Rules    string        `json:"rules" yaml:"rules"`
+	Template string        `json:"template" yaml:"template"`
+	Timeout  time.Duration `json:"timeout" yaml:"timeout"`
+	Interval time.Duration `json:"interval" yaml:"interval"`
 }
 
 // GetDefaultConfig returns a configuration with sensible defaults
 func GetDefaultConfig() *Config {
 	return &Config{
 		DiscoveryPrefix: "homeassistant",
+		MQTTLayout:      "native",
+		TeslamateCarID:  1,
+		PublishMode:     "onchange",
+		Units:           "metric",
 		DeviceID:        "", // Will be auto-generated
 		Verbose:         false,
+		LogFormat:       "text",
+		StateFile:       "/storage/emulated/0/bydhass/state.json",
+
+		SnapshotFile:     "/storage/emulated/0/bydhass/snapshot.json",
+		SnapshotInterval: time.Minute,
+		CapabilityFile:   "/storage/emulated/0/bydhass/capabilities.json",
+
 		DiplusURL:       "localhost:8988",
+		DiplusTemplate:  "/api/getDiPars?text={text}",
+		DiplusBatchSize: 40,
+		DiplusParallel:  1,
+		ReplaySpeed:     1,
+		DiplusRetries:   2,
 
-		ExtendedPolling: true,    // Enable extended polling by default
-		APITimeout:      10,      // 10 second API timeout
+		DiplusPollTimeout: 30 * time.Second,
+
+		DiplusBreakerThreshold: 5,
+		DiplusProbeInterval:    30 * time.Second,
+
+		ExtendedPolling: true, // Enable extended polling by default
+		DiplusTimeout:   10 * time.Second,
 		ABRPEnhanced:    true,    // Use enhanced ABRP data by default
 		ABRPLocation:    true,    // Location ENABLED by default
+		MQTTLocation:    true,    // Raw coordinates on MQTT unless disabled
 		ABRPVehicleType: "byd:*", // Generic BYD vehicle type
+		ABRPMode:        "http",
+		ABRPElevation:   true,
+		ABRPHeading:     true,
+
+		ABRPBufferDuration: 30 * time.Minute,
+		ABRPCurrentMaxAge:  30 * time.Second,
+		ABRPTimeout:        10 * time.Second,
+
+		HARateLimit:        5,
+		HAInterval:         MQTTTransmitInterval,
+		PrometheusListen:   "127.0.0.1:9725",
+		TraccarMinDistance: 25,
+		EVCCStaleAfter:     2 * time.Minute,
+
+		InfluxBatchSize:     500,
+		InfluxFlushInterval: 10 * time.Second,
+
+		PostgresTable:   "byd_positions",
+		PostgresMaxRows: 1000,
+
+		WebhookMode:     "change",
+		WebhookTimeout:  10 * time.Second,
+		WebhookInterval: MQTTTransmitInterval,
+
+		CSVRotate:    "daily",
+		CSVMaxSizeMB: 10,
+
+		HistoryMaxAge:    24 * time.Hour,
+		HistoryMaxSizeMB: 50,
+
+		SpoolMaxSizeMB:   20,
+		SpoolMaxAttempts: 10,
+
+		ValidateRanges:           true,
+		HoldMissing:              5 * time.Minute,
+		SleepAfterPolls:          4,
+		TripStartSpeed:           5,
+		TripEndAfter:             5 * time.Minute,
+		SleepIntervals:           []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute},
+		KeepaliveCap:             12 * time.Hour,
+		DoorOpenAlert:            2 * time.Minute,
+		ChargingConfirmSamples:   3,
+		DCFCThresholdKW:          15,
+		EfficiencyWindowKM:       10,
+		RangeWindowKM:            50,
+		WindowOpenThreshold:      5,
+		ZoneHysteresisM:          30,
+		ZoneMaxAccuracyM:         50,
+		TirePressureMin:          2.0,
+		TirePressureDeviationPct: 10,
+		Battery12VLowVolt:        11.8,
+		DebouncePolls:            2,
 
 		// Default intervals (can be overridden)
-		MQTTInterval:       MQTTTransmitInterval,
-		ABRPInterval:       ABRPTransmitInterval,
-		RequireABRPApp:     true,
-		EnableWiFiReenable: false, // WiFi re-enable disabled by default
+		PollInterval:        DiplusPollInterval,
+		PollIntervalMin:     MinPollInterval,
+		PollIntervalMax:     MaxPollInterval,
+		MQTTInterval:        MQTTTransmitInterval,
+		ABRPInterval:        ABRPTransmitInterval,
+		ABRPParkedInterval:  ABRPParkedTransmitInterval,
+		TransmitTimeout:     30 * time.Second,
+		ABRPTransmitTimeout: 60 * time.Second,
+		ConnectTimeout:      15 * time.Second,
+		TransmitBudget:      10 * time.Second,
+		RequireABRPApp:      true,
+		EnableWiFiReenable:  false, // WiFi re-enable disabled by default
+
+		EnableMQTT:       true,
+		EnableABRP:       true,
+		EnableWebSocket:  true,
+		EnableHAREST:     true,
+		EnableTraccar:    true,
+		EnableEVCC:       true,
+		EnablePrometheus: true,
+		EnableInflux:     true,
+		EnableWebhook:    true,
+		EnablePostgres:   true,
+		EnableCSV:        true,
+		EnableHistory:    true,
 	}
 }
 
-// Validate checks if the configuration is valid
+// Validate checks if the configuration is valid; the error lists every
+// problem ValidateConfig finds.
 func (c *Config) Validate() error {
-	// Basic validation
-	if c.DeviceID == "" {
-		return fmt.Errorf("device ID is required")
+	if errs := ValidateConfig(c); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Error()
+		}
+		return errors.New(strings.Join(msgs, "; "))
+	}
+
+	// Set defaults for invalid values
+	if c.DiplusTimeout <= 0 {
+		c.DiplusTimeout = 10 * time.Second
+	}
+	if c.ABRPTimeout <= 0 {
+		c.ABRPTimeout = 10 * time.Second
 	}
 
-	// MQTT validation - support both WebSocket and standard MQTT protocols
-	if c.MQTTUrl != "" {
-		if !strings.HasPrefix(c.MQTTUrl, "ws://") &&
-			!strings.HasPrefix(c.MQTTUrl, "wss://") &&
-			!strings.HasPrefix(c.MQTTUrl, "mqtt://") &&
-			!strings.HasPrefix(c.MQTTUrl, "mqtts://") {
-			return fmt.Errorf("MQTT URL must use supported protocol (ws://, wss://, mqtt://, or mqtts://)")
+	return nil
+}
+
+// ParsePollInterval parses a BYD_HASS_POLL_INTERVAL value (a Go duration such
+// as "10s", or plain seconds). Invalid or too-short values yield the default
+// together with an error describing the problem.
+func ParsePollInterval(raw string) (time.Duration, error) {
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		v, err2 := strconv.Atoi(raw)
+		if err2 != nil {
+			return DiplusPollInterval, fmt.Errorf("invalid poll interval %q: %w", raw, err)
 		}
+		d = time.Duration(v) * time.Second
 	}
+	if d < MinPollInterval {
+		return DiplusPollInterval, fmt.Errorf("poll interval %s is below the minimum of %s", d, MinPollInterval)
+	}
+	return d, nil
+}
 
-	// ABRP validation
-	if c.ABRPAPIKey != "" && c.ABRPToken == "" {
-		return fmt.Errorf("ABRP token is required when API key is provided")
+// ParseDurationList parses a comma-separated list of durations such as
+// "1m,5m,15m" (entries may also be plain seconds). "" and "0" yield an empty
+// list.
+func ParseDurationList(raw string) ([]time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "0" {
+		return nil, nil
 	}
-	if c.ABRPToken != "" && c.ABRPAPIKey == "" {
-		return fmt.Errorf("ABRP API key is required when token is provided")
+	var list []time.Duration
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			v, err2 := strconv.Atoi(part)
+			if err2 != nil {
+				return nil, fmt.Errorf("invalid duration %q in %q", part, raw)
+			}
+			d = time.Duration(v) * time.Second
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("duration %q in %q must be positive", part, raw)
+		}
+		list = append(list, d)
 	}
+	return list, nil
+}
 
-	// Set defaults for invalid values
-	if c.APITimeout <= 0 {
-		c.APITimeout = 10 // Set default
+// ParseDeadbands parses per-sensor deadbands such as "33:0.5,2:1" (sensor
+// ID:deadband, comma-separated). "" yields nil.
+func ParseDeadbands(raw string) (map[int]float64, error) {
+	var bands map[int]float64
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		idStr, bandStr, ok := strings.Cut(entry, ":")
+		id, err := strconv.Atoi(strings.TrimSpace(idStr))
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid entry %q: expected id:deadband", entry)
+		}
+		band, err := strconv.ParseFloat(strings.TrimSpace(bandStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry %q: deadband is not a number", entry)
+		}
+		if bands == nil {
+			bands = make(map[int]float64)
+		}
+		bands[id] = band
 	}
+	return bands, nil
+}
 
-	return nil
+// ClampPollInterval limits d to [PollIntervalMin, PollIntervalMax].
+func (c *Config) ClampPollInterval(d time.Duration) time.Duration {
+	if d < c.PollIntervalMin {
+		return c.PollIntervalMin
+	}
+	if c.PollIntervalMax > 0 && d > c.PollIntervalMax {
+		return c.PollIntervalMax
+	}
+	return d
+}
+
+// NamespaceID returns the identifier used for MQTT topics, client ID, discovery
+// unique_ids and the Home Assistant device. It is DeviceID suffixed with the
+// sanitised VehicleID when one is configured, so two instances with different
+// vehicle IDs never share a topic or entity.
+func (c *Config) NamespaceID() string {
+	vid := SanitizeID(c.VehicleID)
+	if vid == "" {
+		return c.DeviceID
+	}
+	return c.DeviceID + "_" + vid
+}
+
+// SanitizeID lower-cases id and replaces everything except [a-z0-9_-] with
+// '_' so it is safe to use in MQTT topics and Home Assistant unique_ids.
+func SanitizeID(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	var b strings.Builder
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
 }
 
 // HasMQTT returns true if MQTT is configured
@@ -112,12 +643,155 @@ func (c *Config) HasMQTT() bool {
 	return c.MQTTUrl != ""
 }
 
+// InfluxTagSensorList splits InfluxTagSensors into sensor names.
+func (c *Config) InfluxTagSensorList() []string {
+	var names []string
+	for _, n := range strings.Split(c.InfluxTagSensors, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// ABRPTokens splits ABRPToken into the individual user tokens, skipping blanks
+// and duplicates.
+func (c *Config) ABRPTokens() []string {
+	var tokens []string
+	seen := make(map[string]bool)
+	for _, tok := range strings.Split(c.ABRPToken, ",") {
+		tok = strings.TrimSpace(tok)
+		if tok == "" || seen[tok] {
+			continue
+		}
+		seen[tok] = true
+		tokens = append(tokens, tok)
+	}
+	return tokens
+}
+
+// WebhookOutputs returns the webhooks to run: the one of the Webhook*
+// settings, unnamed, when WebhookURL is set, then Webhooks with their empty
+// fields filled in.
+func (c *Config) WebhookOutputs() []Webhook {
+	var hooks []Webhook
+	if c.WebhookURL != "" {
+		hooks = append(hooks, Webhook{
+			URL:      c.WebhookURL,
+			Token:    c.WebhookToken,
+			Mode:     c.WebhookMode,
+			Rules:    c.WebhookRules,
+			Template: c.WebhookTemplate,
+			Timeout:  c.WebhookTimeout,
+			Interval: c.WebhookInterval,
+		})
+	}
+	for _, w := range c.Webhooks {
+		if w.Mode == "" {
+			w.Mode = c.WebhookMode
+		}
+		if w.Timeout == 0 {
+			w.Timeout = c.WebhookTimeout
+		}
+		if w.Interval == 0 {
+			w.Interval = c.WebhookInterval
+		}
+		hooks = append(hooks, w)
+	}
+	return hooks
+}
+
+// Secrets lists the configured credentials, which are redacted from logs.
+func (c *Config) Secrets() []string {
+	secrets := append([]string{c.ABRPAPIKey, c.HAToken, c.EVCCToken, c.InfluxToken, c.WebhookToken, c.APIToken}, c.ABRPTokens()...)
+	for _, w := range c.Webhooks {
+		secrets = append(secrets, w.Token)
+	}
+	for _, raw := range []string{c.MQTTUrl, c.PostgresURL} {
+		if u, err := url.Parse(raw); err == nil && u.User != nil {
+			if password, ok := u.User.Password(); ok {
+				secrets = append(secrets, password)
+			}
+		}
+	}
+	if _, password, ok := strings.Cut(c.EVCCBasicAuth, ":"); ok {
+		secrets = append(secrets, password)
+	}
+	return secrets
+}
+
+// Changed lists the settings, by their json names, whose values differ
+// between c and other.
+func (c *Config) Changed(other *Config) []string {
+	var keys []string
+	a, b := reflect.ValueOf(c).Elem(), reflect.ValueOf(other).Elem()
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" || !t.Field(i).IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+// With returns a copy of c with the settings named by keys, by their json
+// names, taken from other.
+func (c *Config) With(other *Config, keys []string) *Config {
+	merged := *c
+	a, b := reflect.ValueOf(&merged).Elem(), reflect.ValueOf(other).Elem()
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if slices.Contains(keys, name) {
+			a.Field(i).Set(b.Field(i))
+		}
+	}
+	return &merged
+}
+
+// DiplusEndpoint returns the Diplus request URL: DiplusURL, with http://
+// added if it has no scheme, joined with DiplusTemplate.
+func (c *Config) DiplusEndpoint() (string, error) {
+	base := strings.TrimRight(c.DiplusURL, "/")
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("must use http:// or https://, got %s://", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", errors.New("missing host")
+	}
+	if p := u.Port(); p != "" {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("invalid port %q", p)
+		}
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", errors.New("must not contain a query; use diplus_template")
+	}
+	return base + c.DiplusTemplate, nil
+}
+
+// MQTTRepublishInterval is how often unchanged MQTT topics are sent again:
+// the shorter of PublishRefresh and ForceUpdateInterval (0 = never).
+func (c *Config) MQTTRepublishInterval() time.Duration {
+	d := c.PublishRefresh
+	if c.ForceUpdateInterval > 0 && (d == 0 || c.ForceUpdateInterval < d) {
+		d = c.ForceUpdateInterval
+	}
+	return d
+}
+
 // HasABRP returns true if ABRP is configured
 func (c *Config) HasABRP() bool {
 	return c.ABRPAPIKey != "" && c.ABRPToken != ""
 }
-
-// GetAPITimeout returns the API timeout as a duration
-func (c *Config) GetAPITimeout() time.Duration {
-	return time.Duration(c.APITimeout) * time.Second
-}
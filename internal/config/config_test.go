@@ -0,0 +1,31 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePollInterval(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"10s", 10 * time.Second, false},
+		{"2m", 2 * time.Minute, false},
+		{"20", 20 * time.Second, false}, // plain seconds
+		{"1s", MinPollInterval, false},
+		{"500ms", DiplusPollInterval, true},
+		{"0", DiplusPollInterval, true},
+		{"-5s", DiplusPollInterval, true},
+		{"soon", DiplusPollInterval, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParsePollInterval(tt.raw)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("ParsePollInterval(%q) = %s, %v; want %s, error %v", tt.raw, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,9 +4,12 @@ import "time"
 
 const (
 	// Polling / transmission intervals
-	DiplusPollInterval   = 8 * time.Second  // Poll local DiPlus API
-	ABRPTransmitInterval = 10 * time.Second // Push data to ABRP (HTTP)
-	MQTTTransmitInterval = 60 * time.Second // Publish data to MQTT
+	DiplusPollInterval         = 8 * time.Second  // Poll local DiPlus API (default for BYD_HASS_POLL_INTERVAL)
+	MinPollInterval            = 1 * time.Second  // Lower bound for BYD_HASS_POLL_INTERVAL
+	MaxPollInterval            = 5 * time.Minute  // Default upper bound of the poll interval setting
+	ABRPTransmitInterval       = 10 * time.Second // Push data to ABRP (HTTP)
+	ABRPParkedTransmitInterval = 10 * time.Minute // Push data to ABRP while parked & not charging
+	MQTTTransmitInterval       = 60 * time.Second // Publish data to MQTT
 
 	// Operation time-outs (to avoid blocking goroutines)
 	DiplusTimeout = 3 * time.Second // DiPlus API call
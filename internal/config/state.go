@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RuntimeState holds the settings changed at runtime (from the Home Assistant
+// number/select entities). It is persisted to Config.StateFile and takes
+// precedence over flags and environment on the next start.
+type RuntimeState struct {
+	PollIntervalSeconds int    `json:"poll_interval_seconds,omitempty"`
+	ABRPIntervalSeconds int    `json:"abrp_interval_seconds,omitempty"`
+	LogLevel            string `json:"log_level,omitempty"`
+}
+
+// LoadRuntimeState reads the state file. A missing file yields an empty state.
+func LoadRuntimeState(path string) (RuntimeState, error) {
+	var s RuntimeState
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return RuntimeState{}, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// SaveRuntimeState writes s to path atomically.
+func SaveRuntimeState(path string, s RuntimeState) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	return WriteFileAtomic(path, data)
+}
+
+// WriteFileAtomic writes data to path via a temp file and a rename, so a
+// power cut never leaves a truncated file behind. Missing directories are
+// created.
+func WriteFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// FieldError is a problem with one configuration setting. Field is the key
+// the setting has in `config print`.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidateConfig checks c and returns every problem found, in field order;
+// nil means c is usable. It only reports settings that cannot work, not the
+// ones flag parsing already replaced with a default.
+func ValidateConfig(c *Config) []FieldError {
+	var errs []FieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	oneOf := func(field, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		add(field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+	}
+
+	if c.MQTTUrl != "" {
+		if u, err := url.Parse(c.MQTTUrl); err != nil {
+			add("mqtt_url", "invalid URL: %v", err)
+		} else if u.Scheme != "ws" && u.Scheme != "wss" && u.Scheme != "mqtt" && u.Scheme != "mqtts" {
+			add("mqtt_url", "must use ws://, wss://, mqtt:// or mqtts://")
+		}
+	}
+	if c.MQTTTokenFile != "" && c.MQTTTokenURL != "" {
+		add("mqtt_token_url", "cannot be combined with mqtt_token_file")
+	}
+	if (c.MQTTCert == "") != (c.MQTTKey == "") {
+		add("mqtt_key", "mqtt_cert and mqtt_key must be set together")
+	}
+	if c.DiplusSource == "" {
+		if _, err := c.DiplusEndpoint(); err != nil {
+			add("diplus_url", "%v", err)
+		}
+		if !strings.Contains(c.DiplusTemplate, "{text}") {
+			add("diplus_template", "must contain {text}, where the sensor template goes")
+		} else if !strings.HasPrefix(c.DiplusTemplate, "/") && !strings.HasPrefix(c.DiplusTemplate, "?") {
+			add("diplus_template", "must start with / or ?")
+		}
+	}
+	if _, err := sensors.ParseQoS(c.MQTTQoS); err != nil {
+		add("mqtt_qos", "%v", err)
+	}
+	if _, err := sensors.ParseSensorIDList(c.SensorForce); err != nil {
+		add("sensor_force", "%v", err)
+	}
+	if _, err := sensors.ParseComfortFormula(c.Comfort); err != nil {
+		add("comfort", "%v", err)
+	}
+	oneOf("mqtt_layout", c.MQTTLayout, "native", "teslamate")
+	oneOf("publish_mode", c.PublishMode, "onchange", "always")
+	oneOf("units", c.Units, "metric", "imperial", "auto")
+
+	if c.ABRPAPIKey != "" && c.ABRPToken == "" {
+		add("abrp_token", "required when abrp_api_key is set")
+	}
+	if c.ABRPToken != "" && c.ABRPAPIKey == "" {
+		add("abrp_api_key", "required when abrp_token is set")
+	}
+	oneOf("abrp_mode", c.ABRPMode, "http", "ws")
+	if id := c.ABRPPackVoltageSensor; id != 0 {
+		if def := sensors.GetSensorByID(id); def == nil || def.UnitOfMeasurement != "V" {
+			add("abrp_pack_voltage_sensor", "sensor %d is not a voltage sensor", id)
+		}
+	}
+
+	if c.DeviceID == "" {
+		add("device_id", "is required")
+	}
+	if c.DiplusParallel != 1 && c.DiplusParallel != 2 {
+		add("diplus_parallel", "must be 1 or 2, got %d", c.DiplusParallel)
+	}
+	if c.Diagnostics && c.APIToken == "" {
+		add("api_token", "required when diagnostics is enabled")
+	}
+	if c.WebhookURL != "" {
+		oneOf("webhook_mode", c.WebhookMode, "change", "every", "rules")
+	}
+	names := make(map[string]bool)
+	for i, w := range c.Webhooks {
+		field := fmt.Sprintf("webhooks[%d]", i)
+		switch {
+		case w.Name == "":
+			add(field, "name is required")
+		case SanitizeID(w.Name) != w.Name:
+			add(field, "name %q may only contain a-z, 0-9, _ and -", w.Name)
+		case names[w.Name]:
+			add(field, "name %q is used twice", w.Name)
+		}
+		names[w.Name] = true
+		if w.URL == "" {
+			add(field, "url is required")
+		}
+		if w.Mode != "" {
+			oneOf(field+".mode", w.Mode, "change", "every", "rules")
+		}
+		if w.Timeout < 0 || w.Interval < 0 {
+			add(field, "timeout and interval must not be negative")
+		}
+	}
+	for i, z := range c.Geofences {
+		if err := z.Validate(); err != nil {
+			add(fmt.Sprintf("geofences[%d]", i), "%v", err)
+		}
+	}
+	ids := make([]int, 0, len(c.PublishDeadbands))
+	for id := range c.PublishDeadbands {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if d := c.PublishDeadbands[id]; sensors.GetSensorByID(id) == nil {
+			add("publish_deadbands", "unknown sensor ID %d", id)
+		} else if d < 0 {
+			add("publish_deadbands", "sensor %d: must not be negative, got %g", id, d)
+		}
+	}
+	if c.CSVDir != "" {
+		oneOf("csv_rotate", c.CSVRotate, "daily", "size")
+	}
+
+	// No numeric setting takes a negative value; 0 disables the optional
+	// ones, but not these.
+	positive := map[string]bool{
+		"poll_interval":        true,
+		"mqtt_interval":        true,
+		"abrp_interval":        true,
+		"abrp_parked_interval": true,
+	}
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		switch f := v.Field(i).Interface().(type) {
+		case int:
+			if f < 0 {
+				add(name, "must not be negative, got %d", f)
+			}
+		case float64:
+			if f < 0 {
+				add(name, "must not be negative, got %g", f)
+			}
+		case time.Duration:
+			if positive[name] && f <= 0 {
+				add(name, "interval must be positive, got %s", f)
+			} else if f < 0 {
+				add(name, "must not be negative, got %s", f)
+			}
+		case []time.Duration:
+			for _, d := range f {
+				if d <= 0 {
+					add(name, "intervals must be positive, got %s", d)
+					break
+				}
+			}
+		}
+	}
+	return errs
+}
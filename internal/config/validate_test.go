@@ -0,0 +1,36 @@
+package config
+
+import "testing"
+
+// fieldErrors returns the fields ValidateConfig reports for the default
+// config modified by set.
+func fieldErrors(set func(c *Config)) map[string]string {
+	c := GetDefaultConfig()
+	c.DeviceID = "test"
+	set(c)
+	out := make(map[string]string)
+	for _, e := range ValidateConfig(c) {
+		out[e.Field] = e.Message
+	}
+	return out
+}
+
+func TestValidateDiagnostics(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(c *Config)
+		wantErr bool
+	}{
+		{"off by default", func(c *Config) {}, false},
+		{"enabled without token", func(c *Config) { c.Diagnostics = true }, true},
+		{"enabled with token", func(c *Config) { c.Diagnostics, c.APIToken = true, "s3cret" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got := fieldErrors(tt.set)["api_token"]
+			if got != tt.wantErr {
+				t.Errorf("api_token error = %v, want %v", got, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IsYAMLFile reports whether the config file at path is YAML, by its
+// extension; any other file is read as an env file (see ReadEnvFile).
+func IsYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// LoadYAMLFile reads the YAML config file at path into c, on top of what c
+// already holds. The keys are those `config print` writes, so its output
+// can be used as a config file; nested settings such as geofences and
+// webhooks are mappings or lists of mappings. Durations are written like
+// "10s". Unknown keys are ignored and reported in warnings together with
+// the valid ones; a value that does not fit its setting is an error.
+//
+// set lists the top-level keys the file sets.
+func LoadYAMLFile(path string, c *Config) (set map[string]bool, warnings []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	set, warnings, err = loadYAML(data, c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, w := range warnings {
+		warnings[i] = path + ": " + w
+	}
+	return set, warnings, nil
+}
+
+func loadYAML(data []byte, c *Config) (map[string]bool, []string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, nil // empty or only comments
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("line %d: expected key: value settings", root.Line)
+	}
+	set := make(map[string]bool)
+	for i := 0; i < len(root.Content); i += 2 {
+		set[root.Content[i].Value] = true
+	}
+	warnings := checkYAMLKeys(root, reflect.TypeOf(c).Elem(), "")
+	if err := root.Decode(c); err != nil {
+		return nil, nil, err
+	}
+	return set, warnings, nil
+}
+
+// yamlFields maps the YAML keys of struct type t to the types of their
+// fields.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// checkYAMLKeys returns a warning for every mapping in n, which is decoded
+// into type t, with keys no field takes. where locates n in the file.
+func checkYAMLKeys(n *yaml.Node, t reflect.Type, where string) []string {
+	var warnings []string
+	switch {
+	case t.Kind() == reflect.Struct && n.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		var unknown []string
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			ft, ok := fields[key]
+			if !ok {
+				unknown = append(unknown, key)
+				continue
+			}
+			sub := key
+			if where != "" {
+				sub = where + "." + key
+			}
+			warnings = append(warnings, checkYAMLKeys(n.Content[i+1], ft, sub)...)
+		}
+		if len(unknown) > 0 {
+			valid := make([]string, 0, len(fields))
+			for name := range fields {
+				valid = append(valid, name)
+			}
+			sort.Strings(unknown)
+			sort.Strings(valid)
+			w := fmt.Sprintf("unknown keys ignored: %s (valid keys: %s)", strings.Join(unknown, ", "), strings.Join(valid, ", "))
+			if where != "" {
+				w = where + ": " + w
+			}
+			warnings = append([]string{w}, warnings...)
+		}
+	case t.Kind() == reflect.Slice && n.Kind == yaml.SequenceNode:
+		for i, item := range n.Content {
+			warnings = append(warnings, checkYAMLKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", where, i))...)
+		}
+	}
+	return warnings
+}
+
+// WriteYAML writes the effective configuration as YAML, in the format
+// LoadYAMLFile reads, with every credential listed by Secrets replaced by
+// <redacted>.
+func (c *Config) WriteYAML(w io.Writer) error {
+	var doc yaml.Node
+	if err := doc.Encode(c); err != nil {
+		return err
+	}
+	var secrets []string
+	for _, s := range c.Secrets() {
+		if s != "" {
+			secrets = append(secrets, s)
+		}
+	}
+	redactYAML(&doc, secrets)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// redactYAML replaces secrets in the string values below n.
+func redactYAML(n *yaml.Node, secrets []string) {
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!str" {
+		for _, secret := range secrets {
+			n.Value = strings.ReplaceAll(n.Value, secret, "<redacted>")
+		}
+	}
+	for _, child := range n.Content {
+		redactYAML(child, secrets)
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		want     func(*Config) string
+		wantText string
+		warnings string
+		wantErr  string
+	}{
+		{
+			name:     "flat settings",
+			yaml:     "mqtt_url: mqtt://broker:1883\npoll_interval: 20s\nenable_abrp: false\n",
+			want:     func(c *Config) string { return fmt.Sprint(c.MQTTUrl, " ", c.PollInterval, " ", c.EnableABRP) },
+			wantText: "mqtt://broker:1883 20s false",
+		},
+		{
+			name: "nested settings",
+			yaml: `geofences:
+  - {name: home, latitude: 52.37, longitude: 4.89, radius_m: 100}
+publish_deadbands:
+  33: 0.5
+webhooks:
+  - name: garage
+    url: http://garage.local/hook
+    interval: 1m
+`,
+			want: func(c *Config) string {
+				return fmt.Sprint(c.Geofences, c.PublishDeadbands, c.Webhooks[0].Name, " ", c.Webhooks[0].Interval)
+			},
+			wantText: "[{home 52.37 4.89 100}] map[33:0.5]garage 1m0s",
+		},
+		{
+			name:     "unknown keys",
+			yaml:     "mqtt_urll: x\nwebhooks:\n  - {name: a, url: http://a, secret: x}\n",
+			want:     func(c *Config) string { return c.Webhooks[0].URL },
+			wantText: "http://a",
+			warnings: "unknown keys ignored: mqtt_urll|webhooks[0]: unknown keys ignored: secret",
+		},
+		{name: "empty", yaml: "# nothing yet\n", want: func(c *Config) string { return c.DiplusURL }, wantText: "localhost:8988"},
+		{name: "duration without unit", yaml: "poll_interval: 20\n", wantErr: "line 1"},
+		{name: "list at the top", yaml: "- mqtt_url\n", wantErr: "expected key: value settings"},
+		{name: "duplicate key", yaml: "units: metric\nunits: imperial\n", wantErr: "already defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := GetDefaultConfig()
+			_, warnings, err := loadYAML([]byte(tt.yaml), c)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.want(c); got != tt.wantText {
+				t.Errorf("got %s, want %s", got, tt.wantText)
+			}
+			var short []string
+			for _, w := range warnings {
+				short = append(short, strings.Split(w, " (valid keys")[0])
+			}
+			if got := strings.Join(short, "|"); got != tt.warnings {
+				t.Errorf("warnings %q, want %q", got, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestWriteYAMLRoundTrip(t *testing.T) {
+	c := GetDefaultConfig()
+	c.DeviceID = "car"
+	c.ABRPToken = "tok-secret"
+	c.Webhooks = []Webhook{{Name: "garage", URL: "http://garage.local/hook", Token: "hook-secret", Interval: time.Minute}}
+
+	var buf bytes.Buffer
+	if err := c.WriteYAML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "secret") {
+		t.Errorf("credentials not redacted:\n%s", out)
+	}
+
+	read := GetDefaultConfig()
+	_, warnings, err := loadYAML(buf.Bytes(), read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("warnings reading config print output: %q", warnings)
+	}
+	read.ABRPToken, read.Webhooks[0].Token = c.ABRPToken, c.Webhooks[0].Token
+	if changed := c.Changed(read); len(changed) > 0 {
+		t.Errorf("settings changed by the round trip: %v", changed)
+	}
+}
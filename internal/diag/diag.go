@@ -0,0 +1,249 @@
+// Package diag collects health information about byd-hass itself: uptime,
+// poll and transmit outcomes, buffered message counts and memory usage.
+package diag
+
+import (
+	"encoding/json"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limits that keep a Snapshot, and the retained MQTT message built from it,
+// within a few KB.
+const (
+	maxTransmitters = 16
+	maxBuffers      = 8
+	maxErrorLen     = 120
+
+	// MaxPayloadBytes caps the encoded snapshot.
+	MaxPayloadBytes = 4096
+)
+
+// Status values reported by Snapshot.
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+)
+
+// Registry holds the counters. PollResult and TransmitResult match the
+// app.Observer interface, so the collector and scheduler feed it like any
+// other observer. All methods are safe for concurrent use.
+type Registry struct {
+	start   time.Time
+	version string
+	commit  string
+	// staleAfter is how old the last successful poll may be before the
+	// status turns degraded.
+	staleAfter time.Duration
+
+	mu           sync.Mutex
+	polls        uint64
+	pollErrors   uint64
+	lastPollOK   time.Time
+	diplusDown   bool
+	transmitters map[string]*txCounters
+	buffers      map[string]func() int
+}
+
+type txCounters struct {
+	sent        uint64
+	errors      uint64
+	lastSuccess time.Time
+	lastError   string
+	failing     bool
+}
+
+// Snapshot is the JSON view published as the diagnostic sensor's attributes.
+type Snapshot struct {
+	Status         string             `json:"status"`
+	Version        string             `json:"version"`
+	Commit         string             `json:"commit,omitempty"`
+	UptimeSeconds  int64              `json:"uptime_s"`
+	Polls          uint64             `json:"polls"`
+	PollErrors     uint64             `json:"poll_errors"`
+	LastPollAgeSec *int64             `json:"last_poll_age_s"`
+	DiplusBreaker  string             `json:"diplus_breaker"` // "closed" or "open"
+	Transmitters   []TransmitterState `json:"transmitters,omitempty"`
+	Buffered       map[string]int     `json:"buffered,omitempty"`
+	HeapMB         float64            `json:"heap_mb"`
+	SysMB          float64            `json:"sys_mb"`
+	Goroutines     int                `json:"goroutines"`
+}
+
+// TransmitterState summarises one transmitter.
+type TransmitterState struct {
+	Name           string `json:"name"`
+	Sent           uint64 `json:"sent"`
+	Errors         uint64 `json:"errors"`
+	LastSuccessAge *int64 `json:"last_success_age_s"`
+	LastError      string `json:"last_error,omitempty"`
+}
+
+// New creates a registry. The status is degraded once no poll succeeded for
+// staleAfter (0 disables that check).
+func New(version, commit string, staleAfter time.Duration) *Registry {
+	return &Registry{
+		start:        time.Now(),
+		version:      version,
+		commit:       commit,
+		staleAfter:   staleAfter,
+		transmitters: make(map[string]*txCounters),
+		buffers:      make(map[string]func() int),
+	}
+}
+
+// PollResult records the outcome of a Diplus poll.
+func (r *Registry) PollResult(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.polls++
+	if err != nil {
+		r.pollErrors++
+		return
+	}
+	r.lastPollOK = time.Now()
+}
+
+// SetDiplusConnected records the Diplus circuit breaker state.
+func (r *Registry) SetDiplusConnected(connected bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.diplusDown = !connected
+}
+
+// TransmitResult records the outcome of a transmission.
+func (r *Registry) TransmitResult(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.transmitters[name]
+	if !ok {
+		if len(r.transmitters) >= maxTransmitters {
+			return
+		}
+		c = &txCounters{}
+		r.transmitters[name] = c
+	}
+	if err != nil {
+		c.errors++
+		c.lastError = truncate(err.Error(), maxErrorLen)
+		c.failing = true
+		return
+	}
+	c.sent++
+	c.lastSuccess = time.Now()
+	c.failing = false
+}
+
+// RegisterBuffer adds a queue whose length is reported under name. fn must
+// be cheap and must not block for long.
+func (r *Registry) RegisterBuffer(name string, fn func() int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.buffers) >= maxBuffers {
+		return
+	}
+	r.buffers[name] = fn
+}
+
+// Snapshot returns the current state.
+func (r *Registry) Snapshot() Snapshot {
+	now := time.Now()
+
+	r.mu.Lock()
+	s := Snapshot{
+		Status:        StatusOK,
+		Version:       r.version,
+		Commit:        r.commit,
+		UptimeSeconds: int64(now.Sub(r.start) / time.Second),
+		Polls:         r.polls,
+		PollErrors:    r.pollErrors,
+		DiplusBreaker: "closed",
+	}
+	if r.diplusDown {
+		s.DiplusBreaker = "open"
+		s.Status = StatusDegraded
+	}
+	if !r.lastPollOK.IsZero() {
+		s.LastPollAgeSec = ageSeconds(now, r.lastPollOK)
+	}
+	if r.staleAfter > 0 {
+		since := r.lastPollOK
+		if since.IsZero() {
+			since = r.start
+		}
+		if now.Sub(since) > r.staleAfter {
+			s.Status = StatusDegraded
+		}
+	}
+	for name, c := range r.transmitters {
+		ts := TransmitterState{Name: name, Sent: c.sent, Errors: c.errors, LastError: c.lastError}
+		if !c.lastSuccess.IsZero() {
+			ts.LastSuccessAge = ageSeconds(now, c.lastSuccess)
+		}
+		if c.failing {
+			s.Status = StatusDegraded
+		}
+		s.Transmitters = append(s.Transmitters, ts)
+	}
+	buffers := make(map[string]func() int, len(r.buffers))
+	for name, fn := range r.buffers {
+		buffers[name] = fn
+	}
+	r.mu.Unlock()
+
+	sort.Slice(s.Transmitters, func(i, j int) bool { return s.Transmitters[i].Name < s.Transmitters[j].Name })
+
+	// Buffer lengths are read without the lock; a reporter may briefly wait
+	// for its own transmitter.
+	if len(buffers) > 0 {
+		s.Buffered = make(map[string]int, len(buffers))
+		for name, fn := range buffers {
+			s.Buffered[name] = fn()
+		}
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s.HeapMB = roundMB(mem.HeapAlloc)
+	s.SysMB = roundMB(mem.Sys)
+	s.Goroutines = runtime.NumGoroutine()
+	return s
+}
+
+// JSON encodes s in at most MaxPayloadBytes, dropping the error texts and
+// then the per-transmitter details if necessary.
+func (s Snapshot) JSON() ([]byte, error) {
+	data, err := json.Marshal(s)
+	if err != nil || len(data) <= MaxPayloadBytes {
+		return data, err
+	}
+	trimmed := make([]TransmitterState, len(s.Transmitters))
+	for i, ts := range s.Transmitters {
+		ts.LastError = ""
+		trimmed[i] = ts
+	}
+	s.Transmitters = trimmed
+	if data, err = json.Marshal(s); err != nil || len(data) <= MaxPayloadBytes {
+		return data, err
+	}
+	s.Transmitters = nil
+	return json.Marshal(s)
+}
+
+func ageSeconds(now, t time.Time) *int64 {
+	v := int64(now.Sub(t) / time.Second)
+	return &v
+}
+
+func roundMB(b uint64) float64 {
+	return float64(b*10/(1<<20)) / 10
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
@@ -0,0 +1,98 @@
+package diag
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotStatus(t *testing.T) {
+	fail := errors.New("connection refused")
+	tests := []struct {
+		name        string
+		staleAfter  time.Duration
+		feed        func(r *Registry)
+		wantStatus  string
+		wantBreaker string
+	}{
+		{"fresh poll", time.Minute, func(r *Registry) {
+			r.PollResult(nil)
+		}, StatusOK, "closed"},
+		{"failed polls only", 0, func(r *Registry) {
+			r.PollResult(fail)
+			r.PollResult(fail)
+		}, StatusOK, "closed"},
+		{"no poll succeeded in time", time.Nanosecond, func(r *Registry) {
+			time.Sleep(time.Millisecond)
+		}, StatusDegraded, "closed"},
+		{"breaker open", 0, func(r *Registry) {
+			r.PollResult(nil)
+			r.SetDiplusConnected(false)
+		}, StatusDegraded, "open"},
+		{"breaker closed again", 0, func(r *Registry) {
+			r.SetDiplusConnected(false)
+			r.SetDiplusConnected(true)
+		}, StatusOK, "closed"},
+		{"failing transmitter", 0, func(r *Registry) {
+			r.TransmitResult("MQTT", nil)
+			r.TransmitResult("ABRP", fail)
+		}, StatusDegraded, "closed"},
+		{"transmitter recovered", 0, func(r *Registry) {
+			r.TransmitResult("ABRP", fail)
+			r.TransmitResult("ABRP", nil)
+		}, StatusOK, "closed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New("test", "", tt.staleAfter)
+			tt.feed(r)
+			s := r.Snapshot()
+			if s.Status != tt.wantStatus || s.DiplusBreaker != tt.wantBreaker {
+				t.Errorf("status %q, breaker %q; want %q, %q", s.Status, s.DiplusBreaker, tt.wantStatus, tt.wantBreaker)
+			}
+		})
+	}
+}
+
+func TestSnapshotCounters(t *testing.T) {
+	r := New("test", "abc", 0)
+	r.PollResult(nil)
+	r.PollResult(errors.New("timeout"))
+	r.TransmitResult("MQTT", nil)
+	r.TransmitResult("MQTT", errors.New(strings.Repeat("x", 500)))
+	r.RegisterBuffer("abrp", func() int { return 3 })
+
+	s := r.Snapshot()
+	if s.Polls != 2 || s.PollErrors != 1 {
+		t.Errorf("polls %d, errors %d; want 2, 1", s.Polls, s.PollErrors)
+	}
+	if len(s.Transmitters) != 1 {
+		t.Fatalf("transmitters %+v, want MQTT only", s.Transmitters)
+	}
+	mqtt := s.Transmitters[0]
+	if mqtt.Sent != 1 || mqtt.Errors != 1 || len(mqtt.LastError) != maxErrorLen {
+		t.Errorf("MQTT sent %d, errors %d, error of %d bytes; want 1, 1, %d", mqtt.Sent, mqtt.Errors, len(mqtt.LastError), maxErrorLen)
+	}
+	if s.Buffered["abrp"] != 3 {
+		t.Errorf("buffered %v, want abrp: 3", s.Buffered)
+	}
+}
+
+func TestSnapshotJSONLimit(t *testing.T) {
+	r := New("test", "", 0)
+	for i := 0; i < maxTransmitters+4; i++ {
+		name := strings.Repeat(string(rune('a'+i)), 100)
+		r.TransmitResult(name, errors.New(strings.Repeat("x", maxErrorLen)))
+	}
+	data, err := r.Snapshot().JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > MaxPayloadBytes {
+		t.Errorf("snapshot is %d bytes, want at most %d", len(data), MaxPayloadBytes)
+	}
+	if !strings.Contains(string(data), `"status":"degraded"`) {
+		t.Errorf("trimmed snapshot lost its status: %s", data)
+	}
+}
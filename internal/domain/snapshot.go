@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/Allthebester/byd-hass/internal/location"
 	"github.com/Allthebester/byd-hass/internal/sensors"
 )
 
@@ -30,7 +31,7 @@ func Changed(prev, cur *sensors.SensorData) bool {
 	if p.Location != nil && c.Location != nil {
 		const distThr = 10.0 // metres
 		const bearThr = 5.0  // degrees
-		dist := haversineMeters(p.Location.Latitude, p.Location.Longitude,
+		dist := location.DistanceMeters(p.Location.Latitude, p.Location.Longitude,
 			c.Location.Latitude, c.Location.Longitude)
 		bearingDiff := math.Abs(p.Location.Bearing - c.Location.Bearing)
 		if bearingDiff > 180 {
@@ -44,19 +45,3 @@ func Changed(prev, cur *sensors.SensorData) bool {
 
 	return !reflect.DeepEqual(p, c)
 }
-
-func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
-	const r = 6371000.0 // Earth radius in metres
-	dLat := toRad(lat2 - lat1)
-	dLon := toRad(lon2 - lon1)
-	lat1Rad := toRad(lat1)
-	lat2Rad := toRad(lat2)
-
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	return r * c
-}
-
-func toRad(deg float64) float64 { return deg * math.Pi / 180 }
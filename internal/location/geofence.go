@@ -0,0 +1,194 @@
+package location
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ZoneAway is the zone reported outside every configured zone.
+const ZoneAway = "away"
+
+// Zone is a named circle, e.g. home or work.
+type Zone struct {
+	Name      string  `json:"name" yaml:"name"`
+	Latitude  float64 `json:"latitude" yaml:"latitude"`
+	Longitude float64 `json:"longitude" yaml:"longitude"`
+	RadiusM   float64 `json:"radius_m" yaml:"radius_m"`
+}
+
+// Validate reports why z cannot be used as a zone, if it can't.
+func (z Zone) Validate() error {
+	switch {
+	case z.Name == "":
+		return fmt.Errorf("missing name")
+	case z.Name == ZoneAway:
+		return fmt.Errorf("%q is reserved", ZoneAway)
+	case z.Latitude < -90 || z.Latitude > 90:
+		return fmt.Errorf("latitude out of range")
+	case z.Longitude < -180 || z.Longitude > 180:
+		return fmt.Errorf("longitude out of range")
+	case z.RadiusM <= 0:
+		return fmt.Errorf("radius must be positive")
+	}
+	return nil
+}
+
+// ParseZones parses zones of the form "home:52.37,4.89,100;work:52.09,5.12,150"
+// (name:latitude,longitude,radius in metres). Invalid entries are skipped and
+// reported in the returned warnings.
+func ParseZones(raw string) ([]Zone, []string) {
+	var zones []Zone
+	var warnings []string
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		z, err := parseZone(entry)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("ignoring zone %q: %v", entry, err))
+			continue
+		}
+		zones = append(zones, z)
+	}
+	return zones, warnings
+}
+
+// ReadZonesFile reads zones from path, one per line in the ParseZones format;
+// blank lines and lines starting with # are ignored.
+func ReadZonesFile(path string) ([]Zone, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open zones file: %w", err)
+	}
+	defer f.Close()
+
+	var zones []Zone
+	var warnings []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		z, err := parseZone(entry)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s:%d: ignoring zone %q: %v", path, line, entry, err))
+			continue
+		}
+		zones = append(zones, z)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read zones file: %w", err)
+	}
+	return zones, warnings, nil
+}
+
+func parseZone(entry string) (Zone, error) {
+	name, spec, ok := strings.Cut(entry, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return Zone{}, fmt.Errorf("expected name:latitude,longitude,radius")
+	}
+	parts := strings.Split(spec, ",")
+	if len(parts) != 3 {
+		return Zone{}, fmt.Errorf("expected name:latitude,longitude,radius")
+	}
+	var v [3]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return Zone{}, fmt.Errorf("invalid number %q", strings.TrimSpace(p))
+		}
+		v[i] = f
+	}
+	z := Zone{Name: name, Latitude: v[0], Longitude: v[1], RadiusM: v[2]}
+	if err := z.Validate(); err != nil {
+		return Zone{}, err
+	}
+	return z, nil
+}
+
+// Geofence tracks which zone the car is in. A zone is entered within its
+// radius and only left beyond radius + hysteresisM, so a car parked near the
+// boundary does not flap. Fixes that are not GoodFix or less accurate than
+// maxAccuracyM (0 = no limit) are skipped and keep the current zone.
+type Geofence struct {
+	zones        []Zone
+	hysteresisM  float64
+	maxAccuracyM float64
+
+	mu      sync.Mutex
+	current string // "" until the first usable fix
+}
+
+// NewGeofence creates a geofence over zones.
+func NewGeofence(zones []Zone, hysteresisM, maxAccuracyM float64) *Geofence {
+	return &Geofence{zones: zones, hysteresisM: max(hysteresisM, 0), maxAccuracyM: maxAccuracyM}
+}
+
+// Zones returns the configured zone names.
+func (g *Geofence) Zones() []string {
+	names := make([]string, 0, len(g.zones))
+	for _, z := range g.zones {
+		names = append(names, z.Name)
+	}
+	return names
+}
+
+// Update evaluates a fix and returns the current zone (a zone name,
+// ZoneAway, or "" before the first usable fix) plus the zones left and
+// entered by this fix ("" if none). The first usable fix only sets the zone,
+// so a restart at home does not look like an arrival.
+func (g *Geofence) Update(loc *LocationData) (zone, left, entered string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !loc.GoodFix() || (g.maxAccuracyM > 0 && loc.Accuracy > g.maxAccuracyM) {
+		return g.current, "", ""
+	}
+
+	next := ZoneAway
+	if z := g.zone(g.current); z != nil && g.distance(z, loc) <= z.RadiusM+g.hysteresisM {
+		next = z.Name
+	} else {
+		best := math.Inf(1)
+		for i := range g.zones {
+			z := &g.zones[i]
+			if d := g.distance(z, loc); d <= z.RadiusM && d < best {
+				next, best = z.Name, d
+			}
+		}
+	}
+
+	prev := g.current
+	g.current = next
+	if prev == "" || prev == next {
+		return next, "", ""
+	}
+	if prev != ZoneAway {
+		left = prev
+	}
+	if next != ZoneAway {
+		entered = next
+	}
+	return next, left, entered
+}
+
+func (g *Geofence) zone(name string) *Zone {
+	for i := range g.zones {
+		if g.zones[i].Name == name {
+			return &g.zones[i]
+		}
+	}
+	return nil
+}
+
+func (g *Geofence) distance(z *Zone, loc *LocationData) float64 {
+	return DistanceMeters(z.Latitude, z.Longitude, loc.Latitude, loc.Longitude)
+}
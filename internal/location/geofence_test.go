@@ -0,0 +1,65 @@
+package location
+
+import "testing"
+
+func TestGeofenceHysteresis(t *testing.T) {
+	home := Zone{Name: "home", Latitude: 52, Longitude: 4, RadiusM: 100}
+	// fixAt is a fix distM north of home.
+	fixAt := func(distM, accuracy float64) *LocationData {
+		return &LocationData{
+			Latitude:  home.Latitude + distM/111195,
+			Longitude: home.Longitude,
+			Accuracy:  accuracy,
+			Provider:  "gps",
+		}
+	}
+
+	type step struct {
+		distM, accuracy               float64
+		wantZone, wantLeft, wantEnter string
+	}
+	tests := []struct {
+		name        string
+		hysteresisM float64
+		maxAccuracy float64
+		steps       []step
+	}{
+		{"no hysteresis flaps at the boundary", 0, 0, []step{
+			{distM: 90, wantZone: "home"},
+			{distM: 110, wantZone: ZoneAway, wantLeft: "home"},
+			{distM: 90, wantZone: "home", wantEnter: "home"},
+			{distM: 110, wantZone: ZoneAway, wantLeft: "home"},
+		}},
+		{"hysteresis holds the zone", 50, 0, []step{
+			{distM: 90, wantZone: "home"},
+			{distM: 110, wantZone: "home"},
+			{distM: 90, wantZone: "home"},
+			{distM: 140, wantZone: "home"},
+			{distM: 160, wantZone: ZoneAway, wantLeft: "home"},
+			// Re-entering takes the radius itself, not radius + hysteresis.
+			{distM: 120, wantZone: ZoneAway},
+			{distM: 90, wantZone: "home", wantEnter: "home"},
+		}},
+		{"first fix sets the zone without an event", 50, 0, []step{
+			{distM: 500, wantZone: ZoneAway},
+			{distM: 20, wantZone: "home", wantEnter: "home"},
+		}},
+		{"inaccurate fix keeps the zone", 50, 30, []step{
+			{distM: 20, accuracy: 10, wantZone: "home"},
+			{distM: 500, accuracy: 200, wantZone: "home"},
+			{distM: 500, accuracy: 10, wantZone: ZoneAway, wantLeft: "home"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGeofence([]Zone{home}, tt.hysteresisM, tt.maxAccuracy)
+			for i, st := range tt.steps {
+				zone, left, entered := g.Update(fixAt(st.distM, st.accuracy))
+				if zone != st.wantZone || left != st.wantLeft || entered != st.wantEnter {
+					t.Errorf("step %d (%gm): got zone=%q left=%q entered=%q, want %q %q %q",
+						i, st.distM, zone, left, entered, st.wantZone, st.wantLeft, st.wantEnter)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"sync"
 	"time"
@@ -22,9 +23,51 @@ type LocationData struct {
 	Speed            float64   `json:"speed"`
 	ElapsedMs        int64     `json:"elapsed_ms"`
 	Provider         string    `json:"provider"`
+	Satellites       int       `json:"satellites,omitempty"` // Satellites used in the fix (0 = unknown)
+	HDOP             float64   `json:"hdop,omitempty"`       // Horizontal dilution of precision (0 = unknown)
 	Timestamp        time.Time `json:"-"`
 }
 
+// Fix quality limits for GoodFix.
+const (
+	MinFixSatellites = 4   // fewer satellites than this is a poor fix
+	MaxFixHDOP       = 5.0 // a higher HDOP is a poor fix
+)
+
+// DistanceMeters returns the great-circle distance between two coordinates
+// using the haversine formula.
+func DistanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const r = 6371000.0 // Earth radius in metres
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	lat1Rad := toRad(lat1)
+	lat2Rad := toRad(lat2)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
+			math.Sin(dLon/2)*math.Sin(dLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return r * c
+}
+
+func toRad(deg float64) float64 { return deg * math.Pi / 180 }
+
+// GoodFix reports whether the fix is trustworthy enough for derived values
+// such as altitude and bearing. Quality indicators that the GPS source does
+// not report are not held against the fix.
+func (l *LocationData) GoodFix() bool {
+	if l == nil || l.Provider == "default" {
+		return false
+	}
+	if l.Satellites > 0 && l.Satellites < MinFixSatellites {
+		return false
+	}
+	if l.HDOP > 0 && l.HDOP > MaxFixHDOP {
+		return false
+	}
+	return true
+}
+
 type TermuxLocationProvider struct {
 	logger          *logrus.Logger
 	mu              sync.RWMutex
@@ -70,12 +113,16 @@ func (p *TermuxLocationProvider) fetchFromFile() (*LocationData, time.Time, erro
 	}
 
 	var raw struct {
-		Latitude  float64 `json:"latitude"`
-		Longitude float64 `json:"longitude"`
-		Speed     float64 `json:"speed"`
-		Accuracy  float64 `json:"accuracy"`
-		Battery   float64 `json:"battery"`
-		Timestamp *int64  `json:"timestamp,omitempty"` // Optional timestamp from GPS script
+		Latitude   float64 `json:"latitude"`
+		Longitude  float64 `json:"longitude"`
+		Altitude   float64 `json:"altitude"`
+		Bearing    float64 `json:"bearing"`
+		Speed      float64 `json:"speed"`
+		Accuracy   float64 `json:"accuracy"`
+		Satellites int     `json:"satellites"`
+		HDOP       float64 `json:"hdop"`
+		Battery    float64 `json:"battery"`
+		Timestamp  *int64  `json:"timestamp,omitempty"` // Optional timestamp from GPS script
 	}
 
 	if err := json.Unmarshal(data, &raw); err != nil {
@@ -92,12 +139,16 @@ func (p *TermuxLocationProvider) fetchFromFile() (*LocationData, time.Time, erro
 	}
 
 	return &LocationData{
-		Latitude:  raw.Latitude,
-		Longitude: raw.Longitude,
-		Speed:     raw.Speed,
-		Accuracy:  raw.Accuracy,
-		Provider:  "termux-file",
-		Timestamp: timestamp,
+		Latitude:   raw.Latitude,
+		Longitude:  raw.Longitude,
+		Altitude:   raw.Altitude,
+		Bearing:    raw.Bearing,
+		Speed:      raw.Speed,
+		Accuracy:   raw.Accuracy,
+		Satellites: raw.Satellites,
+		HDOP:       raw.HDOP,
+		Provider:   "termux-file",
+		Timestamp:  timestamp,
 	}, fileModTime, nil
 }
 
@@ -159,6 +210,8 @@ func (p *TermuxLocationProvider) fetchLocationData() {
 			"longitude": loc.Longitude,
 			"speed":     loc.Speed,
 			"accuracy":  loc.Accuracy,
+			"altitude":  loc.Altitude,
+			"bearing":   loc.Bearing,
 			"provider":  loc.Provider,
 			"timestamp": loc.Timestamp,
 			"file_mod":  fileModTime,
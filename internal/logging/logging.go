@@ -0,0 +1,230 @@
+// Package logging builds the logrus loggers used throughout byd-hass: one
+// logger per component (poller, mqtt, abrp, …) carrying a "component" field
+// and its own level, a redaction hook that scrubs secrets before anything is
+// written, and a ring buffer of recent records for the diagnostics endpoint.
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Options configures the loggers.
+type Options struct {
+	// Level is a level spec: a default level optionally followed by
+	// per-component overrides, e.g. "info,mqtt=debug,abrp=warn". Empty
+	// means info (debug with Verbose).
+	Level   string
+	Format  string // "text" or "json"
+	Verbose bool
+	// Secrets are replaced by "[redacted]" in messages and fields.
+	Secrets []string
+	// RedactLocation also hides coordinates.
+	RedactLocation bool
+	// RingSize is the number of recent records kept (0 = 200).
+	RingSize int
+}
+
+// LevelSpec is a parsed level spec.
+type LevelSpec struct {
+	Default   logrus.Level
+	Overrides map[string]logrus.Level
+}
+
+// ParseLevelSpec parses "info,mqtt=debug". A bare level sets the default;
+// "component=level" overrides one component.
+func ParseLevelSpec(spec string) (LevelSpec, error) {
+	ls := LevelSpec{Default: logrus.InfoLevel, Overrides: map[string]logrus.Level{}}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, level, hasName := strings.Cut(part, "=")
+		if !hasName {
+			level, name = name, ""
+		}
+		lvl, err := logrus.ParseLevel(strings.TrimSpace(level))
+		if err != nil {
+			return LevelSpec{}, fmt.Errorf("invalid log level %q (use debug, info, warn or error)", level)
+		}
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+			ls.Default = lvl
+		} else {
+			ls.Overrides[name] = lvl
+		}
+	}
+	return ls, nil
+}
+
+// hasDefault reports whether spec sets the default level.
+func hasDefault(spec string) bool {
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part != "" && !strings.Contains(part, "=") {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the spec back into its textual form.
+func (ls LevelSpec) String() string {
+	parts := []string{ls.Default.String()}
+	names := make([]string, 0, len(ls.Overrides))
+	for name := range ls.Overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, name+"="+ls.Overrides[name].String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// WithDefault returns spec with its default level replaced by level, keeping
+// the component overrides. An unparsable spec is replaced entirely.
+func WithDefault(spec, level string) string {
+	ls, err := ParseLevelSpec(spec)
+	if err != nil {
+		return level
+	}
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return spec
+	}
+	ls.Default = lvl
+	return ls.String()
+}
+
+// Loggers hands out the per-component loggers. All of them share the output,
+// formatter, redaction and ring buffer.
+type Loggers struct {
+	out       *os.File
+	formatter logrus.Formatter
+	redact    *redactHook
+	ring      *Ring
+
+	mu      sync.Mutex
+	spec    LevelSpec
+	loggers map[string]*logrus.Logger
+}
+
+// New creates the loggers. An invalid level spec falls back to info (or
+// debug with Verbose); the error is returned so the caller can warn.
+func New(opts Options) (*Loggers, error) {
+	spec, err := ParseLevelSpec(opts.Level)
+	if err != nil {
+		spec, _ = ParseLevelSpec("")
+	}
+	if opts.Verbose && (err != nil || !hasDefault(opts.Level)) {
+		spec.Default = logrus.DebugLevel
+	}
+
+	var formatter logrus.Formatter = &logrus.TextFormatter{FullTimestamp: true, TimestampFormat: time.RFC3339}
+	if opts.Format == "json" {
+		formatter = &logrus.JSONFormatter{TimestampFormat: time.RFC3339}
+	}
+	size := opts.RingSize
+	if size <= 0 {
+		size = 200
+	}
+	return &Loggers{
+		out:       os.Stderr,
+		formatter: formatter,
+		redact:    newRedactHook(opts.Secrets, opts.RedactLocation),
+		ring:      NewRing(size),
+		spec:      spec,
+		loggers:   make(map[string]*logrus.Logger),
+	}, err
+}
+
+// For returns the logger of component, creating it on first use. Every record
+// it writes carries component in the "component" field.
+func (l *Loggers) For(component string) *logrus.Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if lg, ok := l.loggers[component]; ok {
+		return lg
+	}
+	lg := logrus.New()
+	lg.SetOutput(l.out)
+	lg.SetFormatter(l.formatter)
+	lg.SetLevel(l.levelFor(component))
+	// Hooks run in order: tag, scrub, then keep a copy.
+	lg.AddHook(componentHook(component))
+	lg.AddHook(l.redact)
+	lg.AddHook(l.ring)
+	l.loggers[component] = lg
+	return lg
+}
+
+func (l *Loggers) levelFor(component string) logrus.Level {
+	if lvl, ok := l.spec.Overrides[component]; ok {
+		return lvl
+	}
+	return l.spec.Default
+}
+
+// Level returns the default level.
+func (l *Loggers) Level() logrus.Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.spec.Default
+}
+
+// SetLevel changes the default level; components with an override keep
+// theirs.
+func (l *Loggers) SetLevel(lvl logrus.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.spec.Default = lvl
+	for component, lg := range l.loggers {
+		lg.SetLevel(l.levelFor(component))
+	}
+}
+
+// SetLevelSpec replaces the default level and the component overrides with
+// spec, interpreted as by New. An invalid spec changes nothing.
+func (l *Loggers) SetLevelSpec(spec string, verbose bool) error {
+	ls, err := ParseLevelSpec(spec)
+	if err != nil {
+		return err
+	}
+	if verbose && !hasDefault(spec) {
+		ls.Default = logrus.DebugLevel
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.spec = ls
+	for component, lg := range l.loggers {
+		lg.SetLevel(l.levelFor(component))
+	}
+	return nil
+}
+
+// AddSecret registers another value to redact, e.g. a token fetched at
+// runtime.
+func (l *Loggers) AddSecret(s string) {
+	l.redact.add(s)
+}
+
+// Ring returns the buffer of recent records.
+func (l *Loggers) Ring() *Ring {
+	return l.ring
+}
+
+// componentHook sets the "component" field.
+type componentHook string
+
+func (h componentHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h componentHook) Fire(e *logrus.Entry) error {
+	e.Data["component"] = string(h)
+	return nil
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "[redacted]"
+
+// minSecretLen keeps short values (e.g. "1") from blanking out unrelated text.
+const minSecretLen = 4
+
+// locationFields are hidden when location redaction is on.
+var locationFields = map[string]bool{
+	"lat": true, "lon": true, "latitude": true, "longitude": true, "location": true,
+}
+
+// redactHook scrubs secrets from the message and every field before the
+// record is formatted or stored.
+type redactHook struct {
+	location bool
+
+	mu      sync.RWMutex
+	secrets []string
+}
+
+func newRedactHook(secrets []string, location bool) *redactHook {
+	h := &redactHook{location: location}
+	for _, s := range secrets {
+		h.add(s)
+	}
+	return h
+}
+
+func (h *redactHook) add(s string) {
+	if len(s) < minSecretLen {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, known := range h.secrets {
+		if known == s {
+			return
+		}
+	}
+	h.secrets = append(h.secrets, s)
+}
+
+func (h *redactHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *redactHook) Fire(e *logrus.Entry) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	e.Message = h.scrub(e.Message)
+	for k, v := range e.Data {
+		if h.location && locationFields[strings.ToLower(k)] {
+			e.Data[k] = redacted
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			e.Data[k] = h.scrub(v)
+		case error:
+			if s := v.Error(); h.contains(s) {
+				e.Data[k] = h.scrub(s)
+			}
+		case fmt.Stringer:
+			if s := v.String(); h.contains(s) {
+				e.Data[k] = h.scrub(s)
+			}
+		default:
+			// Slices, maps and structs are rendered as text by the
+			// formatters and the ring; scrub that text.
+			if s := fmt.Sprint(v); h.contains(s) {
+				e.Data[k] = h.scrub(s)
+			}
+		}
+	}
+	return nil
+}
+
+// scrub replaces every secret in s; caller holds h.mu.
+func (h *redactHook) scrub(s string) string {
+	for _, secret := range h.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+func (h *redactHook) contains(s string) bool {
+	for _, secret := range h.secrets {
+		if strings.Contains(s, secret) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Record is one log line kept by the Ring.
+type Record struct {
+	Time      time.Time              `json:"time"`
+	Level     string                 `json:"level"`
+	Component string                 `json:"component,omitempty"`
+	Message   string                 `json:"msg"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Ring keeps the most recent log records in memory. It is a logrus hook and
+// serves its contents as JSON.
+type Ring struct {
+	mu      sync.Mutex
+	records []Record
+	next    int
+	full    bool
+}
+
+// NewRing creates a ring holding size records.
+func NewRing(size int) *Ring {
+	return &Ring{records: make([]Record, size)}
+}
+
+// Levels implements logrus.Hook.
+func (r *Ring) Levels() []logrus.Level { return logrus.AllLevels }
+
+// Fire implements logrus.Hook.
+func (r *Ring) Fire(e *logrus.Entry) error {
+	rec := Record{Time: e.Time, Level: e.Level.String(), Message: e.Message}
+	for k, v := range e.Data {
+		if k == "component" {
+			rec.Component, _ = v.(string)
+			continue
+		}
+		if rec.Fields == nil {
+			rec.Fields = make(map[string]interface{}, len(e.Data))
+		}
+		// Keep JSON-friendly values only; errors and other types are
+		// rendered as text.
+		switch v.(type) {
+		case string, bool, int, int64, uint64, float64:
+			rec.Fields[k] = v
+		default:
+			rec.Fields[k] = fmt.Sprint(v)
+		}
+	}
+
+	r.mu.Lock()
+	r.records[r.next] = rec
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// Records returns the kept records, oldest first.
+func (r *Ring) Records() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Record(nil), r.records[:r.next]...)
+	}
+	out := make([]Record, 0, len(r.records))
+	out = append(out, r.records[r.next:]...)
+	return append(out, r.records[:r.next]...)
+}
+
+// ServeHTTP serves Records as JSON (mounted on /diagnostics/logs).
+func (r *Ring) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"records": r.Records()})
+}
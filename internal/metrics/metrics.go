@@ -0,0 +1,127 @@
+// Package metrics counts what byd-hass itself does – polls, poll latency and
+// deliveries per output – and renders the counters in the Prometheus text
+// exposition format under the bydhass_ namespace, apart from the vehicle
+// gauges.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pollLatencyBuckets are the upper bounds, in seconds, of the poll latency
+// histogram. A healthy head-unit answers well within a second; the upper
+// buckets catch the retries and timeouts of a flaky one.
+var pollLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry holds the counters. PollResult and TransmitResult match the
+// app.Observer interface. All methods are safe for concurrent use.
+type Registry struct {
+	mu         sync.Mutex
+	polls      uint64
+	pollErrors uint64
+	latency    []uint64 // per bucket, not cumulative; the last one is +Inf
+	latencySum float64
+	latencyN   uint64
+	transmits  map[string]*transmitCounters
+}
+
+type transmitCounters struct {
+	success uint64
+	failure uint64
+}
+
+// New creates an empty registry.
+func New() *Registry {
+	return &Registry{
+		latency:   make([]uint64, len(pollLatencyBuckets)+1),
+		transmits: make(map[string]*transmitCounters),
+	}
+}
+
+// PollResult counts a Diplus poll.
+func (r *Registry) PollResult(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.polls++
+	if err != nil {
+		r.pollErrors++
+	}
+}
+
+// PollDuration records how long a Diplus poll took.
+func (r *Registry) PollDuration(d time.Duration) {
+	s := d.Seconds()
+	i := sort.SearchFloat64s(pollLatencyBuckets, s)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latency[i]++
+	r.latencySum += s
+	r.latencyN++
+}
+
+// TransmitResult counts a delivery by output name.
+func (r *Registry) TransmitResult(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.transmits[name]
+	if !ok {
+		c = &transmitCounters{}
+		r.transmits[name] = c
+	}
+	if err != nil {
+		c.failure++
+	} else {
+		c.success++
+	}
+}
+
+// WriteText writes the counters in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	polls, pollErrors := r.polls, r.pollErrors
+	latency := append([]uint64(nil), r.latency...)
+	latencySum, latencyN := r.latencySum, r.latencyN
+	names := make([]string, 0, len(r.transmits))
+	transmits := make(map[string]transmitCounters, len(r.transmits))
+	for name, c := range r.transmits {
+		names = append(names, name)
+		transmits[name] = *c
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP bydhass_polls_total Diplus polls attempted.")
+	fmt.Fprintln(w, "# TYPE bydhass_polls_total counter")
+	fmt.Fprintf(w, "bydhass_polls_total %d\n", polls)
+	fmt.Fprintln(w, "# HELP bydhass_poll_errors_total Diplus polls that failed.")
+	fmt.Fprintln(w, "# TYPE bydhass_poll_errors_total counter")
+	fmt.Fprintf(w, "bydhass_poll_errors_total %d\n", pollErrors)
+
+	fmt.Fprintln(w, "# HELP bydhass_poll_duration_seconds Duration of Diplus polls, including retries.")
+	fmt.Fprintln(w, "# TYPE bydhass_poll_duration_seconds histogram")
+	var cumulative uint64
+	for i, le := range pollLatencyBuckets {
+		cumulative += latency[i]
+		fmt.Fprintf(w, "bydhass_poll_duration_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "bydhass_poll_duration_seconds_bucket{le=\"+Inf\"} %d\n", latencyN)
+	fmt.Fprintf(w, "bydhass_poll_duration_seconds_sum %s\n", strconv.FormatFloat(latencySum, 'g', -1, 64))
+	fmt.Fprintf(w, "bydhass_poll_duration_seconds_count %d\n", latencyN)
+
+	fmt.Fprintln(w, "# HELP bydhass_transmits_total Deliveries per output by result.")
+	fmt.Fprintln(w, "# TYPE bydhass_transmits_total counter")
+	for _, name := range names {
+		c := transmits[name]
+		output := labelEscaper.Replace(name)
+		fmt.Fprintf(w, "bydhass_transmits_total{output=\"%s\",result=\"success\"} %d\n", output, c.success)
+		fmt.Fprintf(w, "bydhass_transmits_total{output=\"%s\",result=\"failure\"} %d\n", output, c.failure)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
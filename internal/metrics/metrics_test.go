@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteText(t *testing.T) {
+	r := New()
+	fail := errors.New("timeout")
+	r.PollResult(nil)
+	r.PollResult(nil)
+	r.PollResult(fail)
+	for _, d := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 700 * time.Millisecond, time.Minute} {
+		r.PollDuration(d)
+	}
+	r.TransmitResult("MQTT", nil)
+	r.TransmitResult("MQTT", nil)
+	r.TransmitResult("ABRP", fail)
+	r.TransmitResult(`web"hook`, nil)
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	out := buf.String()
+
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"polls", "bydhass_polls_total 3"},
+		{"poll errors", "bydhass_poll_errors_total 1"},
+		// Bucket bounds are inclusive.
+		{"fastest bucket", `bydhass_poll_duration_seconds_bucket{le="0.1"} 2`},
+		{"cumulative bucket", `bydhass_poll_duration_seconds_bucket{le="1"} 3`},
+		{"top bucket", `bydhass_poll_duration_seconds_bucket{le="30"} 3`},
+		{"over every bucket", `bydhass_poll_duration_seconds_bucket{le="+Inf"} 4`},
+		{"sum", "bydhass_poll_duration_seconds_sum 60.85"},
+		{"count", "bydhass_poll_duration_seconds_count 4"},
+		{"successes", `bydhass_transmits_total{output="MQTT",result="success"} 2`},
+		{"failures", `bydhass_transmits_total{output="ABRP",result="failure"} 1`},
+		{"no failures", `bydhass_transmits_total{output="MQTT",result="failure"} 0`},
+		{"escaped label", `bydhass_transmits_total{output="web\"hook",result="success"} 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(out, tt.line+"\n") {
+				t.Errorf("missing %q in\n%s", tt.line, out)
+			}
+		})
+	}
+	if a, m := strings.Index(out, `output="ABRP"`), strings.Index(out, `output="MQTT"`); a > m {
+		t.Error("outputs not sorted by name")
+	}
+}
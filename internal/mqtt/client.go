@@ -1,13 +1,16 @@
 package mqtt
 
 import (
-	"crypto/tls"
+	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,10 +19,24 @@ type Client struct {
 	client   mqtt.Client
 	deviceID string
 	logger   *logrus.Logger
+
+	// subscriptions are restored after a reconnect; the session is clean, so
+	// the broker forgets them.
+	subMu         sync.Mutex
+	subscriptions map[string]mqtt.MessageHandler
+
+	tls tlsState
+
+	auth      *credentialState // nil without credentials
+	logFields logrus.Fields    // broker details for the connect log
+	dryRun    bool             // log publishes instead of sending them
 }
 
-// NewClient creates a new MQTT client with support for both WebSocket and standard MQTT protocols
-func NewClient(mqttURL, deviceID string, logger *logrus.Logger) (*Client, error) {
+// NewClient creates a new MQTT client with support for both WebSocket and standard MQTT protocols.
+// creds may be nil, in which case any credentials embedded in mqttURL are used.
+// tlsOpts applies to the secure schemes (mqtts, wss). The client does not
+// connect until Connect is called.
+func NewClient(mqttURL, deviceID string, creds CredentialsProvider, tlsOpts TLSOptions, logger *logrus.Logger) (*Client, error) {
 	// Parse the MQTT URL
 	parsedURL, err := url.Parse(mqttURL)
 	if err != nil {
@@ -32,6 +49,27 @@ func NewClient(mqttURL, deviceID string, logger *logrus.Logger) (*Client, error)
 	// Configure MQTT client options
 	opts := mqtt.NewClientOptions()
 
+	c := &Client{
+		deviceID:      deviceID,
+		logger:        logger,
+		subscriptions: make(map[string]mqtt.MessageHandler),
+	}
+	secure := parsedURL.Scheme == "mqtts" || parsedURL.Scheme == "wss"
+	if secure {
+		tlsCfg, err := tlsOpts.build(parsedURL.Hostname(), &c.tls, func(err error) {
+			logger.WithError(err).Warn("MQTT TLS handshake failed")
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsCfg)
+		if tlsOpts.Insecure {
+			logger.Debug("MQTT broker certificate is not verified")
+		}
+	} else if tlsOpts.CAFile != "" || tlsOpts.CertFile != "" {
+		logger.Warn("MQTT TLS options are ignored for " + parsedURL.Scheme + ":// URLs; use mqtts:// or wss://")
+	}
+
 	// Handle different protocol schemes
 	var brokerURL string
 	switch parsedURL.Scheme {
@@ -42,7 +80,6 @@ func NewClient(mqttURL, deviceID string, logger *logrus.Logger) (*Client, error)
 	case "wss":
 		brokerURL = mqttURL
 		logger.Debug("Using secure WebSocket MQTT connection")
-		opts.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
 	case "mqtt":
 		// Standard MQTT - convert to tcp://
 		brokerURL = strings.Replace(mqttURL, "mqtt://", "tcp://", 1)
@@ -51,8 +88,6 @@ func NewClient(mqttURL, deviceID string, logger *logrus.Logger) (*Client, error)
 		// Secure MQTT - convert to ssl://
 		brokerURL = strings.Replace(mqttURL, "mqtts://", "ssl://", 1)
 		logger.Debug("Using secure MQTT connection (SSL/TLS)")
-		// Disable certificate verification to support self-signed certs
-		opts.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
 	default:
 		return nil, fmt.Errorf("unsupported protocol scheme: %s (supported: ws, wss, mqtt, mqtts)", parsedURL.Scheme)
 	}
@@ -71,16 +106,27 @@ func NewClient(mqttURL, deviceID string, logger *logrus.Logger) (*Client, error)
 	///opts.SetWill(willTopic, "offline", 1, true)
 
 	// Set credentials if provided in URL
-	if parsedURL.User != nil {
-		username := parsedURL.User.Username()
+	if creds == nil && parsedURL.User != nil {
 		password, _ := parsedURL.User.Password()
-		opts.SetUsername(username)
-		opts.SetPassword(password)
+		creds = StaticCredentials{Username: parsedURL.User.Username(), Password: password}
+	}
+
+	// The provider is consulted on every (re)connect so short-lived tokens are
+	// refreshed transparently. paho asks for the credentials once per attempt,
+	// before the connection-attempt handler runs, so attempts are counted in
+	// the provider callback itself.
+	var authState *credentialState
+	if creds != nil {
+		authState = &credentialState{provider: creds, logger: logger}
+		opts.SetCredentialsProvider(authState.get)
 	}
 
 	// Set connection handlers
 	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
 		logger.WithError(err).Warn("MQTT connection lost")
+		if authState != nil {
+			authState.invalidate()
+		}
 	})
 
 	opts.SetReconnectingHandler(func(client mqtt.Client, opts *mqtt.ClientOptions) {
@@ -89,43 +135,106 @@ func NewClient(mqttURL, deviceID string, logger *logrus.Logger) (*Client, error)
 
 	firstConnect := true
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		if authState != nil {
+			authState.connected()
+		}
 		if firstConnect {
 			logger.Debug("MQTT connected")
 			firstConnect = false
 		} else {
 			logger.Info("MQTT reconnected")
 		}
+		// Subscriptions made before the first connect are pending too.
+		c.resubscribe()
 	})
 
 	// Create client
-	client := mqtt.NewClient(opts)
-
-	// Connect to broker
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
-	}
-
-	logger.WithFields(logrus.Fields{
+	c.client = mqtt.NewClient(opts)
+	c.auth = authState
+	c.logFields = logrus.Fields{
 		"broker":    cleanURL(mqttURL),
 		"protocol":  parsedURL.Scheme,
 		"client_id": clientID,
-	}).Info("MQTT client connected")
+	}
+	return c, nil
+}
+
+// Connect connects to the broker, giving up when ctx is done. An auth
+// rejection gets one immediate retry with freshly fetched credentials. Once
+// connected, the client reconnects on its own.
+func (c *Client) Connect(ctx context.Context) error {
+	if c.dryRun || c.client.IsConnected() {
+		return nil
+	}
+	err := c.connectOnce(ctx)
+	if err != nil && c.auth != nil && isAuthError(err) {
+		// The failed attempt makes the next one fetch fresh credentials.
+		c.logger.WithError(err).Warn("MQTT broker rejected credentials; refreshing and retrying")
+		err = c.connectOnce(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+	c.logger.WithFields(c.logFields).Info("MQTT client connected")
+	return nil
+}
 
+func (c *Client) connectOnce(ctx context.Context) error {
+	token := c.client.Connect()
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewDryRunClient returns a client that never connects: every publish is
+// logged at info level instead of sent and subscriptions are accepted but
+// receive nothing. It always reports itself connected.
+func NewDryRunClient(deviceID string, logger *logrus.Logger) *Client {
 	return &Client{
-		client:   client,
-		deviceID: deviceID,
-		logger:   logger,
-	}, nil
+		deviceID:      deviceID,
+		logger:        logger,
+		subscriptions: make(map[string]mqtt.MessageHandler),
+		dryRun:        true,
+	}
 }
 
 // Publish publishes a message to the specified topic
 func (c *Client) Publish(topic string, payload []byte, retained bool) error {
-	qos := byte(1) // At least once delivery
+	return c.PublishContext(context.Background(), topic, payload, retained)
+}
+
+// PublishContext publishes a message with QoS 1 (at least once) and waits
+// for the broker's acknowledgement until ctx is done (and at most 5 s).
+func (c *Client) PublishContext(ctx context.Context, topic string, payload []byte, retained bool) error {
+	return c.PublishQoS(ctx, topic, payload, 1, retained)
+}
+
+// PublishQoS is PublishContext with the given QoS (0, 1 or 2). With QoS 0
+// there is no acknowledgement to wait for.
+func (c *Client) PublishQoS(ctx context.Context, topic string, payload []byte, qos byte, retained bool) error {
+	if c.dryRun {
+		c.logger.WithFields(logrus.Fields{
+			"topic":    topic,
+			"qos":      qos,
+			"retained": retained,
+			"payload":  string(payload),
+		}).Info("MQTT publish (not sent)")
+		return nil
+	}
 	token := c.client.Publish(topic, qos, retained, payload)
 
 	// Avoid potential deadlocks: wait for completion with a timeout instead of indefinitely.
 	const pubTimeout = 5 * time.Second
-	if !token.WaitTimeout(pubTimeout) {
+	timer := time.NewTimer(pubTimeout)
+	defer timer.Stop()
+	select {
+	case <-token.Done():
+	case <-ctx.Done():
+		return fmt.Errorf("publish to topic %s aborted: %w", topic, ctx.Err())
+	case <-timer.C:
 		return fmt.Errorf("publish to topic %s timed out after %s", topic, pubTimeout)
 	}
 	if token.Error() != nil {
@@ -135,14 +244,26 @@ func (c *Client) Publish(topic string, payload []byte, retained bool) error {
 	c.logger.WithFields(logrus.Fields{
 		"topic":    topic,
 		"size":     len(payload),
+		"qos":      qos,
 		"retained": retained,
 	}).Debug("Published MQTT message")
 
 	return nil
 }
 
-// Subscribe subscribes to a topic with a message handler
+// Subscribe subscribes to a topic with a message handler. Before the first
+// connect the subscription is only noted and made once connected.
 func (c *Client) Subscribe(topic string, handler mqtt.MessageHandler) error {
+	if c.dryRun {
+		return nil
+	}
+	if !c.client.IsConnected() {
+		c.subMu.Lock()
+		c.subscriptions[topic] = handler
+		c.subMu.Unlock()
+		c.logger.WithField("topic", topic).Debug("MQTT subscription pending until connected")
+		return nil
+	}
 	qos := byte(1)
 	token := c.client.Subscribe(topic, qos, handler)
 
@@ -155,18 +276,49 @@ func (c *Client) Subscribe(topic string, handler mqtt.MessageHandler) error {
 		return fmt.Errorf("failed to subscribe to topic %s: %w", topic, token.Error())
 	}
 
+	c.subMu.Lock()
+	c.subscriptions[topic] = handler
+	c.subMu.Unlock()
+
 	c.logger.WithField("topic", topic).Debug("Subscribed to MQTT topic")
 	return nil
 }
 
-// IsConnected returns true if the client is connected
+// resubscribe makes every noted subscription, after a (re)connect.
+func (c *Client) resubscribe() {
+	c.subMu.Lock()
+	subs := make(map[string]mqtt.MessageHandler, len(c.subscriptions))
+	for topic, handler := range c.subscriptions {
+		subs[topic] = handler
+	}
+	c.subMu.Unlock()
+
+	for topic, handler := range subs {
+		if err := c.Subscribe(topic, handler); err != nil {
+			c.logger.WithError(err).Warn("Failed to restore MQTT subscription")
+		}
+	}
+}
+
+// IsConnected returns true if the client is connected and the last TLS
+// handshake (if any) succeeded.
 func (c *Client) IsConnected() bool {
-	return c.client.IsConnected()
+	if c.dryRun {
+		return true
+	}
+	return c.client.IsConnected() && c.tls.err() == nil
+}
+
+// TLSError returns why the last TLS handshake failed, or nil.
+func (c *Client) TLSError() error {
+	return c.tls.err()
 }
 
 // Disconnect disconnects the client
 func (c *Client) Disconnect(quiesce uint) {
-	c.client.Disconnect(quiesce)
+	if !c.dryRun {
+		c.client.Disconnect(quiesce)
+	}
 	c.logger.Debug("MQTT client disconnected")
 }
 
@@ -232,3 +384,65 @@ func BuildCleanTopic(parts ...string) string {
 	}
 	return strings.Join(cleanParts, "/")
 }
+
+// isAuthError reports whether err is a CONNACK refusal caused by bad or
+// expired credentials.
+func isAuthError(err error) bool {
+	return errors.Is(err, packets.ErrorRefusedBadUsernameOrPassword) ||
+		errors.Is(err, packets.ErrorRefusedNotAuthorised)
+}
+
+// credentialState glues a CredentialsProvider to paho's synchronous
+// credentials callback and tracks failed attempts so stale tokens get dropped.
+// paho calls get exactly once per connection attempt, so every call that
+// follows an attempt which did not end in connected is a retry.
+type credentialState struct {
+	provider CredentialsProvider
+	logger   *logrus.Logger
+
+	mu       sync.Mutex
+	failed   int    // attempts since the last successful connect
+	lastUser string // last credentials that were fetched successfully
+	lastPass string
+}
+
+func (s *credentialState) get() (string, string) {
+	s.mu.Lock()
+	failed := s.failed
+	s.failed++
+	s.mu.Unlock()
+
+	// Every attempt that follows a failed one forces a refresh: the broker
+	// does not tell the auto-reconnect loop *why* it refused us, and an
+	// expired token is by far the most common cause.
+	if failed > 0 {
+		s.logger.WithField("failed_attempts", failed).Debug("MQTT reconnect after failed attempt; forcing credential refresh")
+		s.provider.Invalidate()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, pass, err := s.provider.Credentials(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		// Fall back to the previous credentials; the broker will tell us if
+		// they are no longer valid and we will try again on the next attempt.
+		s.logger.WithError(err).Warn("MQTT credentials refresh failed; reusing previous credentials")
+		return s.lastUser, s.lastPass
+	}
+	s.lastUser, s.lastPass = user, pass
+	return user, pass
+}
+
+func (s *credentialState) connected() {
+	s.mu.Lock()
+	s.failed = 0
+	s.mu.Unlock()
+}
+
+func (s *credentialState) invalidate() {
+	s.provider.Invalidate()
+}
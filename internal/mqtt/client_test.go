@@ -0,0 +1,219 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/sirupsen/logrus"
+)
+
+// countingProvider hands out a new token after every Invalidate and counts
+// how often it was asked.
+type countingProvider struct {
+	mu          sync.Mutex
+	generation  int
+	fetches     int
+	invalidates int
+}
+
+func (p *countingProvider) Credentials(context.Context) (string, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fetches++
+	return "user", fmt.Sprintf("token-%d", p.generation), nil
+}
+
+func (p *countingProvider) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.invalidates++
+	p.generation++
+}
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestCredentialStateRefreshesAfterFailedAttempt(t *testing.T) {
+	// Each step is one call of paho's credentials callback, i.e. one
+	// connection attempt; connected marks the attempt as successful.
+	type step struct {
+		connected   bool
+		wantPass    string
+		invalidated int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"first attempt uses cached token", []step{
+			{connected: true, wantPass: "token-0"},
+		}},
+		{"retry after failure refreshes", []step{
+			{wantPass: "token-0"},
+			{connected: true, wantPass: "token-1", invalidated: 1},
+		}},
+		{"every failed attempt refreshes", []step{
+			{wantPass: "token-0"},
+			{wantPass: "token-1", invalidated: 1},
+			{connected: true, wantPass: "token-2", invalidated: 2},
+		}},
+		{"success resets the count", []step{
+			{connected: true, wantPass: "token-0"},
+			{connected: true, wantPass: "token-0"},
+			{wantPass: "token-0"},
+			{connected: true, wantPass: "token-1", invalidated: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &countingProvider{}
+			s := &credentialState{provider: p, logger: quietLogger()}
+			for i, st := range tt.steps {
+				_, pass := s.get()
+				if pass != st.wantPass {
+					t.Errorf("attempt %d: password = %q, want %q", i+1, pass, st.wantPass)
+				}
+				if p.invalidates != st.invalidated {
+					t.Errorf("attempt %d: %d invalidations, want %d", i+1, p.invalidates, st.invalidated)
+				}
+				if p.fetches != i+1 {
+					t.Errorf("attempt %d: %d fetches, want one per attempt", i+1, p.fetches)
+				}
+				if st.connected {
+					s.connected()
+				}
+			}
+		})
+	}
+}
+
+// fakeBroker accepts MQTT connections and answers the i-th CONNECT with
+// codes[i] (Accepted once codes runs out). It records the passwords sent.
+// paho retries a refused MQTT 3.1.1 CONNECT as MQTT 3.1 within the same
+// attempt, so those are answered like the CONNECT before and not counted.
+type fakeBroker struct {
+	ln    net.Listener
+	codes []byte
+
+	mu        sync.Mutex
+	passwords []string
+	last      byte
+}
+
+func newFakeBroker(t *testing.T, codes ...byte) *fakeBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{ln: ln, codes: codes}
+	t.Cleanup(func() { ln.Close() })
+	go b.serve()
+	return b
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	pkt, err := packets.ReadPacket(conn)
+	if err != nil {
+		return
+	}
+	connect, ok := pkt.(*packets.ConnectPacket)
+	if !ok {
+		return
+	}
+	b.mu.Lock()
+	code := b.last
+	if connect.ProtocolVersion == 4 {
+		i := len(b.passwords)
+		b.passwords = append(b.passwords, string(connect.Password))
+		code = packets.Accepted
+		if i < len(b.codes) {
+			code = b.codes[i]
+		}
+		b.last = code
+	}
+	b.mu.Unlock()
+
+	ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+	ack.ReturnCode = code
+	if ack.Write(conn) != nil || code != packets.Accepted {
+		return
+	}
+	// Keep the session open until the client disconnects.
+	for {
+		pkt, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		if _, ok := pkt.(*packets.PingreqPacket); ok {
+			packets.NewControlPacket(packets.Pingresp).Write(conn)
+		}
+	}
+}
+
+func (b *fakeBroker) seen() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.passwords...)
+}
+
+func TestConnectRefreshesRejectedCredentials(t *testing.T) {
+	tests := []struct {
+		name          string
+		codes         []byte
+		wantPasswords []string
+		wantErr       bool
+	}{
+		{"accepted", nil, []string{"token-0"}, false},
+		{"bad password", []byte{packets.ErrRefusedBadUsernameOrPassword}, []string{"token-0", "token-1"}, false},
+		{"not authorised", []byte{packets.ErrRefusedNotAuthorised}, []string{"token-0", "token-1"}, false},
+		{"rejected twice", []byte{packets.ErrRefusedBadUsernameOrPassword, packets.ErrRefusedBadUsernameOrPassword}, []string{"token-0", "token-1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newFakeBroker(t, tt.codes...)
+			p := &countingProvider{}
+			c, err := NewClient("mqtt://"+b.ln.Addr().String(), "test", p, TLSOptions{}, quietLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err = c.Connect(ctx)
+			defer c.client.Disconnect(0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Connect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			got := b.seen()
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantPasswords) {
+				t.Errorf("broker saw passwords %v, want %v", got, tt.wantPasswords)
+			}
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.fetches != len(tt.wantPasswords) {
+				t.Errorf("%d credential fetches for %d attempts", p.fetches, len(tt.wantPasswords))
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialsProvider supplies the username/password pair used for every
+// (re)connect to the broker. Brokers with short-lived tokens (e.g. EMQX with
+// JWT auth) need the password to be refreshed regularly, so the client asks the
+// provider again before each connection attempt instead of baking static
+// credentials into the options once at startup.
+//
+// Invalidate is called when the broker rejected the credentials (or dropped the
+// connection) so the next call to Credentials fetches a fresh token instead of
+// returning a cached one.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (username, password string, err error)
+	Invalidate()
+}
+
+// StaticCredentials always returns the same username/password. It is used when
+// credentials are embedded in the MQTT URL.
+type StaticCredentials struct {
+	Username string
+	Password string
+}
+
+// Credentials implements CredentialsProvider.
+func (s StaticCredentials) Credentials(context.Context) (string, string, error) {
+	return s.Username, s.Password, nil
+}
+
+// Invalidate implements CredentialsProvider; static credentials cannot be refreshed.
+func (s StaticCredentials) Invalidate() {}
+
+// FileTokenProvider reads the password (token) from a file on every call. An
+// external helper is expected to keep the file up to date.
+type FileTokenProvider struct {
+	Username string
+	Path     string
+}
+
+// Credentials implements CredentialsProvider.
+func (f *FileTokenProvider) Credentials(context.Context) (string, string, error) {
+	raw, err := os.ReadFile(f.Path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read MQTT token file: %w", err)
+	}
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", "", fmt.Errorf("MQTT token file %s is empty", f.Path)
+	}
+	return f.Username, token, nil
+}
+
+// Invalidate implements CredentialsProvider. The file is re-read on every call
+// so there is nothing cached to drop.
+func (f *FileTokenProvider) Invalidate() {}
+
+// HTTPTokenProvider fetches the password (token) with an HTTP GET against a
+// configurable URL. The response body may either be the raw token or a JSON
+// object containing a "token" (or "access_token") field. Tokens are cached for
+// TTL or until Invalidate is called.
+type HTTPTokenProvider struct {
+	Username   string
+	URL        string
+	TTL        time.Duration
+	HTTPClient *http.Client
+
+	mu        sync.Mutex
+	token     string
+	fetchedAt time.Time
+}
+
+// NewHTTPTokenProvider creates a provider that refreshes its token at least
+// every ttl.
+func NewHTTPTokenProvider(username, tokenURL string, ttl time.Duration) *HTTPTokenProvider {
+	return &HTTPTokenProvider{
+		Username:   username,
+		URL:        tokenURL,
+		TTL:        ttl,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Credentials implements CredentialsProvider.
+func (h *HTTPTokenProvider) Credentials(ctx context.Context) (string, string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.token != "" && (h.TTL <= 0 || time.Since(h.fetchedAt) < h.TTL) {
+		return h.Username, h.token, nil
+	}
+
+	token, err := h.fetch(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	h.token = token
+	h.fetchedAt = time.Now()
+	return h.Username, h.token, nil
+}
+
+// Invalidate implements CredentialsProvider.
+func (h *HTTPTokenProvider) Invalidate() {
+	h.mu.Lock()
+	h.token = ""
+	h.mu.Unlock()
+}
+
+func (h *HTTPTokenProvider) fetch(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	resp, err := h.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read token response: %w", err)
+	}
+	return parseTokenResponse(body)
+}
+
+// parseTokenResponse accepts either a JSON object with a token field or a
+// plain-text token.
+func parseTokenResponse(body []byte) (string, error) {
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "{") {
+		var obj struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.Unmarshal([]byte(trimmed), &obj); err != nil {
+			return "", fmt.Errorf("invalid token JSON: %w", err)
+		}
+		if obj.Token != "" {
+			return obj.Token, nil
+		}
+		if obj.AccessToken != "" {
+			return obj.AccessToken, nil
+		}
+		return "", fmt.Errorf("token JSON has no token field")
+	}
+	if trimmed == "" {
+		return "", fmt.Errorf("token endpoint returned an empty body")
+	}
+	return trimmed, nil
+}
@@ -0,0 +1,109 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// TLSOptions configures mqtts:// and wss:// connections.
+type TLSOptions struct {
+	CAFile   string // PEM bundle the broker certificate is verified against ("" = system roots)
+	CertFile string // PEM client certificate for mutual TLS (requires KeyFile)
+	KeyFile  string // PEM private key of CertFile
+	Insecure bool   // skip verification of the broker certificate
+}
+
+// tlsState remembers the outcome of the last TLS handshake, which paho's
+// reconnect loop otherwise swallows.
+type tlsState struct {
+	mu      sync.Mutex
+	lastErr error
+}
+
+func (s *tlsState) set(err error) (changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed = (err == nil) != (s.lastErr == nil) ||
+		(err != nil && s.lastErr != nil && err.Error() != s.lastErr.Error())
+	s.lastErr = err
+	return changed
+}
+
+func (s *tlsState) err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastErr
+}
+
+// build returns the tls.Config for o. Certificate verification runs in
+// VerifyConnection rather than inside crypto/tls so its outcome can be
+// recorded in state; onFailure is called when a handshake fails
+// verification.
+func (o TLSOptions) build(serverName string, state *tlsState, onFailure func(error)) (*tls.Config, error) {
+	cfg := &tls.Config{
+		// Verified below (unless Insecure) with the same checks crypto/tls
+		// would make.
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	var roots *x509.CertPool
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MQTT CA bundle: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("MQTT CA bundle %s contains no PEM certificates", o.CAFile)
+		}
+	}
+
+	switch {
+	case o.CertFile != "" && o.KeyFile != "":
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load MQTT client certificate %s with key %s: %w", o.CertFile, o.KeyFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	case o.CertFile != "" || o.KeyFile != "":
+		return nil, errors.New("MQTT client certificate and key must be set together")
+	}
+
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if o.Insecure {
+			state.set(nil)
+			return nil
+		}
+		err := verifyPeer(cs, roots, serverName)
+		if state.set(err) && err != nil && onFailure != nil {
+			onFailure(err)
+		}
+		return err
+	}
+	return cfg, nil
+}
+
+// verifyPeer verifies the broker's certificate chain against roots (nil =
+// system roots) and its name against serverName.
+func verifyPeer(cs tls.ConnectionState, roots *x509.CertPool, serverName string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("MQTT broker sent no certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       serverName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+		return fmt.Errorf("MQTT broker certificate rejected: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package sensors
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// lockLocked is the value the door lock sensors (59, 93–96) and
+// RemoteLockStatus (22) report when locked; 1 is unlocked.
+const lockLocked = 2
+
+// Aggregate is a derived on/off sensor built from several member sensors.
+// Members lists the offending ones: the open doors or windows, or the
+// unlocked locks.
+type Aggregate struct {
+	On      bool     `json:"on"`
+	Members []string `json:"members"`
+}
+
+// aggregateMember is one constituent of an aggregate; name is its snake_case
+// sensor key.
+type aggregateMember struct {
+	id    int
+	name  string
+	value *float64
+}
+
+// DeriveAggregates fills in DoorsOpen, WindowsOpen and VehicleLocked:
+//
+//   - doors_open: any of the doors, hood or trunk (81–86) is open.
+//   - windows_open: any window, the sunroof or the sunshade (61–66) is open
+//     more than windowThreshold percent.
+//   - vehicle_locked: every door lock (59, 93–96) and RemoteLockStatus (22)
+//     reports locked.
+//
+// DoorsOpenCount and WindowsOpenCount count the open side doors (81–84) and
+// side windows (61–64) among those members.
+//
+// Only polled members count. An aggregate is left nil (unavailable) when a
+// polled member has no value in data, or none of its members is polled,
+// rather than reporting "all closed" from partial data.
+func DeriveAggregates(data *SensorData, windowThreshold float64) {
+	if data == nil {
+		return
+	}
+	data.DoorsOpen = aggregate([]aggregateMember{
+		{81, "driver_door", data.DriverDoor},
+		{82, "passenger_door", data.PassengerDoor},
+		{83, "left_rear_door", data.LeftRearDoor},
+		{84, "right_rear_door", data.RightRearDoor},
+		{85, "hood", data.Hood},
+		{86, "trunk", data.TrunkDoor},
+	}, func(v float64) bool { return v != 0 })
+	data.WindowsOpen = aggregate([]aggregateMember{
+		{61, "driver_window", data.DriverWindowOpenPercent},
+		{62, "passenger_window", data.PassengerWindowOpenPercent},
+		{63, "left_rear_window", data.LeftRearWindowOpenPercent},
+		{64, "right_rear_window", data.RightRearWindowOpenPercent},
+		{65, "sunroof", data.SunroofOpenPercent},
+		{66, "sunshade", data.SunshadeOpenPercent},
+	}, func(v float64) bool { return v > windowThreshold })
+	data.DoorsOpenCount = countMembers(data.DoorsOpen, "driver_door", "passenger_door", "left_rear_door", "right_rear_door")
+	data.WindowsOpenCount = countMembers(data.WindowsOpen, "driver_window", "passenger_window", "left_rear_window", "right_rear_window")
+
+	locked := aggregate([]aggregateMember{
+		{59, "driver_door_lock", data.DriverDoorLock},
+		{93, "left_rear_door_lock", data.LeftRearDoorLock},
+		{94, "passenger_door_lock", data.PassengerDoorLock},
+		{95, "right_rear_door_lock", data.RightRearDoorLock},
+		{96, "trunk_lock", data.TrunkLock},
+		{22, "remote_lock_status", data.RemoteLockStatus},
+	}, func(v float64) bool { return v != lockLocked })
+	if locked != nil {
+		// aggregate reports whether any lock is unlocked; invert it.
+		locked.On = !locked.On
+	}
+	data.VehicleLocked = locked
+}
+
+// aggregate returns whether any polled member is offending, or nil when a
+// polled member is missing or none is polled.
+func aggregate(members []aggregateMember, offending func(float64) bool) *Aggregate {
+	polled := PollSensorIDs()
+	a := &Aggregate{Members: []string{}}
+	seen := false
+	for _, m := range members {
+		if !slices.Contains(polled, m.id) {
+			continue
+		}
+		if m.value == nil {
+			return nil
+		}
+		seen = true
+		if offending(*m.value) {
+			a.On = true
+			a.Members = append(a.Members, m.name)
+		}
+	}
+	if !seen {
+		return nil
+	}
+	return a
+}
+
+// countMembers returns how many of names are offending members of a, or nil
+// when a is.
+func countMembers(a *Aggregate, names ...string) *float64 {
+	if a == nil {
+		return nil
+	}
+	n := 0.0
+	for _, m := range a.Members {
+		if slices.Contains(names, m) {
+			n++
+		}
+	}
+	return &n
+}
+
+// tireWarmUp is how long a drive must have lasted before tire pressures are
+// compared with each other: cold tires on the sunny side of the car read
+// noticeably higher than the others.
+const tireWarmUp = 10 * time.Minute
+
+// DeriveTirePressure fills in TirePressureImbalance, the spread between the
+// highest and lowest of the four tire pressures (53–56) in bar, and
+// TirePressureWarning, which lists the tires below minBar or, after
+// tireWarmUp of driving (see CurrentTrip), more than maxDeviationPct percent
+// off the mean of all four. 0 disables either rule. Both stay nil unless all
+// polled tire sensors have a value.
+func DeriveTirePressure(data *SensorData, minBar, maxDeviationPct float64) {
+	if data == nil {
+		return
+	}
+	tires := []aggregateMember{
+		{53, "left_front", data.LeftFrontTirePressure},
+		{54, "right_front", data.RightFrontTirePressure},
+		{55, "left_rear", data.LeftRearTirePressure},
+		{56, "right_rear", data.RightRearTirePressure},
+	}
+	var sum, lo, hi float64
+	n := 0
+	for _, t := range tires {
+		if t.value == nil {
+			continue
+		}
+		v := *t.value
+		if n == 0 || v < lo {
+			lo = v
+		}
+		if n == 0 || v > hi {
+			hi = v
+		}
+		sum += v
+		n++
+	}
+	data.TirePressureImbalance = nil
+	if n == len(tires) {
+		spread := hi - lo
+		data.TirePressureImbalance = &spread
+	}
+
+	warm := data.CurrentTrip != nil && data.CurrentTrip.DurationMin >= tireWarmUp.Minutes()
+	mean := 0.0
+	if n > 0 {
+		mean = sum / float64(n)
+	}
+	data.TirePressureWarning = aggregate(tires, func(v float64) bool {
+		if minBar > 0 && v < minBar {
+			return true
+		}
+		return warm && maxDeviationPct > 0 && mean > 0 && math.Abs(v-mean)/mean*100 > maxDeviationPct
+	})
+}
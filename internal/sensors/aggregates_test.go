@@ -0,0 +1,82 @@
+package sensors
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDeriveAggregates(t *testing.T) {
+	closed := func() *SensorData {
+		return &SensorData{
+			DriverDoor: ptr(0), PassengerDoor: ptr(0), LeftRearDoor: ptr(0), RightRearDoor: ptr(0),
+			Hood: ptr(0), TrunkDoor: ptr(0),
+			DriverWindowOpenPercent: ptr(0), PassengerWindowOpenPercent: ptr(0),
+			LeftRearWindowOpenPercent: ptr(0), RightRearWindowOpenPercent: ptr(0),
+			SunroofOpenPercent: ptr(0), SunshadeOpenPercent: ptr(0),
+			DriverDoorLock: ptr(2), LeftRearDoorLock: ptr(2), PassengerDoorLock: ptr(2),
+			RightRearDoorLock: ptr(2), TrunkLock: ptr(2), RemoteLockStatus: ptr(2),
+		}
+	}
+	format := func(a *Aggregate) string {
+		if a == nil {
+			return "unavailable"
+		}
+		return fmt.Sprint(a.On, " ", a.Members)
+	}
+
+	tests := []struct {
+		name      string
+		sensorIDs string // BYD_HASS_SENSOR_IDS; "" = defaults
+		change    func(d *SensorData)
+		// "doors | windows | locked"
+		want string
+	}{
+		{
+			name: "all closed and locked",
+			want: "false [] | false [] | true []",
+		},
+		{
+			name: "open doors and an unlocked trunk",
+			change: func(d *SensorData) {
+				d.DriverDoor, d.TrunkDoor, d.TrunkLock = ptr(1), ptr(1), ptr(1)
+			},
+			want: "true [driver_door trunk] | false [] | false [trunk_lock]",
+		},
+		{
+			name: "window threshold",
+			change: func(d *SensorData) {
+				d.DriverWindowOpenPercent, d.SunroofOpenPercent = ptr(5), ptr(30)
+			},
+			want: "false [] | true [sunroof] | true []",
+		},
+		{
+			name:   "missing member",
+			change: func(d *SensorData) { d.Hood, d.RemoteLockStatus = nil, nil },
+			want:   "unavailable | false [] | unavailable",
+		},
+		{
+			name:      "unpolled members do not count",
+			sensorIDs: "33,81,61",
+			change: func(d *SensorData) {
+				d.Hood, d.PassengerDoor, d.SunroofOpenPercent = nil, ptr(1), ptr(100)
+			},
+			want: "false [] | false [] | unavailable",
+		},
+	}
+	defer SetMonitoredSensors(GetMonitoredSensors())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BYD_HASS_SENSOR_IDS", tt.sensorIDs)
+			SetMonitoredSensors(loadMonitoredSensorsFromEnv())
+			data := closed()
+			if tt.change != nil {
+				tt.change(data)
+			}
+			DeriveAggregates(data, 5)
+			got := format(data.DoorsOpen) + " | " + format(data.WindowsOpen) + " | " + format(data.VehicleLocked)
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
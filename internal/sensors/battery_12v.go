@@ -0,0 +1,155 @@
+package sensors
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// battery12VConfirmSamples is how many consecutive parked readings below
+	// the threshold trip the low warning; one sag while a door module wakes
+	// up does not.
+	battery12VConfirmSamples = 3
+	// battery12VHysteresis is how far above the threshold (V) the voltage
+	// has to recover to clear the warning.
+	battery12VHysteresis = 0.2
+	// battery12VTrendDays is how many days of parked minimums the trend
+	// covers, and battery12VMinTrendDays the least it needs.
+	battery12VTrendDays    = 7
+	battery12VMinTrendDays = 3
+)
+
+// Battery12VTracker watches the 12V auxiliary battery (BatteryVoltage12V,
+// 39) while the car is off (PowerStatus, 1, is 0); with the car on, the
+// DC-DC converter charging it masks its state. Readings of 0, which some
+// models report all the time, are ignored.
+//
+// Low trips after battery12VConfirmSamples consecutive parked readings below
+// the threshold and clears once the voltage is back above the threshold plus
+// battery12VHysteresis; it keeps its value while the car is on. Trend is the
+// least-squares slope (V/day) of the lowest parked voltage of each of the
+// last battery12VTrendDays days, nil until battery12VMinTrendDays days were
+// seen. A battery that keeps losing charge shows a steadily negative trend
+// well before the car fails to start.
+type Battery12VTracker struct {
+	threshold float64
+	loc       *time.Location
+
+	mu       sync.Mutex
+	low      *bool
+	lowCount int
+	days     []Battery12VDay
+}
+
+// Battery12VDay is the lowest parked 12V reading of one day.
+type Battery12VDay struct {
+	Day     time.Time `json:"day"` // local midnight
+	MinVolt float64   `json:"min_volt"`
+}
+
+// NewBattery12VTracker creates a tracker that warns below threshold volts,
+// with day boundaries in loc (nil = the collector's own time zone).
+func NewBattery12VTracker(threshold float64, loc *time.Location) *Battery12VTracker {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &Battery12VTracker{threshold: threshold, loc: loc}
+}
+
+// Update feeds one sample and returns the low warning and the trend; either
+// is nil while unknown.
+func (t *Battery12VTracker) Update(data *SensorData) (low *bool, trend *float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parked := data != nil && data.PowerStatus != nil && *data.PowerStatus == 0
+	if parked && data.BatteryVoltage12V != nil && *data.BatteryVoltage12V > 0 {
+		v := *data.BatteryVoltage12V
+		now := data.Timestamp
+		if now.IsZero() {
+			now = time.Now()
+		}
+		t.observe(v, now)
+	}
+	return t.result()
+}
+
+func (t *Battery12VTracker) observe(v float64, now time.Time) {
+	switch {
+	case v < t.threshold:
+		t.lowCount++
+		if t.lowCount >= battery12VConfirmSamples {
+			low := true
+			t.low = &low
+		}
+	case v >= t.threshold+battery12VHysteresis:
+		t.lowCount = 0
+		low := false
+		t.low = &low
+	default:
+		// In the hysteresis band: keep the current state.
+		t.lowCount = 0
+		if t.low == nil {
+			low := false
+			t.low = &low
+		}
+	}
+
+	y, m, d := now.In(t.loc).Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, t.loc)
+	if n := len(t.days); n > 0 && t.days[n-1].Day.Equal(day) {
+		t.days[n-1].MinVolt = min(t.days[n-1].MinVolt, v)
+	} else {
+		t.days = append(t.days, Battery12VDay{Day: day, MinVolt: v})
+	}
+	for len(t.days) > 0 && day.Sub(t.days[0].Day) >= battery12VTrendDays*24*time.Hour {
+		t.days = t.days[1:]
+	}
+}
+
+func (t *Battery12VTracker) result() (*bool, *float64) {
+	var low *bool
+	if t.low != nil {
+		v := *t.low
+		low = &v
+	}
+	if len(t.days) < battery12VMinTrendDays {
+		return low, nil
+	}
+	// Least-squares slope of MinVolt over days since the first entry.
+	first := t.days[0].Day
+	var sx, sy, sxx, sxy float64
+	for _, d := range t.days {
+		x := d.Day.Sub(first).Hours() / 24
+		sx += x
+		sy += d.MinVolt
+		sxx += x * x
+		sxy += x * d.MinVolt
+	}
+	n := float64(len(t.days))
+	denom := n*sxx - sx*sx
+	if denom == 0 {
+		return low, nil
+	}
+	slope := (n*sxy - sx*sy) / denom
+	return low, &slope
+}
+
+// Export returns the daily minimums behind the trend.
+func (t *Battery12VTracker) Export() []Battery12VDay {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Battery12VDay(nil), t.days...)
+}
+
+// Restore replaces the daily minimums with days; days that have aged out are
+// dropped by the next Update.
+func (t *Battery12VTracker) Restore(days []Battery12VDay) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.days = t.days[:0]
+	for _, d := range days {
+		d.Day = d.Day.In(t.loc)
+		t.days = append(t.days, d)
+	}
+}
@@ -0,0 +1,196 @@
+package sensors
+
+import (
+	"sync"
+	"time"
+)
+
+// Battery thermal state enum values.
+const (
+	BatteryThermalHeating = "heating"
+	BatteryThermalCooling = "cooling"
+	BatteryThermalIdle    = "idle"
+	BatteryThermalUnknown = "unknown"
+)
+
+// BatteryThermalStates lists the states BatteryThermalTracker reports while
+// it can tell; BatteryThermalUnknown is published as a missing value.
+var BatteryThermalStates = []string{BatteryThermalIdle, BatteryThermalHeating, BatteryThermalCooling}
+
+const (
+	// thermalTrendWindow is how far back the pack temperature trend looks,
+	// and thermalMinSpan the least history it needs.
+	thermalTrendWindow = 15 * time.Minute
+	thermalMinSpan     = 3 * time.Minute
+	// thermalRatePerHour is the AvgBatteryTemp trend (°C/h) that counts as
+	// active heating or cooling; a state is left again once the trend drops
+	// below half of it. Passive drift of a parked pack is well below that.
+	thermalRatePerHour = 3.0
+	// thermalParkedLoadKW is the least EnginePower draw of a parked car for a
+	// temperature trend to be put down to the heater or cooler.
+	thermalParkedLoadKW = 1.0
+	// thermalHeatBelow is the pack temperature (°C) under which a rising
+	// temperature while charging is put down to the heater rather than the
+	// charge current.
+	thermalHeatBelow = 20.0
+	// thermalConfirmSamples is how many consecutive samples a new state
+	// needs before it is reported.
+	thermalConfirmSamples = 2
+)
+
+// BatteryTempSpread returns MaxBatteryTemp (14) minus MinBatteryTemp (16), or
+// nil when either is missing.
+func BatteryTempSpread(data *SensorData) *float64 {
+	if data == nil || data.MaxBatteryTemp == nil || data.MinBatteryTemp == nil {
+		return nil
+	}
+	spread := *data.MaxBatteryTemp - *data.MinBatteryTemp
+	return &spread
+}
+
+// HasBatteryTemps reports whether data carries all three pack temperatures
+// (14–16).
+func HasBatteryTemps(data *SensorData) bool {
+	return data != nil && data.MaxBatteryTemp != nil && data.AvgBatteryTemp != nil && data.MinBatteryTemp != nil
+}
+
+// BatteryThermalTracker guesses whether the pack heater or cooler is running
+// from the AvgBatteryTemp (15) trend over thermalTrendWindow, combined with
+// the power draw (EnginePower, 10) while parked or the charging state:
+//
+//   - parked, drawing at least thermalParkedLoadKW: a rising pack is being
+//     heated, a falling one cooled;
+//   - charging: a rising pack below thermalHeatBelow is being heated, and a
+//     falling one is being cooled, as charging alone warms it.
+//
+// Anything else is idle. While driving the traction load masks the thermal
+// management, so the state is unknown, as it is when any of the three pack
+// temperatures (14–16) is missing or stale. Changes need
+// thermalConfirmSamples consecutive samples, and a state is held until the
+// trend falls below half the rate that started it, so it does not flicker.
+type BatteryThermalTracker struct {
+	staleAfter time.Duration
+
+	mu           sync.Mutex
+	samples      []thermalSample
+	lastRead     time.Time
+	state        string
+	pending      string
+	pendingCount int
+}
+
+type thermalSample struct {
+	at   time.Time
+	temp float64
+}
+
+// NewBatteryThermalTracker creates a tracker that reports unknown once the
+// pack temperatures were last read more than staleAfter ago.
+func NewBatteryThermalTracker(staleAfter time.Duration) *BatteryThermalTracker {
+	return &BatteryThermalTracker{staleAfter: staleAfter, state: BatteryThermalUnknown}
+}
+
+// Update feeds one processed sample (DrivingState and Charging already set)
+// and returns the state. read reports whether the pack temperatures in data
+// were read in this poll, rather than held (see ValueHolder) or carried over
+// from the last full poll by a fast poll; only read samples extend the trend.
+func (t *BatteryThermalTracker) Update(data *SensorData, read bool) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !HasBatteryTemps(data) {
+		return t.reset()
+	}
+	if data.DrivingState != nil && *data.DrivingState == DrivingStateDriving {
+		// Also keeps the heat of the drive out of the next trend.
+		return t.reset()
+	}
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if !read {
+		if t.lastRead.IsZero() || now.Sub(t.lastRead) > t.staleAfter {
+			return t.reset()
+		}
+		return t.state
+	}
+	t.lastRead = now
+	t.samples = append(t.samples, thermalSample{at: now, temp: *data.AvgBatteryTemp})
+	i := 0
+	for i < len(t.samples)-1 && now.Sub(t.samples[i+1].at) >= thermalTrendWindow {
+		i++
+	}
+	t.samples = t.samples[i:]
+
+	raw := t.classify(data, now)
+	switch {
+	case raw == t.state:
+		t.pending, t.pendingCount = "", 0
+	case t.state == BatteryThermalUnknown:
+		t.state = raw
+		t.pending, t.pendingCount = "", 0
+	default:
+		if raw != t.pending {
+			t.pending, t.pendingCount = raw, 0
+		}
+		t.pendingCount++
+		if t.pendingCount >= thermalConfirmSamples {
+			t.state = raw
+			t.pending, t.pendingCount = "", 0
+		}
+	}
+	return t.state
+}
+
+// classify returns the undebounced state of the latest sample.
+func (t *BatteryThermalTracker) classify(data *SensorData, now time.Time) string {
+	first := t.samples[0]
+	span := now.Sub(first.at)
+	if span < thermalMinSpan {
+		if t.state == BatteryThermalUnknown {
+			return BatteryThermalIdle
+		}
+		return t.state
+	}
+	avg := *data.AvgBatteryTemp
+	rate := (avg - first.temp) / span.Hours()
+
+	// Thresholds for entering a state; staying in one needs only half.
+	heatRate, coolRate := thermalRatePerHour, thermalRatePerHour
+	switch t.state {
+	case BatteryThermalHeating:
+		heatRate /= 2
+	case BatteryThermalCooling:
+		coolRate /= 2
+	}
+
+	if data.Charging != nil && data.Charging.Charging {
+		switch {
+		case rate >= heatRate && avg < thermalHeatBelow:
+			return BatteryThermalHeating
+		case rate <= -coolRate:
+			return BatteryThermalCooling
+		}
+		return BatteryThermalIdle
+	}
+	if data.EnginePower == nil || *data.EnginePower < thermalParkedLoadKW {
+		return BatteryThermalIdle
+	}
+	switch {
+	case rate >= heatRate:
+		return BatteryThermalHeating
+	case rate <= -coolRate:
+		return BatteryThermalCooling
+	}
+	return BatteryThermalIdle
+}
+
+// reset forgets the trend and reports unknown.
+func (t *BatteryThermalTracker) reset() string {
+	t.samples = t.samples[:0]
+	t.lastRead = time.Time{}
+	t.state = BatteryThermalUnknown
+	t.pending, t.pendingCount = "", 0
+	return t.state
+}
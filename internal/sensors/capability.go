@@ -0,0 +1,95 @@
+package sensors
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Capabilities records which sensors a car answers: different BYD models
+// expose different subsets (no fuel sensors on a pure EV, no sunroof on most).
+// It is detected by polling every sensor of AllSensors once.
+type Capabilities struct {
+	DetectedAt time.Time `json:"detected_at"`
+	Supported  []int     `json:"supported"`
+}
+
+// DetectCapabilities returns the capabilities shown by data, a response to a
+// request for every sensor of AllSensors: a sensor is supported if it
+// returned a value.
+func DetectCapabilities(data *SensorData, at time.Time) Capabilities {
+	c := Capabilities{DetectedAt: at}
+	if data == nil {
+		return c
+	}
+	v := reflect.ValueOf(data).Elem()
+	for _, def := range AllSensors {
+		field := v.FieldByName(def.FieldName)
+		if field.IsValid() && field.Kind() == reflect.Ptr && !field.IsNil() {
+			c.Supported = append(c.Supported, def.ID)
+		}
+	}
+	return c
+}
+
+// Unsupported returns the IDs of AllSensors missing from c.Supported.
+func (c Capabilities) Unsupported() []int {
+	var ids []int
+	for _, def := range AllSensors {
+		if !slices.Contains(c.Supported, def.ID) {
+			ids = append(ids, def.ID)
+		}
+	}
+	return ids
+}
+
+// supportedSensors is the capability map installed by SetSupportedSensors,
+// forced IDs included; nil until the car was probed. It only trims the
+// default sensor list: sensors named in BYD_HASS_SENSOR_IDS are always
+// polled. Guarded by monitoredMu.
+var supportedSensors map[int]bool
+
+// SetSupportedSensors installs c as the capability map: while the default
+// sensor list is in use, GetMonitoredSensors leaves out the sensors the car
+// did not answer, except those in force. It returns the default sensors left
+// out.
+func SetSupportedSensors(c Capabilities, force []int) (excluded []int) {
+	supported := make(map[int]bool, len(c.Supported)+len(force))
+	for _, id := range c.Supported {
+		supported[id] = true
+	}
+	for _, id := range force {
+		supported[id] = true
+	}
+
+	monitoredMu.Lock()
+	defer monitoredMu.Unlock()
+	supportedSensors = supported
+	for _, s := range defaultMonitoredSensors {
+		if !supported[s.ID] {
+			excluded = append(excluded, s.ID)
+		}
+	}
+	return excluded
+}
+
+// ParseSensorIDList parses a comma-separated list of sensor IDs, e.g. the
+// -sensor-force setting. Every ID must be known.
+func ParseSensorIDList(raw string) ([]int, error) {
+	var ids []int
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, err := strconv.Atoi(entry)
+		if err != nil || GetSensorByID(id) == nil {
+			return nil, fmt.Errorf("unknown sensor ID %q", entry)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,82 @@
+package sensors
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDetectCapabilities(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := DetectCapabilities(&SensorData{Speed: ptr(0), BatteryPercentage: ptr(80), Mileage: ptr(1000)}, at)
+	if fmt.Sprint(c.Supported) != "[2 3 33]" || !c.DetectedAt.Equal(at) {
+		t.Errorf("DetectCapabilities = %+v, want sensors [2 3 33] at %s", c, at)
+	}
+	unsupported := c.Unsupported()
+	if len(unsupported) != len(AllSensors)-3 || slices.Contains(unsupported, 33) {
+		t.Errorf("Unsupported() has %d sensors (33 included: %v), want %d", len(unsupported), slices.Contains(unsupported, 33), len(AllSensors)-3)
+	}
+	if c := DetectCapabilities(nil, at); len(c.Supported) != 0 {
+		t.Errorf("DetectCapabilities(nil) = %v, want none supported", c.Supported)
+	}
+}
+
+func TestSetSupportedSensors(t *testing.T) {
+	tests := []struct {
+		name      string
+		sensorIDs string // BYD_HASS_SENSOR_IDS
+		force     []int
+		wantPoll  string
+	}{
+		{"defaults trimmed", "", nil, "[2 33]"},
+		{"forced sensor kept", "", []int{81}, "[2 33 81]"},
+		{"explicit list untouched", "2,33,61,81", nil, "[2 33 61 81]"},
+	}
+	defer func() {
+		monitoredMu.Lock()
+		supportedSensors = nil
+		monitoredMu.Unlock()
+		LoadConfig(func(string) string { return "" })
+	}()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			LoadConfig(func(key string) string {
+				if key == "BYD_HASS_SENSOR_IDS" {
+					return tt.sensorIDs
+				}
+				return ""
+			})
+			excluded := SetSupportedSensors(Capabilities{Supported: []int{2, 33}}, tt.force)
+			if got := PollSensorIDs(); fmt.Sprint(got) != tt.wantPoll {
+				t.Errorf("PollSensorIDs() = %v, want %s", got, tt.wantPoll)
+			}
+			if len(excluded) == 0 || slices.Contains(excluded, 33) || slices.ContainsFunc(tt.force, func(id int) bool { return slices.Contains(excluded, id) }) {
+				t.Errorf("excluded %v, want the unsupported default sensors", excluded)
+			}
+		})
+	}
+}
+
+func TestParseSensorIDList(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "", want: "[]"},
+		{raw: "81, 82,", want: "[81 82]"},
+		{raw: "81,x", wantErr: true},
+		{raw: "9999", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSensorIDList(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSensorIDList(%q) err = %v, want error %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && fmt.Sprint(got) != tt.want {
+			t.Errorf("ParseSensorIDList(%q) = %v, want %s", tt.raw, got, tt.want)
+		}
+	}
+}
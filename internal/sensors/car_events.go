@@ -0,0 +1,209 @@
+package sensors
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Car event types reported by CarEventTracker.
+const (
+	EventPlugged           = "plugged"
+	EventUnplugged         = "unplugged"
+	EventChargingStarted   = "charging_started"
+	EventChargingStopped   = "charging_stopped"
+	EventChargingCompleted = "charging_completed"
+	EventDoorLeftOpen      = "door_left_open"
+	EventSentryTriggered   = "sentry_triggered"
+)
+
+// CarEventTypes lists every event type CarEventTracker may report.
+var CarEventTypes = []string{
+	EventPlugged, EventUnplugged,
+	EventChargingStarted, EventChargingStopped, EventChargingCompleted,
+	EventDoorLeftOpen, EventSentryTriggered,
+}
+
+// gunConfirmSamples is how many consecutive samples a new ChargeGunState
+// needs before a plug event fires.
+const gunConfirmSamples = 2
+
+// CarEvent is a discrete happening; Attrs carries the values relevant to it,
+// e.g. the SoC at plug-in or the door left open.
+type CarEvent struct {
+	Type  string
+	Time  time.Time
+	Attrs map[string]interface{}
+}
+
+// CarEventTracker turns state changes into edge-triggered events:
+//
+//   - plugged / unplugged: ChargeGunState (12) changed, confirmed by
+//     gunConfirmSamples consecutive samples;
+//   - charging_started / charging_stopped / charging_completed: the
+//     debounced Charging state changed. A session ending with the gun still
+//     connected (power dropped to zero while plugged) is completed, one ended
+//     by unplugging is stopped;
+//   - door_left_open: a member of DoorsOpen stayed open for doorOpenAfter
+//     while VehicleLocked was on, once per time it was opened (0 disables);
+//   - sentry_triggered: LastSentryTriggerTime (2003) moved forward.
+//
+// The first sample only records the state, so a restart does not replay
+// events.
+type CarEventTracker struct {
+	doorOpenAfter time.Duration
+
+	mu           sync.Mutex
+	primed       bool
+	gun          bool
+	gunPending   int
+	charging     bool
+	chargeSOC    *float64
+	doorOpenAt   map[string]time.Time
+	doorReported map[string]bool
+	sentryKnown  bool // LastSentryTriggerTime was read, even if never set
+	sentryAt     time.Time
+}
+
+// NewCarEventTracker creates a tracker that reports a door left open once it
+// has been open for doorOpenAfter with the car locked.
+func NewCarEventTracker(doorOpenAfter time.Duration) *CarEventTracker {
+	return &CarEventTracker{
+		doorOpenAfter: doorOpenAfter,
+		doorOpenAt:    make(map[string]time.Time),
+		doorReported:  make(map[string]bool),
+	}
+}
+
+// Update feeds one processed sample (Charging, DoorsOpen, VehicleLocked and
+// EventTimes already set) and returns the events it triggered, oldest first.
+func (t *CarEventTracker) Update(data *SensorData) []CarEvent {
+	if data == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	gun := data.ChargeGunState != nil && *data.ChargeGunState == 2
+	charging := data.Charging != nil && data.Charging.Charging
+	sentryAt := data.EventTimes["last_sentry_trigger_time"]
+
+	if !t.primed {
+		t.primed = true
+		t.gun, t.charging = gun, charging
+		t.sentryKnown, t.sentryAt = data.LastSentryTriggerTime != nil, sentryAt
+		if charging {
+			t.chargeSOC = copyFloat(data.BatteryPercentage)
+		}
+		return nil
+	}
+
+	var events []CarEvent
+	emit := func(eventType string, attrs map[string]interface{}) {
+		events = append(events, CarEvent{Type: eventType, Time: now, Attrs: attrs})
+	}
+	soc := func() map[string]interface{} {
+		attrs := map[string]interface{}{}
+		if data.BatteryPercentage != nil {
+			attrs["soc"] = *data.BatteryPercentage
+		}
+		return attrs
+	}
+
+	// Only a known gun state counts; a missing reading keeps the last one.
+	if data.ChargeGunState != nil && gun != t.gun {
+		t.gunPending++
+		if t.gunPending >= gunConfirmSamples {
+			t.gun, t.gunPending = gun, 0
+			if gun {
+				emit(EventPlugged, soc())
+			} else {
+				emit(EventUnplugged, soc())
+			}
+		}
+	} else {
+		t.gunPending = 0
+	}
+
+	if charging != t.charging {
+		t.charging = charging
+		attrs := soc()
+		if charging {
+			attrs["dcfc"] = data.Charging.DCFC
+			t.chargeSOC = copyFloat(data.BatteryPercentage)
+			emit(EventChargingStarted, attrs)
+		} else {
+			if t.chargeSOC != nil && data.BatteryPercentage != nil {
+				attrs["soc_gained"] = *data.BatteryPercentage - *t.chargeSOC
+			}
+			t.chargeSOC = nil
+			if gun {
+				emit(EventChargingCompleted, attrs)
+			} else {
+				emit(EventChargingStopped, attrs)
+			}
+		}
+	}
+
+	t.updateDoors(data, now, emit)
+
+	if sentryAt.After(t.sentryAt) {
+		attrs := map[string]interface{}{"triggered_at": sentryAt.Format(time.RFC3339)}
+		if data.LastSentryTriggerImage != nil {
+			attrs["image"] = *data.LastSentryTriggerImage
+		}
+		if t.sentryKnown {
+			emit(EventSentryTriggered, attrs)
+		}
+		t.sentryAt = sentryAt
+	}
+	if data.LastSentryTriggerTime != nil {
+		t.sentryKnown = true
+	}
+	return events
+}
+
+// updateDoors tracks how long each door has been open while locked.
+func (t *CarEventTracker) updateDoors(data *SensorData, now time.Time, emit func(string, map[string]interface{})) {
+	if t.doorOpenAfter <= 0 || data.DoorsOpen == nil {
+		return // unknown: keep the timers running
+	}
+	open := make(map[string]bool, len(data.DoorsOpen.Members))
+	for _, door := range data.DoorsOpen.Members {
+		open[door] = true
+	}
+	for door := range t.doorOpenAt {
+		if !open[door] {
+			delete(t.doorOpenAt, door)
+			delete(t.doorReported, door)
+		}
+	}
+	locked := data.VehicleLocked != nil && data.VehicleLocked.On
+	for _, door := range data.DoorsOpen.Members {
+		since, ok := t.doorOpenAt[door]
+		if !ok || !locked {
+			// The clock starts once the door is open and the car locked.
+			t.doorOpenAt[door] = now
+			continue
+		}
+		if !t.doorReported[door] && now.Sub(since) >= t.doorOpenAfter {
+			t.doorReported[door] = true
+			emit(EventDoorLeftOpen, map[string]interface{}{
+				"door":         door,
+				"open_minutes": math.Round(now.Sub(since).Minutes()*10) / 10,
+			})
+		}
+	}
+}
+
+func copyFloat(v *float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
@@ -0,0 +1,265 @@
+package sensors
+
+import (
+	"sync"
+	"time"
+)
+
+// chargeReseatGrace is how long the gun may be unplugged before the session
+// ends, so re-seating the plug doesn't split a session in two.
+const chargeReseatGrace = 2 * time.Minute
+
+// ChargeSession summarises one plug-in of the charge gun.
+type ChargeSession struct {
+	Start           time.Time  `json:"start"`
+	End             *time.Time `json:"end,omitempty"` // nil while the session is ongoing
+	Active          bool       `json:"active"`
+	DurationMin     float64    `json:"duration_min"` // plug-in to unplug (or the latest sample)
+	StartSOC        float64    `json:"start_soc"`
+	EndSOC          float64    `json:"end_soc"`
+	SOCGained       float64    `json:"soc_gained"`
+	EnergyKWh       float64    `json:"energy_kwh"`    // SOC gained × battery capacity
+	MeteredKWh      float64    `json:"metered_kwh"`   // integrated charge power
+	AvgPowerKW      float64    `json:"avg_power_kw"`  // metered (or, failing that, SOC) energy over the duration
+	PeakPowerKW     float64    `json:"peak_power_kw"` // highest charge power seen (positive)
+	DCFC            bool       `json:"dcfc"`          // DC fast charge vs AC
+	CapacityKWh     float64    `json:"capacity_kwh,omitempty"`
+	StartOdometerKM *float64   `json:"start_odometer_km,omitempty"`
+	EndOdometerKM   *float64   `json:"end_odometer_km,omitempty"`
+}
+
+// AddedKWh is the best figure for the energy added: the metered energy when
+// power was reported, the SOC-based estimate otherwise.
+func (s *ChargeSession) AddedKWh() float64 {
+	if s.MeteredKWh > 0 {
+		return s.MeteredKWh
+	}
+	return s.EnergyKWh
+}
+
+// ChargeSessionTracker opens a session when the charge gun connects
+// (ChargeGunState == 2) and closes it once the gun has been disconnected for
+// chargeReseatGrace. A plug-in during which charging never started is
+// dropped rather than reported as an empty session.
+//
+// Charging is taken from the debounced SensorData.Charging when present and
+// from ChargingStatus (52) / EnginePower (10) otherwise. Charge power is
+// normally negative EnginePower; head-units that report it as positive are
+// handled while ChargingStatus says the car is charging and it is not moving.
+// A session counts as DCFC if the tracker state said so or peak power
+// exceeded dcfcThresholdKW.
+type ChargeSessionTracker struct {
+	dcfcThresholdKW float64
+
+	mu          sync.Mutex
+	current     *ChargeSession
+	charged     bool      // charging observed in the current session
+	lastAt      time.Time // timestamp of the previous sample, for power integration
+	lastKW      float64
+	unpluggedAt time.Time // when the gun was disconnected during the current session
+	last        *ChargeSession
+	capacity    float64
+}
+
+// NewChargeSessionTracker creates a tracker using dcfcThresholdKW for the
+// DC/AC classification.
+func NewChargeSessionTracker(dcfcThresholdKW float64) *ChargeSessionTracker {
+	return &ChargeSessionTracker{dcfcThresholdKW: dcfcThresholdKW}
+}
+
+// Update feeds one sample into the tracker. It returns the session that was
+// closed by this sample, if any.
+func (t *ChargeSessionTracker) Update(data *SensorData) *ChargeSession {
+	if data == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if data.BatteryCapacity != nil && *data.BatteryCapacity > 0 {
+		t.capacity = *data.BatteryCapacity
+	}
+
+	gunConnected := data.ChargeGunState != nil && *data.ChargeGunState == 2
+
+	if !gunConnected {
+		if t.current == nil {
+			return nil
+		}
+		if t.unpluggedAt.IsZero() {
+			t.unpluggedAt = now
+			t.lastAt = time.Time{} // nothing flows while unplugged
+		}
+		if now.Sub(t.unpluggedAt) < chargeReseatGrace {
+			return nil
+		}
+		return t.close(t.unpluggedAt)
+	}
+	t.unpluggedAt = time.Time{}
+
+	if t.current == nil {
+		t.current = &ChargeSession{Start: now, Active: true}
+		if data.BatteryPercentage != nil {
+			t.current.StartSOC = *data.BatteryPercentage
+			t.current.EndSOC = *data.BatteryPercentage
+		}
+		if data.Mileage != nil {
+			odo := *data.Mileage
+			t.current.StartOdometerKM = &odo
+		}
+		t.charged = false
+		t.lastAt = time.Time{}
+	}
+	s := t.current
+
+	chargeKW := 0.0
+	if p := data.EnginePower; p != nil {
+		switch {
+		case *p < 0:
+			chargeKW = -*p
+		case *p > 0 && data.ChargingStatus != nil && *data.ChargingStatus != 0 &&
+			(data.Speed == nil || *data.Speed == 0):
+			chargeKW = *p
+		}
+	}
+
+	var charging bool
+	if data.Charging != nil {
+		charging = data.Charging.Charging
+		if data.Charging.DCFC {
+			s.DCFC = true
+		}
+	} else {
+		charging = chargeKW > 1 || (data.ChargingStatus != nil && *data.ChargingStatus != 0)
+	}
+	if charging {
+		t.charged = true
+	}
+
+	// Trapezoidal integration of charge power between consecutive samples.
+	if !t.lastAt.IsZero() && now.After(t.lastAt) {
+		s.MeteredKWh += (t.lastKW + chargeKW) / 2 * now.Sub(t.lastAt).Hours()
+	}
+	t.lastAt, t.lastKW = now, chargeKW
+
+	if chargeKW > s.PeakPowerKW {
+		s.PeakPowerKW = chargeKW
+	}
+	if t.dcfcThresholdKW > 0 && s.PeakPowerKW > t.dcfcThresholdKW {
+		s.DCFC = true
+	}
+	if data.BatteryPercentage != nil {
+		s.EndSOC = *data.BatteryPercentage
+	}
+	if data.Mileage != nil {
+		odo := *data.Mileage
+		s.EndOdometerKM = &odo
+	}
+	t.refresh(s, now)
+	return nil
+}
+
+// Completed returns a copy of the most recently completed session, or nil.
+func (t *ChargeSessionTracker) Completed() *ChargeSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return copySession(t.last)
+}
+
+// Last returns a copy of the session in progress (once charging has started)
+// or, failing that, the most recently completed session. It returns nil when
+// no session has been seen yet.
+func (t *ChargeSessionTracker) Last() *ChargeSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current != nil && t.charged {
+		cp := *t.current
+		return &cp
+	}
+	if t.last != nil {
+		cp := *t.last
+		return &cp
+	}
+	return nil
+}
+
+// ChargeSessionTrackerState is the part of a ChargeSessionTracker kept
+// across restarts.
+type ChargeSessionTrackerState struct {
+	Current     *ChargeSession `json:"current,omitempty"`
+	Charged     bool           `json:"charged,omitempty"`
+	UnpluggedAt time.Time      `json:"unplugged_at,omitempty"`
+	Last        *ChargeSession `json:"last,omitempty"`
+	CapacityKWh float64        `json:"capacity_kwh,omitempty"`
+}
+
+// Export returns a copy of the tracker state.
+func (t *ChargeSessionTracker) Export() ChargeSessionTrackerState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return ChargeSessionTrackerState{
+		Current:     copySession(t.current),
+		Charged:     t.charged,
+		UnpluggedAt: t.unpluggedAt,
+		Last:        copySession(t.last),
+		CapacityKWh: t.capacity,
+	}
+}
+
+// Restore replaces the tracker state with s. Power integration restarts
+// with the next sample; the time the process was down is not metered.
+func (t *ChargeSessionTracker) Restore(s ChargeSessionTrackerState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current = copySession(s.Current)
+	t.charged = s.Charged && s.Current != nil
+	t.unpluggedAt = time.Time{}
+	if s.Current != nil {
+		t.unpluggedAt = s.UnpluggedAt
+	}
+	t.last = copySession(s.Last)
+	t.capacity = s.CapacityKWh
+	t.lastAt, t.lastKW = time.Time{}, 0
+}
+
+func copySession(s *ChargeSession) *ChargeSession {
+	if s == nil {
+		return nil
+	}
+	cp := *s
+	return &cp
+}
+
+func (t *ChargeSessionTracker) close(now time.Time) *ChargeSession {
+	s := t.current
+	t.current = nil
+	t.unpluggedAt = time.Time{}
+	if !t.charged {
+		// Gun was plugged in but charging never started – nothing to report.
+		return nil
+	}
+	end := now
+	s.End = &end
+	s.Active = false
+	t.refresh(s, now)
+	t.last = s
+	cp := *s
+	return &cp
+}
+
+func (t *ChargeSessionTracker) refresh(s *ChargeSession, now time.Time) {
+	s.SOCGained = s.EndSOC - s.StartSOC
+	if s.SOCGained < 0 {
+		s.SOCGained = 0
+	}
+	s.CapacityKWh = t.capacity
+	s.EnergyKWh = s.SOCGained * t.capacity / 100
+	if d := now.Sub(s.Start); d > 0 {
+		s.DurationMin = d.Minutes()
+		s.AvgPowerKW = s.AddedKWh() / d.Hours()
+	}
+}
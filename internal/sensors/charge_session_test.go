@@ -0,0 +1,153 @@
+package sensors
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestChargeSessionTracker(t *testing.T) {
+	// sample is one poll 15 minutes after the previous one: gun plugged in,
+	// power in kW (negative = charging) and SoC.
+	type sample struct {
+		gun   bool
+		power float64
+		soc   float64
+	}
+	unplugged := sample{soc: 50}
+
+	tests := []struct {
+		name    string
+		samples []sample
+		// The session closed by the last sample, as "duration_min
+		// soc_gained energy_kwh metered_kwh avg_kw peak_kw dcfc"; "" = none.
+		want string
+	}{
+		{
+			name: "7 kW AC charge",
+			samples: []sample{
+				{true, 0, 40}, {true, -7, 42}, {true, -7, 45}, {true, -7, 48}, {true, 0, 50},
+				unplugged, unplugged,
+			},
+			// Trapezoids: 0.875 + 1.75 + 1.75 + 0.875 kWh.
+			want: "75 10 7 5.25 4.2 7 false",
+		},
+		{
+			name:    "DC fast charge",
+			samples: []sample{{true, -50, 20}, {true, -50, 40}, {true, -30, 55}, unplugged, unplugged},
+			want:    "45 35 24.5 22.5 30 50 true",
+		},
+		{
+			name:    "plugged in without charging",
+			samples: []sample{{true, 0, 50}, {true, 0, 50}, unplugged},
+		},
+		{
+			name:    "still plugged in",
+			samples: []sample{{true, -7, 40}, {true, -7, 42}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewChargeSessionTracker(20)
+			start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			capacity := 70.0
+			var done *ChargeSession
+			for i, s := range tt.samples {
+				gun := 1.0
+				if s.gun {
+					gun = 2
+				}
+				power, soc := s.power, s.soc
+				done = tracker.Update(&SensorData{
+					Timestamp:         start.Add(time.Duration(i) * 15 * time.Minute),
+					ChargeGunState:    &gun,
+					EnginePower:       &power,
+					BatteryPercentage: &soc,
+					BatteryCapacity:   &capacity,
+				})
+			}
+			got := ""
+			if done != nil {
+				got = fmt.Sprint(done.DurationMin, " ", done.SOCGained, " ", done.EnergyKWh, " ", done.MeteredKWh, " ",
+					done.AvgPowerKW, " ", done.PeakPowerKW, " ", done.DCFC)
+				if done.Active || done.End == nil {
+					t.Errorf("closed session Active = %v, End = %v", done.Active, done.End)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("closed session %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChargeSessionLast(t *testing.T) {
+	tracker := NewChargeSessionTracker(20)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	update := func(i int, gun, power, soc float64) {
+		tracker.Update(&SensorData{
+			Timestamp:         start.Add(time.Duration(i) * time.Minute),
+			ChargeGunState:    &gun,
+			EnginePower:       &power,
+			BatteryPercentage: &soc,
+		})
+	}
+
+	if s := tracker.Last(); s != nil {
+		t.Fatalf("Last() = %+v before any session", s)
+	}
+	update(0, 2, 0, 40)
+	if s := tracker.Last(); s != nil {
+		t.Errorf("Last() = %+v before charging started", s)
+	}
+	update(1, 2, -7, 41)
+	if s := tracker.Last(); s == nil || !s.Active || s.EndSOC != 41 {
+		t.Errorf("Last() = %+v, want the active session at 41%%", s)
+	}
+	update(2, 1, 0, 41)
+	update(5, 1, 0, 41)
+	// A new plug-in that never charges keeps the finished session.
+	update(6, 2, 0, 41)
+	if s := tracker.Last(); s == nil || s.Active || s.SOCGained != 1 {
+		t.Errorf("Last() = %+v, want the finished session", s)
+	}
+}
+
+func TestChargeSessionReseat(t *testing.T) {
+	tracker := NewChargeSessionTracker(20)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// update feeds a sample at minute i and returns the closed session's
+	// "start-end" in minutes, or "".
+	update := func(i int, gun, power, soc float64) string {
+		s := tracker.Update(&SensorData{
+			Timestamp:         start.Add(time.Duration(i) * time.Minute),
+			ChargeGunState:    &gun,
+			EnginePower:       &power,
+			BatteryPercentage: &soc,
+		})
+		if s == nil {
+			return ""
+		}
+		return fmt.Sprint(s.Start.Sub(start).Minutes(), "-", s.End.Sub(start).Minutes())
+	}
+
+	steps := []struct {
+		at        int
+		gun       float64
+		power     float64
+		wantClose string
+	}{
+		{0, 2, -7, ""},
+		{1, 1, 0, ""},
+		{2, 2, -7, ""}, // re-seated within the grace period
+		{3, 1, 0, ""},
+		{4, 1, 0, ""},
+		{5, 1, 0, "0-3"}, // unplugged since minute 3
+		{6, 1, 0, ""},
+	}
+	for _, st := range steps {
+		if got := update(st.at, st.gun, st.power, 50); got != st.wantClose {
+			t.Errorf("minute %d: closed %q, want %q", st.at, got, st.wantClose)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package sensors
+
+import (
+	"sync"
+	"time"
+)
+
+// ChargingState is the debounced charging state produced by
+// ChargingStateTracker. It is attached to SensorData as a derived value so
+// every transmitter reports the same, flap-free answer.
+type ChargingState struct {
+	Charging bool `json:"charging"`
+	DCFC     bool `json:"dcfc"`
+}
+
+// ChargingStateTracker turns the per-sample charging signals into a stable
+// charging / DC-fast-charging state.
+//
+// A raw sample counts as "charging" when the gun is connected (ChargeGunState
+// == 2) and either power flows into the battery (EnginePower < -1 kW) or the
+// car's own ChargingStatus (52) is non-zero. The latter keeps short power dips
+// during cell balancing from being read as the end of a session.
+//
+// The reported state only toggles after the opposite raw state has been seen
+// for confirmSamples consecutive samples, or has persisted for hold – whichever
+// comes first (a zero value disables that criterion). Unplugging the gun ends a
+// session immediately.
+//
+// DCFC is latched for the rest of a session once power has stayed above
+// dcfcThresholdKW for confirmSamples samples, so the taper near 100 % doesn't
+// reclassify a fast-charge as AC.
+type ChargingStateTracker struct {
+	confirmSamples  int
+	hold            time.Duration
+	dcfcThresholdKW float64
+
+	mu    sync.Mutex
+	state ChargingState
+
+	pendingCount int
+	pendingSince time.Time
+	dcfcCount    int
+}
+
+// NewChargingStateTracker creates a tracker. confirmSamples and hold configure
+// the hysteresis; dcfcThresholdKW is the sustained charge power above which a
+// session is classified as DC fast charging.
+func NewChargingStateTracker(confirmSamples int, hold time.Duration, dcfcThresholdKW float64) *ChargingStateTracker {
+	return &ChargingStateTracker{
+		confirmSamples:  confirmSamples,
+		hold:            hold,
+		dcfcThresholdKW: dcfcThresholdKW,
+	}
+}
+
+// Update feeds one sample into the tracker and returns the resulting state.
+func (t *ChargingStateTracker) Update(data *SensorData) ChargingState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if data == nil {
+		return t.state
+	}
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	gunConnected := data.ChargeGunState != nil && *data.ChargeGunState == 2
+	if !gunConnected {
+		t.state = ChargingState{}
+		t.resetPending()
+		t.dcfcCount = 0
+		return t.state
+	}
+
+	raw := (data.EnginePower != nil && *data.EnginePower < -1) ||
+		(data.ChargingStatus != nil && *data.ChargingStatus != 0)
+
+	if raw == t.state.Charging {
+		t.resetPending()
+	} else {
+		if t.pendingCount == 0 {
+			t.pendingSince = now
+		}
+		t.pendingCount++
+		if t.confirmed(now) {
+			t.state.Charging = raw
+			t.resetPending()
+			if !raw {
+				t.state.DCFC = false
+				t.dcfcCount = 0
+			}
+		}
+	}
+
+	if t.state.Charging && !t.state.DCFC {
+		if data.EnginePower != nil && -*data.EnginePower > t.dcfcThresholdKW {
+			t.dcfcCount++
+		} else {
+			t.dcfcCount = 0
+		}
+		if t.dcfcCount >= max(t.confirmSamples, 1) {
+			t.state.DCFC = true
+		}
+	}
+
+	return t.state
+}
+
+// State returns the current debounced state without feeding a sample.
+func (t *ChargingStateTracker) State() ChargingState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// Restore sets the state, e.g. from a snapshot saved before a restart.
+// Pending transitions start over.
+func (t *ChargingStateTracker) Restore(state ChargingState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.state = state
+	t.resetPending()
+	t.dcfcCount = 0
+}
+
+func (t *ChargingStateTracker) confirmed(now time.Time) bool {
+	if t.confirmSamples <= 1 && t.hold <= 0 {
+		return true
+	}
+	if t.confirmSamples > 0 && t.pendingCount >= t.confirmSamples {
+		return true
+	}
+	return t.hold > 0 && now.Sub(t.pendingSince) >= t.hold
+}
+
+func (t *ChargingStateTracker) resetPending() {
+	t.pendingCount = 0
+	t.pendingSince = time.Time{}
+}
@@ -0,0 +1,100 @@
+package sensors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChargingStateTracker(t *testing.T) {
+	// sample is one poll: gun plugged in, power in kW (negative = charging)
+	// and ChargingStatus.
+	type sample struct {
+		gun    bool
+		power  float64
+		status float64
+	}
+	plugged := func(power float64) sample { return sample{gun: true, power: power} }
+	unplugged := sample{}
+
+	tests := []struct {
+		name    string
+		confirm int
+		hold    time.Duration
+		samples []sample
+		want    string // per sample: - idle, c charging (AC), d DC fast charging
+	}{
+		{
+			name:    "no hysteresis",
+			confirm: 1,
+			samples: []sample{plugged(0), plugged(-7), plugged(0), plugged(-7)},
+			want:    "-c-c",
+		},
+		{
+			name:    "flapping power is ignored",
+			confirm: 3,
+			samples: []sample{plugged(-7), plugged(0), plugged(-7), plugged(-7), plugged(-7), plugged(0), plugged(-7), plugged(0), plugged(0), plugged(0)},
+			want:    "----ccccc-",
+		},
+		{
+			name:    "charging status bridges power dips",
+			confirm: 2,
+			samples: []sample{plugged(-7), plugged(-7), {gun: true, status: 1}, {gun: true, status: 1}, plugged(0), plugged(0)},
+			want:    "-cccc-",
+		},
+		{
+			name:    "unplugging ends at once",
+			confirm: 3,
+			samples: []sample{plugged(-7), plugged(-7), plugged(-7), unplugged, plugged(-7)},
+			want:    "--c--",
+		},
+		{
+			name:    "hold confirms after its duration",
+			hold:    30 * time.Second, // samples are 10 s apart
+			samples: []sample{plugged(-7), plugged(-7), plugged(-7), plugged(-7), plugged(-7)},
+			want:    "---cc",
+		},
+		{
+			name:    "DCFC latched through the taper",
+			confirm: 2,
+			samples: []sample{plugged(-80), plugged(-80), plugged(-80), plugged(-80), plugged(-10), plugged(-5)},
+			want:    "-cdddd",
+		},
+		{
+			name:    "short power peak is not DCFC",
+			confirm: 2,
+			samples: []sample{plugged(-7), plugged(-7), plugged(-80), plugged(-7), plugged(-7)},
+			want:    "-cccc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewChargingStateTracker(tt.confirm, tt.hold, 50)
+			start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			got := make([]byte, 0, len(tt.samples))
+			for i, s := range tt.samples {
+				gun := 1.0
+				if s.gun {
+					gun = 2
+				}
+				power, status := s.power, s.status
+				state := tracker.Update(&SensorData{
+					Timestamp:      start.Add(time.Duration(i) * 10 * time.Second),
+					ChargeGunState: &gun,
+					EnginePower:    &power,
+					ChargingStatus: &status,
+				})
+				switch {
+				case state.DCFC:
+					got = append(got, 'd')
+				case state.Charging:
+					got = append(got, 'c')
+				default:
+					got = append(got, '-')
+				}
+			}
+			if string(got) != tt.want {
+				t.Errorf("states %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
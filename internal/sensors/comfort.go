@@ -0,0 +1,84 @@
+package sensors
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ComfortFormula parameterises DeriveCabinComfort. The zero value is not
+// usable; start from DefaultComfortFormula.
+type ComfortFormula struct {
+	Target       float64 // °C felt as most comfortable
+	Span         float64 // °C away from Target at which the score reaches 0
+	OutsideShare float64 // weight of OutsideTemperature in the felt temperature (0–1)
+	FanPenalty   float64 // points taken off per fan level while the AC runs
+}
+
+// DefaultComfortFormula is the formula used unless BYD_HASS_COMFORT
+// overrides it.
+var DefaultComfortFormula = ComfortFormula{Target: 22, Span: 10, OutsideShare: 0.1, FanPenalty: 2}
+
+// ParseComfortFormula parses comma-separated key=value overrides of
+// DefaultComfortFormula, e.g. "target=21,span=8,outside=0.2,fan=3". Keys
+// left out keep their default.
+func ParseComfortFormula(raw string) (ComfortFormula, error) {
+	f := DefaultComfortFormula
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, valStr, ok := strings.Cut(entry, "=")
+		v, err := strconv.ParseFloat(strings.TrimSpace(valStr), 64)
+		if !ok || err != nil {
+			return f, fmt.Errorf("invalid entry %q: expected key=number", entry)
+		}
+		switch strings.TrimSpace(key) {
+		case "target":
+			f.Target = v
+		case "span":
+			if v <= 0 {
+				return f, fmt.Errorf("span must be positive, got %g", v)
+			}
+			f.Span = v
+		case "outside":
+			if v < 0 || v > 1 {
+				return f, fmt.Errorf("outside must be between 0 and 1, got %g", v)
+			}
+			f.OutsideShare = v
+		case "fan":
+			if v < 0 {
+				return f, fmt.Errorf("fan must not be negative, got %g", v)
+			}
+			f.FanPenalty = v
+		default:
+			return f, fmt.Errorf("unknown key %q (expected target, span, outside or fan)", key)
+		}
+	}
+	return f, nil
+}
+
+// DeriveCabinComfort returns a 0–100 comfort score from the cabin (25) and
+// outside (26) temperatures, the AC status (77) and the fan level (78), or
+// nil unless all four have a value:
+//
+//	felt  = cabin + outside_share × (outside − cabin)
+//	score = 100 × (1 − |felt − target| / span) − fan_penalty × fan level (AC on)
+//
+// clamped to 0–100. The outside share stands in for the warmth or chill of
+// the glass; the fan penalty for draught and noise.
+func DeriveCabinComfort(data *SensorData, f ComfortFormula) *float64 {
+	if data == nil || data.CabinTemperature == nil || data.OutsideTemperature == nil || data.ACStatus == nil || data.FanSpeedLevel == nil {
+		return nil
+	}
+	cabin := *data.CabinTemperature
+	felt := cabin + f.OutsideShare*(*data.OutsideTemperature-cabin)
+	score := 100 * (1 - math.Abs(felt-f.Target)/f.Span)
+	if *data.ACStatus > 0 {
+		score -= f.FanPenalty * *data.FanSpeedLevel
+	}
+	score = math.Round(math.Max(0, math.Min(100, score)))
+	return &score
+}
@@ -0,0 +1,150 @@
+package sensors
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDebouncedSensors are the on/off style sensors known to flap for a
+// single poll on noisy CAN reads: driver seat belt (21), rear seat belts and
+// passenger belt warning (73–76) and the doors (81–84).
+var DefaultDebouncedSensors = []int{21, 73, 74, 75, 76, 81, 82, 83, 84}
+
+// DebounceRule decides when a new value is accepted: after it has been seen
+// for Polls consecutive polls or has persisted for Hold, whichever comes first
+// (a zero value disables that criterion). Polls <= 1 with no Hold accepts
+// every change immediately.
+type DebounceRule struct {
+	Polls int
+	Hold  time.Duration
+}
+
+func (r DebounceRule) confirmed(count int, since, now time.Time) bool {
+	if r.Polls <= 1 && r.Hold <= 0 {
+		return true
+	}
+	if r.Polls > 0 && count >= r.Polls {
+		return true
+	}
+	return r.Hold > 0 && now.Sub(since) >= r.Hold
+}
+
+// ParseDebounceRules parses per-sensor overrides of the form
+// "81:3,21:10s,5": an ID with a poll count, an ID with a hold duration, or a
+// bare ID which uses the global rule.
+func ParseDebounceRules(raw string, global DebounceRule) (map[int]DebounceRule, []string) {
+	rules := make(map[int]DebounceRule)
+	var warnings []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		idStr, spec, hasSpec := strings.Cut(entry, ":")
+		id, err := strconv.Atoi(strings.TrimSpace(idStr))
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("ignoring debounce rule %q: invalid sensor ID", entry))
+			continue
+		}
+		rule := global
+		if hasSpec {
+			spec = strings.TrimSpace(spec)
+			if n, err := strconv.Atoi(spec); err == nil && n >= 0 {
+				rule = DebounceRule{Polls: n}
+			} else if d, err := time.ParseDuration(spec); err == nil && d >= 0 {
+				rule = DebounceRule{Hold: d}
+			} else {
+				warnings = append(warnings, fmt.Sprintf("ignoring debounce rule %q: expected a poll count or duration", entry))
+				continue
+			}
+		}
+		rules[id] = rule
+	}
+	return rules, warnings
+}
+
+// Debouncer holds back changes of selected sensors until the new value is
+// confirmed by its DebounceRule, so a one-poll glitch on a door or seat belt
+// never reaches Home Assistant automations. Until confirmed, the previous
+// value keeps being reported.
+type Debouncer struct {
+	rules map[int]DebounceRule
+
+	mu    sync.Mutex
+	state map[int]*debounceState
+}
+
+type debounceState struct {
+	stable    float64
+	candidate float64
+	count     int
+	since     time.Time
+}
+
+// NewDebouncer debounces DefaultDebouncedSensors with global, then applies the
+// per-sensor overrides (which may add further sensors).
+func NewDebouncer(global DebounceRule, overrides map[int]DebounceRule) *Debouncer {
+	rules := make(map[int]DebounceRule, len(DefaultDebouncedSensors)+len(overrides))
+	for _, id := range DefaultDebouncedSensors {
+		rules[id] = global
+	}
+	for id, r := range overrides {
+		rules[id] = r
+	}
+	return &Debouncer{rules: rules, state: make(map[int]*debounceState)}
+}
+
+// Apply debounces data in place.
+func (d *Debouncer) Apply(data *SensorData) {
+	if data == nil {
+		return
+	}
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	v := reflect.ValueOf(data).Elem()
+	for id, rule := range d.rules {
+		def := GetSensorByID(id)
+		if def == nil {
+			continue
+		}
+		field := v.FieldByName(def.FieldName)
+		if !field.IsValid() || field.Kind() != reflect.Ptr || field.IsNil() {
+			continue
+		}
+		p, ok := field.Interface().(*float64)
+		if !ok {
+			continue
+		}
+
+		raw := *p
+		st, seen := d.state[id]
+		if !seen {
+			d.state[id] = &debounceState{stable: raw}
+			continue
+		}
+		switch {
+		case raw == st.stable:
+			st.count = 0
+		case st.count > 0 && raw == st.candidate:
+			st.count++
+		default:
+			st.candidate, st.count, st.since = raw, 1, now
+		}
+		if st.count > 0 && rule.confirmed(st.count, st.since, now) {
+			st.stable, st.count = raw, 0
+		}
+		if raw != st.stable {
+			stable := st.stable
+			field.Set(reflect.ValueOf(&stable))
+		}
+	}
+}
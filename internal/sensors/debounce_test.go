@@ -0,0 +1,67 @@
+package sensors
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseDebounceRules(t *testing.T) {
+	global := DebounceRule{Polls: 2}
+	tests := []struct {
+		raw       string
+		want      map[int]DebounceRule
+		wantWarns int
+	}{
+		{"", map[int]DebounceRule{}, 0},
+		{"81:3", map[int]DebounceRule{81: {Polls: 3}}, 0},
+		{"21:10s", map[int]DebounceRule{21: {Hold: 10 * time.Second}}, 0},
+		{"5", map[int]DebounceRule{5: global}, 0},
+		{"81:3, 21:10s ,5", map[int]DebounceRule{81: {Polls: 3}, 21: {Hold: 10 * time.Second}, 5: global}, 0},
+		{"door:3", map[int]DebounceRule{}, 1},
+		{"81:-1,21:soon,5", map[int]DebounceRule{5: global}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, warnings := ParseDebounceRules(tt.raw, global)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ParseDebounceRules(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+			if len(warnings) != tt.wantWarns {
+				t.Errorf("warnings %q, want %d", warnings, tt.wantWarns)
+			}
+		})
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	tests := []struct {
+		name string
+		rule DebounceRule
+		raw  []float64 // driver door (81), one poll every 10 s
+		want []float64 // as reported
+	}{
+		{"disabled", DebounceRule{Polls: 1}, []float64{0, 1, 0, 1}, []float64{0, 1, 0, 1}},
+		{"one-poll glitch suppressed", DebounceRule{Polls: 2}, []float64{0, 1, 0, 0}, []float64{0, 0, 0, 0}},
+		{"confirmed change", DebounceRule{Polls: 2}, []float64{0, 1, 1, 1, 0, 0}, []float64{0, 0, 1, 1, 1, 0}},
+		{"alternating never confirms", DebounceRule{Polls: 3}, []float64{0, 1, 1, 0, 1, 1, 0}, []float64{0, 0, 0, 0, 0, 0, 0}},
+		{"hold", DebounceRule{Hold: 20 * time.Second}, []float64{0, 1, 1, 1, 1}, []float64{0, 0, 0, 1, 1}},
+		{"polls or hold, whichever first", DebounceRule{Polls: 5, Hold: 10 * time.Second}, []float64{0, 1, 1}, []float64{0, 0, 1}},
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDebouncer(tt.rule, nil)
+			var got []float64
+			for i, v := range tt.raw {
+				v := v
+				data := &SensorData{Timestamp: start.Add(time.Duration(i) * 10 * time.Second), DriverDoor: &v}
+				d.Apply(data)
+				got = append(got, *data.DriverDoor)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("reported %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,9 @@ package sensors
 //  2. If ChargeGunState == 2 *and* EnginePower < -1 → "charging".
 //  3. Otherwise (gun connected but power >= -1) → "connected".
 //
+// When the sample carries a debounced ChargingState (see ChargingStateTracker)
+// that replaces the instantaneous power check in step 2.
+//
 // This helper lives in the sensors package so that other components (MQTT
 // transmitter, ABRP, etc.) can reuse the logic without duplicating it.
 func DeriveChargingStatus(data *SensorData) string {
@@ -13,6 +16,13 @@ func DeriveChargingStatus(data *SensorData) string {
 		return "disconnected"
 	}
 
+	if data.Charging != nil {
+		if data.Charging.Charging {
+			return "charging"
+		}
+		return "connected"
+	}
+
 	// At this point the charge gun is physically connected. A negative engine power
 	// (i.e. battery being charged) indicates active charging. A value near zero
 	// means the gun is plugged in but no current is flowing.
@@ -22,3 +32,46 @@ func DeriveChargingStatus(data *SensorData) string {
 
 	return "connected"
 }
+
+// EstimateRangeKM estimates the remaining electric range. It returns the
+// collector's RangeEstimateKM when there is one, and otherwise falls back on
+// the state of charge (33), battery capacity (29) and average consumption
+// (13). The car doesn't report a range over Diplus, so this is only as good
+// as the consumption figure. It returns nil when any input is missing or
+// zero.
+func EstimateRangeKM(data *SensorData) *float64 {
+	if data != nil && data.RangeEstimateKM != nil {
+		v := *data.RangeEstimateKM
+		return &v
+	}
+	if data == nil || data.BatteryPercentage == nil || data.BatteryCapacity == nil || data.PowerConsumption100km == nil {
+		return nil
+	}
+	if *data.BatteryCapacity <= 0 || *data.PowerConsumption100km <= 0 {
+		return nil
+	}
+	energyKWh := *data.BatteryPercentage / 100 * *data.BatteryCapacity
+	km := energyKWh / *data.PowerConsumption100km * 100
+	return &km
+}
+
+// RollingRangeKM estimates the remaining range from the state of charge (33)
+// and the rolling ConsumptionKWh100KM. usableKWh overrides BatteryCapacity
+// (29), e.g. for a degraded pack; 0 uses the reported capacity. It returns
+// nil when any input is missing or zero.
+func RollingRangeKM(data *SensorData, usableKWh float64) *float64 {
+	if data == nil || data.BatteryPercentage == nil || data.ConsumptionKWh100KM == nil || *data.ConsumptionKWh100KM <= 0 {
+		return nil
+	}
+	if usableKWh <= 0 {
+		if data.BatteryCapacity == nil {
+			return nil
+		}
+		usableKWh = *data.BatteryCapacity
+	}
+	if usableKWh <= 0 {
+		return nil
+	}
+	km := usableKWh * *data.BatteryPercentage / 100 / *data.ConsumptionKWh100KM * 100
+	return &km
+}
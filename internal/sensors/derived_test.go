@@ -0,0 +1,36 @@
+package sensors
+
+import "testing"
+
+func TestRollingRangeKM(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      *SensorData
+		usableKWh float64
+		want      interface{}
+	}{
+		{"reported capacity", &SensorData{BatteryPercentage: ptr(50), BatteryCapacity: ptr(60), ConsumptionKWh100KM: ptr(15)}, 0, 200.0},
+		{"usable capacity override", &SensorData{BatteryPercentage: ptr(50), BatteryCapacity: ptr(60), ConsumptionKWh100KM: ptr(15)}, 45, 150.0},
+		{"no capacity", &SensorData{BatteryPercentage: ptr(50), ConsumptionKWh100KM: ptr(15)}, 0, nil},
+		{"no consumption yet", &SensorData{BatteryPercentage: ptr(50), BatteryCapacity: ptr(60)}, 0, nil},
+		{"zero consumption", &SensorData{BatteryPercentage: ptr(50), BatteryCapacity: ptr(60), ConsumptionKWh100KM: ptr(0)}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deref(RollingRangeKM(tt.data, tt.usableKWh)); got != tt.want {
+				t.Errorf("RollingRangeKM = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateRangeKM(t *testing.T) {
+	data := &SensorData{BatteryPercentage: ptr(50), BatteryCapacity: ptr(60), PowerConsumption100km: ptr(20)}
+	if got := deref(EstimateRangeKM(data)); got != 150.0 {
+		t.Errorf("from the car's consumption: %v, want 150", got)
+	}
+	data.RangeEstimateKM = ptr(180)
+	if got := deref(EstimateRangeKM(data)); got != 180.0 {
+		t.Errorf("with a rolling estimate: %v, want 180", got)
+	}
+}
@@ -0,0 +1,122 @@
+package sensors
+
+import (
+	"sync"
+	"time"
+)
+
+// DistanceTracker totals the distance driven today and this week (weeks
+// start on Monday) from Mileage (3), with the day boundary at midnight in
+// loc.
+//
+// Distance is summed from odometer deltas between samples rather than taken
+// against a baseline, so an odometer that goes backwards (head-unit reset or
+// rollover) just starts counting again from the new reading instead of
+// producing a negative or huge total. Distance driven while the collector
+// was not running is added to the period the next reading falls in.
+type DistanceTracker struct {
+	loc *time.Location
+
+	mu         sync.Mutex
+	odometerKM *float64
+	day, week  distancePeriod
+}
+
+type distancePeriod struct {
+	start time.Time
+	km    float64
+}
+
+// NewDistanceTracker creates a tracker with day boundaries in loc (nil =
+// the collector's own time zone).
+func NewDistanceTracker(loc *time.Location) *DistanceTracker {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &DistanceTracker{loc: loc}
+}
+
+// Update feeds one sample and returns today's and this week's distance, or
+// nil before the first odometer reading.
+func (t *DistanceTracker) Update(data *SensorData) (today, week *DistancePeriod) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if data != nil && !data.Timestamp.IsZero() {
+		now = data.Timestamp
+	}
+	t.roll(now)
+	if data != nil && data.Mileage != nil {
+		km := *data.Mileage
+		if t.odometerKM != nil && km > *t.odometerKM {
+			t.day.km += km - *t.odometerKM
+			t.week.km += km - *t.odometerKM
+		}
+		t.odometerKM = &km
+	}
+	if t.odometerKM == nil {
+		return nil, nil
+	}
+	return t.day.export(), t.week.export()
+}
+
+// roll starts a new day or week once now has passed its boundary.
+func (t *DistanceTracker) roll(now time.Time) {
+	local := now.In(t.loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, t.loc)
+	week := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	if !t.day.start.Equal(day) {
+		t.day = distancePeriod{start: day}
+	}
+	if !t.week.start.Equal(week) {
+		t.week = distancePeriod{start: week}
+	}
+}
+
+// DistancePeriod is the distance driven since Start, the last reset.
+type DistancePeriod struct {
+	Start time.Time `json:"start"`
+	KM    float64   `json:"km"`
+}
+
+func (p distancePeriod) export() *DistancePeriod {
+	return &DistancePeriod{Start: p.start, KM: p.km}
+}
+
+// DistanceTrackerState is the part of a DistanceTracker kept across
+// restarts.
+type DistanceTrackerState struct {
+	OdometerKM *float64        `json:"odometer_km,omitempty"`
+	Day        *DistancePeriod `json:"day,omitempty"`
+	Week       *DistancePeriod `json:"week,omitempty"`
+}
+
+// Export returns a copy of the tracker state.
+func (t *DistanceTracker) Export() DistanceTrackerState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.odometerKM == nil {
+		return DistanceTrackerState{}
+	}
+	km := *t.odometerKM
+	return DistanceTrackerState{OdometerKM: &km, Day: t.day.export(), Week: t.week.export()}
+}
+
+// Restore replaces the tracker state with s. Periods that ended while the
+// collector was down are reset by the next Update.
+func (t *DistanceTracker) Restore(s DistanceTrackerState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.odometerKM, t.day, t.week = nil, distancePeriod{}, distancePeriod{}
+	if s.OdometerKM != nil {
+		km := *s.OdometerKM
+		t.odometerKM = &km
+	}
+	if s.Day != nil {
+		t.day = distancePeriod{start: s.Day.Start.In(t.loc), km: s.Day.KM}
+	}
+	if s.Week != nil {
+		t.week = distancePeriod{start: s.Week.Start.In(t.loc), km: s.Week.KM}
+	}
+}
@@ -0,0 +1,239 @@
+package sensors
+
+import (
+	"sync"
+	"time"
+)
+
+// gearPark is GearPosition (4) in P.
+const gearPark = 1
+
+// Odometer glitch filter: a step larger than driveMaxStepKM per
+// driveStepInterval (5 km per 15 s poll, i.e. 1200 km/h) is a bad reading.
+const (
+	driveMaxStepKM    = 5.0
+	driveStepInterval = 15 * time.Second
+)
+
+// DriveSession summarises one drive.
+type DriveSession struct {
+	Start            time.Time  `json:"start"`
+	End              *time.Time `json:"end,omitempty"` // nil while the drive is ongoing
+	Active           bool       `json:"active"`
+	DurationMin      float64    `json:"duration_min"`
+	DistanceKM       float64    `json:"distance_km"`
+	EnergyKWh        float64    `json:"energy_kwh"`
+	KWhPer100KM      *float64   `json:"kwh_per_100km,omitempty"` // nil until 0.1 km was driven
+	AvgSpeedKMH      float64    `json:"avg_speed_kmh"`
+	MaxSpeedKMH      float64    `json:"max_speed_kmh"`
+	StartOdometerKM  *float64   `json:"start_odometer_km,omitempty"`
+	OdometerGlitches int        `json:"odometer_glitches,omitempty"` // rejected odometer readings
+}
+
+// DriveSessionTracker is the trip computer. A drive starts once the car is
+// out of P (GearPosition 4; any gear when it isn't reported) and Speed (2)
+// exceeds startSpeed. It ends once the car has been parked – in P, or at
+// standstill when the gear isn't reported – for endAfter; the end time is
+// when it stopped. Distance accumulates from Mileage (3) deltas and energy
+// from TotalPowerConsumption (32) deltas. Odometer readings that go
+// backwards or jump by more than 5 km per 15 s are ignored.
+type DriveSessionTracker struct {
+	startSpeed float64
+	endAfter   time.Duration
+
+	mu          sync.Mutex
+	current     *DriveSession
+	lastAt      time.Time // time of the previous odometer reading
+	lastOdo     *float64
+	lastEnergy  *float64
+	parkedSince time.Time
+	last        *DriveSession
+}
+
+// NewDriveSessionTracker creates a tracker; startSpeed is in km/h.
+func NewDriveSessionTracker(startSpeed float64, endAfter time.Duration) *DriveSessionTracker {
+	return &DriveSessionTracker{startSpeed: startSpeed, endAfter: endAfter}
+}
+
+// Update feeds one sample into the tracker. It returns the drive that was
+// completed by this sample, if any.
+func (t *DriveSessionTracker) Update(data *SensorData) *DriveSession {
+	if data == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	speed := 0.0
+	if data.Speed != nil {
+		speed = *data.Speed
+	}
+	parked := speed <= 0
+	if data.GearPosition != nil {
+		parked = *data.GearPosition == gearPark
+	}
+
+	if t.current == nil {
+		if parked || speed <= t.startSpeed {
+			t.track(data, now, nil)
+			return nil
+		}
+		t.current = &DriveSession{Start: now, Active: true}
+		if start := data.Mileage; start != nil || t.lastOdo != nil {
+			if start == nil {
+				start = t.lastOdo
+			}
+			odo := *start
+			t.current.StartOdometerKM = &odo
+		}
+		t.parkedSince = time.Time{}
+	}
+	s := t.current
+	t.track(data, now, s)
+	if speed > s.MaxSpeedKMH {
+		s.MaxSpeedKMH = speed
+	}
+
+	if !parked {
+		t.parkedSince = time.Time{}
+		t.refresh(s, now)
+		return nil
+	}
+	if t.parkedSince.IsZero() {
+		t.parkedSince = now
+		t.refresh(s, now)
+	}
+	if now.Sub(t.parkedSince) < t.endAfter {
+		return nil
+	}
+
+	end := t.parkedSince
+	s.End = &end
+	s.Active = false
+	t.refresh(s, end)
+	t.current = nil
+	t.parkedSince = time.Time{}
+	t.last = s
+	return copyDrive(s)
+}
+
+// track accepts the odometer and energy readings of data, adding the deltas
+// to s when a drive is in progress.
+func (t *DriveSessionTracker) track(data *SensorData, now time.Time, s *DriveSession) {
+	if data.Mileage == nil {
+		return
+	}
+	odo := *data.Mileage
+	if t.lastOdo != nil {
+		delta := odo - *t.lastOdo
+		steps := max(now.Sub(t.lastAt).Seconds()/driveStepInterval.Seconds(), 1)
+		switch {
+		case delta < 0 || delta > driveMaxStepKM*steps:
+			// The reading still becomes the new baseline: after a one-off
+			// spike the next (normal) reading is rejected as going
+			// backwards, and after a head-unit reset counting resumes.
+			if s != nil {
+				s.OdometerGlitches++
+			}
+		case s != nil:
+			s.DistanceKM += delta
+		}
+	}
+	t.lastOdo, t.lastAt = &odo, now
+
+	if data.TotalPowerConsumption == nil {
+		return
+	}
+	energy := *data.TotalPowerConsumption
+	if t.lastEnergy != nil && s != nil {
+		if d := energy - *t.lastEnergy; d > 0 {
+			s.EnergyKWh += d
+		}
+	}
+	t.lastEnergy = &energy
+}
+
+// Current returns a copy of the drive in progress, or nil.
+func (t *DriveSessionTracker) Current() *DriveSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return copyDrive(t.current)
+}
+
+// Completed returns a copy of the most recently completed drive, or nil.
+func (t *DriveSessionTracker) Completed() *DriveSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return copyDrive(t.last)
+}
+
+// DriveSessionTrackerState is the part of a DriveSessionTracker kept across
+// restarts.
+type DriveSessionTrackerState struct {
+	Current     *DriveSession `json:"current,omitempty"`
+	ParkedSince time.Time     `json:"parked_since,omitempty"`
+	Last        *DriveSession `json:"last,omitempty"`
+}
+
+// Export returns a copy of the tracker state.
+func (t *DriveSessionTracker) Export() DriveSessionTrackerState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return DriveSessionTrackerState{
+		Current:     copyDrive(t.current),
+		ParkedSince: t.parkedSince,
+		Last:        copyDrive(t.last),
+	}
+}
+
+// Restore replaces the tracker state with s. Odometer and energy deltas
+// restart with the next sample, so the distance driven while the process was
+// down is not counted.
+func (t *DriveSessionTracker) Restore(s DriveSessionTrackerState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current = copyDrive(s.Current)
+	t.parkedSince = time.Time{}
+	if s.Current != nil {
+		t.parkedSince = s.ParkedSince
+	}
+	t.last = copyDrive(s.Last)
+	t.lastOdo, t.lastEnergy, t.lastAt = nil, nil, time.Time{}
+}
+
+func (t *DriveSessionTracker) refresh(s *DriveSession, now time.Time) {
+	d := now.Sub(s.Start)
+	if d <= 0 {
+		return
+	}
+	s.DurationMin = d.Minutes()
+	s.AvgSpeedKMH = s.DistanceKM / d.Hours()
+	if s.DistanceKM >= 0.1 {
+		v := s.EnergyKWh / s.DistanceKM * 100
+		s.KWhPer100KM = &v
+	}
+}
+
+func copyDrive(s *DriveSession) *DriveSession {
+	if s == nil {
+		return nil
+	}
+	cp := *s
+	if s.KWhPer100KM != nil {
+		v := *s.KWhPer100KM
+		cp.KWhPer100KM = &v
+	}
+	if s.StartOdometerKM != nil {
+		v := *s.StartOdometerKM
+		cp.StartOdometerKM = &v
+	}
+	if s.End != nil {
+		v := *s.End
+		cp.End = &v
+	}
+	return &cp
+}
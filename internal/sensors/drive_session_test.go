@@ -0,0 +1,136 @@
+package sensors
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// driveSample is one poll 15 seconds after the previous one. gear is the
+// GearPosition (0 = not reported, 1 = P, 4 = D).
+type driveSample struct {
+	gear, speed, odo, kwh float64
+}
+
+func (s driveSample) data(at time.Time) *SensorData {
+	d := &SensorData{Timestamp: at, Speed: ptr(s.speed), Mileage: ptr(s.odo), TotalPowerConsumption: ptr(s.kwh)}
+	if s.gear != 0 {
+		d.GearPosition = ptr(s.gear)
+	}
+	return d
+}
+
+// summary formats a drive as "duration_min distance_km energy_kwh
+// kwh_per_100km avg_speed max_speed glitches", with "-" for a consumption
+// not yet known.
+func (s *DriveSession) summary() string {
+	consumption := "-"
+	if s.KWhPer100KM != nil {
+		consumption = fmt.Sprintf("%.1f", *s.KWhPer100KM)
+	}
+	return fmt.Sprintf("%.2f %.2f %.2f %s %.0f %.0f %d", s.DurationMin, s.DistanceKM, s.EnergyKWh,
+		consumption, s.AvgSpeedKMH, s.MaxSpeedKMH, s.OdometerGlitches)
+}
+
+func TestDriveSessionTracker(t *testing.T) {
+	parked := driveSample{1, 0, 1000.5, 500.1}
+	tests := []struct {
+		name    string
+		samples []driveSample
+		// The drives completed, in order.
+		want []string
+		// The drive in progress after the last sample; "" = none.
+		wantCurrent string
+	}{
+		{
+			name: "city drive",
+			samples: []driveSample{
+				{1, 0, 1000, 500}, {4, 30, 1000.1, 500.02}, {4, 50, 1000.3, 500.05}, {4, 40, 1000.5, 500.1},
+				parked, parked, parked,
+			},
+			// Driving from 15 s to 60 s, parked for the 30 s that end it.
+			want: []string{"0.75 0.50 0.10 20.0 40 50 0"},
+		},
+		{
+			name: "short stop",
+			samples: []driveSample{
+				{4, 30, 1000, 500}, {1, 0, 1000.1, 500.02}, {4, 30, 1000.2, 500.04}, {4, 30, 1000.3, 500.06},
+			},
+			wantCurrent: "0.75 0.30 0.06 20.0 24 30 0",
+		},
+		{
+			name:    "creeping below the start speed",
+			samples: []driveSample{{4, 3, 1000, 500}, {4, 5, 1000.02, 500}, parked, parked, parked},
+		},
+		{
+			// The reading after the spike goes backwards and is lost too.
+			name: "odometer spike",
+			samples: []driveSample{
+				{4, 50, 1000, 500}, {4, 50, 1000.2, 500.04}, {4, 50, 1100, 500.08}, {4, 50, 1000.4, 500.12},
+				{4, 50, 1000.6, 500.16}, {1, 0, 1000.6, 500.16}, {1, 0, 1000.6, 500.16}, {1, 0, 1000.6, 500.16},
+			},
+			want: []string{"1.25 0.40 0.16 40.0 19 50 2"},
+		},
+		{
+			name: "standstill without gear",
+			samples: []driveSample{
+				{0, 20, 1000, 500}, {0, 20, 1000.1, 500.02}, {0, 0, 1000.1, 500.02}, {0, 0, 1000.1, 500.02},
+				{0, 0, 1000.1, 500.02}, {0, 20, 1000.2, 500.04},
+			},
+			// The next drive counts the odometer step of the sample
+			// that starts it.
+			want:        []string{"0.50 0.10 0.02 20.0 12 20 0"},
+			wantCurrent: "0.00 0.10 0.02 - 0 20 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewDriveSessionTracker(5, 30*time.Second)
+			start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			var got []string
+			for i, s := range tt.samples {
+				if done := tracker.Update(s.data(start.Add(time.Duration(i) * 15 * time.Second))); done != nil {
+					if done.Active || done.End == nil {
+						t.Errorf("completed drive active = %v, end = %v", done.Active, done.End)
+					}
+					got = append(got, done.summary())
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("drives %q, want %q", got, tt.want)
+			}
+			current := ""
+			if c := tracker.Current(); c != nil {
+				current = c.summary()
+			}
+			if current != tt.wantCurrent {
+				t.Errorf("current drive %q, want %q", current, tt.wantCurrent)
+			}
+		})
+	}
+}
+
+// TestDriveSessionRestore checks that a restored drive goes on without
+// counting what was driven while the process was down.
+func TestDriveSessionRestore(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	before := NewDriveSessionTracker(5, 30*time.Second)
+	before.Update(driveSample{4, 40, 1000, 500}.data(start))
+	before.Update(driveSample{4, 40, 1000.2, 500.04}.data(start.Add(15 * time.Second)))
+
+	after := NewDriveSessionTracker(5, 30*time.Second)
+	after.Restore(before.Export())
+	after.Update(driveSample{4, 40, 1010, 502}.data(start.Add(15 * time.Minute)))
+	after.Update(driveSample{4, 40, 1010.2, 502.04}.data(start.Add(15*time.Minute + 15*time.Second)))
+
+	c := after.Current()
+	if c == nil {
+		t.Fatal("no drive in progress after restore")
+	}
+	if got, want := fmt.Sprintf("%.2f %.2f", c.DistanceKM, c.EnergyKWh), "0.40 0.08"; got != want {
+		t.Errorf("distance and energy %s, want %s", got, want)
+	}
+	if !c.Start.Equal(start) {
+		t.Errorf("start %s, want %s", c.Start, start)
+	}
+}
@@ -0,0 +1,96 @@
+package sensors
+
+import "sync"
+
+// Driving state enum values, in order of precedence.
+const (
+	DrivingStateCharging = "charging"
+	DrivingStateDriving  = "driving"
+	DrivingStateOff      = "off"
+	DrivingStateParked   = "parked"
+)
+
+// DrivingStates lists every value DeriveDrivingState can return.
+var DrivingStates = []string{DrivingStateParked, DrivingStateDriving, DrivingStateCharging, DrivingStateOff}
+
+// DeriveDrivingState condenses PowerStatus (1), Speed (2) and ChargeGunState
+// (12) into a single state. Precedence: charging beats driving, driving beats
+// off, and off beats parked – a car that is charging is reported as charging
+// even while switched off.
+func DeriveDrivingState(data *SensorData) string {
+	switch {
+	case data == nil:
+		return DrivingStateOff
+	case DeriveChargingStatus(data) == "charging":
+		return DrivingStateCharging
+	case data.Speed != nil && *data.Speed > 0:
+		return DrivingStateDriving
+	case data.PowerStatus != nil && *data.PowerStatus == 0:
+		return DrivingStateOff
+	default:
+		return DrivingStateParked
+	}
+}
+
+// DrivingStateTracker debounces DeriveDrivingState: a new state is only
+// reported once it was derived for confirmSamples consecutive samples, so a
+// single 0 km/h reading at a traffic light doesn't flip driving → parked.
+// Charging is already debounced by ChargingStateTracker and applies at once.
+type DrivingStateTracker struct {
+	confirmSamples int
+
+	mu           sync.Mutex
+	state        string
+	pending      string
+	pendingCount int
+}
+
+// NewDrivingStateTracker creates a tracker requiring confirmSamples matching
+// samples before changing state.
+func NewDrivingStateTracker(confirmSamples int) *DrivingStateTracker {
+	return &DrivingStateTracker{confirmSamples: confirmSamples}
+}
+
+// Update feeds one sample and returns the debounced state.
+func (t *DrivingStateTracker) Update(data *SensorData) string {
+	if data == nil {
+		return t.State()
+	}
+	raw := DeriveDrivingState(data)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case t.state == "" || raw == DrivingStateCharging || t.state == DrivingStateCharging:
+		t.state = raw
+		t.pending, t.pendingCount = "", 0
+	case raw == t.state:
+		t.pending, t.pendingCount = "", 0
+	default:
+		if raw != t.pending {
+			t.pending, t.pendingCount = raw, 0
+		}
+		t.pendingCount++
+		if t.pendingCount >= t.confirmSamples {
+			t.state = raw
+			t.pending, t.pendingCount = "", 0
+		}
+	}
+	return t.state
+}
+
+// State returns the current debounced state ("" before the first sample).
+func (t *DrivingStateTracker) State() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// Restore sets the state, e.g. from a snapshot saved before a restart.
+func (t *DrivingStateTracker) Restore(state string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.state = state
+	t.pending, t.pendingCount = "", 0
+}
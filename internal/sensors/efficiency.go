@@ -0,0 +1,121 @@
+package sensors
+
+import "sync"
+
+// efficiencyMinStepKM is the odometer resolution; samples closer together are
+// not stored.
+const efficiencyMinStepKM = 0.1
+
+// EfficiencyTracker computes real-world consumption in Wh/km over the last
+// windowKM kilometres from Mileage (3) and TotalPowerConsumption (32) deltas,
+// which is far steadier than the car's instantaneous PowerConsumption100km
+// (13).
+//
+// A sample is stored each time the odometer advanced; the buffer is trimmed
+// so it spans just over windowKM. A value is only reported once minKM of
+// history exists, and the last value is held while parked. Samples without
+// energy data are skipped, and an odometer or energy counter that goes
+// backwards (head-unit reset) starts a new window.
+type EfficiencyTracker struct {
+	windowKM float64
+	minKM    float64
+
+	mu      sync.Mutex
+	samples []efficiencySample
+	last    *float64
+}
+
+type efficiencySample struct {
+	odometerKM float64
+	energyKWh  float64
+}
+
+// NewEfficiencyTracker creates a tracker averaging over windowKM kilometres
+// that reports once minKM (at most windowKM) have been driven.
+func NewEfficiencyTracker(windowKM, minKM float64) *EfficiencyTracker {
+	return &EfficiencyTracker{windowKM: windowKM, minKM: min(minKM, windowKM)}
+}
+
+// Update feeds one sample and returns the current efficiency in Wh/km, or
+// nil until minKM have been driven.
+func (t *EfficiencyTracker) Update(data *SensorData) *float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if data == nil || data.Mileage == nil || data.TotalPowerConsumption == nil {
+		return t.value()
+	}
+	s := efficiencySample{odometerKM: *data.Mileage, energyKWh: *data.TotalPowerConsumption}
+
+	if n := len(t.samples); n > 0 {
+		prev := t.samples[n-1]
+		switch {
+		case s.odometerKM < prev.odometerKM || s.energyKWh < prev.energyKWh:
+			t.samples = t.samples[:0]
+		case s.odometerKM-prev.odometerKM < efficiencyMinStepKM:
+			return t.value()
+		}
+	}
+	t.samples = append(t.samples, s)
+
+	// Drop the oldest sample while the next one still covers the window.
+	for len(t.samples) > 1 && s.odometerKM-t.samples[1].odometerKM >= t.windowKM {
+		t.samples = t.samples[1:]
+	}
+
+	first := t.samples[0]
+	distance := s.odometerKM - first.odometerKM
+	if distance >= t.minKM && distance > 0 {
+		whPerKM := (s.energyKWh - first.energyKWh) * 1000 / distance
+		t.last = &whPerKM
+	}
+	return t.value()
+}
+
+// EfficiencyTrackerState is the part of an EfficiencyTracker kept across
+// restarts.
+type EfficiencyTrackerState struct {
+	Samples []EfficiencySample `json:"samples,omitempty"`
+	WhKM    *float64           `json:"wh_km,omitempty"`
+}
+
+// EfficiencySample is one stored odometer/energy reading.
+type EfficiencySample struct {
+	OdometerKM float64 `json:"odometer_km"`
+	EnergyKWh  float64 `json:"energy_kwh"`
+}
+
+// Export returns a copy of the tracker state.
+func (t *EfficiencyTracker) Export() EfficiencyTrackerState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := EfficiencyTrackerState{WhKM: t.value()}
+	for _, sample := range t.samples {
+		s.Samples = append(s.Samples, EfficiencySample{OdometerKM: sample.odometerKM, EnergyKWh: sample.energyKWh})
+	}
+	return s
+}
+
+// Restore replaces the tracker state with s. A window that no longer fits
+// windowKM is trimmed by the next Update.
+func (t *EfficiencyTracker) Restore(s EfficiencyTrackerState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples = t.samples[:0]
+	for _, sample := range s.Samples {
+		t.samples = append(t.samples, efficiencySample{odometerKM: sample.OdometerKM, energyKWh: sample.EnergyKWh})
+	}
+	t.last = nil
+	if s.WhKM != nil {
+		v := *s.WhKM
+		t.last = &v
+	}
+}
+
+func (t *EfficiencyTracker) value() *float64 {
+	if t.last == nil {
+		return nil
+	}
+	v := *t.last
+	return &v
+}
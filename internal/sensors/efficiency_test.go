@@ -0,0 +1,77 @@
+package sensors
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEfficiencyTracker(t *testing.T) {
+	// sample is one poll: odometer in km and total energy in kWh; a negative
+	// energy means the sample has no energy data.
+	type sample struct {
+		km, kwh float64
+	}
+	tests := []struct {
+		name    string
+		minKM   float64 // 0 = the full window
+		samples []sample
+		want    string // efficiency in Wh/km after each sample, "<nil>" = none
+	}{
+		{
+			name:    "window not yet driven",
+			samples: []sample{{1000, 500}, {1005, 501}, {1009.9, 502}},
+			want:    "[<nil> <nil> <nil>]",
+		},
+		{
+			name:    "full window",
+			samples: []sample{{1000, 500}, {1005, 501}, {1010, 502}},
+			want:    "[<nil> <nil> 200]",
+		},
+		{
+			name:    "window slides",
+			samples: []sample{{1000, 500}, {1005, 501}, {1010, 502}, {1015, 504}},
+			want:    "[<nil> <nil> 200 300]",
+		},
+		{
+			name:    "reported after the minimum distance",
+			minKM:   5,
+			samples: []sample{{1000, 500}, {1004.9, 501}, {1005, 501}, {1010, 502}, {1015, 504}},
+			want:    "[<nil> <nil> 200 200 300]",
+		},
+		{
+			name:    "held while parked",
+			samples: []sample{{1000, 500}, {1010, 502}, {1010, 502}, {1010.05, 502.5}},
+			want:    "[<nil> 200 200 200]",
+		},
+		{
+			name:    "samples without energy skipped",
+			samples: []sample{{1000, 500}, {1005, -1}, {1010, 502}},
+			want:    "[<nil> <nil> 200]",
+		},
+		{
+			name:    "odometer reset starts a new window",
+			samples: []sample{{1000, 500}, {1010, 502}, {0, 0}, {5, 1}, {10, 3}},
+			want:    "[<nil> 200 200 200 300]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minKM := tt.minKM
+			if minKM == 0 {
+				minKM = 10
+			}
+			tracker := NewEfficiencyTracker(10, minKM)
+			var got []interface{}
+			for _, s := range tt.samples {
+				data := &SensorData{Mileage: ptr(s.km)}
+				if s.kwh >= 0 {
+					data.TotalPowerConsumption = ptr(s.kwh)
+				}
+				got = append(got, deref(tracker.Update(data)))
+			}
+			if fmt.Sprint(got) != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package sensors
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Plausibility bounds for event timestamps: the head-unit reports 0 (or
+// garbage) until the event happened once.
+var (
+	eventTimeMin = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	eventTimeMax = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// EventTimeSensorIDs returns the timestamp sensors (DeviceClass "timestamp"),
+// e.g. LastSentryTriggerTime (2003).
+func EventTimeSensorIDs() []int {
+	var ids []int
+	for _, s := range AllSensors {
+		if s.DeviceClass == "timestamp" {
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids
+}
+
+// ParseEventTime converts a raw timestamp reading. Diplus reports Unix
+// seconds or milliseconds, or on some firmwares a yyyyMMddHHmmss number.
+//
+// Some head-units count epoch seconds from the local wall clock rather than
+// from UTC. When loc is non-nil the epoch is taken to be such a wall-clock
+// value in loc; yyyyMMddHHmmss values are always local, in loc or, when nil,
+// in the collector's own time zone.
+func ParseEventTime(raw float64, loc *time.Location) (time.Time, bool) {
+	if raw <= 0 {
+		return time.Time{}, false
+	}
+	var t time.Time
+	switch {
+	case raw >= 1e13: // yyyyMMddHHmmss
+		if loc == nil {
+			loc = time.Local
+		}
+		var err error
+		t, err = time.ParseInLocation("20060102150405", strconv.FormatFloat(raw, 'f', 0, 64), loc)
+		if err != nil {
+			return time.Time{}, false
+		}
+	case raw >= 1e11: // milliseconds
+		t = time.UnixMilli(int64(raw)).UTC()
+	default:
+		t = time.Unix(int64(raw), 0).UTC()
+	}
+	if loc != nil && raw < 1e13 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+	}
+	if t.Before(eventTimeMin) || t.After(eventTimeMax) {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// DeriveEventTimes fills in EventTimes from the timestamp sensors that carry
+// a plausible value; loc is passed on to ParseEventTime.
+func DeriveEventTimes(data *SensorData, loc *time.Location) {
+	if data == nil {
+		return
+	}
+	data.EventTimes = nil
+	values := GetNonNilFields(data)
+	for _, id := range EventTimeSensorIDs() {
+		def := GetSensorByID(id)
+		if def == nil {
+			continue
+		}
+		key := ToSnakeCase(def.FieldName)
+		raw, ok := values[key].(float64)
+		if !ok {
+			continue
+		}
+		if t, ok := ParseEventTime(raw, loc); ok {
+			if data.EventTimes == nil {
+				data.EventTimes = make(map[string]time.Time)
+			}
+			data.EventTimes[key] = t
+		}
+	}
+}
+
+// EventAgeKey returns the key of the "seconds since" sensor derived from the
+// timestamp sensor key, e.g. last_sentry_trigger_seconds_ago.
+func EventAgeKey(key string) string {
+	return strings.TrimSuffix(key, "_time") + "_seconds_ago"
+}
+
+// EventAgeName returns the display name of the "seconds since" sensor, e.g.
+// "Since Last Sentry Trigger".
+func EventAgeName(def *SensorDefinition) string {
+	return "Since " + strings.TrimSuffix(def.EnglishName, " Time")
+}
+
+// EventAge returns how long before data was sampled the event at t happened,
+// never negative.
+func EventAge(data *SensorData, t time.Time) time.Duration {
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return max(now.Sub(t), 0)
+}
@@ -0,0 +1,77 @@
+package sensors
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ValueHolder fills sensors missing from a partial Diplus response with the
+// last value they reported, so one truncated response does not blank half
+// the entities. A value is held for at most maxAge after the sensor last
+// reported; after that the sensor is left empty again.
+type ValueHolder struct {
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	last    map[int]reflect.Value // copy of the last reported value (not a pointer)
+	updated map[int]time.Time
+}
+
+// NewValueHolder creates an empty holder.
+func NewValueHolder(maxAge time.Duration) *ValueHolder {
+	return &ValueHolder{
+		maxAge:  maxAge,
+		last:    make(map[int]reflect.Value),
+		updated: make(map[int]time.Time),
+	}
+}
+
+// Apply records the sensors present in data and fills in the missing ones in
+// place. It returns the IDs of the sensors that were filled in. Apply must
+// run before anything modifies the values (see ApplyTransforms).
+func (h *ValueHolder) Apply(data *SensorData) []int {
+	if data == nil {
+		return nil
+	}
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var held []int
+	v := reflect.ValueOf(data).Elem()
+	for _, def := range AllSensors {
+		field := v.FieldByName(def.FieldName)
+		if !field.IsValid() || field.Kind() != reflect.Ptr {
+			continue
+		}
+		if !field.IsNil() {
+			cp := reflect.New(field.Type().Elem()).Elem()
+			cp.Set(field.Elem())
+			h.last[def.ID] = cp
+			h.updated[def.ID] = now
+			continue
+		}
+		last, ok := h.last[def.ID]
+		if !ok || now.Sub(h.updated[def.ID]) > h.maxAge {
+			continue
+		}
+		// Each snapshot gets its own copy; later stages may modify it.
+		p := reflect.New(last.Type())
+		p.Elem().Set(last)
+		field.Set(p)
+		held = append(held, def.ID)
+	}
+	return held
+}
+
+// LastUpdated returns when sensor id last carried a value in a response.
+func (h *ValueHolder) LastUpdated(id int) (time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.updated[id]
+	return t, ok
+}
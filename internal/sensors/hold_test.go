@@ -0,0 +1,123 @@
+package sensors
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValueHolder(t *testing.T) {
+	// step is one response 10 s after the previous one; nil leaves the
+	// sensor out.
+	type step struct {
+		speed, soc *float64
+		wantHeld   []int
+		wantSpeed  interface{}
+		wantSOC    interface{}
+	}
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		steps  []step
+	}{
+		{"missing sensors keep their last value", time.Minute, []step{
+			{speed: ptr(42), soc: ptr(80), wantSpeed: 42.0, wantSOC: 80.0},
+			{soc: ptr(79), wantHeld: []int{2}, wantSpeed: 42.0, wantSOC: 79.0},
+			{wantHeld: []int{2, 33}, wantSpeed: 42.0, wantSOC: 79.0},
+			{speed: ptr(50), wantHeld: []int{33}, wantSpeed: 50.0, wantSOC: 79.0},
+		}},
+		{"hold expires", 15 * time.Second, []step{
+			{speed: ptr(42), wantSpeed: 42.0},
+			{wantHeld: []int{2}, wantSpeed: 42.0},
+			{wantSpeed: nil},
+			{speed: ptr(0), wantSpeed: 0.0},
+		}},
+		{"never reported", time.Minute, []step{
+			{speed: ptr(42), wantSpeed: 42.0},
+			{speed: ptr(43), wantSpeed: 43.0},
+		}},
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewValueHolder(tt.maxAge)
+			for i, st := range tt.steps {
+				data := &SensorData{
+					Timestamp:         start.Add(time.Duration(i) * 10 * time.Second),
+					Speed:             st.speed,
+					BatteryPercentage: st.soc,
+				}
+				held := h.Apply(data)
+				if fmt.Sprint(held) != fmt.Sprint(st.wantHeld) {
+					t.Errorf("step %d: held %v, want %v", i, held, st.wantHeld)
+				}
+				if got := deref(data.Speed); got != st.wantSpeed {
+					t.Errorf("step %d: speed %v, want %v", i, got, st.wantSpeed)
+				}
+				if got := deref(data.BatteryPercentage); got != st.wantSOC {
+					t.Errorf("step %d: SOC %v, want %v", i, got, st.wantSOC)
+				}
+			}
+		})
+	}
+}
+
+func TestValueHolderLastUpdated(t *testing.T) {
+	h := NewValueHolder(time.Minute)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h.Apply(&SensorData{Timestamp: start, Speed: ptr(42)})
+	held := &SensorData{Timestamp: start.Add(10 * time.Second)}
+	h.Apply(held)
+
+	if got, ok := h.LastUpdated(2); !ok || !got.Equal(start) {
+		t.Errorf("LastUpdated(speed) = %v, %v; want %v, a held value does not count", got, ok, start)
+	}
+	if _, ok := h.LastUpdated(33); ok {
+		t.Error("LastUpdated reports a sensor that never reported")
+	}
+	// The held value is a copy; changing it must not change what is held.
+	*held.Speed = 99
+	next := &SensorData{Timestamp: start.Add(20 * time.Second)}
+	h.Apply(next)
+	if got := deref(next.Speed); got != 42.0 {
+		t.Errorf("held speed %v after modifying a snapshot, want 42", got)
+	}
+}
+
+// TestHoldNullEmptyZero feeds responses through the parser and the holder
+// as the collector does: a null or empty speed keeps the last one, a
+// genuine zero replaces it.
+func TestHoldNullEmptyZero(t *testing.T) {
+	tests := []struct {
+		speed string // raw Speed value in the response
+		after time.Duration
+		want  interface{}
+	}{
+		{"42", 0, 42.0},
+		{"null", 10 * time.Second, 42.0},
+		{"", 20 * time.Second, 42.0},
+		{"undefined", 30 * time.Second, 42.0},
+		{"0", 40 * time.Second, 0.0},
+		{"null", 50 * time.Second, 0.0},
+		// The hold has expired: missing, not zero.
+		{"null", 2 * time.Minute, nil},
+		{"7", 3 * time.Minute, 7.0},
+	}
+	h := NewValueHolder(time.Minute)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		body := fmt.Sprintf(`{"success":true,"val":"BatteryPercentage:80|Speed:%s"}`, tt.speed)
+		data, report, err := ParseAPIResponseReport([]byte(body))
+		if err != nil {
+			t.Fatalf("Speed %q at %s: %v", tt.speed, tt.after, err)
+		}
+		if len(report.Malformed) > 0 {
+			t.Errorf("Speed %q at %s reported as malformed", tt.speed, tt.after)
+		}
+		data.Timestamp = start.Add(tt.after)
+		h.Apply(data)
+		if got := deref(data.Speed); got != tt.want {
+			t.Errorf("Speed %q at %s: got %v, want %v", tt.speed, tt.after, got, tt.want)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package sensors
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,49 +18,68 @@ type APIResponse struct {
 	Val     string `json:"val"`
 }
 
+// ParseReport describes which sensors a response actually carried.
+type ParseReport struct {
+	Present []int // IDs with a usable value
+	// Malformed maps IDs whose value could not be parsed ("--", "NaN", …)
+	// to the raw value. They are left unset.
+	Malformed map[int]string
+}
+
 // ParseAPIResponse parses the API response and populates a SensorData struct
 func ParseAPIResponse(responseBody []byte) (*SensorData, error) {
+	data, _, err := ParseAPIResponseReport(responseBody)
+	return data, err
+}
+
+// ParseAPIResponseReport is ParseAPIResponse that also reports which sensors
+// were present. Any subset of the requested sensors is accepted; only a
+// response without a single usable value is an error.
+func ParseAPIResponseReport(responseBody []byte) (*SensorData, ParseReport, error) {
+	var report ParseReport
 	var apiResp APIResponse
 	if err := json.Unmarshal(responseBody, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal API response: %w", err)
+		return nil, report, fmt.Errorf("failed to unmarshal API response: %w", err)
 	}
 
 	if !apiResp.Success {
-		return nil, fmt.Errorf("API request failed: success=false")
+		return nil, report, fmt.Errorf("API request failed: success=false")
 	}
 
 	sensorData := &SensorData{
 		Timestamp: time.Now(),
 	}
 
-	if err := parseValueString(apiResp.Val, sensorData); err != nil {
-		return nil, fmt.Errorf("failed to parse sensor values: %w", err)
+	if err := parseValueString(apiResp.Val, sensorData, &report); err != nil {
+		return nil, report, fmt.Errorf("failed to parse sensor values: %w", err)
 	}
 
-	return sensorData, nil
+	return sensorData, report, nil
 }
 
 // parseValueString parses the pipe-separated key:value string from the API
-func parseValueString(valString string, sensorData *SensorData) error {
+func parseValueString(valString string, sensorData *SensorData, report *ParseReport) error {
 	if valString == "" {
 		return fmt.Errorf("empty value string")
 	}
 
-	// Split by pipe separator
-	pairs := strings.Split(valString, "|")
-
 	// Use reflection to set struct fields
 	v := reflect.ValueOf(sensorData).Elem()
 
-	for _, pair := range pairs {
+	// Walk the pipe-separated pairs in place rather than splitting, to avoid
+	// allocating a slice per poll.
+	for rest := valString; rest != ""; {
+		var pair string
+		pair, rest, _ = strings.Cut(rest, "|")
+
 		// Split key:value
-		parts := strings.SplitN(pair, ":", 2)
-		if len(parts) != 2 {
+		key, valueStr, ok := strings.Cut(pair, ":")
+		if !ok {
 			continue // Skip malformed pairs
 		}
 
-		key := strings.TrimSpace(parts[0])
-		valueStr := strings.TrimSpace(parts[1])
+		key = strings.TrimSpace(key)
+		valueStr = strings.TrimSpace(valueStr)
 
 		// Lookup the struct field by the authoritative key directly; no fallback
 		// conversion is needed because Diplus now echoes back exactly what we
@@ -70,29 +91,42 @@ func parseValueString(valString string, sensorData *SensorData) error {
 		}
 
 		// Determine scaling factor based on sensor metadata (defaults to 1)
-		scaleFactor := GetScaleFactor(ToSnakeCase(key))
+		meta := fieldMetaFor(key)
 
-		// Parse the value and set the field with scaling applied where necessary
-		if err := setFieldValue(field, valueStr, scaleFactor); err != nil {
-			// Log error but continue with other fields
+		// Parse the value and set the field with scaling applied where
+		// necessary. A bad value only loses its own sensor.
+		set, err := setFieldValue(field, valueStr, meta.scale)
+		if err != nil {
+			if report.Malformed == nil {
+				report.Malformed = make(map[int]string)
+			}
+			report.Malformed[meta.id] = valueStr
 			continue
 		}
+		if set {
+			report.Present = append(report.Present, meta.id)
+		}
 	}
 
+	if len(report.Present) == 0 {
+		return fmt.Errorf("no usable sensor values in response")
+	}
 	return nil
 }
 
-// setFieldValue sets a reflect.Value field with the parsed string value
-func setFieldValue(field reflect.Value, valueStr string, scaleFactor float64) error {
+// setFieldValue sets a reflect.Value field with the parsed string value and
+// reports whether it did; empty values leave the field unset.
+func setFieldValue(field reflect.Value, valueStr string, scaleFactor float64) (bool, error) {
 	// Normalize the value string for European formats
 	normalizedValue := normalizeNumericValue(valueStr)
 
-	// If the normalized value is empty, treat it as null/not present
-	if normalizedValue == "" {
-		return nil // Leave the pointer nil
+	// Empty and null values mean the sensor is not present; they are not
+	// malformed, and certainly not zero.
+	if normalizedValue == "" || strings.EqualFold(normalizedValue, "null") || strings.EqualFold(normalizedValue, "undefined") {
+		return false, nil // Leave the pointer nil
 	}
 	if field.Kind() != reflect.Ptr {
-		return fmt.Errorf("field is not a pointer")
+		return false, fmt.Errorf("field is not a pointer")
 	}
 
 	// Get the type of the pointer's element
@@ -105,7 +139,11 @@ func setFieldValue(field reflect.Value, valueStr string, scaleFactor float64) er
 	case reflect.Float32, reflect.Float64:
 		floatVal, err := strconv.ParseFloat(normalizedValue, 64)
 		if err != nil {
-			return fmt.Errorf("failed to parse float value '%s': %w", normalizedValue, err)
+			return false, fmt.Errorf("failed to parse float value '%s': %w", normalizedValue, err)
+		}
+		// ParseFloat accepts "NaN" and "Inf", which are no readings either.
+		if math.IsNaN(floatVal) || math.IsInf(floatVal, 0) {
+			return false, fmt.Errorf("invalid float value '%s'", normalizedValue)
 		}
 		newVal.Elem().SetFloat(floatVal * scaleFactor)
 	case reflect.String:
@@ -114,12 +152,12 @@ func setFieldValue(field reflect.Value, valueStr string, scaleFactor float64) er
 		// We currently only expect *float64 and *string fields in SensorData.
 		// Unknown types are ignored rather than treated as errors to keep the
 		// parser resilient to future struct changes.
-		return nil
+		return false, nil
 	}
 
 	field.Set(newVal)
 
-	return nil
+	return true, nil
 }
 
 // normalizeNumericValue converts European number formats to standard formats
@@ -137,6 +175,33 @@ func normalizeNumericValue(value string) string {
 	return value
 }
 
+// fieldMeta is what the parser needs to know about a SensorData field.
+type fieldMeta struct {
+	id    int // 0 when the field has no sensor definition
+	scale float64
+}
+
+var (
+	fieldMetaOnce sync.Once
+	fieldMetas    map[string]fieldMeta // by FieldName
+)
+
+// fieldMetaFor returns the sensor ID and scale factor of the given
+// FieldName. The scale factor matches GetScaleFactor but is computed once
+// instead of snake-casing every sensor name on each lookup.
+func fieldMetaFor(fieldName string) fieldMeta {
+	fieldMetaOnce.Do(func() {
+		fieldMetas = make(map[string]fieldMeta, len(AllSensors))
+		for _, s := range AllSensors {
+			fieldMetas[s.FieldName] = fieldMeta{id: s.ID, scale: GetScaleFactor(ToSnakeCase(s.FieldName))}
+		}
+	})
+	if m, ok := fieldMetas[fieldName]; ok {
+		return m
+	}
+	return fieldMeta{scale: GetScaleFactor(ToSnakeCase(fieldName))}
+}
+
 var matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
 var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
 
@@ -221,6 +286,49 @@ func GetNonNilFields(data *SensorData) map[string]interface{} {
 	return result
 }
 
+// MergeSensorData copies every non-nil sensor field of src into dst, e.g. to
+// combine the responses of several batched Diplus requests.
+func MergeSensorData(dst, src *SensorData) {
+	if dst == nil || src == nil {
+		return
+	}
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src).Elem()
+	for i := 0; i < sv.NumField(); i++ {
+		field := sv.Field(i)
+		if field.Kind() == reflect.Ptr && !field.IsNil() {
+			dv.Field(i).Set(field)
+		}
+	}
+}
+
+// SensorsDiffer reports whether any of the sensors ids has a different value
+// (or presence) in a and b.
+func SensorsDiffer(a, b *SensorData, ids []int) bool {
+	if a == nil || b == nil {
+		return a != b
+	}
+	av := reflect.ValueOf(a).Elem()
+	bv := reflect.ValueOf(b).Elem()
+	for _, id := range ids {
+		def := GetSensorByID(id)
+		if def == nil {
+			continue
+		}
+		fa, fb := av.FieldByName(def.FieldName), bv.FieldByName(def.FieldName)
+		if !fa.IsValid() || fa.Kind() != reflect.Ptr {
+			continue
+		}
+		if fa.IsNil() != fb.IsNil() {
+			return true
+		}
+		if !fa.IsNil() && !reflect.DeepEqual(fa.Elem().Interface(), fb.Elem().Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
 // CompareRawVsParsed compares the raw API response map with the parsed SensorData struct.
 func CompareRawVsParsed(responseBody []byte, parsedData *SensorData) {
 	fmt.Println("\n" + strings.Repeat("=", 80))
@@ -0,0 +1,88 @@
+package sensors
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestParseAPIResponseFixtures(t *testing.T) {
+	tests := []struct {
+		file          string
+		wantErr       bool
+		wantPresent   []int
+		wantMalformed map[int]string
+		check         func(t *testing.T, d *SensorData)
+	}{
+		{
+			file:        "diplus_full.json",
+			wantPresent: []int{1, 2, 3, 4, 25, 26, 33},
+			check: func(t *testing.T, d *SensorData) {
+				if got := deref(d.Mileage); got != 12345.6 {
+					t.Errorf("Mileage = %v, want 12345.6 (scaled by 0.1)", got)
+				}
+				if got := deref(d.OutsideTemperature); got != -3.5 {
+					t.Errorf("OutsideTemperature = %v, want -3.5", got)
+				}
+			},
+		},
+		{
+			file:        "diplus_missing_ids.json",
+			wantPresent: []int{1, 2, 3},
+			check: func(t *testing.T, d *SensorData) {
+				if d.BatteryPercentage != nil {
+					t.Errorf("BatteryPercentage = %v, want unset", *d.BatteryPercentage)
+				}
+			},
+		},
+		{
+			file:        "diplus_truncated_pair.json",
+			wantPresent: []int{1, 2, 3, 4},
+		},
+		{
+			file:          "diplus_malformed.json",
+			wantPresent:   []int{1, 33},
+			wantMalformed: map[int]string{2: "--", 3: "NaN", 25: "Inf"},
+			check: func(t *testing.T, d *SensorData) {
+				// Empty and null values are absent, not zero.
+				if d.GearPosition != nil || d.OutsideTemperature != nil {
+					t.Errorf("GearPosition = %v, OutsideTemperature = %v, want both unset", d.GearPosition, d.OutsideTemperature)
+				}
+			},
+		},
+		{file: "diplus_no_usable.json", wantErr: true},
+		{file: "diplus_cut_body.json", wantErr: true},
+		{file: "diplus_failed.json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, report, err := ParseAPIResponseReport(body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			present := append([]int(nil), report.Present...)
+			sort.Ints(present)
+			if fmt.Sprint(present) != fmt.Sprint(tt.wantPresent) {
+				t.Errorf("present %v, want %v", present, tt.wantPresent)
+			}
+			if fmt.Sprint(report.Malformed) != fmt.Sprint(tt.wantMalformed) {
+				t.Errorf("malformed %v, want %v", report.Malformed, tt.wantMalformed)
+			}
+			if n := CountValues(data); n != len(tt.wantPresent) {
+				t.Errorf("%d values set, want %d", n, len(tt.wantPresent))
+			}
+			if tt.check != nil {
+				tt.check(t, data)
+			}
+		})
+	}
+}
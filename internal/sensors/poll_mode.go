@@ -0,0 +1,63 @@
+package sensors
+
+// Poll mode values, published as the Polling Mode sensor.
+const (
+	// PollModeActive polls at the configured interval.
+	PollModeActive = "active"
+	// PollModeSleeping backs off while the car is switched off.
+	PollModeSleeping = "sleeping"
+)
+
+// PollModes lists every poll mode.
+var PollModes = []string{PollModeActive, PollModeSleeping}
+
+// WakeSensorIDs are the sensors WakeReason looks at: PowerStatus (1), Speed
+// (2), ChargeGunState (12) and the doors, hood and trunk (81–86).
+var WakeSensorIDs = []int{1, 2, 12, 81, 82, 83, 84, 85, 86}
+
+// CarAsleep reports whether data shows the car switched off (PowerStatus 0),
+// stationary and unplugged. Without a PowerStatus reading the car is not
+// considered asleep.
+func CarAsleep(data *SensorData) bool {
+	return data != nil && data.PowerStatus != nil && *data.PowerStatus <= 0 &&
+		WakeReason(nil, data) == ""
+}
+
+// WakeReason returns why data shows the car awake, or "" if it doesn't: it
+// is switched on, moving or the charge gun is connected, or – compared with
+// baseline, the sample taken when it fell asleep – a door, the hood or the
+// trunk changed. Baseline may be nil.
+func WakeReason(baseline, data *SensorData) string {
+	switch {
+	case data == nil:
+		return ""
+	case data.PowerStatus != nil && *data.PowerStatus > 0:
+		return "power on"
+	case data.Speed != nil && *data.Speed > 0:
+		return "moving"
+	case data.ChargeGunState != nil && *data.ChargeGunState == 2:
+		return "charge gun connected"
+	}
+	if baseline == nil {
+		return ""
+	}
+	doors := []struct {
+		name     string
+		was, now *float64
+	}{
+		{"driver door", baseline.DriverDoor, data.DriverDoor},
+		{"passenger door", baseline.PassengerDoor, data.PassengerDoor},
+		{"left rear door", baseline.LeftRearDoor, data.LeftRearDoor},
+		{"right rear door", baseline.RightRearDoor, data.RightRearDoor},
+		{"hood", baseline.Hood, data.Hood},
+		{"trunk", baseline.TrunkDoor, data.TrunkDoor},
+	}
+	for _, d := range doors {
+		// Only a value seen on both sides counts; a sensor missing from one
+		// response is not a door opening.
+		if d.was != nil && d.now != nil && *d.was != *d.now {
+			return d.name
+		}
+	}
+	return ""
+}
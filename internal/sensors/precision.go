@@ -0,0 +1,119 @@
+package sensors
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxPrecision bounds the decimals a BYD_HASS_PRECISION entry may ask for.
+const maxPrecision = 6
+
+// defaultPrecision returns the decimals sensor d is published with unless
+// BYD_HASS_PRECISION says otherwise; false leaves its values as read.
+func defaultPrecision(d SensorDefinition) (int, bool) {
+	if d.Category != "sensor" {
+		return 0, false
+	}
+	switch {
+	case d.DeviceClass == "temperature", d.DeviceClass == "voltage":
+		return 1, true
+	case d.UnitOfMeasurement == "%":
+		return 0, true
+	case d.DeviceClass == "power":
+		return 2, true
+	}
+	return 0, false
+}
+
+// Precisions holds the number of decimals of every sensor that is rounded
+// before publishing: the defaults with the BYD_HASS_PRECISION entries on
+// top. Like the value maps, only the MQTT and Home Assistant outputs round;
+// SensorData keeps the values as read.
+var Precisions = loadPrecisions(os.Getenv("BYD_HASS_PRECISION"))
+
+// PrecisionFor returns the number of decimals of sensor id, or false if its
+// values are published as read.
+func PrecisionFor(id int) (int, bool) {
+	p, ok := Precisions[id]
+	return p, ok
+}
+
+// IntegerSensors returns the IDs of the sensors whose values are whole
+// numbers by declaration: rounded to no decimals, or published as read from
+// the car's raw integers, i.e. neither scaled, transformed nor converted to
+// dBm. The values of other sensors may carry decimals.
+func IntegerSensors() map[int]bool {
+	transformed := make(map[int]bool)
+	for _, m := range GetMonitoredSensors() {
+		if m.Transform != nil {
+			transformed[m.ID] = true
+		}
+	}
+	ids := make(map[int]bool)
+	for _, d := range AllSensors {
+		if p, ok := PrecisionFor(d.ID); ok {
+			if p == 0 {
+				ids[d.ID] = true
+			}
+			continue
+		}
+		unscaled := d.ScaleFactor == 0 || d.ScaleFactor == 1
+		if unscaled && !transformed[d.ID] {
+			ids[d.ID] = true
+		}
+	}
+	return ids
+}
+
+func loadPrecisions(raw string) map[int]int {
+	precisions := make(map[int]int)
+	for _, d := range AllSensors {
+		if p, ok := defaultPrecision(d); ok {
+			precisions[d.ID] = p
+		}
+	}
+	overrides, warnings := ParsePrecisions(raw)
+	ConfigWarnings = append(ConfigWarnings, warnings...)
+	for id, p := range overrides {
+		if p < 0 {
+			delete(precisions, id) // "39:" publishes the value as read
+			continue
+		}
+		precisions[id] = p
+	}
+	return precisions
+}
+
+// ParsePrecisions parses "id:decimals" entries separated by commas, e.g.
+// "39:2,33:1". An empty value ("39:") turns rounding off for the sensor and
+// is returned as -1.
+func ParsePrecisions(raw string) (map[int]int, []string) {
+	out := make(map[int]int)
+	var warnings []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		idStr, pStr, ok := strings.Cut(entry, ":")
+		id, err := strconv.Atoi(strings.TrimSpace(idStr))
+		if !ok || err != nil || GetSensorByID(id) == nil {
+			warnings = append(warnings, fmt.Sprintf("ignoring precision %q: expected id:decimals", entry))
+			continue
+		}
+		pStr = strings.TrimSpace(pStr)
+		if pStr == "" {
+			out[id] = -1
+			continue
+		}
+		p, err := strconv.Atoi(pStr)
+		if err != nil || p < 0 || p > maxPrecision {
+			warnings = append(warnings, fmt.Sprintf("ignoring precision %q: decimals must be 0–%d", entry, maxPrecision))
+			continue
+		}
+		out[id] = p
+	}
+	return out, warnings
+}
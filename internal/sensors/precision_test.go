@@ -0,0 +1,29 @@
+package sensors
+
+import "testing"
+
+func TestIntegerSensors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		id   int
+		want bool
+	}{
+		{"raw integer", nil, 2, true},             // speed
+		{"rounded to no decimals", nil, 33, true}, // battery percentage
+		{"scaled", nil, 3, false},                 // mileage ×0.1
+		{"one decimal", nil, 14, false},           // battery temperature
+		{"transformed", map[string]string{"BYD_HASS_TRANSFORM": "2:1.5"}, 2, false},
+		{"precision override", map[string]string{"BYD_HASS_PRECISION": "14:0"}, 14, true},
+		{"precision removed", map[string]string{"BYD_HASS_PRECISION": "33:2"}, 33, false},
+	}
+	defer LoadConfig(func(string) string { return "" })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			LoadConfig(func(key string) string { return tt.env[key] })
+			if got := IntegerSensors()[tt.id]; got != tt.want {
+				t.Errorf("IntegerSensors()[%d] = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
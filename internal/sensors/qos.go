@@ -0,0 +1,58 @@
+package sensors
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultQoS is the MQTT QoS sensor states are published with unless
+// BYD_HASS_MQTT_QOS says otherwise: at least once.
+const DefaultQoS byte = 1
+
+// QoS holds the MQTT QoS of the sensor states: Default for every sensor,
+// PerSensor for those overridden by ID.
+type QoS struct {
+	Default   byte
+	PerSensor map[int]byte
+}
+
+// For returns the QoS of sensor id.
+func (q QoS) For(id int) byte {
+	if v, ok := q.PerSensor[id]; ok {
+		return v
+	}
+	return q.Default
+}
+
+// ParseQoS parses "id:qos" entries separated by commas, e.g.
+// "default:0,52:1"; "default" sets the QoS of every sensor not listed.
+// "" yields DefaultQoS throughout.
+func ParseQoS(raw string) (QoS, error) {
+	q := QoS{Default: DefaultQoS}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, valStr, ok := strings.Cut(entry, ":")
+		v, err := strconv.Atoi(strings.TrimSpace(valStr))
+		if !ok || err != nil || v < 0 || v > 2 {
+			return QoS{}, fmt.Errorf("invalid entry %q: expected id:qos with a QoS of 0, 1 or 2", entry)
+		}
+		key = strings.TrimSpace(key)
+		if key == "default" {
+			q.Default = byte(v)
+			continue
+		}
+		id, err := strconv.Atoi(key)
+		if err != nil || GetSensorByID(id) == nil {
+			return QoS{}, fmt.Errorf("invalid entry %q: unknown sensor ID", entry)
+		}
+		if q.PerSensor == nil {
+			q.PerSensor = make(map[int]byte)
+		}
+		q.PerSensor[id] = byte(v)
+	}
+	return q, nil
+}
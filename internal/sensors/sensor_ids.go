@@ -1,9 +1,11 @@
 package sensors
 
 import (
+    "fmt"
     "os"
     "strings"
     "strconv"
+    "sync"
 )
 
 // MonitoredSensor represents a sensor that we (a) poll from Diplus and (b)
@@ -22,17 +24,25 @@ import (
 //   2. Append its ID to "BYD_HASS_SENSOR_IDS" env, choosing Publish=true/false
 //      in such manner: "ID:publish" for example "33:0,34:1", this will publish
 //      id 34, and read but not publish id 33, you can omit ":1" as publish is 
-//      the default, so you can write use "33,34:1" with the same effect
+//      the default, so you can write use "33,34:1" with the same effect.
+//      Append ":p" to also poll a sensor on the fast path, e.g. "81:1:p" or
+//      "81:p" (see BYD_HASS_FAST_POLL_INTERVAL)
+//      Append ":ema=0.3" or ":avg=5" to smooth a noisy sensor, e.g.
+//      "10:1:ema=0.3"; "10:1:ema=0.3+" keeps the raw value and adds a
+//      <name>_smoothed sensor (see Smoothing)
 //   3. No other lists need editing.
 
 type MonitoredSensor struct {
-	ID      int  // sensors.SensorDefinition.ID
-	Publish bool // true → value may be published externally
+	ID        int              // sensors.SensorDefinition.ID
+	Publish   bool             // true → value may be published externally
+	Priority  bool             // true → also polled on the fast path (see PrioritySensorIDs)
+	Transform *LinearTransform // optional correction, see BYD_HASS_TRANSFORM
+	Smoothing *Smoothing       // optional, see Smoother
 }
 
 // MonitoredSensors enumerates the subset of sensors our app currently cares
-// about.  Keep this list tidy; polling *all* 100-ish sensors every 15 seconds
-// would waste bandwidth and CPU on the head-unit.
+// about.  Keep this list tidy; polling *all* 100-ish sensors on every poll
+// (BYD_HASS_POLL_INTERVAL, 8 s by default) would waste bandwidth and CPU on the head-unit.
 // loadMonitoredSensorsFromEnv overrides the default MonitoredSensors
 
 // Default monitors
@@ -67,7 +77,7 @@ var defaultMonitoredSensors = []MonitoredSensor{
 	{ID: 9, Publish: true},   // RearMotorRPM
 	{ID: 10, Publish: true},  // EnginePower
 	{ID: 11, Publish: true},  // FrontMotorTorque
-	{ID: 12, Publish: true}, // ChargeGunState (internal‑only)
+	{ID: 12, Publish: true, Priority: true}, // ChargeGunState (internal‑only)
 
 	// 13‑22 --------------------------------------------------- 
 	{ID: 13, Publish: true}, // PowerConsumption100KM
@@ -102,7 +112,7 @@ var defaultMonitoredSensors = []MonitoredSensor{
 	{ID: 36, Publish: true}, // LaneLineCurvature
 	{ID: 37, Publish: true}, // RightLaneDistance
 	{ID: 38, Publish: true}, // LeftLaneDistance
-	{ID: 39, Publish: true}, // BatteryVoltage
+	{ID: 39, Publish: true}, // BatteryVoltage12V
 	{ID: 40, Publish: true}, // RadarLeftFront
 	{ID: 41, Publish: true}, // RadarRightFront
 	{ID: 42, Publish: true}, // RadarLeftRear
@@ -117,7 +127,7 @@ var defaultMonitoredSensors = []MonitoredSensor{
 	{ID: 49, Publish: true}, // WiperGear
 	{ID: 50, Publish: true}, // CruiseSwitch (binary_sensor)
 	{ID: 51, Publish: true}, // DistanceToVehicleAhead
-	{ID: 52, Publish: true}, // ChargingStatus
+	{ID: 52, Publish: true, Priority: true}, // ChargingStatus
 	{ID: 53, Publish: true}, // LeftFrontTirePressure
 	{ID: 54, Publish: true}, // RightFrontTirePressure
 	{ID: 55, Publish: true}, // LeftRearTirePressure
@@ -126,7 +136,7 @@ var defaultMonitoredSensors = []MonitoredSensor{
 	// 57‑66 ---------------------------------------------------
 	{ID: 57, Publish: true}, // LeftTurnSignal (binary_sensor)
 	{ID: 58, Publish: true}, // RightTurnSignal (binary_sensor)
-	{ID: 59, Publish: true}, // DriverDoorLock (binary_sensor)
+	{ID: 59, Publish: true, Priority: true}, // DriverDoorLock (binary_sensor)
 	// ID 60 is undocumented in the spec – it never appears in the XML.
 
 	{ID: 61, Publish: true}, // DriverWindowOpenPercentage
@@ -153,24 +163,24 @@ var defaultMonitoredSensors = []MonitoredSensor{
 	{ID: 78, Publish: true}, // FanSpeedLevel
 	{ID: 79, Publish: true}, // ACCirculationMode
 	{ID: 80, Publish: true}, // ACBlowingMode
-	{ID: 81, Publish: true}, // DriverDoor (binary_sensor)
-	{ID: 82, Publish: true}, // PassengerDoor (binary_sensor)
-	{ID: 83, Publish: true}, // LeftRearDoor (binary_sensor)
-	{ID: 84, Publish: true}, // RightRearDoor (binary_sensor)
+	{ID: 81, Publish: true, Priority: true}, // DriverDoor (binary_sensor)
+	{ID: 82, Publish: true, Priority: true}, // PassengerDoor (binary_sensor)
+	{ID: 83, Publish: true, Priority: true}, // LeftRearDoor (binary_sensor)
+	{ID: 84, Publish: true, Priority: true}, // RightRearDoor (binary_sensor)
 
 	// 85‑107 --------------------------------------------------
-	{ID: 85, Publish: true}, // Hood (binary_sensor)
-	{ID: 86, Publish: true}, // Trunk (binary_sensor)
-	{ID: 87, Publish: true}, // FuelTankCap (binary_sensor)
+	{ID: 85, Publish: true, Priority: true}, // Hood (binary_sensor)
+	{ID: 86, Publish: true, Priority: true}, // Trunk (binary_sensor)
+	{ID: 87, Publish: true, Priority: true}, // FuelTankCap (binary_sensor)
 	{ID: 88, Publish: true}, // AutomaticParking (binary_sensor)
 	{ID: 89, Publish: true}, // ACCCruiseStatus
 	{ID: 90, Publish: true}, // LeftRearApproachWarning (binary_sensor)
 	{ID: 91, Publish: true}, // RightRearApproachWarning (binary_sensor)
 	{ID: 92, Publish: true}, // Lane Keeping Status
-	{ID: 93, Publish: true}, // LeftRearDoorLock (binary_sensor)
-	{ID: 94, Publish: true}, // PassengerDoorLock (binary_sensor)
-	{ID: 95, Publish: true}, // RightRearDoorLock (binary_sensor)   // note: name in XML is “上次雨刮时间”, but it represents the right rear door lock
-	{ID: 96, Publish: true}, // TrunkDoorLock (binary_sensor)
+	{ID: 93, Publish: true, Priority: true}, // LeftRearDoorLock (binary_sensor)
+	{ID: 94, Publish: true, Priority: true}, // PassengerDoorLock (binary_sensor)
+	{ID: 95, Publish: true, Priority: true}, // RightRearDoorLock (binary_sensor)   // note: name in XML is “上次雨刮时间”, but it represents the right rear door lock
+	{ID: 96, Publish: true, Priority: true}, // TrunkDoorLock (binary_sensor)
 	{ID: 97, Publish: true}, // LeftRearChildLock (binary_sensor)
 	{ID: 98, Publish: true}, // RightRearChildLock (binary_sensor)
 	{ID: 99, Publish: true}, // LowBeam (binary_sensor)
@@ -206,15 +216,87 @@ var defaultMonitoredSensors = []MonitoredSensor{
 	{ID: 2007, Publish: true}, // LastVideoPath.
 }
 
-// Global value initialized at startup
-var MonitoredSensors = loadMonitoredSensorsFromEnv()
+// ConfigWarnings lists BYD_HASS_SENSOR_IDS / BYD_HASS_TRANSFORM entries that
+// were skipped while loading. The sensors package has no logger, so main
+// reports them once logging is set up.
+var ConfigWarnings []string
+
+// DroppedSensorTokens lists the BYD_HASS_SENSOR_IDS entries that were ignored
+// because they are not a valid or known sensor ID.
+var DroppedSensorTokens []string
+
+// monitoredSensors is initialized at startup from the environment. Access it
+// only through GetMonitoredSensors / SetMonitoredSensors so it can be replaced
+// while the collector and the outputs are reading it.
+var (
+	monitoredMu      sync.RWMutex
+	monitoredSensors = dedupeMonitoredSensors(attachTransforms(loadMonitoredSensorsFromEnv(), os.Getenv("BYD_HASS_TRANSFORM")))
+	// monitoredDefaults is set while monitoredSensors is the default list,
+	// i.e. BYD_HASS_SENSOR_IDS is empty; only then does the capability map
+	// (SetSupportedSensors) trim it.
+	monitoredDefaults = os.Getenv("BYD_HASS_SENSOR_IDS") == ""
+)
+
+// GetMonitoredSensors returns a copy of the monitored sensor list, without
+// the default sensors the car does not support (see SetSupportedSensors). It
+// is safe for concurrent use.
+func GetMonitoredSensors() []MonitoredSensor {
+	monitoredMu.RLock()
+	defer monitoredMu.RUnlock()
+	if !monitoredDefaults || supportedSensors == nil {
+		return append([]MonitoredSensor(nil), monitoredSensors...)
+	}
+	list := make([]MonitoredSensor, 0, len(monitoredSensors))
+	for _, s := range monitoredSensors {
+		if supportedSensors[s.ID] {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// SetMonitoredSensors replaces the monitored sensor list, e.g. after the
+// configuration was reloaded; duplicate IDs are merged as at startup. It is
+// safe for concurrent use.
+func SetMonitoredSensors(list []MonitoredSensor) {
+	list = dedupeMonitoredSensors(list)
+	monitoredMu.Lock()
+	defer monitoredMu.Unlock()
+	monitoredSensors = list
+}
 
 // ---------------------------------------------------------
 
 func loadMonitoredSensorsFromEnv() []MonitoredSensor {
-	raw := os.Getenv("BYD_HASS_SENSOR_IDS")
+	list, warnings, dropped := parseMonitoredSensors(os.Getenv("BYD_HASS_SENSOR_IDS"))
+	ConfigWarnings = append(ConfigWarnings, warnings...)
+	DroppedSensorTokens = append(DroppedSensorTokens, dropped...)
+	return list
+}
+
+// LoadConfig re-reads BYD_HASS_SENSOR_IDS, BYD_HASS_TRANSFORM,
+// BYD_HASS_VALUE_MAP and BYD_HASS_PRECISION through get exactly as they are read from the
+// environment at startup, replacing ConfigWarnings and DroppedSensorTokens,
+// e.g. once a config file supplied them. Call it before polling starts.
+func LoadConfig(get func(string) string) {
+	ConfigWarnings, DroppedSensorTokens = nil, nil
+	list, warnings, dropped := parseMonitoredSensors(get("BYD_HASS_SENSOR_IDS"))
+	ConfigWarnings = append(ConfigWarnings, warnings...)
+	DroppedSensorTokens = append(DroppedSensorTokens, dropped...)
+	SetMonitoredSensors(attachTransforms(list, get("BYD_HASS_TRANSFORM")))
+	monitoredMu.Lock()
+	monitoredDefaults = get("BYD_HASS_SENSOR_IDS") == ""
+	monitoredMu.Unlock()
+	ValueMaps = loadValueMaps(get("BYD_HASS_VALUE_MAP"))
+	Precisions = loadPrecisions(get("BYD_HASS_PRECISION"))
+}
+
+// parseMonitoredSensors parses a BYD_HASS_SENSOR_IDS value; "" selects the
+// defaults. Skipped entries are reported in warnings and, when not a valid
+// sensor ID, in dropped.
+func parseMonitoredSensors(raw string) (list []MonitoredSensor, warnings, dropped []string) {
 	if raw == "" {
-		return defaultMonitoredSensors
+		return defaultMonitoredSensors, nil, nil
 	}
 
 	parts := strings.Split(raw, ",")
@@ -227,49 +309,169 @@ func loadMonitoredSensorsFromEnv() []MonitoredSensor {
 		}
 
 		publish := true
-
-		// Format supports: "33" or "12:0" or "53:1"
-		idStr := p
-		if strings.Contains(p, ":") {
-			pieces := strings.SplitN(p, ":", 2)
-			idStr = pieces[0]
-			if pieces[1] == "0" {
+		priority := false
+		var smoothing *Smoothing
+
+		// Format supports: "33" or "12:0" or "53:1", optionally followed
+		// by ":p" for priority ("81:1:p", "81:p")
+		pieces := strings.Split(p, ":")
+		idStr := pieces[0]
+		for _, flag := range pieces[1:] {
+			switch strings.TrimSpace(flag) {
+			case "0":
 				publish = false
+			case "p", "P":
+				priority = true
+			default:
+				s, ok, err := parseSmoothing(flag)
+				if err != nil {
+					warnings = append(warnings, fmt.Sprintf("BYD_HASS_SENSOR_IDS: ignoring smoothing of %q: %v", p, err))
+				} else if ok {
+					smoothing = s
+				}
 			}
 		}
 
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("BYD_HASS_SENSOR_IDS: ignoring %q: invalid sensor ID", p))
+			dropped = append(dropped, p)
+			continue
+		}
+		if GetSensorByID(id) == nil {
+			warnings = append(warnings, fmt.Sprintf("BYD_HASS_SENSOR_IDS: ignoring %q: unknown sensor ID", p))
+			dropped = append(dropped, p)
 			continue
 		}
 
 		sensorsList = append(sensorsList, MonitoredSensor{
 			ID:	  id,
 			Publish: publish,
+			Priority: priority,
+			Smoothing: smoothing,
 		})
 	}
 
 	if len(sensorsList) == 0 {
-		return defaultMonitoredSensors
+		warnings = append(warnings, "BYD_HASS_SENSOR_IDS contains no usable sensor IDs; using the defaults")
+		return defaultMonitoredSensors, warnings, dropped
 	}
 
-	return sensorsList
+	return dedupeMonitoredSensors(sensorsList), warnings, dropped
+}
+
+// MonitoredDiff lists the sensor IDs a ReloadMonitoredSensors call added,
+// removed, or changed (Publish, Priority, Transform or Smoothing).
+type MonitoredDiff struct {
+	Added   []int `json:"added,omitempty"`
+	Removed []int `json:"removed,omitempty"`
+	Changed []int `json:"changed,omitempty"`
+}
+
+// Empty reports whether nothing changed.
+func (d MonitoredDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// ReloadMonitoredSensors parses sensorIDs and transforms as
+// BYD_HASS_SENSOR_IDS and BYD_HASS_TRANSFORM are parsed at startup and swaps
+// them in as the monitored sensor list. Pollers pick up the new list with
+// their next request. ConfigWarnings and DroppedSensorTokens keep describing
+// the startup configuration; the warnings of this reload are returned.
+func ReloadMonitoredSensors(sensorIDs, transforms string) (MonitoredDiff, []string) {
+	list, warnings, _ := parseMonitoredSensors(sensorIDs)
+	list, transformWarnings := withTransforms(list, transforms)
+	warnings = append(warnings, transformWarnings...)
+	list = dedupeMonitoredSensors(list)
+
+	monitoredMu.Lock()
+	old := monitoredSensors
+	monitoredSensors = list
+	monitoredDefaults = sensorIDs == ""
+	monitoredMu.Unlock()
+
+	var diff MonitoredDiff
+	before := make(map[int]MonitoredSensor, len(old))
+	for _, s := range old {
+		before[s.ID] = s
+	}
+	for _, s := range list {
+		prev, ok := before[s.ID]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, s.ID)
+		case prev.Publish != s.Publish || prev.Priority != s.Priority || !sameTransform(prev.Transform, s.Transform) || !sameSmoothing(prev.Smoothing, s.Smoothing):
+			diff.Changed = append(diff.Changed, s.ID)
+		}
+		delete(before, s.ID)
+	}
+	for _, s := range old {
+		if _, ok := before[s.ID]; ok {
+			diff.Removed = append(diff.Removed, s.ID)
+		}
+	}
+	return diff, warnings
+}
+
+func sameTransform(a, b *LinearTransform) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// dedupeMonitoredSensors collapses repeated IDs into a single entry while
+// preserving first-seen order. When duplicates disagree on Publish or
+// Priority, the entry is published / prioritised (true wins); the first
+// smoothing spec wins.
+func dedupeMonitoredSensors(list []MonitoredSensor) []MonitoredSensor {
+	index := make(map[int]int, len(list))
+	out := make([]MonitoredSensor, 0, len(list))
+	for _, s := range list {
+		if i, ok := index[s.ID]; ok {
+			out[i].Publish = out[i].Publish || s.Publish
+			out[i].Priority = out[i].Priority || s.Priority
+			if out[i].Smoothing == nil {
+				out[i].Smoothing = s.Smoothing
+			}
+			continue
+		}
+		index[s.ID] = len(out)
+		out = append(out, s)
+	}
+	return out
 }
 
 // PollSensorIDs returns every sensor ID we must include in the Diplus API
-// template.
+// template, without duplicates and in first-seen order (SetMonitoredSensors
+// and the loader already merge duplicates).
 func PollSensorIDs() []int {
-	ids := make([]int, 0, len(MonitoredSensors))
-	for _, s := range MonitoredSensors {
+	monitored := GetMonitoredSensors()
+	ids := make([]int, 0, len(monitored))
+	for _, s := range monitored {
 		ids = append(ids, s.ID)
 	}
 	return ids
 }
 
+// PrioritySensorIDs returns the IDs polled on the fast path, i.e. those whose
+// Priority flag is true.
+func PrioritySensorIDs() []int {
+	monitored := GetMonitoredSensors()
+	var ids []int
+	for _, s := range monitored {
+		if s.Priority {
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids
+}
+
 // PublishedSensorIDs returns only the IDs whose Publish flag is true.
 func PublishedSensorIDs() []int {
-	ids := make([]int, 0, len(MonitoredSensors))
-	for _, s := range MonitoredSensors {
+	monitored := GetMonitoredSensors()
+	ids := make([]int, 0, len(monitored))
+	for _, s := range monitored {
 		if s.Publish {
 			ids = append(ids, s.ID)
 		}
@@ -277,6 +479,18 @@ func PublishedSensorIDs() []int {
 	return ids
 }
 
+// SmoothedSensorIDs returns the published IDs whose smoothed value is an
+// additional <name>_smoothed sensor (Smoothing.Extra).
+func SmoothedSensorIDs() []int {
+	var ids []int
+	for _, s := range GetMonitoredSensors() {
+		if s.Publish && s.Smoothing != nil && s.Smoothing.Extra {
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids
+}
+
 // -----------------------------------------------------------------------------
 // Integration Notes
 // -----------------------------------------------------------------------------
@@ -0,0 +1,33 @@
+package sensors
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMonitoredSensorDedupe(t *testing.T) {
+	tests := []struct {
+		name          string
+		sensorIDs     string
+		wantPoll      []int
+		wantPublished []int
+	}{
+		{"no duplicates", "33,2:0,1", []int{33, 2, 1}, []int{33, 1}},
+		{"publish wins", "33:0,33:1", []int{33}, []int{33}},
+		{"publish wins either way", "33:1,2,33:0", []int{33, 2}, []int{33, 2}},
+		{"first-seen order", "2,33,1,2,33", []int{2, 33, 1}, []int{2, 33, 1}},
+	}
+	defer SetMonitoredSensors(GetMonitoredSensors())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BYD_HASS_SENSOR_IDS", tt.sensorIDs)
+			SetMonitoredSensors(loadMonitoredSensorsFromEnv())
+			if got := PollSensorIDs(); fmt.Sprint(got) != fmt.Sprint(tt.wantPoll) {
+				t.Errorf("PollSensorIDs() = %v, want %v", got, tt.wantPoll)
+			}
+			if got := PublishedSensorIDs(); fmt.Sprint(got) != fmt.Sprint(tt.wantPublished) {
+				t.Errorf("PublishedSensorIDs() = %v, want %v", got, tt.wantPublished)
+			}
+		})
+	}
+}
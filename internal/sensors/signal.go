@@ -0,0 +1,55 @@
+package sensors
+
+import (
+	"reflect"
+	"sync"
+)
+
+var (
+	signalMu      sync.Mutex
+	signalPercent = make(map[int]bool) // by sensor ID: reports a 0–100 quality
+)
+
+// ObserveSignalStrength notes for every signal strength sensor in data
+// whether the head-unit reports it as RSSI in dBm, which is always
+// negative, or as a 0–100 quality, as some do. Values are left as they
+// are; HAMeta publishes the quality as % without a device class, since it
+// cannot be turned into dBm faithfully. 0 fits both and changes nothing.
+func ObserveSignalStrength(data *SensorData) {
+	if data == nil {
+		return
+	}
+	v := reflect.ValueOf(data).Elem()
+	signalMu.Lock()
+	defer signalMu.Unlock()
+	for _, def := range AllSensors {
+		if !def.IsSignalStrength() {
+			continue
+		}
+		field := v.FieldByName(def.FieldName)
+		if !field.IsValid() || field.Kind() != reflect.Ptr || field.IsNil() {
+			continue
+		}
+		p, ok := field.Interface().(*float64)
+		if !ok || *p == 0 {
+			continue
+		}
+		signalPercent[def.ID] = *p > 0
+	}
+}
+
+// HAMeta returns the device class and unit Home Assistant is told about for
+// the sensor: those of the definition, except for a signal strength sensor
+// the head-unit reports as a 0–100 quality (see ObserveSignalStrength),
+// which has no device class and the unit %.
+func (d SensorDefinition) HAMeta() (deviceClass, unit string) {
+	if d.IsSignalStrength() {
+		signalMu.Lock()
+		percent := signalPercent[d.ID]
+		signalMu.Unlock()
+		if percent {
+			return "", "%"
+		}
+	}
+	return d.DeviceClass, d.UnitOfMeasurement
+}
@@ -0,0 +1,38 @@
+package sensors
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestObserveSignalStrength(t *testing.T) {
+	def := GetSensorByID(1009) // BluetoothSignalStrength
+	tests := []struct {
+		name  string
+		value *float64
+		want  string // value after, device class and unit
+	}{
+		{"nothing seen yet", nil, "<nil> signal_strength dBm"},
+		{"dBm", ptr(-67), "-67 signal_strength dBm"},
+		{"quality", ptr(80), "80  %"},
+		{"zero keeps the quality", ptr(0), "0  %"},
+		{"dBm again", ptr(-90), "-90 signal_strength dBm"},
+	}
+	defer func() {
+		signalMu.Lock()
+		delete(signalPercent, def.ID)
+		signalMu.Unlock()
+	}()
+	for _, tt := range tests {
+		data := &SensorData{BluetoothSignalStrength: tt.value}
+		ObserveSignalStrength(data)
+		value := "<nil>"
+		if p := data.BluetoothSignalStrength; p != nil {
+			value = fmt.Sprint(*p)
+		}
+		class, unit := def.HAMeta()
+		if got := fmt.Sprint(value, " ", class, " ", unit); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
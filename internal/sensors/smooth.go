@@ -0,0 +1,179 @@
+package sensors
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Smoothing kinds, see Smoothing.
+const (
+	SmoothingEMA = "ema"
+	SmoothingAvg = "avg"
+)
+
+// Smoothing calms a noisy analog sensor: an exponential moving average with
+// weight Alpha for the newest sample ("ema=0.3"), or the mean of the last
+// Window samples ("avg=5"). With Extra ("ema=0.3+") the smoothed value is
+// published as an additional <name>_smoothed sensor and the raw one is kept;
+// otherwise it replaces the raw value.
+type Smoothing struct {
+	Kind   string  `json:"kind"`
+	Alpha  float64 `json:"alpha,omitempty"`
+	Window int     `json:"window,omitempty"`
+	Extra  bool    `json:"extra,omitempty"`
+}
+
+// parseSmoothing parses the "ema=0.3" / "avg=5" flag of a BYD_HASS_SENSOR_IDS
+// entry, optionally followed by "+". ok is false if flag is not a smoothing
+// spec at all.
+func parseSmoothing(flag string) (s *Smoothing, ok bool, err error) {
+	kind, arg, found := strings.Cut(flag, "=")
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if !found || (kind != SmoothingEMA && kind != SmoothingAvg) {
+		return nil, false, nil
+	}
+	arg = strings.TrimSpace(arg)
+	s = &Smoothing{Kind: kind}
+	if strings.HasSuffix(arg, "+") {
+		s.Extra = true
+		arg = strings.TrimSpace(strings.TrimSuffix(arg, "+"))
+	}
+	if kind == SmoothingEMA {
+		s.Alpha, err = strconv.ParseFloat(arg, 64)
+		if err != nil || s.Alpha <= 0 || s.Alpha > 1 {
+			return nil, true, fmt.Errorf("ema weight must be in (0, 1], got %q", arg)
+		}
+		return s, true, nil
+	}
+	s.Window, err = strconv.Atoi(arg)
+	if err != nil || s.Window < 1 {
+		return nil, true, fmt.Errorf("avg window must be a positive number of samples, got %q", arg)
+	}
+	return s, true, nil
+}
+
+func sameSmoothing(a, b *Smoothing) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// staleSamples is how many poll intervals a sensor may go without a sample
+// before its smoother starts over, so it never blends across a gap.
+const staleSamples = 3
+
+// Smoother applies the Smoothing of the monitored sensors.
+type Smoother struct {
+	interval     time.Duration // full poll interval
+	fastInterval time.Duration // poll interval of priority sensors (0 = none)
+
+	mu    sync.Mutex
+	state map[int]*smoothState
+}
+
+type smoothState struct {
+	spec    Smoothing
+	value   float64
+	window  []float64
+	updated time.Time
+}
+
+// NewSmoother creates a smoother for sensors read every interval, priority
+// sensors every fastInterval (0 = no fast poll).
+func NewSmoother(interval, fastInterval time.Duration) *Smoother {
+	return &Smoother{interval: interval, fastInterval: fastInterval, state: make(map[int]*smoothState)}
+}
+
+// Apply smooths data in place: smoothed values replace the raw ones or, for
+// Extra, go into data.Smoothed. Only the sensors fresh reports as read by
+// this poll add a sample (nil = all of them); the others show their current
+// smoothed value.
+func (s *Smoother) Apply(data *SensorData, fresh func(id int) bool) {
+	if data == nil {
+		return
+	}
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := reflect.ValueOf(data).Elem()
+	for _, m := range GetMonitoredSensors() {
+		if m.Smoothing == nil {
+			delete(s.state, m.ID)
+			continue
+		}
+		def := GetSensorByID(m.ID)
+		if def == nil {
+			continue
+		}
+		field := v.FieldByName(def.FieldName)
+		if !field.IsValid() || field.Kind() != reflect.Ptr || field.IsNil() {
+			continue
+		}
+		p, ok := field.Interface().(*float64)
+		if !ok {
+			continue
+		}
+
+		st := s.state[m.ID]
+		if st == nil || st.spec != *m.Smoothing {
+			st = &smoothState{spec: *m.Smoothing}
+			s.state[m.ID] = st
+		}
+		interval := s.interval
+		if m.Priority && s.fastInterval > 0 {
+			interval = s.fastInterval
+		}
+		if !st.updated.IsZero() && now.Sub(st.updated) > staleSamples*interval {
+			st.window, st.updated = nil, time.Time{}
+		}
+		if st.updated.IsZero() || fresh == nil || fresh(m.ID) {
+			st.add(*p)
+			st.updated = now
+		}
+
+		smoothed := st.value
+		if m.Smoothing.Extra {
+			if !m.Publish {
+				continue
+			}
+			if data.Smoothed == nil {
+				data.Smoothed = make(map[int]float64)
+			}
+			data.Smoothed[m.ID] = smoothed
+		} else {
+			field.Set(reflect.ValueOf(&smoothed))
+		}
+	}
+}
+
+// add feeds sample into the average; the first sample after a reset is taken
+// as is.
+func (st *smoothState) add(sample float64) {
+	switch st.spec.Kind {
+	case SmoothingEMA:
+		if st.updated.IsZero() {
+			st.value = sample
+			return
+		}
+		st.value += st.spec.Alpha * (sample - st.value)
+	case SmoothingAvg:
+		st.window = append(st.window, sample)
+		if len(st.window) > st.spec.Window {
+			st.window = st.window[len(st.window)-st.spec.Window:]
+		}
+		sum := 0.0
+		for _, x := range st.window {
+			sum += x
+		}
+		st.value = sum / float64(len(st.window))
+	}
+}
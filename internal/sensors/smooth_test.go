@@ -0,0 +1,135 @@
+package sensors
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseSmoothing(t *testing.T) {
+	tests := []struct {
+		flag    string
+		want    *Smoothing
+		wantOK  bool
+		wantErr bool
+	}{
+		{"ema=0.3", &Smoothing{Kind: SmoothingEMA, Alpha: 0.3}, true, false},
+		{"EMA=1", &Smoothing{Kind: SmoothingEMA, Alpha: 1}, true, false},
+		{"avg=5", &Smoothing{Kind: SmoothingAvg, Window: 5}, true, false},
+		{"avg=5+", &Smoothing{Kind: SmoothingAvg, Window: 5, Extra: true}, true, false},
+		{"ema= 0.3 +", &Smoothing{Kind: SmoothingEMA, Alpha: 0.3, Extra: true}, true, false},
+		{"ema=0", nil, true, true},
+		{"ema=1.5", nil, true, true},
+		{"avg=0", nil, true, true},
+		{"avg=x", nil, true, true},
+		{"p", nil, false, false},
+		{"median=3", nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			got, ok, err := parseSmoothing(tt.flag)
+			if ok != tt.wantOK || (err != nil) != tt.wantErr || !sameSmoothing(got, tt.want) {
+				t.Errorf("parseSmoothing(%q) = %+v, %v, %v; want %+v, %v, error %v", tt.flag, got, ok, err, tt.want, tt.wantOK, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSmoother(t *testing.T) {
+	// sample is a pedal reading taken after the given time; stale marks a
+	// poll that did not read the sensor again.
+	type sample struct {
+		at    time.Duration
+		value float64
+		stale bool
+	}
+	seq := func(values ...float64) []sample {
+		s := make([]sample, len(values))
+		for i, v := range values {
+			s[i] = sample{at: time.Duration(i) * time.Second, value: v}
+		}
+		return s
+	}
+	tests := []struct {
+		name    string
+		spec    string
+		samples []sample
+		want    []float64 // published pedal depth
+		// wantExtra is the <name>_smoothed value per sample; the raw value
+		// is published unchanged.
+		wantExtra []float64
+	}{
+		{
+			name:    "ema",
+			spec:    "7:1:ema=0.5",
+			samples: seq(0, 10, 10, 0, 0),
+			want:    []float64{0, 5, 7.5, 3.75, 1.875},
+		},
+		{
+			name:    "moving average",
+			spec:    "7:1:avg=3",
+			samples: seq(3, 6, 9, 12, 0),
+			want:    []float64{3, 4.5, 6, 9, 7},
+		},
+		{
+			name:      "extra sensor keeps the raw value",
+			spec:      "7:1:avg=2+",
+			samples:   seq(10, 20, 40),
+			want:      []float64{10, 20, 40},
+			wantExtra: []float64{10, 15, 30},
+		},
+		{
+			name: "restarts after a gap",
+			spec: "7:1:ema=0.5",
+			samples: []sample{
+				{at: 0, value: 0},
+				{at: time.Second, value: 10},
+				{at: 3 * time.Second, value: 10},
+				// More than 3 intervals since the last sample.
+				{at: 7 * time.Second, value: 40},
+				{at: 8 * time.Second, value: 0},
+			},
+			want: []float64{0, 5, 7.5, 40, 20},
+		},
+		{
+			name: "no sample from a poll that did not read the sensor",
+			spec: "7:1:ema=0.5",
+			samples: []sample{
+				{at: 0, value: 0},
+				{at: time.Second, value: 10},
+				{at: 2 * time.Second, value: 99, stale: true},
+				{at: 3 * time.Second, value: 10},
+			},
+			want: []float64{0, 5, 5, 7.5},
+		},
+	}
+	defer LoadConfig(func(string) string { return "" })
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			LoadConfig(func(key string) string {
+				if key == "BYD_HASS_SENSOR_IDS" {
+					return tt.spec
+				}
+				return ""
+			})
+			s := NewSmoother(time.Second, 0)
+			var got, gotExtra []float64
+			for _, sm := range tt.samples {
+				value := sm.value
+				data := &SensorData{Timestamp: start.Add(sm.at), AcceleratorPedalDepth: &value}
+				s.Apply(data, func(int) bool { return !sm.stale })
+				got = append(got, *data.AcceleratorPedalDepth)
+				if extra, ok := data.Smoothed[7]; ok {
+					gotExtra = append(gotExtra, extra)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("published %v, want %v", got, tt.want)
+			}
+			if fmt.Sprint(gotExtra) != fmt.Sprint(tt.wantExtra) {
+				t.Errorf("smoothed sensor %v, want %v", gotExtra, tt.wantExtra)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package sensors
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// LinearTransform corrects a raw reading as value*Scale + Offset. It is applied
+// on top of SensorDefinition.ScaleFactor for head-units that report a sensor
+// in a different unit or with an extra factor.
+type LinearTransform struct {
+	Scale  float64 `json:"scale"`
+	Offset float64 `json:"offset"`
+}
+
+// Apply returns the corrected value.
+func (t LinearTransform) Apply(v float64) float64 {
+	return v*t.Scale + t.Offset
+}
+
+// ParseTransforms parses "id:scale:offset" entries separated by commas, e.g.
+// "39:0.1:0,5:1:-40". The offset may be omitted ("39:0.1").
+func ParseTransforms(raw string) (map[int]LinearTransform, []string) {
+	out := make(map[int]LinearTransform)
+	var warnings []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			warnings = append(warnings, fmt.Sprintf("ignoring transform %q: expected id:scale[:offset]", entry))
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("ignoring transform %q: invalid sensor ID", entry))
+			continue
+		}
+		scale, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("ignoring transform %q: invalid scale", entry))
+			continue
+		}
+		t := LinearTransform{Scale: scale}
+		if len(parts) == 3 {
+			if t.Offset, err = strconv.ParseFloat(strings.TrimSpace(parts[2]), 64); err != nil {
+				warnings = append(warnings, fmt.Sprintf("ignoring transform %q: invalid offset", entry))
+				continue
+			}
+		}
+		out[id] = t
+	}
+	return out, warnings
+}
+
+// attachTransforms returns a copy of list with the transforms from raw set on
+// the matching entries. Transforms for sensors that are not monitored are
+// reported in ConfigWarnings.
+func attachTransforms(list []MonitoredSensor, raw string) []MonitoredSensor {
+	out, warnings := withTransforms(list, raw)
+	ConfigWarnings = append(ConfigWarnings, warnings...)
+	return out
+}
+
+// withTransforms is attachTransforms returning the warnings instead.
+func withTransforms(list []MonitoredSensor, raw string) ([]MonitoredSensor, []string) {
+	if strings.TrimSpace(raw) == "" {
+		return list, nil
+	}
+	transforms, warnings := ParseTransforms(raw)
+
+	out := make([]MonitoredSensor, len(list))
+	copy(out, list)
+	for i := range out {
+		if t, ok := transforms[out[i].ID]; ok {
+			t := t
+			out[i].Transform = &t
+			delete(transforms, out[i].ID)
+		}
+	}
+	for id := range transforms {
+		warnings = append(warnings, fmt.Sprintf("ignoring transform for sensor %d: not monitored", id))
+	}
+	return out, warnings
+}
+
+// ApplyTransforms rewrites every monitored sensor that has a LinearTransform
+// in place and notes the scale signal strengths are reported in (see
+// ObserveSignalStrength). The collector calls it once per poll, before range
+// validation, so every output sees the corrected value.
+func ApplyTransforms(data *SensorData) {
+	if data == nil {
+		return
+	}
+	v := reflect.ValueOf(data).Elem()
+	for _, m := range GetMonitoredSensors() {
+		if m.Transform == nil {
+			continue
+		}
+		def := GetSensorByID(m.ID)
+		if def == nil {
+			continue
+		}
+		field := v.FieldByName(def.FieldName)
+		if !field.IsValid() || field.Kind() != reflect.Ptr || field.IsNil() {
+			continue
+		}
+		p, ok := field.Interface().(*float64)
+		if !ok {
+			continue
+		}
+		corrected := m.Transform.Apply(*p)
+		field.Set(reflect.ValueOf(&corrected))
+	}
+	ObserveSignalStrength(data)
+}
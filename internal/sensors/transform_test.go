@@ -0,0 +1,85 @@
+package sensors
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseTransforms(t *testing.T) {
+	tests := []struct {
+		raw       string
+		want      map[int]LinearTransform
+		wantWarns int
+	}{
+		{"", map[int]LinearTransform{}, 0},
+		{"39:0.1", map[int]LinearTransform{39: {Scale: 0.1}}, 0},
+		{"39:0.1:0, 5:1:-40", map[int]LinearTransform{39: {Scale: 0.1}, 5: {Scale: 1, Offset: -40}}, 0},
+		{"39", map[int]LinearTransform{}, 1},
+		{"x:1", map[int]LinearTransform{}, 1},
+		{"39:big", map[int]LinearTransform{}, 1},
+		{"39:1:low,5:2", map[int]LinearTransform{5: {Scale: 2}}, 1},
+		{"39:1:2:3", map[int]LinearTransform{}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, warnings := ParseTransforms(tt.raw)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ParseTransforms(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+			if len(warnings) != tt.wantWarns {
+				t.Errorf("warnings %q, want %d", warnings, tt.wantWarns)
+			}
+		})
+	}
+}
+
+func TestApplyTransforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform string
+		speed     *float64
+		want      *float64
+		wantWarns int
+	}{
+		{"none", "", ptr(100), ptr(100), 0},
+		{"scale", "2:0.5", ptr(100), ptr(50), 0},
+		{"scale and offset", "2:1.609344:-1", ptr(100), ptr(159.9344), 0},
+		{"missing value stays missing", "2:0.5", nil, nil, 0},
+		{"unmonitored sensor", "2:0.5,14:2", ptr(100), ptr(50), 1},
+	}
+	defer SetMonitoredSensors(GetMonitoredSensors())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BYD_HASS_SENSOR_IDS", "2,33")
+			ConfigWarnings = nil
+			SetMonitoredSensors(attachTransforms(loadMonitoredSensorsFromEnv(), tt.transform))
+			if len(ConfigWarnings) != tt.wantWarns {
+				t.Errorf("warnings %q, want %d", ConfigWarnings, tt.wantWarns)
+			}
+			var raw *float64
+			if tt.speed != nil {
+				raw = ptr(*tt.speed)
+			}
+			data := &SensorData{Speed: raw, BatteryPercentage: ptr(80)}
+			ApplyTransforms(data)
+			if fmt.Sprint(deref(data.Speed)) != fmt.Sprint(deref(tt.want)) {
+				t.Errorf("speed = %v, want %v", deref(data.Speed), deref(tt.want))
+			}
+			if *data.BatteryPercentage != 80 {
+				t.Errorf("untransformed sensor changed to %g", *data.BatteryPercentage)
+			}
+			if raw != nil && *raw != *tt.speed {
+				t.Errorf("raw reading modified in place")
+			}
+		})
+	}
+}
+
+func ptr(v float64) *float64 { return &v }
+
+func deref(p *float64) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
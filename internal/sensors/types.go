@@ -1,6 +1,7 @@
 package sensors
 
 import (
+	"reflect"
 	"time"
 	"github.com/Allthebester/byd-hass/internal/location"
 )
@@ -11,13 +12,13 @@ type SensorData struct {
 	Timestamp time.Time `json:"timestamp"`
 
 	// --- Core Vehicle Data ---
-	Speed            *float64 `json:"speed,omitempty"`
-	Mileage          *float64 `json:"mileage,omitempty"`
-	GearPosition     *float64 `json:"gear_position,omitempty"`
-	PowerStatus      *float64 `json:"power_status,omitempty"`
-	SteeringAngle    *float64 `json:"steering_angle,omitempty"`
-	AcceleratorDepth *float64 `json:"accelerator_depth,omitempty"`
-	BrakeDepth       *float64 `json:"brake_depth,omitempty"`
+	Speed                 *float64 `json:"speed,omitempty"`
+	Mileage               *float64 `json:"mileage,omitempty"`
+	GearPosition          *float64 `json:"gear_position,omitempty"`
+	PowerStatus           *float64 `json:"power_status,omitempty"`
+	SteeringAngle         *float64 `json:"steering_angle,omitempty"`
+	AcceleratorPedalDepth *float64 `json:"accelerator_pedal_depth,omitempty"`
+	BrakePedalDepth       *float64 `json:"brake_pedal_depth,omitempty"`
 
 	// --- Powertrain & Battery ---
 	EnginePower           *float64 `json:"engine_power,omitempty"`
@@ -154,6 +155,65 @@ type SensorData struct {
 	Day      *float64               `json:"day,omitempty"`
 	Hour     *float64               `json:"hour,omitempty"`
 	Minute   *float64               `json:"minute,omitempty"`
+
+	// --- Derived ---
+	// Charging is filled in by ChargingStateTracker; it has no Diplus ID.
+	Charging *ChargingState `json:"charging,omitempty"`
+	// DrivingState is the debounced DrivingStateTracker value.
+	DrivingState *string `json:"driving_state,omitempty"`
+	// ChargeSession is the ongoing or last completed session from ChargeSessionTracker.
+	ChargeSession *ChargeSession `json:"charge_session,omitempty"`
+	// EfficiencyWhKM is the rolling consumption from EfficiencyTracker.
+	EfficiencyWhKM *float64 `json:"efficiency_wh_km,omitempty"`
+	// ConsumptionKWh100KM is the rolling consumption behind RangeEstimateKM
+	// (see RollingRangeKM); both are nil until enough distance was driven.
+	ConsumptionKWh100KM *float64 `json:"consumption_kwh_100km,omitempty"`
+	RangeEstimateKM     *float64 `json:"range_estimate_km,omitempty"`
+	// CurrentTrip is the drive in progress and LastTrip the last completed
+	// one, from DriveSessionTracker.
+	CurrentTrip *DriveSession `json:"current_trip,omitempty"`
+	LastTrip    *DriveSession `json:"last_trip,omitempty"`
+	// DoorsOpen, WindowsOpen and VehicleLocked are the DeriveAggregates
+	// sensors; nil while a member sensor has no value.
+	DoorsOpen     *Aggregate `json:"doors_open,omitempty"`
+	WindowsOpen   *Aggregate `json:"windows_open,omitempty"`
+	VehicleLocked *Aggregate `json:"vehicle_locked,omitempty"`
+	// DoorsOpenCount and WindowsOpenCount count the open side doors and
+	// windows (see DeriveAggregates).
+	DoorsOpenCount   *float64 `json:"doors_open_count,omitempty"`
+	WindowsOpenCount *float64 `json:"windows_open_count,omitempty"`
+	// TirePressureImbalance (bar) and TirePressureWarning are the
+	// DeriveTirePressure sensors.
+	TirePressureImbalance *float64   `json:"tire_pressure_imbalance,omitempty"`
+	TirePressureWarning   *Aggregate `json:"tire_pressure_warning,omitempty"`
+	// CabinComfort is the DeriveCabinComfort score (0–100).
+	CabinComfort *float64 `json:"cabin_comfort,omitempty"`
+	// Battery12VLow and Battery12VTrend (V/day) are the Battery12VTracker
+	// sensors.
+	Battery12VLow   *bool    `json:"battery_12v_low,omitempty"`
+	Battery12VTrend *float64 `json:"battery_12v_trend,omitempty"`
+	// BatteryTempSpread is the pack temperature spread (°C) and
+	// BatteryThermalState the BatteryThermalTracker state.
+	BatteryTempSpread   *float64 `json:"battery_temp_spread,omitempty"`
+	BatteryThermalState *string  `json:"battery_thermal_state,omitempty"`
+	// DistanceToday and DistanceWeek are the DistanceTracker totals.
+	DistanceToday *DistancePeriod `json:"distance_today,omitempty"`
+	DistanceWeek  *DistancePeriod `json:"distance_week,omitempty"`
+	// LocationZone is the geofence zone of Location (see location.Geofence).
+	LocationZone *string `json:"location_zone,omitempty"`
+	// EventTimes holds the parsed timestamp sensors by key, see
+	// DeriveEventTimes.
+	EventTimes map[string]time.Time `json:"event_times,omitempty"`
+	// KeepaliveMinutes is how long the collector has polled with the car off
+	// since the last drive; DiplusRequestsToday counts the Diplus requests
+	// since local midnight.
+	KeepaliveMinutes    *float64 `json:"head_unit_keepalive_minutes,omitempty"`
+	DiplusRequestsToday *float64 `json:"diplus_requests_today,omitempty"`
+	// PollMode is the collector's poll mode (PollModeActive or PollModeSleeping).
+	PollMode *string `json:"poll_mode,omitempty"`
+	// Smoothed holds, by sensor ID, the smoothed values published as
+	// additional <name>_smoothed sensors (see Smoother).
+	Smoothed map[int]float64 `json:"smoothed,omitempty"`
 }
 
 // SensorDefinition provides metadata for a sensor.
@@ -166,6 +226,32 @@ type SensorDefinition struct {
 	DeviceClass       string
 	UnitOfMeasurement string
 	ScaleFactor       float64
+	StateClass        string  // Home-Assistant state_class ("measurement", "total_increasing", …)
+	Min               float64 // Plausible minimum (after scaling); Min == Max == 0 means unbounded
+	Max               float64 // Plausible maximum (after scaling)
+}
+
+// IsSignalStrength reports whether the sensor is a radio signal strength,
+// defined in dBm; some head-units report a 0–100 quality instead (see
+// ObserveSignalStrength).
+func (d SensorDefinition) IsSignalStrength() bool {
+	return d.DeviceClass == "signal_strength" && d.UnitOfMeasurement == "dBm"
+}
+
+// Clamp limits value to the sensor's plausible range. The second result is
+// false when value was outside the range, i.e. the reading is implausible and
+// should not be published. Sensors without a range accept every value.
+func (d SensorDefinition) Clamp(value float64) (float64, bool) {
+	if d.Min == 0 && d.Max == 0 {
+		return value, true
+	}
+	if value < d.Min {
+		return d.Min, false
+	}
+	if value > d.Max {
+		return d.Max, false
+	}
+	return value, true
 }
 
 // ----------------------------------------------------------------------------
@@ -184,136 +270,141 @@ type SensorDefinition struct {
 //	DeviceClass   – Optional Home-Assistant device_class (speed, voltage, …)
 //	Unit          – Unit of measurement (km/h, °C, %, …) – empty if unit-less
 //	ScaleFactor   – Multiply raw value by this to obtain the real value (1 = none)
+//	StateClass    – Optional Home-Assistant state_class; needed for long-term
+//	                statistics ("measurement") and the energy dashboard
+//	                ("total_increasing" for odometer / energy counters)
+//	Min, Max      – Plausible value range (after scaling); readings outside it
+//	                are dropped by RangeValidator. 0, 0 = unbounded
 //
 // Whenever you add / remove a field in SensorData **make sure** to update this
 // slice accordingly; build failures will warn you if you forget.
 // ----------------------------------------------------------------------------
 var AllSensors = []SensorDefinition{
-	{1, "PowerStatus", "电源状态", "Power Status", "sensor", "", "", 1},
-	{2, "Speed", "车速", "Speed", "sensor", "speed", "km/h", 1},
-	{3, "Mileage", "里程", "Mileage", "sensor", "distance", "km", 0.1},
-	{4, "GearPosition", "档位", "Gear Position", "sensor", "", "", 1},
-	{5, "EngineRPM", "发动机转速", "Engine RPM", "sensor", "", "rpm", 1},
-	{6, "BrakePedalDepth", "刹车深度", "Brake Pedal Depth", "sensor", "", "%", 1},
-	{7, "AcceleratorPedalDepth", "加速踏板深度", "Accelerator Pedal Depth", "sensor", "", "%", 1},
-	{8, "FrontMotorRPM", "前电机转速", "Front Motor RPM", "sensor", "", "rpm", 1},
-	{9, "RearMotorRPM", "后电机转速", "Rear Motor RPM", "sensor", "", "rpm", 1},
-	{10, "EnginePower", "发动机功率", "Engine Power", "sensor", "power", "kW", 1},
-	{11, "FrontMotorTorque", "前电机扭矩", "Front Motor Torque", "sensor", "", "Nm", 1},
-	{12, "ChargeGunState", "充电枪插枪状态", "Charge Gun State", "binary_sensor", "", "", 1},
-	{13, "PowerConsumption100KM", "百公里电耗", "Power consumption per 100 kilometers", "sensor", "", "kWh/100km", 1},
-	{14, "MaxBatteryTemp", "最高电池温度", "Maximum Battery Temperature", "sensor", "temperature", "°C", 1},
-	{15, "AvgBatteryTemp", "平均电池温度", "Average Battery Temperature", "sensor", "temperature", "°C", 1},
-	{16, "MinBatteryTemp", "最低电池温度", "Minimum Battery Temperature", "sensor", "", "°C", 1},
-	{17, "MaxBatteryVoltage", "最高电池电压", "Max Battery Voltage", "sensor", "voltage", "V", 1}, // This is the 12V battery voltage
-	{18, "MinBatteryVoltage", "最低电池电压", "Minimum Battery Voltage", "sensor", "", "V", 1},
-	{19, "LastWiperTime", "上次雨刮时间", "Last Wiper Time", "sensor", "", "", 1},
-	{20, "Weather", "天气", "Weather", "sensor", "", "", 1},
-	{21, "DriverSeatBeltStatus", "主驾驶安全带状态", "Driver's seat belt status", "sensor", "", "", 1},
-	{22, "RemoteLockStatus", "远程锁车状态", "Remote Lock Status", "sensor", "", "", 1},
+	{1, "PowerStatus", "电源状态", "Power Status", "sensor", "", "", 1, "", 0, 0},
+	{2, "Speed", "车速", "Speed", "sensor", "speed", "km/h", 1, "measurement", 0, 250},
+	{3, "Mileage", "里程", "Mileage", "sensor", "distance", "km", 0.1, "total_increasing", 0, 10000000},
+	{4, "GearPosition", "档位", "Gear Position", "sensor", "", "", 1, "", 0, 0},
+	{5, "EngineRPM", "发动机转速", "Engine RPM", "sensor", "", "rpm", 1, "measurement", 0, 0},
+	{6, "BrakePedalDepth", "刹车深度", "Brake Pedal Depth", "sensor", "", "%", 1, "measurement", 0, 100},
+	{7, "AcceleratorPedalDepth", "加速踏板深度", "Accelerator Pedal Depth", "sensor", "", "%", 1, "measurement", 0, 100},
+	{8, "FrontMotorRPM", "前电机转速", "Front Motor RPM", "sensor", "", "rpm", 1, "measurement", 0, 0},
+	{9, "RearMotorRPM", "后电机转速", "Rear Motor RPM", "sensor", "", "rpm", 1, "measurement", 0, 0},
+	{10, "EnginePower", "发动机功率", "Engine Power", "sensor", "power", "kW", 1, "measurement", -500, 500},
+	{11, "FrontMotorTorque", "前电机扭矩", "Front Motor Torque", "sensor", "", "Nm", 1, "measurement", 0, 0},
+	{12, "ChargeGunState", "充电枪插枪状态", "Charge Gun State", "binary_sensor", "", "", 1, "", 0, 0},
+	{13, "PowerConsumption100KM", "百公里电耗", "Power consumption per 100 kilometers", "sensor", "", "kWh/100km", 1, "measurement", 0, 0},
+	{14, "MaxBatteryTemp", "最高电池温度", "Maximum Battery Temperature", "sensor", "temperature", "°C", 1, "measurement", -40, 90},
+	{15, "AvgBatteryTemp", "平均电池温度", "Average Battery Temperature", "sensor", "temperature", "°C", 1, "measurement", -40, 90},
+	{16, "MinBatteryTemp", "最低电池温度", "Minimum Battery Temperature", "sensor", "temperature", "°C", 1, "measurement", -40, 90},
+	{17, "MaxBatteryVoltage", "最高电池电压", "Max Battery Voltage", "sensor", "voltage", "V", 1, "measurement", 0, 0}, // This is the 12V battery voltage
+	{18, "MinBatteryVoltage", "最低电池电压", "Minimum Battery Voltage", "sensor", "voltage", "V", 1, "measurement", 0, 0},
+	{19, "LastWiperTime", "上次雨刮时间", "Last Wiper Time", "sensor", "", "", 1, "", 0, 0},
+	{20, "Weather", "天气", "Weather", "sensor", "", "", 1, "", 0, 0},
+	{21, "DriverSeatBeltStatus", "主驾驶安全带状态", "Driver's seat belt status", "sensor", "", "", 1, "", 0, 0},
+	{22, "RemoteLockStatus", "远程锁车状态", "Remote Lock Status", "sensor", "", "", 1, "", 0, 0},
 	// what is ID 23 and 24? not documeneted in the spec.
-	{25, "CabinTemperature", "车内温度", "Cabin Temperature", "sensor", "", "°C", 1},
-	{26, "OutsideTemperature", "车外温度", "Outside Temperature", "sensor", "temperature", "°C", 1},
-	{27, "DriverACTemp", "主驾驶空调温度", "Driver AC temperature", "sensor", "temperature", "°C", 1},
-	{28, "TemperatureUnit", "温度单位", "Temperature unit", "sensor", "", "", 1},
-	{29, "BatteryCapacity", "电池容量", "Battery Capacity", "sensor", "energy_storage", "kWh", 1}, // seems to be 0 all the time?
-	{30, "SteeringWheelAngle", "方向盘转角", "Steering Wheel Angle", "sensor", "", "°", 1},
-	{31, "SteeringWheelSpeed", "方向盘转速", "Steering Sheel Speed", "sensor", "", "°/s", 1},
-	{32, "TotalPowerConsumption", "总电耗", "Total Power Consumption", "sensor", "", "kWh", 1},
-	{33, "BatteryPercentage", "电量百分比", "Battery Percentage", "sensor", "battery", "%", 1},
-	{34, "FuelPercentage", "油量百分比", "Fuel Percentage", "sensor", "battery", "%", 1},
-	{35, "TotalFuelConsumption", "总燃油消耗", "Total Fuel Consumption", "sensor", "", "L", 1},
-	{36, "LaneLineCurvature", "车道线曲率", "Lane Line Curvature", "sensor", "", "", 1},
-	{37, "RightLaneDistance", "右侧线距离", "Right Lane Distance", "sensor", "", "", 1},
-	{38, "LeftLaneDistance", "左侧线距离", "Left Lane Distance", "sensor", "", "", 1},
-	{39, "BatteryVoltage", "蓄电池电压", "Battery Voltage", "sensor", "", "", 1}, // seems to be 0 all the time?
-	{40, "RadarLeftFront", "雷达左前", "Radar Left Front", "sensor", "", "m", 1},
-	{41, "RadarRightFront", "雷达右前", "Radar Right Front", "sensor", "", "m", 1},
-	{42, "RadarLeftRear", "雷达左后", "Radar Left Rear", "sensor", "", "m", 1},
-	{43, "RadarRightRear", "雷达右后", "Radar Right Rear", "sensor", "", "m", 1},
-	{44, "RadarLeft", "雷达左", "Radar Left", "sensor", "", "m", 1},
-	{45, "RadarFrontLeftCenter", "雷达前左中", "Radar Front Left Center", "sensor", "distance", "m", 1},
-	{46, "RadarFrontRightCenter", "雷达前右中", "Radar Front Right Center", "sensor", "distance", "m", 1},
-	{47, "RadarCenterRear", "雷达中后", "Radar Center Rear", "sensor", "distance", "m", 1},
-	{48, "FrontWiperSpeed", "前雨刮速度", "Front Wiper Speed", "sensor", "", "", 1},
-	{49, "WiperGear", "雨刮档位", "WiperGear", "sensor", "", "", 1},
-	{50, "CruiseSwitch", "巡航开关", "Cruise Switch", "sensor", "", "", 1},
-	{51, "DistanceToVehicleAhead", "前车距离", "Distance To The Vehicle Ahead", "sensor", "distance", "m", 1},
-	{52, "ChargingStatus", "充电状态", "Charging Status", "sensor", "", "", 1},
-	{53, "LeftFrontTirePressure", "左前轮气压", "Left Front Tire Pressure", "sensor", "pressure", "bar", 0.01},
-	{54, "RightFrontTirePressure", "右前轮气压", "Right Front Tire Pressure", "sensor", "pressure", "bar", 0.01},
-	{55, "LeftRearTirePressure", "左后轮气压", "Left Rear Tire Pressure", "sensor", "pressure", "bar", 0.01},
-	{56, "RightRearTirePressure", "右后轮气压", "Right Rear Tire Pressure", "sensor", "pressure", "bar", 0.01},
-	{57, "LeftTurnSignal", "左转向灯", "Left Turn Signal", "binary_sensor", "", "", 1},
-	{58, "RightTurnSignal", "右转向灯", "Right Turn Signal", "sensor", "", "", 1},
-	{59, "DriverDoorLock", "主驾车门锁", "Driver Door Lock", "sensor", "", "", 1},
+	{25, "CabinTemperature", "车内温度", "Cabin Temperature", "sensor", "temperature", "°C", 1, "measurement", -40, 85},
+	{26, "OutsideTemperature", "车外温度", "Outside Temperature", "sensor", "temperature", "°C", 1, "measurement", -50, 60},
+	{27, "DriverACTemp", "主驾驶空调温度", "Driver AC temperature", "sensor", "temperature", "°C", 1, "measurement", 0, 0},
+	{28, "TemperatureUnit", "温度单位", "Temperature unit", "sensor", "", "", 1, "", 0, 0},
+	{29, "BatteryCapacity", "电池容量", "Battery Capacity", "sensor", "energy_storage", "kWh", 1, "measurement", 0, 200}, // seems to be 0 all the time?
+	{30, "SteeringWheelAngle", "方向盘转角", "Steering Wheel Angle", "sensor", "", "°", 1, "measurement", 0, 0},
+	{31, "SteeringWheelSpeed", "方向盘转速", "Steering Sheel Speed", "sensor", "", "°/s", 1, "measurement", 0, 0},
+	{32, "TotalPowerConsumption", "总电耗", "Total Power Consumption", "sensor", "energy", "kWh", 1, "total_increasing", 0, 10000000},
+	{33, "BatteryPercentage", "电量百分比", "Battery Percentage", "sensor", "battery", "%", 1, "measurement", 0, 100},
+	{34, "FuelPercentage", "油量百分比", "Fuel Percentage", "sensor", "battery", "%", 1, "measurement", 0, 100},
+	{35, "TotalFuelConsumption", "总燃油消耗", "Total Fuel Consumption", "sensor", "", "L", 1, "total_increasing", 0, 0},
+	{36, "LaneLineCurvature", "车道线曲率", "Lane Line Curvature", "sensor", "", "", 1, "", 0, 0},
+	{37, "RightLaneDistance", "右侧线距离", "Right Lane Distance", "sensor", "", "", 1, "", 0, 0},
+	{38, "LeftLaneDistance", "左侧线距离", "Left Lane Distance", "sensor", "", "", 1, "", 0, 0},
+	{39, "BatteryVoltage12V", "蓄电池电压", "Battery Voltage", "sensor", "voltage", "V", 1, "measurement", 0, 0}, // seems to be 0 all the time?
+	{40, "RadarLeftFront", "雷达左前", "Radar Left Front", "sensor", "distance", "m", 1, "measurement", 0, 0},
+	{41, "RadarRightFront", "雷达右前", "Radar Right Front", "sensor", "distance", "m", 1, "measurement", 0, 0},
+	{42, "RadarLeftRear", "雷达左后", "Radar Left Rear", "sensor", "distance", "m", 1, "measurement", 0, 0},
+	{43, "RadarRightRear", "雷达右后", "Radar Right Rear", "sensor", "distance", "m", 1, "measurement", 0, 0},
+	{44, "RadarLeft", "雷达左", "Radar Left", "sensor", "distance", "m", 1, "measurement", 0, 0},
+	{45, "RadarFrontLeftCenter", "雷达前左中", "Radar Front Left Center", "sensor", "distance", "m", 1, "measurement", 0, 0},
+	{46, "RadarFrontRightCenter", "雷达前右中", "Radar Front Right Center", "sensor", "distance", "m", 1, "measurement", 0, 0},
+	{47, "RadarCenterRear", "雷达中后", "Radar Center Rear", "sensor", "distance", "m", 1, "measurement", 0, 0},
+	{48, "FrontWiperSpeed", "前雨刮速度", "Front Wiper Speed", "sensor", "", "", 1, "", 0, 0},
+	{49, "WiperGear", "雨刮档位", "WiperGear", "sensor", "", "", 1, "", 0, 0},
+	{50, "CruiseSwitch", "巡航开关", "Cruise Switch", "sensor", "", "", 1, "", 0, 0},
+	{51, "DistanceToVehicleAhead", "前车距离", "Distance To The Vehicle Ahead", "sensor", "distance", "m", 1, "measurement", 0, 0},
+	{52, "ChargingStatus", "充电状态", "Charging Status", "sensor", "", "", 1, "", 0, 0},
+	{53, "LeftFrontTirePressure", "左前轮气压", "Left Front Tire Pressure", "sensor", "pressure", "bar", 0.01, "measurement", 0, 6},
+	{54, "RightFrontTirePressure", "右前轮气压", "Right Front Tire Pressure", "sensor", "pressure", "bar", 0.01, "measurement", 0, 6},
+	{55, "LeftRearTirePressure", "左后轮气压", "Left Rear Tire Pressure", "sensor", "pressure", "bar", 0.01, "measurement", 0, 6},
+	{56, "RightRearTirePressure", "右后轮气压", "Right Rear Tire Pressure", "sensor", "pressure", "bar", 0.01, "measurement", 0, 6},
+	{57, "LeftTurnSignal", "左转向灯", "Left Turn Signal", "binary_sensor", "", "", 1, "", 0, 0},
+	{58, "RightTurnSignal", "右转向灯", "Right Turn Signal", "sensor", "", "", 1, "", 0, 0},
+	{59, "DriverDoorLock", "主驾车门锁", "Driver Door Lock", "sensor", "", "", 1, "", 0, 0},
 	// what is ID 60? not documeneted in the spec.
-	{61, "DriverWindowOpenPercentage", "主驾车窗打开百分比", "Driver Window Open Percentage", "sensor", "", "%", 1},
-	{62, "PassengerWindowOpenPercentage", "副驾车窗打开百分比", "Passenger Window Open Percentage", "sensor", "", "%", 1},
-	{63, "LeftLearWindowOpenPercentage", "左后车窗打开百分比", "Left Rear Window Open Percentage", "sensor", "", "%", 1},
-	{64, "RightRearWindowOpenPercentage", "右后车窗打开百分比", "Right Rear Window Open Percentage", "sensor", "", "%", 1},
-	{65, "SunroofOpenPercentage", "天窗打开百分比", "Sunroof Open Percentage", "sensor", "", "%", 1},
-	{66, "SunshadeOpenPercentage", "遮阳帘打开百分比", "SunshadeOpenPercentage", "sensor", "", "%", 1},
-	{67, "VehicleWorkingMode", "整车工作模式", "Vehicle Working Mode", "sensor", "", "", 1},
-	{68, "VehicleOperationMode", "整车运行模式", "Vehicle Operation Mode", "sensor", "", "", 1},
-	{69, "Month", "月", "Month", "sensor", "", "", 1},
-	{70, "Day", "日", "Day", "sensor", "", "", 1},
-	{71, "Hour", "时", "Hour", "sensor", "", "", 1},
-	{72, "Year", "分", "Year", "sensor", "", "", 1},
-	{73, "PassengerSeatBeltWarning", "副驾安全带警告", "Passenger Seat Belt Warning", "sensor", "", "", 1},
-	{74, "SecondRowLeftSeatBelt", "二排左安全带", "Second Row Left Seat Belt", "sensor", "", "", 1},
-	{75, "SecondRowRightSeatBelt", "二排右安全带", "Second Row Right Seat Belt", "sensor", "", "", 1},
-	{76, "Second Row Center Seat Belt", "二排中安全带", "Second Row Center Seat Belt", "sensor", "", "", 1},
-	{77, "ACStatus", "空调状态", "AC Status", "sensor", "", "", 1},
-	{78, "FanSpeedLevel", "风量档位", "Fan Speed Level", "sensor", "", "", 1},
-	{79, "ACCirculationMode", "空调循环方式", "AC Circulation Mode", "sensor", "", "", 1},
-	{80, "ACBlowingMode", "空调出风模式", "AC Blowing Mode", "sensor", "", "", 1},
-	{81, "DriverDoor", "主驾车门", "Driver Door", "sensor", "", "", 1},
-	{82, "PassengerDoor", "副驾车门", "Passenger Door", "sensor", "", "", 1},
-	{83, "LeftRearDoor", "左后车门", "Left Rear Door", "sensor", "", "", 1},
-	{84, "RightRearDoor", "右后车门", "Right Rear Door", "sensor", "", "", 1},
-	{85, "Hood", "引擎盖", "Hood", "sensor", "", "", 1},
-	{86, "Trunk", "后备箱门", "Trunk", "sensor", "", "", 1},
-	{87, "FuelTankCap", "油箱盖", "Fuel Tank Cap", "sensor", "", "", 1},
-	{88, "AutomaticParking", "自动驻车", "Automatic Parking", "sensor", "", "", 1},
-	{89, "ACCCruiseStatus", "ACC巡航状态", "ACC Cruise Status", "sensor", "", "", 1},
-	{90, "LeftRearApproachWarning", "左后接近告警", "Left Rear Approach Warning", "sensor", "", "", 1},
-	{91, "RightRearApproachWarning", "右后接近告警", "Right Rear Approach Warning", "sensor", "", "", 1},
-	{92, "Lane Keeping Status", "车道保持状态", "Lane Keeping Status", "sensor", "", "", 1},
-	{93, "LeftRearDoorLock", "左后车门锁", "Left Rear Door Lock", "sensor", "", "", 1},
-	{94, "PassengerDoorLock", "副驾车门锁", "Passenger Door Lock", "sensor", "", "", 1},
-	{95, "RightRearDoorLock", "上次雨刮时间", "Right Rear Door Lock", "sensor", "", "", 1},
-	{96, "TrunkDoorLock", "后备箱门锁", "Trunk Toor Lock", "sensor", "", "", 1},
-	{97, "LeftRearChildLock", "左后儿童锁", "Left Rear Child Lock", "sensor", "", "", 1},
-	{98, "RightRearChildLock", "右后儿童锁", "Right Rear Child Lock", "sensor", "", "", 1},
-	{99, "LowBeam", "小灯", "Low Beam", "sensor", "", "", 1},
-	{100, "LowBeam2", "近光灯", "Low Beam", "sensor", "", "", 1},
-	{101, "HighBeam", "远光灯", "High Beam", "sensor", "lock", "", 1},
+	{61, "DriverWindowOpenPercentage", "主驾车窗打开百分比", "Driver Window Open Percentage", "sensor", "", "%", 1, "measurement", 0, 100},
+	{62, "PassengerWindowOpenPercentage", "副驾车窗打开百分比", "Passenger Window Open Percentage", "sensor", "", "%", 1, "measurement", 0, 100},
+	{63, "LeftLearWindowOpenPercentage", "左后车窗打开百分比", "Left Rear Window Open Percentage", "sensor", "", "%", 1, "measurement", 0, 100},
+	{64, "RightRearWindowOpenPercentage", "右后车窗打开百分比", "Right Rear Window Open Percentage", "sensor", "", "%", 1, "measurement", 0, 100},
+	{65, "SunroofOpenPercentage", "天窗打开百分比", "Sunroof Open Percentage", "sensor", "", "%", 1, "measurement", 0, 100},
+	{66, "SunshadeOpenPercentage", "遮阳帘打开百分比", "SunshadeOpenPercentage", "sensor", "", "%", 1, "measurement", 0, 100},
+	{67, "VehicleWorkingMode", "整车工作模式", "Vehicle Working Mode", "sensor", "", "", 1, "", 0, 0},
+	{68, "VehicleOperationMode", "整车运行模式", "Vehicle Operation Mode", "sensor", "", "", 1, "", 0, 0},
+	{69, "Month", "月", "Month", "sensor", "", "", 1, "", 0, 0},
+	{70, "Day", "日", "Day", "sensor", "", "", 1, "", 0, 0},
+	{71, "Hour", "时", "Hour", "sensor", "", "", 1, "", 0, 0},
+	{72, "Year", "分", "Year", "sensor", "", "", 1, "", 0, 0},
+	{73, "PassengerSeatBeltWarning", "副驾安全带警告", "Passenger Seat Belt Warning", "sensor", "", "", 1, "", 0, 0},
+	{74, "SecondRowLeftSeatBelt", "二排左安全带", "Second Row Left Seat Belt", "sensor", "", "", 1, "", 0, 0},
+	{75, "SecondRowRightSeatBelt", "二排右安全带", "Second Row Right Seat Belt", "sensor", "", "", 1, "", 0, 0},
+	{76, "Second Row Center Seat Belt", "二排中安全带", "Second Row Center Seat Belt", "sensor", "", "", 1, "", 0, 0},
+	{77, "ACStatus", "空调状态", "AC Status", "sensor", "", "", 1, "", 0, 0},
+	{78, "FanSpeedLevel", "风量档位", "Fan Speed Level", "sensor", "", "", 1, "", 0, 0},
+	{79, "ACCirculationMode", "空调循环方式", "AC Circulation Mode", "sensor", "", "", 1, "", 0, 0},
+	{80, "ACBlowingMode", "空调出风模式", "AC Blowing Mode", "sensor", "", "", 1, "", 0, 0},
+	{81, "DriverDoor", "主驾车门", "Driver Door", "sensor", "", "", 1, "", 0, 0},
+	{82, "PassengerDoor", "副驾车门", "Passenger Door", "sensor", "", "", 1, "", 0, 0},
+	{83, "LeftRearDoor", "左后车门", "Left Rear Door", "sensor", "", "", 1, "", 0, 0},
+	{84, "RightRearDoor", "右后车门", "Right Rear Door", "sensor", "", "", 1, "", 0, 0},
+	{85, "Hood", "引擎盖", "Hood", "sensor", "", "", 1, "", 0, 0},
+	{86, "Trunk", "后备箱门", "Trunk", "sensor", "", "", 1, "", 0, 0},
+	{87, "FuelTankCap", "油箱盖", "Fuel Tank Cap", "sensor", "", "", 1, "", 0, 0},
+	{88, "AutomaticParking", "自动驻车", "Automatic Parking", "sensor", "", "", 1, "", 0, 0},
+	{89, "ACCCruiseStatus", "ACC巡航状态", "ACC Cruise Status", "sensor", "", "", 1, "", 0, 0},
+	{90, "LeftRearApproachWarning", "左后接近告警", "Left Rear Approach Warning", "sensor", "", "", 1, "", 0, 0},
+	{91, "RightRearApproachWarning", "右后接近告警", "Right Rear Approach Warning", "sensor", "", "", 1, "", 0, 0},
+	{92, "Lane Keeping Status", "车道保持状态", "Lane Keeping Status", "sensor", "", "", 1, "", 0, 0},
+	{93, "LeftRearDoorLock", "左后车门锁", "Left Rear Door Lock", "sensor", "", "", 1, "", 0, 0},
+	{94, "PassengerDoorLock", "副驾车门锁", "Passenger Door Lock", "sensor", "", "", 1, "", 0, 0},
+	{95, "RightRearDoorLock", "上次雨刮时间", "Right Rear Door Lock", "sensor", "", "", 1, "", 0, 0},
+	{96, "TrunkDoorLock", "后备箱门锁", "Trunk Toor Lock", "sensor", "", "", 1, "", 0, 0},
+	{97, "LeftRearChildLock", "左后儿童锁", "Left Rear Child Lock", "sensor", "", "", 1, "", 0, 0},
+	{98, "RightRearChildLock", "右后儿童锁", "Right Rear Child Lock", "sensor", "", "", 1, "", 0, 0},
+	{99, "LowBeam", "小灯", "Low Beam", "sensor", "", "", 1, "", 0, 0},
+	{100, "LowBeam2", "近光灯", "Low Beam", "sensor", "", "", 1, "", 0, 0},
+	{101, "HighBeam", "远光灯", "High Beam", "sensor", "", "", 1, "", 0, 0},
 	// what is ID 102 and 103? not documeneted in the spec.
-	{104, "FrontFogLamp", "前雾灯", "Front Fog Lamp", "sensor", "", "", 1},
-	{105, "RearFogLamp", "后雾灯", "Rear Fog Lamp", "sensor", "", "", 1},
-	{106, "Footlights", "脚照灯", "Footlights", "sensor", "", "", 1},
-	{107, "DaytimeRunningLights", "日行灯", "Daytime Running Lights", "sensor", "", "", 1},
-	{108, "EngineWaterTemperature", "发动机水温", "Engine Water Temperature", "sensor", "", "°C", 1},
-	{109, "DoubleFlash", "双闪", "DoubleFlash", "sensor", "", "", 1},
+	{104, "FrontFogLamp", "前雾灯", "Front Fog Lamp", "sensor", "", "", 1, "", 0, 0},
+	{105, "RearFogLamp", "后雾灯", "Rear Fog Lamp", "sensor", "", "", 1, "", 0, 0},
+	{106, "Footlights", "脚照灯", "Footlights", "sensor", "", "", 1, "", 0, 0},
+	{107, "DaytimeRunningLights", "日行灯", "Daytime Running Lights", "sensor", "", "", 1, "", 0, 0},
+	{108, "EngineWaterTemperature", "发动机水温", "Engine Water Temperature", "sensor", "temperature", "°C", 1, "measurement", -40, 150},
+	{109, "DoubleFlash", "双闪", "DoubleFlash", "sensor", "", "", 1, "", 0, 0},
 
-	{1001, "PanoramaStatus", "熄火录制配置", "PanoramaStatus", "sensor", "", "", 1},
-	{1002, "ConfigUIVer", "熄火哨兵警报", "Configuration UI Version", "sensor", "", "", 1},
-	{1003, "SentryStatus", "WiFi状态", "Sentry Status", "sensor", "", "", 1},
-	{1004, "RecordingConfigSwitch", "蓝牙状态", "Recording Configuration Switch", "sensor", "", "", 1},
-	{1006, "SentryAlarm", "蓝牙信号强度", "Sentry Alarm", "sensor", "signal_strength", "dBm", 1},
-	{1007, "WIFIStatus", "上次哨兵触发时间", "WIFI Status", "sensor", "", "", 1},
-	{1008, "BluetoothStatus", "上次哨兵触发图像", "Bluetooth Status", "sensor", "", "", 1},
-	{1009, "BluetoothSignalStrength", "上次录像开始时间", "Bluetooth Signal Strength", "sensor", "signal_strength", "dBm", 1},
-	{1101, "WirelessADBSwitch", "上次录像结束时间", "Wireless ADB Switch", "sensor", "", "", 1},
+	{1001, "PanoramaStatus", "熄火录制配置", "PanoramaStatus", "sensor", "", "", 1, "", 0, 0},
+	{1002, "ConfigUIVer", "熄火哨兵警报", "Configuration UI Version", "sensor", "", "", 1, "", 0, 0},
+	{1003, "SentryStatus", "WiFi状态", "Sentry Status", "sensor", "", "", 1, "", 0, 0},
+	{1004, "RecordingConfigSwitch", "蓝牙状态", "Recording Configuration Switch", "sensor", "", "", 1, "", 0, 0},
+	{1006, "SentryAlarm", "蓝牙信号强度", "Sentry Alarm", "sensor", "signal_strength", "dBm", 1, "measurement", 0, 0},
+	{1007, "WIFIStatus", "上次哨兵触发时间", "WIFI Status", "sensor", "", "", 1, "", 0, 0},
+	{1008, "BluetoothStatus", "上次哨兵触发图像", "Bluetooth Status", "sensor", "", "", 1, "", 0, 0},
+	{1009, "BluetoothSignalStrength", "上次录像开始时间", "Bluetooth Signal Strength", "sensor", "signal_strength", "dBm", 1, "measurement", -127, 100},
+	{1101, "WirelessADBSwitch", "上次录像结束时间", "Wireless ADB Switch", "sensor", "", "", 1, "", 0, 0},
 	
-	{2001, "AIPersonConfidence", "AI识别人可信度", "AI Person Confidence", "sensor", "", "", 1},
-	{2002, "AIVehicleConfidence", "AI识别车可信度", "AI Vehicle Confidence", "sensor", "", "", 1},
-	{2003, "LastSentryTriggerTime", "上次哨兵触发时间", "Last Sentry Trigger Time", "sensor", "", "", 1},
-	{2004, "LastSentryTriggerImage", "上次哨兵触发画面", "Last Sentry Trigger Image", "sensor", "", "", 1},
-	{2005, "LastVideoStartTime", "上次录像文件开始时间", "Last Video Start Time", "sensor", "", "", 1},
-	{2006, "LastVideoEndTime", "上次录像文件结束时间", "Last Video End Time", "sensor", "", "", 1},
-	{2007, "LastVideoPath.", "上次录像路径", "Last Video Path.", "sensor", "", "", 1},
+	{2001, "AIPersonConfidence", "AI识别人可信度", "AI Person Confidence", "sensor", "", "", 1, "", 0, 0},
+	{2002, "AIVehicleConfidence", "AI识别车可信度", "AI Vehicle Confidence", "sensor", "", "", 1, "", 0, 0},
+	{2003, "LastSentryTriggerTime", "上次哨兵触发时间", "Last Sentry Trigger Time", "sensor", "timestamp", "", 1, "", 0, 0},
+	{2004, "LastSentryTriggerImage", "上次哨兵触发画面", "Last Sentry Trigger Image", "sensor", "", "", 1, "", 0, 0},
+	{2005, "LastVideoStartTime", "上次录像文件开始时间", "Last Video Start Time", "sensor", "timestamp", "", 1, "", 0, 0},
+	{2006, "LastVideoEndTime", "上次录像文件结束时间", "Last Video End Time", "sensor", "timestamp", "", 1, "", 0, 0},
+	{2007, "LastVideoPath.", "上次录像路径", "Last Video Path.", "sensor", "", "", 1, "", 0, 0},
 }
 
 // GetSensorByID returns a sensor definition by its ID
@@ -339,3 +430,18 @@ func GetScaleFactor(jsonKey string) float64 {
 	}
 	return factor
 }
+
+// CountValues returns how many sensor fields of data carry a value.
+func CountValues(data *SensorData) int {
+	if data == nil {
+		return 0
+	}
+	n := 0
+	v := reflect.ValueOf(data).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Field(i); f.Kind() == reflect.Ptr && !f.IsNil() {
+			n++
+		}
+	}
+	return n
+}
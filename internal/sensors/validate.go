@@ -0,0 +1,61 @@
+package sensors
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// RangeValidator drops implausible readings (see SensorDefinition.Min/Max)
+// before they reach any transmitter. An out-of-range value is replaced with the
+// last in-range value seen for that sensor, or removed if there is none yet,
+// so a single garbage sample from Diplus (SOC 255, negative speed, …) neither
+// spikes Home Assistant graphs nor reaches ABRP.
+type RangeValidator struct {
+	mu       sync.Mutex
+	lastGood map[int]float64
+}
+
+// NewRangeValidator creates an empty validator.
+func NewRangeValidator() *RangeValidator {
+	return &RangeValidator{lastGood: make(map[int]float64)}
+}
+
+// Apply validates data in place and returns a description of every value that
+// was rejected.
+func (r *RangeValidator) Apply(data *SensorData) []string {
+	if data == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rejected []string
+	v := reflect.ValueOf(data).Elem()
+	for _, def := range AllSensors {
+		if def.Min == 0 && def.Max == 0 {
+			continue
+		}
+		field := v.FieldByName(def.FieldName)
+		if !field.IsValid() || field.Kind() != reflect.Ptr || field.IsNil() {
+			continue
+		}
+		p, ok := field.Interface().(*float64)
+		if !ok {
+			continue
+		}
+
+		if _, ok := def.Clamp(*p); ok {
+			r.lastGood[def.ID] = *p
+			continue
+		}
+
+		rejected = append(rejected, fmt.Sprintf("%s out of range [%g, %g]: %g", def.EnglishName, def.Min, def.Max, *p))
+		if last, ok := r.lastGood[def.ID]; ok {
+			field.Set(reflect.ValueOf(&last))
+		} else {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+	return rejected
+}
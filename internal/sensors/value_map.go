@@ -0,0 +1,118 @@
+package sensors
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValueMap translates the integer states of an enum-style sensor into
+// readable labels, e.g. GearPosition 1 → "P".
+type ValueMap map[int]string
+
+// Label returns the label for v. Values that are not whole numbers or have
+// no entry yield false.
+func (m ValueMap) Label(v float64) (string, bool) {
+	if v != math.Trunc(v) {
+		return "", false
+	}
+	label, ok := m[int(v)]
+	return label, ok
+}
+
+// Options returns the labels ordered by their raw value, as Home Assistant
+// expects for an enum sensor's options.
+func (m ValueMap) Options() []string {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	opts := make([]string, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if !seen[m[k]] {
+			seen[m[k]] = true
+			opts = append(opts, m[k])
+		}
+	}
+	return opts
+}
+
+// defaultValueMaps only covers enums whose values are known; other mode
+// sensors stay numeric unless mapped through BYD_HASS_VALUE_MAP.
+var defaultValueMaps = map[int]ValueMap{
+	4: {1: "P", 2: "R", 3: "N", 4: "D"}, // GearPosition
+}
+
+// ValueMaps holds the value map of every enum-style sensor: the defaults
+// with the BYD_HASS_VALUE_MAP entries on top. Only the MQTT and Home
+// Assistant outputs publish the labels; SensorData keeps the raw numbers, so
+// ABRP, InfluxDB and the other outputs are unaffected.
+var ValueMaps = loadValueMaps(os.Getenv("BYD_HASS_VALUE_MAP"))
+
+// ValueMapFor returns the value map of sensor id, or nil.
+func ValueMapFor(id int) ValueMap {
+	return ValueMaps[id]
+}
+
+func loadValueMaps(raw string) map[int]ValueMap {
+	maps := make(map[int]ValueMap, len(defaultValueMaps))
+	for id, m := range defaultValueMaps {
+		maps[id] = m
+	}
+	overrides, warnings := ParseValueMaps(raw)
+	ConfigWarnings = append(ConfigWarnings, warnings...)
+	for id, m := range overrides {
+		if len(m) == 0 {
+			delete(maps, id) // "4:" publishes the gear as a number again
+			continue
+		}
+		maps[id] = m
+	}
+	return maps
+}
+
+// ParseValueMaps parses "id:value=label|value=label" entries separated by
+// commas, e.g. "4:1=P|2=R|3=N|4=D,79:0=Fresh|1=Recirculate". An entry
+// replaces the whole map of its sensor; an empty one ("4:") removes it.
+func ParseValueMaps(raw string) (map[int]ValueMap, []string) {
+	out := make(map[int]ValueMap)
+	var warnings []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		idStr, pairs, ok := strings.Cut(entry, ":")
+		id, err := strconv.Atoi(strings.TrimSpace(idStr))
+		if !ok || err != nil || GetSensorByID(id) == nil {
+			warnings = append(warnings, fmt.Sprintf("ignoring value map %q: expected id:value=label|…", entry))
+			continue
+		}
+		m := make(ValueMap)
+		valid := true
+		for _, pair := range strings.Split(pairs, "|") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			valStr, label, ok := strings.Cut(pair, "=")
+			val, err := strconv.Atoi(strings.TrimSpace(valStr))
+			label = strings.TrimSpace(label)
+			if !ok || err != nil || label == "" {
+				warnings = append(warnings, fmt.Sprintf("ignoring value map %q: invalid pair %q", entry, pair))
+				valid = false
+				break
+			}
+			m[val] = label
+		}
+		if valid {
+			out[id] = m
+		}
+	}
+	return out, warnings
+}
@@ -0,0 +1,195 @@
+// Package state keeps the collector's in-memory state (derived sensor
+// trackers, the last poll, …) in a JSON file across restarts. Components
+// register under a name and are saved and restored by a Store; the store
+// itself knows nothing about what they contain.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/config"
+)
+
+// Version is the schema version written to the state file. Bump it when a
+// component's saved form changes incompatibly, and teach migrate to convert
+// or drop older files.
+const Version = 1
+
+// Component is a piece of state kept across restarts.
+type Component interface {
+	// SaveState returns the value to persist; it must marshal to JSON.
+	// A nil value (or one marshalling to null) is left out of the file.
+	SaveState() interface{}
+	// RestoreState loads a value previously returned by SaveState.
+	RestoreState(data json.RawMessage) error
+}
+
+// funcComponent adapts a pair of functions to Component.
+type funcComponent[T any] struct {
+	save    func() T
+	restore func(T)
+}
+
+// Func returns a Component that persists the value returned by save and
+// hands it back to restore on load.
+func Func[T any](save func() T, restore func(T)) Component {
+	return funcComponent[T]{save: save, restore: restore}
+}
+
+func (c funcComponent[T]) SaveState() interface{} { return c.save() }
+
+func (c funcComponent[T]) RestoreState(data json.RawMessage) error {
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	c.restore(v)
+	return nil
+}
+
+// file is the on-disk layout.
+type file struct {
+	Version    int                        `json:"version"`
+	SavedAt    time.Time                  `json:"saved_at"`
+	Components map[string]json.RawMessage `json:"components"`
+}
+
+// Store saves and restores the registered components to one file.
+type Store struct {
+	path string
+
+	mu         sync.Mutex
+	components map[string]Component
+}
+
+// NewStore creates a store backed by path.
+func NewStore(path string) *Store {
+	return &Store{path: path, components: make(map[string]Component)}
+}
+
+// Register adds c under name, replacing any component registered before
+// under the same name. Names must stay stable across releases; a renamed
+// component loses its saved state.
+func (s *Store) Register(name string, c Component) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.components[name] = c
+}
+
+// Save writes every component to the file atomically (temp file and
+// rename), so a power cut leaves either the old or the new file.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := file{Version: Version, SavedAt: time.Now(), Components: make(map[string]json.RawMessage, len(s.components))}
+	var errs []error
+	for name, c := range s.components {
+		v := c.SaveState()
+		if v == nil {
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		if string(data) == "null" {
+			continue
+		}
+		f.Components[name] = data
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	if err := config.WriteFileAtomic(s.path, data); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("state saved without some components: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Load restores the registered components from the file and returns when it
+// was saved and the names of the components restored. A missing file
+// restores nothing. An unreadable, corrupt or newer-version file is an
+// error and restores nothing; a component that fails to restore is skipped
+// and reported in the error while the others are still restored. Saved
+// state without a registered component is ignored.
+func (s *Store) Load() (time.Time, []string, error) {
+	raw, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil, nil
+	}
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	f, err := migrate(raw)
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("failed to parse state file %s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var restored []string
+	var errs []error
+	for name, data := range f.Components {
+		c, ok := s.components[name]
+		if !ok || string(data) == "null" {
+			continue
+		}
+		if err := c.RestoreState(data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		restored = append(restored, name)
+	}
+	sort.Strings(restored)
+	if len(errs) > 0 {
+		return f.SavedAt, restored, fmt.Errorf("ignoring part of the state file: %w", errors.Join(errs...))
+	}
+	return f.SavedAt, restored, nil
+}
+
+// migrate decodes raw and converts it to the current Version.
+//
+// Version 0 is the unversioned snapshot of earlier releases: one flat
+// object whose keys (besides saved_at) are the component names.
+func migrate(raw []byte) (*file, error) {
+	var probe struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, err
+	}
+	switch {
+	case probe.Version > Version:
+		return nil, fmt.Errorf("written by a newer release (version %d, this release reads up to %d)", probe.Version, Version)
+	case probe.Version == 0:
+		var legacy map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &legacy); err != nil {
+			return nil, err
+		}
+		f := &file{Version: Version, Components: legacy}
+		if savedAt, ok := legacy["saved_at"]; ok {
+			if err := json.Unmarshal(savedAt, &f.SavedAt); err != nil {
+				return nil, err
+			}
+			delete(legacy, "saved_at")
+		}
+		return f, nil
+	}
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
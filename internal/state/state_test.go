@@ -0,0 +1,100 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// counter is a component holding one number.
+type counter struct{ n int }
+
+func (c *counter) component() Component {
+	return Func(func() int { return c.n }, func(n int) { c.n = n })
+}
+
+// broken fails to restore.
+type broken struct{}
+
+func (broken) SaveState() interface{}             { return "x" }
+func (broken) RestoreState(json.RawMessage) error { return errors.New("bad state") }
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	trips, charges := &counter{n: 12}, &counter{n: 3}
+	s := NewStore(path)
+	s.Register("trips", trips.component())
+	s.Register("charges", charges.component())
+	// A nil value is left out of the file.
+	s.Register("empty", Func(func() *int { return nil }, func(*int) { t.Error("restored a nil value") }))
+	before := time.Now()
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	trips2, charges2 := &counter{}, &counter{}
+	s2 := NewStore(path)
+	s2.Register("trips", trips2.component())
+	s2.Register("charges", charges2.component())
+	s2.Register("empty", Func(func() *int { return nil }, func(*int) { t.Error("restored a nil value") }))
+	savedAt, restored, err := s2.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if savedAt.Before(before.Add(-time.Second)) {
+		t.Errorf("saved at %s, want about %s", savedAt, before)
+	}
+	if fmt.Sprint(restored) != "[charges trips]" {
+		t.Errorf("restored %v, want [charges trips]", restored)
+	}
+	if trips2.n != 12 || charges2.n != 3 {
+		t.Errorf("restored trips=%d charges=%d, want 12 and 3", trips2.n, charges2.n)
+	}
+}
+
+func TestStoreLoad(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string // "" leaves the file missing
+		wantRestored string
+		wantN        int
+		wantErr      bool
+	}{
+		{"missing file", "", "[]", 0, false},
+		{"current version", `{"version":1,"saved_at":"2024-05-01T12:00:00Z","components":{"trips":7,"other":1}}`, "[trips]", 7, false},
+		{"unversioned file", `{"saved_at":"2024-05-01T12:00:00Z","trips":5}`, "[trips]", 5, false},
+		{"null component", `{"version":1,"components":{"trips":null}}`, "[]", 0, false},
+		{"newer version", `{"version":99,"components":{"trips":7}}`, "[]", 0, true},
+		{"corrupt file", `{"version":1,"comp`, "[]", 0, true},
+		{"one bad component", `{"version":1,"components":{"trips":4,"broken":"x"}}`, "[trips]", 4, true},
+		{"component of the wrong type", `{"version":1,"components":{"trips":"seven"}}`, "[]", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.json")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			trips := &counter{}
+			s := NewStore(path)
+			s.Register("trips", trips.component())
+			s.Register("broken", broken{})
+			_, restored, err := s.Load()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got := fmt.Sprint(restored); got != tt.wantRestored {
+				t.Errorf("restored %v, want %s", restored, tt.wantRestored)
+			}
+			if trips.n != tt.wantN {
+				t.Errorf("trips = %d, want %d", trips.n, tt.wantN)
+			}
+		})
+	}
+}
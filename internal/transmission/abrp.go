@@ -4,18 +4,42 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"sync/atomic"
 
 	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 )
 
+// ABRP transport modes (BYD_HASS_ABRP_MODE).
+const (
+	ABRPModeHTTP = "http" // one HTTP POST per sample (default)
+	ABRPModeWS   = "ws"   // persistent WebSocket stream with HTTP fallback
+)
+
+const (
+	abrpStreamURL         = "wss://api.iternio.com/1/tlm/stream"
+	abrpStreamDialTimeout = 5 * time.Second  // give up on the socket and fall back to HTTP after this
+	abrpStreamAckTimeout  = 10 * time.Second // max wait for the server to acknowledge a frame
+
+	abrpDefaultTimeout        = 10 * time.Second // single HTTP request, until SetTimeout
+	abrpDefaultCurrentMaxAge  = 30 * time.Second // derived current is dropped for older samples
+	abrpDefaultActiveInterval = 10 * time.Second // while driving / charging
+	abrpDefaultParkedInterval = 10 * time.Minute // when parked & not charging
+	abrpMinPackVoltage        = 1.0              // below this the current derivation is skipped (near-zero guard)
+)
+
 // ABRP (A Better Route Planner) telemetry integration
 //
 // This module transmits comprehensive vehicle telemetry data to ABRP for improved
@@ -44,11 +68,27 @@ import (
 
 // ABRPTransmitter transmits telemetry data to A Better Route Planner
 type ABRPTransmitter struct {
-	apiKey     string
-	token      string
-	httpClient *http.Client
-	logger     *logrus.Logger
-	healthy    uint32 // 1 = last transmission successful, 0 = failed/unknown
+	apiKey       string
+	destinations []*abrpDestination // one per user token; the payload is fanned out to all
+	httpClient   *http.Client
+	logger       *logrus.Logger
+
+	mode string
+
+	buffer *abrpBuffer // samples awaiting replay; nil when buffering is disabled
+
+	spool      *spoolQueue  // replaces buffer when set
+	spooledUtc atomic.Int64 // utc of the last sample handed to the spool
+
+	currentMaxAge    time.Duration // max sample age for the derived current (0 = unlimited)
+	packVoltageField string        // SensorData field of the HV pack voltage sensor ("" = none)
+
+	policy *abrpRatePolicy
+
+	sendElevation bool // include GPS altitude as "elevation"
+	sendHeading   bool // include GPS bearing as "heading"
+
+	guard closeGuard
 }
 
 // ABRPTelemetry represents the telemetry data format for ABRP
@@ -87,33 +127,84 @@ type ABRPTelemetry struct {
 	TirePressureRR  *float64 `json:"tire_pressure_rr,omitempty"`  // Rear right tire pressure in kPa
 }
 
-// NewABRPTransmitter creates a new ABRP transmitter
-func NewABRPTransmitter(apiKey, token string, logger *logrus.Logger) *ABRPTransmitter {
-	// Rely on the global custom DNS resolver installed in main.go.
-	transport := &http.Transport{
-		Proxy:                 http.ProxyFromEnvironment,
-		ForceAttemptHTTP2:     true,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+// NewABRPTransmitter creates a new ABRP transmitter sending the same telemetry
+// to every user token in tokens (at most abrpMaxTokens).
+func NewABRPTransmitter(apiKey string, tokens []string, logger *logrus.Logger) *ABRPTransmitter {
+	if len(tokens) > abrpMaxTokens {
+		logger.WithField("tokens", len(tokens)).Warnf("Too many ABRP tokens; only the first %d are used", abrpMaxTokens)
+		tokens = tokens[:abrpMaxTokens]
+	}
+	destinations := make([]*abrpDestination, 0, len(tokens))
+	for _, token := range tokens {
+		destinations = append(destinations, &abrpDestination{token: token})
 	}
 
 	return &ABRPTransmitter{
-		apiKey: apiKey,
-		token:  token,
+		apiKey:       apiKey,
+		destinations: destinations,
 		httpClient: &http.Client{
-			Timeout:   10 * time.Second,
-			Transport: transport,
+			Timeout:   abrpDefaultTimeout,
+			Transport: abrpTransport(abrpDefaultTimeout),
 		},
-		logger: logger,
+		logger:        logger,
+		mode:          ABRPModeHTTP,
+		currentMaxAge: abrpDefaultCurrentMaxAge,
+		sendElevation: true,
+		sendHeading:   true,
+		policy: &abrpRatePolicy{
+			activeInterval: abrpDefaultActiveInterval,
+			parkedInterval: abrpDefaultParkedInterval,
+			logger:         logger,
+		},
+	}
+}
+
+// SetTransport implements TransportSetter.
+func (t *ABRPTransmitter) SetTransport(rt http.RoundTripper) {
+	t.httpClient.Transport = rt
+}
+
+// SetRatePolicy sets the transmission interval while driving or charging and
+// while parked.
+func (t *ABRPTransmitter) SetRatePolicy(active, parked time.Duration) {
+	t.policy.mu.Lock()
+	t.policy.activeInterval = active
+	t.policy.parkedInterval = parked
+	t.policy.mu.Unlock()
+}
+
+// Interval returns how long the scheduler should wait after the previous
+// transmission before sending data. It is zero when the vehicle changed state
+// (park → drive, charge start/stop) so transitions are reported immediately.
+func (t *ABRPTransmitter) Interval(data *sensors.SensorData) time.Duration {
+	return t.policy.interval(data)
+}
+
+// SetMode selects the transport: ABRPModeHTTP or ABRPModeWS.
+func (t *ABRPTransmitter) SetMode(mode string) error {
+	switch mode {
+	case ABRPModeHTTP:
+		for _, d := range t.destinations {
+			d.stream = nil
+		}
+	case ABRPModeWS:
+		for _, d := range t.destinations {
+			streamURL := fmt.Sprintf("%s?api_key=%s&token=%s", abrpStreamURL, url.QueryEscape(t.apiKey), url.QueryEscape(d.token))
+			d.stream = newABRPStream(streamURL, t.logger)
+		}
+	default:
+		return fmt.Errorf("unknown ABRP mode %q (supported: %s, %s)", mode, ABRPModeHTTP, ABRPModeWS)
 	}
+	t.mode = mode
+	return nil
 }
 
-// TransmitWithContext sends sensor data to ABRP using the provided context.
-// If ctx is cancelled or times out, the request is aborted.
-func (t *ABRPTransmitter) TransmitWithContext(ctx context.Context, data *sensors.SensorData) error {
+// Transmit sends sensor data to ABRP. If ctx is cancelled or times out, the
+// request is aborted.
+func (t *ABRPTransmitter) Transmit(ctx context.Context, data *sensors.SensorData) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
 	// Convert sensor data to ABRP telemetry JSON once so we can reuse it between retries.
 	telemetry := t.buildTelemetryData(data)
 
@@ -122,10 +213,166 @@ func (t *ABRPTransmitter) TransmitWithContext(ctx context.Context, data *sensors
 		return fmt.Errorf("failed to marshal ABRP telemetry: %w", err)
 	}
 
-	// Prepare the constant request body and target URL up-front.
-	formEncoded := url.Values{"tlm": []string{string(payload)}}.Encode()
-	apiURL := fmt.Sprintf("https://api.iternio.com/1/tlm/send?api_key=%s&token=%s", t.apiKey, t.token)
+	// The state counts as reported even if delivery fails: the sample is
+	// buffered for replay, so don't keep forcing immediate sends.
+	t.policy.sent(data)
+
+	if t.spool != nil {
+		// The scheduler resends the latest sample between polls; spool
+		// each sample only once.
+		if telemetry.Utc == t.spooledUtc.Load() && t.spool.depth() > 0 {
+			return nil
+		}
+		queued, err := t.spool.send(ctx, payload)
+		if queued {
+			t.spooledUtc.Store(telemetry.Utc)
+		}
+		return err
+	}
+
+	if err := t.deliver(ctx, payload); err != nil {
+		// The scheduler resends the latest sample between polls; buffer
+		// each sample only once.
+		if t.buffer != nil {
+			if last, ok := t.buffer.peek(); !ok || last.Utc != telemetry.Utc {
+				t.buffer.push(abrpBufferedSample{Utc: telemetry.Utc, Payload: payload})
+				t.logger.WithField("buffered", t.buffer.len()).Debug("ABRP sample buffered for later replay")
+			}
+		}
+		return err
+	}
+
+	t.replayBuffered(ctx)
+	return nil
+}
+
+// deliver fans one payload out to every destination concurrently. It succeeds
+// when at least one destination accepted the sample, so a dead account never
+// causes samples to be buffered for the healthy ones. The sample only counts
+// as rejected when every destination rejected it.
+func (t *ABRPTransmitter) deliver(ctx context.Context, payload []byte) error {
+	now := time.Now()
+	errs := make([]error, len(t.destinations))
+	var wg sync.WaitGroup
+	for i, d := range t.destinations {
+		if !d.due(now) {
+			errs[i] = fmt.Errorf("ABRP token %s cooling down after failures", d.label())
+			continue
+		}
+		wg.Add(1)
+		go func(i int, d *abrpDestination) {
+			defer wg.Done()
+			errs[i] = t.deliverTo(ctx, d, payload)
+		}(i, d)
+	}
+	wg.Wait()
+
+	rejected := true
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+		rejected = rejected && isSpoolRejection(err)
+	}
+	if rejected {
+		return spoolRejection{errors.Join(errs...)}
+	}
+	return errors.Join(errs...)
+}
+
+// deliverTo sends one payload to a single destination over the configured
+// transport. A destination that is already failing gets a single attempt
+// instead of the full retry loop so it can't hold up the cycle.
+func (t *ABRPTransmitter) deliverTo(ctx context.Context, d *abrpDestination, payload []byte) error {
+	err := errABRPStreamClosed
+	if d.stream != nil {
+		err = d.stream.send(ctx, payload)
+		if err != nil && ctx.Err() == nil {
+			// The frame was never acknowledged, so delivering it over HTTP can't
+			// duplicate an accepted sample.
+			t.logger.WithError(err).WithField("token", d.label()).Debug("ABRP stream unavailable – falling back to HTTP")
+		}
+	}
+	if d.stream == nil || (err != nil && ctx.Err() == nil) {
+		if d.isHealthy() || atomic.LoadUint64(&d.failures) == 0 {
+			err = t.postWithRetry(ctx, d, payload)
+		} else {
+			err = t.postOnce(ctx, d, payload)
+		}
+	}
+
+	wasHealthy := d.record(err)
+	switch {
+	case err == nil && !wasHealthy && atomic.LoadUint64(&d.failures) > 0:
+		t.logger.WithField("token", d.label()).Info("ABRP connection restored")
+	case err != nil && wasHealthy:
+		t.logger.WithError(err).WithField("token", d.label()).Warn("ABRP destination unreachable – backing off")
+	}
+	return err
+}
+
+// replayBuffered backfills samples captured while ABRP was unreachable,
+// most recent first. Replay is rate-limited: at most abrpReplayBatch samples per
+// call, spaced abrpReplaySpacing apart, stopping at the first failure.
+func (t *ABRPTransmitter) replayBuffered(ctx context.Context) {
+	if t.buffer == nil || t.buffer.len() == 0 {
+		return
+	}
+
+	sent := 0
+	for sent < abrpReplayBatch {
+		sample, ok := t.buffer.peek()
+		if !ok {
+			break
+		}
+		if sent > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(abrpReplaySpacing):
+			}
+		}
+		if err := t.replayOne(ctx, sample.Payload); err != nil {
+			t.logger.WithError(err).Debug("ABRP backfill failed; will retry next cycle")
+			return
+		}
+		t.buffer.pop()
+		sent++
+	}
+
+	t.logger.WithFields(logrus.Fields{
+		"replayed":  sent,
+		"remaining": t.buffer.len(),
+	}).Debug("ABRP buffered samples replayed")
+}
+
+// replayOne posts a buffered sample to every healthy destination. The sample
+// was buffered because no destination accepted it, so none has it yet.
+func (t *ABRPTransmitter) replayOne(ctx context.Context, payload []byte) error {
+	var errs []error
+	sent := false
+	for _, d := range t.destinations {
+		if !d.isHealthy() {
+			continue
+		}
+		if err := t.postOnce(ctx, d, payload); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sent = true
+	}
+	if sent {
+		return nil
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("no healthy ABRP destination")
+	}
+	return errors.Join(errs...)
+}
 
+// postWithRetry delivers one telemetry payload to d via HTTP POST, retrying
+// with exponential back-off until it succeeds or ctx is done.
+func (t *ABRPTransmitter) postWithRetry(ctx context.Context, d *abrpDestination, payload []byte) error {
 	// Retry parameters. We use exponential back-off capped at 30 seconds and keep retrying
 	// until the provided context is cancelled.
 	const (
@@ -150,50 +397,24 @@ func (t *ABRPTransmitter) TransmitWithContext(ctx context.Context, data *sensors
 
 		attempt++
 
-		// Build a fresh *http.Request for every attempt because the request body reader
-		// cannot be reused once it has been read.
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(formEncoded))
-		if err != nil {
-			return fmt.Errorf("failed to create ABRP request: %w", err)
-		}
-		req.Header.Set("User-Agent", "byd-hass/1.0.0")
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-		resp, err := t.httpClient.Do(req)
-		if err == nil && resp != nil && resp.StatusCode == http.StatusOK {
-			if resp.Body != nil {
-				_ = resp.Body.Close()
-			}
-			prev := atomic.SwapUint32(&t.healthy, 1)
-
-			if prev == 0 {
-				t.logger.Info("ABRP connection restored")
-			} else if t.logger.IsLevelEnabled(logrus.DebugLevel) {
+		err := t.postOnce(ctx, d, payload)
+		if err == nil {
+			if t.logger.IsLevelEnabled(logrus.DebugLevel) {
 				t.logger.WithFields(logrus.Fields{
-					"attempt":     attempt,
-					"status_code": resp.StatusCode,
+					"attempt": attempt,
+					"token":   d.label(),
 				}).Debug("Successfully transmitted to ABRP")
 			}
 			return nil
 		}
 
 		// Handle failure path – we want to retry.
-		if resp != nil {
-			_ = resp.Body.Close()
-			err = fmt.Errorf("ABRP API returned status %d: %s", resp.StatusCode, resp.Status)
-		}
 		lastErr = err
-		atomic.StoreUint32(&t.healthy, 0)
-
-		// Drop idle connections to avoid half-open sockets after network hand-over.
-		if tr, ok := t.httpClient.Transport.(*http.Transport); ok {
-			tr.CloseIdleConnections()
-		}
 
 		if attempt == 1 {
 			// Surface the initial failure at WARN so operators know we are offline.
 			// Detailed retry counters/back-off remain at DEBUG level to keep INFO/WARN output concise.
-			t.logger.WithError(err).Warn("ABRP transmit failed – retrying")
+			t.logger.WithError(err).WithField("token", d.label()).Warn("ABRP transmit failed – retrying")
 		} else {
 			t.logger.WithError(err).Debugf("ABRP retry %d failed – next attempt in %s", attempt, backoff)
 		}
@@ -216,14 +437,80 @@ func (t *ABRPTransmitter) TransmitWithContext(ctx context.Context, data *sensors
 	}
 }
 
-// Transmit is kept for backward-compatibility and uses Background context.
-func (t *ABRPTransmitter) Transmit(data *sensors.SensorData) error {
-	return t.TransmitWithContext(context.Background(), data)
+// postOnce performs a single HTTP POST of one telemetry payload to d.
+func (t *ABRPTransmitter) postOnce(ctx context.Context, d *abrpDestination, payload []byte) error {
+	formEncoded := url.Values{"tlm": []string{string(payload)}}.Encode()
+	apiURL := fmt.Sprintf("https://api.iternio.com/1/tlm/send?api_key=%s&token=%s", t.apiKey, d.token)
+
+	// Build a fresh *http.Request for every attempt because the request body reader
+	// cannot be reused once it has been read.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(formEncoded))
+	if err != nil {
+		return fmt.Errorf("failed to create ABRP request: %w", err)
+	}
+	req.Header.Set("User-Agent", "byd-hass/1.0.0")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.httpClient.Do(req)
+	if err == nil && resp.StatusCode == http.StatusOK {
+		_ = resp.Body.Close()
+		return nil
+	}
+	if resp != nil {
+		_ = resp.Body.Close()
+		err = fmt.Errorf("ABRP API returned status %d: %s", resp.StatusCode, resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			err = spoolRejection{err}
+		}
+	}
+
+	// Drop idle connections to avoid half-open sockets after network hand-over.
+	if tr, ok := t.httpClient.Transport.(*http.Transport); ok {
+		tr.CloseIdleConnections()
+	}
+	return err
 }
 
-// IsConnected returns true when the last transmission attempt succeeded.
+// Buffered implements BufferReporter: the samples awaiting replay.
+func (t *ABRPTransmitter) Buffered() int {
+	if t.spool != nil {
+		return t.spool.depth()
+	}
+	if t.buffer == nil {
+		return 0
+	}
+	return t.buffer.len()
+}
+
+// Check implements Checker. It only proves the ABRP API is reachable: tokens
+// can't be verified without sending telemetry.
+func (t *ABRPTransmitter) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.iternio.com/1/", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create ABRP request: %w", err)
+	}
+	req.Header.Set("User-Agent", "byd-hass/1.0.0")
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ABRP API unreachable: %w", err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// Name implements Transmitter.
+func (t *ABRPTransmitter) Name() string { return "ABRP" }
+
+// IsConnected returns true when at least one destination is healthy: its last
+// transmission attempt succeeded or, in WebSocket mode, its stream socket is
+// currently open.
 func (t *ABRPTransmitter) IsConnected() bool {
-	return atomic.LoadUint32(&t.healthy) == 1
+	for _, d := range t.destinations {
+		if d.isHealthy() || (d.stream != nil && d.stream.isConnected()) {
+			return true
+		}
+	}
+	return false
 }
 
 // buildTelemetryData converts sensor data to ABRP telemetry format
@@ -250,11 +537,17 @@ func (t *ABRPTransmitter) buildTelemetryData(data *sensors.SensorData) ABRPTelem
 	if data.Location != nil {
 		telemetry.Lat = &data.Location.Latitude
 		telemetry.Lon = &data.Location.Longitude
-		if data.Location.Altitude > 0 {
-			telemetry.Elevation = &data.Location.Altitude
-		}
-		if data.Location.Bearing > 0 {
-			telemetry.Heading = &data.Location.Bearing
+		// Elevation and heading are derived values that are garbage on a poor
+		// fix, so they are omitted entirely rather than sent.
+		if data.Location.GoodFix() {
+			if t.sendElevation && data.Location.Altitude != 0 {
+				elevation := math.Round(data.Location.Altitude)
+				telemetry.Elevation = &elevation
+			}
+			if t.sendHeading && data.Location.Bearing > 0 {
+				heading := math.Mod(math.Round(data.Location.Bearing), 360)
+				telemetry.Heading = &heading
+			}
 		}
 	}
 
@@ -263,25 +556,23 @@ func (t *ABRPTransmitter) buildTelemetryData(data *sensors.SensorData) ABRPTelem
 		telemetry.Power = data.EnginePower
 	}
 
-	// High priority - Charging status and DC fast-charging detection based on instantaneous power
+	// High priority - Charging status and DC fast-charging detection.
 	// ABRP expects negative values for battery charge (power flowing INTO the battery).
-	// Charging detection rules:
+	// The debounced tracker state is preferred when present; otherwise fall
+	// back to the instantaneous rules:
 	//   * is_charging  = 1 when power is below -1 kW (i.e. < −1).
 	//   * is_dcfc      = 1 when power is below -50 kW (i.e. < −50).
 	// Note: "below" means numerically less (more negative).
 
-	// Determine if the charging gun is physically connected (gun state 2)
-	connected := false
-	if data.ChargeGunState != nil && int(*data.ChargeGunState) == 2 {
-		connected = true
-	}
-
 	// Initialise flags to false so they are always sent
 	isCharging := false
 	isDCFC := false
 
-	// Update flags only when the gun is connected and power thresholds are met
-	if telemetry.Power != nil && connected {
+	if data.Charging != nil {
+		isCharging = data.Charging.Charging
+		isDCFC = data.Charging.DCFC
+	} else if telemetry.Power != nil && data.ChargeGunState != nil && int(*data.ChargeGunState) == 2 {
+		// Update flags only when the gun is connected and power thresholds are met
 		p := *telemetry.Power
 		if p < -1.0 {
 			isCharging = true
@@ -305,15 +596,20 @@ func (t *ABRPTransmitter) buildTelemetryData(data *sensors.SensorData) ABRPTelem
 		}
 	}
 
-	// Lower priority - Battery voltage and estimated current
-	if data.MaxBatteryVoltage != nil {
-		telemetry.Voltage = data.MaxBatteryVoltage
-
-		// Estimate current from power and voltage (I = P / V)
-		if telemetry.Power != nil && telemetry.Voltage != nil && *telemetry.Voltage > 0 {
+	// Lower priority - Battery voltage and estimated current. Only with a
+	// pack voltage sensor (see SetPackVoltageSensor): the 12 V battery would
+	// make a 7 kW charge read as several hundred amps.
+	if packVoltage := t.packVoltage(data); packVoltage != nil {
+		telemetry.Voltage = packVoltage
+
+		// Estimate current from power and voltage (I = P / V). Both inputs come
+		// from the same poll, so the sample age bounds their staleness. Power
+		// is negative while charging, which gives ABRP's sign convention.
+		fresh := t.currentMaxAge <= 0 || time.Since(data.Timestamp) <= t.currentMaxAge
+		if telemetry.Power != nil && fresh && *packVoltage >= abrpMinPackVoltage {
 			// Power is in kW, convert to W for calculation
 			powerWatts := *telemetry.Power * 1000
-			current := powerWatts / *telemetry.Voltage
+			current := powerWatts / *packVoltage
 			telemetry.Current = &current
 		}
 	}
@@ -378,9 +674,72 @@ func (t *ABRPTransmitter) buildTelemetryData(data *sensors.SensorData) ABRPTelem
 	return telemetry
 }
 
-// SetTimeout configures the HTTP client timeout
+// SetGPSFields toggles the GPS-sourced elevation and heading fields, e.g. for
+// privacy.
+func (t *ABRPTransmitter) SetGPSFields(elevation, heading bool) {
+	t.sendElevation = elevation
+	t.sendHeading = heading
+}
+
+// SetPackVoltageSensor names the sensor that reports the high-voltage pack
+// voltage; voltage and current are only sent to ABRP with one. Diplus has no
+// such sensor on the cars seen so far, where MaxBatteryVoltage (17) and
+// BatteryVoltage12V (39) read the 12 V battery. Zero clears it.
+func (t *ABRPTransmitter) SetPackVoltageSensor(id int) error {
+	if id == 0 {
+		t.packVoltageField = ""
+		return nil
+	}
+	def := sensors.GetSensorByID(id)
+	if def == nil || def.UnitOfMeasurement != "V" {
+		return fmt.Errorf("sensor %d is not a voltage sensor", id)
+	}
+	t.packVoltageField = def.FieldName
+	return nil
+}
+
+// packVoltage returns the reading of the pack voltage sensor in data, or nil.
+func (t *ABRPTransmitter) packVoltage(data *sensors.SensorData) *float64 {
+	if t.packVoltageField == "" {
+		return nil
+	}
+	v, _ := reflect.ValueOf(data).Elem().FieldByName(t.packVoltageField).Interface().(*float64)
+	return v
+}
+
+// SetCurrentMaxAge sets how old a sample may be for the derived pack current
+// to be included in the payload. Zero disables the check.
+func (t *ABRPTransmitter) SetCurrentMaxAge(d time.Duration) {
+	t.currentMaxAge = d
+}
+
+// SetTimeout bounds a single HTTP request: connecting, the TLS handshake,
+// waiting for the response headers and the request as a whole each give up
+// after timeout. A timed-out request is retried by postWithRetry like any
+// other failure. Call it before the first transmit.
 func (t *ABRPTransmitter) SetTimeout(timeout time.Duration) {
 	t.httpClient.Timeout = timeout
+	t.httpClient.Transport = abrpTransport(timeout)
+}
+
+// abrpTransport returns the HTTP transport for ABRP with every connection
+// phase bounded by timeout.
+func abrpTransport(timeout time.Duration) *http.Transport {
+	// Rely on the global custom DNS resolver installed in main.go.
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+	}
 }
 
 // GetConnectionStatus returns detailed connection status for diagnostics
@@ -388,7 +747,213 @@ func (t *ABRPTransmitter) GetConnectionStatus() map[string]interface{} {
 	return map[string]interface{}{
 		"connected":   t.IsConnected(),
 		"api_key_set": t.apiKey != "",
-		"token_set":   t.token != "",
+		"token_set":   len(t.destinations) > 0,
 		"timeout":     t.httpClient.Timeout,
+		"mode":        t.mode,
+		"buffered":    t.Buffered(),
+		"tokens":      t.destinationStatus(),
 	}
 }
+
+func (t *ABRPTransmitter) destinationStatus() []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(t.destinations))
+	for _, d := range t.destinations {
+		out = append(out, d.status())
+	}
+	return out
+}
+
+// EnableBuffer keeps up to capacity failed samples for later replay. When path
+// is non-empty the buffer is persisted there so a restart doesn't lose it.
+func (t *ABRPTransmitter) EnableBuffer(capacity int, path string) error {
+	buf, err := newABRPBuffer(capacity, path)
+	if err != nil {
+		return err
+	}
+	t.buffer = buf
+	if n := buf.len(); n > 0 {
+		t.logger.WithField("samples", n).Info("Restored buffered ABRP samples")
+	}
+	return nil
+}
+
+// SetSpool hands samples no destination accepted to s, which keeps up to
+// capacity of them and replays them oldest first once ABRP is reachable
+// again. New samples are still sent right away, ahead of the backlog, so the
+// live view stays current. It takes the place of the buffer set up by
+// EnableBuffer. Call it before the first Transmit.
+func (t *ABRPTransmitter) SetSpool(s *Spool, capacity int) error {
+	q, err := s.queue("abrp", t.deliver, spoolQueueOptions{liveFirst: true, maxEntries: capacity})
+	if err != nil {
+		return err
+	}
+	t.spool, t.buffer = q, nil
+	return nil
+}
+
+// Close makes a last attempt to replay buffered samples (those left over stay
+// in the spill file or the spool) and closes the stream sockets, if any.
+func (t *ABRPTransmitter) Close(ctx context.Context) error {
+	return t.guard.close(func() error {
+		t.replayBuffered(ctx)
+		if n := t.Buffered(); n > 0 {
+			t.logger.WithField("buffered", n).Info("ABRP samples still buffered at shutdown")
+		}
+		for _, d := range t.destinations {
+			if d.stream != nil {
+				d.stream.close()
+			}
+		}
+		return nil
+	})
+}
+
+// -----------------------------------------------------------------------------
+// WebSocket streaming transport
+// -----------------------------------------------------------------------------
+
+// abrpStream keeps a persistent WebSocket to ABRP's streaming telemetry
+// endpoint. Frames carry the same tlm JSON as the HTTP API; every frame is
+// acknowledged by the server with a JSON status message. send() is
+// synchronous, so at most one frame is in flight and a frame is only reported
+// delivered once acknowledged.
+type abrpStream struct {
+	url    string
+	logger *logrus.Logger
+
+	mu   sync.Mutex // serialises send/reconnect
+	conn *websocket.Conn
+	acks chan error // one entry per server status message
+	done chan struct{}
+
+	connected uint32
+}
+
+// abrpStreamAck is the server's reply to a telemetry frame.
+type abrpStreamAck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+var errABRPStreamClosed = errors.New("ABRP stream closed")
+
+func newABRPStream(streamURL string, logger *logrus.Logger) *abrpStream {
+	return &abrpStream{url: streamURL, logger: logger}
+}
+
+func (s *abrpStream) isConnected() bool {
+	return atomic.LoadUint32(&s.connected) == 1
+}
+
+// send writes one frame and waits for its acknowledgement. Any failure tears
+// the socket down so the next call reconnects.
+func (s *abrpStream) send(ctx context.Context, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.dial(ctx); err != nil {
+			return err
+		}
+	}
+
+	frame, err := json.Marshal(map[string]json.RawMessage{"tlm": payload})
+	if err != nil {
+		return fmt.Errorf("failed to marshal ABRP stream frame: %w", err)
+	}
+
+	_ = s.conn.SetWriteDeadline(time.Now().Add(abrpStreamAckTimeout))
+	if err := s.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+		s.teardown()
+		return fmt.Errorf("ABRP stream write failed: %w", err)
+	}
+
+	timer := time.NewTimer(abrpStreamAckTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-s.acks:
+		if err != nil {
+			// The server is up but rejected the sample; a retry over HTTP
+			// would be rejected as well.
+			return err
+		}
+		return nil
+	case <-s.done:
+		s.teardown()
+		return errABRPStreamClosed
+	case <-timer.C:
+		s.teardown()
+		return fmt.Errorf("ABRP stream ack timed out after %s", abrpStreamAckTimeout)
+	case <-ctx.Done():
+		s.teardown()
+		return ctx.Err()
+	}
+}
+
+func (s *abrpStream) dial(ctx context.Context) error {
+	dialCtx, cancel := context.WithTimeout(ctx, abrpStreamDialTimeout)
+	defer cancel()
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: abrpStreamDialTimeout,
+	}
+	conn, _, err := dialer.DialContext(dialCtx, s.url, http.Header{"User-Agent": []string{"byd-hass/1.0.0"}})
+	if err != nil {
+		return fmt.Errorf("ABRP stream dial failed: %w", err)
+	}
+
+	s.conn = conn
+	s.acks = make(chan error, 1)
+	s.done = make(chan struct{})
+	conn.SetPingHandler(func(appData string) error {
+		return conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(abrpStreamAckTimeout))
+	})
+	atomic.StoreUint32(&s.connected, 1)
+	go s.readLoop(conn, s.acks, s.done)
+
+	s.logger.Info("ABRP stream connected")
+	return nil
+}
+
+// readLoop converts server status messages into acknowledgements. Control
+// frames (pings) are handled by the connection's ping handler while reading.
+func (s *abrpStream) readLoop(conn *websocket.Conn, acks chan<- error, done chan struct{}) {
+	defer close(done)
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			atomic.StoreUint32(&s.connected, 0)
+			s.logger.WithError(err).Debug("ABRP stream read failed")
+			return
+		}
+		var ack abrpStreamAck
+		if err := json.Unmarshal(msg, &ack); err != nil {
+			continue // not a status message
+		}
+		var ackErr error
+		if ack.Status != "ok" {
+			ackErr = fmt.Errorf("ABRP stream rejected frame: %s %s", ack.Status, ack.Error)
+		}
+		select {
+		case acks <- ackErr:
+		default:
+			// Unsolicited status; nothing is waiting for it.
+		}
+	}
+}
+
+// teardown closes the current socket; caller holds s.mu.
+func (s *abrpStream) teardown() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	atomic.StoreUint32(&s.connected, 0)
+}
+
+func (s *abrpStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.teardown()
+}
@@ -0,0 +1,132 @@
+package transmission
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	abrpReplayBatch   = 5               // max backfilled samples per successful cycle
+	abrpReplaySpacing = 2 * time.Second // pause between backfilled samples
+)
+
+// abrpBufferedSample is a telemetry payload that could not be delivered. The
+// payload already carries its original "utc" so ABRP files it at the right
+// point in history.
+type abrpBufferedSample struct {
+	Utc     int64           `json:"utc"`
+	Payload json.RawMessage `json:"tlm"`
+}
+
+// abrpBuffer is a bounded queue of undelivered samples, replayed newest first.
+// When full the oldest sample is discarded. If a path is configured the contents are mirrored to a
+// JSON-lines file after every change.
+type abrpBuffer struct {
+	mu       sync.Mutex
+	samples  []abrpBufferedSample
+	capacity int
+	path     string
+}
+
+func newABRPBuffer(capacity int, path string) (*abrpBuffer, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("ABRP buffer capacity must be positive, got %d", capacity)
+	}
+	b := &abrpBuffer{capacity: capacity, path: path}
+	if path != "" {
+		if err := b.load(); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (b *abrpBuffer) push(s abrpBufferedSample) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.samples = append(b.samples, s)
+	if over := len(b.samples) - b.capacity; over > 0 {
+		b.samples = b.samples[over:]
+	}
+	b.persist()
+}
+
+// peek returns the most recent sample without removing it. Replaying newest
+// first gets the freshest state to ABRP as soon as the link is back; the older
+// points only fill in history.
+func (b *abrpBuffer) peek() (abrpBufferedSample, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.samples) == 0 {
+		return abrpBufferedSample{}, false
+	}
+	return b.samples[len(b.samples)-1], true
+}
+
+// pop removes the most recent sample.
+func (b *abrpBuffer) pop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.samples) == 0 {
+		return
+	}
+	b.samples = b.samples[:len(b.samples)-1]
+	b.persist()
+}
+
+func (b *abrpBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.samples)
+}
+
+// load reads a previously spilled buffer. A missing file is not an error.
+func (b *abrpBuffer) load() error {
+	data, err := os.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read ABRP buffer file: %w", err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var s abrpBufferedSample
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			continue // skip a torn line from an interrupted write
+		}
+		b.samples = append(b.samples, s)
+	}
+	if over := len(b.samples) - b.capacity; over > 0 {
+		b.samples = b.samples[over:]
+	}
+	return nil
+}
+
+// persist rewrites the spill file; caller holds b.mu. Errors are ignored – the
+// in-memory buffer stays authoritative.
+func (b *abrpBuffer) persist() {
+	if b.path == "" {
+		return
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, s := range b.samples {
+		_ = enc.Encode(s)
+	}
+	tmp := b.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o755); err != nil {
+		return
+	}
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, b.path)
+}
@@ -0,0 +1,85 @@
+package transmission
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	abrpMaxTokens = 5 // upper bound for BYD_HASS_ABRP_TOKEN fan-out
+
+	// A destination that failed a whole cycle is skipped for a cool-down that
+	// doubles on every further failure, so a dead account doesn't hold up the
+	// others on each cycle.
+	abrpCooldownMin = 30 * time.Second
+	abrpCooldownMax = 5 * time.Minute
+)
+
+// abrpDestination is one ABRP user token the telemetry is fanned out to. Each
+// destination tracks its own health, counters and cool-down.
+type abrpDestination struct {
+	token  string
+	stream *abrpStream // non-nil in ABRPModeWS
+
+	healthy   uint32 // 1 = last delivery succeeded
+	successes uint64
+	failures  uint64
+
+	mu          sync.Mutex
+	cooldown    time.Duration
+	nextAttempt time.Time
+}
+
+// label identifies the destination in logs without leaking the token.
+func (d *abrpDestination) label() string {
+	if len(d.token) <= 4 {
+		return "…"
+	}
+	return "…" + d.token[len(d.token)-4:]
+}
+
+func (d *abrpDestination) isHealthy() bool {
+	return atomic.LoadUint32(&d.healthy) == 1
+}
+
+// due reports whether the destination is outside its failure cool-down.
+func (d *abrpDestination) due(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !now.Before(d.nextAttempt)
+}
+
+// record updates counters and the cool-down after a delivery attempt. It
+// returns the previous health state.
+func (d *abrpDestination) record(err error) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err == nil {
+		atomic.AddUint64(&d.successes, 1)
+		d.cooldown = 0
+		d.nextAttempt = time.Time{}
+		return atomic.SwapUint32(&d.healthy, 1) == 1
+	}
+	atomic.AddUint64(&d.failures, 1)
+	if d.cooldown == 0 {
+		d.cooldown = abrpCooldownMin
+	} else if d.cooldown *= 2; d.cooldown > abrpCooldownMax {
+		d.cooldown = abrpCooldownMax
+	}
+	d.nextAttempt = time.Now().Add(d.cooldown)
+	return atomic.SwapUint32(&d.healthy, 0) == 1
+}
+
+func (d *abrpDestination) status() map[string]interface{} {
+	st := map[string]interface{}{
+		"token":     d.label(),
+		"healthy":   d.isHealthy(),
+		"successes": atomic.LoadUint64(&d.successes),
+		"failures":  atomic.LoadUint64(&d.failures),
+	}
+	if d.stream != nil {
+		st["stream_connected"] = d.stream.isConnected()
+	}
+	return st
+}
@@ -0,0 +1,79 @@
+package transmission
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+)
+
+// ABRP vehicle states used by the rate policy.
+const (
+	abrpStateDriving  = "driving"
+	abrpStateCharging = "charging"
+	abrpStateParked   = "parked"
+)
+
+// abrpRatePolicy decides how often telemetry is sent. While driving or
+// charging samples go out every activeInterval; while parked only every
+// parkedInterval. A change of state since the last transmitted sample (park →
+// drive, charge start/stop, …) is sent immediately.
+type abrpRatePolicy struct {
+	activeInterval time.Duration
+	parkedInterval time.Duration
+	logger         *logrus.Logger
+
+	mu         sync.Mutex
+	sentState  string // state of the last transmitted sample ("" = none yet)
+	lastLogged string
+}
+
+func abrpVehicleState(data *sensors.SensorData) string {
+	switch {
+	case data == nil:
+		return abrpStateDriving
+	case data.Speed != nil && *data.Speed > 0:
+		return abrpStateDriving
+	case sensors.DeriveChargingStatus(data) == "charging":
+		return abrpStateCharging
+	default:
+		return abrpStateParked
+	}
+}
+
+// interval returns the minimum time between transmissions for data. It is zero
+// when the vehicle state differs from the last transmitted sample.
+func (p *abrpRatePolicy) interval(data *sensors.SensorData) time.Duration {
+	state := abrpVehicleState(data)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	interval := p.activeInterval
+	if state == abrpStateParked {
+		interval = p.parkedInterval
+	}
+	transition := state != p.sentState
+	if transition {
+		interval = 0
+	}
+
+	if state != p.lastLogged {
+		p.lastLogged = state
+		p.logger.WithFields(logrus.Fields{
+			"state":      state,
+			"previous":   p.sentState,
+			"interval":   interval,
+			"transition": transition,
+		}).Debug("ABRP rate policy decision")
+	}
+	return interval
+}
+
+// sent records the state of a transmitted sample.
+func (p *abrpRatePolicy) sent(data *sensors.SensorData) {
+	p.mu.Lock()
+	p.sentState = abrpVehicleState(data)
+	p.mu.Unlock()
+}
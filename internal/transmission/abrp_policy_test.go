@@ -0,0 +1,58 @@
+package transmission
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+func abrpPolicySample(state string) *sensors.SensorData {
+	speed, gun := 0.0, 1.0
+	data := &sensors.SensorData{Speed: &speed, ChargeGunState: &gun}
+	switch state {
+	case abrpStateDriving:
+		speed = 60
+	case abrpStateCharging:
+		gun = 2
+		data.Charging = &sensors.ChargingState{Charging: true}
+	case "plugged in":
+		gun = 2
+		data.Charging = &sensors.ChargingState{}
+	}
+	return data
+}
+
+func TestABRPRatePolicy(t *testing.T) {
+	const active, parked = 10 * time.Second, 10 * time.Minute
+	// Steps run in order against one transmitter; send marks the sample as
+	// transmitted after checking its interval.
+	tests := []struct {
+		name  string
+		state string
+		send  bool
+		want  time.Duration
+	}{
+		{"first sample goes out at once", abrpStateParked, true, 0},
+		{"parked", abrpStateParked, true, parked},
+		{"plugged in but not charging counts as parked", "plugged in", false, parked},
+		{"pulling away", abrpStateDriving, false, 0},
+		{"still due until sent", abrpStateDriving, true, 0},
+		{"driving", abrpStateDriving, true, active},
+		{"arriving at a charger", abrpStateCharging, true, 0},
+		{"charging", abrpStateCharging, true, active},
+		{"charge finished", abrpStateParked, true, 0},
+		{"parked again", abrpStateParked, false, parked},
+	}
+	tx := NewABRPTransmitter("key", []string{"token"}, quietLogger())
+	tx.SetRatePolicy(active, parked)
+	for _, tt := range tests {
+		data := abrpPolicySample(tt.state)
+		if got := tx.Interval(data); got != tt.want {
+			t.Errorf("%s: Interval = %s, want %s", tt.name, got, tt.want)
+		}
+		if tt.send {
+			tx.policy.sent(data)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package transmission
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/gorilla/websocket"
+)
+
+// fakeABRPStream is a streaming endpoint that answers the n-th frame
+// (counted across connections) with the status replies[n]; "" drops the
+// connection instead.
+type fakeABRPStream struct {
+	replies []string
+
+	mu     sync.Mutex
+	frames int
+	conns  int
+}
+
+func (f *fakeABRPStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	f.mu.Lock()
+	f.conns++
+	f.mu.Unlock()
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		f.mu.Lock()
+		reply := "ok"
+		if f.frames < len(f.replies) {
+			reply = f.replies[f.frames]
+		}
+		f.frames++
+		f.mu.Unlock()
+		if reply == "" {
+			return
+		}
+		ack := abrpStreamAck{Status: reply}
+		if reply != "ok" {
+			ack.Error = "bad token"
+		}
+		if err := conn.WriteJSON(ack); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeABRPStream) connections() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns
+}
+
+func wsURL(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestABRPStreamSend(t *testing.T) {
+	tests := []struct {
+		name      string
+		replies   []string
+		wantErrs  []bool // per send
+		wantConns int
+	}{
+		{"acknowledged", []string{"ok", "ok"}, []bool{false, false}, 1},
+		{"rejected keeps the socket", []string{"error", "ok"}, []bool{true, false}, 1},
+		{"reconnects after a drop", []string{"", "ok"}, []bool{true, false}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeABRPStream{replies: tt.replies}
+			srv := httptest.NewServer(server)
+			defer srv.Close()
+			s := newABRPStream(wsURL(srv), quietLogger())
+			defer s.close()
+
+			for i, wantErr := range tt.wantErrs {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				err := s.send(ctx, []byte(`{"utc":1,"soc":50}`))
+				cancel()
+				if (err != nil) != wantErr {
+					t.Errorf("send %d: err = %v, want error %v", i, err, wantErr)
+				}
+			}
+			if got := server.connections(); got != tt.wantConns {
+				t.Errorf("%d connections, want %d", got, tt.wantConns)
+			}
+		})
+	}
+}
+
+// roundTripFunc stands in for the ABRP HTTP API.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestABRPStreamFallback(t *testing.T) {
+	tests := []struct {
+		name       string
+		streamUp   bool
+		wantPosts  int
+		wantStream bool // connected afterwards
+	}{
+		{"stream up", true, 0, true},
+		{"stream down falls back to HTTP", false, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(&fakeABRPStream{})
+			defer srv.Close()
+			streamURL := wsURL(srv)
+			if !tt.streamUp {
+				srv.Close()
+			}
+
+			tx := NewABRPTransmitter("key", []string{"token"}, quietLogger())
+			if err := tx.SetMode(ABRPModeWS); err != nil {
+				t.Fatal(err)
+			}
+			tx.destinations[0].stream = newABRPStream(streamURL, quietLogger())
+			var mu sync.Mutex
+			posts := 0
+			tx.httpClient.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				mu.Lock()
+				posts++
+				mu.Unlock()
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"status":"ok"}`))}, nil
+			})
+			defer tx.Close(context.Background())
+
+			soc := 50.0
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := tx.Transmit(ctx, &sensors.SensorData{Timestamp: time.Now(), BatteryPercentage: &soc}); err != nil {
+				t.Fatalf("Transmit: %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if posts != tt.wantPosts {
+				t.Errorf("%d HTTP posts, want %d", posts, tt.wantPosts)
+			}
+			if got := tx.destinations[0].stream.isConnected(); got != tt.wantStream {
+				t.Errorf("stream connected = %v, want %v", got, tt.wantStream)
+			}
+		})
+	}
+}
+
+// orDash formats v, or "-" for nil.
+func orDash(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprint(*v)
+}
+
+func TestABRPPackVoltage(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	charging := func(age time.Duration, packVoltage float64) *sensors.SensorData {
+		return &sensors.SensorData{
+			Timestamp:         time.Now().Add(-age),
+			EnginePower:       f(-7),
+			BatteryVoltage12V: f(13.8),
+			MaxBatteryVoltage: f(packVoltage),
+		}
+	}
+	tests := []struct {
+		name   string
+		sensor int
+		data   *sensors.SensorData
+		want   string // "voltage current", "-" = not sent
+	}{
+		{"no pack voltage sensor", 0, charging(0, 14.2), "- -"},
+		{"7 kW charge", 17, charging(0, 400), "400 -17.5"},
+		{"stale sample", 17, charging(time.Minute, 400), "400 -"},
+		{"no reading", 17, &sensors.SensorData{Timestamp: time.Now(), EnginePower: f(-7)}, "- -"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := NewABRPTransmitter("key", []string{"token"}, quietLogger())
+			if err := tx.SetPackVoltageSensor(tt.sensor); err != nil {
+				t.Fatal(err)
+			}
+			tlm := tx.buildTelemetryData(tt.data)
+			got := fmt.Sprint(orDash(tlm.Voltage), " ", orDash(tlm.Current))
+			if got != tt.want {
+				t.Errorf("voltage and current %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	tx := NewABRPTransmitter("key", []string{"token"}, quietLogger())
+	if err := tx.SetPackVoltageSensor(33); err == nil {
+		t.Error("SetPackVoltageSensor(33) accepted the battery percentage")
+	}
+}
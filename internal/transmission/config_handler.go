@@ -0,0 +1,67 @@
+package transmission
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// monitoredSensorInfo describes one entry of the resolved sensor list.
+type monitoredSensorInfo struct {
+	ID        int                      `json:"id"`
+	Name      string                   `json:"name"`
+	Key       string                   `json:"key"` // snake_case name used in payloads
+	Publish   bool                     `json:"publish"`
+	Interval  string                   `json:"interval"` // every monitored sensor is read on each poll
+	Transform *sensors.LinearTransform `json:"transform,omitempty"`
+	Smoothing *sensors.Smoothing       `json:"smoothing,omitempty"`
+	ValueMap  sensors.ValueMap         `json:"value_map,omitempty"`
+}
+
+type configReport struct {
+	PollInterval string                `json:"poll_interval"`
+	Sensors      []monitoredSensorInfo `json:"sensors"`
+	Dropped      []string              `json:"dropped"`
+	Warnings     []string              `json:"warnings"`
+}
+
+// NewConfigHandler serves the sensor list the application actually resolved
+// from BYD_HASS_SENSOR_IDS / BYD_HASS_TRANSFORM, read from the live
+// sensors.GetMonitoredSensors rather than re-parsing the environment.
+func NewConfigHandler(pollInterval time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report := configReport{
+			PollInterval: pollInterval.String(),
+			Sensors:      []monitoredSensorInfo{},
+			Dropped:      append([]string{}, sensors.DroppedSensorTokens...),
+			Warnings:     append([]string{}, sensors.ConfigWarnings...),
+		}
+		for _, m := range sensors.GetMonitoredSensors() {
+			info := monitoredSensorInfo{
+				ID:        m.ID,
+				Publish:   m.Publish,
+				Interval:  pollInterval.String(),
+				Transform: m.Transform,
+				Smoothing: m.Smoothing,
+				ValueMap:  sensors.ValueMapFor(m.ID),
+			}
+			if def := sensors.GetSensorByID(m.ID); def != nil {
+				info.Name = def.EnglishName
+				info.Key = sensors.ToSnakeCase(def.FieldName)
+			}
+			report.Sensors = append(report.Sensors, info)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	})
+}
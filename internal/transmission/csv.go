@@ -0,0 +1,254 @@
+package transmission
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+)
+
+// CSV rotation policies (BYD_HASS_CSV_ROTATE).
+const (
+	CSVRotateDaily = "daily" // one file per calendar day
+	CSVRotateSize  = "size"  // start a new file once the current one exceeds the size limit
+)
+
+const csvFlushInterval = 30 * time.Second
+
+// CSVTransmitter appends every published snapshot as a row to a CSV file for
+// offline analysis. Files are named byd-hass-YYYY-MM-DD[-N].csv inside dir and
+// start with a header of sensor names. A new file is started when the day
+// changes (daily), the size limit is reached (size) or the set of published
+// sensors changes, so each file has a single consistent header.
+type CSVTransmitter struct {
+	dir      string
+	rotate   string
+	maxBytes int64
+	logger   *logrus.Logger
+
+	mu        sync.Mutex
+	file      *os.File
+	buf       *bufio.Writer
+	w         *csv.Writer
+	columns   []string
+	day       string
+	seq       int
+	size      int64
+	lastFlush time.Time
+	lastErr   error
+
+	guard closeGuard
+}
+
+// NewCSVTransmitter creates the directory if needed. rotate is CSVRotateDaily
+// or CSVRotateSize; maxBytes only applies to CSVRotateSize.
+func NewCSVTransmitter(dir, rotate string, maxBytes int64, logger *logrus.Logger) (*CSVTransmitter, error) {
+	switch rotate {
+	case CSVRotateDaily:
+	case CSVRotateSize:
+		if maxBytes <= 0 {
+			return nil, fmt.Errorf("CSV size rotation needs a positive size limit")
+		}
+	default:
+		return nil, fmt.Errorf("unknown CSV rotation %q (supported: %s, %s)", rotate, CSVRotateDaily, CSVRotateSize)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create CSV directory: %w", err)
+	}
+	return &CSVTransmitter{dir: dir, rotate: rotate, maxBytes: maxBytes, logger: logger}, nil
+}
+
+// Transmit appends one row with the published sensor values.
+func (t *CSVTransmitter) Transmit(_ context.Context, data *sensors.SensorData) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
+	columns := csvColumns()
+	values := publishedValues(data)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.ensureFile(data.Timestamp, columns); err != nil {
+		t.lastErr = err
+		return err
+	}
+
+	row := make([]string, 0, len(columns)+1)
+	row = append(row, data.Timestamp.UTC().Format(time.RFC3339))
+	for _, col := range columns {
+		row = append(row, csvValue(values[col]))
+	}
+	if err := t.writeRow(row); err != nil {
+		t.lastErr = err
+		return err
+	}
+
+	if time.Since(t.lastFlush) >= csvFlushInterval {
+		if err := t.flush(); err != nil {
+			t.lastErr = err
+			return err
+		}
+	}
+	t.lastErr = nil
+	return nil
+}
+
+// Name implements Transmitter.
+func (t *CSVTransmitter) Name() string { return "CSV" }
+
+// IsConnected reports whether the last write succeeded.
+func (t *CSVTransmitter) IsConnected() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastErr == nil
+}
+
+// Close flushes, syncs and closes the current file.
+func (t *CSVTransmitter) Close(context.Context) error {
+	return t.guard.close(func() error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return t.closeFile()
+	})
+}
+
+// ensureFile opens a new file when none is open, the day changed, the size
+// limit was hit or the column set changed.
+func (t *CSVTransmitter) ensureFile(ts time.Time, columns []string) error {
+	day := ts.Format("2006-01-02")
+	if t.file != nil {
+		switch {
+		case !equalStrings(columns, t.columns):
+			t.logger.Info("CSV columns changed; starting a new file")
+		case t.rotate == CSVRotateDaily && day != t.day:
+		case t.rotate == CSVRotateSize && t.size >= t.maxBytes:
+		default:
+			return nil
+		}
+		t.closeFile()
+	}
+
+	if day != t.day {
+		t.day, t.seq = day, 0
+	}
+	// Never append to an existing file: its header may differ.
+	var path string
+	for {
+		path = t.path()
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		t.seq++
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV file: %w", err)
+	}
+	t.file = f
+	t.buf = bufio.NewWriter(f)
+	t.w = csv.NewWriter(t.buf)
+	t.columns = columns
+	t.size = 0
+	t.lastFlush = time.Now()
+
+	header := append([]string{"timestamp"}, columns...)
+	if err := t.writeRow(header); err != nil {
+		return err
+	}
+	t.logger.WithField("path", path).Info("CSV log file opened")
+	return nil
+}
+
+func (t *CSVTransmitter) path() string {
+	name := "byd-hass-" + t.day
+	if t.seq > 0 {
+		name += "-" + strconv.Itoa(t.seq)
+	}
+	return filepath.Join(t.dir, name+".csv")
+}
+
+func (t *CSVTransmitter) writeRow(row []string) error {
+	if err := t.w.Write(row); err != nil {
+		return fmt.Errorf("failed to write CSV row: %w", err)
+	}
+	// Approximate on-disk size; exact accounting isn't needed for rotation.
+	t.size += int64(len(strings.Join(row, ",")) + 1)
+	return nil
+}
+
+func (t *CSVTransmitter) flush() error {
+	t.w.Flush()
+	if err := t.w.Error(); err != nil {
+		return fmt.Errorf("failed to flush CSV file: %w", err)
+	}
+	if err := t.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to flush CSV file: %w", err)
+	}
+	t.lastFlush = time.Now()
+	return nil
+}
+
+func (t *CSVTransmitter) closeFile() error {
+	if t.file == nil {
+		return nil
+	}
+	err := t.flush()
+	if err != nil {
+		t.logger.WithError(err).Warn("CSV flush on close failed")
+	}
+	if syncErr := t.file.Sync(); syncErr != nil && err == nil {
+		err = fmt.Errorf("failed to sync CSV file: %w", syncErr)
+	}
+	if closeErr := t.file.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("failed to close CSV file: %w", closeErr)
+	}
+	t.file, t.buf, t.w = nil, nil, nil
+	return err
+}
+
+// csvColumns lists the published sensors in PublishedSensorIDs order.
+func csvColumns() []string {
+	var cols []string
+	for _, id := range sensors.PublishedSensorIDs() {
+		if def := sensors.GetSensorByID(id); def != nil {
+			cols = append(cols, sensors.ToSnakeCase(def.FieldName))
+		}
+	}
+	return cols
+}
+
+func csvValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case string:
+		return x
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package transmission
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+func TestCSVRotation(t *testing.T) {
+	day1 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	tests := []struct {
+		name     string
+		rotate   string
+		maxBytes int64
+		existing string // file already in the directory
+		samples  []time.Time
+		want     []string // "<file> <rows>" per file
+	}{
+		{
+			name:    "daily",
+			rotate:  CSVRotateDaily,
+			samples: []time.Time{day1, day1.Add(time.Minute), day2},
+			want:    []string{"byd-hass-2024-05-01.csv 2", "byd-hass-2024-05-02.csv 1"},
+		},
+		{
+			name:     "size",
+			rotate:   CSVRotateSize,
+			maxBytes: 1,
+			samples:  []time.Time{day1, day1.Add(time.Minute), day1.Add(2 * time.Minute)},
+			want:     []string{"byd-hass-2024-05-01-1.csv 1", "byd-hass-2024-05-01-2.csv 1", "byd-hass-2024-05-01.csv 1"},
+		},
+		{
+			name:     "existing file is not appended to",
+			rotate:   CSVRotateDaily,
+			existing: "byd-hass-2024-05-01.csv",
+			samples:  []time.Time{day1},
+			want:     []string{"byd-hass-2024-05-01-1.csv 1", "byd-hass-2024-05-01.csv 0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.existing != "" {
+				if err := os.WriteFile(filepath.Join(dir, tt.existing), []byte("timestamp\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tx, err := NewCSVTransmitter(dir, tt.rotate, tt.maxBytes, quietLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, ts := range tt.samples {
+				soc := float64(80 - i)
+				if err := tx.Transmit(context.Background(), &sensors.SensorData{Timestamp: ts, BatteryPercentage: &soc}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tx.Close(context.Background())
+
+			var got []string
+			entries, _ := os.ReadDir(dir)
+			for _, e := range entries {
+				got = append(got, fmt.Sprint(e.Name(), " ", len(readCSV(t, filepath.Join(dir, e.Name())))-1))
+			}
+			sort.Strings(got)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("files %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVRow(t *testing.T) {
+	dir := t.TempDir()
+	tx, err := NewCSVTransmitter(dir, CSVRotateDaily, 0, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	soc, speed := 80.5, 42.0
+	if err := tx.Transmit(context.Background(), &sensors.SensorData{Timestamp: ts, BatteryPercentage: &soc, Speed: &speed}); err != nil {
+		t.Fatal(err)
+	}
+	tx.Close(context.Background())
+
+	rows := readCSV(t, filepath.Join(dir, "byd-hass-2024-05-01.csv"))
+	if len(rows) != 2 {
+		t.Fatalf("%d rows, want the header and one sample", len(rows))
+	}
+	got := make(map[string]string)
+	for i, col := range rows[0] {
+		got[col] = rows[1][i]
+	}
+	for col, want := range map[string]string{
+		"timestamp":          "2024-05-01T10:00:00Z",
+		"battery_percentage": "80.5",
+		"speed":              "42",
+		"mileage":            "", // published but not read
+	} {
+		if v, ok := got[col]; !ok || v != want {
+			t.Errorf("%s = %q (present %v), want %q", col, v, ok, want)
+		}
+	}
+}
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
@@ -0,0 +1,196 @@
+package transmission
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+)
+
+// EVCCServer is a small read-only HTTP API for evcc's custom vehicle
+// integration:
+//
+//	GET /api/soc     {"soc":73,"range_km":312,"charging":true,"power_kw":7.2,"data_age_s":4}
+//	GET /api/status  all published sensor values plus data_age_s
+//
+// Both endpoints answer 503 when the latest snapshot is older than staleAfter
+// (or no poll succeeded yet) so evcc never acts on a stale SoC. Requests can
+// be protected with a bearer token and/or HTTP basic auth.
+type EVCCServer struct {
+	staleAfter time.Duration
+	token      string
+	basicUser  string
+	basicPass  string
+	logger     *logrus.Logger
+	server     *http.Server
+
+	mu     sync.Mutex
+	latest *sensors.SensorData
+
+	guard closeGuard
+}
+
+// EVCCSoC is the /api/soc response.
+type EVCCSoC struct {
+	SoC      *float64 `json:"soc"`
+	RangeKM  *float64 `json:"range_km,omitempty"`
+	Charging bool     `json:"charging"`
+	PowerKW  float64  `json:"power_kw"` // charge power, positive while charging
+	DataAge  float64  `json:"data_age_s"`
+}
+
+// NewEVCCServer starts serving on listenAddr. basicAuth is "user:password"
+// or empty; token is a bearer token or empty.
+func NewEVCCServer(listenAddr string, staleAfter time.Duration, token, basicAuth string, logger *logrus.Logger) (*EVCCServer, error) {
+	s := &EVCCServer{staleAfter: staleAfter, token: token, logger: logger}
+	if basicAuth != "" {
+		user, pass, ok := strings.Cut(basicAuth, ":")
+		if !ok {
+			return nil, fmt.Errorf("evcc basic auth must be user:password")
+		}
+		s.basicUser, s.basicPass = user, pass
+	}
+
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listenAddr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/soc", s.authorized(s.handleSoC))
+	mux.HandleFunc("/api/status", s.authorized(s.handleStatus))
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.WithError(err).Error("evcc API stopped")
+		}
+	}()
+
+	logger.WithField("listen", ln.Addr().String()).Info("evcc API listening on /api/soc and /api/status")
+	return s, nil
+}
+
+// Transmit records the latest snapshot; it never blocks on HTTP clients.
+func (s *EVCCServer) Transmit(_ context.Context, data *sensors.SensorData) error {
+	if s.guard.isClosed() {
+		return ErrClosed
+	}
+	s.mu.Lock()
+	s.latest = data
+	s.mu.Unlock()
+	return nil
+}
+
+// Name implements Transmitter.
+func (s *EVCCServer) Name() string { return "evcc" }
+
+// IsConnected reports whether the HTTP server is running.
+func (s *EVCCServer) IsConnected() bool {
+	return s.server != nil
+}
+
+// Close shuts the HTTP server down.
+func (s *EVCCServer) Close(ctx context.Context) error {
+	return s.guard.close(func() error {
+		return s.server.Shutdown(ctx)
+	})
+}
+
+func (s *EVCCServer) handleSoC(w http.ResponseWriter, _ *http.Request) {
+	data, age, ok := s.fresh(w)
+	if !ok {
+		return
+	}
+	resp := EVCCSoC{
+		SoC:      data.BatteryPercentage,
+		RangeKM:  sensors.EstimateRangeKM(data),
+		Charging: sensors.DeriveChargingStatus(data) == "charging",
+		DataAge:  age,
+	}
+	if resp.RangeKM != nil {
+		r := math.Round(*resp.RangeKM)
+		resp.RangeKM = &r
+	}
+	if resp.Charging && data.EnginePower != nil && *data.EnginePower < 0 {
+		resp.PowerKW = -*data.EnginePower
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *EVCCServer) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	data, age, ok := s.fresh(w)
+	if !ok {
+		return
+	}
+	values := publishedValues(data)
+	values["data_age_s"] = age
+	writeJSON(w, http.StatusOK, values)
+}
+
+// fresh returns the latest snapshot and its age in seconds, or writes a 503
+// and returns false when there is none or it is stale.
+func (s *EVCCServer) fresh(w http.ResponseWriter) (*sensors.SensorData, float64, bool) {
+	s.mu.Lock()
+	data := s.latest
+	s.mu.Unlock()
+
+	if data == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "no data yet"})
+		return nil, 0, false
+	}
+	age := time.Since(data.Timestamp)
+	ageS := math.Round(age.Seconds())
+	if s.staleAfter > 0 && age > s.staleAfter {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"error": "data is stale", "data_age_s": ageS})
+		return nil, 0, false
+	}
+	return data, ageS, true
+}
+
+func (s *EVCCServer) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if s.token == "" && s.basicUser == "" {
+			next(w, r)
+			return
+		}
+		if s.token != "" {
+			if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") &&
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(s.token)) == 1 {
+				next(w, r)
+				return
+			}
+		}
+		if s.basicUser != "" {
+			if user, pass, ok := r.BasicAuth(); ok &&
+				subtle.ConstantTimeCompare([]byte(user), []byte(s.basicUser)) == 1 &&
+				subtle.ConstantTimeCompare([]byte(pass), []byte(s.basicPass)) == 1 {
+				next(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="byd-hass"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
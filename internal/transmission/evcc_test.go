@@ -0,0 +1,114 @@
+package transmission
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+func TestEVCCSoC(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name       string
+		data       *sensors.SensorData // nil: nothing transmitted
+		wantStatus int
+		wantBody   string
+	}{
+		{"no data yet", nil, http.StatusServiceUnavailable, `{"error":"no data yet"}`},
+		{
+			"stale",
+			&sensors.SensorData{Timestamp: time.Now().Add(-10 * time.Minute), BatteryPercentage: f(73)},
+			http.StatusServiceUnavailable, `{"data_age_s":600,"error":"data is stale"}`,
+		},
+		{
+			"parked",
+			&sensors.SensorData{Timestamp: time.Now(), BatteryPercentage: f(73)},
+			http.StatusOK, `{"soc":73,"charging":false,"power_kw":0,"data_age_s":0}`,
+		},
+		{
+			"charging with a range estimate",
+			&sensors.SensorData{
+				Timestamp: time.Now(), BatteryPercentage: f(50), BatteryCapacity: f(60.5),
+				PowerConsumption100km: f(15), ChargeGunState: f(2), EnginePower: f(-7.2),
+			},
+			// 50 % of 60.5 kWh at 15 kWh/100 km, rounded.
+			http.StatusOK, `{"soc":50,"range_km":202,"charging":true,"power_kw":7.2,"data_age_s":0}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewEVCCServer("127.0.0.1:0", 5*time.Minute, "", "", quietLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close(context.Background())
+			srv := httptest.NewServer(s.server.Handler)
+			defer srv.Close()
+			if tt.data != nil {
+				s.Transmit(context.Background(), tt.data)
+			}
+
+			resp, err := http.Get(srv.URL + "/api/soc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || strings.TrimSpace(string(body)) != tt.wantBody {
+				t.Errorf("got %d %s, want %d %s", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestEVCCAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		basic      string
+		request    func(*http.Request)
+		wantStatus int
+	}{
+		{"open", "", "", func(*http.Request) {}, http.StatusOK},
+		{"token", "secret", "", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }, http.StatusOK},
+		{"wrong token", "secret", "", func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, http.StatusUnauthorized},
+		{"basic", "", "evcc:pw", func(r *http.Request) { r.SetBasicAuth("evcc", "pw") }, http.StatusOK},
+		{"basic instead of the token", "secret", "evcc:pw", func(r *http.Request) { r.SetBasicAuth("evcc", "pw") }, http.StatusOK},
+		{"wrong password", "", "evcc:pw", func(r *http.Request) { r.SetBasicAuth("evcc", "guess") }, http.StatusUnauthorized},
+		{"none given", "secret", "", func(*http.Request) {}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewEVCCServer("127.0.0.1:0", 0, tt.token, tt.basic, quietLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close(context.Background())
+			srv := httptest.NewServer(s.server.Handler)
+			defer srv.Close()
+			soc := 73.0
+			s.Transmit(context.Background(), &sensors.SensorData{Timestamp: time.Now(), BatteryPercentage: &soc})
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/status", nil)
+			tt.request(req)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+
+	if _, err := NewEVCCServer("127.0.0.1:0", 0, "", "no-colon", quietLogger()); err == nil {
+		t.Error("basic auth without a password accepted")
+	}
+}
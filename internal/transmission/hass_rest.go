@@ -0,0 +1,679 @@
+package transmission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/units"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	haHealthInterval = 30 * time.Second
+	haRequestTimeout = 10 * time.Second
+	// haRefreshInterval re-posts unchanged states so entities recover after a
+	// Home Assistant restart, which forgets states set via the REST API.
+	haRefreshInterval = 10 * time.Minute
+)
+
+// HARESTTransmitter pushes sensor states straight to Home Assistant's REST API
+// (POST /api/states/<entity_id>) for installations without an MQTT broker.
+//
+// Entity IDs are sensor.byd_<device>_<sensor> (binary_sensor.… for on/off
+// sensors), so two vehicles never collide. Unit, device_class and state_class
+// come from the same sensor table the MQTT discovery uses. Only changed states
+// are posted each cycle, paced by a token bucket; IsConnected follows a
+// periodic GET /api/ health check.
+type HARESTTransmitter struct {
+	baseURL    string
+	token      string
+	objectBase string
+	httpClient *http.Client
+	limiter    *tokenBucket
+	logger     *logrus.Logger
+
+	healthy uint32
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+
+	mu         sync.Mutex
+	lastPosted map[string]string
+	lastFull   time.Time
+
+	// unitSetting and units as in MQTTTransmitter (see SetUnits).
+	unitSetting atomic.Value
+	units       units.System
+
+	guard closeGuard
+}
+
+// haUnavailable is the state posted for a sensor that stopped reporting.
+const haUnavailable = "unavailable"
+
+// haState is the body of POST /api/states/<entity_id>.
+type haState struct {
+	State      string                 `json:"state"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// NewHARESTTransmitter creates the transmitter and starts the health check.
+// ratePerSec and burst configure the request token bucket.
+func NewHARESTTransmitter(baseURL, token, deviceID string, ratePerSec float64, burst int, logger *logrus.Logger) (*HARESTTransmitter, error) {
+	if token == "" {
+		return nil, errors.New("a Home Assistant long-lived access token is required")
+	}
+	if ratePerSec <= 0 {
+		return nil, fmt.Errorf("Home Assistant rate limit must be positive, got %g", ratePerSec)
+	}
+	t := &HARESTTransmitter{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		objectBase: "byd_" + haObjectID(deviceID),
+		httpClient: &http.Client{Timeout: haRequestTimeout},
+		limiter:    newTokenBucket(ratePerSec, burst),
+		logger:     logger,
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+		lastPosted: make(map[string]string),
+	}
+	t.checkHealth()
+	go t.healthLoop()
+	return t, nil
+}
+
+// SetTransport implements TransportSetter.
+func (t *HARESTTransmitter) SetTransport(rt http.RoundTripper) {
+	t.httpClient.Transport = rt
+}
+
+// Transmit posts every published sensor whose state changed since it was last
+// posted successfully.
+func (t *HARESTTransmitter) Transmit(ctx context.Context, data *sensors.SensorData) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
+	setting, _ := t.unitSetting.Load().(string)
+	if sys := units.Resolve(setting, data.TemperatureUnit, t.units); sys != t.units {
+		// Post everything again so every unit_of_measurement is updated.
+		t.units = sys
+		t.mu.Lock()
+		t.lastFull = time.Time{}
+		t.mu.Unlock()
+	}
+	states := t.buildStates(data)
+	t.convertStates(states)
+
+	t.mu.Lock()
+	full := time.Since(t.lastFull) >= haRefreshInterval
+	var pending []string
+	for entityID, st := range states {
+		last, posted := t.lastPosted[entityID]
+		if st.State == haUnavailable && !posted {
+			continue // never reported; don't create the entity
+		}
+		if full || last != st.State {
+			pending = append(pending, entityID)
+		}
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	for _, entityID := range pending {
+		if err := t.limiter.wait(ctx, t.stopCh); err != nil {
+			return err
+		}
+		st := states[entityID]
+		if err := t.post(ctx, entityID, st); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t.mu.Lock()
+		t.lastPosted[entityID] = st.State
+		t.mu.Unlock()
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d Home Assistant state updates failed: %w", len(errs), len(pending), errors.Join(errs...))
+	}
+	if full {
+		t.mu.Lock()
+		t.lastFull = time.Now()
+		t.mu.Unlock()
+	}
+	return nil
+}
+
+// SetUnits selects the unit system of the posted states: "metric",
+// "imperial" or units.Auto to follow the car's display. It is safe to call
+// while Transmit runs.
+func (t *HARESTTransmitter) SetUnits(setting string) {
+	t.unitSetting.Store(setting)
+}
+
+// convertStates converts the numeric states, computed in metric, and their
+// unit_of_measurement to the current unit system, then rounds them: sensors
+// with a precision (see sensors.Precisions) to it, other converted states to
+// two decimals.
+func (t *HARESTTransmitter) convertStates(states map[string]haState) {
+	precisions := precisionKeys()
+	for entityID, st := range states {
+		key := strings.TrimPrefix(entityID[strings.IndexByte(entityID, '.')+1:], t.objectBase+"_")
+		unit, _ := st.Attributes["unit_of_measurement"].(string)
+		convert := unit != "" && t.units.Unit(unit) != unit
+		p, round := precisions[key]
+		if !convert && !round {
+			continue
+		}
+		if convert {
+			st.Attributes["unit_of_measurement"] = t.units.Unit(unit)
+		}
+		v, err := strconv.ParseFloat(st.State, 64)
+		if err != nil {
+			continue // unavailable, or a label
+		}
+		if convert {
+			if unitKeys[key].delta {
+				v = t.units.ConvertDelta(v, unit)
+			} else {
+				v = t.units.Convert(v, unit)
+			}
+			if !round {
+				p = 2
+			}
+		}
+		st.State = strconv.FormatFloat(units.Round(v, p), 'f', -1, 64)
+		states[entityID] = st
+	}
+}
+
+// Name implements Transmitter.
+func (t *HARESTTransmitter) Name() string { return "Home Assistant REST" }
+
+// IsConnected reports the result of the last health check.
+func (t *HARESTTransmitter) IsConnected() bool {
+	return atomic.LoadUint32(&t.healthy) == 1
+}
+
+// Close ends the health check loop.
+func (t *HARESTTransmitter) Close(ctx context.Context) error {
+	return t.guard.close(func() error {
+		close(t.stopCh)
+		select {
+		case <-t.doneCh:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+func (t *HARESTTransmitter) buildStates(data *sensors.SensorData) map[string]haState {
+	values := publishedValues(data)
+	labelValues(values)
+	eventTimeValues(values, data)
+	states := make(map[string]haState, len(values)+2)
+
+	for _, id := range sensors.PublishedSensorIDs() {
+		def := sensors.GetSensorByID(id)
+		if def == nil {
+			continue
+		}
+		key := sensors.ToSnakeCase(def.FieldName)
+		v, ok := values[key]
+
+		attrs := map[string]interface{}{"friendly_name": "BYD " + def.EnglishName}
+		deviceClass, unit := def.HAMeta()
+		if unit != "" {
+			attrs["unit_of_measurement"] = unit
+		}
+		if deviceClass != "" {
+			attrs["device_class"] = deviceClass
+		}
+		if def.StateClass != "" {
+			attrs["state_class"] = def.StateClass
+		}
+		if opts := sensors.ValueMapFor(id).Options(); len(opts) > 0 {
+			attrs["device_class"] = "enum"
+			attrs["options"] = opts
+			delete(attrs, "unit_of_measurement")
+			delete(attrs, "state_class")
+		}
+
+		domain := "sensor"
+		state := haStateString(v)
+		if def.Category == "binary_sensor" {
+			domain = "binary_sensor"
+			state = "off"
+			if f, ok := v.(float64); ok && f != 0 {
+				state = "on"
+			}
+		}
+		if !ok {
+			// Missing for longer than the hold (see sensors.ValueHolder);
+			// Transmit only posts this for entities it posted before.
+			state = haUnavailable
+		}
+		states[domain+"."+t.objectBase+"_"+haObjectID(key)] = haState{State: state, Attributes: attrs}
+	}
+
+	for id, v := range data.Smoothed {
+		def := sensors.GetSensorByID(id)
+		if def == nil {
+			continue
+		}
+		attrs := map[string]interface{}{"friendly_name": "BYD " + def.EnglishName + " (Smoothed)"}
+		deviceClass, unit := def.HAMeta()
+		if unit != "" {
+			attrs["unit_of_measurement"] = unit
+		}
+		if deviceClass != "" {
+			attrs["device_class"] = deviceClass
+		}
+		if def.StateClass != "" {
+			attrs["state_class"] = def.StateClass
+		}
+		key := sensors.ToSnakeCase(def.FieldName) + "_smoothed"
+		states["sensor."+t.objectBase+"_"+haObjectID(key)] = haState{State: haStateString(v), Attributes: attrs}
+	}
+
+	// Derived sensors, as in the MQTT state payload.
+	states["sensor."+t.objectBase+"_charging_status"] = haState{
+		State:      sensors.DeriveChargingStatus(data),
+		Attributes: map[string]interface{}{"friendly_name": "BYD Charging Status"},
+	}
+	if data.DrivingState != nil {
+		states["sensor."+t.objectBase+"_driving_state"] = haState{
+			State: *data.DrivingState,
+			Attributes: map[string]interface{}{
+				"friendly_name": "BYD Driving State",
+				"device_class":  "enum",
+				"options":       sensors.DrivingStates,
+			},
+		}
+	}
+	if data.KeepaliveMinutes != nil {
+		states["sensor."+t.objectBase+"_head_unit_keepalive_minutes"] = haState{
+			State: strconv.FormatFloat(*data.KeepaliveMinutes, 'f', 0, 64),
+			Attributes: map[string]interface{}{
+				"friendly_name":       "BYD Head Unit Keepalive",
+				"unit_of_measurement": "min",
+				"device_class":        "duration",
+				"state_class":         "measurement",
+			},
+		}
+	}
+	if data.DiplusRequestsToday != nil {
+		states["sensor."+t.objectBase+"_diplus_requests_today"] = haState{
+			State: strconv.FormatFloat(*data.DiplusRequestsToday, 'f', 0, 64),
+			Attributes: map[string]interface{}{
+				"friendly_name": "BYD Diplus Requests Today",
+				"state_class":   "total_increasing",
+			},
+		}
+	}
+	for _, def := range publishedEventTimeSensors() {
+		key := sensors.EventAgeKey(sensors.ToSnakeCase(def.FieldName))
+		if v, ok := values[key]; ok {
+			states["sensor."+t.objectBase+"_"+key] = haState{
+				State: haStateString(v),
+				Attributes: map[string]interface{}{
+					"friendly_name":       "BYD " + sensors.EventAgeName(def),
+					"unit_of_measurement": "s",
+					"device_class":        "duration",
+					"state_class":         "measurement",
+				},
+			}
+		}
+	}
+	for _, a := range aggregateSensors {
+		attrs := map[string]interface{}{"friendly_name": "BYD " + a.name, "members": []string{}}
+		if a.deviceClass != "" {
+			attrs["device_class"] = a.deviceClass
+		}
+		state := "unavailable" // a member sensor has no value
+		if v := a.get(data); v != nil {
+			state = "off"
+			if v.On {
+				state = "on"
+			}
+			attrs["members"] = v.Members
+		}
+		states["binary_sensor."+t.objectBase+"_"+a.key] = haState{State: state, Attributes: attrs}
+	}
+	for _, c := range []struct {
+		key, name string
+		count     *float64
+	}{
+		{"doors_open_count", "Doors Open Count", data.DoorsOpenCount},
+		{"windows_open_count", "Windows Open Count", data.WindowsOpenCount},
+	} {
+		if c.count == nil {
+			continue
+		}
+		states["sensor."+t.objectBase+"_"+c.key] = haState{
+			State: strconv.FormatFloat(*c.count, 'f', 0, 64),
+			Attributes: map[string]interface{}{
+				"friendly_name": "BYD " + c.name,
+				"state_class":   "measurement",
+			},
+		}
+	}
+	if data.PollMode != nil {
+		states["sensor."+t.objectBase+"_poll_mode"] = haState{
+			State: *data.PollMode,
+			Attributes: map[string]interface{}{
+				"friendly_name": "BYD Polling Mode",
+				"device_class":  "enum",
+				"options":       sensors.PollModes,
+			},
+		}
+	}
+	if data.EfficiencyWhKM != nil {
+		states["sensor."+t.objectBase+"_efficiency"] = haState{
+			State: strconv.FormatFloat(math.Round(*data.EfficiencyWhKM), 'f', 0, 64),
+			Attributes: map[string]interface{}{
+				"friendly_name":       "BYD Efficiency",
+				"unit_of_measurement": "Wh/km",
+				"state_class":         "measurement",
+			},
+		}
+	}
+	if data.ConsumptionKWh100KM != nil {
+		states["sensor."+t.objectBase+"_rolling_consumption"] = haState{
+			State: strconv.FormatFloat(math.Round(*data.ConsumptionKWh100KM*10)/10, 'f', 1, 64),
+			Attributes: map[string]interface{}{
+				"friendly_name":       "BYD Rolling Consumption",
+				"unit_of_measurement": "kWh/100km",
+				"state_class":         "measurement",
+			},
+		}
+	}
+	if data.RangeEstimateKM != nil {
+		states["sensor."+t.objectBase+"_range_estimate_km"] = haState{
+			State: strconv.FormatFloat(math.Round(*data.RangeEstimateKM), 'f', 0, 64),
+			Attributes: map[string]interface{}{
+				"friendly_name":       "BYD Range Estimate",
+				"unit_of_measurement": "km",
+				"device_class":        "distance",
+				"state_class":         "measurement",
+			},
+		}
+	}
+	for _, d := range []struct {
+		key, name string
+		period    *sensors.DistancePeriod
+	}{
+		{"distance_today", "Distance Today", data.DistanceToday},
+		{"distance_week", "Distance This Week", data.DistanceWeek},
+	} {
+		if d.period == nil {
+			continue
+		}
+		states["sensor."+t.objectBase+"_"+d.key] = haState{
+			State: strconv.FormatFloat(math.Round(d.period.KM*10)/10, 'f', 1, 64),
+			Attributes: map[string]interface{}{
+				"friendly_name":       "BYD " + d.name,
+				"unit_of_measurement": "km",
+				"device_class":        "distance",
+				"state_class":         "total",
+				"last_reset":          d.period.Start.Format(time.RFC3339),
+			},
+		}
+	}
+	if data.BatteryTempSpread != nil {
+		states["sensor."+t.objectBase+"_battery_temp_spread"] = haState{
+			State: strconv.FormatFloat(math.Round(*data.BatteryTempSpread*10)/10, 'f', -1, 64),
+			Attributes: map[string]interface{}{
+				"friendly_name":       "BYD Battery Temperature Spread",
+				"unit_of_measurement": "°C",
+				"device_class":        "temperature",
+				"state_class":         "measurement",
+			},
+		}
+	}
+	if data.BatteryThermalState != nil {
+		states["sensor."+t.objectBase+"_battery_thermal_state"] = haState{
+			State: *data.BatteryThermalState,
+			Attributes: map[string]interface{}{
+				"friendly_name": "BYD Battery Thermal State",
+				"device_class":  "enum",
+				"options":       sensors.BatteryThermalStates,
+			},
+		}
+	}
+	if data.LocationZone != nil {
+		states["sensor."+t.objectBase+"_location_zone"] = haState{
+			State: *data.LocationZone,
+			Attributes: map[string]interface{}{
+				"friendly_name": "BYD Location Zone",
+				"icon":          "mdi:map-marker-radius",
+			},
+		}
+	}
+	if data.TirePressureImbalance != nil {
+		states["sensor."+t.objectBase+"_tire_pressure_imbalance"] = haState{
+			State: strconv.FormatFloat(*data.TirePressureImbalance, 'f', 2, 64),
+			Attributes: map[string]interface{}{
+				"friendly_name":       "BYD Tire Pressure Imbalance",
+				"unit_of_measurement": "bar",
+				"device_class":        "pressure",
+				"state_class":         "measurement",
+			},
+		}
+	}
+	if data.CabinComfort != nil {
+		states["sensor."+t.objectBase+"_cabin_comfort"] = haState{
+			State: strconv.FormatFloat(*data.CabinComfort, 'f', 0, 64),
+			Attributes: map[string]interface{}{
+				"friendly_name": "BYD Cabin Comfort",
+				"state_class":   "measurement",
+				"icon":          "mdi:sofa-single",
+			},
+		}
+	}
+	if data.Battery12VLow != nil {
+		low := "OFF"
+		if *data.Battery12VLow {
+			low = "ON"
+		}
+		states["binary_sensor."+t.objectBase+"_battery_12v_low"] = haState{
+			State: low,
+			Attributes: map[string]interface{}{
+				"friendly_name": "BYD 12V Battery Low",
+				"device_class":  "battery",
+			},
+		}
+	}
+	if data.Battery12VTrend != nil {
+		states["sensor."+t.objectBase+"_battery_12v_trend"] = haState{
+			State: strconv.FormatFloat(*data.Battery12VTrend, 'f', 3, 64),
+			Attributes: map[string]interface{}{
+				"friendly_name":       "BYD 12V Battery Trend",
+				"unit_of_measurement": "V/d",
+				"state_class":         "measurement",
+				"icon":                "mdi:car-battery",
+			},
+		}
+	}
+	return states
+}
+
+func (t *HARESTTransmitter) post(ctx context.Context, entityID string, st haState) error {
+	body, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s state: %w", entityID, err)
+	}
+	resp, err := t.do(ctx, http.MethodPost, "/api/states/"+entityID, body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("Home Assistant returned status %d for %s", resp.StatusCode, entityID)
+	}
+	return nil
+}
+
+func (t *HARESTTransmitter) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, haRequestTimeout)
+	defer cancel()
+
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, t.baseURL+path, rd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Home Assistant request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "byd-hass/1.0.0")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Home Assistant request failed: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	_ = resp.Body.Close()
+	return resp, nil
+}
+
+func (t *HARESTTransmitter) healthLoop() {
+	defer close(t.doneCh)
+	ticker := time.NewTicker(haHealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case <-ticker.C:
+			t.checkHealth()
+		}
+	}
+}
+
+// Check implements Checker: GET /api/ must succeed with the configured token.
+func (t *HARESTTransmitter) Check(ctx context.Context) error {
+	resp, err := t.do(ctx, http.MethodGet, "/api/", nil)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("Home Assistant rejected the token (status %d)", resp.StatusCode)
+	default:
+		return fmt.Errorf("Home Assistant returned status %d", resp.StatusCode)
+	}
+}
+
+func (t *HARESTTransmitter) checkHealth() {
+	resp, err := t.do(context.Background(), http.MethodGet, "/api/", nil)
+	ok := err == nil && resp.StatusCode == http.StatusOK
+	was := atomic.SwapUint32(&t.healthy, boolToUint32(ok)) == 1
+	switch {
+	case ok && !was:
+		t.logger.Info("Home Assistant REST API reachable")
+	case !ok && was:
+		if err == nil {
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		t.logger.WithError(err).Warn("Home Assistant REST API unreachable")
+	}
+}
+
+func boolToUint32(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// haStateString formats a published value as a Home Assistant state.
+func haStateString(v interface{}) string {
+	switch x := v.(type) {
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		if x {
+			return "on"
+		}
+		return "off"
+	case string:
+		return x
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// haObjectID lower-cases s and replaces everything outside [a-z0-9_] with '_',
+// as Home Assistant requires for entity object IDs.
+func haObjectID(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// tokenBucket is a minimal rate limiter: up to burst requests at once, refilled
+// at rate tokens per second.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait blocks until a token is available, ctx is done or stop is closed.
+func (b *tokenBucket) wait(ctx context.Context, stop <-chan struct{}) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-stop:
+			return errors.New("transmitter stopped")
+		case <-time.After(delay):
+		}
+	}
+}
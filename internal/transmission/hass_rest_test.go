@@ -0,0 +1,132 @@
+package transmission
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/units"
+)
+
+// fakeHAStates records the states posted to /api/states/<entity_id>.
+type fakeHAStates struct {
+	mu     sync.Mutex
+	posted map[string][]string // entity ID → states in order
+	units  map[string]string   // entity ID → last unit_of_measurement
+}
+
+func (f *fakeHAStates) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	entityID, ok := strings.CutPrefix(r.URL.Path, "/api/states/")
+	if !ok {
+		return // health check
+	}
+	var st haState
+	if err := json.NewDecoder(r.Body).Decode(&st); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.posted == nil {
+		f.posted = make(map[string][]string)
+		f.units = make(map[string]string)
+	}
+	f.posted[entityID] = append(f.posted[entityID], st.State)
+	f.units[entityID], _ = st.Attributes["unit_of_measurement"].(string)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (f *fakeHAStates) states(entityID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.posted[entityID]
+}
+
+func TestHARESTMissingSensor(t *testing.T) {
+	ha := &fakeHAStates{}
+	srv := httptest.NewServer(ha)
+	defer srv.Close()
+	tx, err := NewHARESTTransmitter(srv.URL, "token", "test", 1000, 1000, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close(context.Background())
+
+	soc := 80.0
+	zero := 0.0
+	speed := 42.0
+	// Speed reports, stops reporting once the hold expired, then reports a
+	// genuine zero. Mileage never reports.
+	for _, data := range []*sensors.SensorData{
+		{BatteryPercentage: &soc, Speed: &speed},
+		{BatteryPercentage: &soc},
+		{BatteryPercentage: &soc},
+		{BatteryPercentage: &soc, Speed: &zero},
+	} {
+		data.Timestamp = time.Now()
+		if err := tx.Transmit(context.Background(), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		"sensor.byd_test_speed":   "42 unavailable 0",
+		"sensor.byd_test_mileage": "",
+	}
+	for entityID, w := range want {
+		if got := strings.Join(ha.states(entityID), " "); got != w {
+			t.Errorf("%s posted %q, want %q", entityID, got, w)
+		}
+	}
+}
+
+func TestHARESTUnitSwitch(t *testing.T) {
+	ha := &fakeHAStates{}
+	srv := httptest.NewServer(ha)
+	defer srv.Close()
+	tx, err := NewHARESTTransmitter(srv.URL, "token", "test", 1000, 1000, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close(context.Background())
+
+	speed, outside := 100.0, 20.0
+	celsius, fahrenheit := 1.0, 2.0
+	steps := []struct {
+		setting   string
+		tempUnit  *float64
+		wantSpeed string
+		wantUnit  string
+	}{
+		{"metric", &fahrenheit, "100", "km/h"},
+		{"imperial", &celsius, "62.14", "mph"},
+		{units.Auto, &celsius, "100", "km/h"},
+		{units.Auto, &fahrenheit, "62.14", "mph"},
+		// Still imperial: an unchanged state is not posted again.
+		{units.Auto, nil, "62.14", "mph"},
+	}
+	const entityID = "sensor.byd_test_speed"
+	for i, st := range steps {
+		tx.SetUnits(st.setting)
+		data := &sensors.SensorData{Timestamp: time.Now(), Speed: &speed, OutsideTemperature: &outside, TemperatureUnit: st.tempUnit}
+		if err := tx.Transmit(context.Background(), data); err != nil {
+			t.Fatal(err)
+		}
+		posted := ha.states(entityID)
+		ha.mu.Lock()
+		unit := ha.units[entityID]
+		ha.mu.Unlock()
+		if got := posted[len(posted)-1]; got != st.wantSpeed || unit != st.wantUnit {
+			t.Errorf("step %d (%s): speed %s %s, want %s %s", i, st.setting, got, unit, st.wantSpeed, st.wantUnit)
+		}
+	}
+	if got := len(ha.states(entityID)); got != 4 {
+		t.Errorf("speed posted %d times, want 4", got)
+	}
+}
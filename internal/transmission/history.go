@@ -0,0 +1,568 @@
+package transmission
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// historySegmentSpan is how much time one segment file covers; pruning
+	// removes whole segments.
+	historySegmentSpan = time.Hour
+	historyIndexFile   = "index.json"
+	historyPrefix      = "history-"
+	historySuffix      = ".jsonl"
+	// historyMaxLine bounds one record when reading segments back.
+	historyMaxLine = 1 << 20
+)
+
+// Export formats of the history API.
+const (
+	HistoryFormatCSV  = "csv"
+	HistoryFormatJSON = "json"
+)
+
+// HistoryBuffer keeps the published snapshots of the last maxAge on disk, at
+// most maxBytes, so recent data can be exported while Home Assistant is
+// unreachable.
+//
+// Snapshots are appended as JSON lines to hourly segment files named
+// history-<unix start>.jsonl. Each record is written with a single unbuffered
+// write, so a crash loses at most the record being written; the torn tail
+// is cut off when the buffer is opened again. index.json lists the segments
+// with their time range and size. It is rewritten atomically whenever a
+// segment is started or pruned, and any segment whose size no longer
+// matches it (the one being written at the time of a crash) is rescanned.
+// Whole segments are pruned, oldest first, once the total exceeds maxBytes
+// or a segment ends before maxAge ago.
+type HistoryBuffer struct {
+	dir      string
+	maxAge   time.Duration
+	maxBytes int64
+	logger   *logrus.Logger
+
+	mu       sync.Mutex
+	segments []historySegment // oldest first; the last one is being written
+	file     *os.File
+	lastErr  error
+
+	guard closeGuard
+}
+
+// historySegment is one index entry.
+type historySegment struct {
+	Name    string    `json:"name"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Bytes   int64     `json:"bytes"`
+	Records int       `json:"records"`
+}
+
+type historyRecord struct {
+	T int64                  `json:"t"` // Unix milliseconds
+	V map[string]interface{} `json:"v"`
+}
+
+// NewHistoryBuffer opens (or creates) the buffer in dir.
+func NewHistoryBuffer(dir string, maxAge time.Duration, maxBytes int64, logger *logrus.Logger) (*HistoryBuffer, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("history size limit must be positive")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	segments, err := loadHistorySegments(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	h := &HistoryBuffer{dir: dir, maxAge: maxAge, maxBytes: maxBytes, logger: logger, segments: segments}
+	h.prune(time.Now())
+	if err := h.saveIndex(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Transmit appends the published values of data.
+func (h *HistoryBuffer) Transmit(_ context.Context, data *sensors.SensorData) error {
+	if h.guard.isClosed() {
+		return ErrClosed
+	}
+	ts := data.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	line, err := json.Marshal(historyRecord{T: ts.UnixMilli(), V: publishedValues(data)})
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %w", err)
+	}
+	line = append(line, '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastErr = h.append(ts, line)
+	return h.lastErr
+}
+
+func (h *HistoryBuffer) append(ts time.Time, line []byte) error {
+	n := len(h.segments)
+	if h.file == nil || ts.Sub(h.segments[n-1].From) >= historySegmentSpan || ts.Before(h.segments[n-1].From) {
+		if err := h.startSegment(ts); err != nil {
+			return err
+		}
+		n = len(h.segments)
+	}
+	if _, err := h.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	seg := &h.segments[n-1]
+	if ts.After(seg.To) {
+		seg.To = ts
+	}
+	seg.Bytes += int64(len(line))
+	seg.Records++
+	return nil
+}
+
+// startSegment closes the current segment file and starts a new one at ts.
+func (h *HistoryBuffer) startSegment(ts time.Time) error {
+	if err := h.closeFile(); err != nil {
+		h.logger.WithError(err).Warn("History: failed to close segment")
+	}
+	name := fmt.Sprintf("%s%d%s", historyPrefix, ts.Unix(), historySuffix)
+	if n := len(h.segments); n > 0 && h.segments[n-1].Name == name {
+		// Same second as the last segment (clock stepped back): keep writing it.
+		h.segments = h.segments[:n-1]
+		reopened, err := scanHistorySegment(h.dir, name, true)
+		if err != nil {
+			return err
+		}
+		h.segments = append(h.segments, reopened)
+	} else {
+		h.segments = append(h.segments, historySegment{Name: name, From: ts, To: ts})
+	}
+	f, err := os.OpenFile(filepath.Join(h.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history segment: %w", err)
+	}
+	h.file = f
+	h.prune(ts)
+	return h.saveIndex()
+}
+
+// prune removes finished segments past maxAge or beyond maxBytes.
+func (h *HistoryBuffer) prune(now time.Time) {
+	var total int64
+	for _, seg := range h.segments {
+		total += seg.Bytes
+	}
+	for len(h.segments) > 1 || (len(h.segments) == 1 && h.file == nil) {
+		oldest := h.segments[0]
+		expired := h.maxAge > 0 && oldest.To.Before(now.Add(-h.maxAge))
+		if !expired && total <= h.maxBytes {
+			return
+		}
+		if err := os.Remove(filepath.Join(h.dir, oldest.Name)); err != nil && !os.IsNotExist(err) {
+			h.logger.WithError(err).Warn("History: failed to remove old segment")
+			return
+		}
+		total -= oldest.Bytes
+		h.segments = h.segments[1:]
+	}
+}
+
+func (h *HistoryBuffer) saveIndex() error {
+	data, err := json.Marshal(h.segments)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history index: %w", err)
+	}
+	return config.WriteFileAtomic(filepath.Join(h.dir, historyIndexFile), data)
+}
+
+func (h *HistoryBuffer) closeFile() error {
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Sync()
+	if closeErr := h.file.Close(); err == nil {
+		err = closeErr
+	}
+	h.file = nil
+	return err
+}
+
+// Name implements Transmitter.
+func (h *HistoryBuffer) Name() string { return "History" }
+
+// IsConnected reports whether the last write succeeded.
+func (h *HistoryBuffer) IsConnected() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastErr == nil
+}
+
+// Close syncs the current segment and writes the index.
+func (h *HistoryBuffer) Close(context.Context) error {
+	return h.guard.close(func() error {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return errors.Join(h.closeFile(), h.saveIndex())
+	})
+}
+
+// Export streams the records matching q to w.
+func (h *HistoryBuffer) Export(w io.Writer, q HistoryQuery) error {
+	h.mu.Lock()
+	// Segments are append-only: the recorded sizes are complete records.
+	segments := append([]historySegment(nil), h.segments...)
+	h.mu.Unlock()
+	return exportHistory(h.dir, segments, w, q)
+}
+
+// ServeHTTP answers GET /api/history?from=…&to=…&ids=33,2&format=csv|json,
+// see ParseHistoryQuery.
+func (h *HistoryBuffer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := ParseHistoryQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Format == HistoryFormatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if err := h.Export(w, q); err != nil {
+		// Headers are gone; the client sees a truncated body.
+		h.logger.WithError(err).Warn("History export failed")
+	}
+}
+
+// ExportHistoryDir streams the records matching q from the buffer in dir to
+// w without opening it for writing, so it is safe while the collector is
+// running.
+func ExportHistoryDir(dir string, w io.Writer, q HistoryQuery) error {
+	segments, err := loadHistorySegments(dir, false)
+	if err != nil {
+		return err
+	}
+	return exportHistory(dir, segments, w, q)
+}
+
+// HistoryQuery selects records for export.
+type HistoryQuery struct {
+	From, To time.Time // inclusive; zero = unbounded
+	IDs      []int     // sensor IDs; empty = every published sensor
+	Format   string    // HistoryFormatCSV or HistoryFormatJSON
+}
+
+// ParseHistoryQuery parses from, to (RFC 3339, "2006-01-02T15:04",
+// "2006-01-02" in local time, or Unix seconds), ids (comma-separated sensor
+// IDs) and format (csv, the default, or json).
+func ParseHistoryQuery(v url.Values) (HistoryQuery, error) {
+	q := HistoryQuery{Format: HistoryFormatCSV}
+	var err error
+	if q.From, err = parseHistoryTime(v.Get("from")); err != nil {
+		return q, fmt.Errorf("invalid from: %w", err)
+	}
+	if q.To, err = parseHistoryTime(v.Get("to")); err != nil {
+		return q, fmt.Errorf("invalid to: %w", err)
+	}
+	if raw := v.Get("ids"); raw != "" {
+		for _, tok := range strings.Split(raw, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(tok))
+			if err != nil || sensors.GetSensorByID(id) == nil {
+				return q, fmt.Errorf("unknown sensor id %q", tok)
+			}
+			q.IDs = append(q.IDs, id)
+		}
+	}
+	if f := v.Get("format"); f != "" {
+		if f != HistoryFormatCSV && f != HistoryFormatJSON {
+			return q, fmt.Errorf("unknown format %q (supported: %s, %s)", f, HistoryFormatCSV, HistoryFormatJSON)
+		}
+		q.Format = f
+	}
+	return q, nil
+}
+
+func parseHistoryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time", s)
+}
+
+// exportHistory streams the records of segments matching q to w, one line at
+// a time.
+func exportHistory(dir string, segments []historySegment, w io.Writer, q HistoryQuery) error {
+	var keys []string
+	for _, id := range q.IDs {
+		keys = append(keys, sensors.ToSnakeCase(sensors.GetSensorByID(id).FieldName))
+	}
+	out := newHistoryWriter(w, q.Format, keys)
+	for _, seg := range segments {
+		if (!q.To.IsZero() && seg.From.After(q.To)) || (!q.From.IsZero() && seg.To.Before(q.From)) {
+			continue
+		}
+		if err := exportHistorySegment(filepath.Join(dir, seg.Name), seg.Bytes, q, out); err != nil {
+			return err
+		}
+	}
+	return out.close()
+}
+
+func exportHistorySegment(path string, size int64, q HistoryQuery, out historyWriter) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil // pruned meanwhile
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open history segment: %w", err)
+	}
+	defer f.Close()
+	return readHistoryRecords(io.LimitReader(f, size), func(rec historyRecord) error {
+		ts := time.UnixMilli(rec.T)
+		if (!q.From.IsZero() && ts.Before(q.From)) || (!q.To.IsZero() && ts.After(q.To)) {
+			return nil
+		}
+		return out.write(ts, rec.V)
+	})
+}
+
+// readHistoryRecords calls fn for each complete, well-formed record of r.
+func readHistoryRecords(r io.Reader, fn func(historyRecord) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), historyMaxLine)
+	for scanner.Scan() {
+		var rec historyRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue // torn record
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read history segment: %w", err)
+	}
+	return nil
+}
+
+// historyWriter formats exported records.
+type historyWriter interface {
+	write(ts time.Time, values map[string]interface{}) error
+	close() error
+}
+
+func newHistoryWriter(w io.Writer, format string, keys []string) historyWriter {
+	if format == HistoryFormatJSON {
+		return &historyJSONWriter{w: w, keys: keys}
+	}
+	if len(keys) == 0 {
+		keys = csvColumns()
+	}
+	return &historyCSVWriter{w: csv.NewWriter(w), keys: keys}
+}
+
+// historyCSVWriter writes a header of sensor keys and one row per record.
+type historyCSVWriter struct {
+	w       *csv.Writer
+	keys    []string
+	started bool
+}
+
+func (c *historyCSVWriter) write(ts time.Time, values map[string]interface{}) error {
+	if !c.started {
+		c.started = true
+		if err := c.w.Write(append([]string{"timestamp"}, c.keys...)); err != nil {
+			return err
+		}
+	}
+	row := make([]string, 0, len(c.keys)+1)
+	row = append(row, ts.UTC().Format(time.RFC3339))
+	for _, k := range c.keys {
+		row = append(row, csvValue(values[k]))
+	}
+	return c.w.Write(row)
+}
+
+func (c *historyCSVWriter) close() error {
+	if !c.started {
+		if err := c.w.Write(append([]string{"timestamp"}, c.keys...)); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// historyJSONWriter writes a JSON array of {"timestamp", "values"} objects.
+type historyJSONWriter struct {
+	w     io.Writer
+	keys  []string
+	count int
+}
+
+func (j *historyJSONWriter) write(ts time.Time, values map[string]interface{}) error {
+	if len(j.keys) > 0 {
+		filtered := make(map[string]interface{}, len(j.keys))
+		for _, k := range j.keys {
+			if v, ok := values[k]; ok {
+				filtered[k] = v
+			}
+		}
+		values = filtered
+	}
+	data, err := json.Marshal(struct {
+		Timestamp string                 `json:"timestamp"`
+		Values    map[string]interface{} `json:"values"`
+	}{ts.UTC().Format(time.RFC3339), values})
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if j.count == 0 {
+		sep = "[\n"
+	}
+	j.count++
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *historyJSONWriter) close() error {
+	end := "\n]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// loadHistorySegments lists the segments in dir, oldest first. Index entries
+// are trusted while the file size matches; other segments are rescanned.
+// With repair, a torn record at the end of a segment is cut off.
+func loadHistorySegments(dir string, repair bool) ([]historySegment, error) {
+	indexed := make(map[string]historySegment)
+	if data, err := os.ReadFile(filepath.Join(dir, historyIndexFile)); err == nil {
+		var list []historySegment
+		if json.Unmarshal(data, &list) == nil {
+			for _, seg := range list {
+				indexed[seg.Name] = seg
+			}
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history directory: %w", err)
+	}
+	var segments []historySegment
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, historyPrefix) || !strings.HasSuffix(name, historySuffix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if seg, ok := indexed[name]; ok && seg.Bytes == info.Size() {
+			segments = append(segments, seg)
+			continue
+		}
+		seg, err := scanHistorySegment(dir, name, repair)
+		if err != nil {
+			return nil, err
+		}
+		if seg.Records > 0 {
+			segments = append(segments, seg)
+		} else if repair {
+			_ = os.Remove(filepath.Join(dir, name))
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].From.Before(segments[j].From) })
+	return segments, nil
+}
+
+// scanHistorySegment rebuilds the index entry of one segment from its
+// records.
+func scanHistorySegment(dir, name string, repair bool) (historySegment, error) {
+	path := filepath.Join(dir, name)
+	seg := historySegment{Name: name}
+	f, err := os.Open(path)
+	if err != nil {
+		return seg, fmt.Errorf("failed to open history segment: %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break // a torn record (if any) is not counted
+		}
+		if err != nil {
+			return seg, fmt.Errorf("failed to read history segment: %w", err)
+		}
+		var rec historyRecord
+		if json.Unmarshal(line, &rec) == nil {
+			ts := time.UnixMilli(rec.T)
+			if seg.Records == 0 || ts.Before(seg.From) {
+				seg.From = ts
+			}
+			if ts.After(seg.To) {
+				seg.To = ts
+			}
+			seg.Records++
+		}
+		seg.Bytes += int64(len(line))
+	}
+	if seg.Records == 0 {
+		if sec, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, historyPrefix), historySuffix), 10, 64); err == nil {
+			seg.From = time.Unix(sec, 0)
+			seg.To = seg.From
+		}
+	}
+	if repair {
+		if err := os.Truncate(path, seg.Bytes); err != nil {
+			return seg, fmt.Errorf("failed to repair history segment: %w", err)
+		}
+	}
+	return seg, nil
+}
@@ -0,0 +1,206 @@
+package transmission
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// writeHistory appends one record per SoC, 30 minutes apart from start, so
+// every other record starts a new hourly segment.
+func writeHistory(t *testing.T, h *HistoryBuffer, start time.Time, socs ...float64) {
+	t.Helper()
+	for i, soc := range socs {
+		soc := soc
+		speed := float64(10 * i)
+		data := &sensors.SensorData{Timestamp: start.Add(time.Duration(i) * 30 * time.Minute), BatteryPercentage: &soc, Speed: &speed}
+		if err := h.Transmit(context.Background(), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func exportString(t *testing.T, h *HistoryBuffer, query string) string {
+	t.Helper()
+	v, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := ParseHistoryQuery(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := h.Export(&buf, q); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestHistoryExport(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h, err := NewHistoryBuffer(t.TempDir(), 0, 1<<20, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close(context.Background())
+	writeHistory(t, h, start, 80, 79, 78, 77)
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "csv",
+			query: "ids=33,2",
+			want: "timestamp,battery_percentage,speed\n" +
+				"2024-05-01T12:00:00Z,80,0\n2024-05-01T12:30:00Z,79,10\n" +
+				"2024-05-01T13:00:00Z,78,20\n2024-05-01T13:30:00Z,77,30\n",
+		},
+		{
+			name:  "time range",
+			query: "ids=33&from=2024-05-01T12:30:00Z&to=2024-05-01T13:00:00Z",
+			want:  "timestamp,battery_percentage\n2024-05-01T12:30:00Z,79\n2024-05-01T13:00:00Z,78\n",
+		},
+		{
+			name:  "json",
+			query: "ids=33&format=json&from=1714570200",
+			want:  "[\n" + `{"timestamp":"2024-05-01T13:30:00Z","values":{"battery_percentage":77}}` + "\n]\n",
+		},
+		{
+			name:  "nothing in range",
+			query: "ids=33&format=json&from=2024-06-01T00:00:00Z",
+			want:  "[]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exportString(t, h, tt.query); got != tt.want {
+				t.Errorf("export %q:\n%s\nwant:\n%s", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/history?ids=33&to=2024-05-01T12:00:00Z", nil))
+	if got, want := rec.Body.String(), "timestamp,battery_percentage\n2024-05-01T12:00:00Z,80\n"; got != want || rec.Header().Get("Content-Type") != "text/csv" {
+		t.Errorf("GET /api/history = %q (%s), want %q", got, rec.Header().Get("Content-Type"), want)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/history?format=xml", nil))
+	if rec.Code != 400 {
+		t.Errorf("unknown format: status %d, want 400", rec.Code)
+	}
+}
+
+func TestHistoryReopen(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	h, err := NewHistoryBuffer(dir, 0, 1<<20, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeHistory(t, h, start, 80, 79, 78)
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash tore the last record of the newest segment.
+	segments, _ := filepath.Glob(filepath.Join(dir, historyPrefix+"*"))
+	if len(segments) != 2 {
+		t.Fatalf("%d segments, want 2", len(segments))
+	}
+	newest := segments[len(segments)-1]
+	f, err := os.OpenFile(newest, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"t":171457`)
+	f.Close()
+
+	h, err = NewHistoryBuffer(dir, 0, 1<<20, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close(context.Background())
+	if data, _ := os.ReadFile(newest); !bytes.HasSuffix(data, []byte("}\n")) {
+		t.Error("torn record not cut off")
+	}
+	writeHistory(t, h, start.Add(90*time.Minute), 77)
+	want := "timestamp,battery_percentage\n2024-05-01T12:00:00Z,80\n2024-05-01T12:30:00Z,79\n" +
+		"2024-05-01T13:00:00Z,78\n2024-05-01T13:30:00Z,77\n"
+	if got := exportString(t, h, "ids=33"); got != want {
+		t.Errorf("export after reopening:\n%s\nwant:\n%s", got, want)
+	}
+
+	// -export-history reads the directory without the buffer.
+	var buf bytes.Buffer
+	if err := ExportHistoryDir(dir, &buf, HistoryQuery{IDs: []int{33}, Format: HistoryFormatCSV}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("ExportHistoryDir:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestHistoryPrune(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxAge   time.Duration
+		maxBytes int64
+		want     string // battery values left
+	}{
+		{"within limits", 0, 1 << 20, "80 79 78 77 76 75"},
+		{"size", 0, 100, "76 75"},
+		{"age", time.Hour, 1 << 20, "78 77 76 75"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Recent timestamps, so opening the buffer prunes nothing.
+			start := time.Now().Add(-3 * time.Hour).Truncate(time.Hour)
+			h, err := NewHistoryBuffer(t.TempDir(), tt.maxAge, tt.maxBytes, quietLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close(context.Background())
+			writeHistory(t, h, start, 80, 79, 78, 77, 76, 75)
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(exportString(t, h, "ids=33")), "\n")[1:] {
+				got = append(got, line[strings.Index(line, ",")+1:])
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("left %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHistoryQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{query: ""},
+		{query: "from=2024-05-01&to=2024-05-01T18:30&ids=33,%202&format=json"},
+		{query: "from=1714557600"},
+		{query: "from=yesterday", wantErr: true},
+		{query: "ids=33,x", wantErr: true},
+		{query: "ids=9999", wantErr: true},
+		{query: "format=xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		v, _ := url.ParseQuery(tt.query)
+		if _, err := ParseHistoryQuery(v); (err != nil) != tt.wantErr {
+			t.Errorf("ParseHistoryQuery(%q) err = %v, want error %v", tt.query, err, tt.wantErr)
+		}
+	}
+}
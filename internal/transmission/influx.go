@@ -0,0 +1,391 @@
+package transmission
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	influxMeasurement    = "byd"
+	influxMaxAttempts    = 5
+	influxInitialBackoff = 2 * time.Second
+	influxMaxBackoff     = 30 * time.Second
+	influxRequestTimeout = 15 * time.Second
+)
+
+// InfluxTransmitter writes the published sensor values to an InfluxDB v2
+// /api/v2/write endpoint in line protocol, one point per sensor:
+//
+//	byd,device=<id>,sensor=speed value=87.5 1699999999000000000
+//
+// Numeric and boolean sensors use the float field "value". String sensors are
+// written as a string field "text", or – when listed in tagSensors – as a
+// "state" tag with value=1 so they can be grouped by in queries.
+//
+// Transmit only queues lines; a background goroutine flushes every
+// flushInterval or as soon as batchSize lines are pending. A failed batch is
+// handed to the spool when one is set; otherwise it is retried with capped
+// back-off and dropped with a warning after influxMaxAttempts.
+type InfluxTransmitter struct {
+	writeURL      string
+	healthURL     string
+	token         string
+	deviceID      string
+	tagSensors    map[string]bool
+	batchSize     int
+	flushInterval time.Duration
+	httpClient    *http.Client
+	logger        *logrus.Logger
+
+	mu      sync.Mutex
+	pending []string
+
+	healthy uint32
+	flushCh chan struct{}
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+
+	spool *spoolQueue // undelivered batches; nil = drop after the retries
+
+	guard closeGuard
+}
+
+// NewInfluxTransmitter creates the transmitter and starts its flush loop.
+// baseURL is the InfluxDB server (e.g. http://influx:8086).
+func NewInfluxTransmitter(baseURL, org, bucket, token, deviceID string, tagSensors []string, batchSize int, flushInterval time.Duration, logger *logrus.Logger) (*InfluxTransmitter, error) {
+	if org == "" || bucket == "" {
+		return nil, fmt.Errorf("InfluxDB org and bucket are required")
+	}
+	u, err := url.Parse(strings.TrimRight(baseURL, "/") + "/api/v2/write")
+	if err != nil {
+		return nil, fmt.Errorf("invalid InfluxDB URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("org", org)
+	q.Set("bucket", bucket)
+	q.Set("precision", "ns")
+	u.RawQuery = q.Encode()
+
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	if flushInterval <= 0 {
+		flushInterval = 10 * time.Second
+	}
+
+	t := &InfluxTransmitter{
+		writeURL:      u.String(),
+		healthURL:     strings.TrimRight(baseURL, "/") + "/health",
+		token:         token,
+		deviceID:      deviceID,
+		tagSensors:    make(map[string]bool),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		httpClient:    &http.Client{Timeout: influxRequestTimeout},
+		logger:        logger,
+		healthy:       1,
+		flushCh:       make(chan struct{}, 1),
+		stopCh:        make(chan struct{}),
+		doneCh:        make(chan struct{}),
+	}
+	for _, s := range tagSensors {
+		if s = strings.TrimSpace(s); s != "" {
+			t.tagSensors[s] = true
+		}
+	}
+	go t.run()
+	return t, nil
+}
+
+// SetTransport implements TransportSetter.
+func (t *InfluxTransmitter) SetTransport(rt http.RoundTripper) {
+	t.httpClient.Transport = rt
+}
+
+// Transmit queues one point per published sensor.
+func (t *InfluxTransmitter) Transmit(_ context.Context, data *sensors.SensorData) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
+	lines := t.lines(data)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	t.pending = append(t.pending, lines...)
+	full := len(t.pending) >= t.batchSize
+	t.mu.Unlock()
+
+	if full {
+		select {
+		case t.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Name implements Transmitter.
+func (t *InfluxTransmitter) Name() string { return "InfluxDB" }
+
+// IsConnected reports whether the last batch was written successfully.
+func (t *InfluxTransmitter) IsConnected() bool {
+	return atomic.LoadUint32(&t.healthy) == 1
+}
+
+// Close flushes what is pending and stops the flush loop.
+func (t *InfluxTransmitter) Close(ctx context.Context) error {
+	return t.guard.close(func() error {
+		close(t.stopCh)
+		select {
+		case <-t.doneCh:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("InfluxDB flush on close: %w", ctx.Err())
+		}
+	})
+}
+
+func (t *InfluxTransmitter) run() {
+	defer close(t.doneCh)
+	ticker := time.NewTicker(t.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stopCh:
+			t.flush()
+			return
+		case <-ticker.C:
+			t.flush()
+		case <-t.flushCh:
+			t.flush()
+		}
+	}
+}
+
+// flush writes pending lines in batches of at most batchSize.
+func (t *InfluxTransmitter) flush() {
+	for {
+		t.mu.Lock()
+		n := len(t.pending)
+		if n == 0 {
+			t.mu.Unlock()
+			return
+		}
+		if n > t.batchSize {
+			n = t.batchSize
+		}
+		batch := t.pending[:n:n]
+		t.pending = t.pending[n:]
+		t.mu.Unlock()
+
+		if t.spool != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), influxRequestTimeout)
+			queued, err := t.spool.send(ctx, []byte(strings.Join(batch, "\n")))
+			cancel()
+			switch {
+			case err != nil && queued:
+				atomic.StoreUint32(&t.healthy, 0)
+				t.logger.WithError(err).Debugf("InfluxDB write failed – %d points spooled", len(batch))
+			case err != nil:
+				atomic.StoreUint32(&t.healthy, 0)
+				t.logger.WithError(err).Warnf("InfluxDB write failed – dropping %d points", len(batch))
+				return
+			case !queued:
+				atomic.StoreUint32(&t.healthy, 1)
+			}
+			continue
+		}
+		if err := t.writeWithRetry(batch); err != nil {
+			atomic.StoreUint32(&t.healthy, 0)
+			t.logger.WithError(err).Warnf("InfluxDB write failed – dropping %d points", len(batch))
+			return
+		}
+		atomic.StoreUint32(&t.healthy, 1)
+	}
+}
+
+func (t *InfluxTransmitter) writeWithRetry(batch []string) error {
+	body := []byte(strings.Join(batch, "\n"))
+	backoff := influxInitialBackoff
+	var lastErr error
+	for attempt := 1; attempt <= influxMaxAttempts; attempt++ {
+		retry, err := t.write(context.Background(), body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || attempt == influxMaxAttempts {
+			break
+		}
+		t.logger.WithError(err).Debugf("InfluxDB attempt %d failed – retrying in %s", attempt, backoff)
+		select {
+		case <-t.stopCh:
+			return lastErr
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > influxMaxBackoff {
+			backoff = influxMaxBackoff
+		}
+	}
+	return lastErr
+}
+
+// Check implements Checker using the /health endpoint. The token is only
+// verified by the first write.
+func (t *InfluxTransmitter) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.healthURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create InfluxDB request: %w", err)
+	}
+	req.Header.Set("User-Agent", "byd-hass/1.0.0")
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("InfluxDB unreachable: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("InfluxDB health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Buffered implements BufferReporter: the batches waiting in the spool.
+func (t *InfluxTransmitter) Buffered() int {
+	if t.spool == nil {
+		return 0
+	}
+	return t.spool.depth()
+}
+
+// SetSpool hands batches that could not be written to s, which replays them
+// in order once InfluxDB is back. Call it before the first Transmit.
+func (t *InfluxTransmitter) SetSpool(s *Spool) error {
+	q, err := s.queue("influxdb", t.deliverSpooled, spoolQueueOptions{})
+	if err != nil {
+		return err
+	}
+	t.spool = q
+	return nil
+}
+
+// deliverSpooled makes one write attempt for the spool. Responses that
+// writeWithRetry would not retry count as rejections.
+func (t *InfluxTransmitter) deliverSpooled(ctx context.Context, body []byte) error {
+	retry, err := t.write(ctx, body)
+	if err == nil {
+		atomic.StoreUint32(&t.healthy, 1)
+		return nil
+	}
+	if !retry {
+		return spoolRejection{err}
+	}
+	return err
+}
+
+// write performs one request. retry reports whether the failure is transient.
+func (t *InfluxTransmitter) write(ctx context.Context, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, influxRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create InfluxDB request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", "byd-hass/1.0.0")
+	if t.token != "" {
+		req.Header.Set("Authorization", "Token "+t.token)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("InfluxDB request failed: %w", err)
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	// 429 and 5xx are transient; anything else (bad token, malformed line)
+	// won't get better by retrying.
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("InfluxDB returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+}
+
+// lines renders data as line protocol in PublishedSensorIDs order.
+func (t *InfluxTransmitter) lines(data *sensors.SensorData) []string {
+	values := publishedValues(data)
+	ts := data.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	stamp := strconv.FormatInt(ts.UnixNano(), 10)
+	prefix := influxMeasurement + ",device=" + influxEscapeTag(t.deviceID) + ",sensor="
+
+	var out []string
+	for _, id := range sensors.PublishedSensorIDs() {
+		def := sensors.GetSensorByID(id)
+		if def == nil {
+			continue
+		}
+		name := sensors.ToSnakeCase(def.FieldName)
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+
+		var series, fields string
+		switch x := v.(type) {
+		case float64:
+			series, fields = influxEscapeTag(name), "value="+strconv.FormatFloat(x, 'f', -1, 64)
+		case bool:
+			f := "0"
+			if x {
+				f = "1"
+			}
+			series, fields = influxEscapeTag(name), "value="+f
+		case string:
+			if x == "" {
+				continue
+			}
+			if t.tagSensors[name] {
+				series, fields = influxEscapeTag(name)+",state="+influxEscapeTag(x), "value=1"
+			} else {
+				series, fields = influxEscapeTag(name), "text="+influxQuoteString(x)
+			}
+		default:
+			continue
+		}
+		out = append(out, prefix+series+" "+fields+" "+stamp)
+	}
+	return out
+}
+
+var (
+	influxTagEscaper    = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+	influxStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+func influxEscapeTag(s string) string {
+	return influxTagEscaper.Replace(s)
+}
+
+func influxQuoteString(s string) string {
+	return `"` + influxStringEscaper.Replace(s) + `"`
+}
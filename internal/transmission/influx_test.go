@@ -0,0 +1,132 @@
+package transmission
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+func TestInfluxLines(t *testing.T) {
+	tx := &InfluxTransmitter{deviceID: "my car"}
+	soc, speed := 80.5, 42.0
+	got := tx.lines(&sensors.SensorData{Timestamp: time.Unix(1714557600, 0), BatteryPercentage: &soc, Speed: &speed})
+	// In PublishedSensorIDs order.
+	want := []string{
+		`byd,device=my\ car,sensor=speed value=42 1714557600000000000`,
+		`byd,device=my\ car,sensor=battery_percentage value=80.5 1714557600000000000`,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("lines\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestInfluxEscaping(t *testing.T) {
+	tests := []struct {
+		in, tag, str string
+	}{
+		{"plain", "plain", `"plain"`},
+		{"a b,c=d", `a\ b\,c\=d`, `"a b,c=d"`},
+		{`say "hi" \o/`, `say\ "hi"\ \o/`, `"say \"hi\" \\o/"`},
+	}
+	for _, tt := range tests {
+		if got := influxEscapeTag(tt.in); got != tt.tag {
+			t.Errorf("influxEscapeTag(%q) = %q, want %q", tt.in, got, tt.tag)
+		}
+		if got := influxQuoteString(tt.in); got != tt.str {
+			t.Errorf("influxQuoteString(%q) = %q, want %q", tt.in, got, tt.str)
+		}
+	}
+}
+
+func TestInfluxWrite(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantConnected bool
+	}{
+		{"written", http.StatusNoContent, true},
+		{"rejected batch is dropped", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				requests = append(requests, fmt.Sprint(r.URL.RequestURI(), " ", r.Header.Get("Authorization"), " ", strings.Count(string(body), "\n")+1))
+				mu.Unlock()
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			// Nothing is flushed before Stop: the interval is long and the
+			// batch never fills.
+			tx, err := NewInfluxTransmitter(srv.URL+"/", "org", "car data", "tok", "car", nil, 100, time.Hour, quietLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				soc := float64(80 - i)
+				if err := tx.Transmit(context.Background(), &sensors.SensorData{Timestamp: time.Now(), BatteryPercentage: &soc}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tx.Close(context.Background())
+
+			mu.Lock()
+			defer mu.Unlock()
+			want := []string{"/api/v2/write?bucket=car+data&org=org&precision=ns Token tok 3"}
+			if fmt.Sprint(requests) != fmt.Sprint(want) {
+				t.Errorf("requests %q, want %q", requests, want)
+			}
+			if got := tx.IsConnected(); got != tt.wantConnected {
+				t.Errorf("IsConnected() = %v, want %v", got, tt.wantConnected)
+			}
+		})
+	}
+}
+
+func TestInfluxBatchSize(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		sizes = append(sizes, strings.Count(string(body), "\n")+1)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	tx, err := NewInfluxTransmitter(srv.URL, "org", "bucket", "", "car", nil, 2, time.Hour, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		soc := float64(80 - i)
+		tx.Transmit(context.Background(), &sensors.SensorData{Timestamp: time.Now(), BatteryPercentage: &soc})
+	}
+	tx.Close(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	total := 0
+	for _, n := range sizes {
+		if n > 2 {
+			t.Errorf("batch of %d lines, batch size 2", n)
+		}
+		total += n
+	}
+	if total != 5 {
+		t.Errorf("%d lines written, want 5", total)
+	}
+}
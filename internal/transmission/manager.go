@@ -0,0 +1,319 @@
+package transmission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultTransmitTimeout bounds a single transmission when none is given at
+// registration.
+const DefaultTransmitTimeout = 30 * time.Second
+
+// ErrTransmitterBusy is reported when a transmitter is still working on an
+// earlier (timed-out) transmission.
+var ErrTransmitterBusy = errors.New("previous transmission still running")
+
+// ErrNotReady is reported for a transmitter that is still connecting (see
+// Manager.Await). It is not counted as an error.
+var ErrNotReady = errors.New("not connected yet")
+
+// ErrOverBudget is reported by SendAll for a transmitter still running when
+// the cycle budget ran out. The transmission carries on in the background and
+// the transmitter misses the next cycle if it is still busy then.
+var ErrOverBudget = errors.New("missed the cycle budget")
+
+// Manager is the registry of named transmitters. Send runs each transmission
+// in its own goroutine with a context bounded by the transmitter's timeout, so
+// a slow or dead destination never delays the others, and keeps
+// per-transmitter counters for diagnostics.
+type Manager struct {
+	logger *logrus.Logger
+
+	inFlight sync.WaitGroup
+	// abortCtx is cancelled when Close gives up waiting, aborting every
+	// transmission still in flight.
+	abortCtx context.Context
+	abort    context.CancelFunc
+
+	mu      sync.Mutex
+	entries map[string]*managedTransmitter
+	order   []string
+	waiting map[string]bool // still connecting, by name
+}
+
+type managedTransmitter struct {
+	tx      Transmitter
+	timeout time.Duration
+
+	busy        bool
+	sent        uint64
+	errors      uint64
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// TransmitterStats is the diagnostic view of one registered transmitter.
+type TransmitterStats struct {
+	Name        string     `json:"name"`
+	Connected   bool       `json:"connected"`
+	Busy        bool       `json:"busy"`
+	Sent        uint64     `json:"sent"`
+	Errors      uint64     `json:"errors"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// NewManager creates an empty registry.
+func NewManager(logger *logrus.Logger) *Manager {
+	abortCtx, abort := context.WithCancel(context.Background())
+	return &Manager{
+		logger:   logger,
+		abortCtx: abortCtx,
+		abort:    abort,
+		entries:  make(map[string]*managedTransmitter),
+		waiting:  make(map[string]bool),
+	}
+}
+
+// Await holds back transmissions to the named transmitter, registered or
+// not, until Ready is called for it.
+func (m *Manager) Await(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waiting[name] = true
+}
+
+// Ready lets the named transmitter join the fan-out.
+func (m *Manager) Ready(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.waiting, name)
+}
+
+// Register adds tx under tx.Name(). timeout bounds each transmission; 0 uses
+// DefaultTransmitTimeout.
+func (m *Manager) Register(tx Transmitter, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultTransmitTimeout
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := tx.Name()
+	if _, ok := m.entries[name]; ok {
+		return fmt.Errorf("transmitter %q registered twice", name)
+	}
+	m.entries[name] = &managedTransmitter{tx: tx, timeout: timeout}
+	m.order = append(m.order, name)
+	return nil
+}
+
+// Names lists the registered transmitters in registration order.
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.order...)
+}
+
+// Send transmits data to the named transmitter in the background and calls
+// done with the outcome once it finished or its timeout expired. A
+// transmitter is never entered twice: while an earlier call is still running,
+// done receives ErrTransmitterBusy straight away, and ErrNotReady while it is
+// still connecting.
+func (m *Manager) Send(ctx context.Context, name string, data *sensors.SensorData, done func(err error)) {
+	m.mu.Lock()
+	e, ok := m.entries[name]
+	if !ok {
+		m.mu.Unlock()
+		done(fmt.Errorf("unknown transmitter %q", name))
+		return
+	}
+	if m.waiting[name] {
+		m.mu.Unlock()
+		done(ErrNotReady)
+		return
+	}
+	if e.busy {
+		m.mu.Unlock()
+		m.logger.WithField("transmitter", name).Debug("Skipping transmission: previous one still running")
+		m.record(e, ErrTransmitterBusy)
+		done(ErrTransmitterBusy)
+		return
+	}
+	e.busy = true
+	m.mu.Unlock()
+
+	m.inFlight.Add(1)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+		stop := context.AfterFunc(m.abortCtx, cancel)
+		defer stop()
+
+		result := make(chan error, 1)
+		go func() {
+			err := e.tx.Transmit(ctx, data)
+			m.mu.Lock()
+			e.busy = false
+			m.mu.Unlock()
+			m.inFlight.Done()
+			result <- err
+		}()
+
+		// Transmitters honour ctx; this only guards against one that doesn't.
+		var err error
+		select {
+		case err = <-result:
+		case <-ctx.Done():
+			err = fmt.Errorf("%s transmit timed out after %s", name, e.timeout)
+		}
+		m.record(e, err)
+		done(err)
+	}()
+}
+
+// SendAll sends data to the named transmitters at once, each through Send, and
+// waits until they all finished but no longer than budget (0 = no limit
+// beyond their own timeouts). done, if not nil, is called for every
+// transmitter with its outcome, also for one finishing after SendAll
+// returned. The returned error joins the failures seen within the budget,
+// ErrOverBudget for the transmitters that were still running.
+//
+// data is shared by every transmitter and must not be changed afterwards.
+func (m *Manager) SendAll(ctx context.Context, names []string, data *sensors.SensorData, budget time.Duration, done func(name string, err error)) error {
+	waitCtx := context.Background()
+	if budget > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(waitCtx, budget)
+		defer cancel()
+	}
+
+	// errgroup keeps only the first error; the others are kept per
+	// transmitter so the caller sees every one of them.
+	var g errgroup.Group
+	errs := make([]error, len(names))
+	for i, name := range names {
+		i, name := i, name
+		g.Go(func() error {
+			result := make(chan error, 1)
+			m.Send(ctx, name, data, func(err error) {
+				if done != nil {
+					done(name, err)
+				}
+				result <- err
+			})
+			select {
+			case err := <-result:
+				if err != nil {
+					errs[i] = fmt.Errorf("%s: %w", name, err)
+				}
+			case <-waitCtx.Done():
+				errs[i] = fmt.Errorf("%s: %w", name, ErrOverBudget)
+			}
+			return errs[i]
+		})
+	}
+	if g.Wait() == nil {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Manager) record(e *managedTransmitter, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		e.errors++
+		e.lastError = err.Error()
+		e.lastErrorAt = time.Now()
+		return
+	}
+	e.sent++
+	e.lastSuccess = time.Now()
+}
+
+// Stats returns the counters of every registered transmitter.
+func (m *Manager) Stats() []TransmitterStats {
+	m.mu.Lock()
+	stats := make([]TransmitterStats, 0, len(m.order))
+	txs := make([]Transmitter, 0, len(m.order))
+	for _, name := range m.order {
+		e := m.entries[name]
+		s := TransmitterStats{
+			Name:      name,
+			Busy:      e.busy,
+			Sent:      e.sent,
+			Errors:    e.errors,
+			LastError: e.lastError,
+		}
+		if !e.lastSuccess.IsZero() {
+			t := e.lastSuccess
+			s.LastSuccess = &t
+		}
+		if !e.lastErrorAt.IsZero() {
+			t := e.lastErrorAt
+			s.LastErrorAt = &t
+		}
+		stats = append(stats, s)
+		txs = append(txs, e.tx)
+	}
+	m.mu.Unlock()
+
+	// IsConnected may wait for a transmission in progress, so it is queried
+	// without holding the registry lock.
+	for i, tx := range txs {
+		stats[i].Connected = tx.IsConnected()
+	}
+	return stats
+}
+
+// Close waits for transmissions still in flight, then closes every registered
+// transmitter in parallel. Both steps give up once ctx expires.
+func (m *Manager) Close(ctx context.Context) error {
+	idle := make(chan struct{})
+	go func() {
+		m.inFlight.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		m.logger.Warn("Shutdown: aborting transmissions still running")
+		m.abort()
+	}
+
+	m.mu.Lock()
+	txs := make([]Transmitter, 0, len(m.order))
+	for _, name := range m.order {
+		txs = append(txs, m.entries[name].tx)
+	}
+	m.mu.Unlock()
+
+	errs := make([]error, len(txs))
+	var wg sync.WaitGroup
+	for i, tx := range txs {
+		wg.Add(1)
+		go func(i int, tx Transmitter) {
+			defer wg.Done()
+			if err := tx.Close(ctx); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", tx.Name(), err)
+			}
+		}(i, tx)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// ServeHTTP serves Stats as JSON (mounted on /diagnostics).
+func (m *Manager) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"transmitters": m.Stats()})
+}
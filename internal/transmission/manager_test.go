@@ -0,0 +1,184 @@
+package transmission
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// fakeTransmitter takes delay to transmit, or until ctx is done, and reads
+// the snapshot it was given so the race detector sees a shared one.
+type fakeTransmitter struct {
+	name  string
+	delay time.Duration
+	err   error
+
+	mu    sync.Mutex
+	speed []float64
+}
+
+func (f *fakeTransmitter) Transmit(ctx context.Context, data *sensors.SensorData) error {
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if data.Speed != nil {
+		f.speed = append(f.speed, *data.Speed)
+	}
+	return f.err
+}
+
+func (f *fakeTransmitter) IsConnected() bool           { return true }
+func (f *fakeTransmitter) Name() string                { return f.name }
+func (f *fakeTransmitter) Close(context.Context) error { return nil }
+
+func TestManagerSendAll(t *testing.T) {
+	errRejected := errors.New("rejected")
+	tests := []struct {
+		name     string
+		txs      []*fakeTransmitter
+		timeout  time.Duration // per transmitter
+		budget   time.Duration
+		maxWait  time.Duration // SendAll must have returned by then
+		wantErrs map[string]error
+	}{
+		{
+			name:    "all in time",
+			txs:     []*fakeTransmitter{{name: "mqtt"}, {name: "abrp", delay: 20 * time.Millisecond}},
+			budget:  time.Second,
+			maxWait: 500 * time.Millisecond,
+		},
+		{
+			name:     "errors collected",
+			txs:      []*fakeTransmitter{{name: "mqtt", err: errRejected}, {name: "abrp", err: errRejected}, {name: "traccar"}},
+			budget:   time.Second,
+			maxWait:  500 * time.Millisecond,
+			wantErrs: map[string]error{"mqtt": errRejected, "abrp": errRejected},
+		},
+		{
+			name:     "slow one misses the budget",
+			txs:      []*fakeTransmitter{{name: "mqtt"}, {name: "abrp", delay: time.Second}},
+			budget:   50 * time.Millisecond,
+			maxWait:  500 * time.Millisecond,
+			wantErrs: map[string]error{"abrp": ErrOverBudget},
+		},
+		{
+			name:     "no budget waits for the timeout",
+			txs:      []*fakeTransmitter{{name: "mqtt"}, {name: "abrp", delay: time.Second}},
+			timeout:  50 * time.Millisecond,
+			maxWait:  500 * time.Millisecond,
+			wantErrs: map[string]error{"abrp": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(quietLogger())
+			var names []string
+			for _, tx := range tt.txs {
+				if err := m.Register(tx, tt.timeout); err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, tx.Name())
+			}
+
+			speed := 42.0
+			data := &sensors.SensorData{Speed: &speed}
+			var mu sync.Mutex
+			reported := make(map[string]bool)
+			allDone := make(chan struct{})
+			start := time.Now()
+			err := m.SendAll(context.Background(), names, data, tt.budget, func(name string, _ error) {
+				mu.Lock()
+				defer mu.Unlock()
+				reported[name] = true
+				if len(reported) == len(names) {
+					close(allDone)
+				}
+			})
+			if elapsed := time.Since(start); elapsed > tt.maxWait {
+				t.Errorf("SendAll returned after %s, want within %s", elapsed, tt.maxWait)
+			}
+
+			for _, name := range names {
+				want, failed := tt.wantErrs[name]
+				switch {
+				case !failed && err != nil && errorNames(err)[name]:
+					t.Errorf("%s reported as failed: %v", name, err)
+				case failed && !errorNames(err)[name]:
+					t.Errorf("%s not reported as failed: %v", name, err)
+				case want != nil && !errors.Is(err, want):
+					t.Errorf("err = %v, want it to wrap %v", err, want)
+				}
+			}
+
+			// Late transmitters still report once they finished.
+			select {
+			case <-allDone:
+			case <-time.After(2 * time.Second):
+				t.Fatal("done not called for every transmitter")
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := m.Close(ctx); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestManagerSendAllBusy checks that a transmitter that missed the budget
+// is skipped by the next cycle while still running.
+func TestManagerSendAllBusy(t *testing.T) {
+	m := NewManager(quietLogger())
+	slow := &fakeTransmitter{name: "abrp", delay: 300 * time.Millisecond}
+	fast := &fakeTransmitter{name: "mqtt"}
+	for _, tx := range []Transmitter{slow, fast} {
+		if err := m.Register(tx, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	speed := 1.0
+	data := &sensors.SensorData{Speed: &speed}
+	names := []string{"abrp", "mqtt"}
+
+	if err := m.SendAll(context.Background(), names, data, 20*time.Millisecond, nil); !errors.Is(err, ErrOverBudget) {
+		t.Fatalf("first cycle: err = %v, want ErrOverBudget", err)
+	}
+	err := m.SendAll(context.Background(), names, data, 20*time.Millisecond, nil)
+	if !errors.Is(err, ErrTransmitterBusy) || errorNames(err)["mqtt"] {
+		t.Fatalf("second cycle: err = %v, want only abrp busy", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := m.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	fast.mu.Lock()
+	defer fast.mu.Unlock()
+	if len(fast.speed) != 2 {
+		t.Errorf("mqtt transmitted %d times, want 2", len(fast.speed))
+	}
+}
+
+// errorNames returns the transmitters named by the errors joined in err.
+func errorNames(err error) map[string]bool {
+	names := make(map[string]bool)
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return names
+	}
+	for _, e := range joined.Unwrap() {
+		name, _, _ := strings.Cut(e.Error(), ":")
+		names[name] = true
+	}
+	return names
+}
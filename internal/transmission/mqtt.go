@@ -1,24 +1,108 @@
 package transmission
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"reflect"
+	"math"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Allthebester/byd-hass/internal/mqtt"
 	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/units"
 	"github.com/sirupsen/logrus"
 )
 
 // MQTTTransmitter transmits sensor data via MQTT
 type MQTTTransmitter struct {
 	client           *mqtt.Client
-	deviceID         string
+	deviceID         string // topic/unique_id namespace (config.NamespaceID)
+	vehicleName      string // optional label appended to the HA device name
+	deviceModel      string // HA device model
+	swVersion        string // HA device sw_version
 	discoveryPrefix  string
 	logger           *logrus.Logger
 	publishedSensors map[string]bool // Tracks published discovery configs
+	// sensorMeta is the device class and unit each sensor config was
+	// announced with; a signal strength sensor found to report a quality
+	// changes them (see sensors.SensorDefinition.HAMeta).
+	sensorMeta map[string]string
+	// discoveryTopics are the discovery topics holding a config this run
+	// delivered; Close withdraws them when cleanup is set.
+	discoveryTopics map[string]bool
+	cleanup         atomic.Bool
+
+	// unitSetting is "metric", "imperial" or units.Auto (see SetUnits);
+	// units is the system the current discovery configs announce.
+	unitSetting atomic.Value
+	units       units.System
+
+	// lastPublished remembers the payload last delivered per topic so each
+	// cycle only publishes what actually changed.
+	lastPublished map[string]publishedPayload
+	// policy decides which topics are published; it may be changed while
+	// running (see SetPublishMode, SetRepublishInterval).
+	policyMu sync.Mutex
+	policy   publishPolicy
+
+	// controls are the runtime settings exposed as number/select entities.
+	controls []Control
+	// pollCommand is set once the poll-now command topic is subscribed.
+	pollCommand bool
+	// diagnostics enables the health sensor (see EnableDiagnostics).
+	diagnostics bool
+	// zones are the geofence zones (see EnableZones); nil = disabled.
+	zones []string
+	// deviceTracker publishes raw GPS coordinates (see SetDeviceTracker).
+	deviceTracker bool
+
+	// layout is LayoutNative or LayoutTeslamate (see SetLayout).
+	layout         string
+	teslamateCarID int
+	teslamateState string
+	teslamateSince time.Time
+
+	// removals are the sensors whose discovery configs the next Transmit
+	// withdraws (see RemoveSensors); smoothedRemovals those of their
+	// <name>_smoothed sensors.
+	removalsMu       sync.Mutex
+	removals         []int
+	smoothedRemovals []int
+
+	guard closeGuard
+}
+
+// publishedPayload is the last payload delivered on a topic.
+type publishedPayload struct {
+	payload []byte
+	at      time.Time
+}
+
+// mqttMessage is a single publish queued during a Transmit cycle.
+type mqttMessage struct {
+	topic    string
+	payload  []byte
+	retained bool
+	// discoveryKey, when set, is marked in publishedSensors once the message
+	// has been delivered.
+	discoveryKey string
+	// binary marks binary sensor states, which are only published on
+	// change even with PublishAlways.
+	binary bool
+	// deadband lets numbers in the payload move by less than the configured
+	// deadband without counting as a change.
+	deadband bool
+	// exact marks a state payload: its whole-number sensors compare exactly
+	// despite deadband (see exactStateKeys), and the per-sensor deadbands
+	// apply (see SetSensorDeadbands).
+	exact bool
+	// state marks sensor states, which are published with the configured
+	// QoS (see SetQoS) instead of 1.
+	state bool
 }
 
 // HADiscoveryConfig represents Home Assistant MQTT discovery configuration
@@ -29,11 +113,23 @@ type HADiscoveryConfig struct {
 	ValueTemplate     string   `json:"value_template,omitempty"`
 	DeviceClass       string   `json:"device_class,omitempty"`
 	UnitOfMeasurement string   `json:"unit_of_measurement,omitempty"`
+	DisplayPrecision  *int     `json:"suggested_display_precision,omitempty"` // see sensors.Precisions
 	Device            HADevice `json:"device"`
 	AvailabilityTopic string   `json:"availability_topic"`
+	AttributesTopic   string   `json:"json_attributes_topic,omitempty"`
 	Icon              string   `json:"icon,omitempty"`
 	StateClass        string   `json:"state_class,omitempty"`
 	EntityCategory    string   `json:"entity_category,omitempty"`
+	Options           []string `json:"options,omitempty"` // allowed states for device_class "enum" and select entities
+	CommandTopic      string   `json:"command_topic,omitempty"`
+	Min               *float64 `json:"min,omitempty"`
+	Max               *float64 `json:"max,omitempty"`
+	Step              *float64 `json:"step,omitempty"`
+	Mode              string   `json:"mode,omitempty"`
+	EventTypes        []string `json:"event_types,omitempty"`
+	// LastResetValueTemplate extracts the last reset of a state_class
+	// "total" sensor.
+	LastResetValueTemplate string `json:"last_reset_value_template,omitempty"`
 }
 
 // HADevice represents the device information for Home Assistant
@@ -55,7 +151,9 @@ type SensorConfig struct {
 	Icon        string
 	StateClass  string
 	Category    string
-	ScaleFactor float64 // For unit conversion
+	ScaleFactor float64  // For unit conversion
+	Options     []string // enum labels, see sensors.ValueMaps
+	Precision   *int     // decimals, see sensors.Precisions; nil = as read
 }
 
 // NewMQTTTransmitter creates a new MQTT transmitter
@@ -66,9 +164,43 @@ func NewMQTTTransmitter(client *mqtt.Client, deviceID, discoveryPrefix string, l
 		discoveryPrefix:  discoveryPrefix,
 		logger:           logger,
 		publishedSensors: make(map[string]bool),
+		sensorMeta:       make(map[string]string),
+		discoveryTopics:  make(map[string]bool),
+		lastPublished:    make(map[string]publishedPayload),
+		policy:           publishPolicy{mode: PublishOnChange},
+		deviceModel:      "Car",
+		swVersion:        "1.0.0",
+		layout:           LayoutNative,
+		deviceTracker:    true,
 	}
 }
 
+// SetVehicleName labels the Home Assistant device so several cars on one
+// broker are distinguishable. The topic namespace itself comes from deviceID.
+func (t *MQTTTransmitter) SetVehicleName(name string) {
+	t.vehicleName = name
+}
+
+// SetDeviceInfo sets the model and software version shown on the Home
+// Assistant device card that groups all entities. Empty values keep the
+// defaults.
+func (t *MQTTTransmitter) SetDeviceInfo(model, swVersion string) {
+	if model != "" {
+		t.deviceModel = model
+	}
+	if swVersion != "" {
+		t.swVersion = swVersion
+	}
+}
+
+// SetRepublishInterval makes Transmit re-send unchanged topics once their last
+// publish is older than d. Zero disables forced republishing.
+func (t *MQTTTransmitter) SetRepublishInterval(d time.Duration) {
+	t.policyMu.Lock()
+	defer t.policyMu.Unlock()
+	t.policy.republish = d
+}
+
 // getSensorConfigs builds sensor discovery configurations dynamically
 // from the canonical sensors.AllSensors slice. This removes the need to
 // manually maintain a duplicate list every time a new sensor is added.
@@ -85,36 +217,102 @@ func (t *MQTTTransmitter) getSensorConfigs() []SensorConfig {
 
 	configs := make([]SensorConfig, 0, len(idSet))
 
+	smoothed := make(map[int]bool)
+	for _, id := range sensors.SmoothedSensorIDs() {
+		smoothed[id] = true
+	}
+
 	for _, def := range sensors.AllSensors {
 		if _, ok := idSet[def.ID]; !ok {
 			continue // skip sensors not in the allowed MQTT list
 		}
+		deviceClass, unit := def.HAMeta()
 		configs = append(configs, SensorConfig{
 			Name:        def.EnglishName,
 			EntityID:    sensors.ToSnakeCase(def.FieldName),
-			EntityType:  def.Category,          // "sensor" / "binary_sensor"
-			DeviceClass: def.DeviceClass,       // may be "" if not set
-			Unit:        def.UnitOfMeasurement, // may be "" if not set
-			ScaleFactor: 1.0,                   // default; can be refined later
+			EntityType:  def.Category,   // "sensor" / "binary_sensor"
+			DeviceClass: deviceClass,    // may be "" if not set
+			Unit:        unit,           // may be "" if not set
+			StateClass:  def.StateClass, // may be "" if not set
+			ScaleFactor: 1.0,            // default; can be refined later
+			Options:     sensors.ValueMapFor(def.ID).Options(),
+			Precision:   precisionOf(def.ID),
 		})
+		if smoothed[def.ID] {
+			c := configs[len(configs)-1]
+			c.Name += " (Smoothed)"
+			c.EntityID += "_smoothed"
+			c.Options = nil
+			configs = append(configs, c)
+		}
 	}
 	return configs
 }
 
-// publishDiscoveryForSensor publishes the discovery config for a single sensor.
-func (t *MQTTTransmitter) publishDiscoveryForSensor(sensor SensorConfig, device HADevice, baseTopic string) error {
+// RemoveSensors withdraws the Home Assistant entities of the given sensors
+// with the next Transmit, e.g. after they were dropped from the monitored
+// sensors. Sensors published again later are re-announced. It is safe to call
+// while Transmit runs.
+func (t *MQTTTransmitter) RemoveSensors(ids []int) {
+	t.removalsMu.Lock()
+	defer t.removalsMu.Unlock()
+	t.removals = append(t.removals, ids...)
+}
+
+// RemoveSmoothedSensors withdraws the <name>_smoothed entities of the given
+// sensors with the next Transmit, e.g. after their smoothing was turned off.
+// It is safe to call while Transmit runs.
+func (t *MQTTTransmitter) RemoveSmoothedSensors(ids []int) {
+	t.removalsMu.Lock()
+	defer t.removalsMu.Unlock()
+	t.smoothedRemovals = append(t.smoothedRemovals, ids...)
+}
+
+// queueSensorRemovals queues empty retained discovery configs for the sensors
+// passed to RemoveSensors and RemoveSmoothedSensors.
+func (t *MQTTTransmitter) queueSensorRemovals(batch *[]mqttMessage) {
+	t.removalsMu.Lock()
+	ids, smoothed := t.removals, t.smoothedRemovals
+	t.removals, t.smoothedRemovals = nil, nil
+	t.removalsMu.Unlock()
+
+	for i, id := range append(ids, smoothed...) {
+		def := sensors.GetSensorByID(id)
+		if def == nil {
+			continue
+		}
+		entityID := sensors.ToSnakeCase(def.FieldName)
+		if i >= len(ids) {
+			entityID += "_smoothed"
+		}
+		delete(t.publishedSensors, fmt.Sprintf("%s_%s", t.deviceID, entityID))
+		topic := fmt.Sprintf("%s/%s/byd_car_%s/%s/config", t.discoveryPrefix, def.Category, t.deviceID, entityID)
+		*batch = append(*batch, mqttMessage{topic: topic, payload: []byte{}, retained: true})
+	}
+}
+
+// queueDiscoveryForSensor queues the discovery config for a single sensor.
+func (t *MQTTTransmitter) queueDiscoveryForSensor(batch *[]mqttMessage, sensor SensorConfig, device HADevice, baseTopic string) error {
 	uniqueID := fmt.Sprintf("%s_%s", t.deviceID, sensor.EntityID)
 
-	// Skip if already published
-	if t.publishedSensors[uniqueID] {
+	// Skip if already published with the same device class and unit
+	meta := sensor.DeviceClass + " " + sensor.Unit
+	if t.publishedSensors[uniqueID] && t.sensorMeta[uniqueID] == meta {
 		return nil
 	}
+	t.sensorMeta[uniqueID] = meta
 
+	// A sensor missing from the state (see sensors.ValueHolder) shows as
+	// unknown rather than as a made-up zero.
+	stateTopic := fmt.Sprintf("%s/state", baseTopic)
+	if onOffStateKeys()[sensor.EntityID] {
+		stateTopic = fmt.Sprintf("%s/binary_state", baseTopic)
+	}
 	config := HADiscoveryConfig{
 		Name:              sensor.Name,
 		UniqueID:          uniqueID,
-		StateTopic:        fmt.Sprintf("%s/state", baseTopic),
-		ValueTemplate:     fmt.Sprintf("{{ value_json.%s | default(0) }}", sensor.EntityID),
+		StateTopic:        stateTopic,
+		ValueTemplate:     fmt.Sprintf("{{ value_json.%s | default(None) }}", sensor.EntityID),
 		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
 		Device:            device,
 	}
@@ -134,43 +332,54 @@ func (t *MQTTTransmitter) publishDiscoveryForSensor(sensor SensorConfig, device
 	if sensor.Category != "" {
 		config.EntityCategory = sensor.Category
 	}
+	if sensor.Precision != nil {
+		config.DisplayPrecision = sensor.Precision
+	}
+	if len(sensor.Options) > 0 {
+		// Published as labels (see labelValues), not numbers.
+		config.DeviceClass = "enum"
+		config.Options = sensor.Options
+		config.UnitOfMeasurement = ""
+		config.StateClass = ""
+		config.DisplayPrecision = nil
+	}
 
 	topic := fmt.Sprintf("%s/%s/byd_car_%s/%s/config",
 		t.discoveryPrefix, sensor.EntityType, t.deviceID, sensor.EntityID)
 
-	if err := t.publishConfigRaw(topic, config); err != nil {
-		return fmt.Errorf("failed to publish %s discovery config: %w", sensor.Name, err)
+	if err := t.queueConfigRaw(batch, uniqueID, topic, config); err != nil {
+		return fmt.Errorf("failed to build %s discovery config: %w", sensor.Name, err)
 	}
-
-	t.logger.WithFields(logrus.Fields{
-		"sensor_name": sensor.Name,
-		"entity_id":   sensor.EntityID,
-		"topic":       topic,
-	}).Debug("Published sensor discovery config")
-
-	// Mark as published
-	t.publishedSensors[uniqueID] = true
 	return nil
 }
 
-// publishDiscoveryConfigs ensures all available sensors have their discovery configs published.
-func (t *MQTTTransmitter) publishDiscoveryConfigs(data *sensors.SensorData) error {
+// queueDiscoveryConfigs queues discovery configs for every entity that has not
+// been announced yet.
+func (t *MQTTTransmitter) queueDiscoveryConfigs(batch *[]mqttMessage) {
+	deviceName := "BYD Car"
+	if t.vehicleName != "" {
+		deviceName = fmt.Sprintf("BYD Car (%s)", t.vehicleName)
+	}
+	// Every discovery config carries this block so HA groups all entities
+	// under a single device.
 	device := HADevice{
 		Identifiers:  []string{fmt.Sprintf("byd_car_%s", t.deviceID)},
-		Name:         "BYD Car",
-		Model:        "Car",
+		Name:         deviceName,
+		Model:        t.deviceModel,
 		Manufacturer: "BYD",
-		SWVersion:    "1.0.0",
+		SWVersion:    t.swVersion,
 	}
 	baseTopic := fmt.Sprintf("byd_car/%s", t.deviceID)
 
-	// Publish device_tracker discovery first (if not already done)
-	if !t.publishedSensors["device_tracker"] {
-		if err := t.publishDeviceTrackerDiscovery(baseTopic, device); err != nil {
-			t.logger.WithError(err).Warn("Failed to publish device_tracker discovery")
-		} else {
-			t.logger.Debug("Device tracker discovery config published")
-			t.publishedSensors["device_tracker"] = true
+	// Queue device_tracker discovery first (if not already done)
+	if !t.deviceTracker {
+		t.queueDeviceTrackerRemoval(batch)
+	} else if err := t.queueDeviceTrackerDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Warn("Failed to build device_tracker discovery")
+	}
+	if t.zones != nil {
+		if err := t.queueZoneDiscovery(batch, baseTopic, device); err != nil {
+			t.logger.WithError(err).Error("Failed to build zone discovery")
 		}
 	}
 
@@ -180,86 +389,231 @@ func (t *MQTTTransmitter) publishDiscoveryConfigs(data *sensors.SensorData) erro
 		// Always publish Home-Assistant discovery for allowed sensors even if we don't
 		// currently have a value for them. This guarantees that the full set of
 		// entities defined in PublishedSensorIDs becomes available in the UI right from
-		// the start. The ValueTemplate in publishDiscoveryForSensor already
+		// the start. The ValueTemplate in queueDiscoveryForSensor already
 		// employs a `default(0)` filter, so missing values will not break
 		// rendering.
-		if err := t.publishDiscoveryForSensor(config, device, baseTopic); err != nil {
-			t.logger.WithError(err).WithField("sensor", config.Name).Error("Failed to publish discovery config")
+		if err := t.queueDiscoveryForSensor(batch, config, device, baseTopic); err != nil {
+			t.logger.WithError(err).WithField("sensor", config.Name).Error("Failed to build discovery config")
 			// Continue to the next sensor
 		}
 	}
 
-	// Publish Last Transmission discovery
-	if err := t.publishLastTransmissionDiscovery(baseTopic, device); err != nil {
-		t.logger.WithError(err).Error("Failed to publish Last Transmission discovery")
+	// Last Transmission discovery
+	if err := t.queueLastTransmissionDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Last Transmission discovery")
 	}
 
-	// Publish derived Charging Status discovery (virtual sensor)
-	if err := t.publishDerivedChargingStatusDiscovery(baseTopic, device); err != nil {
-		t.logger.WithError(err).Error("Failed to publish Charging Status discovery")
+	// Derived Charging Status discovery (virtual sensor)
+	if err := t.queueDerivedChargingStatusDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Charging Status discovery")
 	}
 
-	return nil
-}
+	// Last charge session (virtual sensor with session details as attributes)
+	if err := t.queueChargeSessionDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Charge Session discovery")
+	}
 
-// publishConfigRaw publishes a raw configuration object
-func (t *MQTTTransmitter) publishConfigRaw(topic string, config interface{}) error {
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return fmt.Errorf("failed to marshal discovery config: %w", err)
+	// Summary of the last completed charge session (virtual sensors)
+	if err := t.queueSummaryDiscovery(batch, baseTopic+"/charge_session/summary", chargeSessionSummarySensors, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build charge session summary discovery")
 	}
 
-	if err := t.client.Publish(topic, payload, true); err != nil {
-		return fmt.Errorf("failed to publish discovery config to %s: %w", topic, err)
+	// Trip computer (virtual sensors)
+	if err := t.queueSummaryDiscovery(batch, baseTopic+"/trip/last", lastTripSensors, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build last trip discovery")
+	}
+	if err := t.queueSummaryDiscovery(batch, baseTopic+"/trip/current", currentTripSensors, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build current trip discovery")
 	}
 
-	return nil
-}
+	// Doors open / windows open / vehicle locked (virtual sensors)
+	if err := t.queueAggregateDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build aggregate discovery")
+	}
+	if err := t.queueOpenCountDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build open count discovery")
+	}
 
-// buildStatePayload builds the JSON payload for the state topic
-func (t *MQTTTransmitter) buildStatePayload(data *sensors.SensorData) ([]byte, error) {
-	state := make(map[string]interface{})
-	// Pre-compute allowed entityIDs in snake_case for quick filtering
-	allowed := make(map[string]struct{}, len(sensors.PublishedSensorIDs()))
-	for _, id := range sensors.PublishedSensorIDs() {
-		if def := sensors.GetSensorByID(id); def != nil {
-			allowed[sensors.ToSnakeCase(def.FieldName)] = struct{}{}
-		}
+	// Driving state enum (virtual sensor)
+	if err := t.queueDrivingStateDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Driving State discovery")
+	}
+
+	// Rolling efficiency (virtual sensor)
+	if err := t.queueEfficiencyDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Efficiency discovery")
 	}
 
-	v := reflect.ValueOf(data).Elem()
-	tOf := v.Type()
+	// Range estimate and the rolling consumption behind it (virtual sensors)
+	if err := t.queueRangeDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Range Estimate discovery")
+	}
 
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Field(i)
+	// Daily and weekly distance from the odometer (virtual sensors)
+	if err := t.queueDistanceDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build distance discovery")
+	}
 
-		// Skip unexported fields or fields that are nil
-		if !field.CanInterface() || (field.Kind() == reflect.Ptr && field.IsNil()) {
-			continue
-		}
+	// Battery temperature spread and thermal management (virtual sensors)
+	if err := t.queueBatteryThermalDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build battery thermal discovery")
+	}
 
-		jsonTag := tOf.Field(i).Tag.Get("json")
-		jsonKey := strings.Split(jsonTag, ",")[0]
+	// Tire pressure spread (virtual sensor)
+	if err := t.queueTirePressureDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Tire Pressure Imbalance discovery")
+	}
 
-		if jsonKey == "" || jsonKey == "-" {
-			continue
-		}
+	// Cabin comfort score (virtual sensor)
+	if err := t.queueCabinComfortDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Cabin Comfort discovery")
+	}
 
-		if _, ok := allowed[jsonKey]; !ok {
-			continue // not in MQTT allow-list
-		}
+	// 12V battery low warning and trend (virtual sensors)
+	if err := t.queueBattery12VDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build 12V battery discovery")
+	}
 
-		// Dereference pointer to get the actual value
-		var value interface{}
-		if field.Kind() == reflect.Ptr {
-			value = field.Elem().Interface()
-		} else {
-			value = field.Interface()
+	// Time elapsed since the timestamp sensors (virtual sensors)
+	if err := t.queueEventAgeDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build event age discovery")
+	}
+
+	// Sleep-aware polling mode (virtual sensor)
+	if err := t.queuePollModeDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Polling Mode discovery")
+	}
+
+	// Debounced charging binary_sensor (virtual sensor)
+	if err := t.queueDerivedChargingDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Charging discovery")
+	}
+
+	// Runtime settings (number/select entities)
+	for _, c := range t.controls {
+		if err := t.queueControlDiscovery(batch, c, baseTopic, device); err != nil {
+			t.logger.WithError(err).WithField("control", c.Key).Error("Failed to build control discovery")
+		}
+	}
+	if t.pollCommand {
+		if err := t.queuePollButtonDiscovery(batch, baseTopic, device); err != nil {
+			t.logger.WithError(err).Error("Failed to build Refresh Now discovery")
+		}
+	}
+	if err := t.queueWatchdogDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build keepalive discovery")
+	}
+	if err := t.queueEventDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Warning discovery")
+	}
+	if err := t.queueCarEventDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Car Event discovery")
+	}
+	if err := t.queueDiplusConnectedDiscovery(batch, baseTopic, device); err != nil {
+		t.logger.WithError(err).Error("Failed to build Diplus Connected discovery")
+	}
+	if t.diagnostics {
+		if err := t.queueDiagnosticsDiscovery(batch, baseTopic, device); err != nil {
+			t.logger.WithError(err).Error("Failed to build Health discovery")
 		}
-		state[jsonKey] = value
 	}
+}
+
+// queueConfigRaw marshals a discovery configuration object and queues it as a
+// retained message. key is marked as published once delivery succeeds.
+func (t *MQTTTransmitter) queueConfigRaw(batch *[]mqttMessage, key, topic string, config interface{}) error {
+	if c, ok := config.(HADiscoveryConfig); ok && c.UnitOfMeasurement != "" {
+		c.UnitOfMeasurement = t.units.Unit(c.UnitOfMeasurement)
+		config = c
+	}
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal discovery config: %w", err)
+	}
+
+	*batch = append(*batch, mqttMessage{topic: topic, payload: payload, retained: true, discoveryKey: key})
+	return nil
+}
+
+// buildStatePayload builds the JSON payload for the state topic, and the one
+// for the binary_state topic: the values of the on/off sensors (see
+// onOffStateKeys), which the state payload carries as well.
+func (t *MQTTTransmitter) buildStatePayload(data *sensors.SensorData) ([]byte, []byte, error) {
+	state := publishedValues(data)
+	labelValues(state)
+	eventTimeValues(state, data)
+
 	// Inject derived/virtual sensors -------------------------------------
 	state["charging_status"] = sensors.DeriveChargingStatus(data)
+	if data.DrivingState != nil {
+		state["driving_state"] = *data.DrivingState
+	}
+	if data.EfficiencyWhKM != nil {
+		state["efficiency"] = math.Round(*data.EfficiencyWhKM)
+	}
+	if data.ConsumptionKWh100KM != nil {
+		state["rolling_consumption"] = math.Round(*data.ConsumptionKWh100KM*10) / 10
+	}
+	if data.RangeEstimateKM != nil {
+		state["range_estimate_km"] = math.Round(*data.RangeEstimateKM)
+	}
+	if data.DoorsOpenCount != nil {
+		state["doors_open_count"] = *data.DoorsOpenCount
+	}
+	if data.WindowsOpenCount != nil {
+		state["windows_open_count"] = *data.WindowsOpenCount
+	}
+	for key, p := range map[string]*sensors.DistancePeriod{"distance_today": data.DistanceToday, "distance_week": data.DistanceWeek} {
+		if p != nil {
+			state[key] = math.Round(p.KM*10) / 10
+			state[key+"_reset"] = p.Start.Format(time.RFC3339)
+		}
+	}
+	if data.BatteryTempSpread != nil {
+		state["battery_temp_spread"] = math.Round(*data.BatteryTempSpread*10) / 10
+	}
+	if data.BatteryThermalState != nil && *data.BatteryThermalState != sensors.BatteryThermalUnknown {
+		state["battery_thermal_state"] = *data.BatteryThermalState
+	}
+	if data.LocationZone != nil {
+		state["location_zone"] = *data.LocationZone
+	}
+	if data.TirePressureImbalance != nil {
+		state["tire_pressure_imbalance"] = math.Round(*data.TirePressureImbalance*100) / 100
+	}
+	if data.CabinComfort != nil {
+		state["cabin_comfort"] = *data.CabinComfort
+	}
+	if data.Battery12VLow != nil {
+		state["battery_12v_low"] = "OFF"
+		if *data.Battery12VLow {
+			state["battery_12v_low"] = "ON"
+		}
+	}
+	if data.Battery12VTrend != nil {
+		state["battery_12v_trend"] = math.Round(*data.Battery12VTrend*1000) / 1000
+	}
+	if data.PollMode != nil {
+		state["poll_mode"] = *data.PollMode
+	}
+	if data.KeepaliveMinutes != nil {
+		state["head_unit_keepalive_minutes"] = *data.KeepaliveMinutes
+	}
+	if data.DiplusRequestsToday != nil {
+		state["diplus_requests_today"] = *data.DiplusRequestsToday
+	}
+	for id, v := range data.Smoothed {
+		if def := sensors.GetSensorByID(id); def != nil {
+			state[sensors.ToSnakeCase(def.FieldName)+"_smoothed"] = v
+		}
+	}
+	if data.Charging != nil {
+		state["charging"] = "OFF"
+		if data.Charging.Charging {
+			state["charging"] = "ON"
+		}
+		state["charging_dcfc"] = data.Charging.DCFC
+	}
 
 	// Add a 'state' field for the device_tracker
 	if data.Speed != nil && *data.Speed > 0 {
@@ -272,78 +626,278 @@ func (t *MQTTTransmitter) buildStatePayload(data *sensors.SensorData) ([]byte, e
 		state["state"] = "parked"
 	}
 
-	return json.Marshal(state)
+	t.convertUnits(state)
+	roundValues(state)
+	onOff := make(map[string]interface{})
+	for key := range onOffStateKeys() {
+		if v, ok := state[key]; ok {
+			onOff[key] = v
+		}
+	}
+	statePayload, err := json.Marshal(state)
+	if err != nil {
+		return nil, nil, err
+	}
+	onOffPayload, err := json.Marshal(onOff)
+	if err != nil {
+		return nil, nil, err
+	}
+	return statePayload, onOffPayload, nil
 }
 
-// Transmit sends sensor data to MQTT
-func (t *MQTTTransmitter) Transmit(data *sensors.SensorData) error {
+// Transmit sends sensor data to MQTT. All messages for the cycle are computed
+// up-front and published in a fixed order (discovery, state, location,
+// availability, last transmission); topics whose payload has not changed since
+// the last successful publish are skipped. Individual publish failures do not
+// abort the cycle – they are collected and returned together.
+func (t *MQTTTransmitter) Transmit(ctx context.Context, data *sensors.SensorData) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
 	if !t.client.IsConnected() {
 		// Best-effort publish "offline" retained message (will silently drop if
 		// the client really is disconnected). Ignore error.
 		_ = t.publishAvailability(false)
+		// Retained state may be gone by the time we reconnect (e.g. broker
+		// restart), so send everything again on the next cycle.
+		t.lastPublished = make(map[string]publishedPayload)
 		return fmt.Errorf("MQTT client not connected")
 	}
 
-	// Publish discovery config for available sensors if it hasn't been done
-	if err := t.publishDiscoveryConfigs(data); err != nil {
-		// Log error but don't block transmission
-		t.logger.WithError(err).Error("Failed to publish Home Assistant discovery configs")
+	batch, err := t.buildBatch(data)
+	if err != nil {
+		return err
+	}
+	return t.publishBatch(ctx, batch)
+}
+
+// buildBatch computes every message for this cycle without publishing any.
+func (t *MQTTTransmitter) buildBatch(data *sensors.SensorData) ([]mqttMessage, error) {
+	if t.layout == LayoutTeslamate {
+		return t.buildTeslamateBatch(data), nil
+	}
+	t.resolveUnits(data)
+
+	var batch []mqttMessage
+
+	// Discovery configs for entities not announced yet, and withdrawals of
+	// sensors that are no longer published
+	t.queueSensorRemovals(&batch)
+	t.queueDiscoveryConfigs(&batch)
+
+	// Sensor state
+	statePayload, onOffPayload, err := t.buildStatePayload(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build state payload: %w", err)
+	}
+	batch = append(batch, mqttMessage{
+		topic:    fmt.Sprintf("byd_car/%s/state", t.deviceID),
+		payload:  statePayload,
+		retained: true,
+		deadband: true,
+		exact:    true,
+		state:    true,
+	})
+	// The on/off sensors are read from their own topic, which stays
+	// change-only with PublishAlways.
+	batch = append(batch, mqttMessage{
+		topic:    fmt.Sprintf("byd_car/%s/binary_state", t.deviceID),
+		payload:  onOffPayload,
+		retained: true,
+		binary:   true,
+		state:    true,
+	})
+
+	// Location data if available
+	if data.Location != nil && t.deviceTracker {
+		locPayload, err := t.buildLocationPayload(data)
+		if err != nil {
+			t.logger.WithError(err).Warn("Failed to build location payload")
+		} else {
+			batch = append(batch, mqttMessage{
+				topic:   fmt.Sprintf("byd_car/%s/location", t.deviceID),
+				payload: locPayload,
+			})
+		}
 	}
 
-	// Publish sensor data
-	if err := t.publishSensorData(data); err != nil {
-		return fmt.Errorf("failed to publish sensor data: %w", err)
+	// Ongoing / last charge session
+	if data.ChargeSession != nil {
+		sessionPayload, err := json.Marshal(data.ChargeSession)
+		if err != nil {
+			t.logger.WithError(err).Warn("Failed to build charge session payload")
+		} else {
+			batch = append(batch, mqttMessage{
+				topic:    fmt.Sprintf("byd_car/%s/charge_session", t.deviceID),
+				payload:  sessionPayload,
+				retained: true,
+			})
+		}
+		// The summary sensors only change once a session has ended.
+		if s := data.ChargeSession; !s.Active {
+			summary, err := json.Marshal(map[string]float64{
+				"session_energy_kwh":   math.Round(s.AddedKWh()*100) / 100,
+				"session_duration_min": math.Round(s.DurationMin),
+				"session_avg_power_kw": math.Round(s.AvgPowerKW*10) / 10,
+				"soc_added":            math.Round(s.SOCGained*10) / 10,
+			})
+			if err != nil {
+				t.logger.WithError(err).Warn("Failed to build charge session summary payload")
+			} else {
+				batch = append(batch, mqttMessage{
+					topic:    fmt.Sprintf("byd_car/%s/charge_session/summary", t.deviceID),
+					payload:  summary,
+					retained: true,
+				})
+			}
+		}
 	}
 
-	// Publish location data if available
-	if data.Location != nil {
-		if err := t.publishLocationData(data); err != nil {
-			// Log error but don't block other publications
-			t.logger.WithError(err).Warn("Failed to publish location data")
+	// Aggregates: "state" is left out while a member sensor has no value,
+	// which shows the binary sensor as unknown.
+	for _, a := range aggregateSensors {
+		payload := map[string]interface{}{"members": []string{}}
+		if v := a.get(data); v != nil {
+			payload["state"] = "OFF"
+			if v.On {
+				payload["state"] = "ON"
+			}
+			payload["members"] = v.Members
 		}
+		batch = t.appendJSON(batch, fmt.Sprintf("byd_car/%s/%s", t.deviceID, a.key), payload)
+		batch[len(batch)-1].binary = true
 	}
 
-	// Publish availability
-	if err := t.publishAvailability(true); err != nil {
-		return fmt.Errorf("failed to publish availability: %w", err)
+	// Trip computer: the live trip reads zero between drives.
+	current := tripValues("current_", data.CurrentTrip)
+	t.convertUnits(current)
+	batch = t.appendJSON(batch, fmt.Sprintf("byd_car/%s/trip/current", t.deviceID), current)
+	if data.LastTrip != nil {
+		last := tripValues("", data.LastTrip)
+		t.convertUnits(last)
+		batch = t.appendJSON(batch, fmt.Sprintf("byd_car/%s/trip/last", t.deviceID), last)
 	}
 
-	// Publish last transmission timestamp
-	if err := t.publishLastTransmission(); err != nil {
-		return fmt.Errorf("failed to publish last transmission: %w", err)
+	// Current value of each runtime setting
+	for _, c := range t.controls {
+		batch = append(batch, mqttMessage{
+			topic:    t.controlTopic(c),
+			payload:  []byte(c.Get()),
+			retained: true,
+		})
 	}
 
-	t.logger.Debug("Data transmitted successfully")
-	return nil
+	// Availability
+	batch = append(batch, mqttMessage{
+		topic:    fmt.Sprintf("byd_car/%s/availability", t.deviceID),
+		payload:  []byte("online"),
+		retained: true,
+	})
+
+	return batch, nil
 }
 
-// publishSensorData publishes the main sensor data payload
-func (t *MQTTTransmitter) publishSensorData(data *sensors.SensorData) error {
-	payload, err := t.buildStatePayload(data)
-	if err != nil {
-		return fmt.Errorf("failed to build state payload: %w", err)
+// publishBatch delivers the queued messages, skipping unchanged topics, and
+// logs a single summary line for the cycle. The last transmission timestamp is
+// only published when every other message made it.
+func (t *MQTTTransmitter) publishBatch(ctx context.Context, batch []mqttMessage) error {
+	var (
+		errs                       []error
+		changed, failed, unchanged int
+		bytes                      int
+		now                        = time.Now()
+	)
+	t.policyMu.Lock()
+	policy := t.policy
+	t.policyMu.Unlock()
+
+	for _, msg := range batch {
+		if msg.discoveryKey == "" && !t.needsPublish(msg, policy, now) {
+			unchanged++
+			continue
+		}
+		if ctx.Err() != nil {
+			errs = append(errs, fmt.Errorf("MQTT cycle aborted: %w", ctx.Err()))
+			failed++
+			break
+		}
+		qos := byte(1)
+		if msg.state {
+			qos = t.stateQoS(msg, policy.qos)
+		}
+		if err := t.client.PublishQoS(ctx, msg.topic, msg.payload, qos, msg.retained); err != nil {
+			errs = append(errs, fmt.Errorf("failed to publish to %s: %w", msg.topic, err))
+			failed++
+			continue
+		}
+		changed++
+		bytes += len(msg.payload)
+		t.lastPublished[msg.topic] = publishedPayload{payload: msg.payload, at: now}
+		if msg.discoveryKey != "" {
+			t.publishedSensors[msg.discoveryKey] = true
+		}
+		if strings.HasPrefix(msg.topic, t.discoveryPrefix+"/") {
+			t.discoveryTopics[msg.topic] = len(msg.payload) > 0
+		}
 	}
 
-	topic := fmt.Sprintf("byd_car/%s/state", t.deviceID)
-	if err := t.client.Publish(topic, payload, true); err != nil {
-		return fmt.Errorf("failed to publish sensor data to %s: %w", topic, err)
+	if failed == 0 && changed > 0 {
+		if err := t.publishLastTransmission(ctx); err != nil {
+			errs = append(errs, err)
+			failed++
+		} else {
+			changed++
+		}
 	}
 
-	t.logger.WithFields(logrus.Fields{
-		"topic":   topic,
-		"payload": string(payload),
-	}).Debug("Published sensor data")
+	entry := t.logger.WithFields(logrus.Fields{
+		"changed":   changed,
+		"failed":    failed,
+		"unchanged": unchanged,
+		"bytes":     bytes,
+	})
+	summary := fmt.Sprintf("MQTT cycle: %d changed, %d failed, %d unchanged, %d bytes", changed, failed, unchanged, bytes)
+	if failed > 0 {
+		entry.Warn(summary)
+	} else {
+		entry.Debug(summary)
+	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
-// publishLocationData publishes location data to the device_tracker entity
-func (t *MQTTTransmitter) publishLocationData(data *sensors.SensorData) error {
-	if data.Location == nil {
-		return nil
+// needsPublish reports whether msg differs from what was last delivered on its
+// topic, whether the topic is due for a forced republish, or whether every
+// cycle is published (PublishAlways).
+func (t *MQTTTransmitter) needsPublish(msg mqttMessage, policy publishPolicy, now time.Time) bool {
+	last, ok := t.lastPublished[msg.topic]
+	if !ok || (policy.mode == PublishAlways && !msg.binary) {
+		return true
 	}
+	deadband := 0.0
+	var keyBands map[string]float64
+	if msg.deadband {
+		deadband = policy.deadband
+		if msg.exact && (deadband > 0 || len(policy.sensorDeadbands) > 0) {
+			keyBands = make(map[string]float64)
+			if deadband > 0 {
+				for key := range exactStateKeys(t.units == units.Imperial) {
+					keyBands[key] = 0
+				}
+			}
+			for key, d := range policy.sensorDeadbands {
+				keyBands[key] = d
+			}
+		}
+	}
+	if !samePayload(last.payload, msg.payload, deadband, keyBands) {
+		return true
+	}
+	return policy.republish > 0 && now.Sub(last.at) >= policy.republish
+}
 
-	topic := fmt.Sprintf("byd_car/%s/location", t.deviceID)
+// buildLocationPayload builds the JSON attributes for the device_tracker entity
+func (t *MQTTTransmitter) buildLocationPayload(data *sensors.SensorData) ([]byte, error) {
 	payload := map[string]interface{}{
 		"latitude":     data.Location.Latitude,
 		"longitude":    data.Location.Longitude,
@@ -354,14 +908,16 @@ func (t *MQTTTransmitter) publishLocationData(data *sensors.SensorData) error {
 
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal location data: %w", err)
+		return nil, fmt.Errorf("failed to marshal location data: %w", err)
 	}
-
-	return t.client.Publish(topic, jsonPayload, false)
+	return jsonPayload, nil
 }
 
-// publishDeviceTrackerDiscovery publishes the discovery config for the device tracker.
-func (t *MQTTTransmitter) publishDeviceTrackerDiscovery(baseTopic string, device HADevice) error {
+// queueDeviceTrackerDiscovery queues the discovery config for the device tracker.
+func (t *MQTTTransmitter) queueDeviceTrackerDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	if t.publishedSensors["device_tracker"] {
+		return nil
+	}
 	attributesTopic := fmt.Sprintf("%s/location", baseTopic)
 	config := map[string]interface{}{
 		"name":                  "Location",
@@ -373,7 +929,7 @@ func (t *MQTTTransmitter) publishDeviceTrackerDiscovery(baseTopic string, device
 	}
 	topic := fmt.Sprintf("%s/device_tracker/byd_car_%s/config", t.discoveryPrefix, t.deviceID)
 
-	return t.publishConfigRaw(topic, config)
+	return t.queueConfigRaw(batch, "device_tracker", topic, config)
 }
 
 // publishAvailability publishes the availability status
@@ -390,8 +946,8 @@ func (t *MQTTTransmitter) publishAvailability(online bool) error {
 	return nil
 }
 
-// publishLastTransmissionDiscovery publishes discovery config for the "Last Transmission" timestamp sensor
-func (t *MQTTTransmitter) publishLastTransmissionDiscovery(baseTopic string, device HADevice) error {
+// queueLastTransmissionDiscovery queues discovery config for the "Last Transmission" timestamp sensor
+func (t *MQTTTransmitter) queueLastTransmissionDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
 	uniqueID := fmt.Sprintf("%s_last_transmission", t.deviceID)
 
 	// Skip if already published
@@ -410,32 +966,21 @@ func (t *MQTTTransmitter) publishLastTransmissionDiscovery(baseTopic string, dev
 
 	topic := fmt.Sprintf("%s/sensor/byd_car_%s/last_transmission/config", t.discoveryPrefix, t.deviceID)
 
-	if err := t.publishConfigRaw(topic, config); err != nil {
-		return fmt.Errorf("failed to publish Last Transmission discovery config: %w", err)
-	}
-
-	t.logger.WithFields(logrus.Fields{
-		"sensor_name": "Last Transmission",
-		"entity_id":   "last_transmission",
-		"topic":       topic,
-	}).Debug("Published Last Transmission discovery config")
-
-	t.publishedSensors[uniqueID] = true
-	return nil
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
 }
 
 // publishLastTransmission publishes the current timestamp indicating the last successful transmission
-func (t *MQTTTransmitter) publishLastTransmission() error {
+func (t *MQTTTransmitter) publishLastTransmission(ctx context.Context) error {
 	topic := fmt.Sprintf("byd_car/%s/last_transmission", t.deviceID)
 	timestamp := time.Now().Format(time.RFC3339)
-	if err := t.client.Publish(topic, []byte(timestamp), true); err != nil {
+	if err := t.client.PublishContext(ctx, topic, []byte(timestamp), true); err != nil {
 		return fmt.Errorf("failed to publish last transmission timestamp to %s: %w", topic, err)
 	}
 	return nil
 }
 
-// publishDerivedChargingStatusDiscovery publishes discovery config for the virtual Charging Status sensor.
-func (t *MQTTTransmitter) publishDerivedChargingStatusDiscovery(baseTopic string, device HADevice) error {
+// queueDerivedChargingStatusDiscovery queues discovery config for the virtual Charging Status sensor.
+func (t *MQTTTransmitter) queueDerivedChargingStatusDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
 	uniqueID := fmt.Sprintf("%s_charging_status", t.deviceID)
 
 	if t.publishedSensors[uniqueID] {
@@ -454,18 +999,609 @@ func (t *MQTTTransmitter) publishDerivedChargingStatusDiscovery(baseTopic string
 
 	topic := fmt.Sprintf("%s/sensor/byd_car_%s/charging_status/config", t.discoveryPrefix, t.deviceID)
 
-	if err := t.publishConfigRaw(topic, config); err != nil {
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+// queueDerivedChargingDiscovery queues discovery config for the debounced
+// Charging binary_sensor fed by sensors.ChargingStateTracker.
+func (t *MQTTTransmitter) queueDerivedChargingDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_charging", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := HADiscoveryConfig{
+		Name:              "Charging",
+		UniqueID:          uniqueID,
+		StateTopic:        fmt.Sprintf("%s/binary_state", baseTopic),
+		ValueTemplate:     "{{ value_json.charging | default('OFF') }}",
+		DeviceClass:       "battery_charging",
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		Device:            device,
+	}
+
+	topic := fmt.Sprintf("%s/binary_sensor/byd_car_%s/charging/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+// aggregateSensor is one of the sensors.DeriveAggregates (or
+// DeriveTirePressure) binary sensors,
+// published as {"state":"ON","members":[…]} on byd_car/<id>/<key>.
+type aggregateSensor struct {
+	key, name, deviceClass, icon string
+	get                          func(*sensors.SensorData) *sensors.Aggregate
+}
+
+var aggregateSensors = []aggregateSensor{
+	{"doors_open", "Doors Open", "door", "", func(d *sensors.SensorData) *sensors.Aggregate { return d.DoorsOpen }},
+	{"windows_open", "Windows Open", "window", "", func(d *sensors.SensorData) *sensors.Aggregate { return d.WindowsOpen }},
+	// No "lock" device class: Home Assistant reads ON as unlocked there.
+	{"vehicle_locked", "Vehicle Locked", "", "mdi:car-key", func(d *sensors.SensorData) *sensors.Aggregate { return d.VehicleLocked }},
+	{"tire_pressure_warning", "Tire Pressure Warning", "problem", "mdi:car-tire-alert", func(d *sensors.SensorData) *sensors.Aggregate { return d.TirePressureWarning }},
+}
+
+// queueAggregateDiscovery queues discovery config for the aggregate binary
+// sensors; the offending members are exposed as attributes.
+func (t *MQTTTransmitter) queueAggregateDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	for _, a := range aggregateSensors {
+		uniqueID := fmt.Sprintf("%s_%s", t.deviceID, a.key)
+		if t.publishedSensors[uniqueID] {
+			continue
+		}
+		stateTopic := fmt.Sprintf("%s/%s", baseTopic, a.key)
+		config := HADiscoveryConfig{
+			Name:              a.name,
+			UniqueID:          uniqueID,
+			StateTopic:        stateTopic,
+			ValueTemplate:     "{{ value_json.state | default(None) }}",
+			DeviceClass:       a.deviceClass,
+			AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+			AttributesTopic:   stateTopic,
+			Device:            device,
+			Icon:              a.icon,
+		}
+		topic := fmt.Sprintf("%s/binary_sensor/byd_car_%s/%s/config", t.discoveryPrefix, t.deviceID, a.key)
+		if err := t.queueConfigRaw(batch, uniqueID, topic, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueOpenCountDiscovery queues discovery config for the Doors Open Count
+// and Windows Open Count sensors.
+func (t *MQTTTransmitter) queueOpenCountDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	for _, s := range []struct{ key, name, icon string }{
+		{"doors_open_count", "Doors Open Count", "mdi:car-door"},
+		{"windows_open_count", "Windows Open Count", "mdi:window-open-variant"},
+	} {
+		uniqueID := fmt.Sprintf("%s_%s", t.deviceID, s.key)
+		if t.publishedSensors[uniqueID] {
+			continue
+		}
+		config := HADiscoveryConfig{
+			Name:              s.name,
+			UniqueID:          uniqueID,
+			StateTopic:        fmt.Sprintf("%s/state", baseTopic),
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s | default(None) }}", s.key),
+			StateClass:        "measurement",
+			AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+			Device:            device,
+			Icon:              s.icon,
+		}
+		topic := fmt.Sprintf("%s/sensor/byd_car_%s/%s/config", t.discoveryPrefix, t.deviceID, s.key)
+		if err := t.queueConfigRaw(batch, uniqueID, topic, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueChargeSessionDiscovery queues discovery config for the Last Charge
+// Session sensor. Its state is the energy added; the full session is exposed
+// as attributes.
+func (t *MQTTTransmitter) queueChargeSessionDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_charge_session", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	sessionTopic := fmt.Sprintf("%s/charge_session", baseTopic)
+	config := HADiscoveryConfig{
+		Name:              "Last Charge Session",
+		UniqueID:          uniqueID,
+		StateTopic:        sessionTopic,
+		ValueTemplate:     "{{ value_json.energy_kwh | round(2) }}",
+		DeviceClass:       "energy",
+		UnitOfMeasurement: "kWh",
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		AttributesTopic:   sessionTopic,
+		Device:            device,
+		Icon:              "mdi:battery-charging",
+	}
+
+	topic := fmt.Sprintf("%s/sensor/byd_car_%s/charge_session/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+// summarySensor is one value of a JSON summary topic (charge session, trip)
+// exposed as its own sensor.
+type summarySensor struct {
+	key, name, deviceClass, unit, icon string
+}
+
+// chargeSessionSummarySensors are read from the charge session summary topic.
+var chargeSessionSummarySensors = []summarySensor{
+	{"session_energy_kwh", "Last Session Energy", "energy", "kWh", "mdi:battery-charging"},
+	{"session_duration_min", "Last Session Duration", "duration", "min", "mdi:timer-outline"},
+	{"session_avg_power_kw", "Last Session Average Power", "power", "kW", "mdi:flash"},
+	{"soc_added", "Last Session SOC Added", "", "%", "mdi:battery-plus"},
+}
+
+// lastTripSensors are read from the trip/last topic.
+var lastTripSensors = []summarySensor{
+	{"trip_distance_km", "Last Trip Distance", "distance", "km", "mdi:map-marker-distance"},
+	{"trip_consumption_kwh_per_100km", "Last Trip Consumption", "", "kWh/100km", "mdi:leaf"},
+	{"trip_duration_min", "Last Trip Duration", "duration", "min", "mdi:timer-outline"},
+	{"trip_avg_speed", "Last Trip Average Speed", "speed", "km/h", "mdi:speedometer"},
+}
+
+// currentTripSensors are read from the trip/current topic.
+var currentTripSensors = []summarySensor{
+	{"current_trip_distance_km", "Current Trip Distance", "distance", "km", "mdi:map-marker-distance"},
+	{"current_trip_consumption_kwh_per_100km", "Current Trip Consumption", "", "kWh/100km", "mdi:leaf"},
+	{"current_trip_duration_min", "Current Trip Duration", "duration", "min", "mdi:timer-outline"},
+	{"current_trip_avg_speed", "Current Trip Average Speed", "speed", "km/h", "mdi:speedometer"},
+}
+
+// queueSummaryDiscovery queues discovery configs for sensors read from the
+// JSON topic stateTopic.
+func (t *MQTTTransmitter) queueSummaryDiscovery(batch *[]mqttMessage, stateTopic string, list []summarySensor, baseTopic string, device HADevice) error {
+	for _, s := range list {
+		uniqueID := fmt.Sprintf("%s_%s", t.deviceID, s.key)
+		if t.publishedSensors[uniqueID] {
+			continue
+		}
+		config := HADiscoveryConfig{
+			Name:              s.name,
+			UniqueID:          uniqueID,
+			StateTopic:        stateTopic,
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s }}", s.key),
+			DeviceClass:       s.deviceClass,
+			UnitOfMeasurement: s.unit,
+			AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+			Device:            device,
+			Icon:              s.icon,
+		}
+		topic := fmt.Sprintf("%s/sensor/byd_car_%s/%s/config", t.discoveryPrefix, t.deviceID, s.key)
+		if err := t.queueConfigRaw(batch, uniqueID, topic, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueDrivingStateDiscovery queues discovery config for the Driving State
+// enum sensor.
+func (t *MQTTTransmitter) queueDrivingStateDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_driving_state", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := HADiscoveryConfig{
+		Name:              "Driving State",
+		UniqueID:          uniqueID,
+		StateTopic:        fmt.Sprintf("%s/state", baseTopic),
+		ValueTemplate:     "{{ value_json.driving_state }}",
+		DeviceClass:       "enum",
+		Options:           sensors.DrivingStates,
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		Device:            device,
+		Icon:              "mdi:car-info",
+	}
+
+	topic := fmt.Sprintf("%s/sensor/byd_car_%s/driving_state/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+// queueEfficiencyDiscovery queues discovery config for the rolling Wh/km
+// Efficiency sensor.
+func (t *MQTTTransmitter) queueEfficiencyDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_efficiency", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := HADiscoveryConfig{
+		Name:              "Efficiency",
+		UniqueID:          uniqueID,
+		StateTopic:        fmt.Sprintf("%s/state", baseTopic),
+		ValueTemplate:     "{{ value_json.efficiency | default(None) }}",
+		UnitOfMeasurement: "Wh/km",
+		StateClass:        "measurement",
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		Device:            device,
+		Icon:              "mdi:leaf",
+	}
+
+	topic := fmt.Sprintf("%s/sensor/byd_car_%s/efficiency/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+// queueRangeDiscovery queues discovery config for the Range Estimate and
+// Rolling Consumption sensors.
+func (t *MQTTTransmitter) queueRangeDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	for _, key := range []string{"range_estimate_km", "rolling_consumption"} {
+		uniqueID := fmt.Sprintf("%s_%s", t.deviceID, key)
+		if t.publishedSensors[uniqueID] {
+			continue
+		}
+		config := HADiscoveryConfig{
+			Name:              "Range Estimate",
+			UniqueID:          uniqueID,
+			StateTopic:        fmt.Sprintf("%s/state", baseTopic),
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s | default(None) }}", key),
+			UnitOfMeasurement: "km",
+			DeviceClass:       "distance",
+			StateClass:        "measurement",
+			AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+			Device:            device,
+			Icon:              "mdi:map-marker-distance",
+		}
+		if key == "rolling_consumption" {
+			config.Name = "Rolling Consumption"
+			config.UnitOfMeasurement = "kWh/100km"
+			config.DeviceClass = ""
+			config.Icon = "mdi:flash"
+		}
+		topic := fmt.Sprintf("%s/sensor/byd_car_%s/%s/config", t.discoveryPrefix, t.deviceID, key)
+		if err := t.queueConfigRaw(batch, uniqueID, topic, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueDistanceDiscovery queues discovery config for the Distance Today and
+// Distance This Week sensors.
+func (t *MQTTTransmitter) queueDistanceDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	for _, s := range []struct{ key, name string }{
+		{"distance_today", "Distance Today"},
+		{"distance_week", "Distance This Week"},
+	} {
+		uniqueID := fmt.Sprintf("%s_%s", t.deviceID, s.key)
+		if t.publishedSensors[uniqueID] {
+			continue
+		}
+		config := HADiscoveryConfig{
+			Name:                   s.name,
+			UniqueID:               uniqueID,
+			StateTopic:             fmt.Sprintf("%s/state", baseTopic),
+			ValueTemplate:          fmt.Sprintf("{{ value_json.%s | default(None) }}", s.key),
+			LastResetValueTemplate: fmt.Sprintf("{{ value_json.%s_reset | default(None) }}", s.key),
+			UnitOfMeasurement:      "km",
+			DeviceClass:            "distance",
+			StateClass:             "total",
+			AvailabilityTopic:      fmt.Sprintf("%s/availability", baseTopic),
+			Device:                 device,
+			Icon:                   "mdi:map-marker-distance",
+		}
+		topic := fmt.Sprintf("%s/sensor/byd_car_%s/%s/config", t.discoveryPrefix, t.deviceID, s.key)
+		if err := t.queueConfigRaw(batch, uniqueID, topic, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueEventAgeDiscovery queues discovery config for the "Since …" duration
+// sensors derived from the published timestamp sensors.
+func (t *MQTTTransmitter) queueEventAgeDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	for _, def := range publishedEventTimeSensors() {
+		key := sensors.EventAgeKey(sensors.ToSnakeCase(def.FieldName))
+		uniqueID := fmt.Sprintf("%s_%s", t.deviceID, key)
+		if t.publishedSensors[uniqueID] {
+			continue
+		}
+		config := HADiscoveryConfig{
+			Name:              sensors.EventAgeName(def),
+			UniqueID:          uniqueID,
+			StateTopic:        fmt.Sprintf("%s/state", baseTopic),
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s | default(None) }}", key),
+			UnitOfMeasurement: "s",
+			DeviceClass:       "duration",
+			StateClass:        "measurement",
+			AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+			Device:            device,
+			Icon:              "mdi:timer-sand",
+		}
+		topic := fmt.Sprintf("%s/sensor/byd_car_%s/%s/config", t.discoveryPrefix, t.deviceID, key)
+		if err := t.queueConfigRaw(batch, uniqueID, topic, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueBatteryThermalDiscovery queues discovery config for the Battery
+// Temperature Spread sensor and the Battery Thermal State enum sensor.
+func (t *MQTTTransmitter) queueBatteryThermalDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	configs := []struct {
+		key    string
+		config HADiscoveryConfig
+	}{
+		{"battery_temp_spread", HADiscoveryConfig{
+			Name:              "Battery Temperature Spread",
+			ValueTemplate:     "{{ value_json.battery_temp_spread | default(None) }}",
+			UnitOfMeasurement: "°C",
+			DeviceClass:       "temperature",
+			StateClass:        "measurement",
+			Icon:              "mdi:thermometer-lines",
+		}},
+		{"battery_thermal_state", HADiscoveryConfig{
+			Name:          "Battery Thermal State",
+			ValueTemplate: "{{ value_json.battery_thermal_state | default(None) }}",
+			DeviceClass:   "enum",
+			Options:       sensors.BatteryThermalStates,
+			Icon:          "mdi:thermometer-auto",
+		}},
+	}
+	for _, c := range configs {
+		key, config := c.key, c.config
+		config.UniqueID = fmt.Sprintf("%s_%s", t.deviceID, key)
+		if t.publishedSensors[config.UniqueID] {
+			continue
+		}
+		config.StateTopic = fmt.Sprintf("%s/state", baseTopic)
+		config.AvailabilityTopic = fmt.Sprintf("%s/availability", baseTopic)
+		config.Device = device
+		topic := fmt.Sprintf("%s/sensor/byd_car_%s/%s/config", t.discoveryPrefix, t.deviceID, key)
+		if err := t.queueConfigRaw(batch, config.UniqueID, topic, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueTirePressureDiscovery queues discovery config for the Tire Pressure
+// Imbalance sensor.
+func (t *MQTTTransmitter) queueTirePressureDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_tire_pressure_imbalance", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := HADiscoveryConfig{
+		Name:              "Tire Pressure Imbalance",
+		UniqueID:          uniqueID,
+		StateTopic:        fmt.Sprintf("%s/state", baseTopic),
+		ValueTemplate:     "{{ value_json.tire_pressure_imbalance | default(None) }}",
+		UnitOfMeasurement: "bar",
+		DeviceClass:       "pressure",
+		StateClass:        "measurement",
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		Device:            device,
+		Icon:              "mdi:car-tire-alert",
+	}
+
+	topic := fmt.Sprintf("%s/sensor/byd_car_%s/tire_pressure_imbalance/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+// queueCabinComfortDiscovery queues discovery config for the Cabin Comfort
+// sensor.
+func (t *MQTTTransmitter) queueCabinComfortDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_cabin_comfort", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := HADiscoveryConfig{
+		Name:              "Cabin Comfort",
+		UniqueID:          uniqueID,
+		StateTopic:        fmt.Sprintf("%s/state", baseTopic),
+		ValueTemplate:     "{{ value_json.cabin_comfort | default(None) }}",
+		StateClass:        "measurement",
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		Device:            device,
+		Icon:              "mdi:sofa-single",
+	}
+
+	topic := fmt.Sprintf("%s/sensor/byd_car_%s/cabin_comfort/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+// queueBattery12VDiscovery queues discovery config for the 12V Battery Low
+// binary sensor and the 12V Battery Trend sensor.
+func (t *MQTTTransmitter) queueBattery12VDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	lowID := fmt.Sprintf("%s_battery_12v_low", t.deviceID)
+	if !t.publishedSensors[lowID] {
+		config := HADiscoveryConfig{
+			Name:              "12V Battery Low",
+			UniqueID:          lowID,
+			StateTopic:        fmt.Sprintf("%s/binary_state", baseTopic),
+			ValueTemplate:     "{{ value_json.battery_12v_low | default(None) }}",
+			DeviceClass:       "battery",
+			AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+			Device:            device,
+		}
+		topic := fmt.Sprintf("%s/binary_sensor/byd_car_%s/battery_12v_low/config", t.discoveryPrefix, t.deviceID)
+		if err := t.queueConfigRaw(batch, lowID, topic, config); err != nil {
+			return err
+		}
+	}
+
+	trendID := fmt.Sprintf("%s_battery_12v_trend", t.deviceID)
+	if t.publishedSensors[trendID] {
+		return nil
+	}
+	config := HADiscoveryConfig{
+		Name:              "12V Battery Trend",
+		UniqueID:          trendID,
+		StateTopic:        fmt.Sprintf("%s/state", baseTopic),
+		ValueTemplate:     "{{ value_json.battery_12v_trend | default(None) }}",
+		UnitOfMeasurement: "V/d",
+		StateClass:        "measurement",
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		Device:            device,
+		Icon:              "mdi:car-battery",
+	}
+	topic := fmt.Sprintf("%s/sensor/byd_car_%s/battery_12v_trend/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, trendID, topic, config)
+}
+
+// queuePollModeDiscovery queues discovery config for the Polling Mode enum
+// sensor.
+func (t *MQTTTransmitter) queuePollModeDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_poll_mode", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := HADiscoveryConfig{
+		Name:              "Polling Mode",
+		UniqueID:          uniqueID,
+		StateTopic:        fmt.Sprintf("%s/state", baseTopic),
+		ValueTemplate:     "{{ value_json.poll_mode | default(None) }}",
+		DeviceClass:       "enum",
+		Options:           sensors.PollModes,
+		EntityCategory:    "diagnostic",
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		Device:            device,
+		Icon:              "mdi:sleep",
+	}
+
+	topic := fmt.Sprintf("%s/sensor/byd_car_%s/poll_mode/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+// Name implements Transmitter.
+func (t *MQTTTransmitter) Name() string { return "MQTT" }
+
+// Connect implements Connector.
+func (t *MQTTTransmitter) Connect(ctx context.Context) error {
+	return t.client.Connect(ctx)
+}
+
+// SetCleanup makes Close withdraw every discovery config delivered since
+// startup, so Home Assistant deletes the entities. It is safe to call while
+// Transmit runs.
+func (t *MQTTTransmitter) SetCleanup(enabled bool) {
+	t.cleanup.Store(enabled)
+}
+
+// SetUnits selects the unit system of the published values and discovery
+// configs: "metric", "imperial" or units.Auto to follow the car's display.
+// It is safe to call while Transmit runs; the next cycle republishes the
+// discovery configs if the system changes.
+func (t *MQTTTransmitter) SetUnits(setting string) {
+	t.unitSetting.Store(setting)
+}
+
+// resolveUnits picks the unit system for this cycle. A change clears the
+// announced discovery configs so they go out again with the new units.
+func (t *MQTTTransmitter) resolveUnits(data *sensors.SensorData) {
+	setting, _ := t.unitSetting.Load().(string)
+	sys := units.Resolve(setting, data.TemperatureUnit, t.units)
+	if sys == t.units {
+		return
+	}
+	if t.units != "" {
+		t.logger.WithFields(logrus.Fields{"from": t.units, "to": sys}).Info("Unit system changed; republishing discovery configs")
+	}
+	t.units = sys
+	t.publishedSensors = make(map[string]bool)
+}
+
+// Close marks the device offline and disconnects from the broker, first
+// withdrawing the discovery configs when cleanup is set.
+func (t *MQTTTransmitter) Close(ctx context.Context) error {
+	return t.guard.close(func() error {
+		var err error
+		if t.cleanup.Load() {
+			err = t.withdrawDiscovery(ctx)
+		}
+		if t.client.IsConnected() {
+			err = errors.Join(err, t.publishAvailability(false))
+		}
+		// Give paho up to a second (or what is left of ctx) to flush.
+		quiesce := uint(1000)
+		if deadline, ok := ctx.Deadline(); ok {
+			if left := time.Until(deadline); left < time.Second {
+				quiesce = uint(left.Milliseconds())
+			}
+		}
+		t.client.Disconnect(quiesce)
 		return err
+	})
+}
+
+// withdrawDiscovery publishes an empty retained payload to every discovery
+// topic delivered since startup, until ctx expires. With the broker
+// unreachable the configs stay in place.
+func (t *MQTTTransmitter) withdrawDiscovery(ctx context.Context) error {
+	var topics []string
+	for topic, live := range t.discoveryTopics {
+		if live {
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 {
+		return nil
+	}
+	if !t.client.IsConnected() {
+		return fmt.Errorf("MQTT broker unreachable; %d discovery configs not withdrawn", len(topics))
 	}
+	removed := 0
+	for _, topic := range topics {
+		if err := t.client.PublishContext(ctx, topic, []byte{}, true); err != nil {
+			return fmt.Errorf("withdrew %d of %d discovery configs: %w", removed, len(topics), err)
+		}
+		t.discoveryTopics[topic] = false
+		removed++
+	}
+	t.logger.WithField("entities", removed).Info("Withdrew Home Assistant discovery configs")
+	return nil
+}
 
-	t.logger.WithFields(logrus.Fields{
-		"sensor_name": "Charging Status",
-		"entity_id":   "charging_status",
-		"topic":       topic,
-	}).Debug("Published Charging Status discovery config")
+// Check implements Checker. The broker connection (and credentials) were
+// verified when the client was created; this confirms it is still up.
+func (t *MQTTTransmitter) Check(context.Context) error {
+	if !t.client.IsConnected() {
+		if err := t.client.TLSError(); err != nil {
+			return fmt.Errorf("not connected to the MQTT broker: %w", err)
+		}
+		return fmt.Errorf("not connected to the MQTT broker")
+	}
+	return nil
+}
 
-	// Mark as published
-	t.publishedSensors[uniqueID] = true
+// PublishTest publishes a non-retained timestamp to byd_car/<id>/test,
+// confirming the broker accepts publishes, not just the connection.
+func (t *MQTTTransmitter) PublishTest(ctx context.Context) error {
+	if err := t.Check(ctx); err != nil {
+		return err
+	}
+	topic := fmt.Sprintf("byd_car/%s/test", t.deviceID)
+	if err := t.client.PublishContext(ctx, topic, []byte(time.Now().UTC().Format(time.RFC3339)), false); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
 	return nil
 }
 
@@ -473,3 +1609,95 @@ func (t *MQTTTransmitter) publishDerivedChargingStatusDiscovery(baseTopic string
 func (t *MQTTTransmitter) IsConnected() bool {
 	return t.client.IsConnected()
 }
+
+// appendJSON appends a retained message with payload encoded as JSON.
+func (t *MQTTTransmitter) appendJSON(batch []mqttMessage, topic string, payload interface{}) []mqttMessage {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.logger.WithError(err).WithField("topic", topic).Warn("Failed to build payload")
+		return batch
+	}
+	return append(batch, mqttMessage{topic: topic, payload: data, retained: true})
+}
+
+// unitKey is the metric unit a payload key is computed in. Deltas (a
+// spread or an imbalance) convert without the offset.
+type unitKey struct {
+	unit  string
+	delta bool
+}
+
+// unitKeys covers every numeric key of the state and trip payloads that has a
+// unit; convertUnits leaves other keys alone.
+var unitKeys = func() map[string]unitKey {
+	keys := map[string]unitKey{
+		"efficiency":              {unit: "Wh/km"},
+		"rolling_consumption":     {unit: "kWh/100km"},
+		"range_estimate_km":       {unit: "km"},
+		"distance_today":          {unit: "km"},
+		"distance_week":           {unit: "km"},
+		"battery_temp_spread":     {unit: "°C", delta: true},
+		"tire_pressure_imbalance": {unit: "bar", delta: true},
+		"trip_max_speed":          {unit: "km/h"},
+		"current_trip_max_speed":  {unit: "km/h"},
+	}
+	for _, def := range sensors.AllSensors {
+		if def.UnitOfMeasurement != "" {
+			keys[sensors.ToSnakeCase(def.FieldName)] = unitKey{unit: def.UnitOfMeasurement}
+			keys[sensors.ToSnakeCase(def.FieldName)+"_smoothed"] = unitKey{unit: def.UnitOfMeasurement}
+		}
+	}
+	for _, list := range [][]summarySensor{lastTripSensors, currentTripSensors} {
+		for _, s := range list {
+			keys[s.key] = unitKey{unit: s.unit}
+		}
+	}
+	return keys
+}()
+
+// convertUnits converts the numeric values of payload, computed in metric,
+// to the current unit system. Sensors with a precision are rounded afterwards
+// by roundValues, the rest to two decimals. Key names stay as they are (range_estimate_km
+// holds miles under imperial) so existing entities keep working.
+func (t *MQTTTransmitter) convertUnits(payload map[string]interface{}) {
+	if t.units != units.Imperial {
+		return
+	}
+	precisions := precisionKeys()
+	for key, v := range payload {
+		f, ok := v.(float64)
+		k, known := unitKeys[key]
+		if !ok || !known {
+			continue
+		}
+		if k.delta {
+			f = t.units.ConvertDelta(f, k.unit)
+		} else {
+			f = t.units.Convert(f, k.unit)
+		}
+		if _, ok := precisions[key]; !ok {
+			f = units.Round(f, 2)
+		}
+		payload[key] = f
+	}
+}
+
+// tripValues flattens a trip for the trip sensors; prefix is "current_" for
+// the live trip. A nil trip yields zeros.
+func tripValues(prefix string, s *sensors.DriveSession) map[string]interface{} {
+	if s == nil {
+		s = &sensors.DriveSession{}
+	}
+	var consumption interface{}
+	if s.KWhPer100KM != nil {
+		consumption = math.Round(*s.KWhPer100KM*10) / 10
+	}
+	return map[string]interface{}{
+		prefix + "trip_distance_km":               math.Round(s.DistanceKM*10) / 10,
+		prefix + "trip_consumption_kwh_per_100km": consumption,
+		prefix + "trip_duration_min":              math.Round(s.DurationMin),
+		prefix + "trip_avg_speed":                 math.Round(s.AvgSpeedKMH),
+		prefix + "trip_max_speed":                 math.Round(s.MaxSpeedKMH),
+		prefix + "trip_energy_kwh":                math.Round(s.EnergyKWh*100) / 100,
+	}
+}
@@ -0,0 +1,151 @@
+package transmission
+
+import (
+	"fmt"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Control is a runtime setting exposed to Home Assistant as a number entity,
+// or as a select entity when Options is set. Set validates and applies a
+// value received on the command topic; Get returns the current value.
+type Control struct {
+	Key     string // entity ID and topic suffix, e.g. "poll_interval_seconds"
+	Name    string
+	Icon    string
+	Unit    string
+	Min     float64 // number only
+	Max     float64 // number only
+	Step    float64 // number only
+	Options []string
+
+	Get func() string
+	Set func(value string) error
+}
+
+// Poller runs an out-of-cycle Diplus poll. PollNow must not block; requests
+// arriving while one is pending are coalesced.
+type Poller interface {
+	PollNow()
+}
+
+func (c Control) entityType() string {
+	if len(c.Options) > 0 {
+		return "select"
+	}
+	return "number"
+}
+
+// SetControls announces the controls via discovery and subscribes to their
+// command topics (byd_car/<id>/<key>/set). Each accepted value is echoed on
+// byd_car/<id>/<key>; a rejected one republishes the current value so the
+// Home Assistant entity snaps back.
+func (t *MQTTTransmitter) SetControls(controls []Control) error {
+	t.controls = controls
+	for _, c := range controls {
+		c := c
+		handler := func(_ paho.Client, msg paho.Message) {
+			// Publishing from inside the paho callback can deadlock.
+			go t.handleControl(c, string(msg.Payload()))
+		}
+		if err := t.client.Subscribe(t.controlTopic(c)+"/set", handler); err != nil {
+			return fmt.Errorf("failed to subscribe to %s command topic: %w", c.Key, err)
+		}
+	}
+	return nil
+}
+
+// SetPoller subscribes to byd_car/<id>/cmd/poll: any message on it calls
+// p.PollNow. The command is also announced as a "Refresh Now" button entity.
+func (t *MQTTTransmitter) SetPoller(p Poller) error {
+	handler := func(_ paho.Client, _ paho.Message) {
+		t.logger.Debug("Poll requested over MQTT")
+		p.PollNow()
+	}
+	if err := t.client.Subscribe(t.pollCommandTopic(), handler); err != nil {
+		return fmt.Errorf("failed to subscribe to poll command topic: %w", err)
+	}
+	t.pollCommand = true
+	return nil
+}
+
+func (t *MQTTTransmitter) pollCommandTopic() string {
+	return fmt.Sprintf("byd_car/%s/cmd/poll", t.deviceID)
+}
+
+// haButtonConfig is the discovery config of a button entity, which has no
+// state topic.
+type haButtonConfig struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	CommandTopic      string   `json:"command_topic"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	Icon              string   `json:"icon,omitempty"`
+	Device            HADevice `json:"device"`
+}
+
+// queuePollButtonDiscovery queues the button that triggers an immediate poll.
+func (t *MQTTTransmitter) queuePollButtonDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_poll_now", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := haButtonConfig{
+		Name:              "Refresh Now",
+		UniqueID:          uniqueID,
+		CommandTopic:      t.pollCommandTopic(),
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		Icon:              "mdi:refresh",
+		Device:            device,
+	}
+
+	topic := fmt.Sprintf("%s/button/byd_car_%s/poll_now/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+func (t *MQTTTransmitter) handleControl(c Control, value string) {
+	if err := c.Set(value); err != nil {
+		t.logger.WithError(err).WithField("control", c.Key).Warn("Rejected setting from Home Assistant")
+	}
+	if err := t.client.Publish(t.controlTopic(c), []byte(c.Get()), true); err != nil {
+		t.logger.WithError(err).WithField("control", c.Key).Warn("Failed to publish setting state")
+	}
+}
+
+func (t *MQTTTransmitter) controlTopic(c Control) string {
+	return fmt.Sprintf("byd_car/%s/%s", t.deviceID, c.Key)
+}
+
+// queueControlDiscovery queues the number/select discovery config for c.
+func (t *MQTTTransmitter) queueControlDiscovery(batch *[]mqttMessage, c Control, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_%s", t.deviceID, c.Key)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := HADiscoveryConfig{
+		Name:              c.Name,
+		UniqueID:          uniqueID,
+		StateTopic:        t.controlTopic(c),
+		CommandTopic:      t.controlTopic(c) + "/set",
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		UnitOfMeasurement: c.Unit,
+		Icon:              c.Icon,
+		EntityCategory:    "config",
+		Options:           c.Options,
+		Device:            device,
+	}
+	if c.entityType() == "number" {
+		min, max, step := c.Min, c.Max, c.Step
+		config.Min, config.Max, config.Step = &min, &max, &step
+		config.Mode = "box"
+	}
+
+	topic := fmt.Sprintf("%s/%s/byd_car_%s/%s/config", t.discoveryPrefix, c.entityType(), t.deviceID, c.Key)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
@@ -0,0 +1,204 @@
+package transmission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Allthebester/byd-hass/internal/diag"
+)
+
+// EnableDiagnostics announces the diagnostic "BYD-HASS Health" sensor with
+// the next discovery cycle. Its state is published by PublishDiagnostics.
+func (t *MQTTTransmitter) EnableDiagnostics() {
+	t.diagnostics = true
+}
+
+func (t *MQTTTransmitter) diagnosticsTopic() string {
+	return fmt.Sprintf("byd_car/%s/diagnostics", t.deviceID)
+}
+
+// PublishDiagnostics publishes snap as the retained state of the health
+// sensor; the whole snapshot doubles as its attributes.
+func (t *MQTTTransmitter) PublishDiagnostics(ctx context.Context, snap diag.Snapshot) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
+	payload, err := snap.JSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal diagnostics: %w", err)
+	}
+	if err := t.client.PublishContext(ctx, t.diagnosticsTopic(), payload, true); err != nil {
+		return fmt.Errorf("failed to publish diagnostics to %s: %w", t.diagnosticsTopic(), err)
+	}
+	return nil
+}
+
+// queueDiagnosticsDiscovery queues discovery config for the health sensor.
+func (t *MQTTTransmitter) queueDiagnosticsDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_diagnostics", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := HADiscoveryConfig{
+		Name:              "BYD-HASS Health",
+		UniqueID:          uniqueID,
+		StateTopic:        t.diagnosticsTopic(),
+		ValueTemplate:     "{{ value_json.status }}",
+		AttributesTopic:   t.diagnosticsTopic(),
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		DeviceClass:       "enum",
+		Options:           []string{diag.StatusOK, diag.StatusDegraded},
+		EntityCategory:    "diagnostic",
+		Icon:              "mdi:heart-pulse",
+		Device:            device,
+	}
+
+	topic := fmt.Sprintf("%s/sensor/byd_car_%s/diagnostics/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+func (t *MQTTTransmitter) diplusConnectedTopic() string {
+	return fmt.Sprintf("byd_car/%s/diplus_connected", t.deviceID)
+}
+
+// PublishDiplusConnected publishes the retained state of the Diplus
+// Connected binary sensor.
+func (t *MQTTTransmitter) PublishDiplusConnected(ctx context.Context, connected bool) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
+	payload := "OFF"
+	if connected {
+		payload = "ON"
+	}
+	if err := t.client.PublishContext(ctx, t.diplusConnectedTopic(), []byte(payload), true); err != nil {
+		return fmt.Errorf("failed to publish Diplus state to %s: %w", t.diplusConnectedTopic(), err)
+	}
+	return nil
+}
+
+// queueDiplusConnectedDiscovery queues discovery config for the Diplus
+// Connected binary sensor.
+func (t *MQTTTransmitter) queueDiplusConnectedDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_diplus_connected", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := HADiscoveryConfig{
+		Name:              "Diplus Connected",
+		UniqueID:          uniqueID,
+		StateTopic:        t.diplusConnectedTopic(),
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		DeviceClass:       "connectivity",
+		EntityCategory:    "diagnostic",
+		Device:            device,
+	}
+
+	topic := fmt.Sprintf("%s/binary_sensor/byd_car_%s/diplus_connected/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+// EventKeepaliveCap is published when the collector polled too long with the
+// car off and dropped to the slowest poll interval.
+const EventKeepaliveCap = "keepalive_cap"
+
+// eventTypes lists the events PublishEvent may send.
+var eventTypes = []string{EventKeepaliveCap}
+
+func (t *MQTTTransmitter) eventTopic() string {
+	return fmt.Sprintf("byd_car/%s/event", t.deviceID)
+}
+
+// PublishEvent publishes a one-off (non-retained) warning event; attrs are
+// sent along with the event type.
+func (t *MQTTTransmitter) PublishEvent(ctx context.Context, eventType string, attrs map[string]interface{}) error {
+	return t.publishEvent(ctx, t.eventTopic(), eventType, attrs)
+}
+
+// publishEvent publishes a non-retained Home Assistant event on topic.
+func (t *MQTTTransmitter) publishEvent(ctx context.Context, topic, eventType string, attrs map[string]interface{}) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
+	payload := map[string]interface{}{"event_type": eventType}
+	for k, v := range attrs {
+		payload[k] = v
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if err := t.client.PublishContext(ctx, topic, data, false); err != nil {
+		return fmt.Errorf("failed to publish event to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// queueEventDiscovery queues discovery config for the Warning event entity.
+func (t *MQTTTransmitter) queueEventDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_event", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := HADiscoveryConfig{
+		Name:              "Warning",
+		UniqueID:          uniqueID,
+		StateTopic:        t.eventTopic(),
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		EventTypes:        eventTypes,
+		EntityCategory:    "diagnostic",
+		Icon:              "mdi:car-battery",
+		Device:            device,
+	}
+
+	topic := fmt.Sprintf("%s/event/byd_car_%s/event/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+// queueWatchdogDiscovery queues discovery config for the Head Unit Keepalive
+// and Diplus Requests Today diagnostic sensors.
+func (t *MQTTTransmitter) queueWatchdogDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	configs := []HADiscoveryConfig{
+		{
+			Name:              "Head Unit Keepalive",
+			UniqueID:          fmt.Sprintf("%s_head_unit_keepalive_minutes", t.deviceID),
+			ValueTemplate:     "{{ value_json.head_unit_keepalive_minutes | default(None) }}",
+			DeviceClass:       "duration",
+			UnitOfMeasurement: "min",
+			StateClass:        "measurement",
+			Icon:              "mdi:car-battery",
+		},
+		{
+			Name:          "Diplus Requests Today",
+			UniqueID:      fmt.Sprintf("%s_diplus_requests_today", t.deviceID),
+			ValueTemplate: "{{ value_json.diplus_requests_today | default(None) }}",
+			StateClass:    "total_increasing",
+			Icon:          "mdi:counter",
+		},
+	}
+	for _, config := range configs {
+		if t.publishedSensors[config.UniqueID] {
+			continue
+		}
+		config.StateTopic = fmt.Sprintf("%s/state", baseTopic)
+		config.AvailabilityTopic = fmt.Sprintf("%s/availability", baseTopic)
+		config.EntityCategory = "diagnostic"
+		config.Device = device
+		key := config.UniqueID[len(t.deviceID)+1:]
+		topic := fmt.Sprintf("%s/sensor/byd_car_%s/%s/config", t.discoveryPrefix, t.deviceID, key)
+		if err := t.queueConfigRaw(batch, config.UniqueID, topic, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
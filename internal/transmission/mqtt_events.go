@@ -0,0 +1,46 @@
+package transmission
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+func (t *MQTTTransmitter) carEventTopic() string {
+	return fmt.Sprintf("byd_car/%s/events", t.deviceID)
+}
+
+// PublishCarEvent publishes ev as a one-off (non-retained) event of the Car
+// Event entity, with its time and attributes.
+func (t *MQTTTransmitter) PublishCarEvent(ctx context.Context, ev sensors.CarEvent) error {
+	attrs := map[string]interface{}{"timestamp": ev.Time.Format(time.RFC3339)}
+	for k, v := range ev.Attrs {
+		attrs[k] = v
+	}
+	return t.publishEvent(ctx, t.carEventTopic(), ev.Type, attrs)
+}
+
+// queueCarEventDiscovery queues discovery config for the Car Event entity.
+func (t *MQTTTransmitter) queueCarEventDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_car_event", t.deviceID)
+
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+
+	config := HADiscoveryConfig{
+		Name:              "Car Event",
+		UniqueID:          uniqueID,
+		StateTopic:        t.carEventTopic(),
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		EventTypes:        sensors.CarEventTypes,
+		Icon:              "mdi:car-info",
+		Device:            device,
+	}
+
+	topic := fmt.Sprintf("%s/event/byd_car_%s/car_event/config", t.discoveryPrefix, t.deviceID)
+
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
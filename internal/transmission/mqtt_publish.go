@@ -0,0 +1,266 @@
+package transmission
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// MQTT publish modes.
+const (
+	// PublishOnChange publishes a topic only when its payload changed since
+	// the last publish (or is due for a refresh).
+	PublishOnChange = "onchange"
+	// PublishAlways publishes every topic on every cycle, except those of
+	// the binary and other on/off sensors (see onOffStateKeys), which stay
+	// change-only.
+	PublishAlways = "always"
+)
+
+// publishPolicy is the MQTT transmitter's publish configuration.
+type publishPolicy struct {
+	mode      string        // PublishOnChange or PublishAlways
+	deadband  float64       // change a float needs to count as changed
+	republish time.Duration // resend unchanged topics this often (0 = never)
+	qos       sensors.QoS   // QoS of the sensor states (see SetQoS)
+
+	sensorDeadbands map[string]float64 // by state key (see SetSensorDeadbands)
+}
+
+// SetPublishMode selects when topics are published. deadband is the amount
+// a float has to move before a numeric payload counts as changed; integers
+// always compare exactly. Zero compares every value exactly.
+func (t *MQTTTransmitter) SetPublishMode(mode string, deadband float64) error {
+	switch mode {
+	case "":
+		mode = PublishOnChange
+	case PublishOnChange, PublishAlways:
+	default:
+		return fmt.Errorf("unknown MQTT publish mode %q (use %s or %s)", mode, PublishOnChange, PublishAlways)
+	}
+	t.policyMu.Lock()
+	defer t.policyMu.Unlock()
+	t.policy.mode = mode
+	t.policy.deadband = math.Max(deadband, 0)
+	return nil
+}
+
+// SetSensorDeadbands overrides the deadband of single sensors, by sensor
+// ID, for their raw and smoothed values. Unlike the global deadband it also
+// applies to whole-number sensors, and it applies in PublishOnChange mode
+// even when the global deadband is zero. nil clears the overrides.
+func (t *MQTTTransmitter) SetSensorDeadbands(bands map[int]float64) error {
+	keys := make(map[string]float64, 2*len(bands))
+	for id, d := range bands {
+		def := sensors.GetSensorByID(id)
+		if def == nil {
+			return fmt.Errorf("unknown sensor ID %d", id)
+		}
+		key := sensors.ToSnakeCase(def.FieldName)
+		keys[key] = math.Max(d, 0)
+		keys[key+"_smoothed"] = math.Max(d, 0)
+	}
+	t.policyMu.Lock()
+	defer t.policyMu.Unlock()
+	t.policy.sensorDeadbands = keys
+	return nil
+}
+
+// SetQoS sets the MQTT QoS of the sensor states from a BYD_HASS_MQTT_QOS
+// value such as "default:0,52:1" (see sensors.ParseQoS). The native state
+// topic carries every sensor, so it is sent with the highest QoS of the
+// sensors that changed since the last publish; TeslaMate topics use the
+// default. Discovery configs and availability are always sent with QoS 1.
+func (t *MQTTTransmitter) SetQoS(raw string) error {
+	q, err := sensors.ParseQoS(raw)
+	if err != nil {
+		return err
+	}
+	t.policyMu.Lock()
+	defer t.policyMu.Unlock()
+	t.policy.qos = q
+	return nil
+}
+
+// stateKeyIDs maps the keys of the state payload to their sensor IDs.
+var stateKeyIDs = sync.OnceValue(func() map[string]int {
+	ids := make(map[string]int, 2*len(sensors.AllSensors))
+	for _, def := range sensors.AllSensors {
+		key := sensors.ToSnakeCase(def.FieldName)
+		ids[key] = def.ID
+		ids[key+"_smoothed"] = def.ID
+	}
+	return ids
+})
+
+// onOffSensorIDs are the sensors with two states besides the binary_sensor
+// ones: doors, hood, trunk, locks and seat belts.
+var onOffSensorIDs = []int{21, 22, 59, 73, 74, 75, 76, 81, 82, 83, 84, 85, 86, 93, 94, 95, 96, 97, 98}
+
+// onOffStateKeys are the keys of the state payload holding on/off values:
+// onOffSensorIDs, the binary_sensor sensors, Charging and 12V Battery Low.
+// They are also published on the change-only binary_state topic, which their
+// entities read, so PublishAlways does not repeat them every cycle.
+var onOffStateKeys = sync.OnceValue(func() map[string]bool {
+	keys := map[string]bool{"charging": true, "battery_12v_low": true}
+	for _, def := range sensors.AllSensors {
+		if def.Category == "binary_sensor" || slices.Contains(onOffSensorIDs, def.ID) {
+			keys[sensors.ToSnakeCase(def.FieldName)] = true
+		}
+	}
+	return keys
+})
+
+// stateQoS returns the QoS msg, a sensor state, is published with: the
+// highest QoS of the sensors whose value differs from the last published
+// payload, the default for any other key. Payloads that are not JSON
+// objects, and republished unchanged ones, get the default.
+func (t *MQTTTransmitter) stateQoS(msg mqttMessage, q sensors.QoS) byte {
+	if len(q.PerSensor) == 0 {
+		return q.Default
+	}
+	var next, prev map[string]json.RawMessage
+	if json.Unmarshal(msg.payload, &next) != nil {
+		return q.Default
+	}
+	if last, ok := t.lastPublished[msg.topic]; ok {
+		_ = json.Unmarshal(last.payload, &prev) // nil = every key changed
+	}
+	var changed []string
+	for key, v := range next {
+		if w, ok := prev[key]; !ok || !bytes.Equal(v, w) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range prev {
+		if _, ok := next[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	if len(changed) == 0 {
+		return q.Default
+	}
+	var qos byte
+	for _, key := range changed {
+		if id, ok := stateKeyIDs()[key]; ok {
+			qos = max(qos, q.For(id))
+		} else {
+			qos = max(qos, q.Default)
+		}
+	}
+	return qos
+}
+
+// exactStateKeys returns the keys of the state payload holding whole
+// numbers (see sensors.IntegerSensors), which are compared exactly rather
+// than within the deadband. Under imperial units a converted value is only
+// whole if it is rounded to no decimals.
+func exactStateKeys(imperial bool) map[string]bool {
+	keys := make(map[string]bool)
+	for id := range sensors.IntegerSensors() {
+		def := sensors.GetSensorByID(id)
+		if def == nil {
+			continue
+		}
+		key := sensors.ToSnakeCase(def.FieldName)
+		p, rounded := sensors.PrecisionFor(id)
+		if _, converted := unitKeys[key]; imperial && converted && !rounded {
+			continue
+		}
+		keys[key] = true
+		if rounded && p == 0 {
+			keys[key+"_smoothed"] = true // smoothed values are rounded too
+		}
+	}
+	return keys
+}
+
+// samePayload reports whether b carries the same values as a: equal bytes,
+// or JSON whose numbers all lie within deadband of each other. The numbers
+// under a top-level key in keyBands use that key's deadband instead; 0 means
+// they must be equal.
+func samePayload(a, b []byte, deadband float64, keyBands map[string]float64) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	if deadband <= 0 && len(keyBands) == 0 {
+		return false
+	}
+	va, err := decodeNumbers(a)
+	if err != nil {
+		return false
+	}
+	vb, err := decodeNumbers(b)
+	if err != nil {
+		return false
+	}
+	if ma, ok := va.(map[string]interface{}); ok {
+		mb, ok := vb.(map[string]interface{})
+		if !ok || len(ma) != len(mb) {
+			return false
+		}
+		for k, v := range ma {
+			d, ok := keyBands[k]
+			if !ok {
+				d = deadband
+			}
+			w, ok := mb[k]
+			if !ok || !sameValue(v, w, d) {
+				return false
+			}
+		}
+		return true
+	}
+	return sameValue(va, vb, deadband)
+}
+
+// decodeNumbers decodes a JSON payload keeping numbers as json.Number, so
+// they are compared at the precision they were published with.
+func decodeNumbers(payload []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func sameValue(a, b interface{}, deadband float64) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, errA := a.Float64()
+		fb, errB := b.Float64()
+		if errA != nil || errB != nil {
+			return false
+		}
+		if deadband <= 0 {
+			return fa == fb
+		}
+		return math.Abs(fa-fb) < deadband
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !sameValue(v, w, deadband) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,151 @@
+package transmission
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/mqtt"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+func TestSamePayload(t *testing.T) {
+	keyBands := map[string]float64{"speed": 0, "soc": 2}
+	tests := []struct {
+		name     string
+		a, b     string
+		deadband float64
+		want     bool
+	}{
+		{"equal bytes", `{"speed":50}`, `{"speed":50}`, 0, true},
+		{"no deadband", `{"temp":21.5}`, `{"temp":21.6}`, 0, false},
+		{"float within deadband", `{"temp":21.5}`, `{"temp":21.6}`, 0.5, true},
+		{"float outside deadband", `{"temp":21.5}`, `{"temp":22.1}`, 0.5, false},
+		// A float sensor at a whole value is marshalled without decimals;
+		// it still gets the deadband.
+		{"float at whole value", `{"temp":21}`, `{"temp":21.2}`, 0.5, true},
+		{"float between whole values", `{"temp":21}`, `{"temp":22}`, 1.5, true},
+		{"whole-number sensor changed", `{"speed":50}`, `{"speed":51}`, 5, false},
+		{"whole-number sensor same value", `{"speed":50}`, `{"speed":50.0}`, 5, true},
+		{"key added", `{"temp":21}`, `{"temp":21,"speed":50}`, 0.5, false},
+		{"key replaced", `{"temp":21}`, `{"speed":21}`, 0.5, false},
+		{"string changed", `{"gear":"P"}`, `{"gear":"D"}`, 0.5, false},
+		{"null vs number", `{"temp":null}`, `{"temp":0}`, 0.5, false},
+		{"nested within deadband", `{"trip":{"km":1.01}}`, `{"trip":{"km":1.02}}`, 0.5, true},
+		{"per-sensor deadband", `{"soc":80}`, `{"soc":81}`, 0, true},
+		{"per-sensor deadband exceeded", `{"soc":80}`, `{"soc":82}`, 0.5, false},
+		{"per-sensor deadband only", `{"soc":80,"temp":21}`, `{"soc":81,"temp":21.1}`, 0, false},
+		{"bare number", `21.5`, `21.6`, 0.5, true},
+		{"not JSON", `on`, `off`, 0.5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := samePayload([]byte(tt.a), []byte(tt.b), tt.deadband, keyBands); got != tt.want {
+				t.Errorf("samePayload(%s, %s, %g) = %v, want %v", tt.a, tt.b, tt.deadband, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExactStateKeys(t *testing.T) {
+	tests := []struct {
+		key      string
+		imperial bool
+		want     bool
+	}{
+		{"battery_percentage", false, true},          // rounded to no decimals
+		{"battery_percentage_smoothed", false, true}, // rounded too
+		{"speed", false, true},                       // raw integer, published as read
+		{"speed_smoothed", false, false},             // smoothing adds decimals
+		{"speed", true, false},                       // converted to mph
+		{"battery_percentage", true, true},           // rounded after conversion
+		{"mileage", false, false},                    // scaled by 0.1
+		{"max_battery_temp", false, false},           // one decimal
+		{"range_estimate_km", false, false},          // derived, no declaration
+	}
+	for _, tt := range tests {
+		keys := exactStateKeys(tt.imperial)
+		if got := keys[tt.key]; got != tt.want {
+			t.Errorf("exactStateKeys(imperial=%v)[%q] = %v, want %v", tt.imperial, tt.key, got, tt.want)
+		}
+	}
+}
+
+// pendingTopics returns the topics of the next Transmit of data that would
+// be published, discovery configs left out.
+func pendingTopics(t *testing.T, tx *MQTTTransmitter, data *sensors.SensorData) map[string]bool {
+	t.Helper()
+	batch, err := tx.buildBatch(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.policyMu.Lock()
+	policy := tx.policy
+	tx.policyMu.Unlock()
+	topics := make(map[string]bool)
+	for _, msg := range batch {
+		if msg.discoveryKey == "" && tx.needsPublish(msg, policy, time.Now()) {
+			topics[msg.topic] = true
+		}
+	}
+	return topics
+}
+
+func TestPublishModes(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	parked := &sensors.SensorData{Speed: f(0), DriverDoor: f(0), DriverDoorLock: f(2), BatteryPercentage: f(80)}
+	doorOpen := &sensors.SensorData{Speed: f(0), DriverDoor: f(1), DriverDoorLock: f(2), BatteryPercentage: f(80)}
+	const state, onOff = "byd_car/test/state", "byd_car/test/binary_state"
+	tests := []struct {
+		name      string
+		mode      string
+		next      *sensors.SensorData
+		published []string
+		skipped   []string
+		silent    bool // no topic at all
+	}{
+		{"onchange, nothing changed", PublishOnChange, parked, nil, nil, true},
+		{"onchange, door opened", PublishOnChange, doorOpen, []string{state, onOff}, nil, false},
+		{"always, nothing changed", PublishAlways, parked, []string{state}, []string{onOff}, false},
+		{"always, door opened", PublishAlways, doorOpen, []string{state, onOff}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := NewMQTTTransmitter(mqtt.NewDryRunClient("test", quietLogger()), "test", "homeassistant", quietLogger())
+			if err := tx.SetPublishMode(tt.mode, 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Transmit(context.Background(), parked); err != nil {
+				t.Fatal(err)
+			}
+			topics := pendingTopics(t, tx, tt.next)
+			if tt.silent && len(topics) > 0 {
+				t.Errorf("unchanged poll would publish %v, want nothing", topics)
+			}
+			for _, topic := range tt.published {
+				if !topics[topic] {
+					t.Errorf("%s not published", topic)
+				}
+			}
+			for _, topic := range tt.skipped {
+				if topics[topic] {
+					t.Errorf("%s published, want it skipped", topic)
+				}
+			}
+		})
+	}
+}
+
+func TestOnOffStateKeys(t *testing.T) {
+	keys := onOffStateKeys()
+	for _, key := range []string{"driver_door", "driver_door_lock", "driver_seat_belt_status", "charge_gun_state", "charging"} {
+		if !keys[key] {
+			t.Errorf("%s is not an on/off key", key)
+		}
+	}
+	for _, key := range []string{"speed", "battery_percentage", "driver_door_smoothed"} {
+		if keys[key] {
+			t.Errorf("%s is an on/off key", key)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package transmission
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// MQTT topic layouts.
+const (
+	// LayoutNative publishes one JSON state topic per car plus Home
+	// Assistant discovery.
+	LayoutNative = "native"
+	// LayoutTeslamate mirrors TeslaMate's teslamate/cars/<id>/<name> topics
+	// with one plain value per topic, so dashboards built for TeslaMate
+	// work unchanged. No Home Assistant discovery is published.
+	LayoutTeslamate = "teslamate"
+)
+
+// SetLayout selects the topic layout. carID is the <id> in TeslaMate's
+// topics and is ignored for the native layout.
+func (t *MQTTTransmitter) SetLayout(layout string, carID int) error {
+	switch layout {
+	case "", LayoutNative:
+		t.layout = LayoutNative
+	case LayoutTeslamate:
+		if carID <= 0 {
+			return fmt.Errorf("invalid TeslaMate car ID %d", carID)
+		}
+		t.layout = LayoutTeslamate
+		t.teslamateCarID = carID
+	default:
+		return fmt.Errorf("unknown MQTT layout %q (use %s or %s)", layout, LayoutNative, LayoutTeslamate)
+	}
+	return nil
+}
+
+// buildTeslamateBatch maps data onto TeslaMate's topics. Values TeslaMate
+// publishes that have no BYD counterpart (shift_state, locked, doors_open,
+// …) are left out rather than guessed.
+func (t *MQTTTransmitter) buildTeslamateBatch(data *sensors.SensorData) []mqttMessage {
+	var batch []mqttMessage
+	add := func(name, value string) {
+		batch = append(batch, mqttMessage{
+			topic:    fmt.Sprintf("teslamate/cars/%d/%s", t.teslamateCarID, name),
+			payload:  []byte(value),
+			retained: true,
+			binary:   value == "true" || value == "false",
+			state:    true,
+		})
+	}
+	addFloat := func(name string, v *float64, decimals int) {
+		if v != nil {
+			add(name, formatRounded(*v, decimals))
+			// Whole numbers are compared exactly.
+			batch[len(batch)-1].deadband = decimals > 0
+		}
+	}
+
+	if t.vehicleName != "" {
+		add("display_name", t.vehicleName)
+	}
+	add("healthy", "true")
+
+	state := teslamateState(data)
+	if state != t.teslamateState {
+		t.teslamateState = state
+		t.teslamateSince = data.Timestamp.UTC()
+	}
+	add("state", state)
+	add("since", t.teslamateSince.Format(time.RFC3339))
+
+	addFloat("battery_level", data.BatteryPercentage, 0)
+	addFloat("usable_battery_level", data.BatteryPercentage, 0)
+	if rangeKM := sensors.EstimateRangeKM(data); rangeKM != nil {
+		// The car reports no range over Diplus; the estimate stands in for
+		// all three of TeslaMate's range figures.
+		addFloat("est_battery_range_km", rangeKM, 2)
+		addFloat("rated_battery_range_km", rangeKM, 2)
+		addFloat("ideal_battery_range_km", rangeKM, 2)
+	}
+	addFloat("speed", data.Speed, 0)
+	addFloat("odometer", data.Mileage, 2)
+	addFloat("power", data.EnginePower, 0)
+	addFloat("inside_temp", data.CabinTemperature, 1)
+	addFloat("outside_temp", data.OutsideTemperature, 1)
+	if data.ACStatus != nil {
+		add("is_climate_on", strconv.FormatBool(*data.ACStatus > 0))
+	}
+	addFloat("tpms_pressure_fl", data.LeftFrontTirePressure, 2)
+	addFloat("tpms_pressure_fr", data.RightFrontTirePressure, 2)
+	addFloat("tpms_pressure_rl", data.LeftRearTirePressure, 2)
+	addFloat("tpms_pressure_rr", data.RightRearTirePressure, 2)
+
+	// Charging -------------------------------------------------------------
+	status := sensors.DeriveChargingStatus(data)
+	add("plugged_in", strconv.FormatBool(status != "disconnected"))
+	add("charging_state", teslamateChargingState(status, data))
+	chargerPower := 0.0
+	if status == "charging" && data.EnginePower != nil {
+		chargerPower = math.Abs(*data.EnginePower)
+	}
+	add("charger_power", formatRounded(chargerPower, 0))
+	if data.ChargeSession != nil {
+		add("charge_energy_added", formatRounded(data.ChargeSession.EnergyKWh, 2))
+	}
+
+	// Location -------------------------------------------------------------
+	if loc := data.Location; loc != nil && t.deviceTracker {
+		add("latitude", strconv.FormatFloat(loc.Latitude, 'f', -1, 64))
+		add("longitude", strconv.FormatFloat(loc.Longitude, 'f', -1, 64))
+		add("heading", formatRounded(loc.Bearing, 0))
+		add("elevation", formatRounded(loc.Altitude, 0))
+		if payload, err := json.Marshal(map[string]float64{
+			"latitude":  loc.Latitude,
+			"longitude": loc.Longitude,
+		}); err == nil {
+			add("location", string(payload))
+		}
+	}
+
+	return batch
+}
+
+// teslamateState maps the driving state onto TeslaMate's vehicle states.
+func teslamateState(data *sensors.SensorData) string {
+	if data.DrivingState != nil {
+		switch *data.DrivingState {
+		case "driving":
+			return "driving"
+		case "charging":
+			return "charging"
+		}
+	}
+	if data.PowerStatus != nil && *data.PowerStatus > 0 {
+		return "online"
+	}
+	return "asleep"
+}
+
+// teslamateChargingState maps the derived charging status onto TeslaMate's
+// charging_state values.
+func teslamateChargingState(status string, data *sensors.SensorData) string {
+	switch status {
+	case "charging":
+		return "Charging"
+	case "connected":
+		if data.BatteryPercentage != nil && *data.BatteryPercentage >= 100 {
+			return "Complete"
+		}
+		return "Stopped"
+	default:
+		return "Disconnected"
+	}
+}
+
+func formatRounded(v float64, decimals int) string {
+	p := math.Pow(10, float64(decimals))
+	return strconv.FormatFloat(math.Round(v*p)/p, 'f', -1, 64)
+}
@@ -0,0 +1,88 @@
+package transmission
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Allthebester/byd-hass/internal/location"
+)
+
+// Zone events published by PublishZoneEvent.
+const (
+	EventZoneEnter = "zone_enter"
+	EventZoneLeave = "zone_leave"
+)
+
+// EnableZones announces the Location Zone sensor and the Zone event entity
+// with the next discovery cycle; zones are the configured zone names.
+func (t *MQTTTransmitter) EnableZones(zones []string) {
+	t.zones = append(append([]string{}, zones...), location.ZoneAway)
+}
+
+// SetDeviceTracker controls whether raw GPS coordinates are published: the
+// device_tracker entity and its location topic, and the TeslaMate latitude
+// and longitude topics. Disabling it also removes a device_tracker announced
+// earlier from Home Assistant.
+func (t *MQTTTransmitter) SetDeviceTracker(enabled bool) {
+	t.deviceTracker = enabled
+}
+
+func (t *MQTTTransmitter) zoneEventTopic() string {
+	return fmt.Sprintf("byd_car/%s/zone_event", t.deviceID)
+}
+
+// PublishZoneEvent publishes a one-off (non-retained) zone enter or leave
+// event for zone.
+func (t *MQTTTransmitter) PublishZoneEvent(ctx context.Context, eventType, zone string) error {
+	return t.publishEvent(ctx, t.zoneEventTopic(), eventType, map[string]interface{}{"zone": zone})
+}
+
+// queueZoneDiscovery queues discovery config for the Location Zone enum
+// sensor and the Zone event entity.
+func (t *MQTTTransmitter) queueZoneDiscovery(batch *[]mqttMessage, baseTopic string, device HADevice) error {
+	uniqueID := fmt.Sprintf("%s_location_zone", t.deviceID)
+	if !t.publishedSensors[uniqueID] {
+		config := HADiscoveryConfig{
+			Name:              "Location Zone",
+			UniqueID:          uniqueID,
+			StateTopic:        fmt.Sprintf("%s/state", baseTopic),
+			ValueTemplate:     "{{ value_json.location_zone | default(None) }}",
+			DeviceClass:       "enum",
+			Options:           t.zones,
+			AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+			Device:            device,
+			Icon:              "mdi:map-marker-radius",
+		}
+		topic := fmt.Sprintf("%s/sensor/byd_car_%s/location_zone/config", t.discoveryPrefix, t.deviceID)
+		if err := t.queueConfigRaw(batch, uniqueID, topic, config); err != nil {
+			return err
+		}
+	}
+
+	uniqueID = fmt.Sprintf("%s_zone_event", t.deviceID)
+	if t.publishedSensors[uniqueID] {
+		return nil
+	}
+	config := HADiscoveryConfig{
+		Name:              "Zone",
+		UniqueID:          uniqueID,
+		StateTopic:        t.zoneEventTopic(),
+		AvailabilityTopic: fmt.Sprintf("%s/availability", baseTopic),
+		EventTypes:        []string{EventZoneEnter, EventZoneLeave},
+		Icon:              "mdi:map-marker-radius",
+		Device:            device,
+	}
+	topic := fmt.Sprintf("%s/event/byd_car_%s/zone_event/config", t.discoveryPrefix, t.deviceID)
+	return t.queueConfigRaw(batch, uniqueID, topic, config)
+}
+
+// queueDeviceTrackerRemoval clears the retained device_tracker discovery
+// config once, so Home Assistant drops the entity.
+func (t *MQTTTransmitter) queueDeviceTrackerRemoval(batch *[]mqttMessage) {
+	const key = "device_tracker_removed"
+	if t.publishedSensors[key] {
+		return
+	}
+	topic := fmt.Sprintf("%s/device_tracker/byd_car_%s/config", t.discoveryPrefix, t.deviceID)
+	*batch = append(*batch, mqttMessage{topic: topic, payload: []byte{}, retained: true, discoveryKey: key})
+}
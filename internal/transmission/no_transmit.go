@@ -0,0 +1,58 @@
+package transmission
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TransportSetter is implemented by the transmitters that talk HTTP;
+// SetTransport replaces the transport their requests go through.
+type TransportSetter interface {
+	SetTransport(rt http.RoundTripper)
+}
+
+// noTransmitTransport logs requests instead of sending them.
+type noTransmitTransport struct {
+	output string
+	logger *logrus.Logger
+}
+
+// NoTransmitTransport returns a transport that logs every request of output,
+// body included, at info level and answers it with 200 OK and an empty JSON
+// object instead of sending it.
+func NoTransmitTransport(output string, logger *logrus.Logger) http.RoundTripper {
+	return noTransmitTransport{output: output, logger: logger}
+}
+
+func (t noTransmitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fields := logrus.Fields{
+		"output": t.output,
+		"method": req.Method,
+		"url":    req.URL.Redacted(),
+	}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(body) > 0 {
+			fields["body"] = string(body)
+		}
+	}
+	t.logger.WithFields(fields).Info("HTTP request (not sent)")
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(strings.NewReader("{}")),
+		ContentLength: 2,
+		Request:       req,
+	}, nil
+}
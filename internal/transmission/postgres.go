@@ -0,0 +1,201 @@
+package transmission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	pgMaxConns     = 2
+	pgBatchSize    = 100
+	pgWriteTimeout = 10 * time.Second
+)
+
+// PostgresTransmitter writes one row per snapshot into a TeslaMate-style
+// positions table (see pgColumns), creating it when missing. Rows that cannot
+// be written are kept in a bounded in-memory queue – the oldest row is dropped
+// when full – and inserted in batches once the database is reachable again;
+// pgxpool takes care of reconnecting.
+type PostgresTransmitter struct {
+	pool      *pgxpool.Pool
+	table     string
+	insertSQL string
+	deviceID  string
+	maxRows   int
+	logger    *logrus.Logger
+
+	healthy uint32
+
+	mu      sync.Mutex
+	pending [][]interface{}
+	dropped uint64
+
+	guard closeGuard
+}
+
+// NewPostgresTransmitter sets up a connection pool for dsn; Connect creates
+// table if needed and checks its schema version. maxRows bounds the offline
+// queue.
+func NewPostgresTransmitter(dsn, table, deviceID string, maxRows int, logger *logrus.Logger) (*PostgresTransmitter, error) {
+	if err := validPGTable(table); err != nil {
+		return nil, err
+	}
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PostgreSQL URL: %w", err)
+	}
+	cfg.MaxConns = pgMaxConns
+
+	// The pool connects lazily, on the first query.
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up PostgreSQL: %w", err)
+	}
+	return &PostgresTransmitter{
+		pool:      pool,
+		table:     table,
+		insertSQL: pgInsertSQL(table),
+		deviceID:  deviceID,
+		maxRows:   maxRows,
+		logger:    logger,
+	}, nil
+}
+
+// Connect implements Connector: it connects, creating the table if needed
+// and checking its schema version.
+func (t *PostgresTransmitter) Connect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pgWriteTimeout)
+	defer cancel()
+	if err := t.ensureSchema(ctx); err != nil {
+		return err
+	}
+	atomic.StoreUint32(&t.healthy, 1)
+	return nil
+}
+
+// Transmit queues the snapshot and writes everything pending.
+func (t *PostgresTransmitter) Transmit(ctx context.Context, data *sensors.SensorData) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = append(t.pending, pgRowArgs(t.deviceID, data))
+	if over := len(t.pending) - t.maxRows; t.maxRows > 0 && over > 0 {
+		t.pending = t.pending[over:]
+		t.dropped += uint64(over)
+	}
+
+	for len(t.pending) > 0 {
+		n := len(t.pending)
+		if n > pgBatchSize {
+			n = pgBatchSize
+		}
+		if err := t.insert(ctx, t.pending[:n]); err != nil {
+			if atomic.SwapUint32(&t.healthy, 0) == 1 {
+				t.logger.WithError(err).Warn("PostgreSQL unreachable – queueing rows")
+			}
+			return fmt.Errorf("PostgreSQL insert failed (%d rows queued): %w", len(t.pending), err)
+		}
+		t.pending = t.pending[n:]
+	}
+
+	if atomic.SwapUint32(&t.healthy, 1) == 0 {
+		t.logger.WithField("dropped", t.dropped).Info("PostgreSQL connection restored")
+		t.dropped = 0
+	}
+	return nil
+}
+
+// Check implements Checker by pinging the database.
+func (t *PostgresTransmitter) Check(ctx context.Context) error {
+	if err := t.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("PostgreSQL unreachable: %w", err)
+	}
+	return nil
+}
+
+// Name implements Transmitter.
+func (t *PostgresTransmitter) Name() string { return "PostgreSQL" }
+
+// IsConnected reports whether the last write succeeded.
+func (t *PostgresTransmitter) IsConnected() bool {
+	return atomic.LoadUint32(&t.healthy) == 1
+}
+
+// Close makes one last attempt to write queued rows and closes the connection
+// pool. Rows that still cannot be written are lost.
+func (t *PostgresTransmitter) Close(ctx context.Context) error {
+	return t.guard.close(func() error {
+		defer t.pool.Close()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if len(t.pending) == 0 || ctx.Err() != nil {
+			return nil
+		}
+		if err := t.insert(ctx, t.pending); err != nil {
+			t.logger.WithError(err).WithField("rows", len(t.pending)).Warn("Discarding unwritten PostgreSQL rows on shutdown")
+			return err
+		}
+		t.pending = nil
+		return nil
+	})
+}
+
+// insert writes rows in one transaction so a batch is either fully stored or
+// retried as a whole.
+func (t *PostgresTransmitter) insert(ctx context.Context, rows [][]interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, pgWriteTimeout)
+	defer cancel()
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	batch := &pgx.Batch{}
+	for _, args := range rows {
+		batch.Queue(t.insertSQL, args...)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (t *PostgresTransmitter) ensureSchema(ctx context.Context) error {
+	for _, stmt := range []string{pgCreateMetaSQL(), pgCreateTableSQL(t.table), pgCreateIndexSQL(t.table)} {
+		if _, err := t.pool.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create PostgreSQL schema: %w", err)
+		}
+	}
+
+	var stored int
+	found := true
+	err := t.pool.QueryRow(ctx, "SELECT version FROM "+pgMetaTable+" WHERE table_name = $1", t.table).Scan(&stored)
+	if errors.Is(err, pgx.ErrNoRows) {
+		found = false
+	} else if err != nil {
+		return fmt.Errorf("failed to read PostgreSQL schema version: %w", err)
+	}
+	if err := pgCheckVersion(t.table, stored, found); err != nil {
+		return err
+	}
+	if !found {
+		if _, err := t.pool.Exec(ctx, "INSERT INTO "+pgMetaTable+" (table_name, version) VALUES ($1, $2)", t.table, pgSchemaVersion); err != nil {
+			return fmt.Errorf("failed to record PostgreSQL schema version: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package transmission
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// pgSchemaVersion is bumped whenever pgColumns changes. The version is stored
+// per table in byd_hass_schema; the logger refuses to write into a table with
+// a different version instead of failing on every insert.
+const pgSchemaVersion = 1
+
+// pgMetaTable records the schema version of every table the logger writes.
+const pgMetaTable = "byd_hass_schema"
+
+// pgColumns is the row layout. Names follow TeslaMate's positions table where
+// an equivalent exists so existing Grafana queries need few changes.
+var pgColumns = []struct {
+	name, sqlType string
+}{
+	{"device_id", "TEXT NOT NULL"},
+	{"date", "TIMESTAMPTZ NOT NULL"},
+	{"battery_level", "DOUBLE PRECISION"},
+	{"speed", "DOUBLE PRECISION"},
+	{"odometer", "DOUBLE PRECISION"},
+	{"power", "DOUBLE PRECISION"},
+	{"latitude", "DOUBLE PRECISION"},
+	{"longitude", "DOUBLE PRECISION"},
+	{"elevation", "DOUBLE PRECISION"},
+	{"outside_temp", "DOUBLE PRECISION"},
+	{"inside_temp", "DOUBLE PRECISION"},
+	{"battery_temp", "DOUBLE PRECISION"},
+}
+
+var pgIdentRE = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// validPGTable reports whether name can be used unquoted as a table name.
+func validPGTable(name string) error {
+	if !pgIdentRE.MatchString(name) {
+		return fmt.Errorf("invalid PostgreSQL table name %q (use lower-case letters, digits and _)", name)
+	}
+	return nil
+}
+
+func pgCreateMetaSQL() string {
+	return "CREATE TABLE IF NOT EXISTS " + pgMetaTable + " (table_name TEXT PRIMARY KEY, version INTEGER NOT NULL)"
+}
+
+func pgCreateTableSQL(table string) string {
+	cols := make([]string, 0, len(pgColumns)+1)
+	cols = append(cols, "id BIGSERIAL PRIMARY KEY")
+	for _, c := range pgColumns {
+		cols = append(cols, c.name+" "+c.sqlType)
+	}
+	return "CREATE TABLE IF NOT EXISTS " + table + " (" + strings.Join(cols, ", ") + ")"
+}
+
+func pgCreateIndexSQL(table string) string {
+	return "CREATE INDEX IF NOT EXISTS " + table + "_date_idx ON " + table + " (device_id, date)"
+}
+
+func pgInsertSQL(table string) string {
+	names := make([]string, len(pgColumns))
+	params := make([]string, len(pgColumns))
+	for i, c := range pgColumns {
+		names[i] = c.name
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return "INSERT INTO " + table + " (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(params, ", ") + ")"
+}
+
+// pgCheckVersion compares the stored schema version with pgSchemaVersion.
+// found is false for a table the logger has never written to.
+func pgCheckVersion(table string, stored int, found bool) error {
+	if !found || stored == pgSchemaVersion {
+		return nil
+	}
+	if stored < pgSchemaVersion {
+		return fmt.Errorf("table %s has schema version %d, this build writes version %d – migrate or use a new table", table, stored, pgSchemaVersion)
+	}
+	return fmt.Errorf("table %s has schema version %d, newer than this build's version %d – upgrade byd-hass", table, stored, pgSchemaVersion)
+}
+
+// pgRowArgs returns the insert arguments for one snapshot in pgColumns order.
+// Missing sensors are written as NULL.
+func pgRowArgs(deviceID string, data *sensors.SensorData) []interface{} {
+	ts := data.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	var lat, lon, ele *float64
+	if loc := data.Location; loc != nil {
+		lat, lon = &loc.Latitude, &loc.Longitude
+		if loc.GoodFix() {
+			ele = &loc.Altitude
+		}
+	}
+	return []interface{}{
+		deviceID,
+		ts.UTC(),
+		data.BatteryPercentage,
+		data.Speed,
+		data.Mileage,
+		data.EnginePower,
+		lat,
+		lon,
+		ele,
+		data.OutsideTemperature,
+		data.CabinTemperature,
+		data.AvgBatteryTemp,
+	}
+}
@@ -0,0 +1,226 @@
+package transmission
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// fakePostgres speaks enough of the simple query protocol for the
+// transmitter. It records every statement and answers a schema version
+// query with version (0 = no row). While failing, inserts into the
+// positions table are refused.
+type fakePostgres struct {
+	ln      net.Listener
+	version int
+
+	mu         sync.Mutex
+	failing    bool
+	statements []string
+	rows       []string // battery level of each committed byd_positions row
+}
+
+func newFakePostgres(t *testing.T, version int) *fakePostgres {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &fakePostgres{ln: ln, version: version}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go db.serve(conn)
+		}
+	}()
+	return db
+}
+
+// dsn makes pgx interpolate the arguments so the statements read as SQL.
+func (db *fakePostgres) dsn() string {
+	return "postgres://test@" + db.ln.Addr().String() + "/test?sslmode=disable&default_query_exec_mode=simple_protocol"
+}
+
+func (db *fakePostgres) setFailing(failing bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.failing = failing
+}
+
+func (db *fakePostgres) inserted() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.rows...)
+}
+
+// battery extracts the third value of an INSERT statement.
+func battery(stmt string) string {
+	_, values, _ := strings.Cut(stmt, "VALUES (")
+	return strings.Trim(strings.Split(values, ",")[2], " '")
+}
+
+func (db *fakePostgres) serve(conn net.Conn) {
+	defer conn.Close()
+	be := pgproto3.NewBackend(conn, conn)
+	if _, err := be.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	be.Send(&pgproto3.AuthenticationOk{})
+	be.Send(&pgproto3.ParameterStatus{Name: "client_encoding", Value: "UTF8"})
+	be.Send(&pgproto3.ParameterStatus{Name: "standard_conforming_strings", Value: "on"})
+	be.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if be.Flush() != nil {
+		return
+	}
+	status := byte('I')
+	var uncommitted []string
+	for {
+		msg, err := be.Receive()
+		if err != nil {
+			return
+		}
+		q, ok := msg.(*pgproto3.Query)
+		if !ok {
+			return
+		}
+		for _, stmt := range strings.Split(q.String, ";") {
+			if status == 'E' && stmt != "rollback" {
+				continue
+			}
+			db.mu.Lock()
+			db.statements = append(db.statements, stmt)
+			failing := db.failing
+			db.mu.Unlock()
+			switch {
+			case stmt == "begin":
+				status = 'T'
+				be.Send(&pgproto3.CommandComplete{CommandTag: []byte("BEGIN")})
+			case stmt == "commit" || stmt == "rollback":
+				if stmt == "commit" {
+					db.mu.Lock()
+					db.rows = append(db.rows, uncommitted...)
+					db.mu.Unlock()
+				}
+				uncommitted = nil
+				status = 'I'
+				be.Send(&pgproto3.CommandComplete{CommandTag: []byte(strings.ToUpper(stmt))})
+			case strings.HasPrefix(stmt, "SELECT version"):
+				be.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: []byte("version"), DataTypeOID: 23, DataTypeSize: 4}}})
+				rows := 0
+				if db.version > 0 {
+					be.Send(&pgproto3.DataRow{Values: [][]byte{[]byte(fmt.Sprint(db.version))}})
+					rows = 1
+				}
+				be.Send(&pgproto3.CommandComplete{CommandTag: []byte(fmt.Sprint("SELECT ", rows))})
+			case strings.HasPrefix(stmt, "INSERT INTO byd_positions") && failing:
+				status = 'E'
+				be.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "57P03", Message: "the database system is starting up"})
+			case strings.HasPrefix(stmt, "INSERT INTO byd_positions"):
+				uncommitted = append(uncommitted, battery(stmt))
+				be.Send(&pgproto3.CommandComplete{CommandTag: []byte("INSERT 0 1")})
+			case strings.HasPrefix(stmt, "INSERT"):
+				be.Send(&pgproto3.CommandComplete{CommandTag: []byte("INSERT 0 1")})
+			default:
+				be.Send(&pgproto3.CommandComplete{CommandTag: []byte("CREATE TABLE")})
+			}
+		}
+		be.Send(&pgproto3.ReadyForQuery{TxStatus: status})
+		if be.Flush() != nil {
+			return
+		}
+	}
+}
+
+func TestPostgresTransmitter(t *testing.T) {
+	db := newFakePostgres(t, 0)
+	tx, err := NewPostgresTransmitter(db.dsn(), "byd_positions", "test", 2, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tx.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	db.mu.Lock()
+	var schema []string
+	for _, s := range db.statements {
+		schema = append(schema, strings.Join(strings.Fields(s)[:2], " "))
+	}
+	db.mu.Unlock()
+	if want := "[CREATE TABLE CREATE TABLE CREATE INDEX SELECT version INSERT INTO]"; fmt.Sprint(schema) != want {
+		t.Errorf("schema statements %v, want %v", schema, want)
+	}
+
+	transmit := func(soc float64) error {
+		return tx.Transmit(ctx, &sensors.SensorData{Timestamp: time.Now(), BatteryPercentage: &soc})
+	}
+	steps := []struct {
+		name          string
+		failing       bool
+		soc           float64
+		wantErr       bool
+		wantConnected bool
+		wantRows      string
+	}{
+		{"written", false, 80, false, true, "[80]"},
+		{"queued while the database is down", true, 79, true, false, "[80]"},
+		{"still down", true, 78, true, false, "[80]"},
+		// The queue holds two rows, so 79 was dropped.
+		{"queue written once back", false, 77, false, true, "[80 78 77]"},
+	}
+	for _, st := range steps {
+		db.setFailing(st.failing)
+		if err := transmit(st.soc); (err != nil) != st.wantErr {
+			t.Errorf("%s: err = %v, want error %v", st.name, err, st.wantErr)
+		}
+		if got := tx.IsConnected(); got != st.wantConnected {
+			t.Errorf("%s: IsConnected = %v, want %v", st.name, got, st.wantConnected)
+		}
+		if got := fmt.Sprint(db.inserted()); got != st.wantRows {
+			t.Errorf("%s: rows %s, want %s", st.name, got, st.wantRows)
+		}
+	}
+}
+
+func TestPostgresSchemaVersion(t *testing.T) {
+	tests := []struct {
+		stored  int // 0 = never written
+		wantErr string
+	}{
+		{0, ""},
+		{pgSchemaVersion, ""},
+		{pgSchemaVersion + 1, "upgrade byd-hass"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint("version ", tt.stored), func(t *testing.T) {
+			db := newFakePostgres(t, tt.stored)
+			tx, err := NewPostgresTransmitter(db.dsn(), "byd_positions", "test", 10, quietLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Close(context.Background())
+			err = tx.Connect(context.Background())
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Connect = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewPostgresTransmitter("postgres://localhost/test", "Positions; DROP", "test", 10, quietLogger()); err == nil {
+		t.Error("invalid table name accepted")
+	}
+}
@@ -0,0 +1,216 @@
+package transmission
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/metrics"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+)
+
+// prometheusStaleAfter drops sensor series that were not refreshed for this
+// long, e.g. because polling keeps failing.
+const prometheusStaleAfter = 5 * time.Minute
+
+// PrometheusExporter serves the published sensors in the Prometheus text
+// exposition format on /metrics. Transmit only swaps the in-memory snapshot,
+// so a slow scraper can never block the poll loop.
+//
+// Numeric sensors become byd_sensor{id,name} gauges; non-numeric ones are
+// exposed as byd_sensor_info{id,name,value} 1. A sensor that is missing from
+// the latest snapshot simply disappears from the output (Prometheus then
+// marks the series stale), as does the whole snapshot once it is older than
+// prometheusStaleAfter.
+//
+// The collector's own counters follow under the bydhass_ namespace (see
+// metrics.Registry).
+type PrometheusExporter struct {
+	logger  *logrus.Logger
+	server  *http.Server
+	mux     *http.ServeMux
+	metrics *metrics.Registry
+
+	mu        sync.Mutex
+	samples   []promSample
+	updatedAt time.Time
+
+	guard closeGuard
+}
+
+type promSample struct {
+	id    int
+	name  string
+	value float64
+	text  string // set for non-numeric sensors
+}
+
+// NewPrometheusExporter starts serving /metrics on listenAddr (e.g. "127.0.0.1:9725").
+func NewPrometheusExporter(listenAddr string, logger *logrus.Logger) (*PrometheusExporter, error) {
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listenAddr, err)
+	}
+
+	e := &PrometheusExporter{
+		logger:  logger,
+		metrics: metrics.New(),
+	}
+	e.mux = http.NewServeMux()
+	e.mux.HandleFunc("/metrics", e.handleMetrics)
+	e.server = &http.Server{Handler: e.mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := e.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.WithError(err).Error("Prometheus exporter stopped")
+		}
+	}()
+
+	logger.WithField("listen", ln.Addr().String()).Info("Prometheus metrics listening on /metrics")
+	return e, nil
+}
+
+// Handle mounts an additional operational endpoint (e.g. /config) on the
+// exporter's HTTP server.
+func (e *PrometheusExporter) Handle(pattern string, h http.Handler) {
+	e.mux.Handle(pattern, h)
+}
+
+// HandleWithToken mounts h like Handle, but only for requests carrying
+// "Authorization: Bearer <token>"; everything else gets a 401.
+func (e *PrometheusExporter) HandleWithToken(pattern, token string, h http.Handler) {
+	e.mux.Handle(pattern, requireToken(token, h))
+}
+
+// requireToken guards h with a bearer token. An empty token admits no one.
+func requireToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); token != "" && strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="byd-hass"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// Transmit replaces the exported snapshot with the published values of data.
+func (e *PrometheusExporter) Transmit(_ context.Context, data *sensors.SensorData) error {
+	if e.guard.isClosed() {
+		return ErrClosed
+	}
+	values := publishedValues(data)
+
+	var samples []promSample
+	for _, id := range sensors.PublishedSensorIDs() {
+		def := sensors.GetSensorByID(id)
+		if def == nil {
+			continue
+		}
+		name := sensors.ToSnakeCase(def.FieldName)
+		v, ok := values[name]
+		if !ok {
+			continue // dormant sensor: drop the series
+		}
+		s := promSample{id: id, name: name}
+		switch x := v.(type) {
+		case float64:
+			s.value = x
+		case bool:
+			if x {
+				s.value = 1
+			}
+		case string:
+			s.text = x
+		default:
+			e.logger.WithField("sensor", name).Debug("Prometheus: skipping sensor with unsupported type")
+			continue
+		}
+		samples = append(samples, s)
+	}
+
+	e.mu.Lock()
+	e.samples = samples
+	e.updatedAt = time.Now()
+	e.mu.Unlock()
+	return nil
+}
+
+// Name implements Transmitter.
+func (e *PrometheusExporter) Name() string { return "Prometheus" }
+
+// IsConnected reports whether the HTTP server is running.
+func (e *PrometheusExporter) IsConnected() bool {
+	return e.server != nil
+}
+
+// PollResult counts Diplus poll outcomes.
+func (e *PrometheusExporter) PollResult(err error) {
+	e.metrics.PollResult(err)
+}
+
+// PollDuration records the latency of a Diplus poll.
+func (e *PrometheusExporter) PollDuration(d time.Duration) {
+	e.metrics.PollDuration(d)
+}
+
+// TransmitResult counts deliveries per transmitter.
+func (e *PrometheusExporter) TransmitResult(name string, err error) {
+	e.metrics.TransmitResult(name, err)
+}
+
+// Close shuts the HTTP server down.
+func (e *PrometheusExporter) Close(ctx context.Context) error {
+	return e.guard.close(func() error {
+		return e.server.Shutdown(ctx)
+	})
+}
+
+func (e *PrometheusExporter) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	e.mu.Lock()
+	samples := e.samples
+	if time.Since(e.updatedAt) > prometheusStaleAfter {
+		samples = nil
+	}
+	e.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	fmt.Fprintln(bw, "# HELP byd_sensor Current value of a published BYD sensor.")
+	fmt.Fprintln(bw, "# TYPE byd_sensor gauge")
+	for _, s := range samples {
+		if s.text != "" || math.IsNaN(s.value) {
+			continue
+		}
+		fmt.Fprintf(bw, "byd_sensor{id=\"%d\",name=\"%s\"} %s\n", s.id, promEscape(s.name), strconv.FormatFloat(s.value, 'g', -1, 64))
+	}
+
+	fmt.Fprintln(bw, "# HELP byd_sensor_info Non-numeric BYD sensor; the value is in the value label.")
+	fmt.Fprintln(bw, "# TYPE byd_sensor_info gauge")
+	for _, s := range samples {
+		if s.text == "" {
+			continue
+		}
+		fmt.Fprintf(bw, "byd_sensor_info{id=\"%d\",name=\"%s\",value=\"%s\"} 1\n", s.id, promEscape(s.name), promEscape(s.text))
+	}
+
+	e.metrics.WriteText(bw)
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promEscape(s string) string {
+	return promLabelEscaper.Replace(s)
+}
@@ -0,0 +1,85 @@
+package transmission
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+func TestRequireToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"no header", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "Bearer nope", http.StatusUnauthorized},
+		{"token prefix", "s3cret", "Bearer s3c", http.StatusUnauthorized},
+		{"not a bearer", "s3cret", "Basic s3cret", http.StatusUnauthorized},
+		{"bare token", "s3cret", "s3cret", http.StatusUnauthorized},
+		{"right token", "s3cret", "Bearer s3cret", http.StatusOK},
+		{"empty token admits no one", "", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/diagnostics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			requireToken(tt.token, ok).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	e, err := NewPrometheusExporter("127.0.0.1:0", quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close(context.Background())
+	soc := 80.0
+	if err := e.Transmit(context.Background(), &sensors.SensorData{BatteryPercentage: &soc}); err != nil {
+		t.Fatal(err)
+	}
+	e.PollResult(nil)
+	e.PollResult(errors.New("timeout"))
+	e.TransmitResult("MQTT", nil)
+	e.TransmitResult("ABRP", errors.New("rejected"))
+
+	rec := httptest.NewRecorder()
+	e.handleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{`byd_sensor{id="33",name="battery_percentage"} 80`, true},
+		{"bydhass_polls_total 2", true},
+		{"bydhass_poll_errors_total 1", true},
+		{`bydhass_transmits_total{output="ABRP",result="failure"} 1`, true},
+		// Replaced by the bydhass_ counters above.
+		{"byd_poll_total", false},
+		{"byd_transmit_errors_total", false},
+	}
+	for _, tt := range tests {
+		if got := strings.Contains(body, tt.line); got != tt.want {
+			t.Errorf("%q in /metrics = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,602 @@
+package transmission
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	spoolSegmentPrefix = "seg-"
+	spoolSegmentSuffix = ".jsonl"
+	spoolCursorFile    = "cursor"
+	// A segment is sealed once it reaches 1/spoolSegmentsPerBudget of the
+	// disk budget (but at least spoolMinSegmentBytes), so the budget is
+	// enforced by dropping reasonably small chunks.
+	spoolSegmentsPerBudget = 16
+	spoolMinSegmentBytes   = 64 << 10
+
+	spoolInitialBackoff = 2 * time.Second
+	spoolMaxBackoff     = 5 * time.Minute
+	spoolDeliverTimeout = 30 * time.Second // one replay attempt
+)
+
+// ErrSpooled is wrapped around the delivery error of a payload that was
+// written to the spool for a later retry: the data is not lost, but the
+// destination is not taking it right now.
+var ErrSpooled = errors.New("spooled for retry")
+
+// spoolRejection marks a delivery error where the destination answered and
+// refused the payload (e.g. a 400). Only these count toward the spool's
+// attempt limit; an unreachable destination is retried for as long as the
+// disk budget allows.
+type spoolRejection struct{ err error }
+
+func (e spoolRejection) Error() string { return e.err.Error() }
+func (e spoolRejection) Unwrap() error { return e.err }
+
+func isSpoolRejection(err error) bool {
+	var r spoolRejection
+	return errors.As(err, &r)
+}
+
+// spoolDeliverFunc makes one delivery attempt of a spooled payload.
+type spoolDeliverFunc func(ctx context.Context, payload []byte) error
+
+// Spool is a store-and-forward queue on disk shared by the HTTP-based
+// transmitters. Each destination (ABRP, Webhook, InfluxDB) has its own
+// directory of JSON-lines segment files plus a cursor file holding the
+// sequence number of the first undelivered payload, and its own drainer
+// goroutine that replays the queue in order with exponential back-off.
+//
+// Delivery is at least once: a payload delivered just before a crash is
+// sent again after the restart. A payload the destination rejected
+// maxAttempts times is dropped with a warning so it cannot wedge the queue.
+// When the segments of all destinations together exceed maxBytes, the
+// oldest segment is dropped.
+type Spool struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+	maxAttempts  int
+	logger       *logrus.Logger
+
+	ctx    context.Context // cancelled by Close; stops the drainers
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	queues map[string]*spoolQueue
+	total  int64 // bytes in all segments
+
+	guard closeGuard
+}
+
+// spoolQueue is the queue of one destination. Except where noted, fields
+// are guarded by spool.mu.
+type spoolQueue struct {
+	spool   *Spool
+	name    string
+	dir     string
+	deliver spoolDeliverFunc
+	opts    spoolQueueOptions
+	wake    chan struct{}
+
+	sendMu sync.Mutex // serialises send, so a direct delivery never overtakes the queue
+
+	segments []spoolSegment // oldest first
+	file     *os.File       // open on the last segment; nil once sealed
+	nextSeq  uint64
+	cursor   uint64 // first undelivered sequence number
+	lastErr  error  // last delivery failure; cleared once the queue drains
+
+	// Owned by the drainer.
+	head       []spoolEntry // undelivered entries of segments[0]
+	headLoaded string       // name of the segment head was read from
+	attemptSeq uint64
+	attempts   int
+}
+
+// spoolQueueOptions tailor a queue to its destination.
+type spoolQueueOptions struct {
+	// liveFirst delivers new payloads right away even while a backlog is
+	// queued, instead of queueing them behind it. For destinations where
+	// fresh data matters more than order, such as ABRP's live view.
+	liveFirst bool
+	// maxEntries caps the queued payloads, dropping the oldest first
+	// (0 = only the disk budget applies).
+	maxEntries int
+}
+
+type spoolSegment struct {
+	name        string
+	first, last uint64 // sequence numbers
+	bytes       int64
+	created     time.Time
+}
+
+type spoolEntry struct {
+	Seq uint64 `json:"seq"`
+	T   int64  `json:"t"` // Unix milliseconds when spooled
+	P   []byte `json:"p"`
+}
+
+// OpenSpool creates the spool in dir. Queues are added by the transmitters
+// through their SetSpool methods.
+func OpenSpool(dir string, maxBytes int64, maxAttempts int, logger *logrus.Logger) (*Spool, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("spool size limit must be positive")
+	}
+	if maxAttempts <= 0 {
+		return nil, fmt.Errorf("spool attempt limit must be positive")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Spool{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: max(maxBytes/spoolSegmentsPerBudget, min(maxBytes, spoolMinSegmentBytes)),
+		maxAttempts:  maxAttempts,
+		logger:       logger,
+		ctx:          ctx,
+		cancel:       cancel,
+		queues:       make(map[string]*spoolQueue),
+	}, nil
+}
+
+// queue opens the queue of destination name, restoring what an earlier run
+// left behind, and starts its drainer.
+func (s *Spool) queue(name string, deliver spoolDeliverFunc, opts spoolQueueOptions) (*spoolQueue, error) {
+	if s.guard.isClosed() {
+		return nil, ErrClosed
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.queues[name]; ok {
+		return nil, fmt.Errorf("spool queue %q already exists", name)
+	}
+	q := &spoolQueue{
+		spool:   s,
+		name:    name,
+		dir:     filepath.Join(s.dir, name),
+		deliver: deliver,
+		opts:    opts,
+		wake:    make(chan struct{}, 1),
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	s.queues[name] = q
+	for _, seg := range q.segments {
+		s.total += seg.bytes
+	}
+	s.evictLocked()
+	q.trimLocked()
+	if n := q.depthLocked(); n > 0 {
+		s.logger.WithFields(logrus.Fields{"destination": name, "payloads": n}).Info("Restored spooled payloads")
+	}
+
+	s.wg.Add(1)
+	go q.drain()
+	return q, nil
+}
+
+// Close stops the drainers, waiting for an attempt in flight until ctx
+// expires, and closes the segment files. Undelivered payloads stay on disk
+// for the next run.
+func (s *Spool) Close(ctx context.Context) error {
+	return s.guard.close(func() error {
+		s.cancel()
+		done := make(chan struct{})
+		go func() {
+			s.wg.Wait()
+			close(done)
+		}()
+		var err error
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err = fmt.Errorf("spool drainers still running: %w", ctx.Err())
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, q := range s.queues {
+			err = errors.Join(err, q.closeFile())
+		}
+		return err
+	})
+}
+
+// send delivers payload right away when nothing is queued for the
+// destination, and spools it when that attempt fails or older payloads are
+// still waiting, so the destination receives payloads in order. A liveFirst
+// queue tries the direct delivery even behind a backlog. queued
+// reports whether the payload went to the spool; err is then the reason
+// (wrapping ErrSpooled), or nil when it merely queued behind a backlog that
+// is draining fine.
+func (q *spoolQueue) send(ctx context.Context, payload []byte) (queued bool, err error) {
+	q.sendMu.Lock()
+	defer q.sendMu.Unlock()
+
+	s := q.spool
+	s.mu.Lock()
+	backlog, cause := q.depthLocked() > 0, q.lastErr
+	s.mu.Unlock()
+
+	if !backlog || q.opts.liveFirst {
+		if cause = q.deliver(ctx, payload); cause == nil {
+			return false, nil
+		}
+	}
+	if s.guard.isClosed() {
+		return false, fmt.Errorf("spool closed: %w", cause)
+	}
+
+	s.mu.Lock()
+	err = q.enqueueLocked(payload)
+	if err == nil && cause != nil {
+		q.lastErr = cause
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return false, fmt.Errorf("failed to spool payload: %w (delivery: %v)", err, cause)
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	if cause == nil {
+		return true, nil
+	}
+	return true, fmt.Errorf("%w: %w", ErrSpooled, cause)
+}
+
+// depth returns the number of queued payloads.
+func (q *spoolQueue) depth() int {
+	q.spool.mu.Lock()
+	defer q.spool.mu.Unlock()
+	return q.depthLocked()
+}
+
+func (q *spoolQueue) depthLocked() int {
+	return int(q.nextSeq - q.cursor)
+}
+
+// enqueueLocked appends payload to the last segment, sealing it and starting
+// a new one when it is full.
+func (q *spoolQueue) enqueueLocked(payload []byte) error {
+	s := q.spool
+	now := time.Now()
+	line, err := json.Marshal(spoolEntry{Seq: q.nextSeq, T: now.UnixMilli(), P: payload})
+	if err != nil {
+		return fmt.Errorf("failed to marshal spool entry: %w", err)
+	}
+	line = append(line, '\n')
+	if int64(len(line)) > s.segmentBytes {
+		return fmt.Errorf("payload of %d bytes exceeds the spool segment size", len(payload))
+	}
+
+	n := len(q.segments)
+	if q.file == nil || q.segments[n-1].bytes+int64(len(line)) > s.segmentBytes {
+		if err := q.closeFile(); err != nil {
+			s.logger.WithError(err).WithField("destination", q.name).Warn("Spool: failed to close segment")
+		}
+		name := fmt.Sprintf("%s%020d%s", spoolSegmentPrefix, q.nextSeq, spoolSegmentSuffix)
+		f, err := os.OpenFile(filepath.Join(q.dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open spool segment: %w", err)
+		}
+		q.file = f
+		q.segments = append(q.segments, spoolSegment{name: name, first: q.nextSeq, last: q.nextSeq, created: now})
+		n++
+	}
+	// One unbuffered write per entry: a crash tears at most this line,
+	// which load skips.
+	if _, err := q.file.Write(line); err != nil {
+		// Don't append to a possibly torn line; the next payload starts
+		// a new segment.
+		_ = q.closeFile()
+		return fmt.Errorf("failed to write spool segment: %w", err)
+	}
+	seg := &q.segments[n-1]
+	seg.last = q.nextSeq
+	seg.bytes += int64(len(line))
+	s.total += int64(len(line))
+	q.nextSeq++
+	s.evictLocked()
+	q.trimLocked()
+	return nil
+}
+
+// trimLocked drops the oldest payloads while more than opts.maxEntries are
+// queued. Their lines stay on disk until the drainer passes the segment.
+func (q *spoolQueue) trimLocked() {
+	over := q.depthLocked() - q.opts.maxEntries
+	if q.opts.maxEntries <= 0 || over <= 0 {
+		return
+	}
+	q.advanceLocked(q.cursor + uint64(over))
+	q.spool.logger.WithFields(logrus.Fields{
+		"destination": q.name,
+		"dropped":     over,
+	}).Debug("Spool queue full – dropped the oldest payloads")
+}
+
+// evictLocked drops the oldest segments, across all destinations, while the
+// spool is over its budget.
+func (s *Spool) evictLocked() {
+	for s.total > s.maxBytes {
+		var oldest *spoolQueue
+		for _, q := range s.queues {
+			if len(q.segments) > 0 && (oldest == nil || q.segments[0].created.Before(oldest.segments[0].created)) {
+				oldest = q
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		seg := oldest.segments[0]
+		dropped := 0
+		if oldest.cursor <= seg.last {
+			dropped = int(seg.last + 1 - max(seg.first, oldest.cursor))
+		}
+		if len(oldest.segments) == 1 {
+			if err := oldest.closeFile(); err != nil {
+				s.logger.WithError(err).Warn("Spool: failed to close segment")
+			}
+		}
+		oldest.removeHeadSegmentLocked()
+		if dropped > 0 {
+			oldest.advanceLocked(seg.last + 1)
+			s.logger.WithFields(logrus.Fields{
+				"destination": oldest.name,
+				"dropped":     dropped,
+			}).Warn("Spool over its size limit – dropped the oldest payloads")
+		}
+	}
+}
+
+// removeHeadSegmentLocked deletes segments[0].
+func (q *spoolQueue) removeHeadSegmentLocked() {
+	seg := q.segments[0]
+	if err := os.Remove(filepath.Join(q.dir, seg.name)); err != nil && !os.IsNotExist(err) {
+		q.spool.logger.WithError(err).WithField("destination", q.name).Warn("Spool: failed to remove segment")
+	}
+	q.spool.total -= seg.bytes
+	q.segments = q.segments[1:]
+}
+
+// advanceLocked moves the cursor to seq and persists it.
+func (q *spoolQueue) advanceLocked(seq uint64) {
+	seq = min(seq, q.nextSeq) // a segment whose last write failed claims one more
+	if seq <= q.cursor {
+		return
+	}
+	q.cursor = seq
+	if q.depthLocked() == 0 {
+		q.lastErr = nil
+	}
+	if err := config.WriteFileAtomic(filepath.Join(q.dir, spoolCursorFile), []byte(strconv.FormatUint(seq, 10))); err != nil {
+		q.spool.logger.WithError(err).WithField("destination", q.name).Warn("Spool: failed to save cursor")
+	}
+}
+
+// drain replays the queue until the spool is closed.
+func (q *spoolQueue) drain() {
+	s := q.spool
+	defer s.wg.Done()
+	backoff := spoolInitialBackoff
+	for {
+		entry, ok := q.next()
+		if !ok {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-q.wake:
+				continue
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(s.ctx, spoolDeliverTimeout)
+		err := q.deliver(ctx, entry.P)
+		cancel()
+		if s.ctx.Err() != nil {
+			return // not the payload's fault; it is replayed next run
+		}
+		if err == nil {
+			q.ack(entry.Seq, nil)
+			backoff = spoolInitialBackoff
+			continue
+		}
+
+		s.mu.Lock()
+		q.lastErr = err
+		s.mu.Unlock()
+		if isSpoolRejection(err) {
+			if q.attemptSeq != entry.Seq {
+				q.attemptSeq, q.attempts = entry.Seq, 0
+			}
+			if q.attempts++; q.attempts >= s.maxAttempts {
+				s.logger.WithError(err).WithFields(logrus.Fields{
+					"destination": q.name,
+					"attempts":    q.attempts,
+					"spooled_at":  time.UnixMilli(entry.T).Format(time.RFC3339),
+				}).Warn("Spooled payload rejected too often – dropping it")
+				q.ack(entry.Seq, err)
+				continue
+			}
+		}
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"destination": q.name,
+			"queued":      q.depth(),
+		}).Debugf("Spool replay failed – next attempt in %s", backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, spoolMaxBackoff)
+	}
+}
+
+// next returns the oldest undelivered entry, reading the head segment when
+// the entries read before are used up.
+func (q *spoolQueue) next() (spoolEntry, bool) {
+	s := q.spool
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if len(q.segments) == 0 || q.headLoaded != q.segments[0].name {
+			q.head, q.headLoaded = nil, "" // evicted under us
+		}
+		for len(q.head) > 0 && q.head[0].Seq < q.cursor {
+			q.head = q.head[1:]
+		}
+		if len(q.head) > 0 {
+			return q.head[0], true
+		}
+		if q.depthLocked() == 0 || len(q.segments) == 0 {
+			return spoolEntry{}, false
+		}
+
+		seg := q.segments[0]
+		if q.headLoaded == seg.name || seg.last < q.cursor {
+			// Delivered (or unreadable) to the end: the segment is done.
+			if len(q.segments) == 1 {
+				if err := q.closeFile(); err != nil {
+					s.logger.WithError(err).Warn("Spool: failed to close segment")
+				}
+			}
+			q.removeHeadSegmentLocked()
+			q.advanceLocked(seg.last + 1)
+			q.headLoaded = ""
+			continue
+		}
+		if len(q.segments) == 1 && q.file != nil {
+			// Seal the segment being written so what is read is complete;
+			// the next payload starts a new one.
+			if err := q.closeFile(); err != nil {
+				s.logger.WithError(err).Warn("Spool: failed to close segment")
+			}
+		}
+		entries, err := readSpoolSegment(filepath.Join(q.dir, seg.name))
+		if err != nil {
+			s.logger.WithError(err).WithField("destination", q.name).Warn("Spool: unreadable segment skipped")
+		}
+		q.head, q.headLoaded = nil, seg.name
+		for _, e := range entries {
+			if e.Seq >= q.cursor {
+				q.head = append(q.head, e)
+			}
+		}
+	}
+}
+
+// ack marks seq delivered, or dropped because of err.
+func (q *spoolQueue) ack(seq uint64, err error) {
+	q.spool.mu.Lock()
+	defer q.spool.mu.Unlock()
+	q.lastErr = err
+	q.advanceLocked(seq + 1)
+}
+
+// load restores the segments and cursor left by an earlier run. Every
+// segment is sealed: new payloads go to a fresh one, so a line torn by a
+// crash is never appended to.
+func (q *spoolQueue) load() error {
+	if err := os.MkdirAll(q.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	names, err := filepath.Glob(filepath.Join(q.dir, spoolSegmentPrefix+"*"+spoolSegmentSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names) // zero-padded sequence numbers sort in order
+
+	cursorKnown := false
+	if data, err := os.ReadFile(filepath.Join(q.dir, spoolCursorFile)); err == nil {
+		if seq, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			q.cursor, cursorKnown = seq, true
+		}
+	}
+
+	for _, path := range names {
+		entries, err := readSpoolSegment(path)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat spool segment: %w", err)
+		}
+		if len(entries) == 0 || entries[len(entries)-1].Seq < q.cursor {
+			_ = os.Remove(path) // delivered, or nothing readable in it
+			continue
+		}
+		seg := spoolSegment{
+			name:    filepath.Base(path),
+			first:   entries[0].Seq,
+			last:    entries[len(entries)-1].Seq,
+			bytes:   info.Size(),
+			created: time.UnixMilli(entries[0].T),
+		}
+		if !cursorKnown {
+			q.cursor, cursorKnown = seg.first, true
+		}
+		q.segments = append(q.segments, seg)
+		q.nextSeq = seg.last + 1
+	}
+	if q.nextSeq < q.cursor {
+		q.nextSeq = q.cursor
+	}
+	return nil
+}
+
+// readSpoolSegment returns the entries of a segment; lines that don't parse
+// (a write torn by a crash) are skipped.
+func readSpoolSegment(path string) ([]spoolEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool segment: %w", err)
+	}
+	var entries []spoolEntry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for sc.Scan() {
+		var e spoolEntry
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+func (q *spoolQueue) closeFile() error {
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Sync()
+	if closeErr := q.file.Close(); err == nil {
+		err = closeErr
+	}
+	q.file = nil
+	return err
+}
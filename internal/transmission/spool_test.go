@@ -0,0 +1,145 @@
+package transmission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a spool destination that fails while down and records what
+// it accepted, in order.
+type recorder struct {
+	mu   sync.Mutex
+	down bool
+	got  []string
+}
+
+func (r *recorder) deliver(_ context.Context, payload []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.down {
+		return errors.New("unreachable")
+	}
+	r.got = append(r.got, string(payload))
+	return nil
+}
+
+func (r *recorder) setDown(down bool) {
+	r.mu.Lock()
+	r.down = down
+	r.mu.Unlock()
+}
+
+func (r *recorder) delivered() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.got...)
+}
+
+func openTestSpool(t *testing.T, dir string) *Spool {
+	t.Helper()
+	s, err := OpenSpool(dir, 1<<20, 3, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func closeTestSpool(t *testing.T, s *Spool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpoolSendBehindBacklog(t *testing.T) {
+	tests := []struct {
+		name       string
+		liveFirst  bool
+		wantQueued bool
+		wantFirst  []string // delivered right away, before the drainer's backoff ends
+	}{
+		{"in order", false, true, nil},
+		{"live first", true, false, []string{"live"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{down: true}
+			s := openTestSpool(t, t.TempDir())
+			defer closeTestSpool(t, s)
+			q, err := s.queue("dest", r.deliver, spoolQueueOptions{liveFirst: tt.liveFirst})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			queued, err := q.send(context.Background(), []byte("old"))
+			if !queued || !errors.Is(err, ErrSpooled) {
+				t.Fatalf("send while down: queued=%v err=%v, want spooled", queued, err)
+			}
+			// The drainer's first retry is spoolInitialBackoff away.
+			r.setDown(false)
+			queued, err = q.send(context.Background(), []byte("live"))
+			if queued != tt.wantQueued || errors.Is(err, ErrSpooled) != tt.wantQueued {
+				t.Errorf("send after recovery: queued=%v err=%v, want queued=%v", queued, err, tt.wantQueued)
+			}
+			if got := r.delivered(); fmt.Sprint(got) != fmt.Sprint(tt.wantFirst) {
+				t.Errorf("delivered %v, want %v", got, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestSpoolMaxEntries(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+		reopenMax  int // limit after a restart
+		sent       int
+		wantDepth  int
+		wantReplay []string
+	}{
+		{"unlimited", 0, 0, 4, 4, []string{"p0", "p1", "p2", "p3"}},
+		{"under the limit", 5, 5, 4, 4, []string{"p0", "p1", "p2", "p3"}},
+		{"oldest dropped", 2, 2, 4, 2, []string{"p2", "p3"}},
+		{"limit lowered on restart", 3, 1, 4, 3, []string{"p3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			r := &recorder{down: true}
+			s := openTestSpool(t, dir)
+			q, err := s.queue("dest", r.deliver, spoolQueueOptions{maxEntries: tt.maxEntries})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.sent; i++ {
+				q.send(context.Background(), []byte(fmt.Sprintf("p%d", i)))
+			}
+			if got := q.depth(); got != tt.wantDepth {
+				t.Errorf("depth = %d, want %d", got, tt.wantDepth)
+			}
+			closeTestSpool(t, s)
+
+			// Replay after a restart, with the destination back.
+			r.setDown(false)
+			s = openTestSpool(t, dir)
+			defer closeTestSpool(t, s)
+			q, err = s.queue("dest", r.deliver, spoolQueueOptions{maxEntries: tt.reopenMax})
+			if err != nil {
+				t.Fatal(err)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for q.depth() > 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if got := r.delivered(); fmt.Sprint(got) != fmt.Sprint(tt.wantReplay) {
+				t.Errorf("replayed %v, want %v", got, tt.wantReplay)
+			}
+		})
+	}
+}
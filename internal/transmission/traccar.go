@@ -0,0 +1,209 @@
+package transmission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/location"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	traccarQueueSize      = 100
+	traccarRequestTimeout = 10 * time.Second
+	msToKnots             = 1.943844
+	kmhToKnots            = 1 / 1.852
+)
+
+// TraccarTransmitter reports GPS fixes to a Traccar server using the OsmAnd
+// protocol (GET /?id=…&lat=…&lon=…). A fix is only sent when it is new and the
+// car moved at least minDistance metres since the last reported position, so
+// a parked car doesn't fill the Traccar history. Points that could not be
+// delivered are queued (up to traccarQueueSize, oldest dropped) and sent ahead
+// of the next fix.
+type TraccarTransmitter struct {
+	serverURL   string
+	deviceID    string
+	minDistance float64
+	httpClient  *http.Client
+	logger      *logrus.Logger
+
+	mu      sync.Mutex
+	queue   []url.Values
+	lastFix time.Time
+	lastLat float64
+	lastLon float64
+	havePos bool
+	lastErr error
+	// queued mirrors len(queue) so Buffered never waits for a send.
+	queued atomic.Int64
+
+	guard closeGuard
+}
+
+// NewTraccarTransmitter creates a transmitter for the OsmAnd endpoint at
+// serverURL (typically http://traccar:5055). deviceID is the Traccar device
+// identifier.
+func NewTraccarTransmitter(serverURL, deviceID string, minDistance float64, logger *logrus.Logger) (*TraccarTransmitter, error) {
+	if _, err := url.Parse(serverURL); err != nil {
+		return nil, fmt.Errorf("invalid Traccar URL: %w", err)
+	}
+	if deviceID == "" {
+		return nil, errors.New("a Traccar device ID is required")
+	}
+	return &TraccarTransmitter{
+		serverURL:   strings.TrimRight(serverURL, "/") + "/",
+		deviceID:    deviceID,
+		minDistance: minDistance,
+		httpClient:  &http.Client{Timeout: traccarRequestTimeout},
+		logger:      logger,
+	}, nil
+}
+
+// SetTransport implements TransportSetter.
+func (t *TraccarTransmitter) SetTransport(rt http.RoundTripper) {
+	t.httpClient.Transport = rt
+}
+
+// Transmit sends the current fix if it qualifies, preceded by any queued
+// points.
+func (t *TraccarTransmitter) Transmit(ctx context.Context, data *sensors.SensorData) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer func() { t.queued.Store(int64(len(t.queue))) }()
+
+	if loc := data.Location; loc != nil && loc.Provider != "default" && loc.Timestamp.After(t.lastFix) {
+		t.lastFix = loc.Timestamp
+		if !t.havePos || location.DistanceMeters(t.lastLat, t.lastLon, loc.Latitude, loc.Longitude) >= t.minDistance {
+			t.lastLat, t.lastLon, t.havePos = loc.Latitude, loc.Longitude, true
+			t.queue = append(t.queue, t.point(data, loc))
+			if over := len(t.queue) - traccarQueueSize; over > 0 {
+				t.queue = t.queue[over:]
+				t.logger.WithField("dropped", over).Debug("Traccar queue full – dropped oldest points")
+			}
+		}
+	}
+
+	for len(t.queue) > 0 {
+		if err := t.send(ctx, t.queue[0]); err != nil {
+			if t.lastErr == nil {
+				t.logger.WithError(err).Warn("Traccar unreachable – queueing points")
+			}
+			t.lastErr = err
+			return fmt.Errorf("Traccar send failed (%d points queued): %w", len(t.queue), err)
+		}
+		t.queue = t.queue[1:]
+		if t.lastErr != nil {
+			t.logger.Info("Traccar connection restored")
+			t.lastErr = nil
+		}
+	}
+	return nil
+}
+
+// Name implements Transmitter.
+func (t *TraccarTransmitter) Name() string { return "Traccar" }
+
+// Check implements Checker. The OsmAnd endpoint answers any request, so a
+// response of any status proves the server is reachable.
+func (t *TraccarTransmitter) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.serverURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create Traccar request: %w", err)
+	}
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Traccar unreachable: %w", err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// Buffered implements BufferReporter: the points awaiting delivery.
+func (t *TraccarTransmitter) Buffered() int { return int(t.queued.Load()) }
+
+// IsConnected reports whether the last send succeeded.
+func (t *TraccarTransmitter) IsConnected() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastErr == nil
+}
+
+// Close tries to deliver the queued points until ctx expires; whatever is
+// left is dropped.
+func (t *TraccarTransmitter) Close(ctx context.Context) error {
+	return t.guard.close(func() error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		defer func() { t.queued.Store(int64(len(t.queue))) }()
+		for len(t.queue) > 0 && ctx.Err() == nil {
+			if err := t.send(ctx, t.queue[0]); err != nil {
+				t.logger.WithError(err).WithField("dropped", len(t.queue)).Warn("Discarding queued Traccar points on shutdown")
+				return err
+			}
+			t.queue = t.queue[1:]
+		}
+		return nil
+	})
+}
+
+// point builds the OsmAnd query for one fix. Speed is in knots as the
+// protocol expects: GPS speed (m/s) when available, else the car's km/h.
+func (t *TraccarTransmitter) point(data *sensors.SensorData, loc *location.LocationData) url.Values {
+	q := url.Values{}
+	q.Set("id", t.deviceID)
+	q.Set("timestamp", strconv.FormatInt(loc.Timestamp.Unix(), 10))
+	q.Set("lat", strconv.FormatFloat(loc.Latitude, 'f', 6, 64))
+	q.Set("lon", strconv.FormatFloat(loc.Longitude, 'f', 6, 64))
+
+	speed := loc.Speed * msToKnots
+	if speed == 0 && data.Speed != nil {
+		speed = *data.Speed * kmhToKnots
+	}
+	q.Set("speed", strconv.FormatFloat(speed, 'f', 1, 64))
+	q.Set("bearing", strconv.FormatFloat(loc.Bearing, 'f', 0, 64))
+	q.Set("altitude", strconv.FormatFloat(loc.Altitude, 'f', 0, 64))
+	if loc.Accuracy > 0 {
+		q.Set("accuracy", strconv.FormatFloat(loc.Accuracy, 'f', 0, 64))
+	}
+	if data.BatteryPercentage != nil {
+		q.Set("batt", strconv.FormatFloat(*data.BatteryPercentage, 'f', 0, 64))
+	}
+	return q
+}
+
+func (t *TraccarTransmitter) send(ctx context.Context, q url.Values) error {
+	ctx, cancel := context.WithTimeout(ctx, traccarRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.serverURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create Traccar request: %w", err)
+	}
+	req.Header.Set("User-Agent", "byd-hass/1.0.0")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Traccar request failed: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Traccar returned status %d", resp.StatusCode)
+	}
+	return nil
+}
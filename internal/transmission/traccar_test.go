@@ -0,0 +1,110 @@
+package transmission
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/location"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+func TestTraccarTransmit(t *testing.T) {
+	var mu sync.Mutex
+	var received []string // lat,lon of every delivered point
+	down := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		q := r.URL.Query()
+		received = append(received, q.Get("lat")+","+q.Get("lon"))
+	}))
+	defer srv.Close()
+
+	tx, err := NewTraccarTransmitter(srv.URL, "car", 50, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		name     string
+		second   int // fix timestamp
+		lat      float64
+		provider string
+		down     bool
+		wantErr  bool
+		want     []string // delivered by this step
+	}{
+		{"first fix", 1, 59.9, "gps", false, false, []string{"59.900000,10.750000"}},
+		{"same fix again", 1, 59.91, "gps", false, false, nil},
+		{"moved 5 m", 2, 59.90005, "gps", false, false, nil},
+		{"queued while down", 3, 59.91, "gps", true, true, nil},
+		{"queue sent first", 4, 59.92, "gps", false, false, []string{"59.910000,10.750000", "59.920000,10.750000"}},
+		{"default location", 5, 59.93, "default", false, false, nil},
+	}
+	for _, st := range steps {
+		mu.Lock()
+		down, received = st.down, nil
+		mu.Unlock()
+		err := tx.Transmit(context.Background(), &sensors.SensorData{Location: &location.LocationData{
+			Latitude: st.lat, Longitude: 10.75, Provider: st.provider, Timestamp: start.Add(time.Duration(st.second) * time.Second),
+		}})
+		if (err != nil) != st.wantErr {
+			t.Errorf("%s: err = %v, want error %v", st.name, err, st.wantErr)
+		}
+		if tx.IsConnected() == st.wantErr {
+			t.Errorf("%s: IsConnected() = %v", st.name, tx.IsConnected())
+		}
+		mu.Lock()
+		if fmt.Sprint(received) != fmt.Sprint(st.want) {
+			t.Errorf("%s: delivered %q, want %q", st.name, received, st.want)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestTraccarPoint(t *testing.T) {
+	tx, err := NewTraccarTransmitter("http://traccar:5055", "car", 0, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kmh, soc := 92.6, 80.4
+	tests := []struct {
+		name string
+		data *sensors.SensorData
+		loc  location.LocationData
+		want string
+	}{
+		{
+			"GPS speed",
+			&sensors.SensorData{BatteryPercentage: &soc},
+			location.LocationData{Latitude: 59.9, Longitude: 10.75, Speed: 10, Bearing: 90.4, Altitude: 12.6, Accuracy: 4, Timestamp: time.Unix(1714557600, 0)},
+			"accuracy=4&altitude=13&batt=80&bearing=90&id=car&lat=59.900000&lon=10.750000&speed=19.4&timestamp=1714557600",
+		},
+		{
+			"car speed without GPS speed",
+			&sensors.SensorData{Speed: &kmh},
+			location.LocationData{Latitude: 59.9, Longitude: 10.75, Timestamp: time.Unix(1714557600, 0)},
+			"altitude=0&bearing=0&id=car&lat=59.900000&lon=10.750000&speed=50.0&timestamp=1714557600",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tx.point(tt.data, &tt.loc).Encode(); got != tt.want {
+				t.Errorf("point = %s\nwant    %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewTraccarTransmitter("http://traccar:5055", "", 0, quietLogger()); err == nil {
+		t.Error("empty device ID accepted")
+	}
+}
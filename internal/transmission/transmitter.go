@@ -1,9 +1,79 @@
 package transmission
 
-import "github.com/Allthebester/byd-hass/internal/sensors"
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// ErrClosed is returned by Transmit once the transmitter has been closed.
+var ErrClosed = errors.New("transmitter closed")
 
 // Transmitter defines the interface for transmitting sensor data
 type Transmitter interface {
-	Transmit(data *sensors.SensorData) error
+	// Transmit delivers one snapshot. Network I/O must give up when ctx is
+	// cancelled or its deadline passes. data is shared with the other
+	// transmitters, which run concurrently, and must not be modified; the
+	// collector builds a new snapshot every cycle.
+	Transmit(ctx context.Context, data *sensors.SensorData) error
 	IsConnected() bool
+	// Name identifies the transmitter in logs, metrics and diagnostics.
+	Name() string
+	// Close flushes what is pending and releases the transmitter's
+	// resources, giving up when ctx expires. It is safe to call more than
+	// once; Transmit returns ErrClosed afterwards.
+	Close(ctx context.Context) error
+}
+
+// BufferReporter is implemented by transmitters that queue undelivered data;
+// Buffered returns the number of queued items.
+type BufferReporter interface {
+	Buffered() int
+}
+
+// Checker is implemented by transmitters that can verify their destination
+// without sending data. Check reports why the destination is unusable, e.g.
+// unreachable or rejecting the credentials; it is used by the startup
+// self-test.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Connector is implemented by transmitters that have to reach their server
+// before they can transmit. Connect gives up when ctx is done and may be
+// called again after a failure; see app.ConnectOutputs.
+type Connector interface {
+	Transmitter
+	Connect(ctx context.Context) error
+}
+
+// UnitSetter is implemented by the transmitters that publish to Home
+// Assistant; SetUnits selects "metric", "imperial" or units.Auto.
+type UnitSetter interface {
+	SetUnits(setting string)
+}
+
+// closeGuard makes Close idempotent and lets Transmit refuse work once the
+// transmitter is closed.
+type closeGuard struct {
+	once   sync.Once
+	closed atomic.Bool
+	err    error
+}
+
+func (g *closeGuard) isClosed() bool {
+	return g.closed.Load()
+}
+
+// close marks the transmitter closed and runs fn the first time only; every
+// call returns fn's result.
+func (g *closeGuard) close(fn func() error) error {
+	g.once.Do(func() {
+		g.closed.Store(true)
+		g.err = fn()
+	})
+	return g.err
 }
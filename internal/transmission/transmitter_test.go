@@ -0,0 +1,89 @@
+package transmission
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/mqtt"
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+func TestCloseGuard(t *testing.T) {
+	var g closeGuard
+	calls := 0
+	fail := errors.New("flush failed")
+	for i := 0; i < 3; i++ {
+		if err := g.close(func() error { calls++; return fail }); err != fail {
+			t.Errorf("close #%d = %v, want %v", i+1, err, fail)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("close ran its cleanup %d times, want once", calls)
+	}
+	if !g.isClosed() {
+		t.Error("guard not closed after close")
+	}
+}
+
+// TestTransmitterClose checks every transmitter that can be built offline:
+// Close may be called twice and Transmit fails with ErrClosed afterwards.
+func TestTransmitterClose(t *testing.T) {
+	logger := quietLogger()
+	tests := []struct {
+		name string
+		open func(t *testing.T) (Transmitter, error)
+	}{
+		{"abrp", func(*testing.T) (Transmitter, error) {
+			return NewABRPTransmitter("key", []string{"token"}, logger), nil
+		}},
+		{"csv", func(t *testing.T) (Transmitter, error) {
+			return NewCSVTransmitter(t.TempDir(), "daily", 0, logger)
+		}},
+		{"mqtt", func(*testing.T) (Transmitter, error) {
+			return NewMQTTTransmitter(mqtt.NewDryRunClient("test", logger), "test", "homeassistant", logger), nil
+		}},
+		{"webhook", func(*testing.T) (Transmitter, error) {
+			return NewWebhookTransmitter("http://127.0.0.1:1/hook", "", "test", WebhookModeEvery, "", "", time.Second, logger)
+		}},
+		{"hass rest", func(*testing.T) (Transmitter, error) {
+			return NewHARESTTransmitter("http://127.0.0.1:1", "token", "test", 1, 1, logger)
+		}},
+		{"traccar", func(*testing.T) (Transmitter, error) {
+			return NewTraccarTransmitter("http://127.0.0.1:1", "test", 0, logger)
+		}},
+		{"influx", func(*testing.T) (Transmitter, error) {
+			return NewInfluxTransmitter("http://127.0.0.1:1", "org", "bucket", "token", "test", nil, 0, 0, logger)
+		}},
+		{"history", func(t *testing.T) (Transmitter, error) {
+			return NewHistoryBuffer(t.TempDir(), time.Hour, 1<<20, logger)
+		}},
+		{"websocket", func(*testing.T) (Transmitter, error) {
+			return NewWebSocketTransmitter("127.0.0.1:0", logger)
+		}},
+		{"evcc", func(*testing.T) (Transmitter, error) {
+			return NewEVCCServer("127.0.0.1:0", time.Minute, "", "", logger)
+		}},
+		{"prometheus", func(*testing.T) (Transmitter, error) {
+			return NewPrometheusExporter("127.0.0.1:0", logger)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := tt.open(t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			first := tx.Close(ctx)
+			if second := tx.Close(ctx); second != first {
+				t.Errorf("second Close = %v, want %v", second, first)
+			}
+			speed := 42.0
+			if err := tx.Transmit(context.Background(), &sensors.SensorData{Timestamp: time.Now(), Speed: &speed}); !errors.Is(err, ErrClosed) {
+				t.Errorf("Transmit after Close = %v, want ErrClosed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package transmission
+
+import (
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/Allthebester/byd-hass/internal/units"
+)
+
+// publishedValues flattens the non-nil SensorData fields that are allowed to
+// leave the application (see sensors.PublishedSensorIDs) into a map keyed by
+// their snake_case JSON name. Every output that exposes raw sensor values
+// shares this helper so the allow-list is applied consistently.
+func publishedValues(data *sensors.SensorData) map[string]interface{} {
+	values := make(map[string]interface{})
+	if data == nil {
+		return values
+	}
+
+	// Pre-compute allowed entityIDs in snake_case for quick filtering
+	allowed := make(map[string]struct{}, len(sensors.PublishedSensorIDs()))
+	for _, id := range sensors.PublishedSensorIDs() {
+		if def := sensors.GetSensorByID(id); def != nil {
+			allowed[sensors.ToSnakeCase(def.FieldName)] = struct{}{}
+		}
+	}
+
+	v := reflect.ValueOf(data).Elem()
+	tOf := v.Type()
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+
+		// Skip unexported fields or fields that are nil
+		if !field.CanInterface() || (field.Kind() == reflect.Ptr && field.IsNil()) {
+			continue
+		}
+
+		jsonTag := tOf.Field(i).Tag.Get("json")
+		jsonKey := strings.Split(jsonTag, ",")[0]
+
+		if jsonKey == "" || jsonKey == "-" {
+			continue
+		}
+
+		if _, ok := allowed[jsonKey]; !ok {
+			continue // not in the publish allow-list
+		}
+
+		// Dereference pointer to get the actual value
+		var value interface{}
+		if field.Kind() == reflect.Ptr {
+			value = field.Elem().Interface()
+		} else {
+			value = field.Interface()
+		}
+		values[jsonKey] = value
+	}
+	return values
+}
+
+// precisionKeys maps the snake_case key of every sensor with a precision
+// (see sensors.Precisions), and of its smoothed variant, to its number of
+// decimals.
+func precisionKeys() map[string]int {
+	keys := make(map[string]int, 2*len(sensors.Precisions))
+	for id, p := range sensors.Precisions {
+		if def := sensors.GetSensorByID(id); def != nil {
+			keys[sensors.ToSnakeCase(def.FieldName)] = p
+			keys[sensors.ToSnakeCase(def.FieldName)+"_smoothed"] = p
+		}
+	}
+	return keys
+}
+
+// precisionOf returns the precision of sensor id, or nil.
+func precisionOf(id int) *int {
+	if p, ok := sensors.PrecisionFor(id); ok {
+		return &p
+	}
+	return nil
+}
+
+// roundValues rounds the numeric sensor values in values to their precision.
+// Run it after unit conversion and before comparing payloads, so a deadband
+// sees the published numbers; labels and other strings are left alone.
+func roundValues(values map[string]interface{}) {
+	for key, p := range precisionKeys() {
+		if v, ok := values[key].(float64); ok {
+			values[key] = units.Round(v, p)
+		}
+	}
+}
+
+// labelValues replaces the values of enum-style sensors (see
+// sensors.ValueMaps) in values with their labels. A value without a label is
+// removed, so Home Assistant shows the enum as unknown instead of rejecting
+// the state.
+func labelValues(values map[string]interface{}) {
+	for id, m := range sensors.ValueMaps {
+		def := sensors.GetSensorByID(id)
+		if def == nil {
+			continue
+		}
+		key := sensors.ToSnakeCase(def.FieldName)
+		v, ok := values[key].(float64)
+		if !ok {
+			continue
+		}
+		if label, ok := m.Label(v); ok {
+			values[key] = label
+		} else {
+			delete(values, key)
+		}
+	}
+}
+
+// publishedEventTimeSensors returns the published timestamp sensors (see
+// sensors.EventTimeSensorIDs).
+func publishedEventTimeSensors() []*sensors.SensorDefinition {
+	published := sensors.PublishedSensorIDs()
+	var defs []*sensors.SensorDefinition
+	for _, id := range sensors.EventTimeSensorIDs() {
+		if !slices.Contains(published, id) {
+			continue
+		}
+		if def := sensors.GetSensorByID(id); def != nil {
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
+
+// eventTimeValues replaces the raw timestamp sensors in values with ISO-8601
+// times, as Home Assistant's timestamp device class expects, and adds the
+// seconds elapsed since each (see sensors.EventAgeKey). A timestamp without a
+// plausible time is removed.
+func eventTimeValues(values map[string]interface{}, data *sensors.SensorData) {
+	for _, def := range publishedEventTimeSensors() {
+		key := sensors.ToSnakeCase(def.FieldName)
+		if _, ok := values[key]; !ok {
+			continue
+		}
+		t, ok := data.EventTimes[key]
+		if !ok {
+			delete(values, key)
+			continue
+		}
+		values[key] = t.Format(time.RFC3339)
+		values[sensors.EventAgeKey(key)] = math.Round(sensors.EventAge(data, t).Seconds())
+	}
+}
@@ -0,0 +1,351 @@
+package transmission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/sirupsen/logrus"
+)
+
+// Webhook send modes (BYD_HASS_WEBHOOK_MODE).
+const (
+	WebhookModeEvery  = "every"  // POST on every scheduler cycle
+	WebhookModeChange = "change" // POST only when a published value changed
+	WebhookModeRules  = "rules"  // POST only when a rule becomes true
+)
+
+const (
+	webhookMaxAttempts    = 3
+	webhookInitialBackoff = 1 * time.Second
+)
+
+// WebhookPayload is the data available to a custom body template and, without
+// one, the JSON body itself. Sensors is a map so encoding/json emits its keys
+// in sorted order, keeping the body stable for downstream diffing.
+type WebhookPayload struct {
+	DeviceID  string                 `json:"device_id"`
+	Timestamp time.Time              `json:"timestamp"`
+	Sensors   map[string]interface{} `json:"sensors"`
+	// Triggered lists the rules that just became true (rules mode only).
+	Triggered []string `json:"triggered,omitempty"`
+}
+
+// WebhookTransmitter POSTs the published sensor values as JSON to a custom
+// endpoint. 5xx responses and network errors are retried with back-off, or
+// handed to the spool when one is set; any failure marks the transmitter
+// disconnected until the next success.
+type WebhookTransmitter struct {
+	name       string // "" for the unnamed webhook (see SetName)
+	url        string
+	token      string
+	deviceID   string
+	mode       string
+	tmpl       *template.Template
+	httpClient *http.Client
+	logger     *logrus.Logger
+
+	healthy uint32
+
+	rules []webhookRule
+
+	mu         sync.Mutex
+	lastSent   map[string]interface{}
+	ruleStates []bool // last known outcome per rule
+	ruleKnown  []bool // whether the rule has been evaluated yet
+
+	spool *spoolQueue // undelivered bodies; nil = give up after the retries
+
+	guard closeGuard
+}
+
+// NewWebhookTransmitter creates a webhook transmitter. token is sent as a
+// bearer token when non-empty. bodyTemplate is an optional text/template
+// rendered with a WebhookPayload; it may use the "json" function to embed
+// values, e.g. {"car":"{{.DeviceID}}","data":{{json .Sensors}}}. Non-empty
+// rules (see parseWebhookRules) switch the transmitter to rules mode: it
+// then only POSTs when a rule turns true.
+func NewWebhookTransmitter(url, token, deviceID, mode, bodyTemplate, rules string, timeout time.Duration, logger *logrus.Logger) (*WebhookTransmitter, error) {
+	var parsed []webhookRule
+	if strings.TrimSpace(rules) != "" {
+		var err error
+		if parsed, err = parseWebhookRules(rules); err != nil {
+			return nil, err
+		}
+		mode = WebhookModeRules
+	}
+	switch mode {
+	case WebhookModeEvery, WebhookModeChange:
+	case WebhookModeRules:
+		if len(parsed) == 0 {
+			return nil, fmt.Errorf("webhook mode %s needs rules", WebhookModeRules)
+		}
+	default:
+		return nil, fmt.Errorf("unknown webhook mode %q (supported: %s, %s, %s)", mode, WebhookModeEvery, WebhookModeChange, WebhookModeRules)
+	}
+
+	t := &WebhookTransmitter{
+		url:        url,
+		token:      token,
+		deviceID:   deviceID,
+		mode:       mode,
+		rules:      parsed,
+		httpClient: &http.Client{Timeout: timeout},
+		logger:     logger,
+		ruleStates: make([]bool, len(parsed)),
+		ruleKnown:  make([]bool, len(parsed)),
+	}
+
+	if bodyTemplate != "" {
+		tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+		}).Parse(bodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook template: %w", err)
+		}
+		t.tmpl = tmpl
+	}
+	return t, nil
+}
+
+// SetTransport implements TransportSetter.
+func (t *WebhookTransmitter) SetTransport(rt http.RoundTripper) {
+	t.httpClient.Transport = rt
+}
+
+// SendsUnchanged reports whether the scheduler should call Transmit even when
+// the snapshot did not change.
+func (t *WebhookTransmitter) SendsUnchanged() bool {
+	return t.mode == WebhookModeEvery
+}
+
+// Transmit POSTs the published values of data.
+func (t *WebhookTransmitter) Transmit(ctx context.Context, data *sensors.SensorData) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
+	values := publishedValues(data)
+	payload := WebhookPayload{DeviceID: t.deviceID, Timestamp: data.Timestamp.UTC(), Sensors: values}
+
+	var states, known []bool
+	switch t.mode {
+	case WebhookModeChange:
+		t.mu.Lock()
+		unchanged := t.lastSent != nil && reflect.DeepEqual(t.lastSent, values)
+		t.mu.Unlock()
+		if unchanged {
+			return nil
+		}
+	case WebhookModeRules:
+		payload.Triggered, states, known = t.evaluateRules(data)
+		if len(payload.Triggered) == 0 {
+			t.commitRules(states, known)
+			return nil
+		}
+	}
+
+	body, err := t.render(payload)
+	if err != nil {
+		return err
+	}
+
+	var queued bool
+	if t.spool != nil {
+		queued, err = t.spool.send(ctx, body)
+	} else {
+		err = t.postWithRetry(ctx, body)
+	}
+	if err != nil {
+		atomic.StoreUint32(&t.healthy, 0)
+		if !queued {
+			// Rule states are not committed, so a rule that still holds
+			// fires again on the next cycle.
+			return err
+		}
+	} else if !queued && atomic.SwapUint32(&t.healthy, 1) == 0 {
+		t.logger.Debug("Webhook delivery succeeded")
+	}
+
+	// A spooled body is delivered later; count it as sent so the same change
+	// is not queued twice.
+	t.mu.Lock()
+	t.lastSent = values
+	t.mu.Unlock()
+	if t.mode == WebhookModeRules {
+		t.commitRules(states, known)
+	}
+	return err
+}
+
+// evaluateRules returns the rules that turned true since the last committed
+// evaluation, along with the new rule states. A rule is only evaluated once
+// its sensor has a value; the first evaluation sets the baseline and never
+// fires, so a low SOC at startup is not reported as a transition.
+func (t *WebhookTransmitter) evaluateRules(data *sensors.SensorData) (triggered []string, states, known []bool) {
+	values, labelled := ruleValues(data)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	states = append([]bool(nil), t.ruleStates...)
+	known = append([]bool(nil), t.ruleKnown...)
+	for i, r := range t.rules {
+		match, ok := r.eval(values, labelled)
+		if !ok {
+			continue // keep the previous state
+		}
+		if match && known[i] && !states[i] {
+			triggered = append(triggered, r.text)
+		}
+		states[i], known[i] = match, true
+	}
+	return triggered, states, known
+}
+
+func (t *WebhookTransmitter) commitRules(states, known []bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ruleStates, t.ruleKnown = states, known
+}
+
+// SetName names the webhook when several are configured: it is then
+// reported as "Webhook <name>" and spools to its own queue. Call it before
+// SetSpool.
+func (t *WebhookTransmitter) SetName(name string) {
+	t.name = name
+}
+
+// Name implements Transmitter.
+func (t *WebhookTransmitter) Name() string {
+	if t.name == "" {
+		return "Webhook"
+	}
+	return "Webhook " + t.name
+}
+
+// IsConnected reports whether the last delivery succeeded.
+func (t *WebhookTransmitter) IsConnected() bool {
+	return atomic.LoadUint32(&t.healthy) == 1
+}
+
+// Buffered implements BufferReporter: the bodies waiting in the spool.
+func (t *WebhookTransmitter) Buffered() int {
+	if t.spool == nil {
+		return 0
+	}
+	return t.spool.depth()
+}
+
+// SetSpool hands bodies that could not be delivered to s, which replays them
+// in order once the endpoint is back. Call it before the first Transmit.
+func (t *WebhookTransmitter) SetSpool(s *Spool) error {
+	queue := "webhook"
+	if t.name != "" {
+		queue += "-" + t.name
+	}
+	q, err := s.queue(queue, t.deliverSpooled, spoolQueueOptions{})
+	if err != nil {
+		return err
+	}
+	t.spool = q
+	return nil
+}
+
+// deliverSpooled makes one delivery attempt for the spool. Responses that
+// postWithRetry would not retry count as rejections.
+func (t *WebhookTransmitter) deliverSpooled(ctx context.Context, body []byte) error {
+	retry, err := t.post(ctx, body)
+	if err == nil {
+		atomic.StoreUint32(&t.healthy, 1)
+		return nil
+	}
+	if !retry {
+		return spoolRejection{err}
+	}
+	return err
+}
+
+// Close stops further deliveries; spooled bodies stay on disk.
+func (t *WebhookTransmitter) Close(context.Context) error {
+	return t.guard.close(func() error { return nil })
+}
+
+func (t *WebhookTransmitter) render(p WebhookPayload) ([]byte, error) {
+	if t.tmpl == nil {
+		body, err := json.Marshal(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal webhook payload: %w", err)
+		}
+		return body, nil
+	}
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, p); err != nil {
+		return nil, fmt.Errorf("failed to render webhook template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// postWithRetry retries network errors, 5xx, 408 and 429 responses with
+// exponential back-off; other non-2xx responses fail immediately.
+func (t *WebhookTransmitter) postWithRetry(ctx context.Context, body []byte) error {
+	backoff := webhookInitialBackoff
+	var lastErr error
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		retry, err := t.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || attempt == webhookMaxAttempts {
+			break
+		}
+		t.logger.WithError(err).Debugf("Webhook attempt %d failed – retrying in %s", attempt, backoff)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (gave up: %v)", lastErr, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return lastErr
+}
+
+// post performs one request. retry reports whether the failure is transient.
+func (t *WebhookTransmitter) post(ctx context.Context, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, t.httpClient.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "byd-hass/1.0.0")
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("webhook request failed: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
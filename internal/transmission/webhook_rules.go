@@ -0,0 +1,124 @@
+package transmission
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// webhookOperators in matching order: two-character operators first.
+var webhookOperators = []string{"<=", ">=", "!=", "==", "=", "<", ">"}
+
+// webhookRule is one BYD_HASS_WEBHOOK_RULES condition, e.g.
+// "battery_percentage<20" or "charging_status=charging".
+type webhookRule struct {
+	text  string
+	key   string // snake_case sensor key
+	op    string
+	num   float64
+	str   string
+	isNum bool
+}
+
+// parseWebhookRules parses comma-separated conditions of the form
+// key<op>value. key is a published sensor key (battery_percentage), a sensor
+// ID (33) or one of the derived charging_status and driving_state; op is one
+// of < <= > >= = == !=. Text values only support = and !=, and are compared
+// with the label for sensors that have a value map (gear_position=D).
+func parseWebhookRules(raw string) ([]webhookRule, error) {
+	var rules []webhookRule
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		r := webhookRule{text: entry}
+		idx := -1
+		for _, op := range webhookOperators {
+			if i := strings.Index(entry, op); i > 0 && (idx < 0 || i < idx) {
+				idx, r.op = i, op
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("webhook rule %q: expected key<op>value", entry)
+		}
+		r.key = strings.TrimSpace(entry[:idx])
+		value := strings.TrimSpace(entry[idx+len(r.op):])
+		if r.op == "==" {
+			r.op = "="
+		}
+		if id, err := strconv.Atoi(r.key); err == nil {
+			def := sensors.GetSensorByID(id)
+			if def == nil {
+				return nil, fmt.Errorf("webhook rule %q: unknown sensor ID %d", entry, id)
+			}
+			r.key = sensors.ToSnakeCase(def.FieldName)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("webhook rule %q: missing value", entry)
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			r.num, r.isNum = f, true
+		} else if r.op != "=" && r.op != "!=" {
+			return nil, fmt.Errorf("webhook rule %q: %s needs a number", entry, r.op)
+		} else {
+			r.str = value
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// eval reports whether the rule holds for values (raw numbers) and labelled
+// (the same with value maps applied). known is false when the sensor has no
+// value in this snapshot.
+func (r webhookRule) eval(values, labelled map[string]interface{}) (match, known bool) {
+	if r.isNum {
+		v, ok := values[r.key].(float64)
+		if !ok {
+			return false, false
+		}
+		switch r.op {
+		case "<":
+			return v < r.num, true
+		case "<=":
+			return v <= r.num, true
+		case ">":
+			return v > r.num, true
+		case ">=":
+			return v >= r.num, true
+		case "=":
+			return v == r.num, true
+		default:
+			return v != r.num, true
+		}
+	}
+	v, ok := labelled[r.key]
+	if !ok {
+		return false, false
+	}
+	eq := strings.EqualFold(fmt.Sprint(v), r.str)
+	if r.op == "=" {
+		return eq, true
+	}
+	return !eq, true
+}
+
+// ruleValues returns the values rules are evaluated against: the published
+// sensors plus the derived charging_status and driving_state, raw and with
+// value maps applied.
+func ruleValues(data *sensors.SensorData) (values, labelled map[string]interface{}) {
+	values = publishedValues(data)
+	values["charging_status"] = sensors.DeriveChargingStatus(data)
+	if data.DrivingState != nil {
+		values["driving_state"] = *data.DrivingState
+	}
+	labelled = make(map[string]interface{}, len(values))
+	for k, v := range values {
+		labelled[k] = v
+	}
+	labelValues(labelled)
+	return values, labelled
+}
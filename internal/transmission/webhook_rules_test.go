@@ -0,0 +1,137 @@
+package transmission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+func TestParseWebhookRules(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string // "key op value" per rule
+		wantErr bool
+	}{
+		{raw: "battery_percentage<20", want: "[battery_percentage < 20]"},
+		{raw: " 33 <= 20 , charging_status==charging", want: "[battery_percentage <= 20 charging_status = charging]"},
+		{raw: "gear_position!=P,speed>=100", want: "[gear_position != P speed >= 100]"},
+		{raw: "", want: "[]"},
+		{raw: "battery_percentage", wantErr: true},
+		{raw: "battery_percentage<", wantErr: true},
+		{raw: "gear_position<D", wantErr: true},
+		{raw: "9999=1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			rules, err := parseWebhookRules(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			got := []string{}
+			for _, r := range rules {
+				value := r.str
+				if r.isNum {
+					value = fmt.Sprint(r.num)
+				}
+				got = append(got, r.key+" "+r.op+" "+value)
+			}
+			if !tt.wantErr && fmt.Sprint(got) != tt.want {
+				t.Errorf("rules %q, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookRules(t *testing.T) {
+	// sample is one cycle: SoC, gear (0 = not reported) and the status the
+	// webhook answers with.
+	type sample struct {
+		soc, gear float64
+		status    int
+	}
+	tests := []struct {
+		name    string
+		rules   string
+		samples []sample
+		want    []string // triggered rules per POST
+	}{
+		{
+			name:    "low battery",
+			rules:   "battery_percentage<20",
+			samples: []sample{{25, 0, 200}, {19, 0, 200}, {18, 0, 200}, {25, 0, 200}, {15, 0, 200}},
+			want:    []string{"[battery_percentage<20]", "[battery_percentage<20]"},
+		},
+		{
+			name:    "no transition at startup",
+			rules:   "battery_percentage<20",
+			samples: []sample{{15, 0, 200}, {14, 0, 200}},
+		},
+		{
+			name:    "labelled gear",
+			rules:   "gear_position=D,battery_percentage<20",
+			samples: []sample{{50, 1, 200}, {50, 4, 200}, {19, 4, 200}},
+			want:    []string{"[gear_position=D]", "[battery_percentage<20]"},
+		},
+		{
+			name:    "sensor missing keeps the state",
+			rules:   "gear_position=D",
+			samples: []sample{{50, 1, 200}, {50, 0, 200}, {50, 4, 200}, {50, 0, 200}, {50, 4, 200}},
+			want:    []string{"[gear_position=D]"},
+		},
+		{
+			// The failed POST is not committed; it fires again next cycle.
+			name:    "failed delivery",
+			rules:   "battery_percentage<20",
+			samples: []sample{{25, 0, 200}, {19, 0, 400}, {18, 0, 200}, {17, 0, 200}},
+			want:    []string{"[battery_percentage<20]", "[battery_percentage<20]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := &fakeWebhook{}
+			srv := httptest.NewServer(hook)
+			defer srv.Close()
+			tx, err := NewWebhookTransmitter(srv.URL, "", "car", WebhookModeEvery, "", tt.rules, 5*time.Second, quietLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.samples {
+				if s.status != http.StatusOK {
+					hook.mu.Lock()
+					hook.statuses = append(hook.statuses, s.status)
+					hook.mu.Unlock()
+				}
+				soc := s.soc
+				data := &sensors.SensorData{Timestamp: time.Now(), BatteryPercentage: &soc}
+				if s.gear != 0 {
+					gear := s.gear
+					data.GearPosition = &gear
+				}
+				tx.Transmit(context.Background(), data)
+			}
+
+			bodies, _ := hook.received()
+			var got []string
+			for _, body := range bodies {
+				var p WebhookPayload
+				if err := json.Unmarshal([]byte(body), &p); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, fmt.Sprint(p.Triggered))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("triggered %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewWebhookTransmitter("http://127.0.0.1:1", "", "car", WebhookModeRules, "", "", time.Second, quietLogger()); err == nil {
+		t.Error("rules mode without rules accepted")
+	}
+}
@@ -0,0 +1,150 @@
+package transmission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+)
+
+// fakeWebhook records the bodies it receives and answers with the status
+// codes in order (200 once they run out).
+type fakeWebhook struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+	auth     []string
+}
+
+func (f *fakeWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bodies = append(f.bodies, string(body))
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+	status := http.StatusOK
+	if len(f.statuses) > 0 {
+		status, f.statuses = f.statuses[0], f.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (f *fakeWebhook) received() (bodies, auth []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.bodies...), append([]string(nil), f.auth...)
+}
+
+func TestWebhookModes(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		socs      []float64
+		wantPosts int
+	}{
+		{"every", WebhookModeEvery, []float64{80, 80, 79}, 3},
+		{"change", WebhookModeChange, []float64{80, 80, 79, 79}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := &fakeWebhook{}
+			srv := httptest.NewServer(hook)
+			defer srv.Close()
+			tx, err := NewWebhookTransmitter(srv.URL, "secret", "car", tt.mode, "", "", 5*time.Second, quietLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, soc := range tt.socs {
+				soc := soc
+				if err := tx.Transmit(context.Background(), &sensors.SensorData{Timestamp: time.Unix(1714557600, 0), BatteryPercentage: &soc}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			bodies, auth := hook.received()
+			if len(bodies) != tt.wantPosts {
+				t.Fatalf("%d posts, want %d", len(bodies), tt.wantPosts)
+			}
+			var p WebhookPayload
+			if err := json.Unmarshal([]byte(bodies[0]), &p); err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(p.DeviceID, " ", p.Timestamp.Unix(), " ", p.Sensors); got != "car 1714557600 map[battery_percentage:80]" {
+				t.Errorf("payload %s", got)
+			}
+			if auth[0] != "Bearer secret" {
+				t.Errorf("Authorization %q", auth[0])
+			}
+		})
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	hook := &fakeWebhook{}
+	srv := httptest.NewServer(hook)
+	defer srv.Close()
+	tx, err := NewWebhookTransmitter(srv.URL, "", "car", WebhookModeEvery, `{"car":"{{.DeviceID}}","data":{{json .Sensors}}}`, "", 5*time.Second, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	soc := 80.0
+	if err := tx.Transmit(context.Background(), &sensors.SensorData{Timestamp: time.Now(), BatteryPercentage: &soc}); err != nil {
+		t.Fatal(err)
+	}
+	bodies, auth := hook.received()
+	if want := `{"car":"car","data":{"battery_percentage":80}}`; len(bodies) != 1 || bodies[0] != want {
+		t.Fatalf("bodies %q, want %q", bodies, want)
+	}
+	if auth[0] != "" {
+		t.Errorf("Authorization %q without a token", auth[0])
+	}
+
+	if _, err := NewWebhookTransmitter(srv.URL, "", "car", WebhookModeEvery, "{{.Nope", "", time.Second, quietLogger()); err == nil {
+		t.Error("invalid template accepted")
+	}
+	if _, err := NewWebhookTransmitter(srv.URL, "", "car", "sometimes", "", "", time.Second, quietLogger()); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantPosts int
+		wantErr   bool
+	}{
+		{"server error is retried", []int{http.StatusBadGateway}, 2, false},
+		{"timeout is retried", []int{http.StatusRequestTimeout}, 2, false},
+		{"rate limit is retried", []int{http.StatusTooManyRequests}, 2, false},
+		{"client error is not", []int{http.StatusBadRequest}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := &fakeWebhook{statuses: tt.statuses}
+			srv := httptest.NewServer(hook)
+			defer srv.Close()
+			tx, err := NewWebhookTransmitter(srv.URL, "", "car", WebhookModeEvery, "", "", 5*time.Second, quietLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			soc := 80.0
+			err = tx.Transmit(context.Background(), &sensors.SensorData{Timestamp: time.Now(), BatteryPercentage: &soc})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if bodies, _ := hook.received(); len(bodies) != tt.wantPosts {
+				t.Errorf("%d posts, want %d", len(bodies), tt.wantPosts)
+			}
+			if tx.IsConnected() == tt.wantErr {
+				t.Errorf("IsConnected() = %v after err %v", tx.IsConnected(), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package transmission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	wsClientQueueSize = 16               // frames buffered per client before dropping the oldest
+	wsWriteTimeout    = 5 * time.Second  // per-frame write deadline
+	wsPingInterval    = 30 * time.Second // keep-alive for idle dashboards
+)
+
+// WebSocketTransmitter runs a small WebSocket server and pushes sensor updates
+// to every connected client. Each client receives a full snapshot on connect
+// followed by delta frames containing only the sensors that changed. Only
+// sensors listed in sensors.PublishedSensorIDs are exposed.
+type WebSocketTransmitter struct {
+	logger   *logrus.Logger
+	server   *http.Server
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+	last    map[string]interface{} // last broadcast values, used for snapshots and deltas
+	lastAt  time.Time
+
+	guard closeGuard
+}
+
+// wsFrame is the JSON envelope sent to dashboard clients.
+type wsFrame struct {
+	Type      string                 `json:"type"` // "snapshot" or "update"
+	Timestamp time.Time              `json:"timestamp"`
+	Sensors   map[string]interface{} `json:"sensors"`
+}
+
+// wsClient owns a bounded outgoing queue; the broadcast loop never blocks on it.
+type wsClient struct {
+	conn  *websocket.Conn
+	queue chan []byte
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewWebSocketTransmitter starts listening on listenAddr (e.g. ":8765") and
+// serves the stream on "/ws".
+func NewWebSocketTransmitter(listenAddr string, logger *logrus.Logger) (*WebSocketTransmitter, error) {
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listenAddr, err)
+	}
+
+	t := &WebSocketTransmitter{
+		logger:  logger,
+		clients: make(map[*wsClient]struct{}),
+		last:    make(map[string]interface{}),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 4096,
+			// Dashboards are typically served from a different origin (file://,
+			// local dev server); the stream carries no credentials.
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", t.handleConn)
+	t.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := t.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.WithError(err).Error("WebSocket server stopped")
+		}
+	}()
+
+	logger.WithField("listen", ln.Addr().String()).Info("WebSocket stream listening on /ws")
+	return t, nil
+}
+
+// Transmit broadcasts the published sensors that changed since the previous
+// call. Slow clients lose their oldest queued frames instead of stalling the
+// broadcast.
+func (t *WebSocketTransmitter) Transmit(_ context.Context, data *sensors.SensorData) error {
+	if t.guard.isClosed() {
+		return ErrClosed
+	}
+	values := publishedValues(data)
+
+	t.mu.Lock()
+	delta := make(map[string]interface{})
+	for k, v := range values {
+		if prev, ok := t.last[k]; !ok || !reflect.DeepEqual(prev, v) {
+			delta[k] = v
+		}
+	}
+	t.last = values
+	t.lastAt = data.Timestamp
+	clients := make([]*wsClient, 0, len(t.clients))
+	for c := range t.clients {
+		clients = append(clients, c)
+	}
+	t.mu.Unlock()
+
+	if len(delta) == 0 || len(clients) == 0 {
+		return nil
+	}
+
+	frame, err := json.Marshal(wsFrame{Type: "update", Timestamp: data.Timestamp, Sensors: delta})
+	if err != nil {
+		return fmt.Errorf("failed to marshal WebSocket frame: %w", err)
+	}
+	for _, c := range clients {
+		c.enqueue(frame)
+	}
+
+	t.logger.WithFields(logrus.Fields{
+		"clients": len(clients),
+		"changed": len(delta),
+	}).Debug("WebSocket update broadcast")
+	return nil
+}
+
+// Name implements Transmitter.
+func (t *WebSocketTransmitter) Name() string { return "WebSocket" }
+
+// IsConnected reports whether the server is accepting connections.
+func (t *WebSocketTransmitter) IsConnected() bool {
+	return t.server != nil
+}
+
+// ClientCount returns the number of connected dashboard clients.
+func (t *WebSocketTransmitter) ClientCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.clients)
+}
+
+// Close closes all client connections and shuts the server down.
+func (t *WebSocketTransmitter) Close(ctx context.Context) error {
+	return t.guard.close(func() error {
+		err := t.server.Shutdown(ctx)
+
+		t.mu.Lock()
+		for c := range t.clients {
+			c.close()
+		}
+		t.clients = make(map[*wsClient]struct{})
+		t.mu.Unlock()
+		return err
+	})
+}
+
+func (t *WebSocketTransmitter) handleConn(w http.ResponseWriter, r *http.Request) {
+	conn, err := t.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		t.logger.WithError(err).Debug("WebSocket upgrade failed")
+		return
+	}
+
+	c := &wsClient{
+		conn:  conn,
+		queue: make(chan []byte, wsClientQueueSize),
+		done:  make(chan struct{}),
+	}
+
+	// Register and queue the initial snapshot under the same lock so the
+	// client can't miss an update broadcast in between.
+	t.mu.Lock()
+	snapshot, err := json.Marshal(wsFrame{Type: "snapshot", Timestamp: t.lastAt, Sensors: t.last})
+	if err == nil {
+		c.enqueue(snapshot)
+	}
+	t.clients[c] = struct{}{}
+	count := len(t.clients)
+	t.mu.Unlock()
+
+	t.logger.WithFields(logrus.Fields{
+		"remote":  r.RemoteAddr,
+		"clients": count,
+	}).Debug("WebSocket client connected")
+
+	go t.writeLoop(c)
+	t.readLoop(c)
+
+	t.mu.Lock()
+	delete(t.clients, c)
+	t.mu.Unlock()
+	c.close()
+	t.logger.WithField("remote", r.RemoteAddr).Debug("WebSocket client disconnected")
+}
+
+// readLoop drains (and ignores) client messages so control frames are
+// processed; it returns when the client goes away.
+func (t *WebSocketTransmitter) readLoop(c *wsClient) {
+	c.conn.SetReadLimit(4096)
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (t *WebSocketTransmitter) writeLoop(c *wsClient) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case frame := <-c.queue:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+// enqueue adds a frame to the client's queue, discarding the oldest queued
+// frame when the queue is full.
+func (c *wsClient) enqueue(frame []byte) {
+	for {
+		select {
+		case c.queue <- frame:
+			return
+		default:
+		}
+		select {
+		case <-c.queue:
+		default:
+		}
+	}
+}
+
+func (c *wsClient) close() {
+	c.once.Do(func() {
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
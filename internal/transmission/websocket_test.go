@@ -0,0 +1,98 @@
+package transmission
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Allthebester/byd-hass/internal/sensors"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestWebSocketStream(t *testing.T) {
+	tx, err := NewWebSocketTransmitter("127.0.0.1:0", quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close(context.Background())
+	srv := httptest.NewServer(http.HandlerFunc(tx.handleConn))
+	defer srv.Close()
+
+	send := func(soc, speed float64) {
+		t.Helper()
+		data := &sensors.SensorData{Timestamp: time.Now(), BatteryPercentage: &soc, Speed: &speed}
+		if err := tx.Transmit(context.Background(), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Sent before anyone listens: only the snapshot carries it.
+	send(80, 0)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	read := func() string {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var frame wsFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(frame.Type, " ", frame.Sensors)
+	}
+
+	steps := []struct {
+		name       string
+		soc, speed float64 // sent before reading; negative: nothing sent
+		want       string
+	}{
+		{"snapshot on connect", -1, -1, "snapshot map[battery_percentage:80 speed:0]"},
+		{"only the change", 80, 42, "update map[speed:42]"},
+		// Nothing changed, so nothing is sent and the next frame is the
+		// battery update.
+		{"unchanged", 80, 42, ""},
+		{"next change", 79, 42, "update map[battery_percentage:79]"},
+	}
+	for _, st := range steps {
+		if st.soc >= 0 {
+			send(st.soc, st.speed)
+		}
+		if st.want == "" {
+			continue
+		}
+		if got := read(); got != st.want {
+			t.Errorf("%s: got %q, want %q", st.name, got, st.want)
+		}
+	}
+	if n := tx.ClientCount(); n != 1 {
+		t.Errorf("ClientCount() = %d, want 1", n)
+	}
+}
+
+func TestWSClientQueueDropsOldest(t *testing.T) {
+	c := &wsClient{queue: make(chan []byte, 2)}
+	for _, frame := range []string{"a", "b", "c"} {
+		c.enqueue([]byte(frame))
+	}
+	var got []string
+	for len(c.queue) > 0 {
+		got = append(got, string(<-c.queue))
+	}
+	if want := []string{"b", "c"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("queue %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+// Package units converts the metric values byd-hass works with into the unit
+// system shown in Home Assistant. Values are always converted from the metric
+// source, never from an earlier conversion, so switching back and forth does
+// not accumulate rounding errors.
+package units
+
+import "math"
+
+// System is a unit system: Metric or Imperial.
+type System string
+
+const (
+	Metric   System = "metric"
+	Imperial System = "imperial"
+)
+
+// Auto is the setting that follows the car's display (see FromTemperatureUnit).
+const Auto = "auto"
+
+// conversion turns a metric value into its imperial counterpart:
+// v*factor + offset.
+type conversion struct {
+	unit   string
+	factor float64
+	offset float64
+}
+
+// imperial maps each metric unit to its imperial counterpart. Units missing
+// here (%, kWh, kW, V, min, ...) are the same in both systems.
+var imperial = map[string]conversion{
+	"°C":        {"°F", 1.8, 32},
+	"km":        {"mi", 1 / 1.609344, 0},
+	"km/h":      {"mph", 1 / 1.609344, 0},
+	"m":         {"ft", 1 / 0.3048, 0},
+	"bar":       {"psi", 14.503773773, 0},
+	"kPa":       {"psi", 0.14503773773, 0},
+	"Wh/km":     {"Wh/mi", 1.609344, 0},
+	"kWh/100km": {"kWh/100mi", 1.609344, 0},
+}
+
+// Parse returns the system named s and whether s names one.
+func Parse(s string) (System, bool) {
+	switch System(s) {
+	case Metric, Imperial:
+		return System(s), true
+	}
+	return Metric, false
+}
+
+// FromTemperatureUnit returns the system the car displays, given the value
+// of its TemperatureUnit sensor (28). The head unit reports 1 for Celsius and
+// 2 for Fahrenheit; it has no separate distance setting, so Fahrenheit is
+// taken to mean imperial throughout.
+func FromTemperatureUnit(v float64) System {
+	if v == 2 {
+		return Imperial
+	}
+	return Metric
+}
+
+// Resolve returns the system for setting: "metric", "imperial" or Auto.
+// Auto follows the car's TemperatureUnit reading (nil while unknown) and
+// keeps last until the car reports one.
+func Resolve(setting string, temperatureUnit *float64, last System) System {
+	if setting == Auto {
+		if temperatureUnit != nil {
+			return FromTemperatureUnit(*temperatureUnit)
+		}
+		if last != "" {
+			return last
+		}
+		return Metric
+	}
+	s, _ := Parse(setting)
+	return s
+}
+
+// Unit returns the unit a value given in the metric unit is shown in.
+func (s System) Unit(unit string) string {
+	if c, ok := s.conversion(unit); ok {
+		return c.unit
+	}
+	return unit
+}
+
+// Convert converts v, given in the metric unit, to s.
+func (s System) Convert(v float64, unit string) float64 {
+	if c, ok := s.conversion(unit); ok {
+		return v*c.factor + c.offset
+	}
+	return v
+}
+
+// ConvertDelta converts a difference between two values, e.g. a temperature
+// spread, which scales like Convert but has no offset.
+func (s System) ConvertDelta(v float64, unit string) float64 {
+	if c, ok := s.conversion(unit); ok {
+		return v * c.factor
+	}
+	return v
+}
+
+// ToMetric is the inverse of Convert.
+func (s System) ToMetric(v float64, unit string) float64 {
+	if c, ok := s.conversion(unit); ok {
+		return (v - c.offset) / c.factor
+	}
+	return v
+}
+
+func (s System) conversion(unit string) (conversion, bool) {
+	if s != Imperial {
+		return conversion{}, false
+	}
+	c, ok := imperial[unit]
+	return c, ok
+}
+
+// Round rounds a converted value to the given number of decimals. A metric
+// value rounded to whole kilometres is not a whole number of miles, so
+// outputs round again after converting.
+func Round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,110 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		unit     string
+		metric   float64
+		want     float64
+		wantUnit string
+	}{
+		{"°C", 0, 32, "°F"},
+		{"°C", 100, 212, "°F"},
+		{"°C", -40, -40, "°F"},
+		{"km", 1.609344, 1, "mi"},
+		{"km/h", 100, 62.137, "mph"},
+		{"m", 0.3048, 1, "ft"},
+		{"bar", 2.5, 36.259, "psi"},
+		{"kPa", 250, 36.259, "psi"},
+		{"kWh/100km", 15, 24.14, "kWh/100mi"},
+		{"Wh/km", 150, 241.402, "Wh/mi"},
+		{"%", 80, 80, "%"},
+		{"kW", 7.4, 7.4, "kW"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			if got := Imperial.Convert(tt.metric, tt.unit); Round(got, 3) != tt.want {
+				t.Errorf("Convert(%g %s) = %g, want %g", tt.metric, tt.unit, got, tt.want)
+			}
+			if got := Imperial.Unit(tt.unit); got != tt.wantUnit {
+				t.Errorf("Unit(%s) = %s, want %s", tt.unit, got, tt.wantUnit)
+			}
+			if got := Metric.Convert(tt.metric, tt.unit); got != tt.metric {
+				t.Errorf("metric Convert(%g %s) = %g, want it unchanged", tt.metric, tt.unit, got)
+			}
+			if got := Metric.Unit(tt.unit); got != tt.unit {
+				t.Errorf("metric Unit(%s) = %s", tt.unit, got)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	values := []float64{-40, -12.5, 0, 0.1, 1, 21.7, 100, 123456.7}
+	for unit := range imperial {
+		for _, v := range values {
+			back := Imperial.ToMetric(Imperial.Convert(v, unit), unit)
+			if math.Abs(back-v) > 1e-9*math.Max(1, math.Abs(v)) {
+				t.Errorf("%g %s → %g after a round trip", v, unit, back)
+			}
+		}
+	}
+}
+
+func TestConvertDelta(t *testing.T) {
+	// A 10 °C spread is 18 °F, not 50.
+	if got := Imperial.ConvertDelta(10, "°C"); got != 18 {
+		t.Errorf("ConvertDelta(10 °C) = %g, want 18", got)
+	}
+	if got := Imperial.ConvertDelta(1.609344, "km"); Round(got, 9) != 1 {
+		t.Errorf("ConvertDelta(1.609344 km) = %g, want 1", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	celsius, fahrenheit := 1.0, 2.0
+	tests := []struct {
+		name    string
+		setting string
+		unit    *float64
+		last    System
+		want    System
+	}{
+		{"metric", "metric", &fahrenheit, Imperial, Metric},
+		{"imperial", "imperial", &celsius, Metric, Imperial},
+		{"unknown setting", "nautical", nil, Imperial, Metric},
+		{"auto follows Fahrenheit", Auto, &fahrenheit, Metric, Imperial},
+		{"auto follows Celsius", Auto, &celsius, Imperial, Metric},
+		{"auto keeps the last system", Auto, nil, Imperial, Imperial},
+		{"auto defaults to metric", Auto, nil, "", Metric},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Resolve(tt.setting, tt.unit, tt.last); got != tt.want {
+				t.Errorf("Resolve = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		v        float64
+		decimals int
+		want     float64
+	}{
+		{62.1371192, 1, 62.1},
+		{62.15, 0, 62},
+		{-3.456, 2, -3.46},
+		{1234.5, -1, 1230},
+	}
+	for _, tt := range tests {
+		if got := Round(tt.v, tt.decimals); got != tt.want {
+			t.Errorf("Round(%g, %d) = %g, want %g", tt.v, tt.decimals, got, tt.want)
+		}
+	}
+}